@@ -0,0 +1,37 @@
+package config
+
+import (
+	"os"
+	"strings"
+)
+
+// Email verification enforcement modes, configured through EMAIL_VERIFICATION_REQUIRED
+const (
+	// EmailVerificationOptional lets unverified users use the whole API
+	EmailVerificationOptional = "optional"
+	// EmailVerificationPro blocks pro features until the email is verified
+	EmailVerificationPro = "pro"
+	// EmailVerificationLogin blocks login until the email is verified
+	EmailVerificationLogin = "login"
+)
+
+// EmailVerificationMode returns the configured email verification enforcement mode
+func EmailVerificationMode() string {
+	switch mode := strings.ToLower(os.Getenv("EMAIL_VERIFICATION_REQUIRED")); mode {
+	case EmailVerificationPro, EmailVerificationLogin:
+		return mode
+	default:
+		return EmailVerificationOptional
+	}
+}
+
+// RequireVerifiedEmailForLogin reports whether unverified users are refused at login
+func RequireVerifiedEmailForLogin() bool {
+	return EmailVerificationMode() == EmailVerificationLogin
+}
+
+// RequireVerifiedEmailForPro reports whether pro features require a verified email
+func RequireVerifiedEmailForPro() bool {
+	mode := EmailVerificationMode()
+	return mode == EmailVerificationPro || mode == EmailVerificationLogin
+}
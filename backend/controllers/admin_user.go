@@ -0,0 +1,327 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"mobile-backend/models"
+	"mobile-backend/services"
+	"mobile-backend/utils"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// AdminUserController lets administrators search, inspect and suspend user accounts
+type AdminUserController struct {
+	adminUserService *services.AdminUserService
+	auditService     *services.AuditService
+	logger           *zap.Logger
+}
+
+// NewAdminUserController creates a new admin user controller
+func NewAdminUserController(adminUserService *services.AdminUserService, auditService *services.AuditService, logger *zap.Logger) *AdminUserController {
+	return &AdminUserController{
+		adminUserService: adminUserService,
+		auditService:     auditService,
+		logger:           logger,
+	}
+}
+
+// SuspendUserRequest explains why an account is being suspended
+type SuspendUserRequest struct {
+	Reason string `json:"reason" binding:"required,min=3,max=500"`
+}
+
+// BulkUserActionRequest applies one action to many users
+type BulkUserActionRequest struct {
+	Action  string `json:"action" binding:"required,oneof=suspend reactivate force_password_reset revoke_sessions"`
+	UserIDs []uint `json:"user_ids" binding:"required,min=1,max=1000,dive,min=1"`
+	Reason  string `json:"reason" binding:"required_if=Action suspend,max=500"`
+}
+
+// ListUsers godoc
+// @Summary List users
+// @Description Search and page through all users. Search matches email and name. Sort accepts id, email, name, created_at, updated_at and last_login, optionally as "field:direction" pairs separated by commas.
+// @Tags admin
+// @Produce json
+// @Security BearerAuth
+// @Param page query int false "Page number" default(1)
+// @Param limit query int false "Items per page" default(20)
+// @Param sort query string false "Sort fields" default(created_at)
+// @Param order query string false "Sort direction" Enums(asc, desc) default(desc)
+// @Param search query string false "Search email and name"
+// @Param is_active query bool false "Filter by active status"
+// @Param is_pro query bool false "Filter by pro status"
+// @Param email_verified query bool false "Filter by verified email"
+// @Param suspended query bool false "Filter by suspension"
+// @Param locked query bool false "Filter by failed-login lockout"
+// @Param password_reset_required query bool false "Filter by forced password reset"
+// @Param subscription_status query string false "Filter by subscription status"
+// @Param role query string false "Filter by role name"
+// @Param created_after query string false "Created at or after (RFC 3339)"
+// @Param created_before query string false "Created before (RFC 3339)"
+// @Success 200 {object} utils.PaginatedResponse{data=[]models.User}
+// @Failure 400 {object} utils.ErrorResponse
+// @Failure 401 {object} utils.ErrorResponse
+// @Failure 403 {object} utils.ErrorResponse
+// @Failure 500 {object} utils.ErrorResponse
+// @Router /api/v1/admin/users [get]
+func (auc *AdminUserController) ListUsers(c *gin.Context) {
+	req := utils.GetPaginationFromQuery(c)
+
+	users, total, err := auc.adminUserService.ListUsers(c.Request.Context(), req)
+	if err != nil {
+		if errors.Is(err, services.ErrInvalidUserFilter) {
+			utils.SendErrorResponse(c, http.StatusBadRequest, err.Error(), nil)
+			return
+		}
+		auc.logger.Error("Failed to list users", zap.Error(err))
+		utils.SendInternalServerErrorResponse(c, "Failed to list users")
+		return
+	}
+
+	pagination := utils.CalculatePagination(req.Page, req.Limit, total)
+	pagination.Sort = req.Sort
+	pagination.Order = req.Order
+	pagination.Search = req.Search
+	pagination.FilterCount = len(req.Filters)
+	utils.SendPaginatedResponse(c, users, pagination, "Users retrieved successfully")
+}
+
+// GetUser godoc
+// @Summary Get a user's account overview
+// @Description Get a user together with their roles, active sessions, subscriptions, devices, push tokens and offline sync status
+// @Tags admin
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "User ID"
+// @Success 200 {object} utils.SuccessResponse{data=services.UserOverview}
+// @Failure 400 {object} utils.ErrorResponse
+// @Failure 401 {object} utils.ErrorResponse
+// @Failure 403 {object} utils.ErrorResponse
+// @Failure 404 {object} utils.ErrorResponse
+// @Failure 500 {object} utils.ErrorResponse
+// @Router /api/v1/admin/users/{id} [get]
+func (auc *AdminUserController) GetUser(c *gin.Context) {
+	userID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		utils.SendErrorResponse(c, http.StatusBadRequest, "Invalid user ID", nil)
+		return
+	}
+
+	overview, err := auc.adminUserService.GetUserOverview(c.Request.Context(), uint(userID))
+	if err != nil {
+		if errors.Is(err, services.ErrUserNotFound) {
+			utils.SendNotFoundResponse(c, "User not found")
+			return
+		}
+		auc.logger.Error("Failed to load user overview", zap.Error(err))
+		utils.SendInternalServerErrorResponse(c, "Failed to load user")
+		return
+	}
+
+	utils.SendSuccessResponse(c, overview, "User retrieved successfully")
+}
+
+// SuspendUser godoc
+// @Summary Suspend a user
+// @Description Deactivate a user's account and sign them out everywhere. Suspended users cannot log in and their tokens are refused until they are reactivated.
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "User ID"
+// @Param request body SuspendUserRequest true "Suspension reason"
+// @Success 200 {object} utils.SuccessResponse{data=models.User}
+// @Failure 400 {object} utils.ErrorResponse
+// @Failure 401 {object} utils.ErrorResponse
+// @Failure 403 {object} utils.ErrorResponse
+// @Failure 404 {object} utils.ErrorResponse
+// @Failure 500 {object} utils.ErrorResponse
+// @Router /api/v1/admin/users/{id}/suspend [post]
+func (auc *AdminUserController) SuspendUser(c *gin.Context) {
+	userID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		utils.SendErrorResponse(c, http.StatusBadRequest, "Invalid user ID", nil)
+		return
+	}
+
+	var req SuspendUserRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.SendValidationErrorResponse(c, parseValidationErrors(err))
+		return
+	}
+
+	user, err := auc.adminUserService.SuspendUser(c.Request.Context(), uint(userID), c.GetUint("user_id"), req.Reason)
+	if err != nil {
+		switch {
+		case errors.Is(err, services.ErrUserNotFound):
+			utils.SendNotFoundResponse(c, "User not found")
+		case errors.Is(err, services.ErrCannotSuspendSelf):
+			utils.SendErrorResponse(c, http.StatusBadRequest, "You cannot suspend your own account", nil)
+		default:
+			auc.logger.Error("Failed to suspend user", zap.Error(err))
+			utils.SendInternalServerErrorResponse(c, "Failed to suspend user")
+		}
+		return
+	}
+
+	event := newAuditEvent(c, models.AuditActionUserSuspended, "user", auditID(user.ID))
+	event.Metadata["reason"] = req.Reason
+	auc.auditService.Record(c.Request.Context(), event)
+
+	utils.SendSuccessResponse(c, user, "User suspended successfully")
+}
+
+// ReactivateUser godoc
+// @Summary Reactivate a user
+// @Description Lift a suspension so the user can log in again
+// @Tags admin
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "User ID"
+// @Success 200 {object} utils.SuccessResponse{data=models.User}
+// @Failure 400 {object} utils.ErrorResponse
+// @Failure 401 {object} utils.ErrorResponse
+// @Failure 403 {object} utils.ErrorResponse
+// @Failure 404 {object} utils.ErrorResponse
+// @Failure 500 {object} utils.ErrorResponse
+// @Router /api/v1/admin/users/{id}/reactivate [post]
+func (auc *AdminUserController) ReactivateUser(c *gin.Context) {
+	userID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		utils.SendErrorResponse(c, http.StatusBadRequest, "Invalid user ID", nil)
+		return
+	}
+
+	user, err := auc.adminUserService.ReactivateUser(c.Request.Context(), uint(userID), c.GetUint("user_id"))
+	if err != nil {
+		if errors.Is(err, services.ErrUserNotFound) {
+			utils.SendNotFoundResponse(c, "User not found")
+			return
+		}
+		auc.logger.Error("Failed to reactivate user", zap.Error(err))
+		utils.SendInternalServerErrorResponse(c, "Failed to reactivate user")
+		return
+	}
+
+	auc.auditService.Record(c.Request.Context(), newAuditEvent(c, models.AuditActionUserReactivated, "user", auditID(user.ID)))
+
+	utils.SendSuccessResponse(c, user, "User reactivated successfully")
+}
+
+// ForcePasswordReset godoc
+// @Summary Force a password reset
+// @Description Sign the user out everywhere and refuse password logins until they set a new password through the reset link emailed to them
+// @Tags admin
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "User ID"
+// @Success 200 {object} utils.SuccessResponse
+// @Failure 400 {object} utils.ErrorResponse
+// @Failure 401 {object} utils.ErrorResponse
+// @Failure 403 {object} utils.ErrorResponse
+// @Failure 404 {object} utils.ErrorResponse
+// @Failure 500 {object} utils.ErrorResponse
+// @Router /api/v1/admin/users/{id}/force-password-reset [post]
+func (auc *AdminUserController) ForcePasswordReset(c *gin.Context) {
+	userID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		utils.SendErrorResponse(c, http.StatusBadRequest, "Invalid user ID", nil)
+		return
+	}
+
+	if err := auc.adminUserService.ForcePasswordReset(c.Request.Context(), uint(userID), c.GetUint("user_id")); err != nil {
+		if errors.Is(err, services.ErrUserNotFound) {
+			utils.SendNotFoundResponse(c, "User not found")
+			return
+		}
+		auc.logger.Error("Failed to force password reset", zap.Error(err))
+		utils.SendInternalServerErrorResponse(c, "Failed to force password reset")
+		return
+	}
+
+	auc.auditService.Record(c.Request.Context(), newAuditEvent(c, models.AuditActionPasswordResetForced, "user", auditID(uint(userID))))
+
+	utils.SendSuccessResponse(c, nil, "Password reset required")
+}
+
+// BulkAction godoc
+// @Summary Run an action on many users
+// @Description Suspend, reactivate, force a password reset for or sign out up to 1000 users in a background job. Poll the returned bulk action for per-user results. A reason is required to suspend.
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param request body BulkUserActionRequest true "Bulk action"
+// @Success 202 {object} utils.SuccessResponse{data=models.BulkUserAction}
+// @Failure 400 {object} utils.ErrorResponse
+// @Failure 401 {object} utils.ErrorResponse
+// @Failure 403 {object} utils.ErrorResponse
+// @Failure 500 {object} utils.ErrorResponse
+// @Router /api/v1/admin/users/bulk [post]
+func (auc *AdminUserController) BulkAction(c *gin.Context) {
+	var req BulkUserActionRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.SendValidationErrorResponse(c, parseValidationErrors(err))
+		return
+	}
+
+	bulk, err := auc.adminUserService.QueueBulkAction(c.Request.Context(), c.GetUint("user_id"), req.Action, req.UserIDs, req.Reason)
+	if err != nil {
+		if errors.Is(err, services.ErrInvalidBulkAction) || errors.Is(err, services.ErrTooManyBulkActionUsers) {
+			utils.SendErrorResponse(c, http.StatusBadRequest, err.Error(), nil)
+			return
+		}
+		auc.logger.Error("Failed to queue bulk user action", zap.Error(err))
+		utils.SendInternalServerErrorResponse(c, "Failed to queue bulk user action")
+		return
+	}
+
+	event := newAuditEvent(c, models.AuditActionBulkUserAction, "bulk_user_action", auditID(bulk.ID))
+	event.Metadata["action"] = bulk.Action
+	event.Metadata["user_count"] = len(bulk.UserIDs)
+	if bulk.Reason != "" {
+		event.Metadata["reason"] = bulk.Reason
+	}
+	auc.auditService.Record(c.Request.Context(), event)
+
+	utils.SendAcceptedResponse(c, bulk, "Bulk user action queued")
+}
+
+// GetBulkAction godoc
+// @Summary Get a bulk user action
+// @Description Get the status of a bulk user action and, once it has run, the result for each user
+// @Tags admin
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "Bulk action ID"
+// @Success 200 {object} utils.SuccessResponse{data=models.BulkUserAction}
+// @Failure 400 {object} utils.ErrorResponse
+// @Failure 401 {object} utils.ErrorResponse
+// @Failure 403 {object} utils.ErrorResponse
+// @Failure 404 {object} utils.ErrorResponse
+// @Failure 500 {object} utils.ErrorResponse
+// @Router /api/v1/admin/users/bulk/{id} [get]
+func (auc *AdminUserController) GetBulkAction(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		utils.SendErrorResponse(c, http.StatusBadRequest, "Invalid bulk action ID", nil)
+		return
+	}
+
+	bulk, err := auc.adminUserService.GetBulkAction(c.Request.Context(), uint(id))
+	if err != nil {
+		if errors.Is(err, services.ErrBulkActionNotFound) {
+			utils.SendNotFoundResponse(c, "Bulk action not found")
+			return
+		}
+		auc.logger.Error("Failed to load bulk user action", zap.Error(err))
+		utils.SendInternalServerErrorResponse(c, "Failed to load bulk action")
+		return
+	}
+
+	utils.SendSuccessResponse(c, bulk, "Bulk action retrieved successfully")
+}
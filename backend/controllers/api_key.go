@@ -0,0 +1,162 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"mobile-backend/models"
+	"mobile-backend/services"
+	"mobile-backend/utils"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// APIKeyController manages the current user's API keys
+type APIKeyController struct {
+	apiKeyService *services.APIKeyService
+	logger        *zap.Logger
+}
+
+// NewAPIKeyController creates a new API key controller
+func NewAPIKeyController(apiKeyService *services.APIKeyService, logger *zap.Logger) *APIKeyController {
+	return &APIKeyController{
+		apiKeyService: apiKeyService,
+		logger:        logger,
+	}
+}
+
+type CreateAPIKeyRequest struct {
+	Name      string     `json:"name" binding:"required,max=100"`
+	Scopes    []string   `json:"scopes" binding:"required,min=1"`
+	ExpiresAt *time.Time `json:"expires_at"`
+}
+
+// APIKeyResponse describes an API key. Key holds the raw key and is only set when the
+// key is created.
+type APIKeyResponse struct {
+	ID         uint       `json:"id"`
+	Name       string     `json:"name"`
+	Prefix     string     `json:"prefix"`
+	Key        string     `json:"key,omitempty"`
+	Scopes     []string   `json:"scopes"`
+	ExpiresAt  *time.Time `json:"expires_at,omitempty"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+	LastUsedIP string     `json:"last_used_ip,omitempty"`
+	RevokedAt  *time.Time `json:"revoked_at,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+}
+
+// CreateKey godoc
+// @Summary Create an API key
+// @Description Create an API key for server-to-server calls. Keys are sent in the X-API-Key header and can only call route groups matching their scopes (profile, uploads, sync). The key is returned only once.
+// @Tags api-keys
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param request body CreateAPIKeyRequest true "Key name, scopes and optional expiry"
+// @Success 201 {object} utils.SuccessResponse{data=APIKeyResponse}
+// @Failure 400 {object} utils.ErrorResponse
+// @Failure 401 {object} utils.ErrorResponse
+// @Failure 500 {object} utils.ErrorResponse
+// @Router /api/v1/auth/api-keys [post]
+func (ac *APIKeyController) CreateKey(c *gin.Context) {
+	var req CreateAPIKeyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.SendValidationErrorResponse(c, parseValidationErrors(err))
+		return
+	}
+
+	key, raw, err := ac.apiKeyService.CreateKey(c.Request.Context(), c.GetUint("user_id"), nil, req.Name, req.Scopes, req.ExpiresAt)
+	if err != nil {
+		if errors.Is(err, services.ErrInvalidAPIKeyScope) || errors.Is(err, services.ErrInvalidAPIKeyExpiry) {
+			utils.SendErrorResponse(c, http.StatusBadRequest, err.Error(), map[string]interface{}{
+				"valid_scopes": models.APIKeyScopes,
+			})
+			return
+		}
+		ac.logger.Error("Failed to create API key", zap.Error(err))
+		utils.SendInternalServerErrorResponse(c, "Failed to create API key")
+		return
+	}
+
+	response := newAPIKeyResponse(key)
+	response.Key = raw
+	utils.SendCreatedResponse(c, response, "API key created. Store it now, it will not be shown again.")
+}
+
+// ListKeys godoc
+// @Summary List API keys
+// @Description List the current user's API keys, including revoked and expired ones
+// @Tags api-keys
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {object} utils.SuccessResponse{data=[]APIKeyResponse}
+// @Failure 401 {object} utils.ErrorResponse
+// @Failure 500 {object} utils.ErrorResponse
+// @Router /api/v1/auth/api-keys [get]
+func (ac *APIKeyController) ListKeys(c *gin.Context) {
+	keys, err := ac.apiKeyService.ListKeys(c.Request.Context(), c.GetUint("user_id"))
+	if err != nil {
+		ac.logger.Error("Failed to list API keys", zap.Error(err))
+		utils.SendInternalServerErrorResponse(c, "Failed to list API keys")
+		return
+	}
+
+	response := make([]APIKeyResponse, 0, len(keys))
+	for i := range keys {
+		response = append(response, newAPIKeyResponse(&keys[i]))
+	}
+	utils.SendSuccessResponse(c, response, "API keys retrieved successfully")
+}
+
+// RevokeKey godoc
+// @Summary Revoke an API key
+// @Description Revoke one of the current user's API keys. Requests using it are rejected immediately.
+// @Tags api-keys
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "API key ID"
+// @Success 200 {object} utils.SuccessResponse
+// @Failure 400 {object} utils.ErrorResponse
+// @Failure 401 {object} utils.ErrorResponse
+// @Failure 404 {object} utils.ErrorResponse
+// @Failure 500 {object} utils.ErrorResponse
+// @Router /api/v1/auth/api-keys/{id} [delete]
+func (ac *APIKeyController) RevokeKey(c *gin.Context) {
+	keyID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		utils.SendErrorResponse(c, http.StatusBadRequest, "Invalid API key ID", nil)
+		return
+	}
+
+	if err := ac.apiKeyService.RevokeKey(c.Request.Context(), c.GetUint("user_id"), uint(keyID)); err != nil {
+		if errors.Is(err, services.ErrAPIKeyNotFound) {
+			utils.SendNotFoundResponse(c, "API key not found")
+			return
+		}
+		ac.logger.Error("Failed to revoke API key", zap.Error(err))
+		utils.SendInternalServerErrorResponse(c, "Failed to revoke API key")
+		return
+	}
+
+	utils.SendSuccessResponse(c, nil, "API key revoked successfully")
+}
+
+func newAPIKeyResponse(key *models.APIKey) APIKeyResponse {
+	return APIKeyResponse{
+		ID:         key.ID,
+		Name:       key.Name,
+		Prefix:     key.Prefix,
+		Scopes:     key.ScopeList(),
+		ExpiresAt:  key.ExpiresAt,
+		LastUsedAt: key.LastUsedAt,
+		LastUsedIP: key.LastUsedIP,
+		RevokedAt:  key.RevokedAt,
+		CreatedAt:  key.CreatedAt,
+	}
+}
@@ -0,0 +1,390 @@
+package controllers
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"mobile-backend/config"
+	"mobile-backend/models"
+	"mobile-backend/services"
+	"mobile-backend/utils"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+// AuditController exposes the audit log to administrators
+type AuditController struct {
+	auditService *services.AuditService
+	logger       *zap.Logger
+}
+
+// NewAuditController creates a new audit controller
+func NewAuditController(auditService *services.AuditService, logger *zap.Logger) *AuditController {
+	return &AuditController{
+		auditService: auditService,
+		logger:       logger,
+	}
+}
+
+// auditCSVHeader lists the columns of a CSV export
+var auditCSVHeader = []string{
+	"id", "created_at", "actor_id", "actor_type", "actor_email", "action", "resource_type", "resource_id",
+	"organization_id", "before", "after", "metadata", "ip_address", "user_agent", "request_id", "prev_hash", "hash",
+}
+
+// ListEvents godoc
+// @Summary List audit events
+// @Description List audit events, newest first, filtered by actor, action, resource, organization and time range. An action ending in ".*" matches a whole category, such as "auth.*".
+// @Tags admin
+// @Produce json
+// @Security BearerAuth
+// @Param actor_id query int false "Actor user ID"
+// @Param action query string false "Action, or category such as auth.*"
+// @Param resource_type query string false "Resource type"
+// @Param resource_id query string false "Resource ID"
+// @Param organization_id query int false "Organization ID"
+// @Param from query string false "Start of the time range (RFC 3339, inclusive)"
+// @Param to query string false "End of the time range (RFC 3339, exclusive)"
+// @Param page query int false "Page number" default(1)
+// @Param limit query int false "Items per page" default(20)
+// @Success 200 {object} utils.PaginatedResponse{data=[]models.AuditEvent}
+// @Failure 400 {object} utils.ErrorResponse
+// @Failure 401 {object} utils.ErrorResponse
+// @Failure 403 {object} utils.ErrorResponse
+// @Failure 500 {object} utils.ErrorResponse
+// @Router /api/v1/admin/audit-events [get]
+func (ac *AuditController) ListEvents(c *gin.Context) {
+	filter, err := parseAuditFilter(c)
+	if err != nil {
+		utils.SendErrorResponse(c, http.StatusBadRequest, err.Error(), nil)
+		return
+	}
+
+	events, total, err := ac.auditService.ListEvents(c.Request.Context(), filter)
+	if err != nil {
+		if errors.Is(err, services.ErrInvalidAuditFilter) {
+			utils.SendErrorResponse(c, http.StatusBadRequest, err.Error(), nil)
+			return
+		}
+		ac.logger.Error("Failed to list audit events", zap.Error(err))
+		utils.SendInternalServerErrorResponse(c, "Failed to list audit events")
+		return
+	}
+
+	pagination := utils.CalculatePagination(filter.Page, filter.Limit, total)
+	utils.SendPaginatedResponse(c, events, pagination, "Audit events retrieved successfully")
+}
+
+// ExportEvents godoc
+// @Summary Export audit events
+// @Description Download every audit event matching the filters, oldest first, as CSV or JSON
+// @Tags admin
+// @Produce json
+// @Produce text/csv
+// @Security BearerAuth
+// @Param format query string false "Export format" Enums(csv, json) default(csv)
+// @Param actor_id query int false "Actor user ID"
+// @Param action query string false "Action, or category such as auth.*"
+// @Param resource_type query string false "Resource type"
+// @Param resource_id query string false "Resource ID"
+// @Param organization_id query int false "Organization ID"
+// @Param from query string false "Start of the time range (RFC 3339, inclusive)"
+// @Param to query string false "End of the time range (RFC 3339, exclusive)"
+// @Success 200 {array} models.AuditEvent
+// @Failure 400 {object} utils.ErrorResponse
+// @Failure 401 {object} utils.ErrorResponse
+// @Failure 403 {object} utils.ErrorResponse
+// @Router /api/v1/admin/audit-events/export [get]
+func (ac *AuditController) ExportEvents(c *gin.Context) {
+	format := c.DefaultQuery("format", "csv")
+	if format != "csv" && format != "json" {
+		utils.SendErrorResponse(c, http.StatusBadRequest, "Format must be csv or json", nil)
+		return
+	}
+
+	filter, err := parseAuditFilter(c)
+	if err != nil {
+		utils.SendErrorResponse(c, http.StatusBadRequest, err.Error(), nil)
+		return
+	}
+
+	filename := "audit-events-" + time.Now().UTC().Format("20060102T150405Z") + "." + format
+	c.Header("Content-Disposition", `attachment; filename="`+filename+`"`)
+
+	// The body is streamed, so failures after the first event can only be logged
+	if format == "json" {
+		c.Header("Content-Type", "application/json")
+		err = ac.exportJSON(c, filter)
+	} else {
+		c.Header("Content-Type", "text/csv")
+		err = ac.exportCSV(c, filter)
+	}
+	if err != nil {
+		ac.logger.Error("Failed to export audit events", zap.Error(err))
+		if !c.Writer.Written() {
+			c.Header("Content-Disposition", "")
+			c.Header("Content-Type", "")
+			if errors.Is(err, services.ErrInvalidAuditFilter) {
+				utils.SendErrorResponse(c, http.StatusBadRequest, err.Error(), nil)
+				return
+			}
+			utils.SendInternalServerErrorResponse(c, "Failed to export audit events")
+		}
+	}
+}
+
+func (ac *AuditController) exportJSON(c *gin.Context, filter services.AuditFilter) error {
+	first := true
+	err := ac.auditService.ExportEvents(c.Request.Context(), filter, func(event *models.AuditEvent) error {
+		data, err := json.Marshal(event)
+		if err != nil {
+			return err
+		}
+		prefix := ","
+		if first {
+			prefix = "["
+			first = false
+		}
+		_, err = c.Writer.Write(append([]byte(prefix), data...))
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	closing := "]"
+	if first {
+		closing = "[]"
+	}
+	_, err = c.Writer.Write([]byte(closing))
+	return err
+}
+
+func (ac *AuditController) exportCSV(c *gin.Context, filter services.AuditFilter) error {
+	writer := csv.NewWriter(c.Writer)
+	wroteHeader := false
+	err := ac.auditService.ExportEvents(c.Request.Context(), filter, func(event *models.AuditEvent) error {
+		if !wroteHeader {
+			if err := writer.Write(auditCSVHeader); err != nil {
+				return err
+			}
+			wroteHeader = true
+		}
+		return writer.Write(auditCSVRecord(event))
+	})
+	if err != nil {
+		return err
+	}
+
+	if !wroteHeader {
+		if err := writer.Write(auditCSVHeader); err != nil {
+			return err
+		}
+	}
+	writer.Flush()
+	return writer.Error()
+}
+
+// VerifyChain godoc
+// @Summary Verify the audit log
+// @Description Recompute the audit log's hash chain and report the first event that was altered or whose predecessor was removed
+// @Tags admin
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {object} utils.SuccessResponse{data=services.AuditChainVerification}
+// @Failure 401 {object} utils.ErrorResponse
+// @Failure 403 {object} utils.ErrorResponse
+// @Failure 500 {object} utils.ErrorResponse
+// @Router /api/v1/admin/audit-events/verify [get]
+func (ac *AuditController) VerifyChain(c *gin.Context) {
+	verification, err := ac.auditService.VerifyChain(c.Request.Context())
+	if err != nil {
+		ac.logger.Error("Failed to verify audit chain", zap.Error(err))
+		utils.SendInternalServerErrorResponse(c, "Failed to verify audit log")
+		return
+	}
+
+	message := "Audit log is intact"
+	if !verification.Valid {
+		message = "Audit log has been tampered with"
+	}
+	utils.SendSuccessResponse(c, verification, message)
+}
+
+// parseAuditFilter reads audit filters from the query string
+func parseAuditFilter(c *gin.Context) (services.AuditFilter, error) {
+	filter := services.AuditFilter{
+		Action:       c.Query("action"),
+		ResourceType: c.Query("resource_type"),
+		ResourceID:   c.Query("resource_id"),
+		Page:         utils.ParseInt(c.DefaultQuery("page", "1"), 1),
+		Limit:        utils.ParseInt(c.DefaultQuery("limit", "20"), 20),
+	}
+	if filter.Page < 1 {
+		filter.Page = utils.DefaultPage
+	}
+	if filter.Limit < 1 || filter.Limit > utils.MaxLimit {
+		filter.Limit = utils.DefaultLimit
+	}
+
+	for param, target := range map[string]**uint{"actor_id": &filter.ActorID, "organization_id": &filter.OrganizationID} {
+		if value := c.Query(param); value != "" {
+			id, err := strconv.ParseUint(value, 10, 32)
+			if err != nil {
+				return filter, errors.New("Invalid " + param)
+			}
+			parsed := uint(id)
+			*target = &parsed
+		}
+	}
+	for param, target := range map[string]**time.Time{"from": &filter.From, "to": &filter.To} {
+		if value := c.Query(param); value != "" {
+			t, err := time.Parse(time.RFC3339, value)
+			if err != nil {
+				return filter, errors.New("Invalid " + param + ", expected RFC 3339 time")
+			}
+			*target = &t
+		}
+	}
+	return filter, nil
+}
+
+func auditCSVRecord(event *models.AuditEvent) []string {
+	optionalID := func(id *uint) string {
+		if id == nil {
+			return ""
+		}
+		return strconv.FormatUint(uint64(*id), 10)
+	}
+	optionalJSON := func(m models.JSONMap) string {
+		if m == nil {
+			return ""
+		}
+		data, _ := json.Marshal(m)
+		return string(data)
+	}
+
+	return []string{
+		strconv.FormatUint(uint64(event.ID), 10),
+		event.CreatedAt.UTC().Format(time.RFC3339Nano),
+		optionalID(event.ActorID),
+		event.ActorType,
+		event.ActorEmail,
+		event.Action,
+		event.ResourceType,
+		event.ResourceID,
+		optionalID(event.OrganizationID),
+		optionalJSON(event.Before),
+		optionalJSON(event.After),
+		optionalJSON(event.Metadata),
+		event.IPAddress,
+		event.UserAgent,
+		event.RequestID,
+		event.PrevHash,
+		event.Hash,
+	}
+}
+
+// newAuditEvent describes an action taken in this request. The actor is the
+// authenticated user or API key, if any, or the staff member impersonating the user;
+// callers fill in details such as diffs and add to Metadata.
+func newAuditEvent(c *gin.Context, action, resourceType, resourceID string) *models.AuditEvent {
+	event := &models.AuditEvent{
+		ActorType:    models.AuditActorAnonymous,
+		Action:       action,
+		ResourceType: resourceType,
+		ResourceID:   resourceID,
+		Metadata:     models.JSONMap{},
+		IPAddress:    c.ClientIP(),
+		UserAgent:    c.Request.UserAgent(),
+		RequestID:    config.GetLogContext(c.Request.Context()).RequestID,
+	}
+
+	if userID := c.GetUint("user_id"); userID != 0 {
+		event.ActorID = &userID
+		event.ActorType = models.AuditActorUser
+		event.ActorEmail = c.GetString("user_email")
+	}
+	if impersonatorID := c.GetUint("impersonator_id"); impersonatorID != 0 {
+		event.Metadata["impersonated_user_id"] = c.GetUint("user_id")
+		event.ActorID = &impersonatorID
+		event.ActorEmail = c.GetString("impersonator_email")
+	}
+	if apiKeyID := c.GetUint("api_key_id"); apiKeyID != 0 {
+		event.ActorType = models.AuditActorAPIKey
+		event.Metadata["api_key_id"] = apiKeyID
+	}
+	if organizationID := c.GetUint("organization_id"); organizationID != 0 {
+		event.OrganizationID = &organizationID
+	}
+	return event
+}
+
+// newUserAuditEvent describes an action on the user's own account taken before the
+// request is authenticated as them, such as signing in
+func newUserAuditEvent(c *gin.Context, action string, user *models.User) *models.AuditEvent {
+	event := newAuditEvent(c, action, "user", auditID(user.ID))
+	userID := user.ID
+	event.ActorID = &userID
+	event.ActorType = models.AuditActorUser
+	event.ActorEmail = user.Email
+	return event
+}
+
+// auditID formats a record ID as an audit resource ID
+func auditID(id uint) string {
+	return strconv.FormatUint(uint64(id), 10)
+}
+
+// subscriptionAuditState is the part of a subscription compared in audit diffs
+func subscriptionAuditState(subscription *models.Subscription) map[string]interface{} {
+	return map[string]interface{}{
+		"status":               subscription.Status,
+		"plan_id":              subscription.PlanID,
+		"cancel_at_period_end": subscription.CancelAtPeriodEnd,
+		"canceled_at":          subscription.CanceledAt,
+		"quantity":             subscription.Quantity,
+		"scheduled_plan_id":    subscription.ScheduledPlanID,
+	}
+}
+
+// recordSubscriptionCancelled audits a cancellation, diffing the subscription as it was
+// before against its stored state now
+func recordSubscriptionCancelled(c *gin.Context, auditService *services.AuditService, db *gorm.DB, before *models.Subscription, immediately bool) {
+	event := newAuditEvent(c, models.AuditActionSubscriptionCancelled, "subscription", auditID(before.ID))
+	event.Metadata["immediately"] = immediately
+	event.Metadata["payment_method"] = before.PaymentMethod
+
+	var after models.Subscription
+	if err := db.WithContext(c.Request.Context()).First(&after, before.ID).Error; err == nil {
+		event.Before, event.After = models.AuditDiff(subscriptionAuditState(before), subscriptionAuditState(&after))
+	}
+	auditService.Record(c.Request.Context(), event)
+}
+
+// recordSubscriptionCreated audits a new subscription
+func recordSubscriptionCreated(c *gin.Context, auditService *services.AuditService, subscription *models.Subscription) {
+	event := newAuditEvent(c, models.AuditActionSubscriptionCreated, "subscription", auditID(subscription.ID))
+	event.After = subscriptionAuditState(subscription)
+	event.Metadata["payment_method"] = subscription.PaymentMethod
+	auditService.Record(c.Request.Context(), event)
+}
+
+// recordSubscriptionChanged audits a plan or quantity change
+func recordSubscriptionChanged(c *gin.Context, auditService *services.AuditService, subscription *models.Subscription, preview *services.ProrationPreview) {
+	event := newAuditEvent(c, models.AuditActionSubscriptionChanged, "subscription", auditID(subscription.ID))
+	event.After = subscriptionAuditState(subscription)
+	event.Metadata["payment_method"] = subscription.PaymentMethod
+	event.Metadata["from_plan_id"] = preview.CurrentPlanID
+	event.Metadata["from_quantity"] = preview.CurrentQuantity
+	event.Metadata["timing"] = preview.Timing
+	event.Metadata["amount_due"] = preview.AmountDue
+	event.Metadata["currency"] = preview.Currency
+	auditService.Record(c.Request.Context(), event)
+}
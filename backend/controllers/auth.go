@@ -1,9 +1,13 @@
 package controllers
 
 import (
+	"errors"
+	"math"
 	"net/http"
+	"strconv"
 	"strings"
 
+	"mobile-backend/models"
 	"mobile-backend/services"
 	"mobile-backend/utils"
 
@@ -11,16 +15,22 @@ import (
 )
 
 type AuthController struct {
-	authService *services.AuthService
+	authService         *services.AuthService
+	verificationService *services.VerificationService
+	auditService        *services.AuditService
 }
 
-func NewAuthController(authService *services.AuthService) *AuthController {
-	return &AuthController{authService: authService}
+func NewAuthController(authService *services.AuthService, verificationService *services.VerificationService, auditService *services.AuditService) *AuthController {
+	return &AuthController{
+		authService:         authService,
+		verificationService: verificationService,
+		auditService:        auditService,
+	}
 }
 
 type RegisterRequest struct {
 	Email    string `json:"email" binding:"required,email"`
-	Password string `json:"password" binding:"required,min=8"`
+	Password string `json:"password" binding:"required"`
 	Name     string `json:"name" binding:"required,min=2"`
 }
 
@@ -33,9 +43,38 @@ type RefreshTokenRequest struct {
 	RefreshToken string `json:"refresh_token" binding:"required"`
 }
 
+type EmailRequest struct {
+	Email string `json:"email" binding:"required,email"`
+}
+
+type VerifyEmailRequest struct {
+	Token string `json:"token" binding:"required"`
+}
+
+type ResetPasswordRequest struct {
+	Token    string `json:"token" binding:"required"`
+	Password string `json:"password" binding:"required"`
+}
+
+type ChangePasswordRequest struct {
+	CurrentPassword string `json:"current_password" binding:"required"`
+	NewPassword     string `json:"new_password" binding:"required"`
+}
+
+// ChangeExpiredPasswordRequest sets a new password after login reported the old one expired
+type ChangeExpiredPasswordRequest struct {
+	PasswordChangeToken string `json:"password_change_token" binding:"required"`
+	NewPassword         string `json:"new_password" binding:"required"`
+}
+
+// ImpersonateRequest records why staff need to act as a user
+type ImpersonateRequest struct {
+	Reason string `json:"reason" binding:"required,min=3,max=500"`
+}
+
 // Register godoc
 // @Summary Register a new user
-// @Description Register a new user with email and password
+// @Description Register a new user with email and password. The password must satisfy the password policy.
 // @Tags auth
 // @Accept json
 // @Produce json
@@ -54,6 +93,9 @@ func (ac *AuthController) Register(c *gin.Context) {
 
 	user, err := ac.authService.RegisterUser(req.Email, req.Password, req.Name)
 	if err != nil {
+		if sendPasswordPolicyError(c, "password", err) {
+			return
+		}
 		if strings.Contains(err.Error(), "already exists") {
 			utils.SendErrorResponse(c, http.StatusConflict, "User already exists", nil)
 		} else {
@@ -62,6 +104,11 @@ func (ac *AuthController) Register(c *gin.Context) {
 		return
 	}
 
+	ac.auditService.Record(c.Request.Context(), newUserAuditEvent(c, models.AuditActionRegister, user))
+
+	// Registration succeeds even if the email can't be queued; the user can request a resend
+	_ = ac.verificationService.SendVerificationEmail(c.Request.Context(), user)
+
 	userResponse := utils.UserResponse{
 		ID:        user.ID,
 		Email:     user.Email,
@@ -76,14 +123,16 @@ func (ac *AuthController) Register(c *gin.Context) {
 
 // Login godoc
 // @Summary Login user
-// @Description Login user with email and password
+// @Description Login user with email and password. Repeated failures delay further attempts and then temporarily lock the account; refused attempts return 429 with a Retry-After header.
 // @Tags auth
 // @Accept json
 // @Produce json
 // @Param request body LoginRequest true "User login data"
-// @Success 200 {object} utils.SuccessResponse{data=utils.LoginResponse}
+// @Success 200 {object} utils.SuccessResponse{data=utils.LoginResponse} "Token pair, utils.MFAChallengeResponse when two-factor authentication is enabled, or utils.PasswordChangeResponse when the password has expired"
 // @Failure 400 {object} utils.ErrorResponse
 // @Failure 401 {object} utils.ErrorResponse
+// @Failure 403 {object} utils.ErrorResponse
+// @Failure 429 {object} utils.ErrorResponse
 // @Failure 500 {object} utils.ErrorResponse
 // @Router /api/v1/auth/login [post]
 func (ac *AuthController) Login(c *gin.Context) {
@@ -93,19 +142,50 @@ func (ac *AuthController) Login(c *gin.Context) {
 		return
 	}
 
-	user, _, err := ac.authService.LoginUser(req.Email, req.Password)
+	user, challengeToken, err := ac.authService.LoginUser(c.Request.Context(), req.Email, req.Password, c.ClientIP())
 	if err != nil {
+		if errors.Is(err, services.ErrMFARequired) {
+			utils.SendSuccessResponse(c, utils.MFAChallengeResponse{
+				MFARequired: true,
+				MFAToken:    challengeToken,
+				ExpiresIn:   int(utils.MFAChallengeTTL.Seconds()),
+			}, "Two-factor authentication required")
+			return
+		}
+		if sendPasswordExpired(c, err, challengeToken) {
+			return
+		}
+
+		event := newAuditEvent(c, models.AuditActionLoginFailed, "user", "")
+		event.Metadata["email"] = strings.ToLower(req.Email)
+		event.Metadata["reason"] = loginFailureReason(err)
+		ac.auditService.Record(c.Request.Context(), event)
+
+		if sendLoginRetryError(c, err) {
+			return
+		}
+		if errors.Is(err, services.ErrEmailNotVerified) {
+			utils.SendErrorResponse(c, http.StatusForbidden, "Email address not verified", map[string]interface{}{
+				"email_verified": false,
+			})
+			return
+		}
+		if sendPasswordResetRequired(c, err) {
+			return
+		}
 		utils.SendUnauthorizedResponse(c, "Invalid credentials")
 		return
 	}
 
 	// Generate access and refresh tokens
-	accessToken, refreshToken, err := utils.GenerateAccessAndRefreshTokens(user.ID, user.Email)
+	accessToken, refreshToken, err := ac.authService.GenerateTokens(c.Request.Context(), user, sessionMetadata(c))
 	if err != nil {
 		utils.SendInternalServerErrorResponse(c, "Failed to generate tokens")
 		return
 	}
 
+	ac.auditService.Record(c.Request.Context(), newUserAuditEvent(c, models.AuditActionLogin, user))
+
 	userResponse := utils.UserResponse{
 		ID:        user.ID,
 		Email:     user.Email,
@@ -145,9 +225,33 @@ func (ac *AuthController) Logout(c *gin.Context) {
 		return
 	}
 
+	ac.auditService.Record(c.Request.Context(), newAuditEvent(c, models.AuditActionLogout, "session", c.GetString("session_id")))
+
 	utils.SendSuccessResponse(c, nil, "Logout successful")
 }
 
+// LogoutAll godoc
+// @Summary Logout everywhere
+// @Description Sign out every device, including this one. All refresh and access tokens issued so far stop working.
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {object} utils.SuccessResponse
+// @Failure 401 {object} utils.ErrorResponse
+// @Failure 500 {object} utils.ErrorResponse
+// @Router /api/v1/auth/logout-all [post]
+func (ac *AuthController) LogoutAll(c *gin.Context) {
+	if err := ac.authService.RevokeAllSessions(c.Request.Context(), c.GetUint("user_id"), ""); err != nil {
+		utils.SendInternalServerErrorResponse(c, "Failed to logout")
+		return
+	}
+
+	ac.auditService.Record(c.Request.Context(), newAuditEvent(c, models.AuditActionLogoutAll, "user", auditID(c.GetUint("user_id"))))
+
+	utils.SendSuccessResponse(c, nil, "Logged out from all devices")
+}
+
 // RefreshToken godoc
 // @Summary Refresh access token
 // @Description Refresh access token using refresh token
@@ -167,31 +271,618 @@ func (ac *AuthController) RefreshToken(c *gin.Context) {
 		return
 	}
 
-	// Validate refresh token
-	claims, err := utils.ValidateRefreshToken(req.RefreshToken)
+	// Rotate the session; the presented refresh token can never be used again
+	_, accessToken, refreshToken, err := ac.authService.RefreshTokens(c.Request.Context(), req.RefreshToken, sessionMetadata(c))
 	if err != nil {
-		utils.SendUnauthorizedResponse(c, "Invalid refresh token")
+		switch {
+		case errors.Is(err, services.ErrRefreshTokenReused):
+			utils.SendUnauthorizedResponse(c, "Refresh token has already been used; session revoked")
+		case errors.Is(err, services.ErrInvalidRefreshToken):
+			utils.SendUnauthorizedResponse(c, "Invalid refresh token")
+		default:
+			utils.SendInternalServerErrorResponse(c, "Failed to refresh tokens")
+		}
 		return
 	}
 
-	// Check if refresh token is blacklisted
-	// Note: You'll need to inject the blacklist service into the controller
-	// For now, we'll skip this check
+	refreshResponse := utils.RefreshTokenResponse{
+		AccessToken:  accessToken,
+		RefreshToken: refreshToken,
+		ExpiresIn:    15 * 60, // 15 minutes in seconds
+	}
+
+	utils.SendSuccessResponse(c, refreshResponse, "Tokens refreshed successfully")
+}
 
-	// Generate new token pair
-	accessToken, refreshToken, err := utils.GenerateAccessAndRefreshTokens(claims.UserID, claims.Email)
+// ForgotPassword godoc
+// @Summary Request password reset
+// @Description Email a single-use password reset link. Always succeeds so that account existence is not revealed.
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Param request body EmailRequest true "Account email"
+// @Success 200 {object} utils.SuccessResponse
+// @Failure 400 {object} utils.ErrorResponse
+// @Failure 500 {object} utils.ErrorResponse
+// @Router /api/v1/auth/forgot-password [post]
+func (ac *AuthController) ForgotPassword(c *gin.Context) {
+	var req EmailRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.SendValidationErrorResponse(c, parseValidationErrors(err))
+		return
+	}
+
+	if err := ac.verificationService.RequestPasswordReset(c.Request.Context(), req.Email); err != nil {
+		utils.SendInternalServerErrorResponse(c, "Failed to request password reset")
+		return
+	}
+
+	utils.SendSuccessResponse(c, nil, "If an account exists for this email, a password reset link has been sent")
+}
+
+// ResetPassword godoc
+// @Summary Reset password
+// @Description Set a new password using a password reset token. The password must satisfy the password policy; if it does not, the token stays valid. All sessions are signed out.
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Param request body ResetPasswordRequest true "Reset token and new password"
+// @Success 200 {object} utils.SuccessResponse
+// @Failure 400 {object} utils.ErrorResponse
+// @Failure 500 {object} utils.ErrorResponse
+// @Router /api/v1/auth/reset-password [post]
+func (ac *AuthController) ResetPassword(c *gin.Context) {
+	var req ResetPasswordRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.SendValidationErrorResponse(c, parseValidationErrors(err))
+		return
+	}
+
+	user, err := ac.verificationService.ResetPassword(c.Request.Context(), req.Token, req.Password)
+	if err != nil {
+		if sendPasswordPolicyError(c, "password", err) {
+			return
+		}
+		if errors.Is(err, services.ErrInvalidVerificationToken) {
+			utils.SendErrorResponse(c, http.StatusBadRequest, "Invalid or expired reset token", nil)
+			return
+		}
+		utils.SendInternalServerErrorResponse(c, "Failed to reset password")
+		return
+	}
+
+	ac.auditService.Record(c.Request.Context(), newUserAuditEvent(c, models.AuditActionPasswordReset, user))
+
+	utils.SendSuccessResponse(c, nil, "Password reset successfully")
+}
+
+// ChangePassword godoc
+// @Summary Change password
+// @Description Replace the current user's password. The new password must satisfy the password policy: minimum length, required character classes, not one of the recent passwords and not found in known data breaches. Every other session is signed out.
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param request body ChangePasswordRequest true "Current and new password"
+// @Success 200 {object} utils.SuccessResponse
+// @Failure 400 {object} utils.ValidationErrorResponse
+// @Failure 401 {object} utils.ErrorResponse
+// @Failure 403 {object} utils.ErrorResponse
+// @Failure 500 {object} utils.ErrorResponse
+// @Router /api/v1/auth/change-password [post]
+func (ac *AuthController) ChangePassword(c *gin.Context) {
+	var req ChangePasswordRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.SendValidationErrorResponse(c, parseValidationErrors(err))
+		return
+	}
+
+	userID := c.GetUint("user_id")
+	err := ac.authService.ChangePassword(c.Request.Context(), userID, req.CurrentPassword, req.NewPassword, c.GetString("session_id"))
+	if err != nil {
+		if sendPasswordPolicyError(c, "new_password", err) {
+			return
+		}
+		switch {
+		case errors.Is(err, services.ErrInvalidCurrentPassword):
+			utils.SendErrorResponse(c, http.StatusBadRequest, "Current password is incorrect", nil)
+		case errors.Is(err, services.ErrUserNotFound):
+			utils.SendNotFoundResponse(c, "User not found")
+		default:
+			utils.SendInternalServerErrorResponse(c, "Failed to change password")
+		}
+		return
+	}
+
+	ac.auditService.Record(c.Request.Context(), newAuditEvent(c, models.AuditActionPasswordChanged, "user", auditID(userID)))
+
+	utils.SendSuccessResponse(c, nil, "Password changed successfully")
+}
+
+// ChangeExpiredPassword godoc
+// @Summary Change an expired password
+// @Description Exchange the password_change_token returned by login when the password has expired, and a new password satisfying the password policy, for an access/refresh token pair. The token works once. Every other session is signed out.
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Param request body ChangeExpiredPasswordRequest true "Password change token and new password"
+// @Success 200 {object} utils.SuccessResponse{data=utils.LoginResponse}
+// @Failure 400 {object} utils.ValidationErrorResponse
+// @Failure 401 {object} utils.ErrorResponse
+// @Failure 500 {object} utils.ErrorResponse
+// @Router /api/v1/auth/change-expired-password [post]
+func (ac *AuthController) ChangeExpiredPassword(c *gin.Context) {
+	var req ChangeExpiredPasswordRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.SendValidationErrorResponse(c, parseValidationErrors(err))
+		return
+	}
+
+	user, err := ac.authService.ChangeExpiredPassword(c.Request.Context(), req.PasswordChangeToken, req.NewPassword)
+	if err != nil {
+		if sendPasswordPolicyError(c, "new_password", err) {
+			return
+		}
+		if errors.Is(err, services.ErrInvalidPasswordChangeToken) {
+			utils.SendUnauthorizedResponse(c, "Invalid or expired password change token")
+			return
+		}
+		utils.SendInternalServerErrorResponse(c, "Failed to change password")
+		return
+	}
+
+	accessToken, refreshToken, err := ac.authService.GenerateTokens(c.Request.Context(), user, sessionMetadata(c))
 	if err != nil {
 		utils.SendInternalServerErrorResponse(c, "Failed to generate tokens")
 		return
 	}
 
-	refreshResponse := utils.RefreshTokenResponse{
+	ac.auditService.Record(c.Request.Context(), newUserAuditEvent(c, models.AuditActionPasswordChanged, user))
+	ac.auditService.Record(c.Request.Context(), newUserAuditEvent(c, models.AuditActionLogin, user))
+
+	utils.SendSuccessResponse(c, utils.LoginResponse{
+		User: utils.UserResponse{
+			ID:              user.ID,
+			Email:           user.Email,
+			Name:            user.Name,
+			IsActive:        user.IsActive,
+			EmailVerifiedAt: user.EmailVerifiedAt,
+			CreatedAt:       user.CreatedAt,
+			UpdatedAt:       user.UpdatedAt,
+		},
 		AccessToken:  accessToken,
 		RefreshToken: refreshToken,
-		ExpiresIn:    15 * 60, // 15 minutes in seconds
+		ExpiresIn:    int(utils.AccessTokenTTL.Seconds()),
+	}, "Password changed successfully")
+}
+
+// VerifyEmail godoc
+// @Summary Verify email address
+// @Description Confirm ownership of the account email using a verification token
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Param request body VerifyEmailRequest true "Verification token"
+// @Success 200 {object} utils.SuccessResponse{data=utils.UserResponse}
+// @Failure 400 {object} utils.ErrorResponse
+// @Failure 500 {object} utils.ErrorResponse
+// @Router /api/v1/auth/verify-email [post]
+func (ac *AuthController) VerifyEmail(c *gin.Context) {
+	var req VerifyEmailRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.SendValidationErrorResponse(c, parseValidationErrors(err))
+		return
 	}
 
-	utils.SendSuccessResponse(c, refreshResponse, "Tokens refreshed successfully")
+	user, err := ac.verificationService.VerifyEmail(c.Request.Context(), req.Token)
+	if err != nil {
+		if errors.Is(err, services.ErrInvalidVerificationToken) {
+			utils.SendErrorResponse(c, http.StatusBadRequest, "Invalid or expired verification token", nil)
+			return
+		}
+		utils.SendInternalServerErrorResponse(c, "Failed to verify email")
+		return
+	}
+
+	ac.auditService.Record(c.Request.Context(), newUserAuditEvent(c, models.AuditActionEmailVerified, user))
+
+	userResponse := utils.UserResponse{
+		ID:              user.ID,
+		Email:           user.Email,
+		Name:            user.Name,
+		IsActive:        user.IsActive,
+		EmailVerifiedAt: user.EmailVerifiedAt,
+		CreatedAt:       user.CreatedAt,
+		UpdatedAt:       user.UpdatedAt,
+	}
+
+	utils.SendSuccessResponse(c, userResponse, "Email verified successfully")
+}
+
+// ResendVerification godoc
+// @Summary Resend verification email
+// @Description Send a new email verification link. Always succeeds so that account existence is not revealed.
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Param request body EmailRequest true "Account email"
+// @Success 200 {object} utils.SuccessResponse
+// @Failure 400 {object} utils.ErrorResponse
+// @Failure 500 {object} utils.ErrorResponse
+// @Router /api/v1/auth/resend-verification [post]
+func (ac *AuthController) ResendVerification(c *gin.Context) {
+	var req EmailRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.SendValidationErrorResponse(c, parseValidationErrors(err))
+		return
+	}
+
+	if err := ac.verificationService.ResendVerification(c.Request.Context(), req.Email); err != nil {
+		utils.SendInternalServerErrorResponse(c, "Failed to send verification email")
+		return
+	}
+
+	utils.SendSuccessResponse(c, nil, "If the account exists and is unverified, a verification email has been sent")
+}
+
+// ListSessions godoc
+// @Summary List active sessions
+// @Description List the current user's active sessions, one per signed-in device
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {object} utils.SuccessResponse{data=[]utils.SessionResponse}
+// @Failure 401 {object} utils.ErrorResponse
+// @Failure 500 {object} utils.ErrorResponse
+// @Router /api/v1/auth/sessions [get]
+func (ac *AuthController) ListSessions(c *gin.Context) {
+	sessions, err := ac.authService.ListSessions(c.Request.Context(), c.GetUint("user_id"))
+	if err != nil {
+		utils.SendInternalServerErrorResponse(c, "Failed to list sessions")
+		return
+	}
+
+	currentSessionID := c.GetString("session_id")
+	response := make([]utils.SessionResponse, 0, len(sessions))
+	for _, session := range sessions {
+		response = append(response, utils.SessionResponse{
+			ID:         session.ID,
+			DeviceID:   session.DeviceID,
+			DeviceName: session.DeviceName,
+			UserAgent:  session.UserAgent,
+			IPAddress:  session.IPAddress,
+			CreatedAt:  session.CreatedAt,
+			LastUsedAt: session.LastUsedAt,
+			ExpiresAt:  session.ExpiresAt,
+			Current:    currentSessionID != "" && session.FamilyID == currentSessionID,
+		})
+	}
+
+	utils.SendSuccessResponse(c, response, "Sessions retrieved successfully")
+}
+
+// RevokeSession godoc
+// @Summary Revoke a session
+// @Description Sign out one of the current user's devices by revoking its session
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "Session ID"
+// @Success 200 {object} utils.SuccessResponse
+// @Failure 400 {object} utils.ErrorResponse
+// @Failure 401 {object} utils.ErrorResponse
+// @Failure 404 {object} utils.ErrorResponse
+// @Failure 500 {object} utils.ErrorResponse
+// @Router /api/v1/auth/sessions/{id} [delete]
+func (ac *AuthController) RevokeSession(c *gin.Context) {
+	sessionID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		utils.SendErrorResponse(c, http.StatusBadRequest, "Invalid session ID", nil)
+		return
+	}
+
+	if err := ac.authService.RevokeSession(c.Request.Context(), c.GetUint("user_id"), uint(sessionID)); err != nil {
+		if errors.Is(err, services.ErrSessionNotFound) {
+			utils.SendNotFoundResponse(c, "Session not found")
+			return
+		}
+		utils.SendInternalServerErrorResponse(c, "Failed to revoke session")
+		return
+	}
+
+	ac.auditService.Record(c.Request.Context(), newAuditEvent(c, models.AuditActionSessionRevoked, "session", strconv.FormatUint(sessionID, 10)))
+
+	utils.SendSuccessResponse(c, nil, "Session revoked successfully")
+}
+
+// RevokeAllSessions godoc
+// @Summary Revoke all sessions
+// @Description Sign out all of the current user's devices. Pass except_current=true to keep the calling session.
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param except_current query bool false "Keep the current session"
+// @Success 200 {object} utils.SuccessResponse
+// @Failure 401 {object} utils.ErrorResponse
+// @Failure 500 {object} utils.ErrorResponse
+// @Router /api/v1/auth/sessions [delete]
+func (ac *AuthController) RevokeAllSessions(c *gin.Context) {
+	exceptSessionID := ""
+	if c.Query("except_current") == "true" {
+		exceptSessionID = c.GetString("session_id")
+	}
+
+	if err := ac.authService.RevokeAllSessions(c.Request.Context(), c.GetUint("user_id"), exceptSessionID); err != nil {
+		utils.SendInternalServerErrorResponse(c, "Failed to revoke sessions")
+		return
+	}
+
+	event := newAuditEvent(c, models.AuditActionSessionsRevoked, "user", auditID(c.GetUint("user_id")))
+	event.Metadata["except_current"] = exceptSessionID != ""
+	ac.auditService.Record(c.Request.Context(), event)
+
+	utils.SendSuccessResponse(c, nil, "Sessions revoked successfully")
+}
+
+// RevokeUserTokens godoc
+// @Summary Revoke all tokens of a user
+// @Description Sign a user out of every device and invalidate all of their tokens (admin only)
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "User ID"
+// @Success 200 {object} utils.SuccessResponse
+// @Failure 400 {object} utils.ErrorResponse
+// @Failure 401 {object} utils.ErrorResponse
+// @Failure 403 {object} utils.ErrorResponse
+// @Failure 404 {object} utils.ErrorResponse
+// @Failure 500 {object} utils.ErrorResponse
+// @Router /api/v1/admin/users/{id}/revoke-tokens [post]
+func (ac *AuthController) RevokeUserTokens(c *gin.Context) {
+	userID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		utils.SendErrorResponse(c, http.StatusBadRequest, "Invalid user ID", nil)
+		return
+	}
+
+	if err := ac.authService.RevokeAllTokens(c.Request.Context(), uint(userID), c.GetUint("user_id")); err != nil {
+		if errors.Is(err, services.ErrUserNotFound) {
+			utils.SendNotFoundResponse(c, "User not found")
+			return
+		}
+		utils.SendInternalServerErrorResponse(c, "Failed to revoke tokens")
+		return
+	}
+
+	ac.auditService.Record(c.Request.Context(), newAuditEvent(c, models.AuditActionTokensRevoked, "user", auditID(uint(userID))))
+
+	utils.SendSuccessResponse(c, nil, "User tokens revoked successfully")
+}
+
+// UnlockUser godoc
+// @Summary Unlock a user account
+// @Description Lift a lockout caused by repeated failed logins and reset the user's failed-attempt counters
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "User ID"
+// @Success 200 {object} utils.SuccessResponse
+// @Failure 400 {object} utils.ErrorResponse
+// @Failure 401 {object} utils.ErrorResponse
+// @Failure 403 {object} utils.ErrorResponse
+// @Failure 404 {object} utils.ErrorResponse
+// @Failure 500 {object} utils.ErrorResponse
+// @Router /api/v1/admin/users/{id}/unlock [post]
+func (ac *AuthController) UnlockUser(c *gin.Context) {
+	userID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		utils.SendErrorResponse(c, http.StatusBadRequest, "Invalid user ID", nil)
+		return
+	}
+
+	if err := ac.authService.UnlockUser(c.Request.Context(), uint(userID), c.GetUint("user_id")); err != nil {
+		if errors.Is(err, services.ErrUserNotFound) {
+			utils.SendNotFoundResponse(c, "User not found")
+			return
+		}
+		utils.SendInternalServerErrorResponse(c, "Failed to unlock user")
+		return
+	}
+
+	ac.auditService.Record(c.Request.Context(), newAuditEvent(c, models.AuditActionAccountUnlocked, "user", auditID(uint(userID))))
+
+	utils.SendSuccessResponse(c, nil, "User unlocked successfully")
+}
+
+// ImpersonateUser godoc
+// @Summary Impersonate a user
+// @Description Issue a short-lived access token that acts as the user, so support staff can see exactly what they see. The token names the staff member in its act claim, cannot be refreshed, and is refused by sensitive endpoints such as payments and credential changes. Administrators cannot be impersonated.
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "User ID"
+// @Param request body ImpersonateRequest true "Reason for impersonating the user"
+// @Success 200 {object} utils.SuccessResponse{data=utils.ImpersonationResponse}
+// @Failure 400 {object} utils.ErrorResponse
+// @Failure 401 {object} utils.ErrorResponse
+// @Failure 403 {object} utils.ErrorResponse
+// @Failure 404 {object} utils.ErrorResponse
+// @Failure 500 {object} utils.ErrorResponse
+// @Router /api/v1/admin/users/{id}/impersonate [post]
+func (ac *AuthController) ImpersonateUser(c *gin.Context) {
+	userID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		utils.SendErrorResponse(c, http.StatusBadRequest, "Invalid user ID", nil)
+		return
+	}
+
+	var req ImpersonateRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.SendValidationErrorResponse(c, parseValidationErrors(err))
+		return
+	}
+
+	user, token, expiresAt, err := ac.authService.Impersonate(c.Request.Context(), c.GetUint("user_id"), uint(userID))
+	if err != nil {
+		switch {
+		case errors.Is(err, services.ErrUserNotFound):
+			utils.SendNotFoundResponse(c, "User not found")
+		case errors.Is(err, services.ErrImpersonationNotAllowed):
+			utils.SendErrorResponse(c, http.StatusForbidden, err.Error(), nil)
+		default:
+			utils.SendInternalServerErrorResponse(c, "Failed to impersonate user")
+		}
+		return
+	}
+
+	event := newAuditEvent(c, models.AuditActionImpersonationStarted, "user", auditID(user.ID))
+	event.Metadata["reason"] = req.Reason
+	event.Metadata["expires_at"] = expiresAt
+	ac.auditService.Record(c.Request.Context(), event)
+
+	utils.SendSuccessResponse(c, utils.ImpersonationResponse{
+		User: utils.UserResponse{
+			ID:        user.ID,
+			Email:     user.Email,
+			Name:      user.Name,
+			IsActive:  user.IsActive,
+			CreatedAt: user.CreatedAt,
+			UpdatedAt: user.UpdatedAt,
+		},
+		AccessToken: token,
+		ExpiresIn:   int(utils.ImpersonationTokenTTL.Seconds()),
+		ExpiresAt:   expiresAt,
+	}, "Impersonation started")
+}
+
+// StopImpersonation godoc
+// @Summary Stop impersonating a user
+// @Description Revoke the impersonation token used to make this request
+// @Tags auth
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {object} utils.SuccessResponse
+// @Failure 400 {object} utils.ErrorResponse
+// @Failure 401 {object} utils.ErrorResponse
+// @Failure 500 {object} utils.ErrorResponse
+// @Router /api/v1/auth/impersonation/stop [post]
+func (ac *AuthController) StopImpersonation(c *gin.Context) {
+	impersonatorID := c.GetUint("impersonator_id")
+	if impersonatorID == 0 {
+		utils.SendErrorResponse(c, http.StatusBadRequest, "Not impersonating a user", nil)
+		return
+	}
+
+	userID := c.GetUint("user_id")
+	if err := ac.authService.StopImpersonation(c.Request.Context(), c.GetString("token_id"), impersonatorID, userID); err != nil {
+		utils.SendInternalServerErrorResponse(c, "Failed to stop impersonation")
+		return
+	}
+
+	ac.auditService.Record(c.Request.Context(), newAuditEvent(c, models.AuditActionImpersonationStopped, "user", auditID(userID)))
+
+	utils.SendSuccessResponse(c, nil, "Impersonation stopped")
+}
+
+// sessionMetadata collects the client details recorded on a session
+func sessionMetadata(c *gin.Context) services.SessionMetadata {
+	return services.SessionMetadata{
+		UserAgent:  c.Request.UserAgent(),
+		IPAddress:  c.ClientIP(),
+		DeviceID:   c.GetHeader("X-Device-ID"),
+		DeviceName: c.GetHeader("X-Device-Name"),
+		Platform:   c.GetHeader("X-Platform"),
+		AppVersion: c.GetHeader("X-App-Version"),
+		OSVersion:  c.GetHeader("X-OS-Version"),
+	}
+}
+
+// loginFailureReason classifies a failed login for the audit log
+func loginFailureReason(err error) string {
+	switch {
+	case errors.Is(err, services.ErrAccountLocked):
+		return "account_locked"
+	case errors.As(err, new(*services.LoginRetryError)):
+		return "throttled"
+	case errors.Is(err, services.ErrEmailNotVerified):
+		return "email_not_verified"
+	case errors.Is(err, services.ErrPasswordResetRequired):
+		return "password_reset_required"
+	default:
+		return "invalid_credentials"
+	}
+}
+
+// sendLoginRetryError answers 429 with a Retry-After header when a login attempt was
+// refused by the failed-login lockout. It returns false, without responding, for any
+// other error.
+func sendLoginRetryError(c *gin.Context, err error) bool {
+	var retryErr *services.LoginRetryError
+	if !errors.As(err, &retryErr) {
+		return false
+	}
+
+	retryAfter := int(math.Ceil(retryErr.RetryAfter.Seconds()))
+	c.Header("Retry-After", strconv.Itoa(retryAfter))
+	message := "Too many login attempts, please try again later"
+	if errors.Is(err, services.ErrAccountLocked) {
+		message = "Account temporarily locked after too many failed login attempts"
+	}
+	utils.SendErrorResponse(c, http.StatusTooManyRequests, message, map[string]interface{}{
+		"retry_after": retryAfter,
+	})
+	return true
+}
+
+// sendPasswordResetRequired answers a login refused until the user resets a password an
+// administrator invalidated. It returns false, without responding, for any other error.
+func sendPasswordResetRequired(c *gin.Context, err error) bool {
+	if !errors.Is(err, services.ErrPasswordResetRequired) {
+		return false
+	}
+
+	utils.SendErrorResponse(c, http.StatusForbidden, "Password reset required, check your email for a reset link", map[string]interface{}{
+		"password_reset_required": true,
+	})
+	return true
+}
+
+// sendPasswordExpired answers a login held back by an expired password with the token
+// that lets the user set a new one. It returns false, without responding, for any other
+// error.
+func sendPasswordExpired(c *gin.Context, err error, changeToken string) bool {
+	if !errors.Is(err, services.ErrPasswordExpired) {
+		return false
+	}
+
+	utils.SendSuccessResponse(c, utils.PasswordChangeResponse{
+		PasswordExpired:     true,
+		PasswordChangeToken: changeToken,
+		ExpiresIn:           int(utils.PasswordChangeTokenTTL.Seconds()),
+	}, "Password expired, choose a new password to continue")
+	return true
+}
+
+// sendPasswordPolicyError answers with every password rule err reports as broken. It
+// returns false, without responding, when err is not a password policy violation.
+func sendPasswordPolicyError(c *gin.Context, field string, err error) bool {
+	var policyErr *services.PasswordPolicyError
+	if !errors.As(err, &policyErr) {
+		return false
+	}
+
+	details := make([]utils.ValidationError, 0, len(policyErr.Violations))
+	for _, violation := range policyErr.Violations {
+		details = append(details, utils.ValidationError{Field: field, Message: "Password " + violation})
+	}
+	utils.SendValidationErrorResponse(c, details)
+	return true
 }
 
 func parseValidationErrors(err error) []utils.ValidationError {
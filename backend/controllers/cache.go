@@ -4,6 +4,7 @@ import (
 	"net/http"
 	"time"
 
+	"mobile-backend/models"
 	"mobile-backend/services"
 	"mobile-backend/utils"
 
@@ -13,12 +14,14 @@ import (
 type CacheController struct {
 	cacheService        *services.CacheService
 	cacheMetricsService *services.CacheMetricsService
+	auditService        *services.AuditService
 }
 
-func NewCacheController(cacheService *services.CacheService, cacheMetricsService *services.CacheMetricsService) *CacheController {
+func NewCacheController(cacheService *services.CacheService, cacheMetricsService *services.CacheMetricsService, auditService *services.AuditService) *CacheController {
 	return &CacheController{
 		cacheService:        cacheService,
 		cacheMetricsService: cacheMetricsService,
+		auditService:        auditService,
 	}
 }
 
@@ -224,6 +227,8 @@ func (cc *CacheController) InvalidateCache(c *gin.Context) {
 		return
 	}
 
+	cc.auditService.Record(c.Request.Context(), newAuditEvent(c, models.AuditActionCacheInvalidated, "cache", req.Pattern))
+
 	utils.SendSuccessResponse(c, nil, "Cache invalidated successfully")
 }
 
@@ -282,5 +287,7 @@ func (cc *CacheController) ClearCache(c *gin.Context) {
 		return
 	}
 
+	cc.auditService.Record(c.Request.Context(), newAuditEvent(c, models.AuditActionCacheCleared, "cache", "*"))
+
 	utils.SendSuccessResponse(c, nil, "Cache cleared successfully")
 }
@@ -31,7 +31,7 @@ func NewCategoryController(db *gorm.DB) *CategoryController {
 func (c *CategoryController) GetCategoryList(ctx *gin.Context) {
 	var categorys []models.Category
 
-	if err := c.db.Find(&categorys).Error; err != nil {
+	if err := c.db.WithContext(ctx.Request.Context()).Find(&categorys).Error; err != nil {
 		utils.SendErrorResponse(ctx, http.StatusInternalServerError, "Failed to fetch categorys", nil)
 		return
 	}
@@ -59,7 +59,7 @@ func (c *CategoryController) GetCategory(ctx *gin.Context) {
 	}
 
 	var category models.Category
-	if err := c.db.First(&category, uint(id)).Error; err != nil {
+	if err := c.db.WithContext(ctx.Request.Context()).First(&category, uint(id)).Error; err != nil {
 		if err == gorm.ErrRecordNotFound {
 			utils.SendNotFoundResponse(ctx, "Category not found")
 			return
@@ -91,7 +91,7 @@ func (c *CategoryController) CreateCategory(ctx *gin.Context) {
 		return
 	}
 
-	if err := c.db.Create(&category).Error; err != nil {
+	if err := c.db.WithContext(ctx.Request.Context()).Create(&category).Error; err != nil {
 		utils.SendErrorResponse(ctx, http.StatusInternalServerError, "Failed to create category", nil)
 		return
 	}
@@ -121,7 +121,7 @@ func (c *CategoryController) UpdateCategory(ctx *gin.Context) {
 	}
 
 	var category models.Category
-	if err := c.db.First(&category, uint(id)).Error; err != nil {
+	if err := c.db.WithContext(ctx.Request.Context()).First(&category, uint(id)).Error; err != nil {
 		if err == gorm.ErrRecordNotFound {
 			utils.SendNotFoundResponse(ctx, "Category not found")
 			return
@@ -135,7 +135,10 @@ func (c *CategoryController) UpdateCategory(ctx *gin.Context) {
 		return
 	}
 
-	if err := c.db.Save(&category).Error; err != nil {
+	// The path decides which record is updated, not the body
+	category.ID = uint(id)
+
+	if err := c.db.WithContext(ctx.Request.Context()).Save(&category).Error; err != nil {
 		utils.SendErrorResponse(ctx, http.StatusInternalServerError, "Failed to update category", nil)
 		return
 	}
@@ -157,7 +160,7 @@ func (c *CategoryController) DeleteCategory(ctx *gin.Context) {
 		return
 	}
 
-	if err := c.db.Delete(&models.Category{}, uint(id)).Error; err != nil {
+	if err := c.db.WithContext(ctx.Request.Context()).Delete(&models.Category{}, uint(id)).Error; err != nil {
 		utils.SendErrorResponse(ctx, http.StatusInternalServerError, "Failed to delete category", nil)
 		return
 	}
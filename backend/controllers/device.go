@@ -0,0 +1,200 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"mobile-backend/models"
+	"mobile-backend/services"
+	"mobile-backend/utils"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// DeviceController lets users see the devices signed in to their account and rename,
+// trust or revoke them
+type DeviceController struct {
+	deviceService *services.DeviceService
+	auditService  *services.AuditService
+	logger        *zap.Logger
+}
+
+// NewDeviceController creates a new device controller
+func NewDeviceController(deviceService *services.DeviceService, auditService *services.AuditService, logger *zap.Logger) *DeviceController {
+	return &DeviceController{
+		deviceService: deviceService,
+		auditService:  auditService,
+		logger:        logger,
+	}
+}
+
+// RenameDeviceRequest represents the request body for renaming a device
+type RenameDeviceRequest struct {
+	Name string `json:"name" binding:"required,min=1,max=255"`
+}
+
+// ListDevices godoc
+// @Summary List devices
+// @Description List the devices the current user is signed in on, most recently used first
+// @Tags devices
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {object} utils.SuccessResponse{data=[]models.UserDevice}
+// @Failure 401 {object} utils.ErrorResponse
+// @Failure 500 {object} utils.ErrorResponse
+// @Router /api/v1/devices [get]
+func (dc *DeviceController) ListDevices(c *gin.Context) {
+	devices, err := dc.deviceService.ListDevices(c.Request.Context(), c.GetUint("user_id"))
+	if err != nil {
+		dc.logger.Error("Failed to list devices", zap.Error(err))
+		utils.SendInternalServerErrorResponse(c, "Failed to list devices")
+		return
+	}
+
+	utils.SendSuccessResponse(c, devices, "Devices retrieved successfully")
+}
+
+// RenameDevice godoc
+// @Summary Rename a device
+// @Description Change the name shown for one of the current user's devices
+// @Tags devices
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "Device ID"
+// @Param request body RenameDeviceRequest true "New device name"
+// @Success 200 {object} utils.SuccessResponse{data=models.UserDevice}
+// @Failure 400 {object} utils.ErrorResponse
+// @Failure 401 {object} utils.ErrorResponse
+// @Failure 404 {object} utils.ErrorResponse
+// @Failure 500 {object} utils.ErrorResponse
+// @Router /api/v1/devices/{id} [patch]
+func (dc *DeviceController) RenameDevice(c *gin.Context) {
+	deviceID, ok := parseDeviceID(c)
+	if !ok {
+		return
+	}
+
+	var req RenameDeviceRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.SendValidationErrorResponse(c, parseValidationErrors(err))
+		return
+	}
+
+	device, err := dc.deviceService.RenameDevice(c.Request.Context(), c.GetUint("user_id"), deviceID, req.Name)
+	if err != nil {
+		dc.sendDeviceError(c, err, "Failed to rename device")
+		return
+	}
+
+	event := newAuditEvent(c, models.AuditActionDeviceRenamed, "device", auditID(device.ID))
+	event.Metadata["name"] = device.Name
+	dc.auditService.Record(c.Request.Context(), event)
+
+	utils.SendSuccessResponse(c, device, "Device renamed successfully")
+}
+
+// TrustDevice godoc
+// @Summary Trust a device
+// @Description Mark one of the current user's devices as trusted
+// @Tags devices
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "Device ID"
+// @Success 200 {object} utils.SuccessResponse{data=models.UserDevice}
+// @Failure 400 {object} utils.ErrorResponse
+// @Failure 401 {object} utils.ErrorResponse
+// @Failure 404 {object} utils.ErrorResponse
+// @Failure 500 {object} utils.ErrorResponse
+// @Router /api/v1/devices/{id}/trust [post]
+func (dc *DeviceController) TrustDevice(c *gin.Context) {
+	dc.setTrusted(c, true)
+}
+
+// UntrustDevice godoc
+// @Summary Stop trusting a device
+// @Description Remove the trusted mark from one of the current user's devices
+// @Tags devices
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "Device ID"
+// @Success 200 {object} utils.SuccessResponse{data=models.UserDevice}
+// @Failure 400 {object} utils.ErrorResponse
+// @Failure 401 {object} utils.ErrorResponse
+// @Failure 404 {object} utils.ErrorResponse
+// @Failure 500 {object} utils.ErrorResponse
+// @Router /api/v1/devices/{id}/trust [delete]
+func (dc *DeviceController) UntrustDevice(c *gin.Context) {
+	dc.setTrusted(c, false)
+}
+
+// RevokeDevice godoc
+// @Summary Revoke a device
+// @Description Sign one of the current user's devices out. Its sessions are revoked and its push tokens deactivated.
+// @Tags devices
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "Device ID"
+// @Success 200 {object} utils.SuccessResponse
+// @Failure 400 {object} utils.ErrorResponse
+// @Failure 401 {object} utils.ErrorResponse
+// @Failure 404 {object} utils.ErrorResponse
+// @Failure 500 {object} utils.ErrorResponse
+// @Router /api/v1/devices/{id} [delete]
+func (dc *DeviceController) RevokeDevice(c *gin.Context) {
+	deviceID, ok := parseDeviceID(c)
+	if !ok {
+		return
+	}
+
+	if err := dc.deviceService.RevokeDevice(c.Request.Context(), c.GetUint("user_id"), deviceID); err != nil {
+		dc.sendDeviceError(c, err, "Failed to revoke device")
+		return
+	}
+
+	event := newAuditEvent(c, models.AuditActionDeviceRevoked, "device", auditID(deviceID))
+	dc.auditService.Record(c.Request.Context(), event)
+
+	utils.SendSuccessResponse(c, nil, "Device revoked successfully")
+}
+
+func (dc *DeviceController) setTrusted(c *gin.Context, trusted bool) {
+	deviceID, ok := parseDeviceID(c)
+	if !ok {
+		return
+	}
+
+	device, err := dc.deviceService.SetTrusted(c.Request.Context(), c.GetUint("user_id"), deviceID, trusted)
+	if err != nil {
+		dc.sendDeviceError(c, err, "Failed to update device")
+		return
+	}
+
+	action := models.AuditActionDeviceTrusted
+	if !trusted {
+		action = models.AuditActionDeviceUntrusted
+	}
+	dc.auditService.Record(c.Request.Context(), newAuditEvent(c, action, "device", auditID(device.ID)))
+
+	utils.SendSuccessResponse(c, device, "Device updated successfully")
+}
+
+func (dc *DeviceController) sendDeviceError(c *gin.Context, err error, message string) {
+	if errors.Is(err, services.ErrDeviceNotFound) {
+		utils.SendNotFoundResponse(c, "Device not found")
+		return
+	}
+	dc.logger.Error(message, zap.Error(err))
+	utils.SendInternalServerErrorResponse(c, message)
+}
+
+func parseDeviceID(c *gin.Context) (uint, bool) {
+	deviceID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		utils.SendErrorResponse(c, http.StatusBadRequest, "Invalid device ID", nil)
+		return 0, false
+	}
+	return uint(deviceID), true
+}
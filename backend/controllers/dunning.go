@@ -0,0 +1,100 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"mobile-backend/models"
+	"mobile-backend/services"
+	"mobile-backend/utils"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// DunningController shows admins past due subscriptions and their dunning state
+type DunningController struct {
+	dunningService *services.DunningService
+	logger         *zap.Logger
+}
+
+// NewDunningController creates a new dunning controller
+func NewDunningController(dunningService *services.DunningService, logger *zap.Logger) *DunningController {
+	return &DunningController{
+		dunningService: dunningService,
+		logger:         logger,
+	}
+}
+
+// ListDunning godoc
+// @Summary List dunning
+// @Description Page through periods of failed subscription payments, most recently started first
+// @Tags admin
+// @Produce json
+// @Security BearerAuth
+// @Param page query int false "Page number" default(1)
+// @Param limit query int false "Items per page" default(20)
+// @Param state query string false "Only dunning in this state" Enums(grace, final_notice, downgraded, recovered, canceled)
+// @Success 200 {object} utils.PaginatedResponse{data=[]models.SubscriptionDunning}
+// @Failure 400 {object} utils.ErrorResponse
+// @Failure 401 {object} utils.ErrorResponse
+// @Failure 403 {object} utils.ErrorResponse
+// @Failure 500 {object} utils.ErrorResponse
+// @Router /api/v1/admin/dunning [get]
+func (dc *DunningController) ListDunning(c *gin.Context) {
+	req := utils.GetPaginationFromQuery(c)
+
+	state := c.Query("state")
+	switch state {
+	case "", models.DunningStateGrace, models.DunningStateFinalNotice, models.DunningStateDowngraded,
+		models.DunningStateRecovered, models.DunningStateCanceled:
+	default:
+		utils.SendErrorResponse(c, http.StatusBadRequest, "Invalid dunning state", nil)
+		return
+	}
+
+	dunning, total, err := dc.dunningService.ListDunning(c.Request.Context(), state, req.Page, req.Limit)
+	if err != nil {
+		dc.logger.Error("Failed to list dunning", zap.Error(err))
+		utils.SendInternalServerErrorResponse(c, "Failed to list dunning")
+		return
+	}
+
+	utils.SendPaginatedResponse(c, dunning, utils.CalculatePagination(req.Page, req.Limit, total), "Dunning retrieved successfully")
+}
+
+// GetSubscriptionDunning godoc
+// @Summary Get a subscription's dunning
+// @Description Get the dunning state of a subscription: its current grace period with the reminder schedule, and past periods of failed payments
+// @Tags admin
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "Subscription ID"
+// @Success 200 {object} utils.SuccessResponse{data=services.SubscriptionDunningStatus}
+// @Failure 400 {object} utils.ErrorResponse
+// @Failure 401 {object} utils.ErrorResponse
+// @Failure 403 {object} utils.ErrorResponse
+// @Failure 404 {object} utils.ErrorResponse
+// @Failure 500 {object} utils.ErrorResponse
+// @Router /api/v1/admin/subscriptions/{id}/dunning [get]
+func (dc *DunningController) GetSubscriptionDunning(c *gin.Context) {
+	subscriptionID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		utils.SendErrorResponse(c, http.StatusBadRequest, "Invalid subscription ID", nil)
+		return
+	}
+
+	status, err := dc.dunningService.GetSubscriptionDunning(c.Request.Context(), uint(subscriptionID))
+	if err != nil {
+		if errors.Is(err, services.ErrSubscriptionNotFound) {
+			utils.SendNotFoundResponse(c, "Subscription not found")
+			return
+		}
+		dc.logger.Error("Failed to get subscription dunning", zap.Error(err), zap.Uint64("subscription_id", subscriptionID))
+		utils.SendInternalServerErrorResponse(c, "Failed to get subscription dunning")
+		return
+	}
+
+	utils.SendSuccessResponse(c, status, "Subscription dunning retrieved successfully")
+}
@@ -0,0 +1,225 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+
+	"mobile-backend/models"
+	"mobile-backend/services"
+	"mobile-backend/utils"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// GuestController handles anonymous guest sign in and upgrading guests to full accounts
+type GuestController struct {
+	guestService        *services.GuestService
+	oauth2Service       *services.OAuth2Service
+	authService         *services.AuthService
+	verificationService *services.VerificationService
+	auditService        *services.AuditService
+	logger              *zap.Logger
+}
+
+// NewGuestController creates a new guest controller
+func NewGuestController(guestService *services.GuestService, oauth2Service *services.OAuth2Service, authService *services.AuthService, verificationService *services.VerificationService, auditService *services.AuditService, logger *zap.Logger) *GuestController {
+	return &GuestController{
+		guestService:        guestService,
+		oauth2Service:       oauth2Service,
+		authService:         authService,
+		verificationService: verificationService,
+		auditService:        auditService,
+		logger:              logger,
+	}
+}
+
+// UpgradeGuestRequest represents the request body for upgrading a guest with an email and password
+type UpgradeGuestRequest struct {
+	Email    string `json:"email" binding:"required,email"`
+	Password string `json:"password" binding:"required"`
+	Name     string `json:"name" binding:"omitempty,min=2"`
+}
+
+// SignIn godoc
+// @Summary Sign in as a guest
+// @Description Sign in anonymously. The guest account is bound to the device in the X-Device-ID header, and its refresh tokens only work from that device. The first sign in from a device creates the guest and returns a guest_secret; signing in as that guest again requires the secret in the X-Guest-Secret header.
+// @Tags auth
+// @Produce json
+// @Param X-Device-ID header string true "Stable device identifier"
+// @Param X-Guest-Secret header string false "Secret returned when the guest was created"
+// @Success 200 {object} utils.SuccessResponse{data=utils.GuestLoginResponse}
+// @Failure 400 {object} utils.ErrorResponse
+// @Failure 401 {object} utils.ErrorResponse
+// @Failure 403 {object} utils.ErrorResponse
+// @Failure 429 {object} utils.ErrorResponse
+// @Failure 500 {object} utils.ErrorResponse
+// @Router /api/v1/auth/guest [post]
+func (gc *GuestController) SignIn(c *gin.Context) {
+	user, secret, err := gc.guestService.SignIn(c.Request.Context(), c.GetHeader("X-Device-ID"), c.GetHeader("X-Guest-Secret"))
+	if err != nil {
+		switch {
+		case errors.Is(err, services.ErrGuestDeviceRequired):
+			utils.SendErrorResponse(c, http.StatusBadRequest, "The X-Device-ID header is required for guest sign in", nil)
+		case errors.Is(err, services.ErrInvalidGuestSecret):
+			utils.SendUnauthorizedResponse(c, "Invalid guest secret")
+		case errors.Is(err, services.ErrGuestAccountsDisabled):
+			utils.SendErrorResponse(c, http.StatusForbidden, "Guest accounts are disabled", nil)
+		case errors.Is(err, services.ErrAccountDeactivated):
+			utils.SendErrorResponse(c, http.StatusForbidden, "Account is deactivated", nil)
+		default:
+			gc.logger.Error("Failed to sign in guest", zap.Error(err))
+			utils.SendInternalServerErrorResponse(c, "Failed to sign in guest")
+		}
+		return
+	}
+
+	accessToken, refreshToken, err := gc.authService.GenerateTokens(c.Request.Context(), user, sessionMetadata(c))
+	if err != nil {
+		utils.SendInternalServerErrorResponse(c, "Failed to generate tokens")
+		return
+	}
+
+	action := models.AuditActionLogin
+	if secret != "" {
+		action = models.AuditActionGuestCreated
+	}
+	gc.auditService.Record(c.Request.Context(), newUserAuditEvent(c, action, user))
+
+	utils.SendSuccessResponse(c, utils.GuestLoginResponse{
+		LoginResponse: utils.LoginResponse{
+			User:         guestUserResponse(user),
+			AccessToken:  accessToken,
+			RefreshToken: refreshToken,
+			ExpiresIn:    15 * 60, // 15 minutes in seconds
+		},
+		GuestSecret: secret,
+	}, "Guest sign in successful")
+}
+
+// Upgrade godoc
+// @Summary Upgrade a guest with email and password
+// @Description Convert the current guest into a full account with an email and password. The account keeps its ID, so its data, sessions and devices are kept. A verification email is sent to the new address.
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param request body UpgradeGuestRequest true "Account credentials"
+// @Success 200 {object} utils.SuccessResponse{data=utils.UserResponse}
+// @Failure 400 {object} utils.ErrorResponse
+// @Failure 401 {object} utils.ErrorResponse
+// @Failure 409 {object} utils.ErrorResponse
+// @Failure 500 {object} utils.ErrorResponse
+// @Router /api/v1/auth/guest/upgrade [post]
+func (gc *GuestController) Upgrade(c *gin.Context) {
+	var req UpgradeGuestRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.SendValidationErrorResponse(c, parseValidationErrors(err))
+		return
+	}
+
+	user, err := gc.guestService.UpgradeWithPassword(c.Request.Context(), c.GetUint("user_id"), req.Email, req.Password, req.Name)
+	if err != nil {
+		if sendPasswordPolicyError(c, "password", err) {
+			return
+		}
+		switch {
+		case errors.Is(err, services.ErrNotGuestAccount):
+			utils.SendErrorResponse(c, http.StatusConflict, "Account is not a guest account", nil)
+		case errors.Is(err, services.ErrUserAlreadyExists):
+			utils.SendErrorResponse(c, http.StatusConflict, "User already exists", nil)
+		case errors.Is(err, services.ErrUserNotFound):
+			utils.SendNotFoundResponse(c, "User not found")
+		default:
+			gc.logger.Error("Failed to upgrade guest", zap.Error(err))
+			utils.SendInternalServerErrorResponse(c, "Failed to upgrade guest")
+		}
+		return
+	}
+
+	gc.recordUpgrade(c, user, "password")
+
+	// The upgrade succeeds even if the email can't be queued; the user can request a resend
+	_ = gc.verificationService.SendVerificationEmail(c.Request.Context(), user)
+
+	utils.SendSuccessResponse(c, guestUserResponse(user), "Guest account upgraded successfully")
+}
+
+// UpgradeWithIDToken godoc
+// @Summary Upgrade a guest with a provider ID token
+// @Description Convert the current guest into a full account using an ID token a native app obtained from the Google, Apple or other OIDC provider SDK. The identity is linked to the account, which keeps its ID and data. Browser apps can use the OAuth2 link flow instead.
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param provider path string true "OAuth2 provider"
+// @Param request body IDTokenExchangeRequest true "Provider ID token"
+// @Success 200 {object} utils.SuccessResponse{data=utils.UserResponse}
+// @Failure 400 {object} utils.ErrorResponse
+// @Failure 401 {object} utils.ErrorResponse
+// @Failure 409 {object} utils.ErrorResponse
+// @Failure 500 {object} utils.ErrorResponse
+// @Router /api/v1/auth/guest/upgrade/oauth2/{provider} [post]
+func (gc *GuestController) UpgradeWithIDToken(c *gin.Context) {
+	var req IDTokenExchangeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.SendValidationErrorResponse(c, parseValidationErrors(err))
+		return
+	}
+
+	result, err := gc.oauth2Service.UpgradeGuestWithIDToken(c.Request.Context(), c.GetUint("user_id"), services.OAuth2Provider(c.Param("provider")), services.IDTokenExchangeParams{
+		IDToken: req.IDToken,
+		Nonce:   req.Nonce,
+		Name:    req.Name,
+	})
+	if err != nil {
+		switch {
+		case errors.Is(err, services.ErrNotGuestAccount):
+			utils.SendErrorResponse(c, http.StatusConflict, "Account is not a guest account", nil)
+		case errors.Is(err, services.ErrUnsupportedOAuth2Provider):
+			utils.SendErrorResponse(c, http.StatusBadRequest, "Unsupported OAuth2 provider", nil)
+		case errors.Is(err, services.ErrIDTokenExchangeNotAllowed):
+			utils.SendErrorResponse(c, http.StatusBadRequest, "This provider does not support ID token login", nil)
+		case errors.Is(err, services.ErrInvalidIDToken):
+			utils.SendUnauthorizedResponse(c, "Invalid identity token")
+		case errors.Is(err, services.ErrOAuthEmailRequired):
+			utils.SendErrorResponse(c, http.StatusBadRequest, "The provider did not share an email address", nil)
+		case errors.Is(err, services.ErrOAuthAccountExists):
+			utils.SendErrorResponse(c, http.StatusConflict, "An account with this email already exists", nil)
+		case errors.Is(err, services.ErrIdentityAlreadyLinked):
+			utils.SendErrorResponse(c, http.StatusConflict, "This identity is already linked to another account", nil)
+		case errors.Is(err, services.ErrUserNotFound):
+			utils.SendNotFoundResponse(c, "User not found")
+		default:
+			gc.logger.Error("Failed to upgrade guest", zap.Error(err))
+			utils.SendInternalServerErrorResponse(c, "Failed to upgrade guest")
+		}
+		return
+	}
+
+	gc.recordUpgrade(c, result.User, result.Identity.Provider)
+	if !result.User.IsEmailVerified() {
+		_ = gc.verificationService.SendVerificationEmail(c.Request.Context(), result.User)
+	}
+
+	utils.SendSuccessResponse(c, guestUserResponse(result.User), "Guest account upgraded successfully")
+}
+
+func (gc *GuestController) recordUpgrade(c *gin.Context, user *models.User, method string) {
+	event := newUserAuditEvent(c, models.AuditActionGuestUpgraded, user)
+	event.Metadata["method"] = method
+	gc.auditService.Record(c.Request.Context(), event)
+}
+
+func guestUserResponse(user *models.User) utils.UserResponse {
+	return utils.UserResponse{
+		ID:              user.ID,
+		Email:           user.Email,
+		Name:            user.Name,
+		IsActive:        user.IsActive,
+		CreatedAt:       user.CreatedAt,
+		UpdatedAt:       user.UpdatedAt,
+		EmailVerifiedAt: user.EmailVerifiedAt,
+		IsGuest:         user.IsGuest,
+	}
+}
@@ -0,0 +1,192 @@
+package controllers
+
+import (
+	"errors"
+	"io"
+	"net/http"
+
+	"mobile-backend/models"
+	"mobile-backend/services"
+	"mobile-backend/utils"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// InAppPurchaseController handles App Store and Google Play purchase verification and
+// the stores' server notifications
+type InAppPurchaseController struct {
+	iapService   *services.InAppPurchaseService
+	auditService *services.AuditService
+	logger       *zap.Logger
+}
+
+// NewInAppPurchaseController creates a new in-app purchase controller
+func NewInAppPurchaseController(iapService *services.InAppPurchaseService, auditService *services.AuditService, logger *zap.Logger) *InAppPurchaseController {
+	return &InAppPurchaseController{
+		iapService:   iapService,
+		auditService: auditService,
+		logger:       logger,
+	}
+}
+
+// VerifyAppStoreTransactionRequest represents the request body for linking an App Store purchase
+type VerifyAppStoreTransactionRequest struct {
+	SignedTransaction string `json:"signed_transaction" binding:"required"`
+}
+
+// VerifyGooglePlayPurchaseRequest represents the request body for linking a Google Play purchase
+type VerifyGooglePlayPurchaseRequest struct {
+	ProductID     string `json:"product_id" binding:"required"`
+	PurchaseToken string `json:"purchase_token" binding:"required"`
+}
+
+// AppStoreNotificationRequest is the body of an App Store Server Notification V2
+type AppStoreNotificationRequest struct {
+	SignedPayload string `json:"signedPayload" binding:"required"`
+}
+
+// VerifyAppStoreTransaction godoc
+// @Summary Link an App Store subscription
+// @Description Verify a StoreKit 2 signed transaction (jwsRepresentation) after a purchase or restore and link its subscription to the current user
+// @Tags iap
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param request body VerifyAppStoreTransactionRequest true "Signed transaction"
+// @Success 200 {object} utils.SuccessResponse{data=models.Subscription}
+// @Failure 400 {object} utils.ErrorResponse
+// @Failure 401 {object} utils.ErrorResponse
+// @Failure 409 {object} utils.ErrorResponse
+// @Failure 422 {object} utils.ErrorResponse
+// @Failure 503 {object} utils.ErrorResponse
+// @Router /api/v1/iap/app-store/transactions [post]
+func (ic *InAppPurchaseController) VerifyAppStoreTransaction(c *gin.Context) {
+	var req VerifyAppStoreTransactionRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.SendErrorResponse(c, http.StatusBadRequest, "Invalid request data", map[string]interface{}{"error": err.Error()})
+		return
+	}
+
+	subscription, created, err := ic.iapService.VerifyAppStoreTransaction(c.Request.Context(), c.GetUint("user_id"), req.SignedTransaction)
+	ic.respond(c, subscription, created, err)
+}
+
+// VerifyGooglePlayPurchase godoc
+// @Summary Link a Google Play subscription
+// @Description Verify a Play Billing purchase token and link its subscription to the current user. The purchase is acknowledged with Google Play.
+// @Tags iap
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param request body VerifyGooglePlayPurchaseRequest true "Purchase token"
+// @Success 200 {object} utils.SuccessResponse{data=models.Subscription}
+// @Failure 400 {object} utils.ErrorResponse
+// @Failure 401 {object} utils.ErrorResponse
+// @Failure 409 {object} utils.ErrorResponse
+// @Failure 422 {object} utils.ErrorResponse
+// @Failure 503 {object} utils.ErrorResponse
+// @Router /api/v1/iap/google-play/purchases [post]
+func (ic *InAppPurchaseController) VerifyGooglePlayPurchase(c *gin.Context) {
+	var req VerifyGooglePlayPurchaseRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.SendErrorResponse(c, http.StatusBadRequest, "Invalid request data", map[string]interface{}{"error": err.Error()})
+		return
+	}
+
+	subscription, created, err := ic.iapService.VerifyGooglePlayPurchase(c.Request.Context(), c.GetUint("user_id"), req.ProductID, req.PurchaseToken)
+	ic.respond(c, subscription, created, err)
+}
+
+func (ic *InAppPurchaseController) respond(c *gin.Context, subscription *models.Subscription, created bool, err error) {
+	if err != nil {
+		switch {
+		case errors.Is(err, services.ErrInvalidStorePurchase), errors.Is(err, services.ErrStorePurchaseNotFound):
+			utils.SendErrorResponse(c, http.StatusBadRequest, "Invalid store purchase", nil)
+		case errors.Is(err, services.ErrStorePurchaseOwnedByAnotherUser):
+			utils.SendErrorResponse(c, http.StatusConflict, "This purchase is linked to another account", nil)
+		case errors.Is(err, services.ErrUnknownStoreProduct):
+			utils.SendErrorResponse(c, http.StatusUnprocessableEntity, "This store product is not available", nil)
+		case errors.Is(err, services.ErrStoreNotConfigured):
+			utils.SendErrorResponse(c, http.StatusServiceUnavailable, "This store is not configured", nil)
+		default:
+			ic.logger.Error("Failed to verify store purchase", zap.Error(err), zap.Uint("user_id", c.GetUint("user_id")))
+			utils.SendInternalServerErrorResponse(c, "Failed to verify store purchase")
+		}
+		return
+	}
+
+	if created {
+		recordSubscriptionCreated(c, ic.auditService, subscription)
+	}
+
+	utils.SendSuccessResponse(c, subscription, "Store purchase verified successfully")
+}
+
+// AppStoreNotification godoc
+// @Summary Handle App Store Server Notifications
+// @Description Receive App Store Server Notifications V2. Configure this URL as the production and sandbox notification URL in App Store Connect.
+// @Tags webhooks
+// @Accept json
+// @Produce json
+// @Param request body AppStoreNotificationRequest true "Signed notification"
+// @Success 200 {object} utils.SuccessResponse
+// @Failure 400 {object} utils.ErrorResponse
+// @Failure 500 {object} utils.ErrorResponse
+// @Router /api/v1/webhooks/app-store [post]
+func (ic *InAppPurchaseController) AppStoreNotification(c *gin.Context) {
+	var req AppStoreNotificationRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.SendErrorResponse(c, http.StatusBadRequest, "Invalid notification", nil)
+		return
+	}
+
+	if err := ic.iapService.HandleAppStoreNotification(c.Request.Context(), req.SignedPayload); err != nil {
+		ic.notificationError(c, "app_store", err)
+		return
+	}
+
+	utils.SendSuccessResponse(c, nil, "Notification processed successfully")
+}
+
+// GooglePlayNotification godoc
+// @Summary Handle Google Play real-time developer notifications
+// @Description Receive Pub/Sub push messages carrying Google Play real-time developer notifications. The push endpoint must include the configured token query parameter.
+// @Tags webhooks
+// @Accept json
+// @Produce json
+// @Param token query string true "Push endpoint token"
+// @Success 200 {object} utils.SuccessResponse
+// @Failure 400 {object} utils.ErrorResponse
+// @Failure 401 {object} utils.ErrorResponse
+// @Failure 500 {object} utils.ErrorResponse
+// @Router /api/v1/webhooks/google-play [post]
+func (ic *InAppPurchaseController) GooglePlayNotification(c *gin.Context) {
+	body, err := io.ReadAll(c.Request.Body)
+	if err != nil {
+		utils.SendErrorResponse(c, http.StatusBadRequest, "Failed to read request body", nil)
+		return
+	}
+
+	if err := ic.iapService.HandleGooglePlayNotification(c.Request.Context(), c.Query("token"), body); err != nil {
+		ic.notificationError(c, "google_play", err)
+		return
+	}
+
+	utils.SendSuccessResponse(c, nil, "Notification processed successfully")
+}
+
+// notificationError answers a failed notification. Anything but a rejected notification
+// is answered with a server error so the store redelivers it.
+func (ic *InAppPurchaseController) notificationError(c *gin.Context, store string, err error) {
+	switch {
+	case errors.Is(err, services.ErrInvalidStoreNotification):
+		ic.logger.Warn("Rejected store notification", zap.String("store", store), zap.Error(err))
+		utils.SendErrorResponse(c, http.StatusUnauthorized, "Invalid notification", nil)
+	case errors.Is(err, services.ErrStoreNotConfigured):
+		utils.SendErrorResponse(c, http.StatusNotFound, "This store is not configured", nil)
+	default:
+		ic.logger.Error("Failed to process store notification", zap.String("store", store), zap.Error(err))
+		utils.SendInternalServerErrorResponse(c, "Failed to process notification")
+	}
+}
@@ -0,0 +1,31 @@
+package controllers
+
+import (
+	"net/http"
+
+	"mobile-backend/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+// JWKSController publishes the public keys used to verify issued JWTs
+type JWKSController struct {
+	keyring *utils.Keyring
+}
+
+// NewJWKSController creates a new JWKS controller
+func NewJWKSController(keyring *utils.Keyring) *JWKSController {
+	return &JWKSController{keyring: keyring}
+}
+
+// GetJWKS godoc
+// @Summary JSON Web Key Set
+// @Description Public keys for verifying access tokens, selected by the token's kid header
+// @Tags auth
+// @Produce json
+// @Success 200 {object} utils.JWKSet
+// @Router /.well-known/jwks.json [get]
+func (jc *JWKSController) GetJWKS(c *gin.Context) {
+	c.Header("Cache-Control", "public, max-age=300")
+	c.JSON(http.StatusOK, jc.keyring.JWKS())
+}
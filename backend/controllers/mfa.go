@@ -0,0 +1,286 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+
+	"mobile-backend/models"
+	"mobile-backend/services"
+	"mobile-backend/utils"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// MFAController handles TOTP two-factor enrollment and login challenges
+type MFAController struct {
+	authService  *services.AuthService
+	mfaService   *services.MFAService
+	auditService *services.AuditService
+	logger       *zap.Logger
+}
+
+// NewMFAController creates a new MFA controller
+func NewMFAController(authService *services.AuthService, mfaService *services.MFAService, auditService *services.AuditService, logger *zap.Logger) *MFAController {
+	return &MFAController{
+		authService:  authService,
+		mfaService:   mfaService,
+		auditService: auditService,
+		logger:       logger,
+	}
+}
+
+type MFACodeRequest struct {
+	Code string `json:"code" binding:"required"`
+}
+
+type MFAVerifyRequest struct {
+	MFAToken string `json:"mfa_token" binding:"required"`
+	Code     string `json:"code" binding:"required"`
+}
+
+// RecoveryCodesResponse lists newly issued recovery codes. They are shown only once.
+type RecoveryCodesResponse struct {
+	RecoveryCodes []string `json:"recovery_codes"`
+}
+
+// VerifyChallenge godoc
+// @Summary Complete two-factor login
+// @Description Exchange the mfa_token returned by login and a TOTP or recovery code for an access/refresh token pair. Wrong codes count as failed logins; after a few the mfa_token is revoked, and a locked or throttled account gets 429 with a Retry-After header.
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Param request body MFAVerifyRequest true "Challenge token and code"
+// @Success 200 {object} utils.SuccessResponse{data=utils.LoginResponse} "Token pair, or utils.PasswordChangeResponse when the password used to log in has expired"
+// @Failure 400 {object} utils.ErrorResponse
+// @Failure 401 {object} utils.ErrorResponse
+// @Failure 429 {object} utils.ErrorResponse
+// @Failure 500 {object} utils.ErrorResponse
+// @Router /api/v1/auth/mfa/verify [post]
+func (mc *MFAController) VerifyChallenge(c *gin.Context) {
+	var req MFAVerifyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.SendValidationErrorResponse(c, parseValidationErrors(err))
+		return
+	}
+
+	user, changeToken, err := mc.authService.VerifyMFAChallenge(c.Request.Context(), req.MFAToken, req.Code, c.ClientIP())
+	if err != nil {
+		if sendLoginRetryError(c, err) || sendPasswordExpired(c, err, changeToken) {
+			return
+		}
+		switch {
+		case errors.Is(err, services.ErrInvalidMFAToken):
+			utils.SendUnauthorizedResponse(c, "Invalid or expired MFA token")
+		case errors.Is(err, services.ErrInvalidMFACode), errors.Is(err, services.ErrMFANotEnabled):
+			utils.SendUnauthorizedResponse(c, "Invalid verification code")
+		default:
+			mc.logger.Error("Failed to verify MFA challenge", zap.Error(err))
+			utils.SendInternalServerErrorResponse(c, "Failed to verify MFA challenge")
+		}
+		return
+	}
+
+	accessToken, refreshToken, err := mc.authService.GenerateTokens(c.Request.Context(), user, sessionMetadata(c))
+	if err != nil {
+		utils.SendInternalServerErrorResponse(c, "Failed to generate tokens")
+		return
+	}
+
+	event := newUserAuditEvent(c, models.AuditActionLogin, user)
+	event.Metadata["mfa"] = true
+	mc.auditService.Record(c.Request.Context(), event)
+
+	loginResponse := utils.LoginResponse{
+		User: utils.UserResponse{
+			ID:              user.ID,
+			Email:           user.Email,
+			Name:            user.Name,
+			IsActive:        user.IsActive,
+			EmailVerifiedAt: user.EmailVerifiedAt,
+			CreatedAt:       user.CreatedAt,
+			UpdatedAt:       user.UpdatedAt,
+		},
+		AccessToken:  accessToken,
+		RefreshToken: refreshToken,
+		ExpiresIn:    int(utils.AccessTokenTTL.Seconds()),
+	}
+
+	utils.SendSuccessResponse(c, loginResponse, "Login successful")
+}
+
+// GetStatus godoc
+// @Summary Get two-factor status
+// @Description Get whether two-factor authentication is enabled and how many recovery codes remain
+// @Tags mfa
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {object} utils.SuccessResponse{data=services.MFAStatus}
+// @Failure 401 {object} utils.ErrorResponse
+// @Failure 500 {object} utils.ErrorResponse
+// @Router /api/v1/auth/mfa [get]
+func (mc *MFAController) GetStatus(c *gin.Context) {
+	status, err := mc.mfaService.GetStatus(c.Request.Context(), c.GetUint("user_id"))
+	if err != nil {
+		mc.logger.Error("Failed to get MFA status", zap.Error(err))
+		utils.SendInternalServerErrorResponse(c, "Failed to get MFA status")
+		return
+	}
+
+	utils.SendSuccessResponse(c, status, "MFA status retrieved successfully")
+}
+
+// Enroll godoc
+// @Summary Start TOTP enrollment
+// @Description Generate a TOTP secret and otpauth URI to add to an authenticator app. Enrollment is confirmed with /auth/mfa/enable.
+// @Tags mfa
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {object} utils.SuccessResponse{data=services.MFAEnrollment}
+// @Failure 401 {object} utils.ErrorResponse
+// @Failure 409 {object} utils.ErrorResponse
+// @Failure 500 {object} utils.ErrorResponse
+// @Router /api/v1/auth/mfa/enroll [post]
+func (mc *MFAController) Enroll(c *gin.Context) {
+	user, err := mc.authService.GetUserByID(c.GetUint("user_id"))
+	if err != nil {
+		utils.SendNotFoundResponse(c, "User not found")
+		return
+	}
+
+	enrollment, err := mc.mfaService.BeginEnrollment(c.Request.Context(), user)
+	if err != nil {
+		if errors.Is(err, services.ErrMFAAlreadyEnabled) {
+			utils.SendErrorResponse(c, http.StatusConflict, "Two-factor authentication is already enabled", nil)
+			return
+		}
+		mc.logger.Error("Failed to start MFA enrollment", zap.Error(err))
+		utils.SendInternalServerErrorResponse(c, "Failed to start MFA enrollment")
+		return
+	}
+
+	utils.SendSuccessResponse(c, enrollment, "Scan the QR code with your authenticator app")
+}
+
+// Enable godoc
+// @Summary Confirm TOTP enrollment
+// @Description Enable two-factor authentication by submitting a code from the authenticator app. Returns one-time recovery codes.
+// @Tags mfa
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param request body MFACodeRequest true "TOTP code"
+// @Success 200 {object} utils.SuccessResponse{data=RecoveryCodesResponse}
+// @Failure 400 {object} utils.ErrorResponse
+// @Failure 401 {object} utils.ErrorResponse
+// @Failure 409 {object} utils.ErrorResponse
+// @Failure 500 {object} utils.ErrorResponse
+// @Router /api/v1/auth/mfa/enable [post]
+func (mc *MFAController) Enable(c *gin.Context) {
+	var req MFACodeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.SendValidationErrorResponse(c, parseValidationErrors(err))
+		return
+	}
+
+	codes, err := mc.mfaService.ConfirmEnrollment(c.Request.Context(), c.GetUint("user_id"), req.Code)
+	if err != nil {
+		switch {
+		case errors.Is(err, services.ErrMFANotEnrolled):
+			utils.SendErrorResponse(c, http.StatusBadRequest, "Start enrollment before enabling two-factor authentication", nil)
+		case errors.Is(err, services.ErrMFAAlreadyEnabled):
+			utils.SendErrorResponse(c, http.StatusConflict, "Two-factor authentication is already enabled", nil)
+		case errors.Is(err, services.ErrInvalidMFACode):
+			utils.SendErrorResponse(c, http.StatusBadRequest, "Invalid verification code", nil)
+		default:
+			mc.logger.Error("Failed to enable MFA", zap.Error(err))
+			utils.SendInternalServerErrorResponse(c, "Failed to enable MFA")
+		}
+		return
+	}
+
+	mc.auditService.Record(c.Request.Context(), newAuditEvent(c, models.AuditActionMFAEnabled, "user", auditID(c.GetUint("user_id"))))
+
+	utils.SendSuccessResponse(c, RecoveryCodesResponse{RecoveryCodes: codes}, "Two-factor authentication enabled")
+}
+
+// Disable godoc
+// @Summary Disable two-factor authentication
+// @Description Disable two-factor authentication after verifying a TOTP or recovery code. Wrong codes count as failed logins.
+// @Tags mfa
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param request body MFACodeRequest true "TOTP or recovery code"
+// @Success 200 {object} utils.SuccessResponse
+// @Failure 400 {object} utils.ErrorResponse
+// @Failure 401 {object} utils.ErrorResponse
+// @Failure 429 {object} utils.ErrorResponse
+// @Failure 500 {object} utils.ErrorResponse
+// @Router /api/v1/auth/mfa/disable [post]
+func (mc *MFAController) Disable(c *gin.Context) {
+	var req MFACodeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.SendValidationErrorResponse(c, parseValidationErrors(err))
+		return
+	}
+
+	if err := mc.mfaService.Disable(c.Request.Context(), c.GetUint("user_id"), req.Code, c.ClientIP()); err != nil {
+		mc.sendCodeError(c, err, "Failed to disable MFA")
+		return
+	}
+
+	mc.auditService.Record(c.Request.Context(), newAuditEvent(c, models.AuditActionMFADisabled, "user", auditID(c.GetUint("user_id"))))
+
+	utils.SendSuccessResponse(c, nil, "Two-factor authentication disabled")
+}
+
+// RegenerateRecoveryCodes godoc
+// @Summary Regenerate recovery codes
+// @Description Replace all recovery codes after verifying a TOTP or recovery code. Wrong codes count as failed logins.
+// @Tags mfa
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param request body MFACodeRequest true "TOTP or recovery code"
+// @Success 200 {object} utils.SuccessResponse{data=RecoveryCodesResponse}
+// @Failure 400 {object} utils.ErrorResponse
+// @Failure 401 {object} utils.ErrorResponse
+// @Failure 429 {object} utils.ErrorResponse
+// @Failure 500 {object} utils.ErrorResponse
+// @Router /api/v1/auth/mfa/recovery-codes [post]
+func (mc *MFAController) RegenerateRecoveryCodes(c *gin.Context) {
+	var req MFACodeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.SendValidationErrorResponse(c, parseValidationErrors(err))
+		return
+	}
+
+	codes, err := mc.mfaService.RegenerateRecoveryCodes(c.Request.Context(), c.GetUint("user_id"), req.Code, c.ClientIP())
+	if err != nil {
+		mc.sendCodeError(c, err, "Failed to regenerate recovery codes")
+		return
+	}
+
+	mc.auditService.Record(c.Request.Context(), newAuditEvent(c, models.AuditActionRecoveryCodesReset, "user", auditID(c.GetUint("user_id"))))
+
+	utils.SendSuccessResponse(c, RecoveryCodesResponse{RecoveryCodes: codes}, "Recovery codes regenerated")
+}
+
+// sendCodeError maps errors from code-protected MFA operations to responses
+func (mc *MFAController) sendCodeError(c *gin.Context, err error, message string) {
+	if sendLoginRetryError(c, err) {
+		return
+	}
+	switch {
+	case errors.Is(err, services.ErrMFANotEnabled):
+		utils.SendErrorResponse(c, http.StatusBadRequest, "Two-factor authentication is not enabled", nil)
+	case errors.Is(err, services.ErrInvalidMFACode):
+		utils.SendErrorResponse(c, http.StatusBadRequest, "Invalid verification code", nil)
+	default:
+		mc.logger.Error(message, zap.Error(err))
+		utils.SendInternalServerErrorResponse(c, message)
+	}
+}
@@ -1,15 +1,24 @@
 package controllers
 
 import (
+	"errors"
 	"net/http"
+	"strconv"
 
+	"mobile-backend/models"
 	"mobile-backend/services"
 	"mobile-backend/utils"
 
 	"github.com/gin-gonic/gin"
-	"github.com/google/uuid"
 )
 
+// IDTokenExchangeRequest is sent by native apps that signed in with a provider SDK
+type IDTokenExchangeRequest struct {
+	IDToken string `json:"id_token" binding:"required"`
+	Nonce   string `json:"nonce"`
+	Name    string `json:"name"` // Apple only shares the user's name with the app, on first sign in
+}
+
 type OAuth2Controller struct {
 	oauth2Service *services.OAuth2Service
 	authService   *services.AuthService
@@ -24,36 +33,45 @@ func NewOAuth2Controller(oauth2Service *services.OAuth2Service, authService *ser
 
 // OAuth2Login godoc
 // @Summary OAuth2 login
-// @Description Initiate OAuth2 login with specified provider
+// @Description Initiate OAuth2 login with specified provider. The flow uses PKCE, and OIDC providers also bind the login to a nonce.
 // @Tags auth
 // @Accept json
 // @Produce json
-// @Param provider path string true "OAuth2 provider" Enums(google, github)
+// @Param provider path string true "OAuth2 provider, see /api/v1/auth/oauth2/providers"
 // @Success 200 {object} map[string]string
 // @Failure 400 {object} utils.ErrorResponse
 // @Failure 500 {object} utils.ErrorResponse
 // @Router /api/v1/auth/oauth2/{provider} [get]
 func (oc *OAuth2Controller) OAuth2Login(c *gin.Context) {
-	provider := services.OAuth2Provider(c.Param("provider"))
-
-	// Validate provider
-	if provider != services.GoogleProvider && provider != services.GitHubProvider {
-		utils.SendErrorResponse(c, http.StatusBadRequest, "Unsupported OAuth2 provider", nil)
-		return
-	}
+	oc.beginFlow(c, 0)
+}
 
-	// Generate state parameter for security
-	state := uuid.New().String()
+// OAuth2Link godoc
+// @Summary Link an OAuth2 identity
+// @Description Start an OAuth2 flow whose identity is linked to the current user instead of logging in. A guest is upgraded to a full account with the identity's email.
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param provider path string true "OAuth2 provider"
+// @Success 200 {object} map[string]string
+// @Failure 400 {object} utils.ErrorResponse
+// @Failure 401 {object} utils.ErrorResponse
+// @Failure 500 {object} utils.ErrorResponse
+// @Router /api/v1/auth/oauth2/{provider}/link [post]
+func (oc *OAuth2Controller) OAuth2Link(c *gin.Context) {
+	oc.beginFlow(c, c.GetUint("user_id"))
+}
 
-	// Store state in Redis
-	if err := oc.oauth2Service.StoreOAuthState(c.Request.Context(), state, provider); err != nil {
-		utils.SendInternalServerErrorResponse(c, "Failed to store OAuth state")
-		return
-	}
+func (oc *OAuth2Controller) beginFlow(c *gin.Context, linkUserID uint) {
+	provider := services.OAuth2Provider(c.Param("provider"))
 
-	// Get authorization URL
-	authURL, err := oc.oauth2Service.GetAuthURL(provider, state)
+	authURL, state, err := oc.oauth2Service.BeginLogin(c.Request.Context(), provider, linkUserID)
 	if err != nil {
+		if errors.Is(err, services.ErrUnsupportedOAuth2Provider) {
+			utils.SendErrorResponse(c, http.StatusBadRequest, "Unsupported OAuth2 provider", nil)
+			return
+		}
 		utils.SendInternalServerErrorResponse(c, "Failed to generate OAuth URL")
 		return
 	}
@@ -66,68 +84,216 @@ func (oc *OAuth2Controller) OAuth2Login(c *gin.Context) {
 
 // OAuth2Callback godoc
 // @Summary OAuth2 callback
-// @Description Handle OAuth2 callback and complete authentication
+// @Description Handle OAuth2 callback and complete authentication. Sign in with Apple posts the callback as a form (response_mode=form_post).
 // @Tags auth
-// @Accept json
+// @Accept json,x-www-form-urlencoded
 // @Produce json
 // @Param code query string true "Authorization code"
 // @Param state query string true "State parameter"
-// @Success 200 {object} utils.SuccessResponse{data=utils.LoginResponse}
+// @Success 200 {object} utils.SuccessResponse{data=utils.LoginResponse} "Token pair, utils.MFAChallengeResponse when two-factor authentication is enabled, the linked identity, or the upgraded guest's utils.UserResponse"
 // @Failure 400 {object} utils.ErrorResponse
 // @Failure 401 {object} utils.ErrorResponse
+// @Failure 409 {object} utils.ErrorResponse
 // @Failure 500 {object} utils.ErrorResponse
 // @Router /api/v1/auth/oauth2/callback [get]
+// @Router /api/v1/auth/oauth2/callback [post]
 func (oc *OAuth2Controller) OAuth2Callback(c *gin.Context) {
-	code := c.Query("code")
-	state := c.Query("state")
+	if providerError := callbackParam(c, "error"); providerError != "" {
+		utils.SendErrorResponse(c, http.StatusBadRequest, "OAuth2 provider returned an error", map[string]interface{}{
+			"error": providerError,
+		})
+		return
+	}
 
-	if code == "" || state == "" {
+	params := services.OAuth2CallbackParams{
+		Code:      callbackParam(c, "code"),
+		State:     callbackParam(c, "state"),
+		AppleUser: c.PostForm("user"),
+	}
+	if params.Code == "" || params.State == "" {
 		utils.SendErrorResponse(c, http.StatusBadRequest, "Missing code or state parameter", nil)
 		return
 	}
 
-	// Validate state
-	provider, err := oc.oauth2Service.ValidateOAuthState(c.Request.Context(), state)
+	result, err := oc.oauth2Service.HandleCallback(c.Request.Context(), params)
 	if err != nil {
-		utils.SendErrorResponse(c, http.StatusBadRequest, "Invalid or expired state", nil)
+		switch {
+		case errors.Is(err, services.ErrInvalidOAuthState):
+			utils.SendErrorResponse(c, http.StatusBadRequest, "Invalid or expired state", nil)
+		case errors.Is(err, services.ErrInvalidIDToken):
+			utils.SendUnauthorizedResponse(c, "Invalid identity token")
+		case errors.Is(err, services.ErrOAuthEmailRequired):
+			utils.SendErrorResponse(c, http.StatusBadRequest, "The provider did not share an email address", nil)
+		case errors.Is(err, services.ErrOAuthAccountExists):
+			utils.SendErrorResponse(c, http.StatusConflict, "An account with this email already exists. Sign in and link this provider from your account.", nil)
+		case errors.Is(err, services.ErrIdentityAlreadyLinked):
+			utils.SendErrorResponse(c, http.StatusConflict, "This identity is already linked to another account", nil)
+		default:
+			utils.SendInternalServerErrorResponse(c, "Failed to complete OAuth2 login")
+		}
+		return
+	}
+
+	if result.Upgraded {
+		utils.SendSuccessResponse(c, guestUserResponse(result.User), "Guest account upgraded successfully")
+		return
+	}
+	if result.Linked {
+		utils.SendSuccessResponse(c, result.Identity, "Identity linked successfully")
+		return
+	}
+
+	oc.completeLogin(c, result.User)
+}
+
+// OAuth2Token godoc
+// @Summary Exchange a provider ID token
+// @Description Log in with an ID token a native app obtained from the Google, Apple or other OIDC provider SDK. The token is verified against the provider's published keys and must be issued to one of the configured client IDs.
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Param provider path string true "OAuth2 provider"
+// @Param request body IDTokenExchangeRequest true "Provider ID token"
+// @Success 200 {object} utils.SuccessResponse{data=utils.LoginResponse} "Token pair, or utils.MFAChallengeResponse when two-factor authentication is enabled"
+// @Failure 400 {object} utils.ErrorResponse
+// @Failure 401 {object} utils.ErrorResponse
+// @Failure 409 {object} utils.ErrorResponse
+// @Failure 500 {object} utils.ErrorResponse
+// @Router /api/v1/auth/oauth2/{provider}/token [post]
+func (oc *OAuth2Controller) OAuth2Token(c *gin.Context) {
+	var req IDTokenExchangeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.SendValidationErrorResponse(c, parseValidationErrors(err))
 		return
 	}
 
-	// Exchange code for access token
-	accessToken, err := oc.oauth2Service.ExchangeCodeForToken(provider, code)
+	result, err := oc.oauth2Service.ExchangeIDToken(c.Request.Context(), services.OAuth2Provider(c.Param("provider")), services.IDTokenExchangeParams{
+		IDToken: req.IDToken,
+		Nonce:   req.Nonce,
+		Name:    req.Name,
+	})
 	if err != nil {
-		utils.SendInternalServerErrorResponse(c, "Failed to exchange code for token")
+		switch {
+		case errors.Is(err, services.ErrUnsupportedOAuth2Provider):
+			utils.SendErrorResponse(c, http.StatusBadRequest, "Unsupported OAuth2 provider", nil)
+		case errors.Is(err, services.ErrIDTokenExchangeNotAllowed):
+			utils.SendErrorResponse(c, http.StatusBadRequest, "This provider does not support ID token login", nil)
+		case errors.Is(err, services.ErrInvalidIDToken):
+			utils.SendUnauthorizedResponse(c, "Invalid identity token")
+		case errors.Is(err, services.ErrOAuthEmailRequired):
+			utils.SendErrorResponse(c, http.StatusBadRequest, "The provider did not share an email address", nil)
+		case errors.Is(err, services.ErrOAuthAccountExists):
+			utils.SendErrorResponse(c, http.StatusConflict, "An account with this email already exists. Sign in and link this provider from your account.", nil)
+		default:
+			utils.SendInternalServerErrorResponse(c, "Failed to complete OAuth2 login")
+		}
 		return
 	}
 
-	// Get user info from OAuth2 provider
-	oauthUser, err := oc.oauth2Service.GetUserInfo(provider, accessToken)
+	oc.completeLogin(c, result.User)
+}
+
+// OAuth2Providers godoc
+// @Summary Get available OAuth2 providers
+// @Description Get list of available OAuth2 providers
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Success 200 {object} utils.SuccessResponse{data=[]services.OAuth2ProviderInfo}
+// @Router /api/v1/auth/oauth2/providers [get]
+func (oc *OAuth2Controller) OAuth2Providers(c *gin.Context) {
+	utils.SendSuccessResponse(c, oc.oauth2Service.Providers(), "Available OAuth2 providers")
+}
+
+// ListIdentities godoc
+// @Summary List linked identities
+// @Description List the OAuth2 provider identities linked to the current user
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {object} utils.SuccessResponse{data=[]models.UserIdentity}
+// @Failure 401 {object} utils.ErrorResponse
+// @Failure 500 {object} utils.ErrorResponse
+// @Router /api/v1/auth/identities [get]
+func (oc *OAuth2Controller) ListIdentities(c *gin.Context) {
+	identities, err := oc.oauth2Service.ListIdentities(c.Request.Context(), c.GetUint("user_id"))
+	if err != nil {
+		utils.SendInternalServerErrorResponse(c, "Failed to list identities")
+		return
+	}
+
+	utils.SendSuccessResponse(c, identities, "Identities retrieved successfully")
+}
+
+// UnlinkIdentity godoc
+// @Summary Unlink an identity
+// @Description Remove an OAuth2 provider identity from the current user
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "Identity ID"
+// @Success 200 {object} utils.SuccessResponse
+// @Failure 400 {object} utils.ErrorResponse
+// @Failure 401 {object} utils.ErrorResponse
+// @Failure 404 {object} utils.ErrorResponse
+// @Failure 500 {object} utils.ErrorResponse
+// @Router /api/v1/auth/identities/{id} [delete]
+func (oc *OAuth2Controller) UnlinkIdentity(c *gin.Context) {
+	identityID, err := strconv.ParseUint(c.Param("id"), 10, 32)
 	if err != nil {
-		utils.SendInternalServerErrorResponse(c, "Failed to get user info")
+		utils.SendErrorResponse(c, http.StatusBadRequest, "Invalid identity ID", nil)
 		return
 	}
 
-	// Create or update user in database
-	user, err := oc.oauth2Service.CreateOrUpdateUser(c.Request.Context(), oauthUser)
+	if err := oc.oauth2Service.UnlinkIdentity(c.Request.Context(), c.GetUint("user_id"), uint(identityID)); err != nil {
+		if errors.Is(err, services.ErrIdentityNotFound) {
+			utils.SendNotFoundResponse(c, "Identity not found")
+			return
+		}
+		utils.SendInternalServerErrorResponse(c, "Failed to unlink identity")
+		return
+	}
+
+	utils.SendSuccessResponse(c, nil, "Identity unlinked successfully")
+}
+
+// completeLogin issues a token pair for a user resolved from a provider identity, or
+// an MFA challenge when the user has two-factor authentication enabled
+func (oc *OAuth2Controller) completeLogin(c *gin.Context, user *models.User) {
+	mfaToken, err := oc.authService.LoginExternalUser(c.Request.Context(), user, c.ClientIP())
 	if err != nil {
-		utils.SendInternalServerErrorResponse(c, "Failed to create/update user")
+		if errors.Is(err, services.ErrMFARequired) {
+			utils.SendSuccessResponse(c, utils.MFAChallengeResponse{
+				MFARequired: true,
+				MFAToken:    mfaToken,
+				ExpiresIn:   int(utils.MFAChallengeTTL.Seconds()),
+			}, "Two-factor authentication required")
+			return
+		}
+		if sendLoginRetryError(c, err) || sendPasswordResetRequired(c, err) {
+			return
+		}
+		utils.SendUnauthorizedResponse(c, "Login not allowed")
 		return
 	}
 
 	// Generate JWT tokens
-	accessTokenJWT, refreshToken, err := utils.GenerateAccessAndRefreshTokens(user.ID, user.Email)
+	accessTokenJWT, refreshToken, err := oc.authService.GenerateTokens(c.Request.Context(), user, sessionMetadata(c))
 	if err != nil {
 		utils.SendInternalServerErrorResponse(c, "Failed to generate tokens")
 		return
 	}
 
 	userResponse := utils.UserResponse{
-		ID:        user.ID,
-		Email:     user.Email,
-		Name:      user.Name,
-		IsActive:  user.IsActive,
-		CreatedAt: user.CreatedAt,
-		UpdatedAt: user.UpdatedAt,
+		ID:              user.ID,
+		Email:           user.Email,
+		Name:            user.Name,
+		IsActive:        user.IsActive,
+		CreatedAt:       user.CreatedAt,
+		UpdatedAt:       user.UpdatedAt,
+		EmailVerifiedAt: user.EmailVerifiedAt,
 	}
 
 	loginResponse := utils.LoginResponse{
@@ -140,19 +306,10 @@ func (oc *OAuth2Controller) OAuth2Callback(c *gin.Context) {
 	utils.SendSuccessResponse(c, loginResponse, "OAuth2 login successful")
 }
 
-// OAuth2Providers godoc
-// @Summary Get available OAuth2 providers
-// @Description Get list of available OAuth2 providers
-// @Tags auth
-// @Accept json
-// @Produce json
-// @Success 200 {object} utils.SuccessResponse{data=[]string}
-// @Router /api/v1/auth/oauth2/providers [get]
-func (oc *OAuth2Controller) OAuth2Providers(c *gin.Context) {
-	providers := []string{
-		string(services.GoogleProvider),
-		string(services.GitHubProvider),
+// callbackParam reads a callback value from the posted form or the query string
+func callbackParam(c *gin.Context, key string) string {
+	if value := c.PostForm(key); value != "" {
+		return value
 	}
-
-	utils.SendSuccessResponse(c, providers, "Available OAuth2 providers")
+	return c.Query(key)
 }
@@ -1,6 +1,7 @@
 package controllers
 
 import (
+	"errors"
 	"net/http"
 	"strconv"
 	"time"
@@ -108,6 +109,10 @@ func (osc *OfflineSyncController) QueueOperation(c *gin.Context) {
 
 	// Queue the operation
 	if err := osc.offlineSyncService.QueueOperation(c.Request.Context(), userIDUint, operation); err != nil {
+		if errors.Is(err, models.ErrTenantRequired) {
+			utils.SendErrorResponse(c, http.StatusBadRequest, "Organization required to sync "+req.TableName, nil)
+			return
+		}
 		osc.logger.Error("Failed to queue operation", zap.Error(err))
 		utils.SendErrorResponse(c, http.StatusInternalServerError, "Failed to queue operation", nil)
 		return
@@ -31,7 +31,7 @@ func NewOrderController(db *gorm.DB) *OrderController {
 func (c *OrderController) GetOrderList(ctx *gin.Context) {
 	var orders []models.Order
 
-	if err := c.db.Find(&orders).Error; err != nil {
+	if err := c.db.WithContext(ctx.Request.Context()).Find(&orders).Error; err != nil {
 		utils.SendErrorResponse(ctx, http.StatusInternalServerError, "Failed to fetch orders", nil)
 		return
 	}
@@ -59,7 +59,7 @@ func (c *OrderController) GetOrder(ctx *gin.Context) {
 	}
 
 	var order models.Order
-	if err := c.db.First(&order, uint(id)).Error; err != nil {
+	if err := c.db.WithContext(ctx.Request.Context()).First(&order, uint(id)).Error; err != nil {
 		if err == gorm.ErrRecordNotFound {
 			utils.SendNotFoundResponse(ctx, "Order not found")
 			return
@@ -91,7 +91,7 @@ func (c *OrderController) CreateOrder(ctx *gin.Context) {
 		return
 	}
 
-	if err := c.db.Create(&order).Error; err != nil {
+	if err := c.db.WithContext(ctx.Request.Context()).Create(&order).Error; err != nil {
 		utils.SendErrorResponse(ctx, http.StatusInternalServerError, "Failed to create order", nil)
 		return
 	}
@@ -121,7 +121,7 @@ func (c *OrderController) UpdateOrder(ctx *gin.Context) {
 	}
 
 	var order models.Order
-	if err := c.db.First(&order, uint(id)).Error; err != nil {
+	if err := c.db.WithContext(ctx.Request.Context()).First(&order, uint(id)).Error; err != nil {
 		if err == gorm.ErrRecordNotFound {
 			utils.SendNotFoundResponse(ctx, "Order not found")
 			return
@@ -135,7 +135,10 @@ func (c *OrderController) UpdateOrder(ctx *gin.Context) {
 		return
 	}
 
-	if err := c.db.Save(&order).Error; err != nil {
+	// The path decides which record is updated, not the body
+	order.ID = uint(id)
+
+	if err := c.db.WithContext(ctx.Request.Context()).Save(&order).Error; err != nil {
 		utils.SendErrorResponse(ctx, http.StatusInternalServerError, "Failed to update order", nil)
 		return
 	}
@@ -157,7 +160,7 @@ func (c *OrderController) DeleteOrder(ctx *gin.Context) {
 		return
 	}
 
-	if err := c.db.Delete(&models.Order{}, uint(id)).Error; err != nil {
+	if err := c.db.WithContext(ctx.Request.Context()).Delete(&models.Order{}, uint(id)).Error; err != nil {
 		utils.SendErrorResponse(ctx, http.StatusInternalServerError, "Failed to delete order", nil)
 		return
 	}
@@ -0,0 +1,463 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"mobile-backend/models"
+	"mobile-backend/services"
+	"mobile-backend/utils"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// OrganizationController manages organizations, their members and invitations
+type OrganizationController struct {
+	organizationService *services.OrganizationService
+	authService         *services.AuthService
+	logger              *zap.Logger
+}
+
+// NewOrganizationController creates a new organization controller
+func NewOrganizationController(organizationService *services.OrganizationService, authService *services.AuthService, logger *zap.Logger) *OrganizationController {
+	return &OrganizationController{
+		organizationService: organizationService,
+		authService:         authService,
+		logger:              logger,
+	}
+}
+
+type CreateOrganizationRequest struct {
+	Name string `json:"name" binding:"required,max=255"`
+}
+
+type InviteMemberRequest struct {
+	Email string `json:"email" binding:"required,email"`
+	Role  string `json:"role" binding:"required,oneof=owner admin member"`
+}
+
+type UpdateMemberRoleRequest struct {
+	Role string `json:"role" binding:"required,oneof=owner admin member"`
+}
+
+type AcceptInvitationRequest struct {
+	Token string `json:"token" binding:"required"`
+}
+
+// CreateOrganization godoc
+// @Summary Create an organization
+// @Description Create an organization owned by the current user
+// @Tags organizations
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param request body CreateOrganizationRequest true "Organization name"
+// @Success 201 {object} utils.SuccessResponse{data=models.Organization}
+// @Failure 400 {object} utils.ErrorResponse
+// @Failure 401 {object} utils.ErrorResponse
+// @Failure 500 {object} utils.ErrorResponse
+// @Router /api/v1/organizations [post]
+func (oc *OrganizationController) CreateOrganization(c *gin.Context) {
+	var req CreateOrganizationRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.SendValidationErrorResponse(c, parseValidationErrors(err))
+		return
+	}
+
+	organization, err := oc.organizationService.CreateOrganization(c.Request.Context(), c.GetUint("user_id"), req.Name)
+	if err != nil {
+		oc.logger.Error("Failed to create organization", zap.Error(err))
+		utils.SendInternalServerErrorResponse(c, "Failed to create organization")
+		return
+	}
+
+	utils.SendCreatedResponse(c, organization, "Organization created successfully")
+}
+
+// ListOrganizations godoc
+// @Summary List organizations
+// @Description List the organizations the current user belongs to, with the user's role in each
+// @Tags organizations
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {object} utils.SuccessResponse{data=[]models.OrganizationMembership}
+// @Failure 401 {object} utils.ErrorResponse
+// @Failure 500 {object} utils.ErrorResponse
+// @Router /api/v1/organizations [get]
+func (oc *OrganizationController) ListOrganizations(c *gin.Context) {
+	memberships, err := oc.organizationService.ListOrganizations(c.Request.Context(), c.GetUint("user_id"))
+	if err != nil {
+		oc.logger.Error("Failed to list organizations", zap.Error(err))
+		utils.SendInternalServerErrorResponse(c, "Failed to list organizations")
+		return
+	}
+
+	utils.SendSuccessResponse(c, memberships, "Organizations retrieved successfully")
+}
+
+// GetOrganization godoc
+// @Summary Get an organization
+// @Description Get an organization the current user belongs to
+// @Tags organizations
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "Organization ID"
+// @Success 200 {object} utils.SuccessResponse{data=models.Organization}
+// @Failure 401 {object} utils.ErrorResponse
+// @Failure 403 {object} utils.ErrorResponse
+// @Failure 404 {object} utils.ErrorResponse
+// @Router /api/v1/organizations/{id} [get]
+func (oc *OrganizationController) GetOrganization(c *gin.Context) {
+	organization, err := oc.organizationService.GetOrganization(c.Request.Context(), c.GetUint("organization_id"))
+	if err != nil {
+		if errors.Is(err, services.ErrOrganizationNotFound) {
+			utils.SendNotFoundResponse(c, "Organization not found")
+			return
+		}
+		oc.logger.Error("Failed to get organization", zap.Error(err))
+		utils.SendInternalServerErrorResponse(c, "Failed to get organization")
+		return
+	}
+
+	utils.SendSuccessResponse(c, organization, "Organization retrieved successfully")
+}
+
+// SwitchOrganization godoc
+// @Summary Switch the active organization
+// @Description Make the organization the active one of the current session. The refresh token is rotated and the new access token carries the organization in its org_id claim, which is used when requests omit the X-Organization-ID header.
+// @Tags organizations
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "Organization ID"
+// @Param request body RefreshTokenRequest true "Refresh token of the current session"
+// @Success 200 {object} utils.SuccessResponse{data=utils.RefreshTokenResponse}
+// @Failure 400 {object} utils.ErrorResponse
+// @Failure 401 {object} utils.ErrorResponse
+// @Failure 403 {object} utils.ErrorResponse
+// @Failure 500 {object} utils.ErrorResponse
+// @Router /api/v1/organizations/{id}/switch [post]
+func (oc *OrganizationController) SwitchOrganization(c *gin.Context) {
+	var req RefreshTokenRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.SendValidationErrorResponse(c, parseValidationErrors(err))
+		return
+	}
+
+	organizationID := c.GetUint("organization_id")
+	_, accessToken, refreshToken, err := oc.authService.SwitchOrganization(c.Request.Context(), c.GetUint("user_id"), req.RefreshToken, &organizationID, sessionMetadata(c))
+	if err != nil {
+		switch {
+		case errors.Is(err, services.ErrRefreshTokenReused):
+			utils.SendUnauthorizedResponse(c, "Refresh token has already been used; session revoked")
+		case errors.Is(err, services.ErrInvalidRefreshToken):
+			utils.SendUnauthorizedResponse(c, "Invalid refresh token")
+		default:
+			oc.logger.Error("Failed to switch organization", zap.Error(err))
+			utils.SendInternalServerErrorResponse(c, "Failed to switch organization")
+		}
+		return
+	}
+
+	utils.SendSuccessResponse(c, utils.RefreshTokenResponse{
+		AccessToken:  accessToken,
+		RefreshToken: refreshToken,
+		ExpiresIn:    int(utils.AccessTokenTTL.Seconds()),
+	}, "Organization switched successfully")
+}
+
+// ListMembers godoc
+// @Summary List organization members
+// @Description List the members of an organization and their roles
+// @Tags organizations
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "Organization ID"
+// @Success 200 {object} utils.SuccessResponse{data=[]models.OrganizationMembership}
+// @Failure 401 {object} utils.ErrorResponse
+// @Failure 403 {object} utils.ErrorResponse
+// @Failure 500 {object} utils.ErrorResponse
+// @Router /api/v1/organizations/{id}/members [get]
+func (oc *OrganizationController) ListMembers(c *gin.Context) {
+	memberships, err := oc.organizationService.ListMembers(c.Request.Context(), c.GetUint("organization_id"))
+	if err != nil {
+		oc.logger.Error("Failed to list organization members", zap.Error(err))
+		utils.SendInternalServerErrorResponse(c, "Failed to list members")
+		return
+	}
+
+	utils.SendSuccessResponse(c, memberships, "Members retrieved successfully")
+}
+
+// UpdateMemberRole godoc
+// @Summary Change a member's role
+// @Description Change the role of an organization member. Requires the owner or admin role; only owners can grant or revoke the owner role.
+// @Tags organizations
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "Organization ID"
+// @Param user_id path int true "User ID"
+// @Param request body UpdateMemberRoleRequest true "New role"
+// @Success 200 {object} utils.SuccessResponse{data=models.OrganizationMembership}
+// @Failure 400 {object} utils.ErrorResponse
+// @Failure 401 {object} utils.ErrorResponse
+// @Failure 403 {object} utils.ErrorResponse
+// @Failure 404 {object} utils.ErrorResponse
+// @Failure 409 {object} utils.ErrorResponse
+// @Failure 500 {object} utils.ErrorResponse
+// @Router /api/v1/organizations/{id}/members/{user_id} [put]
+func (oc *OrganizationController) UpdateMemberRole(c *gin.Context) {
+	userID, err := strconv.ParseUint(c.Param("user_id"), 10, 32)
+	if err != nil {
+		utils.SendErrorResponse(c, http.StatusBadRequest, "Invalid user ID", nil)
+		return
+	}
+
+	var req UpdateMemberRoleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.SendValidationErrorResponse(c, parseValidationErrors(err))
+		return
+	}
+
+	organizationID := c.GetUint("organization_id")
+	if c.GetString("organization_role") != models.OrganizationRoleOwner {
+		target, err := oc.organizationService.GetMembership(c.Request.Context(), organizationID, uint(userID))
+		if err != nil {
+			oc.handleMembershipError(c, err, "Failed to update member role")
+			return
+		}
+		if req.Role == models.OrganizationRoleOwner || target.Role == models.OrganizationRoleOwner {
+			utils.SendErrorResponse(c, http.StatusForbidden, "Only owners can grant or revoke the owner role", nil)
+			return
+		}
+	}
+
+	membership, err := oc.organizationService.UpdateMemberRole(c.Request.Context(), organizationID, uint(userID), req.Role)
+	if err != nil {
+		oc.handleMembershipError(c, err, "Failed to update member role")
+		return
+	}
+
+	utils.SendSuccessResponse(c, membership, "Member role updated successfully")
+}
+
+// RemoveMember godoc
+// @Summary Remove a member
+// @Description Remove a member from an organization. Owners and admins can remove other members; any member can remove themselves to leave. Only owners can remove an owner, and the last owner can't leave.
+// @Tags organizations
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "Organization ID"
+// @Param user_id path int true "User ID"
+// @Success 200 {object} utils.SuccessResponse
+// @Failure 400 {object} utils.ErrorResponse
+// @Failure 401 {object} utils.ErrorResponse
+// @Failure 403 {object} utils.ErrorResponse
+// @Failure 404 {object} utils.ErrorResponse
+// @Failure 409 {object} utils.ErrorResponse
+// @Failure 500 {object} utils.ErrorResponse
+// @Router /api/v1/organizations/{id}/members/{user_id} [delete]
+func (oc *OrganizationController) RemoveMember(c *gin.Context) {
+	userID, err := strconv.ParseUint(c.Param("user_id"), 10, 32)
+	if err != nil {
+		utils.SendErrorResponse(c, http.StatusBadRequest, "Invalid user ID", nil)
+		return
+	}
+
+	organizationID := c.GetUint("organization_id")
+	role := c.GetString("organization_role")
+	if uint(userID) != c.GetUint("user_id") {
+		if role != models.OrganizationRoleOwner && role != models.OrganizationRoleAdmin {
+			utils.SendErrorResponse(c, http.StatusForbidden, "Insufficient organization role", nil)
+			return
+		}
+		if role != models.OrganizationRoleOwner {
+			target, err := oc.organizationService.GetMembership(c.Request.Context(), organizationID, uint(userID))
+			if err != nil {
+				oc.handleMembershipError(c, err, "Failed to remove member")
+				return
+			}
+			if target.Role == models.OrganizationRoleOwner {
+				utils.SendErrorResponse(c, http.StatusForbidden, "Only owners can remove an owner", nil)
+				return
+			}
+		}
+	}
+
+	if err := oc.organizationService.RemoveMember(c.Request.Context(), organizationID, uint(userID)); err != nil {
+		oc.handleMembershipError(c, err, "Failed to remove member")
+		return
+	}
+
+	utils.SendSuccessResponse(c, nil, "Member removed successfully")
+}
+
+// InviteMember godoc
+// @Summary Invite a member
+// @Description Email an invitation to join the organization. Requires the owner or admin role; only owners can invite owners. A previous pending invitation to the same address is replaced.
+// @Tags organizations
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "Organization ID"
+// @Param request body InviteMemberRequest true "Invitee email and role"
+// @Success 201 {object} utils.SuccessResponse{data=models.OrganizationInvitation}
+// @Failure 400 {object} utils.ErrorResponse
+// @Failure 401 {object} utils.ErrorResponse
+// @Failure 403 {object} utils.ErrorResponse
+// @Failure 409 {object} utils.ErrorResponse
+// @Failure 500 {object} utils.ErrorResponse
+// @Router /api/v1/organizations/{id}/invitations [post]
+func (oc *OrganizationController) InviteMember(c *gin.Context) {
+	var req InviteMemberRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.SendValidationErrorResponse(c, parseValidationErrors(err))
+		return
+	}
+
+	if req.Role == models.OrganizationRoleOwner && c.GetString("organization_role") != models.OrganizationRoleOwner {
+		utils.SendErrorResponse(c, http.StatusForbidden, "Only owners can invite owners", nil)
+		return
+	}
+
+	invitation, err := oc.organizationService.InviteMember(c.Request.Context(), c.GetUint("organization_id"), c.GetUint("user_id"), req.Email, req.Role)
+	if err != nil {
+		if errors.Is(err, services.ErrAlreadyOrganizationMember) {
+			utils.SendErrorResponse(c, http.StatusConflict, err.Error(), nil)
+			return
+		}
+		oc.logger.Error("Failed to invite organization member", zap.Error(err))
+		utils.SendInternalServerErrorResponse(c, "Failed to invite member")
+		return
+	}
+
+	utils.SendCreatedResponse(c, invitation, "Invitation sent successfully")
+}
+
+// ListInvitations godoc
+// @Summary List pending invitations
+// @Description List an organization's pending invitations. Requires the owner or admin role.
+// @Tags organizations
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "Organization ID"
+// @Success 200 {object} utils.SuccessResponse{data=[]models.OrganizationInvitation}
+// @Failure 401 {object} utils.ErrorResponse
+// @Failure 403 {object} utils.ErrorResponse
+// @Failure 500 {object} utils.ErrorResponse
+// @Router /api/v1/organizations/{id}/invitations [get]
+func (oc *OrganizationController) ListInvitations(c *gin.Context) {
+	invitations, err := oc.organizationService.ListInvitations(c.Request.Context(), c.GetUint("organization_id"))
+	if err != nil {
+		oc.logger.Error("Failed to list organization invitations", zap.Error(err))
+		utils.SendInternalServerErrorResponse(c, "Failed to list invitations")
+		return
+	}
+
+	utils.SendSuccessResponse(c, invitations, "Invitations retrieved successfully")
+}
+
+// RevokeInvitation godoc
+// @Summary Revoke an invitation
+// @Description Cancel a pending invitation. Requires the owner or admin role.
+// @Tags organizations
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "Organization ID"
+// @Param invitation_id path int true "Invitation ID"
+// @Success 200 {object} utils.SuccessResponse
+// @Failure 400 {object} utils.ErrorResponse
+// @Failure 401 {object} utils.ErrorResponse
+// @Failure 403 {object} utils.ErrorResponse
+// @Failure 404 {object} utils.ErrorResponse
+// @Failure 500 {object} utils.ErrorResponse
+// @Router /api/v1/organizations/{id}/invitations/{invitation_id} [delete]
+func (oc *OrganizationController) RevokeInvitation(c *gin.Context) {
+	invitationID, err := strconv.ParseUint(c.Param("invitation_id"), 10, 32)
+	if err != nil {
+		utils.SendErrorResponse(c, http.StatusBadRequest, "Invalid invitation ID", nil)
+		return
+	}
+
+	if err := oc.organizationService.RevokeInvitation(c.Request.Context(), c.GetUint("organization_id"), uint(invitationID)); err != nil {
+		if errors.Is(err, services.ErrInvalidInvitation) {
+			utils.SendNotFoundResponse(c, "Invitation not found")
+			return
+		}
+		oc.logger.Error("Failed to revoke organization invitation", zap.Error(err))
+		utils.SendInternalServerErrorResponse(c, "Failed to revoke invitation")
+		return
+	}
+
+	utils.SendSuccessResponse(c, nil, "Invitation revoked successfully")
+}
+
+// AcceptInvitation godoc
+// @Summary Accept an invitation
+// @Description Join the organization of an invitation sent to the current user's email address
+// @Tags organizations
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param request body AcceptInvitationRequest true "Invitation token from the email"
+// @Success 200 {object} utils.SuccessResponse{data=models.OrganizationMembership}
+// @Failure 400 {object} utils.ErrorResponse
+// @Failure 401 {object} utils.ErrorResponse
+// @Failure 403 {object} utils.ErrorResponse
+// @Failure 409 {object} utils.ErrorResponse
+// @Failure 500 {object} utils.ErrorResponse
+// @Router /api/v1/organizations/invitations/accept [post]
+func (oc *OrganizationController) AcceptInvitation(c *gin.Context) {
+	var req AcceptInvitationRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.SendValidationErrorResponse(c, parseValidationErrors(err))
+		return
+	}
+
+	user, err := oc.authService.GetUserByID(c.GetUint("user_id"))
+	if err != nil {
+		utils.SendUnauthorizedResponse(c, "User not found")
+		return
+	}
+
+	membership, err := oc.organizationService.AcceptInvitation(c.Request.Context(), user, req.Token)
+	if err != nil {
+		switch {
+		case errors.Is(err, services.ErrInvalidInvitation):
+			utils.SendErrorResponse(c, http.StatusBadRequest, err.Error(), nil)
+		case errors.Is(err, services.ErrInvitationEmailMismatch):
+			utils.SendErrorResponse(c, http.StatusForbidden, err.Error(), nil)
+		case errors.Is(err, services.ErrAlreadyOrganizationMember):
+			utils.SendErrorResponse(c, http.StatusConflict, err.Error(), nil)
+		default:
+			oc.logger.Error("Failed to accept organization invitation", zap.Error(err))
+			utils.SendInternalServerErrorResponse(c, "Failed to accept invitation")
+		}
+		return
+	}
+
+	utils.SendSuccessResponse(c, membership, "Invitation accepted successfully")
+}
+
+func (oc *OrganizationController) handleMembershipError(c *gin.Context, err error, message string) {
+	switch {
+	case errors.Is(err, services.ErrNotOrganizationMember):
+		utils.SendNotFoundResponse(c, "Member not found")
+	case errors.Is(err, services.ErrLastOrganizationOwner):
+		utils.SendErrorResponse(c, http.StatusConflict, err.Error(), nil)
+	case errors.Is(err, services.ErrInvalidOrganizationRole):
+		utils.SendErrorResponse(c, http.StatusBadRequest, err.Error(), nil)
+	default:
+		oc.logger.Error(message, zap.Error(err))
+		utils.SendInternalServerErrorResponse(c, message)
+	}
+}
@@ -0,0 +1,182 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+
+	"mobile-backend/models"
+	"mobile-backend/services"
+	"mobile-backend/utils"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// PasswordlessController handles sign in with magic links and emailed codes
+type PasswordlessController struct {
+	passwordlessService *services.PasswordlessService
+	authService         *services.AuthService
+	logger              *zap.Logger
+}
+
+// NewPasswordlessController creates a new passwordless controller
+func NewPasswordlessController(passwordlessService *services.PasswordlessService, authService *services.AuthService, logger *zap.Logger) *PasswordlessController {
+	return &PasswordlessController{
+		passwordlessService: passwordlessService,
+		authService:         authService,
+		logger:              logger,
+	}
+}
+
+type PasswordlessStartRequest struct {
+	Email  string `json:"email" binding:"required,email"`
+	Method string `json:"method" binding:"omitempty,oneof=link code"`
+}
+
+type PasswordlessLinkRequest struct {
+	Token string `json:"token" binding:"required"`
+}
+
+type PasswordlessCodeRequest struct {
+	Email string `json:"email" binding:"required,email"`
+	Code  string `json:"code" binding:"required"`
+}
+
+// Start godoc
+// @Summary Start passwordless sign in
+// @Description Email a single-use sign-in link (method "link", the default) or a 6-digit code (method "code"). The response is the same whether or not the account exists.
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Param request body PasswordlessStartRequest true "Email address and method"
+// @Success 200 {object} utils.SuccessResponse
+// @Failure 400 {object} utils.ErrorResponse
+// @Failure 429 {object} utils.ErrorResponse
+// @Failure 500 {object} utils.ErrorResponse
+// @Router /api/v1/auth/passwordless/start [post]
+func (pc *PasswordlessController) Start(c *gin.Context) {
+	var req PasswordlessStartRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.SendValidationErrorResponse(c, parseValidationErrors(err))
+		return
+	}
+	if req.Method == "" {
+		req.Method = services.PasswordlessMethodLink
+	}
+
+	if err := pc.passwordlessService.Start(c.Request.Context(), req.Email, req.Method, c.ClientIP()); err != nil {
+		if errors.Is(err, services.ErrPasswordlessRateLimited) {
+			utils.SendErrorResponse(c, http.StatusTooManyRequests, "Too many sign-in requests, please try again later", nil)
+			return
+		}
+		pc.logger.Error("Failed to start passwordless sign in", zap.Error(err))
+		utils.SendInternalServerErrorResponse(c, "Failed to send sign-in email")
+		return
+	}
+
+	utils.SendSuccessResponse(c, nil, "If the address can sign in, an email is on its way")
+}
+
+// VerifyLink godoc
+// @Summary Complete magic link sign in
+// @Description Exchange the token from a magic link for an access/refresh token pair
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Param request body PasswordlessLinkRequest true "Magic link token"
+// @Success 200 {object} utils.SuccessResponse{data=utils.LoginResponse} "Token pair, or utils.MFAChallengeResponse when two-factor authentication is enabled"
+// @Failure 400 {object} utils.ErrorResponse
+// @Failure 401 {object} utils.ErrorResponse
+// @Failure 500 {object} utils.ErrorResponse
+// @Router /api/v1/auth/passwordless/verify-link [post]
+func (pc *PasswordlessController) VerifyLink(c *gin.Context) {
+	var req PasswordlessLinkRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.SendValidationErrorResponse(c, parseValidationErrors(err))
+		return
+	}
+
+	user, err := pc.passwordlessService.VerifyLink(c.Request.Context(), req.Token)
+	pc.completeLogin(c, user, err)
+}
+
+// VerifyCode godoc
+// @Summary Complete email code sign in
+// @Description Exchange the emailed 6-digit code for an access/refresh token pair. The code is discarded after too many wrong attempts, and wrong codes count as failed logins; a locked or throttled account gets 429 with a Retry-After header.
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Param request body PasswordlessCodeRequest true "Email address and code"
+// @Success 200 {object} utils.SuccessResponse{data=utils.LoginResponse} "Token pair, or utils.MFAChallengeResponse when two-factor authentication is enabled"
+// @Failure 400 {object} utils.ErrorResponse
+// @Failure 401 {object} utils.ErrorResponse
+// @Failure 429 {object} utils.ErrorResponse
+// @Failure 500 {object} utils.ErrorResponse
+// @Router /api/v1/auth/passwordless/verify-code [post]
+func (pc *PasswordlessController) VerifyCode(c *gin.Context) {
+	var req PasswordlessCodeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.SendValidationErrorResponse(c, parseValidationErrors(err))
+		return
+	}
+
+	user, err := pc.passwordlessService.VerifyCode(c.Request.Context(), req.Email, req.Code, c.ClientIP())
+	pc.completeLogin(c, user, err)
+}
+
+// completeLogin issues a token pair for a verified passwordless sign in, or an MFA
+// challenge when the user has two-factor authentication enabled
+func (pc *PasswordlessController) completeLogin(c *gin.Context, user *models.User, err error) {
+	if err != nil {
+		if sendLoginRetryError(c, err) {
+			return
+		}
+		if errors.Is(err, services.ErrInvalidPasswordlessCode) {
+			utils.SendUnauthorizedResponse(c, "Invalid or expired sign-in code")
+			return
+		}
+		pc.logger.Error("Failed to verify passwordless sign in", zap.Error(err))
+		utils.SendInternalServerErrorResponse(c, "Failed to sign in")
+		return
+	}
+
+	mfaToken, err := pc.authService.LoginExternalUser(c.Request.Context(), user, c.ClientIP())
+	if err != nil {
+		if errors.Is(err, services.ErrMFARequired) {
+			utils.SendSuccessResponse(c, utils.MFAChallengeResponse{
+				MFARequired: true,
+				MFAToken:    mfaToken,
+				ExpiresIn:   int(utils.MFAChallengeTTL.Seconds()),
+			}, "Two-factor authentication required")
+			return
+		}
+		if sendLoginRetryError(c, err) || sendPasswordResetRequired(c, err) {
+			return
+		}
+		utils.SendUnauthorizedResponse(c, "Login not allowed")
+		return
+	}
+
+	accessToken, refreshToken, err := pc.authService.GenerateTokens(c.Request.Context(), user, sessionMetadata(c))
+	if err != nil {
+		utils.SendInternalServerErrorResponse(c, "Failed to generate tokens")
+		return
+	}
+
+	loginResponse := utils.LoginResponse{
+		User: utils.UserResponse{
+			ID:              user.ID,
+			Email:           user.Email,
+			Name:            user.Name,
+			IsActive:        user.IsActive,
+			EmailVerifiedAt: user.EmailVerifiedAt,
+			CreatedAt:       user.CreatedAt,
+			UpdatedAt:       user.UpdatedAt,
+		},
+		AccessToken:  accessToken,
+		RefreshToken: refreshToken,
+		ExpiresIn:    int(utils.AccessTokenTTL.Seconds()),
+	}
+
+	utils.SendSuccessResponse(c, loginResponse, "Login successful")
+}
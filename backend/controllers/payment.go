@@ -13,17 +13,40 @@ import (
 )
 
 type PaymentController struct {
-	stripeService *services.StripeService
-	polarService  *services.PolarService
-	db            *gorm.DB
+	providers    *services.PaymentProviderRegistry
+	db           *gorm.DB
+	auditService *services.AuditService
 }
 
-func NewPaymentController(stripeService *services.StripeService, polarService *services.PolarService, db *gorm.DB) *PaymentController {
+func NewPaymentController(providers *services.PaymentProviderRegistry, db *gorm.DB, auditService *services.AuditService) *PaymentController {
+	// Products are the global billing catalog, shared by every organization
+	db = models.AcrossTenants(db)
+
 	return &PaymentController{
-		stripeService: stripeService,
-		polarService:  polarService,
-		db:            db,
+		providers:    providers,
+		db:           db,
+		auditService: auditService,
+	}
+}
+
+// provider looks up a payment provider by name and responds with 400 when it isn't registered
+func (pc *PaymentController) provider(c *gin.Context, name string) (services.PaymentProvider, bool) {
+	provider, err := pc.providers.Get(name)
+	if err != nil {
+		utils.SendErrorResponse(c, http.StatusBadRequest, "Invalid payment method", map[string]interface{}{"supported": pc.providers.Names()})
+		return nil, false
+	}
+	return provider, true
+}
+
+// catalogProvider returns the provider products and plans are created with
+func (pc *PaymentController) catalogProvider(c *gin.Context) (services.PaymentProvider, bool) {
+	provider, err := pc.providers.Default()
+	if err != nil {
+		utils.SendErrorResponse(c, http.StatusServiceUnavailable, "No payment provider is configured", nil)
+		return nil, false
 	}
+	return provider, true
 }
 
 // Product Management
@@ -59,8 +82,12 @@ func (pc *PaymentController) CreateProduct(c *gin.Context) {
 		return
 	}
 
-	// Create product using Stripe service
-	createdProduct, err := pc.stripeService.CreateProduct(c.Request.Context(), &product)
+	provider, ok := pc.catalogProvider(c)
+	if !ok {
+		return
+	}
+
+	createdProduct, err := provider.CreateProduct(c.Request.Context(), &product)
 	if err != nil {
 		utils.SendErrorResponse(c, http.StatusInternalServerError, "Failed to create product", map[string]interface{}{"error": err.Error()})
 		return
@@ -173,7 +200,12 @@ func (pc *PaymentController) UpdateProduct(c *gin.Context) {
 		return
 	}
 
-	updatedProduct, err := pc.stripeService.UpdateProduct(c.Request.Context(), uint(id), &updates)
+	provider, ok := pc.catalogProvider(c)
+	if !ok {
+		return
+	}
+
+	updatedProduct, err := provider.UpdateProduct(c.Request.Context(), uint(id), &updates)
 	if err != nil {
 		utils.SendErrorResponse(c, http.StatusInternalServerError, "Failed to update product", map[string]interface{}{"error": err.Error()})
 		return
@@ -225,8 +257,12 @@ func (pc *PaymentController) CreatePlan(c *gin.Context) {
 		return
 	}
 
-	// Create plan using Stripe service
-	createdPlan, err := pc.stripeService.CreatePrice(c.Request.Context(), &plan)
+	provider, ok := pc.catalogProvider(c)
+	if !ok {
+		return
+	}
+
+	createdPlan, err := provider.CreatePrice(c.Request.Context(), &plan)
 	if err != nil {
 		utils.SendErrorResponse(c, http.StatusInternalServerError, "Failed to create plan", map[string]interface{}{"error": err.Error()})
 		return
@@ -314,24 +350,27 @@ func (pc *PaymentController) CreatePayment(c *gin.Context) {
 		return
 	}
 
-	var payment *models.Payment
-	var err error
-
-	switch req.PaymentMethod {
-	case "stripe":
-		payment, err = pc.stripeService.CreatePaymentIntent(c.Request.Context(), userID.(uint), req.ProductID, req.Amount, req.Currency)
-	case "polar":
-		payment, err = pc.polarService.CreatePayment(c.Request.Context(), userID.(uint), req.ProductID, req.Amount, req.Currency)
-	default:
-		utils.SendErrorResponse(c, http.StatusBadRequest, "Invalid payment method", nil)
+	provider, ok := pc.provider(c, req.PaymentMethod)
+	if !ok {
 		return
 	}
 
+	payment, err := provider.CreatePayment(c.Request.Context(), userID.(uint), req.ProductID, req.Amount, req.Currency)
 	if err != nil {
 		utils.SendErrorResponse(c, http.StatusInternalServerError, "Failed to create payment", map[string]interface{}{"error": err.Error()})
 		return
 	}
 
+	event := newAuditEvent(c, models.AuditActionPaymentCreated, "payment", auditID(payment.ID))
+	event.After = models.JSONMap{
+		"product_id":     payment.ProductID,
+		"amount":         payment.Amount,
+		"currency":       payment.Currency,
+		"status":         payment.Status,
+		"payment_method": payment.PaymentMethod,
+	}
+	pc.auditService.Record(c.Request.Context(), event)
+
 	utils.SendSuccessResponse(c, payment, "Payment created successfully")
 }
 
@@ -362,12 +401,24 @@ func (pc *PaymentController) CreateCheckoutSession(c *gin.Context) {
 		return
 	}
 
-	session, err := pc.stripeService.CreateCheckoutSession(c.Request.Context(), userID.(uint), req.ProductID, req.SuccessURL, req.CancelURL)
+	// Hosted checkout is a Stripe feature outside the PaymentProvider interface
+	provider, _ := pc.providers.Get("stripe")
+	stripeService, ok := provider.(*services.StripeService)
+	if !ok {
+		utils.SendErrorResponse(c, http.StatusServiceUnavailable, "Checkout is not available", nil)
+		return
+	}
+
+	session, err := stripeService.CreateCheckoutSession(c.Request.Context(), userID.(uint), req.ProductID, req.SuccessURL, req.CancelURL)
 	if err != nil {
 		utils.SendErrorResponse(c, http.StatusInternalServerError, "Failed to create checkout session", map[string]interface{}{"error": err.Error()})
 		return
 	}
 
+	event := newAuditEvent(c, models.AuditActionCheckoutCreated, "checkout_session", session.ID)
+	event.Metadata["product_id"] = req.ProductID
+	pc.auditService.Record(c.Request.Context(), event)
+
 	response := map[string]interface{}{
 		"session_id": session.ID,
 		"url":        session.URL,
@@ -396,8 +447,11 @@ func (pc *PaymentController) GetPayments(c *gin.Context) {
 		return
 	}
 
-	payments, err := pc.stripeService.GetUserPayments(c.Request.Context(), userID.(uint))
-	if err != nil {
+	var payments []models.Payment
+	if err := pc.db.Preload("Product").Preload("Subscription").
+		Where("user_id = ?", userID).
+		Order("created_at DESC").
+		Find(&payments).Error; err != nil {
 		utils.SendErrorResponse(c, http.StatusInternalServerError, "Failed to get payments", map[string]interface{}{"error": err.Error()})
 		return
 	}
@@ -434,24 +488,19 @@ func (pc *PaymentController) CreateSubscription(c *gin.Context) {
 		return
 	}
 
-	var subscription *models.Subscription
-	var err error
-
-	switch req.PaymentMethod {
-	case "stripe":
-		subscription, err = pc.stripeService.CreateSubscription(c.Request.Context(), userID.(uint), req.PlanID, req.PaymentMethodID)
-	case "polar":
-		subscription, err = pc.polarService.CreateSubscription(c.Request.Context(), userID.(uint), req.PlanID)
-	default:
-		utils.SendErrorResponse(c, http.StatusBadRequest, "Invalid payment method", nil)
+	provider, ok := pc.provider(c, req.PaymentMethod)
+	if !ok {
 		return
 	}
 
+	subscription, err := provider.CreateSubscription(c.Request.Context(), userID.(uint), req.PlanID, req.PaymentMethodID)
 	if err != nil {
 		utils.SendErrorResponse(c, http.StatusInternalServerError, "Failed to create subscription", map[string]interface{}{"error": err.Error()})
 		return
 	}
 
+	recordSubscriptionCreated(c, pc.auditService, subscription)
+
 	utils.SendSuccessResponse(c, subscription, "Subscription created successfully")
 }
 
@@ -473,8 +522,10 @@ func (pc *PaymentController) GetSubscriptions(c *gin.Context) {
 		return
 	}
 
-	subscriptions, err := pc.stripeService.GetUserSubscriptions(c.Request.Context(), userID.(uint))
-	if err != nil {
+	var subscriptions []models.Subscription
+	if err := pc.db.Preload("Product").Preload("Plan").
+		Where("user_id = ?", userID).
+		Find(&subscriptions).Error; err != nil {
 		utils.SendErrorResponse(c, http.StatusInternalServerError, "Failed to get subscriptions", map[string]interface{}{"error": err.Error()})
 		return
 	}
@@ -495,6 +546,7 @@ func (pc *PaymentController) GetSubscriptions(c *gin.Context) {
 // @Failure 400 {object} utils.ErrorResponse
 // @Failure 401 {object} utils.ErrorResponse
 // @Failure 404 {object} utils.ErrorResponse
+// @Failure 409 {object} utils.ErrorResponse
 // @Failure 500 {object} utils.ErrorResponse
 // @Router /api/v1/subscriptions/{id}/cancel [post]
 func (pc *PaymentController) CancelSubscription(c *gin.Context) {
@@ -524,74 +576,50 @@ func (pc *PaymentController) CancelSubscription(c *gin.Context) {
 		return
 	}
 
-	// Cancel subscription based on payment method
-	switch subscription.PaymentMethod {
-	case "stripe":
-		err = pc.stripeService.CancelSubscription(c.Request.Context(), uint(id), req.Immediately)
-	case "polar":
-		err = pc.polarService.CancelSubscription(c.Request.Context(), uint(id), req.Immediately)
-	default:
-		utils.SendErrorResponse(c, http.StatusBadRequest, "Invalid payment method", nil)
+	if services.IsStorePaymentMethod(subscription.PaymentMethod) {
+		utils.SendErrorResponse(c, http.StatusConflict, "Store subscriptions must be canceled in the App Store or Google Play", nil)
 		return
 	}
 
-	if err != nil {
+	provider, ok := pc.provider(c, subscription.PaymentMethod)
+	if !ok {
+		return
+	}
+
+	if err := provider.CancelSubscription(c.Request.Context(), uint(id), req.Immediately); err != nil {
 		utils.SendErrorResponse(c, http.StatusInternalServerError, "Failed to cancel subscription", map[string]interface{}{"error": err.Error()})
 		return
 	}
 
+	recordSubscriptionCancelled(c, pc.auditService, pc.db, &subscription, req.Immediately)
+
 	utils.SendSuccessResponse(c, nil, "Subscription canceled successfully")
 }
 
 // Webhook Handlers
 
-// StripeWebhook godoc
-// @Summary Handle Stripe webhook
-// @Description Process Stripe webhook events
+// ProviderWebhook godoc
+// @Summary Handle a payment provider webhook
+// @Description Process webhook events from a registered payment provider, e.g. stripe or polar. The signature is read from the provider's own header, such as Stripe-Signature or X-Polar-Signature.
 // @Tags webhooks
 // @Accept application/json
 // @Produce json
-// @Param X-Stripe-Signature header string true "Stripe signature"
+// @Param provider path string true "Provider name"
 // @Success 200 {object} utils.SuccessResponse
 // @Failure 400 {object} utils.ErrorResponse
+// @Failure 404 {object} utils.ErrorResponse
 // @Failure 500 {object} utils.ErrorResponse
-// @Router /api/v1/webhooks/stripe [post]
-func (pc *PaymentController) StripeWebhook(c *gin.Context) {
-	signature := c.GetHeader("Stripe-Signature")
-	if signature == "" {
-		utils.SendErrorResponse(c, http.StatusBadRequest, "Missing Stripe signature", nil)
-		return
-	}
-
-	body, err := c.GetRawData()
+// @Router /api/v1/webhooks/{provider} [post]
+func (pc *PaymentController) ProviderWebhook(c *gin.Context) {
+	provider, err := pc.providers.Get(c.Param("provider"))
 	if err != nil {
-		utils.SendErrorResponse(c, http.StatusBadRequest, "Failed to read request body", map[string]interface{}{"error": err.Error()})
-		return
-	}
-
-	if err := pc.stripeService.HandleWebhook(c.Request.Context(), body, signature); err != nil {
-		utils.SendErrorResponse(c, http.StatusInternalServerError, "Failed to process webhook", map[string]interface{}{"error": err.Error()})
+		utils.SendNotFoundResponse(c, "Unknown payment provider")
 		return
 	}
 
-	utils.SendSuccessResponse(c, nil, "Webhook processed successfully")
-}
-
-// PolarWebhook godoc
-// @Summary Handle Polar webhook
-// @Description Process Polar webhook events
-// @Tags webhooks
-// @Accept application/json
-// @Produce json
-// @Param X-Polar-Signature header string true "Polar signature"
-// @Success 200 {object} utils.SuccessResponse
-// @Failure 400 {object} utils.ErrorResponse
-// @Failure 500 {object} utils.ErrorResponse
-// @Router /api/v1/webhooks/polar [post]
-func (pc *PaymentController) PolarWebhook(c *gin.Context) {
-	signature := c.GetHeader("X-Polar-Signature")
+	signature := c.GetHeader(provider.WebhookSignatureHeader())
 	if signature == "" {
-		utils.SendErrorResponse(c, http.StatusBadRequest, "Missing Polar signature", nil)
+		utils.SendErrorResponse(c, http.StatusBadRequest, "Missing webhook signature", map[string]interface{}{"header": provider.WebhookSignatureHeader()})
 		return
 	}
 
@@ -601,7 +629,7 @@ func (pc *PaymentController) PolarWebhook(c *gin.Context) {
 		return
 	}
 
-	if err := pc.polarService.HandleWebhook(c.Request.Context(), body, signature); err != nil {
+	if err := provider.HandleWebhook(c.Request.Context(), body, signature); err != nil {
 		utils.SendErrorResponse(c, http.StatusInternalServerError, "Failed to process webhook", map[string]interface{}{"error": err.Error()})
 		return
 	}
@@ -615,7 +643,7 @@ type CreatePaymentRequest struct {
 	ProductID     uint   `json:"product_id" binding:"required"`
 	Amount        int64  `json:"amount" binding:"required,min=1"`
 	Currency      string `json:"currency" binding:"required,len=3"`
-	PaymentMethod string `json:"payment_method" binding:"required,oneof=stripe polar"`
+	PaymentMethod string `json:"payment_method" binding:"required"` // Registered provider name, e.g. stripe or polar
 }
 
 type CreateCheckoutRequest struct {
@@ -626,10 +654,18 @@ type CreateCheckoutRequest struct {
 
 type CreateSubscriptionRequest struct {
 	PlanID          uint   `json:"plan_id" binding:"required"`
-	PaymentMethod   string `json:"payment_method" binding:"required,oneof=stripe polar"`
+	PaymentMethod   string `json:"payment_method" binding:"required"` // Registered provider name, e.g. stripe or polar
 	PaymentMethodID string `json:"payment_method_id,omitempty"`
 }
 
 type CancelSubscriptionRequest struct {
 	Immediately bool `json:"immediately"`
 }
+
+// ChangePlanRequest asks to change the plan or seat count of the current subscription.
+// ProrationDate is the proration_date of a preview, to be charged what it showed.
+type ChangePlanRequest struct {
+	PlanID        uint  `json:"plan_id,omitempty"`
+	Quantity      int   `json:"quantity,omitempty" binding:"omitempty,min=1"`
+	ProrationDate int64 `json:"proration_date,omitempty"`
+}
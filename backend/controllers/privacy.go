@@ -0,0 +1,224 @@
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"mobile-backend/models"
+	"mobile-backend/services"
+	"mobile-backend/utils"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// PrivacyController lets users export their personal data and delete their account
+type PrivacyController struct {
+	privacyService *services.PrivacyService
+	auditService   *services.AuditService
+	logger         *zap.Logger
+}
+
+// NewPrivacyController creates a new privacy controller
+func NewPrivacyController(privacyService *services.PrivacyService, auditService *services.AuditService, logger *zap.Logger) *PrivacyController {
+	return &PrivacyController{
+		privacyService: privacyService,
+		auditService:   auditService,
+		logger:         logger,
+	}
+}
+
+// RequestExport godoc
+// @Summary Request a data export
+// @Description Start building a ZIP archive of all data stored about the current user. The user is emailed when it is ready. A request that is still in progress is returned instead of starting another.
+// @Tags privacy
+// @Produce json
+// @Security BearerAuth
+// @Success 202 {object} utils.SuccessResponse{data=models.DataRequest}
+// @Failure 401 {object} utils.ErrorResponse
+// @Failure 500 {object} utils.ErrorResponse
+// @Router /api/v1/privacy/exports [post]
+func (pc *PrivacyController) RequestExport(c *gin.Context) {
+	request, err := pc.privacyService.RequestExport(c.Request.Context(), c.GetUint("user_id"))
+	if err != nil {
+		pc.logger.Error("Failed to request data export", zap.Error(err))
+		utils.SendInternalServerErrorResponse(c, "Failed to request data export")
+		return
+	}
+
+	event := newAuditEvent(c, models.AuditActionDataExportRequested, "data_request", auditID(request.ID))
+	pc.auditService.Record(c.Request.Context(), event)
+
+	utils.SendAcceptedResponse(c, request, "Data export requested")
+}
+
+// DownloadExport godoc
+// @Summary Download a data export
+// @Description Download a finished data export archive before it expires
+// @Tags privacy
+// @Produce application/zip
+// @Security BearerAuth
+// @Param id path int true "Data request ID"
+// @Success 200 {file} file
+// @Failure 400 {object} utils.ErrorResponse
+// @Failure 401 {object} utils.ErrorResponse
+// @Failure 404 {object} utils.ErrorResponse
+// @Failure 410 {object} utils.ErrorResponse
+// @Router /api/v1/privacy/exports/{id}/download [get]
+func (pc *PrivacyController) DownloadExport(c *gin.Context) {
+	requestID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		utils.SendErrorResponse(c, http.StatusBadRequest, "Invalid request ID", nil)
+		return
+	}
+
+	request, err := pc.privacyService.GetExport(c.Request.Context(), c.GetUint("user_id"), uint(requestID))
+	if err != nil {
+		switch {
+		case errors.Is(err, services.ErrDataRequestNotFound):
+			utils.SendNotFoundResponse(c, "Data request not found")
+		case errors.Is(err, services.ErrDataExportUnavailable):
+			utils.SendErrorResponse(c, http.StatusGone, "Data export is not ready or has expired", nil)
+		default:
+			pc.logger.Error("Failed to load data export", zap.Error(err))
+			utils.SendInternalServerErrorResponse(c, "Failed to load data export")
+		}
+		return
+	}
+
+	c.FileAttachment(request.FilePath, fmt.Sprintf("data-export-%s.zip", request.CompletedAt.UTC().Format("20060102")))
+}
+
+// RequestErasure godoc
+// @Summary Delete account
+// @Description Schedule the permanent deletion of the current user's account and personal data after a grace period, during which the request can be cancelled
+// @Tags privacy
+// @Produce json
+// @Security BearerAuth
+// @Success 202 {object} utils.SuccessResponse{data=models.DataRequest}
+// @Failure 401 {object} utils.ErrorResponse
+// @Failure 409 {object} utils.ErrorResponse
+// @Failure 500 {object} utils.ErrorResponse
+// @Router /api/v1/privacy/erasure [post]
+func (pc *PrivacyController) RequestErasure(c *gin.Context) {
+	requestErasure(c, pc.privacyService, pc.auditService)
+}
+
+// ListRequests godoc
+// @Summary List data requests
+// @Description List the current user's data export and account deletion requests with their status
+// @Tags privacy
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {object} utils.SuccessResponse{data=[]models.DataRequest}
+// @Failure 401 {object} utils.ErrorResponse
+// @Failure 500 {object} utils.ErrorResponse
+// @Router /api/v1/privacy/requests [get]
+func (pc *PrivacyController) ListRequests(c *gin.Context) {
+	requests, err := pc.privacyService.ListRequests(c.Request.Context(), c.GetUint("user_id"))
+	if err != nil {
+		pc.logger.Error("Failed to list data requests", zap.Error(err))
+		utils.SendInternalServerErrorResponse(c, "Failed to list data requests")
+		return
+	}
+
+	utils.SendSuccessResponse(c, requests, "Data requests retrieved successfully")
+}
+
+// GetRequest godoc
+// @Summary Get a data request
+// @Description Get the status of one of the current user's data requests
+// @Tags privacy
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "Data request ID"
+// @Success 200 {object} utils.SuccessResponse{data=models.DataRequest}
+// @Failure 400 {object} utils.ErrorResponse
+// @Failure 401 {object} utils.ErrorResponse
+// @Failure 404 {object} utils.ErrorResponse
+// @Router /api/v1/privacy/requests/{id} [get]
+func (pc *PrivacyController) GetRequest(c *gin.Context) {
+	requestID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		utils.SendErrorResponse(c, http.StatusBadRequest, "Invalid request ID", nil)
+		return
+	}
+
+	request, err := pc.privacyService.GetRequest(c.Request.Context(), c.GetUint("user_id"), uint(requestID))
+	if err != nil {
+		if errors.Is(err, services.ErrDataRequestNotFound) {
+			utils.SendNotFoundResponse(c, "Data request not found")
+			return
+		}
+		pc.logger.Error("Failed to load data request", zap.Error(err))
+		utils.SendInternalServerErrorResponse(c, "Failed to load data request")
+		return
+	}
+
+	utils.SendSuccessResponse(c, request, "Data request retrieved successfully")
+}
+
+// CancelRequest godoc
+// @Summary Cancel a data request
+// @Description Cancel a data request that has not started yet, such as an account deletion still in its grace period
+// @Tags privacy
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "Data request ID"
+// @Success 200 {object} utils.SuccessResponse{data=models.DataRequest}
+// @Failure 400 {object} utils.ErrorResponse
+// @Failure 401 {object} utils.ErrorResponse
+// @Failure 404 {object} utils.ErrorResponse
+// @Failure 409 {object} utils.ErrorResponse
+// @Router /api/v1/privacy/requests/{id}/cancel [post]
+func (pc *PrivacyController) CancelRequest(c *gin.Context) {
+	requestID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		utils.SendErrorResponse(c, http.StatusBadRequest, "Invalid request ID", nil)
+		return
+	}
+
+	request, err := pc.privacyService.CancelRequest(c.Request.Context(), c.GetUint("user_id"), uint(requestID))
+	if err != nil {
+		switch {
+		case errors.Is(err, services.ErrDataRequestNotFound):
+			utils.SendNotFoundResponse(c, "Data request not found")
+		case errors.Is(err, services.ErrDataRequestNotCancellable):
+			utils.SendErrorResponse(c, http.StatusConflict, err.Error(), nil)
+		default:
+			pc.logger.Error("Failed to cancel data request", zap.Error(err))
+			utils.SendInternalServerErrorResponse(c, "Failed to cancel data request")
+		}
+		return
+	}
+
+	if request.Type == models.DataRequestErasure {
+		event := newAuditEvent(c, models.AuditActionErasureCancelled, "data_request", auditID(request.ID))
+		pc.auditService.Record(c.Request.Context(), event)
+	}
+
+	utils.SendSuccessResponse(c, request, "Data request cancelled")
+}
+
+// requestErasure schedules the current user's account for deletion. It is shared by the
+// privacy endpoint and DELETE /profile.
+func requestErasure(c *gin.Context, privacyService *services.PrivacyService, auditService *services.AuditService) {
+	request, err := privacyService.RequestErasure(c.Request.Context(), c.GetUint("user_id"))
+	if err != nil {
+		if errors.Is(err, services.ErrErasureAlreadyScheduled) || errors.Is(err, services.ErrErasureBlocked) {
+			utils.SendErrorResponse(c, http.StatusConflict, err.Error(), nil)
+			return
+		}
+		utils.SendInternalServerErrorResponse(c, "Failed to schedule account deletion")
+		return
+	}
+
+	event := newAuditEvent(c, models.AuditActionErasureRequested, "user", auditID(request.UserID))
+	event.Metadata["data_request_id"] = request.ID
+	event.Metadata["scheduled_for"] = request.ScheduledFor
+	auditService.Record(c.Request.Context(), event)
+
+	utils.SendAcceptedResponse(c, request, "Account deletion scheduled")
+}
@@ -31,7 +31,7 @@ func NewProductController(db *gorm.DB) *ProductController {
 func (c *ProductController) GetProductList(ctx *gin.Context) {
 	var products []models.Product
 
-	if err := c.db.Find(&products).Error; err != nil {
+	if err := c.db.WithContext(ctx.Request.Context()).Find(&products).Error; err != nil {
 		utils.SendErrorResponse(ctx, http.StatusInternalServerError, "Failed to fetch products", nil)
 		return
 	}
@@ -59,7 +59,7 @@ func (c *ProductController) GetProduct(ctx *gin.Context) {
 	}
 
 	var product models.Product
-	if err := c.db.First(&product, uint(id)).Error; err != nil {
+	if err := c.db.WithContext(ctx.Request.Context()).First(&product, uint(id)).Error; err != nil {
 		if err == gorm.ErrRecordNotFound {
 			utils.SendNotFoundResponse(ctx, "Product not found")
 			return
@@ -91,7 +91,7 @@ func (c *ProductController) CreateProduct(ctx *gin.Context) {
 		return
 	}
 
-	if err := c.db.Create(&product).Error; err != nil {
+	if err := c.db.WithContext(ctx.Request.Context()).Create(&product).Error; err != nil {
 		utils.SendErrorResponse(ctx, http.StatusInternalServerError, "Failed to create product", nil)
 		return
 	}
@@ -121,7 +121,7 @@ func (c *ProductController) UpdateProduct(ctx *gin.Context) {
 	}
 
 	var product models.Product
-	if err := c.db.First(&product, uint(id)).Error; err != nil {
+	if err := c.db.WithContext(ctx.Request.Context()).First(&product, uint(id)).Error; err != nil {
 		if err == gorm.ErrRecordNotFound {
 			utils.SendNotFoundResponse(ctx, "Product not found")
 			return
@@ -135,7 +135,10 @@ func (c *ProductController) UpdateProduct(ctx *gin.Context) {
 		return
 	}
 
-	if err := c.db.Save(&product).Error; err != nil {
+	// The path decides which record is updated, not the body
+	product.ID = uint(id)
+
+	if err := c.db.WithContext(ctx.Request.Context()).Save(&product).Error; err != nil {
 		utils.SendErrorResponse(ctx, http.StatusInternalServerError, "Failed to update product", nil)
 		return
 	}
@@ -157,7 +160,7 @@ func (c *ProductController) DeleteProduct(ctx *gin.Context) {
 		return
 	}
 
-	if err := c.db.Delete(&models.Product{}, uint(id)).Error; err != nil {
+	if err := c.db.WithContext(ctx.Request.Context()).Delete(&models.Product{}, uint(id)).Error; err != nil {
 		utils.SendErrorResponse(ctx, http.StatusInternalServerError, "Failed to delete product", nil)
 		return
 	}
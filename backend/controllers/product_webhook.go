@@ -10,54 +10,30 @@ import (
 )
 
 type ProductWebhookController struct {
-	stripeService      *services.StripeService
-	polarService       *services.PolarService
+	providers          *services.PaymentProviderRegistry
 	productSyncService *services.ProductSyncService
 }
 
 func NewProductWebhookController(
-	stripeService *services.StripeService,
-	polarService *services.PolarService,
+	providers *services.PaymentProviderRegistry,
 	productSyncService *services.ProductSyncService,
 ) *ProductWebhookController {
 	return &ProductWebhookController{
-		stripeService:      stripeService,
-		polarService:       polarService,
+		providers:          providers,
 		productSyncService: productSyncService,
 	}
 }
 
-// HandleStripeWebhook handles Stripe product webhooks
-func (pwc *ProductWebhookController) HandleStripeWebhook(c *gin.Context) {
+// HandleProviderWebhook handles product webhooks from a registered payment provider
+func (pwc *ProductWebhookController) HandleProviderWebhook(c *gin.Context) {
 	ctx := c.Request.Context()
 
-	// Read the raw body
-	body, err := c.GetRawData()
+	provider, err := pwc.providers.Get(c.Param("provider"))
 	if err != nil {
-		utils.SendErrorResponse(c, http.StatusBadRequest, "Failed to read request body", map[string]interface{}{"error": err.Error()})
-		return
-	}
-
-	// Get the signature header
-	signature := c.GetHeader("Stripe-Signature")
-	if signature == "" {
-		utils.SendErrorResponse(c, http.StatusBadRequest, "Missing Stripe signature", map[string]interface{}{"error": "Stripe-Signature header is required"})
-		return
-	}
-
-	// Process the webhook
-	if err := pwc.stripeService.HandleWebhook(ctx, body, signature); err != nil {
-		utils.SendErrorResponse(c, http.StatusBadRequest, "Webhook processing failed", map[string]interface{}{"error": err.Error()})
+		utils.SendNotFoundResponse(c, "Unknown payment provider")
 		return
 	}
 
-	utils.SendSuccessResponse(c, nil, "Webhook processed successfully")
-}
-
-// HandlePolarWebhook handles Polar product webhooks
-func (pwc *ProductWebhookController) HandlePolarWebhook(c *gin.Context) {
-	ctx := c.Request.Context()
-
 	// Read the raw body
 	body, err := c.GetRawData()
 	if err != nil {
@@ -66,14 +42,15 @@ func (pwc *ProductWebhookController) HandlePolarWebhook(c *gin.Context) {
 	}
 
 	// Get the signature header
-	signature := c.GetHeader("X-Polar-Signature")
+	header := provider.WebhookSignatureHeader()
+	signature := c.GetHeader(header)
 	if signature == "" {
-		utils.SendErrorResponse(c, http.StatusBadRequest, "Missing Polar signature", map[string]interface{}{"error": "X-Polar-Signature header is required"})
+		utils.SendErrorResponse(c, http.StatusBadRequest, "Missing webhook signature", map[string]interface{}{"error": header + " header is required"})
 		return
 	}
 
 	// Process the webhook
-	if err := pwc.polarService.HandleWebhook(ctx, body, signature); err != nil {
+	if err := provider.HandleWebhook(ctx, body, signature); err != nil {
 		utils.SendErrorResponse(c, http.StatusBadRequest, "Webhook processing failed", map[string]interface{}{"error": err.Error()})
 		return
 	}
@@ -280,7 +280,7 @@ func (pnc *PushNotificationController) CreateSegment(c *gin.Context) {
 // GetSegments returns notification segments
 func (pnc *PushNotificationController) GetSegments(c *gin.Context) {
 	var segments []models.NotificationSegment
-	if err := pnc.pushService.GetDB().Where("is_active = ?", true).Find(&segments).Error; err != nil {
+	if err := pnc.pushService.GetDB().WithContext(c.Request.Context()).Where("is_active = ?", true).Find(&segments).Error; err != nil {
 		pnc.logger.Error("Failed to get segments", zap.Error(err))
 		utils.SendErrorResponse(c, http.StatusInternalServerError, "Failed to get segments", nil)
 		return
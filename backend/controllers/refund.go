@@ -0,0 +1,173 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"mobile-backend/models"
+	"mobile-backend/services"
+	"mobile-backend/utils"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// RefundController handles admin refunds and the dispute list
+type RefundController struct {
+	refundService *services.RefundService
+	auditService  *services.AuditService
+	logger        *zap.Logger
+}
+
+// NewRefundController creates a new refund controller
+func NewRefundController(refundService *services.RefundService, auditService *services.AuditService, logger *zap.Logger) *RefundController {
+	return &RefundController{
+		refundService: refundService,
+		auditService:  auditService,
+		logger:        logger,
+	}
+}
+
+// RefundPaymentRequest refunds all or part of a payment. Amount is in cents; leave it out
+// to refund everything not refunded yet.
+type RefundPaymentRequest struct {
+	Amount       int64  `json:"amount,omitempty" binding:"omitempty,min=1"`
+	Reason       string `json:"reason,omitempty" binding:"omitempty,oneof=duplicate fraudulent requested_by_customer"`
+	RevokeAccess bool   `json:"revoke_access"`
+}
+
+// RefundPayment godoc
+// @Summary Refund a payment
+// @Description Refund all or part of a payment through its payment provider. The user is notified once the refund goes through and, with revoke_access, loses pro access. App Store and Google Play purchases are refunded by the stores.
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "Payment ID"
+// @Param request body RefundPaymentRequest true "Refund"
+// @Success 201 {object} utils.SuccessResponse{data=models.Refund}
+// @Failure 400 {object} utils.ErrorResponse
+// @Failure 401 {object} utils.ErrorResponse
+// @Failure 403 {object} utils.ErrorResponse
+// @Failure 404 {object} utils.ErrorResponse
+// @Failure 409 {object} utils.ErrorResponse
+// @Failure 500 {object} utils.ErrorResponse
+// @Router /api/v1/admin/payments/{id}/refunds [post]
+func (rc *RefundController) RefundPayment(c *gin.Context) {
+	paymentID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		utils.SendErrorResponse(c, http.StatusBadRequest, "Invalid payment ID", nil)
+		return
+	}
+
+	var req RefundPaymentRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.SendValidationErrorResponse(c, parseValidationErrors(err))
+		return
+	}
+
+	refund, err := rc.refundService.RefundPayment(c.Request.Context(), uint(paymentID), services.RefundRequest{
+		Amount:       req.Amount,
+		Reason:       req.Reason,
+		RevokeAccess: req.RevokeAccess,
+		RequestedBy:  c.GetUint("user_id"),
+	})
+	if err != nil {
+		switch {
+		case errors.Is(err, services.ErrPaymentNotFound):
+			utils.SendNotFoundResponse(c, "Payment not found")
+		case errors.Is(err, services.ErrInvalidRefundAmount):
+			utils.SendErrorResponse(c, http.StatusBadRequest, "Invalid refund amount", map[string]interface{}{"error": err.Error()})
+		case errors.Is(err, services.ErrPaymentNotRefundable):
+			utils.SendErrorResponse(c, http.StatusConflict, "This payment can't be refunded", map[string]interface{}{"error": err.Error()})
+		case errors.Is(err, services.ErrStoreRefund):
+			utils.SendErrorResponse(c, http.StatusConflict, "App Store and Google Play purchases are refunded by the stores", nil)
+		default:
+			rc.logger.Error("Failed to refund payment", zap.Error(err), zap.Uint64("payment_id", paymentID))
+			utils.SendInternalServerErrorResponse(c, "Failed to refund payment")
+		}
+		return
+	}
+
+	event := newAuditEvent(c, models.AuditActionPaymentRefunded, "payment", auditID(refund.PaymentID))
+	event.Metadata["refund_id"] = refund.ID
+	event.Metadata["amount"] = refund.Amount
+	event.Metadata["currency"] = refund.Currency
+	event.Metadata["status"] = refund.Status
+	event.Metadata["revoke_access"] = refund.RevokeAccess
+	if refund.Reason != "" {
+		event.Metadata["reason"] = refund.Reason
+	}
+	rc.auditService.Record(c.Request.Context(), event)
+
+	utils.SendCreatedResponse(c, refund, "Refund issued successfully")
+}
+
+// ListPaymentRefunds godoc
+// @Summary List a payment's refunds
+// @Description List the refunds of a payment, including refunds made in the payment provider's dashboard
+// @Tags admin
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "Payment ID"
+// @Success 200 {object} utils.SuccessResponse{data=[]models.Refund}
+// @Failure 400 {object} utils.ErrorResponse
+// @Failure 401 {object} utils.ErrorResponse
+// @Failure 403 {object} utils.ErrorResponse
+// @Failure 404 {object} utils.ErrorResponse
+// @Failure 500 {object} utils.ErrorResponse
+// @Router /api/v1/admin/payments/{id}/refunds [get]
+func (rc *RefundController) ListPaymentRefunds(c *gin.Context) {
+	paymentID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		utils.SendErrorResponse(c, http.StatusBadRequest, "Invalid payment ID", nil)
+		return
+	}
+
+	refunds, err := rc.refundService.ListRefunds(c.Request.Context(), uint(paymentID))
+	if err != nil {
+		if errors.Is(err, services.ErrPaymentNotFound) {
+			utils.SendNotFoundResponse(c, "Payment not found")
+			return
+		}
+		rc.logger.Error("Failed to list refunds", zap.Error(err))
+		utils.SendInternalServerErrorResponse(c, "Failed to list refunds")
+		return
+	}
+
+	utils.SendSuccessResponse(c, refunds, "Refunds retrieved successfully")
+}
+
+// ListDisputes godoc
+// @Summary List disputes
+// @Description Page through chargebacks and inquiries reported by the payment providers, newest first
+// @Tags admin
+// @Produce json
+// @Security BearerAuth
+// @Param page query int false "Page number" default(1)
+// @Param limit query int false "Items per page" default(20)
+// @Param open query bool false "Only undecided (true) or decided (false) disputes"
+// @Success 200 {object} utils.PaginatedResponse{data=[]models.Dispute}
+// @Failure 401 {object} utils.ErrorResponse
+// @Failure 403 {object} utils.ErrorResponse
+// @Failure 500 {object} utils.ErrorResponse
+// @Router /api/v1/admin/disputes [get]
+func (rc *RefundController) ListDisputes(c *gin.Context) {
+	req := utils.GetPaginationFromQuery(c)
+
+	var open *bool
+	if value := c.Query("open"); value != "" {
+		parsed := utils.ParseBool(value, true)
+		open = &parsed
+	}
+
+	disputes, total, err := rc.refundService.ListDisputes(c.Request.Context(), open, req.Page, req.Limit)
+	if err != nil {
+		rc.logger.Error("Failed to list disputes", zap.Error(err))
+		utils.SendInternalServerErrorResponse(c, "Failed to list disputes")
+		return
+	}
+
+	utils.SendPaginatedResponse(c, disputes, utils.CalculatePagination(req.Page, req.Limit, total), "Disputes retrieved successfully")
+}
@@ -0,0 +1,224 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"mobile-backend/models"
+	"mobile-backend/services"
+	"mobile-backend/utils"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// RoleController handles role and permission administration
+type RoleController struct {
+	roleService  *services.RoleService
+	auditService *services.AuditService
+	logger       *zap.Logger
+}
+
+// NewRoleController creates a new role controller
+func NewRoleController(roleService *services.RoleService, auditService *services.AuditService, logger *zap.Logger) *RoleController {
+	return &RoleController{
+		roleService:  roleService,
+		auditService: auditService,
+		logger:       logger,
+	}
+}
+
+type AssignRoleRequest struct {
+	Role string `json:"role" binding:"required"`
+}
+
+// ListRoles godoc
+// @Summary List roles
+// @Description List all roles with their permissions (admin only)
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {object} utils.SuccessResponse{data=[]models.Role}
+// @Failure 401 {object} utils.ErrorResponse
+// @Failure 403 {object} utils.ErrorResponse
+// @Failure 500 {object} utils.ErrorResponse
+// @Router /api/v1/admin/roles [get]
+func (rc *RoleController) ListRoles(c *gin.Context) {
+	roles, err := rc.roleService.ListRoles(c.Request.Context())
+	if err != nil {
+		rc.logger.Error("Failed to list roles", zap.Error(err))
+		utils.SendInternalServerErrorResponse(c, "Failed to list roles")
+		return
+	}
+
+	utils.SendSuccessResponse(c, roles, "Roles retrieved successfully")
+}
+
+// GetUserRoles godoc
+// @Summary Get user roles
+// @Description Get the roles assigned to a user (admin only)
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "User ID"
+// @Success 200 {object} utils.SuccessResponse{data=[]models.Role}
+// @Failure 400 {object} utils.ErrorResponse
+// @Failure 401 {object} utils.ErrorResponse
+// @Failure 403 {object} utils.ErrorResponse
+// @Failure 500 {object} utils.ErrorResponse
+// @Router /api/v1/admin/users/{id}/roles [get]
+func (rc *RoleController) GetUserRoles(c *gin.Context) {
+	userID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		utils.SendErrorResponse(c, http.StatusBadRequest, "Invalid user ID", nil)
+		return
+	}
+
+	roles, err := rc.roleService.GetUserRoles(c.Request.Context(), uint(userID))
+	if err != nil {
+		rc.logger.Error("Failed to get user roles", zap.Error(err), zap.Uint64("user_id", userID))
+		utils.SendInternalServerErrorResponse(c, "Failed to get user roles")
+		return
+	}
+
+	utils.SendSuccessResponse(c, roles, "User roles retrieved successfully")
+}
+
+// AssignRole godoc
+// @Summary Assign role to user
+// @Description Grant a role to a user. Only superadmins may grant the superadmin role.
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "User ID"
+// @Param request body AssignRoleRequest true "Role to assign"
+// @Success 201 {object} utils.SuccessResponse
+// @Failure 400 {object} utils.ErrorResponse
+// @Failure 401 {object} utils.ErrorResponse
+// @Failure 403 {object} utils.ErrorResponse
+// @Failure 404 {object} utils.ErrorResponse
+// @Failure 409 {object} utils.ErrorResponse
+// @Failure 500 {object} utils.ErrorResponse
+// @Router /api/v1/admin/users/{id}/roles [post]
+func (rc *RoleController) AssignRole(c *gin.Context) {
+	userID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		utils.SendErrorResponse(c, http.StatusBadRequest, "Invalid user ID", nil)
+		return
+	}
+
+	var req AssignRoleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.SendValidationErrorResponse(c, parseValidationErrors(err))
+		return
+	}
+
+	if !rc.canManageRole(c, req.Role) {
+		utils.SendErrorResponse(c, http.StatusForbidden, "Only superadmins can grant the superadmin role", nil)
+		return
+	}
+
+	actorID := c.GetUint("user_id")
+	if err := rc.roleService.AssignRole(c.Request.Context(), uint(userID), req.Role, &actorID); err != nil {
+		switch {
+		case errors.Is(err, services.ErrRoleNotFound):
+			utils.SendNotFoundResponse(c, "Role not found")
+		case errors.Is(err, services.ErrRoleAlreadyAssigned):
+			utils.SendErrorResponse(c, http.StatusConflict, "Role already assigned", nil)
+		default:
+			rc.logger.Error("Failed to assign role", zap.Error(err), zap.Uint64("user_id", userID), zap.String("role", req.Role))
+			utils.SendInternalServerErrorResponse(c, "Failed to assign role")
+		}
+		return
+	}
+
+	rc.logger.Info("Role assigned",
+		zap.Uint64("user_id", userID),
+		zap.String("role", req.Role),
+		zap.Uint("granted_by", actorID),
+	)
+
+	event := newAuditEvent(c, models.AuditActionRoleAssigned, "user", auditID(uint(userID)))
+	event.After = models.JSONMap{"role": req.Role}
+	rc.auditService.Record(c.Request.Context(), event)
+
+	utils.SendCreatedResponse(c, gin.H{"user_id": userID, "role": req.Role}, "Role assigned successfully")
+}
+
+// RevokeRole godoc
+// @Summary Revoke role from user
+// @Description Remove a role from a user. Only superadmins may revoke the superadmin role.
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "User ID"
+// @Param role path string true "Role name"
+// @Success 200 {object} utils.SuccessResponse
+// @Failure 400 {object} utils.ErrorResponse
+// @Failure 401 {object} utils.ErrorResponse
+// @Failure 403 {object} utils.ErrorResponse
+// @Failure 404 {object} utils.ErrorResponse
+// @Failure 500 {object} utils.ErrorResponse
+// @Router /api/v1/admin/users/{id}/roles/{role} [delete]
+func (rc *RoleController) RevokeRole(c *gin.Context) {
+	userID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		utils.SendErrorResponse(c, http.StatusBadRequest, "Invalid user ID", nil)
+		return
+	}
+
+	role := c.Param("role")
+	if !rc.canManageRole(c, role) {
+		utils.SendErrorResponse(c, http.StatusForbidden, "Only superadmins can revoke the superadmin role", nil)
+		return
+	}
+
+	actorID := c.GetUint("user_id")
+	if role == models.RoleSuperAdmin && uint(userID) == actorID {
+		utils.SendErrorResponse(c, http.StatusBadRequest, "Superadmins cannot revoke their own superadmin role", nil)
+		return
+	}
+
+	if err := rc.roleService.RevokeRole(c.Request.Context(), uint(userID), role); err != nil {
+		switch {
+		case errors.Is(err, services.ErrRoleNotFound):
+			utils.SendNotFoundResponse(c, "Role not found")
+		case errors.Is(err, services.ErrRoleNotAssigned):
+			utils.SendNotFoundResponse(c, "Role not assigned to user")
+		default:
+			rc.logger.Error("Failed to revoke role", zap.Error(err), zap.Uint64("user_id", userID), zap.String("role", role))
+			utils.SendInternalServerErrorResponse(c, "Failed to revoke role")
+		}
+		return
+	}
+
+	rc.logger.Info("Role revoked",
+		zap.Uint64("user_id", userID),
+		zap.String("role", role),
+		zap.Uint("revoked_by", actorID),
+	)
+
+	event := newAuditEvent(c, models.AuditActionRoleRevoked, "user", auditID(uint(userID)))
+	event.Before = models.JSONMap{"role": role}
+	rc.auditService.Record(c.Request.Context(), event)
+
+	utils.SendSuccessResponse(c, nil, "Role revoked successfully")
+}
+
+// canManageRole checks whether the current user may grant or revoke the given role
+func (rc *RoleController) canManageRole(c *gin.Context, role string) bool {
+	if role != models.RoleSuperAdmin {
+		return true
+	}
+	for _, r := range c.GetStringSlice("user_roles") {
+		if r == models.RoleSuperAdmin {
+			return true
+		}
+	}
+	return false
+}
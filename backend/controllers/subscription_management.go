@@ -1,7 +1,9 @@
 package controllers
 
 import (
+	"errors"
 	"net/http"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"go.uber.org/zap"
@@ -16,8 +18,9 @@ import (
 type SubscriptionManagementController struct {
 	db                        *gorm.DB
 	subscriptionStatusService *services.SubscriptionStatusService
-	stripeService             *services.StripeService
-	polarService              *services.PolarService
+	providers                 *services.PaymentProviderRegistry
+	changeService             *services.SubscriptionChangeService
+	auditService              *services.AuditService
 	logger                    *zap.Logger
 }
 
@@ -25,15 +28,20 @@ type SubscriptionManagementController struct {
 func NewSubscriptionManagementController(
 	db *gorm.DB,
 	subscriptionStatusService *services.SubscriptionStatusService,
-	stripeService *services.StripeService,
-	polarService *services.PolarService,
+	providers *services.PaymentProviderRegistry,
+	changeService *services.SubscriptionChangeService,
+	auditService *services.AuditService,
 	logger *zap.Logger,
 ) *SubscriptionManagementController {
+	// Plans preload products from the global billing catalog
+	db = models.AcrossTenants(db)
+
 	return &SubscriptionManagementController{
 		db:                        db,
 		subscriptionStatusService: subscriptionStatusService,
-		stripeService:             stripeService,
-		polarService:              polarService,
+		providers:                 providers,
+		changeService:             changeService,
+		auditService:              auditService,
 		logger:                    logger,
 	}
 }
@@ -183,26 +191,21 @@ func (smc *SubscriptionManagementController) CreateSubscription(c *gin.Context)
 		return
 	}
 
-	// Create subscription based on payment method
-	var subscription *models.Subscription
-	var err error
-
-	switch req.PaymentMethod {
-	case "stripe":
-		subscription, err = smc.stripeService.CreateSubscription(c.Request.Context(), userIDUint, req.PlanID, req.PaymentMethod)
-	case "polar":
-		subscription, err = smc.polarService.CreateSubscription(c.Request.Context(), userIDUint, req.PlanID)
-	default:
-		utils.SendErrorResponse(c, http.StatusBadRequest, "Invalid payment method", nil)
+	provider, err := smc.providers.Get(req.PaymentMethod)
+	if err != nil {
+		utils.SendErrorResponse(c, http.StatusBadRequest, "Invalid payment method", map[string]interface{}{"supported": smc.providers.Names()})
 		return
 	}
 
+	subscription, err := provider.CreateSubscription(c.Request.Context(), userIDUint, req.PlanID, req.PaymentMethodID)
 	if err != nil {
 		smc.logger.Error("Failed to create subscription", zap.Error(err), zap.Uint("user_id", userIDUint), zap.Uint("plan_id", req.PlanID))
 		utils.SendErrorResponse(c, http.StatusInternalServerError, "Failed to create subscription", map[string]interface{}{"error": err.Error()})
 		return
 	}
 
+	recordSubscriptionCreated(c, smc.auditService, subscription)
+
 	// Update user subscription status
 	if err := smc.subscriptionStatusService.UpdateUserSubscriptionStatus(c.Request.Context(), userIDUint, subscription); err != nil {
 		smc.logger.Error("Failed to update user subscription status", zap.Error(err), zap.Uint("user_id", userIDUint))
@@ -224,6 +227,7 @@ func (smc *SubscriptionManagementController) CreateSubscription(c *gin.Context)
 // @Failure 400 {object} utils.ErrorResponse
 // @Failure 401 {object} utils.ErrorResponse
 // @Failure 404 {object} utils.ErrorResponse
+// @Failure 409 {object} utils.ErrorResponse
 // @Failure 500 {object} utils.ErrorResponse
 // @Router /api/v1/subscription/cancel [post]
 func (smc *SubscriptionManagementController) CancelSubscription(c *gin.Context) {
@@ -252,24 +256,25 @@ func (smc *SubscriptionManagementController) CancelSubscription(c *gin.Context)
 		return
 	}
 
-	// Cancel subscription based on payment method
-	var err error
-	switch subscription.PaymentMethod {
-	case "stripe":
-		err = smc.stripeService.CancelSubscription(c.Request.Context(), subscription.ID, req.Immediately)
-	case "polar":
-		err = smc.polarService.CancelSubscription(c.Request.Context(), subscription.ID, req.Immediately)
-	default:
-		utils.SendErrorResponse(c, http.StatusBadRequest, "Invalid payment method", nil)
+	if services.IsStorePaymentMethod(subscription.PaymentMethod) {
+		utils.SendErrorResponse(c, http.StatusConflict, "Store subscriptions must be canceled in the App Store or Google Play", nil)
 		return
 	}
 
+	provider, err := smc.providers.Get(subscription.PaymentMethod)
 	if err != nil {
+		utils.SendErrorResponse(c, http.StatusBadRequest, "Invalid payment method", nil)
+		return
+	}
+
+	if err := provider.CancelSubscription(c.Request.Context(), subscription.ID, req.Immediately); err != nil {
 		smc.logger.Error("Failed to cancel subscription", zap.Error(err), zap.Uint("subscription_id", subscription.ID))
 		utils.SendErrorResponse(c, http.StatusInternalServerError, "Failed to cancel subscription", map[string]interface{}{"error": err.Error()})
 		return
 	}
 
+	recordSubscriptionCancelled(c, smc.auditService, smc.db, &subscription, req.Immediately)
+
 	// Update user subscription status
 	if err := smc.subscriptionStatusService.UpdateUserSubscriptionStatus(c.Request.Context(), userIDUint, &subscription); err != nil {
 		smc.logger.Error("Failed to update user subscription status", zap.Error(err), zap.Uint("user_id", userIDUint))
@@ -279,6 +284,100 @@ func (smc *SubscriptionManagementController) CancelSubscription(c *gin.Context)
 	utils.SendSuccessResponse(c, nil, "Subscription canceled successfully")
 }
 
+// PreviewPlanChange godoc
+// @Summary Preview a plan change
+// @Description Compute the proration of changing the current subscription's plan or quantity without changing it. Upgrades take effect immediately; downgrades at the end of the current period. Send the returned proration_date to /subscription/change to be charged the previewed amount.
+// @Tags subscription
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param request body ChangePlanRequest true "Plan change"
+// @Success 200 {object} utils.SuccessResponse{data=services.ProrationPreview}
+// @Failure 400 {object} utils.ErrorResponse
+// @Failure 401 {object} utils.ErrorResponse
+// @Failure 404 {object} utils.ErrorResponse
+// @Failure 409 {object} utils.ErrorResponse
+// @Failure 500 {object} utils.ErrorResponse
+// @Router /api/v1/subscription/change/preview [post]
+func (smc *SubscriptionManagementController) PreviewPlanChange(c *gin.Context) {
+	var req ChangePlanRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.SendErrorResponse(c, http.StatusBadRequest, "Invalid request data", map[string]interface{}{"error": err.Error()})
+		return
+	}
+
+	preview, err := smc.changeService.PreviewChange(c.Request.Context(), c.GetUint("user_id"), req.toService())
+	if err != nil {
+		smc.planChangeError(c, err)
+		return
+	}
+
+	utils.SendSuccessResponse(c, preview, "Plan change previewed successfully")
+}
+
+// ChangePlan godoc
+// @Summary Change subscription plan
+// @Description Change the current subscription's plan or quantity. Upgrades take effect immediately and charge the prorated difference; downgrades are scheduled for the end of the current period. Requesting the current plan and quantity drops a scheduled downgrade.
+// @Tags subscription
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param request body ChangePlanRequest true "Plan change"
+// @Success 200 {object} utils.SuccessResponse
+// @Failure 400 {object} utils.ErrorResponse
+// @Failure 401 {object} utils.ErrorResponse
+// @Failure 404 {object} utils.ErrorResponse
+// @Failure 409 {object} utils.ErrorResponse
+// @Failure 422 {object} utils.ErrorResponse
+// @Failure 500 {object} utils.ErrorResponse
+// @Router /api/v1/subscription/change [post]
+func (smc *SubscriptionManagementController) ChangePlan(c *gin.Context) {
+	var req ChangePlanRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.SendErrorResponse(c, http.StatusBadRequest, "Invalid request data", map[string]interface{}{"error": err.Error()})
+		return
+	}
+
+	subscription, preview, err := smc.changeService.ChangePlan(c.Request.Context(), c.GetUint("user_id"), req.toService())
+	if err != nil {
+		smc.planChangeError(c, err)
+		return
+	}
+
+	recordSubscriptionChanged(c, smc.auditService, subscription, preview)
+
+	utils.SendSuccessResponse(c, map[string]interface{}{
+		"subscription": subscription,
+		"proration":    preview,
+	}, "Subscription plan changed successfully")
+}
+
+func (req ChangePlanRequest) toService() services.PlanChangeRequest {
+	change := services.PlanChangeRequest{PlanID: req.PlanID, Quantity: req.Quantity}
+	if req.ProrationDate != 0 {
+		change.ProrationDate = time.Unix(req.ProrationDate, 0)
+	}
+	return change
+}
+
+func (smc *SubscriptionManagementController) planChangeError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, services.ErrNoActiveSubscription):
+		utils.SendErrorResponse(c, http.StatusNotFound, "No active subscription found", nil)
+	case errors.Is(err, services.ErrStoreSubscriptionChange):
+		utils.SendErrorResponse(c, http.StatusConflict, "Store subscriptions must be changed in the App Store or Google Play", nil)
+	case errors.Is(err, services.ErrProrationQuoteExpired):
+		utils.SendErrorResponse(c, http.StatusConflict, "The preview has expired, please preview the change again", nil)
+	case errors.Is(err, services.ErrInvalidPlanChange):
+		utils.SendErrorResponse(c, http.StatusBadRequest, "Invalid plan change", map[string]interface{}{"error": err.Error()})
+	case errors.Is(err, services.ErrPlanChangeUnsupported):
+		utils.SendErrorResponse(c, http.StatusUnprocessableEntity, "This change isn't supported by the subscription's payment provider", nil)
+	default:
+		smc.logger.Error("Failed to change subscription plan", zap.Error(err), zap.Uint("user_id", c.GetUint("user_id")))
+		utils.SendInternalServerErrorResponse(c, "Failed to change subscription plan")
+	}
+}
+
 // GetSubscriptionHistory godoc
 // @Summary Get user subscription history
 // @Description Get the current user's subscription history
@@ -327,15 +426,8 @@ func (smc *SubscriptionManagementController) GetSubscriptionHistory(c *gin.Conte
 // @Failure 401 {object} utils.ErrorResponse
 // @Failure 403 {object} utils.ErrorResponse
 // @Failure 500 {object} utils.ErrorResponse
-// @Router /api/v1/subscription/stats [get]
+// @Router /api/v1/subscription/admin/stats [get]
 func (smc *SubscriptionManagementController) GetSubscriptionStats(c *gin.Context) {
-	// Check if user is admin
-	userRole, exists := c.Get("user_role")
-	if !exists || userRole != "admin" {
-		utils.SendErrorResponse(c, http.StatusForbidden, "Admin access required", nil)
-		return
-	}
-
 	stats, err := smc.subscriptionStatusService.GetSubscriptionStats(c.Request.Context())
 	if err != nil {
 		smc.logger.Error("Failed to get subscription stats", zap.Error(err))
@@ -4,6 +4,7 @@ import (
 	"net/http"
 	"strconv"
 
+	"mobile-backend/models"
 	"mobile-backend/services"
 	"mobile-backend/utils"
 
@@ -11,11 +12,13 @@ import (
 )
 
 type UserController struct {
-	authService *services.AuthService
+	authService    *services.AuthService
+	privacyService *services.PrivacyService
+	auditService   *services.AuditService
 }
 
-func NewUserController(authService *services.AuthService) *UserController {
-	return &UserController{authService: authService}
+func NewUserController(authService *services.AuthService, privacyService *services.PrivacyService, auditService *services.AuditService) *UserController {
+	return &UserController{authService: authService, privacyService: privacyService, auditService: auditService}
 }
 
 type UpdateUserRequest struct {
@@ -42,6 +45,9 @@ func (uc *UserController) GetProfile(c *gin.Context) {
 		IsActive:  user.IsActive,
 		CreatedAt: user.CreatedAt,
 		UpdatedAt: user.UpdatedAt,
+		// Email verification
+		EmailVerifiedAt: user.EmailVerifiedAt,
+		IsGuest:         user.IsGuest,
 		// Add subscription status fields
 		SubscriptionStatus:   user.SubscriptionStatus,
 		IsPro:                user.IsPro,
@@ -73,12 +79,25 @@ func (uc *UserController) UpdateProfile(c *gin.Context) {
 		updates["name"] = req.Name
 	}
 
+	previous, err := uc.authService.GetUserByID(userID.(uint))
+	if err != nil {
+		utils.SendNotFoundResponse(c, "User not found")
+		return
+	}
+
 	user, err := uc.authService.UpdateUser(userID.(uint), updates)
 	if err != nil {
 		utils.SendInternalServerErrorResponse(c, "Failed to update profile")
 		return
 	}
 
+	event := newAuditEvent(c, models.AuditActionProfileUpdated, "user", auditID(user.ID))
+	event.Before, event.After = models.AuditDiff(
+		map[string]interface{}{"name": previous.Name},
+		map[string]interface{}{"name": user.Name},
+	)
+	uc.auditService.Record(c.Request.Context(), event)
+
 	userResponse := utils.UserResponse{
 		ID:        user.ID,
 		Email:     user.Email,
@@ -91,19 +110,15 @@ func (uc *UserController) UpdateProfile(c *gin.Context) {
 	utils.SendSuccessResponse(c, userResponse, "Profile updated successfully")
 }
 
+// DeleteProfile schedules the account and its personal data for erasure. Until the grace
+// period ends the request can be cancelled through the privacy endpoints.
 func (uc *UserController) DeleteProfile(c *gin.Context) {
-	userID, exists := c.Get("user_id")
-	if !exists {
+	if _, exists := c.Get("user_id"); !exists {
 		utils.SendUnauthorizedResponse(c, "User not authenticated")
 		return
 	}
 
-	if err := uc.authService.DeleteUser(userID.(uint)); err != nil {
-		utils.SendInternalServerErrorResponse(c, "Failed to delete profile")
-		return
-	}
-
-	utils.SendSuccessResponse(c, nil, "Profile deleted successfully")
+	requestErasure(c, uc.privacyService, uc.auditService)
 }
 
 func (uc *UserController) GetUserByID(c *gin.Context) {
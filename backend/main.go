@@ -46,16 +46,43 @@ func main() {
 		logger.Fatal("Failed to connect to database", zap.Error(err))
 	}
 
+	// Confine tenant-owned models to the organization of the request context
+	if err := models.RegisterTenantScope(config.GetDB()); err != nil {
+		logger.Fatal("Failed to register tenant scope", zap.Error(err))
+	}
+
 	// Run database migrations
 	if err := config.GetDB().AutoMigrate(
 		&models.User{},
 		&models.Session{},
+		&models.PasswordHistory{},
+		&models.VerificationToken{},
+		&models.UserMFA{},
+		&models.MFARecoveryCode{},
+		&models.SigningKey{},
+		&models.OAuthProvider{},
+		&models.UserIdentity{},
+		&models.APIKey{},
+		&models.Organization{},
+		&models.OrganizationMembership{},
+		&models.OrganizationInvitation{},
+		&models.AuditEvent{},
+		&models.DataRequest{},
+		&models.BulkUserAction{},
+		&models.UserDevice{},
+		&models.Role{},
+		&models.Permission{},
+		&models.UserRole{},
 		&models.Product{},
 		&models.Plan{},
 		&models.Subscription{},
 		&models.Payment{},
+		&models.Refund{},
+		&models.Dispute{},
+		&models.SubscriptionDunning{},
 		&models.PaymentMethod{},
 		&models.WebhookEvent{},
+		&models.IdempotencyKey{},
 		&models.GeminiConversation{},
 		&models.OfflineOperation{},
 		&models.SyncConflict{},
@@ -86,11 +113,54 @@ func main() {
 		logger.Fatal("Failed to connect to Redis", zap.Error(err))
 	}
 
+	// Load JWT signing keys before anything issues or verifies tokens
+	keyringService, err := services.NewKeyringService(config.GetDB(), logger.Logger)
+	if err != nil {
+		logger.Fatal("Failed to configure JWT signing", zap.Error(err))
+	}
+	if err := keyringService.Initialize(ctx); err != nil {
+		logger.Fatal("Failed to initialize JWT signing keys", zap.Error(err))
+	}
+	utils.SetDefaultKeyring(keyringService.Keyring())
+	go keyringService.Start(ctx)
+
 	// Initialize services
 	cacheService := services.NewCacheService(redisClient)
 	cacheMetricsService := services.NewCacheMetricsService(redisClient)
-	authService := services.NewAuthService(config.GetDB(), cacheService)
+	tokenBlacklistService := services.NewTokenBlacklistService(redisClient)
+	middleware.SetTokenRevocationChecker(tokenBlacklistService)
+	loginLockoutService, err := services.NewLoginLockoutService(config.GetDB(), redisClient, logger)
+	if err != nil {
+		logger.Fatal("Failed to initialize login lockout service", zap.Error(err))
+	}
+	passwordPolicyService, err := services.NewPasswordPolicyService(config.GetDB())
+	if err != nil {
+		logger.Fatal("Failed to configure password policy", zap.Error(err))
+	}
+	if err := utils.SetPasswordHashParams(passwordPolicyService.HashParams()); err != nil {
+		logger.Fatal("Failed to configure password hashing", zap.Error(err))
+	}
+	authService := services.NewAuthService(config.GetDB(), cacheService, tokenBlacklistService, loginLockoutService, passwordPolicyService, logger)
 	oauth2Service := services.NewOAuth2Service(config.GetDB(), redisClient)
+	if err := oauth2Service.LoadProviders(ctx); err != nil {
+		logger.Fatal("Failed to load OAuth2 providers", zap.Error(err))
+	}
+	roleService := services.NewRoleService(config.GetDB())
+	mfaService := services.NewMFAService(config.GetDB(), logger)
+	mfaService.SetLoginLockout(loginLockoutService)
+	apiKeyService := services.NewAPIKeyService(config.GetDB(), logger)
+	auditService := services.NewAuditService(config.GetDB(), logger)
+	middleware.SetAPIKeyAuthenticator(apiKeyService)
+
+	// Seed built-in roles and optionally bootstrap the initial superadmin
+	if err := roleService.EnsureDefaultRoles(ctx); err != nil {
+		logger.Fatal("Failed to seed default roles", zap.Error(err))
+	}
+	if email := os.Getenv("SUPERADMIN_EMAIL"); email != "" {
+		if err := roleService.BootstrapSuperAdmin(ctx, email); err != nil {
+			logger.Warn("Failed to bootstrap superadmin", zap.String("email", email), zap.Error(err))
+		}
+	}
 
 	// Initialize subscription status service
 	subscriptionStatusService := services.NewSubscriptionStatusService(config.GetDB(), logger.Logger)
@@ -103,12 +173,115 @@ func main() {
 	stripeService := services.NewStripeService(config.GetDB(), cacheService, websocketService, subscriptionStatusService)
 	polarService := services.NewPolarService(config.GetDB(), cacheService, subscriptionStatusService)
 
+	// Payment providers are looked up by name from payment_method fields and webhook URLs
+	paymentProviders := services.NewPaymentProviderRegistry(os.Getenv("PAYMENT_DEFAULT_PROVIDER"))
+	paymentProviders.Register(stripeService)
+	paymentProviders.Register(polarService)
+	if os.Getenv("FAKE_PAYMENT_PROVIDER_ENABLED") == "true" {
+		// The fake grants subscriptions without charging anyone
+		if os.Getenv("GIN_MODE") == "release" {
+			logger.Fatal("The fake payment provider can't be enabled in release mode")
+		}
+		fakePaymentProvider, err := services.NewFakePaymentProvider(config.GetDB(), subscriptionStatusService)
+		if err != nil {
+			logger.Fatal("Failed to initialize fake payment provider", zap.Error(err))
+		}
+		paymentProviders.Register(fakePaymentProvider)
+	}
+	if _, err := paymentProviders.Default(); err != nil {
+		logger.Fatal("Invalid PAYMENT_DEFAULT_PROVIDER", zap.Error(err))
+	}
+
+	// App Store and Google Play subscriptions are bought in the apps, so they're verified
+	// rather than created through a payment provider
+	if os.Getenv("GOOGLE_PLAY_FIXTURES_DIR") != "" && os.Getenv("GIN_MODE") == "release" {
+		logger.Fatal("Google Play fixtures can't be used in release mode")
+	}
+	iapService, err := services.NewInAppPurchaseService(config.GetDB(), subscriptionStatusService, logger.Logger)
+	if err != nil {
+		logger.Fatal("Failed to initialize in-app purchase service", zap.Error(err))
+	}
+
 	// Initialize job queue and background processing services
 	jobQueueService := services.NewJobQueueService(os.Getenv("REDIS_URL"), config.GetDB(), logger.Logger)
 	cronScheduler := services.NewCronScheduler(jobQueueService, config.GetDB(), logger.Logger)
 	workerManager := services.NewWorkerManager(jobQueueService, cronScheduler, config.GetDB(), logger.Logger)
 	jobQueueMetrics := services.NewJobQueueMetrics(os.Getenv("REDIS_URL"), logger.Logger)
 
+	// Initialize email verification and password reset service
+	verificationService := services.NewVerificationService(config.GetDB(), jobQueueService, tokenBlacklistService, passwordPolicyService, logger)
+
+	// Initialize magic link and email code sign in
+	passwordlessService, err := services.NewPasswordlessService(config.GetDB(), redisClient, jobQueueService, logger)
+	if err != nil {
+		logger.Fatal("Failed to initialize passwordless service", zap.Error(err))
+	}
+	passwordlessService.SetLoginLockout(loginLockoutService)
+
+	// Initialize organizations and tenant resolution
+	organizationService, err := services.NewOrganizationService(config.GetDB(), jobQueueService, logger)
+	if err != nil {
+		logger.Fatal("Failed to initialize organization service", zap.Error(err))
+	}
+	middleware.SetMembershipResolver(organizationService)
+
+	// Initialize personal data export and account erasure jobs
+	privacyService, err := services.NewPrivacyService(config.GetDB(), jobQueueService, tokenBlacklistService, auditService, logger)
+	if err != nil {
+		logger.Fatal("Failed to initialize privacy service", zap.Error(err))
+	}
+	if err := cronScheduler.AddCustomJob("data-export-cleanup", "15 * * * *", "Delete expired data exports", func() error {
+		_, err := privacyService.PurgeExpiredExports(context.Background())
+		return err
+	}); err != nil {
+		logger.Fatal("Failed to schedule data export cleanup", zap.Error(err))
+	}
+
+	// Initialize guest accounts and the daily purge of guests that stopped using the app
+	guestService, err := services.NewGuestService(config.GetDB(), passwordPolicyService, privacyService, logger)
+	if err != nil {
+		logger.Fatal("Failed to initialize guest service", zap.Error(err))
+	}
+	if err := cronScheduler.AddCustomJob("guest-cleanup", "30 3 * * *", "Delete stale guest accounts", func() error {
+		_, err := guestService.PurgeStaleGuests(context.Background())
+		return err
+	}); err != nil {
+		logger.Fatal("Failed to schedule guest cleanup", zap.Error(err))
+	}
+
+	// Initialize request signing and idempotency keys for the payment and sync endpoints
+	requestSigningService, err := services.NewRequestSigningService(redisClient, logger)
+	if err != nil {
+		logger.Fatal("Failed to configure request signing", zap.Error(err))
+	}
+	if requestSigningService.Enabled() {
+		middleware.SetRequestVerifier(requestSigningService)
+	}
+	idempotencyService, err := services.NewIdempotencyService(config.GetDB(), logger)
+	if err != nil {
+		logger.Fatal("Failed to configure idempotency keys", zap.Error(err))
+	}
+	middleware.SetIdempotencyStore(idempotencyService)
+	if err := cronScheduler.AddCustomJob("idempotency-key-cleanup", "45 * * * *", "Delete expired idempotency keys", func() error {
+		_, err := idempotencyService.PurgeExpired(context.Background())
+		return err
+	}); err != nil {
+		logger.Fatal("Failed to schedule idempotency key cleanup", zap.Error(err))
+	}
+
+	// Initialize plan changes; downgrades scheduled for the end of a period are applied hourly
+	subscriptionChangeService := services.NewSubscriptionChangeService(config.GetDB(), paymentProviders, subscriptionStatusService, logger.Logger)
+	if err := cronScheduler.AddCustomJob("scheduled-plan-changes", "5 * * * *", "Apply plan changes scheduled for the end of the billing period", func() error {
+		_, err := subscriptionChangeService.ApplyScheduledChanges(context.Background())
+		return err
+	}); err != nil {
+		logger.Fatal("Failed to schedule plan changes", zap.Error(err))
+	}
+
+	// Initialize user administration; suspended users' tokens are refused from here on
+	adminUserService := services.NewAdminUserService(config.GetDB(), jobQueueService, tokenBlacklistService, verificationService, auditService, logger)
+	middleware.SetUserStatusChecker(adminUserService)
+
 	// Initialize Gemini AI service
 	geminiService, err := services.NewGeminiService(config.GetDB(), cacheService, logger.Logger)
 	if err != nil {
@@ -124,6 +297,31 @@ func main() {
 	// Initialize push notification service
 	pushNotificationService := services.NewPushNotificationService(config.GetDB(), redisClient, cacheService, websocketService, logger.Logger)
 
+	// Initialize the device registry; every login from here on records its device
+	deviceService := services.NewDeviceService(config.GetDB(), jobQueueService, tokenBlacklistService, pushNotificationService, logger)
+	authService.SetDeviceRegistry(deviceService)
+
+	// Initialize refunds and disputes; Stripe and Polar webhooks report them here
+	refundService := services.NewRefundService(config.GetDB(), paymentProviders, subscriptionStatusService, jobQueueService, pushNotificationService, logger.Logger)
+	stripeService.SetRefundService(refundService)
+	polarService.SetRefundService(refundService)
+
+	// Initialize dunning; past due subscriptions keep pro access during a grace period
+	// while reminders go out, and are downgraded by the sweep once it runs out
+	dunningService, err := services.NewDunningService(config.GetDB(), subscriptionStatusService, jobQueueService, pushNotificationService, logger.Logger)
+	if err != nil {
+		logger.Fatal("Failed to configure dunning", zap.Error(err))
+	}
+	if dunningService.Enabled() {
+		subscriptionStatusService.SetDunningService(dunningService)
+	}
+	if err := cronScheduler.AddCustomJob("dunning", "*/15 * * * *", "End expired grace periods and send overdue dunning reminders", func() error {
+		_, err := dunningService.ProcessDunning(context.Background())
+		return err
+	}); err != nil {
+		logger.Fatal("Failed to schedule dunning", zap.Error(err))
+	}
+
 	// Start WebSocket hub in a goroutine
 	go websocketHub.Run()
 
@@ -145,20 +343,34 @@ func main() {
 
 	// Initialize controllers
 	healthController := controllers.NewHealthController(config.GetDB())
-	authController := controllers.NewAuthController(authService)
-	userController := controllers.NewUserController(authService)
+	authController := controllers.NewAuthController(authService, verificationService, auditService)
+	userController := controllers.NewUserController(authService, privacyService, auditService)
 	uploadController := controllers.NewUploadController("./uploads")
 	generatorController := controllers.NewGeneratorController(config.GetDB())
 	oauth2Controller := controllers.NewOAuth2Controller(oauth2Service, authService)
-	cacheController := controllers.NewCacheController(cacheService, cacheMetricsService)
-	paymentController := controllers.NewPaymentController(stripeService, polarService, config.GetDB())
+	cacheController := controllers.NewCacheController(cacheService, cacheMetricsService, auditService)
+	paymentController := controllers.NewPaymentController(paymentProviders, config.GetDB(), auditService)
 	websocketController := controllers.NewWebSocketController(websocketService, websocketHub, logger.Logger)
 	jobQueueController := controllers.NewJobQueueController(jobQueueService, workerManager, logger.Logger)
 	jobQueueMetricsController := controllers.NewJobQueueMetricsController(jobQueueMetrics, logger.Logger)
-	productWebhookController := controllers.NewProductWebhookController(stripeService, polarService, productSyncService)
+	productWebhookController := controllers.NewProductWebhookController(paymentProviders, productSyncService)
 	geminiController := controllers.NewGeminiController(geminiService, logger.Logger)
 	offlineSyncController := controllers.NewOfflineSyncController(offlineSyncService, logger.Logger)
 	pushNotificationController := controllers.NewPushNotificationController(pushNotificationService, logger.Logger)
+	roleController := controllers.NewRoleController(roleService, auditService, logger.Logger)
+	mfaController := controllers.NewMFAController(authService, mfaService, auditService, logger.Logger)
+	jwksController := controllers.NewJWKSController(keyringService.Keyring())
+	passwordlessController := controllers.NewPasswordlessController(passwordlessService, authService, logger.Logger)
+	apiKeyController := controllers.NewAPIKeyController(apiKeyService, logger.Logger)
+	organizationController := controllers.NewOrganizationController(organizationService, authService, logger.Logger)
+	auditController := controllers.NewAuditController(auditService, logger.Logger)
+	privacyController := controllers.NewPrivacyController(privacyService, auditService, logger.Logger)
+	adminUserController := controllers.NewAdminUserController(adminUserService, auditService, logger.Logger)
+	deviceController := controllers.NewDeviceController(deviceService, auditService, logger.Logger)
+	iapController := controllers.NewInAppPurchaseController(iapService, auditService, logger.Logger)
+	refundController := controllers.NewRefundController(refundService, auditService, logger.Logger)
+	dunningController := controllers.NewDunningController(dunningService, logger.Logger)
+	guestController := controllers.NewGuestController(guestService, oauth2Service, authService, verificationService, auditService, logger.Logger)
 	// Subscription management controller is initialized in routes
 
 	// Setup Gin router
@@ -182,15 +394,13 @@ func main() {
 	r.Use(middleware.PrometheusMiddleware())
 	r.Use(utils.ErrorHandler()) // Add error handler
 
-	// Apply rate limiting to specific route groups
-	authGroup := r.Group("/api/v1/auth")
-	authGroup.Use(rateLimiter.AuthRateLimit())
-
+	// Apply rate limiting to specific route groups. Unauthenticated auth endpoints are
+	// limited with rateLimiter.AuthRateLimit() on each route where the routes are set up.
 	apiGroup := r.Group("/api/v1")
 	apiGroup.Use(rateLimiter.APIRateLimit())
 
 	// Setup routes
-	routes.SetupRoutes(r, healthController, authController, userController, uploadController, generatorController, oauth2Controller, cacheController, paymentController, websocketController, offlineSyncController)
+	routes.SetupRoutes(r, healthController, authController, userController, uploadController, generatorController, oauth2Controller, cacheController, paymentController, websocketController, offlineSyncController, rateLimiter)
 
 	// Setup WebSocket routes with logger
 	routes.SetupWebSocketRoutes(r, websocketController, logger.Logger)
@@ -214,8 +424,9 @@ func main() {
 		apiGroup,
 		config.GetDB(),
 		subscriptionStatusService,
-		stripeService,
-		polarService,
+		paymentProviders,
+		subscriptionChangeService,
+		auditService,
 		subscriptionMiddleware,
 		logger.Logger,
 	)
@@ -229,6 +440,23 @@ func main() {
 	// Setup push notification routes
 	routes.SetupPushNotificationRoutes(r, pushNotificationController)
 
+	// Setup admin routes (roles and permissions)
+	routes.SetupAdminRoutes(r, roleController, authController, adminUserController)
+	routes.SetupMFARoutes(r, mfaController, rateLimiter)
+	routes.SetupJWKSRoutes(r, jwksController)
+	routes.SetupPasswordlessRoutes(r, passwordlessController)
+	routes.SetupGuestRoutes(r, guestController, rateLimiter)
+	routes.SetupInAppPurchaseRoutes(r, iapController)
+
+	// Setup admin refund, dispute and dunning routes
+	routes.SetupRefundRoutes(r, refundController)
+	routes.SetupDunningRoutes(r, dunningController)
+	routes.SetupAPIKeyRoutes(r, apiKeyController)
+	routes.SetupOrganizationRoutes(r, organizationController)
+	routes.SetupAuditRoutes(r, auditController)
+	routes.SetupPrivacyRoutes(r, privacyController)
+	routes.SetupDeviceRoutes(r, deviceController)
+
 	// Regenerate Swagger documentation on startup
 	logger.Info("Regenerating Swagger documentation...")
 	if err := regenerateSwaggerDocs(); err != nil {
@@ -0,0 +1,109 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"sync"
+
+	"mobile-backend/models"
+	"mobile-backend/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+// APIKeyHeader carries API keys on server-to-server requests
+const APIKeyHeader = "X-API-Key"
+
+// APIKeyAuthenticator resolves a raw API key to the key it identifies
+type APIKeyAuthenticator interface {
+	AuthenticateAPIKey(ctx context.Context, rawKey, clientIP string) (*models.APIKey, error)
+}
+
+var (
+	apiKeyAuthenticatorMu sync.RWMutex
+	apiKeyAuthenticator   APIKeyAuthenticator
+)
+
+// SetAPIKeyAuthenticator installs the authenticator used by the API key middlewares.
+// Until one is installed, every API key is rejected.
+func SetAPIKeyAuthenticator(authenticator APIKeyAuthenticator) {
+	apiKeyAuthenticatorMu.Lock()
+	apiKeyAuthenticator = authenticator
+	apiKeyAuthenticatorMu.Unlock()
+}
+
+// APIKeyAuthMiddleware authenticates requests by the X-API-Key header. Key requests carry
+// the owner's user_id but no roles or permissions, so RBAC-protected routes stay closed.
+func APIKeyAuthMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if c.GetHeader(APIKeyHeader) == "" {
+			utils.SendUnauthorizedResponse(c, "API key required")
+			c.Abort()
+			return
+		}
+		authenticateAPIKey(c)
+	}
+}
+
+// AuthOrAPIKeyMiddleware accepts either a bearer token or an API key. Combine it with
+// RequireAPIKeyScope to limit which key scopes may call the route.
+func AuthOrAPIKeyMiddleware() gin.HandlerFunc {
+	jwtAuth := AuthMiddleware()
+	return func(c *gin.Context) {
+		if c.GetHeader(APIKeyHeader) != "" {
+			authenticateAPIKey(c)
+			return
+		}
+		jwtAuth(c)
+	}
+}
+
+// RequireAPIKeyScope lets API key requests through only when the key holds the scope.
+// Requests authenticated with a bearer token are not affected.
+func RequireAPIKeyScope(scope string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if _, isKey := c.Get("api_key_id"); !isKey {
+			c.Next()
+			return
+		}
+
+		if !containsString(c.GetStringSlice("api_key_scopes"), scope) {
+			utils.SendErrorResponse(c, http.StatusForbidden, "API key lacks the required scope", map[string]interface{}{
+				"required_scope": scope,
+			})
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
+
+func authenticateAPIKey(c *gin.Context) {
+	apiKeyAuthenticatorMu.RLock()
+	authenticator := apiKeyAuthenticator
+	apiKeyAuthenticatorMu.RUnlock()
+
+	if authenticator == nil {
+		utils.SendUnauthorizedResponse(c, "Invalid API key")
+		c.Abort()
+		return
+	}
+
+	key, err := authenticator.AuthenticateAPIKey(c.Request.Context(), c.GetHeader(APIKeyHeader), c.ClientIP())
+	if err != nil || key == nil {
+		utils.SendUnauthorizedResponse(c, "Invalid API key")
+		c.Abort()
+		return
+	}
+
+	c.Set("user_id", key.UserID)
+	c.Set("user_email", key.User.Email)
+	c.Set("user_roles", []string{})
+	c.Set("user_permissions", []string{})
+	c.Set("api_key_id", key.ID)
+	c.Set("api_key_scopes", key.ScopeList())
+	if key.OrganizationID != nil {
+		c.Set("api_key_organization_id", *key.OrganizationID)
+	}
+	c.Next()
+}
@@ -1,13 +1,76 @@
 package middleware
 
 import (
+	"context"
+	"net/http"
 	"strings"
+	"sync"
 
 	"mobile-backend/utils"
 
 	"github.com/gin-gonic/gin"
 )
 
+// TokenRevocationChecker reports whether a validly signed token has been revoked
+type TokenRevocationChecker interface {
+	IsRevoked(ctx context.Context, claims *utils.Claims) (bool, error)
+}
+
+var (
+	revocationCheckerMu sync.RWMutex
+	revocationChecker   TokenRevocationChecker
+)
+
+// SetTokenRevocationChecker installs the checker consulted by the auth middlewares on
+// every request. Until one is installed, tokens are valid until they expire.
+func SetTokenRevocationChecker(checker TokenRevocationChecker) {
+	revocationCheckerMu.Lock()
+	revocationChecker = checker
+	revocationCheckerMu.Unlock()
+}
+
+// isTokenRevoked consults the installed revocation checker, if any
+func isTokenRevoked(ctx context.Context, claims *utils.Claims) (bool, error) {
+	revocationCheckerMu.RLock()
+	checker := revocationChecker
+	revocationCheckerMu.RUnlock()
+
+	if checker == nil {
+		return false, nil
+	}
+	return checker.IsRevoked(ctx, claims)
+}
+
+// UserStatusChecker reports whether a user's account may still be used
+type UserStatusChecker interface {
+	IsUserActive(ctx context.Context, userID uint) (bool, error)
+}
+
+var (
+	userStatusCheckerMu sync.RWMutex
+	userStatusChecker   UserStatusChecker
+)
+
+// SetUserStatusChecker installs the checker the auth middlewares use to refuse tokens of
+// deactivated users. Until one is installed, account status is only checked at login.
+func SetUserStatusChecker(checker UserStatusChecker) {
+	userStatusCheckerMu.Lock()
+	userStatusChecker = checker
+	userStatusCheckerMu.Unlock()
+}
+
+// isUserActive consults the installed user status checker, if any
+func isUserActive(ctx context.Context, userID uint) (bool, error) {
+	userStatusCheckerMu.RLock()
+	checker := userStatusChecker
+	userStatusCheckerMu.RUnlock()
+
+	if checker == nil {
+		return true, nil
+	}
+	return checker.IsUserActive(ctx, userID)
+}
+
 func AuthMiddleware() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		authHeader := c.GetHeader("Authorization")
@@ -31,8 +94,58 @@ func AuthMiddleware() gin.HandlerFunc {
 			return
 		}
 
+		// Fail closed: a revoked token must never pass because the store is unreachable
+		revoked, err := isTokenRevoked(c.Request.Context(), claims)
+		if err != nil {
+			utils.SendInternalServerErrorResponse(c, "Failed to verify token")
+			c.Abort()
+			return
+		}
+		if revoked {
+			utils.SendUnauthorizedResponse(c, "Token has been revoked")
+			c.Abort()
+			return
+		}
+
+		active, err := isUserActive(c.Request.Context(), claims.UserID)
+		if err != nil {
+			utils.SendInternalServerErrorResponse(c, "Failed to verify account status")
+			c.Abort()
+			return
+		}
+		if !active {
+			utils.SendErrorResponse(c, http.StatusForbidden, "Account is deactivated", nil)
+			c.Abort()
+			return
+		}
+
 		c.Set("user_id", claims.UserID)
 		c.Set("user_email", claims.Email)
+		c.Set("user_roles", claims.Roles)
+		c.Set("user_permissions", claims.Permissions)
+		c.Set("session_id", claims.SessionID)
+		c.Set("token_id", claims.ID)
+		if claims.OrganizationID != 0 {
+			c.Set("token_organization_id", claims.OrganizationID)
+		}
+		if claims.IsImpersonation() {
+			c.Set("impersonator_id", claims.Actor.UserID)
+			c.Set("impersonator_email", claims.Actor.Email)
+		}
+		c.Next()
+	}
+}
+
+// BlockImpersonation refuses the request when it is made with an impersonation token, so
+// that staff acting as a user cannot pay, change credentials or alter the account.
+// Must be used after AuthMiddleware.
+func BlockImpersonation() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if _, impersonating := c.Get("impersonator_id"); impersonating {
+			utils.SendErrorResponse(c, http.StatusForbidden, "This action is not allowed while impersonating a user", nil)
+			c.Abort()
+			return
+		}
 		c.Next()
 	}
 }
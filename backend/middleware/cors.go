@@ -20,6 +20,16 @@ type CORSConfig struct {
 	AllowBrowserExtensions bool
 }
 
+// defaultAllowedHeaders are the request headers clients may send cross-origin, shared by
+// the CORS middleware and PreflightHandler. CORS_ALLOWED_HEADERS replaces them for both.
+var defaultAllowedHeaders = []string{
+	"Origin", "Content-Length", "Content-Type", "Authorization",
+	"X-Requested-With", "Accept", "X-API-Key", "X-Request-ID",
+	"X-Trace-ID", "X-Span-ID", "X-Correlation-ID", "X-Device-ID", "X-Device-Name",
+	"X-Platform", "X-App-Version", "X-OS-Version",
+	"X-Client-ID", "X-Timestamp", "X-Nonce", "X-Signature", "Idempotency-Key",
+}
+
 func CORS() gin.HandlerFunc {
 	config := getCORSConfig()
 	return cors.New(config)
@@ -35,16 +45,13 @@ func getCORSConfig() cors.Config {
 	})
 
 	// Get allowed headers from environment or use defaults
-	headers := getStringSliceFromEnv("CORS_ALLOWED_HEADERS", []string{
-		"Origin", "Content-Length", "Content-Type", "Authorization",
-		"X-Requested-With", "Accept", "X-API-Key", "X-Request-ID",
-		"X-Trace-ID", "X-Span-ID", "X-Correlation-ID",
-	})
+	headers := getStringSliceFromEnv("CORS_ALLOWED_HEADERS", defaultAllowedHeaders)
 
 	// Get exposed headers from environment or use defaults
 	exposeHeaders := getStringSliceFromEnv("CORS_EXPOSED_HEADERS", []string{
 		"Content-Length", "X-Total-Count", "X-Page-Count",
 		"X-RateLimit-Limit", "X-RateLimit-Remaining", "X-RateLimit-Reset",
+		"Idempotent-Replayed",
 	})
 
 	// Get max age from environment or use default
@@ -191,7 +198,7 @@ func PreflightHandler() gin.HandlerFunc {
 		if c.Request.Method == "OPTIONS" {
 			c.Header("Access-Control-Allow-Origin", c.GetHeader("Origin"))
 			c.Header("Access-Control-Allow-Methods", "GET, POST, PUT, PATCH, DELETE, HEAD, OPTIONS")
-			c.Header("Access-Control-Allow-Headers", "Origin, Content-Length, Content-Type, Authorization, X-Requested-With, Accept, X-API-Key, X-Request-ID, X-Trace-ID, X-Span-ID, X-Correlation-ID")
+			c.Header("Access-Control-Allow-Headers", strings.Join(getStringSliceFromEnv("CORS_ALLOWED_HEADERS", defaultAllowedHeaders), ", "))
 			c.Header("Access-Control-Allow-Credentials", "true")
 			c.Header("Access-Control-Max-Age", "86400") // 24 hours
 			c.Status(200)
@@ -0,0 +1,124 @@
+package middleware
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"sync"
+
+	"mobile-backend/models"
+	"mobile-backend/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+// IdempotencyKeyHeader lets clients retry a request without running it twice
+const IdempotencyKeyHeader = "Idempotency-Key"
+
+// IdempotencyStore claims idempotency keys and stores the responses to their requests
+type IdempotencyStore interface {
+	Begin(ctx context.Context, userID uint, key, requestHash string) (*models.IdempotencyKey, bool, error)
+	Complete(ctx context.Context, record *models.IdempotencyKey, statusCode int, body []byte) error
+	Release(ctx context.Context, record *models.IdempotencyKey) error
+}
+
+var (
+	idempotencyStoreMu sync.RWMutex
+	idempotencyStore   IdempotencyStore
+)
+
+// SetIdempotencyStore installs the store used by the Idempotency middleware. Until one is
+// installed, Idempotency-Key headers are ignored.
+func SetIdempotencyStore(store IdempotencyStore) {
+	idempotencyStoreMu.Lock()
+	idempotencyStore = store
+	idempotencyStoreMu.Unlock()
+}
+
+// Idempotency replays the stored response when a request is retried with the same
+// Idempotency-Key, instead of running the handler again. Keys are scoped to the user, so
+// the middleware must come after authentication. Requests without the header run as usual.
+func Idempotency() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		idempotencyStoreMu.RLock()
+		store := idempotencyStore
+		idempotencyStoreMu.RUnlock()
+
+		key := c.GetHeader(IdempotencyKeyHeader)
+		if store == nil || key == "" {
+			c.Next()
+			return
+		}
+		if len(key) > 255 {
+			utils.SendErrorResponse(c, http.StatusBadRequest, "Idempotency-Key must be at most 255 characters", nil)
+			c.Abort()
+			return
+		}
+
+		body, err := io.ReadAll(c.Request.Body)
+		if err != nil {
+			utils.SendErrorResponse(c, http.StatusBadRequest, "Failed to read request body", nil)
+			c.Abort()
+			return
+		}
+		c.Request.Body = io.NopCloser(bytes.NewReader(body))
+		requestHash := utils.HashToken(c.Request.Method + " " + c.Request.URL.Path + "\n" + string(body))
+
+		ctx := c.Request.Context()
+		record, created, err := store.Begin(ctx, c.GetUint("user_id"), key, requestHash)
+		if err != nil {
+			utils.SendInternalServerErrorResponse(c, "Failed to process Idempotency-Key")
+			c.Abort()
+			return
+		}
+
+		if !created {
+			switch {
+			case record.RequestHash != requestHash:
+				utils.SendErrorResponse(c, http.StatusUnprocessableEntity, "Idempotency-Key was already used for a different request", nil)
+			case !record.IsCompleted():
+				utils.SendErrorResponse(c, http.StatusConflict, "A request with this Idempotency-Key is still being processed", nil)
+			default:
+				c.Header("Idempotent-Replayed", "true")
+				c.Data(record.StatusCode, "application/json; charset=utf-8", []byte(record.ResponseBody))
+			}
+			c.Abort()
+			return
+		}
+
+		writer := &responseRecorder{ResponseWriter: c.Writer}
+		c.Writer = writer
+		completed := false
+		defer func() {
+			// A handler that panicked or failed on the server side may succeed when retried
+			if !completed {
+				_ = store.Release(context.Background(), record)
+			}
+		}()
+
+		c.Next()
+
+		if status := writer.Status(); status < http.StatusInternalServerError {
+			if err := store.Complete(ctx, record, status, writer.body.Bytes()); err == nil {
+				completed = true
+			}
+		}
+	}
+}
+
+// responseRecorder keeps a copy of the response body while writing it to the client
+type responseRecorder struct {
+	gin.ResponseWriter
+	body bytes.Buffer
+}
+
+func (w *responseRecorder) Write(data []byte) (int, error) {
+	w.body.Write(data)
+	return w.ResponseWriter.Write(data)
+}
+
+func (w *responseRecorder) WriteString(s string) (int, error) {
+	w.body.WriteString(s)
+	return w.ResponseWriter.WriteString(s)
+}
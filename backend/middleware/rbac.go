@@ -0,0 +1,91 @@
+package middleware
+
+import (
+	"net/http"
+
+	"mobile-backend/models"
+	"mobile-backend/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+// RequireRole allows the request if the authenticated user holds any of the given roles.
+// Superadmins are always allowed. Must be used after AuthMiddleware.
+func RequireRole(roles ...string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userRoles := c.GetStringSlice("user_roles")
+		if containsString(userRoles, models.RoleSuperAdmin) {
+			c.Next()
+			return
+		}
+
+		for _, role := range roles {
+			if containsString(userRoles, role) {
+				c.Next()
+				return
+			}
+		}
+
+		utils.SendErrorResponse(c, http.StatusForbidden, "Insufficient role", map[string]interface{}{
+			"required_roles": roles,
+		})
+		c.Abort()
+	}
+}
+
+// RequirePermission allows the request only if the authenticated user holds all of the
+// given permissions. Superadmins are always allowed. Must be used after AuthMiddleware.
+func RequirePermission(permissions ...string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if containsString(c.GetStringSlice("user_roles"), models.RoleSuperAdmin) {
+			c.Next()
+			return
+		}
+
+		userPermissions := c.GetStringSlice("user_permissions")
+		for _, permission := range permissions {
+			if !containsString(userPermissions, permission) {
+				utils.SendErrorResponse(c, http.StatusForbidden, "Insufficient permissions", map[string]interface{}{
+					"required_permissions": permissions,
+				})
+				c.Abort()
+				return
+			}
+		}
+
+		c.Next()
+	}
+}
+
+// RequireAnyPermission allows the request if the authenticated user holds at least one
+// of the given permissions. Superadmins are always allowed. Must be used after AuthMiddleware.
+func RequireAnyPermission(permissions ...string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if containsString(c.GetStringSlice("user_roles"), models.RoleSuperAdmin) {
+			c.Next()
+			return
+		}
+
+		userPermissions := c.GetStringSlice("user_permissions")
+		for _, permission := range permissions {
+			if containsString(userPermissions, permission) {
+				c.Next()
+				return
+			}
+		}
+
+		utils.SendErrorResponse(c, http.StatusForbidden, "Insufficient permissions", map[string]interface{}{
+			"required_permissions": permissions,
+		})
+		c.Abort()
+	}
+}
+
+func containsString(values []string, target string) bool {
+	for _, value := range values {
+		if value == target {
+			return true
+		}
+	}
+	return false
+}
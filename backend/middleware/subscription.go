@@ -8,6 +8,7 @@ import (
 	"go.uber.org/zap"
 	"gorm.io/gorm"
 
+	"mobile-backend/config"
 	"mobile-backend/models"
 	"mobile-backend/utils"
 )
@@ -52,6 +53,15 @@ func (sm *SubscriptionMiddleware) RequireProSubscription() gin.HandlerFunc {
 			return
 		}
 
+		// Pro features can be gated behind a verified email address
+		if config.RequireVerifiedEmailForPro() && !user.IsEmailVerified() {
+			utils.SendErrorResponse(c, http.StatusForbidden, "Email verification required", map[string]interface{}{
+				"email_verified": false,
+			})
+			c.Abort()
+			return
+		}
+
 		// Check if user has pro access
 		if !user.IsProUser() {
 			utils.SendErrorResponse(c, http.StatusForbidden, "Pro subscription required", map[string]interface{}{
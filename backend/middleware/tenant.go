@@ -0,0 +1,144 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"sync"
+
+	"mobile-backend/models"
+	"mobile-backend/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+// OrganizationHeader selects the organization a request acts on
+const OrganizationHeader = "X-Organization-ID"
+
+// MembershipResolver looks up a user's membership in an organization. It returns an
+// error when the user is not a member.
+type MembershipResolver interface {
+	GetMembership(ctx context.Context, organizationID, userID uint) (*models.OrganizationMembership, error)
+}
+
+var (
+	membershipResolverMu sync.RWMutex
+	membershipResolver   MembershipResolver
+)
+
+// SetMembershipResolver installs the resolver used by the tenant middlewares. Until one
+// is installed, every organization is refused.
+func SetMembershipResolver(resolver MembershipResolver) {
+	membershipResolverMu.Lock()
+	membershipResolver = resolver
+	membershipResolverMu.Unlock()
+}
+
+// TenantMiddleware resolves the organization a request acts on from the X-Organization-ID
+// header, falling back to the organization of an org-bound API key and then to the org_id
+// token claim. The user must be a member. The organization is attached to the request
+// context, so tenant-owned queries made with db.WithContext(c.Request.Context()) only see
+// its rows. Must be used after AuthMiddleware or AuthOrAPIKeyMiddleware.
+func TenantMiddleware() gin.HandlerFunc {
+	return tenantMiddleware(true)
+}
+
+// OptionalTenantMiddleware resolves the organization like TenantMiddleware but lets
+// requests that don't name one through without an organization, for routes that serve
+// both personal and organization data. Tenant-owned queries of such requests fail with
+// models.ErrTenantRequired.
+func OptionalTenantMiddleware() gin.HandlerFunc {
+	return tenantMiddleware(false)
+}
+
+func tenantMiddleware(required bool) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var organizationID uint
+		if header := c.GetHeader(OrganizationHeader); header != "" {
+			id, err := strconv.ParseUint(header, 10, 32)
+			if err != nil || id == 0 {
+				utils.SendErrorResponse(c, http.StatusBadRequest, "Invalid "+OrganizationHeader+" header", nil)
+				c.Abort()
+				return
+			}
+			organizationID = uint(id)
+		} else if keyOrganizationID := c.GetUint("api_key_organization_id"); keyOrganizationID != 0 {
+			organizationID = keyOrganizationID
+		} else {
+			organizationID = c.GetUint("token_organization_id")
+		}
+
+		if organizationID == 0 && !required {
+			c.Next()
+			return
+		}
+		if organizationID == 0 {
+			utils.SendErrorResponse(c, http.StatusBadRequest, "Organization required", map[string]interface{}{
+				"header": OrganizationHeader,
+			})
+			c.Abort()
+			return
+		}
+		setTenant(c, organizationID)
+	}
+}
+
+// TenantFromParamMiddleware resolves the organization from a path parameter, for routes
+// that manage the organization itself. Must be used after AuthMiddleware.
+func TenantFromParamMiddleware(param string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, err := strconv.ParseUint(c.Param(param), 10, 32)
+		if err != nil || id == 0 {
+			utils.SendErrorResponse(c, http.StatusBadRequest, "Invalid organization ID", nil)
+			c.Abort()
+			return
+		}
+		setTenant(c, uint(id))
+	}
+}
+
+// RequireOrganizationRole allows the request only if the user holds one of the given roles
+// in the current organization. Must be used after a tenant middleware.
+func RequireOrganizationRole(roles ...string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !containsString(roles, c.GetString("organization_role")) {
+			utils.SendErrorResponse(c, http.StatusForbidden, "Insufficient organization role", map[string]interface{}{
+				"required_roles": roles,
+			})
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
+
+func setTenant(c *gin.Context, organizationID uint) {
+	// A key bound to an organization can't be pointed at another one
+	if keyOrganizationID := c.GetUint("api_key_organization_id"); keyOrganizationID != 0 && keyOrganizationID != organizationID {
+		utils.SendErrorResponse(c, http.StatusForbidden, "API key is not valid for this organization", nil)
+		c.Abort()
+		return
+	}
+
+	membershipResolverMu.RLock()
+	resolver := membershipResolver
+	membershipResolverMu.RUnlock()
+
+	if resolver == nil {
+		utils.SendErrorResponse(c, http.StatusForbidden, "Not a member of this organization", nil)
+		c.Abort()
+		return
+	}
+
+	membership, err := resolver.GetMembership(c.Request.Context(), organizationID, c.GetUint("user_id"))
+	if err != nil || membership == nil {
+		utils.SendErrorResponse(c, http.StatusForbidden, "Not a member of this organization", nil)
+		c.Abort()
+		return
+	}
+
+	c.Set("organization_id", organizationID)
+	c.Set("organization_role", membership.Role)
+	c.Request = c.Request.WithContext(models.WithOrganization(c.Request.Context(), organizationID))
+	c.Next()
+}
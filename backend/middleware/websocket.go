@@ -4,8 +4,9 @@ import (
 	"net/http"
 	"strings"
 
+	"mobile-backend/utils"
+
 	"github.com/gin-gonic/gin"
-	"github.com/golang-jwt/jwt/v5"
 	"go.uber.org/zap"
 )
 
@@ -31,8 +32,8 @@ func WebSocketAuthMiddleware(logger *zap.Logger) gin.HandlerFunc {
 			return
 		}
 
-		// Verify JWT token
-		claims, err := verifyJWTToken(token)
+		// Verify JWT token with the same verifier as the HTTP auth middleware
+		claims, err := utils.ValidateToken(token)
 		if err != nil {
 			logger.Warn("Invalid WebSocket token", zap.Error(err))
 			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid authentication token"})
@@ -40,66 +41,43 @@ func WebSocketAuthMiddleware(logger *zap.Logger) gin.HandlerFunc {
 			return
 		}
 
-		// Extract user ID from claims
-		userID, ok := claims["user_id"].(float64)
-		if !ok {
-			logger.Warn("Invalid user ID in WebSocket token")
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid user ID in token"})
+		revoked, err := isTokenRevoked(c.Request.Context(), claims)
+		if err != nil {
+			logger.Error("Failed to check WebSocket token revocation", zap.Error(err))
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to verify authentication token"})
+			c.Abort()
+			return
+		}
+		if revoked {
+			logger.Warn("Revoked WebSocket token", zap.Uint("user_id", claims.UserID))
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid authentication token"})
+			c.Abort()
+			return
+		}
+
+		active, err := isUserActive(c.Request.Context(), claims.UserID)
+		if err != nil {
+			logger.Error("Failed to check WebSocket user status", zap.Error(err))
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to verify account status"})
+			c.Abort()
+			return
+		}
+		if !active {
+			logger.Warn("WebSocket token of deactivated user", zap.Uint("user_id", claims.UserID))
+			c.JSON(http.StatusForbidden, gin.H{"error": "Account is deactivated"})
 			c.Abort()
 			return
 		}
 
 		// Set user ID in context
-		c.Set("user_id", uint(userID))
+		c.Set("user_id", claims.UserID)
 		c.Set("user_claims", claims)
 
-		logger.Info("WebSocket authentication successful", zap.Uint("user_id", uint(userID)))
+		logger.Info("WebSocket authentication successful", zap.Uint("user_id", claims.UserID))
 		c.Next()
 	}
 }
 
-// verifyJWTToken verifies a JWT token and returns the claims
-func verifyJWTToken(tokenString string) (jwt.MapClaims, error) {
-	// Get JWT secret from environment
-	jwtSecret := getJWTSecret()
-	if jwtSecret == "" {
-		return nil, jwt.ErrSignatureInvalid
-	}
-
-	// Parse and verify token
-	token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
-		// Validate signing method
-		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-			return nil, jwt.ErrSignatureInvalid
-		}
-		return []byte(jwtSecret), nil
-	})
-
-	if err != nil {
-		return nil, err
-	}
-
-	// Check if token is valid
-	if !token.Valid {
-		return nil, jwt.ErrSignatureInvalid
-	}
-
-	// Extract claims
-	claims, ok := token.Claims.(jwt.MapClaims)
-	if !ok {
-		return nil, jwt.ErrSignatureInvalid
-	}
-
-	return claims, nil
-}
-
-// getJWTSecret retrieves JWT secret from environment
-func getJWTSecret() string {
-	// This should match your JWT secret configuration
-	// You might want to use a config service instead
-	return "your_super_secret_jwt_key_change_this_in_production" // This should come from environment
-}
-
 // WebSocketCORSMiddleware handles CORS for WebSocket connections
 func WebSocketCORSMiddleware() gin.HandlerFunc {
 	return func(c *gin.Context) {
@@ -0,0 +1,40 @@
+-- Migration: Create sessions table for refresh token rotation
+-- Description: Each session is a refresh token family; token holds the hash of the current refresh token ID
+-- Version: 008
+
+CREATE TABLE IF NOT EXISTS sessions (
+    id SERIAL PRIMARY KEY,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    family_id VARCHAR(64) NOT NULL,
+    token TEXT NOT NULL,
+    expires_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    is_active BOOLEAN DEFAULT TRUE,
+    user_agent TEXT,
+    ip_address TEXT,
+    device_id VARCHAR(255),
+    device_name VARCHAR(255),
+    last_used_at TIMESTAMP WITH TIME ZONE,
+    revoked_at TIMESTAMP WITH TIME ZONE,
+    revoked_reason VARCHAR(50),
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    deleted_at TIMESTAMP WITH TIME ZONE
+);
+
+-- Databases created through AutoMigrate already have the original columns
+ALTER TABLE sessions ADD COLUMN IF NOT EXISTS family_id VARCHAR(64);
+ALTER TABLE sessions ADD COLUMN IF NOT EXISTS device_id VARCHAR(255);
+ALTER TABLE sessions ADD COLUMN IF NOT EXISTS device_name VARCHAR(255);
+ALTER TABLE sessions ADD COLUMN IF NOT EXISTS last_used_at TIMESTAMP WITH TIME ZONE;
+ALTER TABLE sessions ADD COLUMN IF NOT EXISTS revoked_at TIMESTAMP WITH TIME ZONE;
+ALTER TABLE sessions ADD COLUMN IF NOT EXISTS revoked_reason VARCHAR(50);
+
+-- Sessions created before rotation was introduced cannot be rotated; retire them
+UPDATE sessions SET family_id = 'legacy-' || id, is_active = FALSE, revoked_reason = 'legacy' WHERE family_id IS NULL;
+ALTER TABLE sessions ALTER COLUMN family_id SET NOT NULL;
+
+CREATE INDEX IF NOT EXISTS idx_sessions_user_id ON sessions(user_id);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_sessions_family_id ON sessions(family_id);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_sessions_token ON sessions(token);
+CREATE INDEX IF NOT EXISTS idx_sessions_device_id ON sessions(device_id);
+CREATE INDEX IF NOT EXISTS idx_sessions_deleted_at ON sessions(deleted_at);
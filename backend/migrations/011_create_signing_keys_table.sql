@@ -0,0 +1,21 @@
+-- Migration: Create JWT signing keys table
+-- Description: Asymmetric JWT signing keys shared by all instances and published via /.well-known/jwks.json
+-- Version: 011
+
+CREATE TABLE IF NOT EXISTS signing_keys (
+    id SERIAL PRIMARY KEY,
+    kid VARCHAR(64) NOT NULL,
+    algorithm VARCHAR(20) NOT NULL,
+    private_key TEXT NOT NULL,
+    encrypted BOOLEAN DEFAULT FALSE,
+    activates_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    expires_at TIMESTAMP WITH TIME ZONE,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    deleted_at TIMESTAMP WITH TIME ZONE
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_signing_keys_kid ON signing_keys(kid);
+CREATE INDEX IF NOT EXISTS idx_signing_keys_activates_at ON signing_keys(activates_at);
+CREATE INDEX IF NOT EXISTS idx_signing_keys_expires_at ON signing_keys(expires_at);
+CREATE INDEX IF NOT EXISTS idx_signing_keys_deleted_at ON signing_keys(deleted_at);
@@ -0,0 +1,11 @@
+-- Migration: Add users:manage permission
+-- Description: Lets admins act on other users' accounts, such as revoking all of their tokens
+-- Version: 012
+
+INSERT INTO permissions (name) VALUES ('users:manage')
+ON CONFLICT (name) DO NOTHING;
+
+INSERT INTO role_permissions (role_id, permission_id)
+SELECT r.id, p.id FROM roles r, permissions p
+WHERE r.name = 'admin' AND p.name = 'users:manage'
+ON CONFLICT DO NOTHING;
@@ -0,0 +1,44 @@
+-- Migration: Create OAuth provider and identity tables
+-- Description: Database-configured identity providers and provider identities linked to users
+-- Version: 013
+
+CREATE TABLE IF NOT EXISTS oauth_providers (
+    id SERIAL PRIMARY KEY,
+    name VARCHAR(50) NOT NULL,
+    display_name VARCHAR(100),
+    type VARCHAR(20) NOT NULL DEFAULT 'oidc',
+    client_id TEXT NOT NULL,
+    client_secret TEXT,
+    redirect_url TEXT,
+    issuer_url TEXT,
+    auth_url TEXT,
+    token_url TEXT,
+    user_info_url TEXT,
+    scopes TEXT,
+    enabled BOOLEAN DEFAULT TRUE,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    deleted_at TIMESTAMP WITH TIME ZONE
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_oauth_providers_name ON oauth_providers(name);
+CREATE INDEX IF NOT EXISTS idx_oauth_providers_deleted_at ON oauth_providers(deleted_at);
+
+CREATE TABLE IF NOT EXISTS user_identities (
+    id SERIAL PRIMARY KEY,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    provider VARCHAR(50) NOT NULL,
+    subject VARCHAR(255) NOT NULL,
+    email TEXT,
+    last_login_at TIMESTAMP WITH TIME ZONE,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    deleted_at TIMESTAMP WITH TIME ZONE
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_user_identities_provider_subject ON user_identities(provider, subject);
+CREATE INDEX IF NOT EXISTS idx_user_identities_user_id ON user_identities(user_id);
+CREATE INDEX IF NOT EXISTS idx_user_identities_deleted_at ON user_identities(deleted_at);
+
+COMMENT ON TABLE oauth_providers IS 'Identity providers configured in the database; rows override env providers with the same name';
+COMMENT ON TABLE user_identities IS 'Provider identities linked to users; each provider subject belongs to one user';
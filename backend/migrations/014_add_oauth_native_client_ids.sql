@@ -0,0 +1,7 @@
+-- Migration: Add native client IDs to OAuth providers
+-- Description: Extra id_token audiences accepted when native apps exchange a platform SDK id_token
+-- Version: 014
+
+ALTER TABLE oauth_providers ADD COLUMN IF NOT EXISTS native_client_ids TEXT;
+
+COMMENT ON COLUMN oauth_providers.native_client_ids IS 'Space separated audiences, e.g. iOS bundle IDs or Android client IDs, accepted by the id_token exchange';
@@ -0,0 +1,29 @@
+-- Migration: Create API keys table
+-- Description: Hashed API keys for server-to-server clients, scoped to route groups
+-- Version: 015
+
+CREATE TABLE IF NOT EXISTS api_keys (
+    id SERIAL PRIMARY KEY,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    organization_id INTEGER,
+    name VARCHAR(100) NOT NULL,
+    prefix VARCHAR(32) NOT NULL,
+    key_hash VARCHAR(64) NOT NULL,
+    scopes TEXT,
+    expires_at TIMESTAMP WITH TIME ZONE,
+    last_used_at TIMESTAMP WITH TIME ZONE,
+    last_used_ip VARCHAR(64),
+    revoked_at TIMESTAMP WITH TIME ZONE,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    deleted_at TIMESTAMP WITH TIME ZONE
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_api_keys_prefix ON api_keys(prefix);
+CREATE INDEX IF NOT EXISTS idx_api_keys_user_id ON api_keys(user_id);
+CREATE INDEX IF NOT EXISTS idx_api_keys_organization_id ON api_keys(organization_id);
+CREATE INDEX IF NOT EXISTS idx_api_keys_deleted_at ON api_keys(deleted_at);
+
+COMMENT ON TABLE api_keys IS 'API keys for server-to-server clients; only the SHA-256 of each key is stored';
+COMMENT ON COLUMN api_keys.prefix IS 'Public mbk_<id> part of the key used for lookup and display';
+COMMENT ON COLUMN api_keys.scopes IS 'Space separated route group scopes: profile, uploads, sync';
@@ -0,0 +1,7 @@
+-- Migration: Add account lockout to users
+-- Description: Password logins are refused until locked_until after repeated failed attempts
+-- Version: 016
+
+ALTER TABLE users ADD COLUMN IF NOT EXISTS locked_until TIMESTAMP WITH TIME ZONE;
+
+COMMENT ON COLUMN users.locked_until IS 'Password logins are locked out until this time after repeated failures; cleared by an admin unlock';
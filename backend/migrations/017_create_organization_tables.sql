@@ -0,0 +1,86 @@
+-- Migration: Create organization tables and tenant columns
+-- Description: Organizations with per-org roles and invitations; products, orders, categories and notification segments become tenant-owned
+-- Version: 017
+
+CREATE TABLE IF NOT EXISTS organizations (
+    id SERIAL PRIMARY KEY,
+    name VARCHAR(255) NOT NULL,
+    slug VARCHAR(100) NOT NULL,
+    created_by INTEGER NOT NULL REFERENCES users(id),
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    deleted_at TIMESTAMP WITH TIME ZONE
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_organizations_slug ON organizations(slug);
+CREATE INDEX IF NOT EXISTS idx_organizations_created_by ON organizations(created_by);
+CREATE INDEX IF NOT EXISTS idx_organizations_deleted_at ON organizations(deleted_at);
+
+CREATE TABLE IF NOT EXISTS organization_memberships (
+    id SERIAL PRIMARY KEY,
+    organization_id INTEGER NOT NULL REFERENCES organizations(id) ON DELETE CASCADE,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    role VARCHAR(20) NOT NULL DEFAULT 'member',
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    deleted_at TIMESTAMP WITH TIME ZONE
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_organization_memberships_org_user ON organization_memberships(organization_id, user_id);
+CREATE INDEX IF NOT EXISTS idx_organization_memberships_user_id ON organization_memberships(user_id);
+CREATE INDEX IF NOT EXISTS idx_organization_memberships_deleted_at ON organization_memberships(deleted_at);
+
+CREATE TABLE IF NOT EXISTS organization_invitations (
+    id SERIAL PRIMARY KEY,
+    organization_id INTEGER NOT NULL REFERENCES organizations(id) ON DELETE CASCADE,
+    email VARCHAR(255) NOT NULL,
+    role VARCHAR(20) NOT NULL,
+    token_hash VARCHAR(64) NOT NULL,
+    invited_by INTEGER NOT NULL REFERENCES users(id),
+    expires_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    accepted_at TIMESTAMP WITH TIME ZONE,
+    revoked_at TIMESTAMP WITH TIME ZONE,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    deleted_at TIMESTAMP WITH TIME ZONE
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_organization_invitations_token_hash ON organization_invitations(token_hash);
+CREATE INDEX IF NOT EXISTS idx_organization_invitations_organization_id ON organization_invitations(organization_id);
+CREATE INDEX IF NOT EXISTS idx_organization_invitations_email ON organization_invitations(email);
+CREATE INDEX IF NOT EXISTS idx_organization_invitations_deleted_at ON organization_invitations(deleted_at);
+
+-- Tenant-owned tables; rows without an organization belong to no tenant
+ALTER TABLE products ADD COLUMN IF NOT EXISTS organization_id INTEGER REFERENCES organizations(id);
+CREATE INDEX IF NOT EXISTS idx_products_organization_id ON products(organization_id);
+
+-- Segments, orders and categories may not exist yet when they are only created by AutoMigrate
+DO $$
+BEGIN
+    IF to_regclass('notification_segments') IS NOT NULL THEN
+        ALTER TABLE notification_segments ADD COLUMN IF NOT EXISTS organization_id INTEGER REFERENCES organizations(id);
+        DROP INDEX IF EXISTS idx_notification_segments_name;
+        CREATE UNIQUE INDEX IF NOT EXISTS idx_notification_segments_org_name ON notification_segments(organization_id, name);
+    END IF;
+
+    IF to_regclass('orders') IS NOT NULL THEN
+        ALTER TABLE orders ADD COLUMN IF NOT EXISTS organization_id INTEGER REFERENCES organizations(id);
+        DROP INDEX IF EXISTS idx_orders_order_number;
+        CREATE UNIQUE INDEX IF NOT EXISTS idx_orders_org_order_number ON orders(organization_id, order_number);
+    END IF;
+
+    IF to_regclass('categories') IS NOT NULL THEN
+        ALTER TABLE categories ADD COLUMN IF NOT EXISTS organization_id INTEGER REFERENCES organizations(id);
+        DROP INDEX IF EXISTS idx_categories_name;
+        DROP INDEX IF EXISTS idx_categories_slug;
+        CREATE UNIQUE INDEX IF NOT EXISTS idx_categories_org_name ON categories(organization_id, name);
+        CREATE UNIQUE INDEX IF NOT EXISTS idx_categories_org_slug ON categories(organization_id, slug);
+    END IF;
+END $$;
+
+-- Active organization of a login session, embedded in its access tokens as org_id
+ALTER TABLE sessions ADD COLUMN IF NOT EXISTS organization_id INTEGER REFERENCES organizations(id) ON DELETE SET NULL;
+
+COMMENT ON TABLE organizations IS 'Teams of users sharing tenant-owned data';
+COMMENT ON COLUMN organization_memberships.role IS 'Per-organization role: owner, admin or member';
+COMMENT ON COLUMN organization_invitations.token_hash IS 'SHA-256 of the emailed invitation token';
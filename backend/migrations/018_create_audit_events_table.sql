@@ -0,0 +1,56 @@
+-- Migration: Create audit events table
+-- Description: Append-only, hash-chained log of security- and billing-relevant actions, plus the audit:read permission
+-- Version: 018
+
+CREATE TABLE IF NOT EXISTS audit_events (
+    id SERIAL PRIMARY KEY,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    actor_id INTEGER,
+    actor_type VARCHAR(20) NOT NULL,
+    actor_email VARCHAR(255),
+    action VARCHAR(100) NOT NULL,
+    resource_type VARCHAR(50),
+    resource_id VARCHAR(100),
+    organization_id INTEGER,
+    before JSONB,
+    after JSONB,
+    metadata JSONB,
+    ip_address VARCHAR(64),
+    user_agent TEXT,
+    request_id VARCHAR(64),
+    prev_hash VARCHAR(64) NOT NULL,
+    hash VARCHAR(64) NOT NULL
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_audit_events_hash ON audit_events(hash);
+CREATE INDEX IF NOT EXISTS idx_audit_events_created_at ON audit_events(created_at);
+CREATE INDEX IF NOT EXISTS idx_audit_events_actor_id ON audit_events(actor_id);
+CREATE INDEX IF NOT EXISTS idx_audit_events_action ON audit_events(action);
+CREATE INDEX IF NOT EXISTS idx_audit_events_resource ON audit_events(resource_type, resource_id);
+CREATE INDEX IF NOT EXISTS idx_audit_events_organization_id ON audit_events(organization_id);
+CREATE INDEX IF NOT EXISTS idx_audit_events_request_id ON audit_events(request_id);
+
+-- Rows can only be appended; the hash chain detects changes made by anyone who bypasses this
+CREATE OR REPLACE FUNCTION audit_events_append_only() RETURNS TRIGGER AS $$
+BEGIN
+    RAISE EXCEPTION 'audit_events is append-only';
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS audit_events_append_only ON audit_events;
+CREATE TRIGGER audit_events_append_only
+    BEFORE UPDATE OR DELETE OR TRUNCATE ON audit_events
+    FOR EACH STATEMENT EXECUTE FUNCTION audit_events_append_only();
+
+COMMENT ON TABLE audit_events IS 'Append-only audit log; each hash covers the event and the previous event''s hash';
+COMMENT ON COLUMN audit_events.actor_id IS 'User who acted, kept after the user is deleted';
+COMMENT ON COLUMN audit_events.before IS 'Changed fields before the action';
+COMMENT ON COLUMN audit_events.after IS 'Changed fields after the action';
+
+INSERT INTO permissions (name) VALUES ('audit:read')
+ON CONFLICT (name) DO NOTHING;
+
+INSERT INTO role_permissions (role_id, permission_id)
+SELECT r.id, p.id FROM roles r, permissions p
+WHERE r.name = 'admin' AND p.name = 'audit:read'
+ON CONFLICT DO NOTHING;
@@ -0,0 +1,26 @@
+-- Migration: Create data requests table
+-- Description: Tracks personal data export and account erasure requests and their status
+-- Version: 019
+
+CREATE TABLE IF NOT EXISTS data_requests (
+    id SERIAL PRIMARY KEY,
+    user_id INTEGER NOT NULL,
+    type VARCHAR(20) NOT NULL,
+    status VARCHAR(20) NOT NULL DEFAULT 'pending',
+    scheduled_for TIMESTAMP WITH TIME ZONE,
+    started_at TIMESTAMP WITH TIME ZONE,
+    completed_at TIMESTAMP WITH TIME ZONE,
+    cancelled_at TIMESTAMP WITH TIME ZONE,
+    file_path VARCHAR(500),
+    file_size BIGINT,
+    expires_at TIMESTAMP WITH TIME ZONE,
+    error TEXT,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    deleted_at TIMESTAMP WITH TIME ZONE
+);
+
+-- user_id has no foreign key: erasure requests must outlive the data they removed
+CREATE INDEX IF NOT EXISTS idx_data_requests_user_id ON data_requests(user_id);
+CREATE INDEX IF NOT EXISTS idx_data_requests_status ON data_requests(status);
+CREATE INDEX IF NOT EXISTS idx_data_requests_deleted_at ON data_requests(deleted_at);
@@ -0,0 +1,11 @@
+-- Migration: Add users:impersonate permission
+-- Description: Lets admins sign in as another user through a short-lived impersonation token
+-- Version: 020
+
+INSERT INTO permissions (name) VALUES ('users:impersonate')
+ON CONFLICT (name) DO NOTHING;
+
+INSERT INTO role_permissions (role_id, permission_id)
+SELECT r.id, p.id FROM roles r, permissions p
+WHERE r.name = 'admin' AND p.name = 'users:impersonate'
+ON CONFLICT DO NOTHING;
@@ -0,0 +1,17 @@
+-- Migration: Create password history table
+-- Description: Adds password_changed_at to users and keeps replaced password hashes so recent passwords can't be reused
+-- Version: 021
+
+ALTER TABLE users ADD COLUMN IF NOT EXISTS password_changed_at TIMESTAMP WITH TIME ZONE;
+
+CREATE TABLE IF NOT EXISTS password_histories (
+    id SERIAL PRIMARY KEY,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    password_hash VARCHAR(255) NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_password_histories_user_id ON password_histories(user_id);
+
+COMMENT ON COLUMN users.password_changed_at IS 'When the password was last set, for the maximum password age';
+COMMENT ON TABLE password_histories IS 'Hashes of replaced passwords, pruned to the configured history size';
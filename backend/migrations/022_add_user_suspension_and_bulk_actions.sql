@@ -0,0 +1,34 @@
+-- Migration: Add user suspension and bulk user actions
+-- Description: Adds suspension and forced password reset columns to users and creates the bulk_user_actions table for admin jobs
+-- Version: 022
+
+ALTER TABLE users ADD COLUMN IF NOT EXISTS password_reset_required BOOLEAN DEFAULT FALSE;
+ALTER TABLE users ADD COLUMN IF NOT EXISTS suspended_at TIMESTAMP WITH TIME ZONE;
+ALTER TABLE users ADD COLUMN IF NOT EXISTS suspension_reason VARCHAR(500);
+
+CREATE TABLE IF NOT EXISTS bulk_user_actions (
+    id SERIAL PRIMARY KEY,
+    actor_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    action VARCHAR(50) NOT NULL,
+    reason VARCHAR(500),
+    status VARCHAR(20) NOT NULL DEFAULT 'pending',
+    user_ids JSONB NOT NULL,
+    results JSONB,
+    succeeded INTEGER DEFAULT 0,
+    failed INTEGER DEFAULT 0,
+    started_at TIMESTAMP WITH TIME ZONE,
+    completed_at TIMESTAMP WITH TIME ZONE,
+    error TEXT,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    deleted_at TIMESTAMP WITH TIME ZONE
+);
+
+CREATE INDEX IF NOT EXISTS idx_bulk_user_actions_actor_id ON bulk_user_actions(actor_id);
+CREATE INDEX IF NOT EXISTS idx_bulk_user_actions_status ON bulk_user_actions(status);
+CREATE INDEX IF NOT EXISTS idx_bulk_user_actions_deleted_at ON bulk_user_actions(deleted_at);
+CREATE INDEX IF NOT EXISTS idx_users_suspended_at ON users(suspended_at);
+
+COMMENT ON COLUMN users.password_reset_required IS 'Set by an administrator to refuse password logins until the password is reset';
+COMMENT ON COLUMN users.suspended_at IS 'When an administrator suspended the account; NULL when active';
+COMMENT ON TABLE bulk_user_actions IS 'Administrator actions on many users, applied by a background job with per-user results';
@@ -0,0 +1,33 @@
+-- Migration: Create user devices table
+-- Description: Creates the per-user device registry and links sessions to the device they were started on
+-- Version: 023
+
+CREATE TABLE IF NOT EXISTS user_devices (
+    id SERIAL PRIMARY KEY,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    fingerprint VARCHAR(64) NOT NULL,
+    device_id VARCHAR(255),
+    name VARCHAR(255),
+    platform VARCHAR(20) NOT NULL DEFAULT 'unknown',
+    app_version VARCHAR(50),
+    os_version VARCHAR(50),
+    user_agent TEXT,
+    first_seen_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    last_seen_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    last_ip VARCHAR(64),
+    trusted_at TIMESTAMP WITH TIME ZONE,
+    revoked_at TIMESTAMP WITH TIME ZONE,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    deleted_at TIMESTAMP WITH TIME ZONE
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_user_devices_user_fingerprint ON user_devices(user_id, fingerprint);
+CREATE INDEX IF NOT EXISTS idx_user_devices_device_id ON user_devices(device_id);
+CREATE INDEX IF NOT EXISTS idx_user_devices_deleted_at ON user_devices(deleted_at);
+
+ALTER TABLE sessions ADD COLUMN IF NOT EXISTS user_device_id INTEGER;
+CREATE INDEX IF NOT EXISTS idx_sessions_user_device_id ON sessions(user_device_id);
+
+COMMENT ON TABLE user_devices IS 'Devices each user has signed in from, recognised by a hash of the client device ID or user agent';
+COMMENT ON COLUMN user_devices.revoked_at IS 'When the user signed the device out; the next login from it counts as a new device';
@@ -0,0 +1,12 @@
+-- Migration: Add guest accounts
+-- Description: Adds the guest flag and device binding to users for anonymous sign in
+-- Version: 024
+
+ALTER TABLE users ADD COLUMN IF NOT EXISTS is_guest BOOLEAN DEFAULT FALSE;
+ALTER TABLE users ADD COLUMN IF NOT EXISTS guest_device_hash VARCHAR(64);
+
+CREATE INDEX IF NOT EXISTS idx_users_is_guest ON users(is_guest);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_users_guest_device_hash ON users(guest_device_hash);
+
+COMMENT ON COLUMN users.is_guest IS 'Anonymous account created by guest sign in; cleared when the guest upgrades to a full account';
+COMMENT ON COLUMN users.guest_device_hash IS 'SHA-256 of the device ID a guest is bound to; NULL for full accounts';
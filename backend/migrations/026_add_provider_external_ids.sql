@@ -0,0 +1,17 @@
+-- Migration: Add generic payment provider IDs
+-- Description: Adds external ID columns for providers without dedicated columns and lifts the fixed provider lists
+-- Version: 026
+
+ALTER TABLE payments ADD COLUMN IF NOT EXISTS provider_payment_id VARCHAR(255);
+ALTER TABLE subscriptions ADD COLUMN IF NOT EXISTS provider_subscription_id VARCHAR(255);
+
+CREATE INDEX IF NOT EXISTS idx_payments_provider_payment_id ON payments(provider_payment_id);
+CREATE INDEX IF NOT EXISTS idx_subscriptions_provider_subscription_id ON subscriptions(provider_subscription_id);
+
+-- Providers are registered in code, so the columns naming them accept any registered name
+ALTER TABLE payments DROP CONSTRAINT IF EXISTS payments_payment_method_check;
+ALTER TABLE subscriptions DROP CONSTRAINT IF EXISTS subscriptions_payment_method_check;
+ALTER TABLE webhook_events DROP CONSTRAINT IF EXISTS webhook_events_provider_check;
+
+COMMENT ON COLUMN payments.provider_payment_id IS 'Payment ID at providers without a dedicated column, such as the fake provider';
+COMMENT ON COLUMN subscriptions.provider_subscription_id IS 'Subscription ID at providers without a dedicated column, such as the fake provider';
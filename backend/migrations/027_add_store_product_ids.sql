@@ -0,0 +1,14 @@
+-- Migration: Add app store product IDs to plans
+-- Description: Links plans to App Store and Google Play subscription products for in-app purchases
+-- Version: 027
+
+ALTER TABLE plans ADD COLUMN IF NOT EXISTS app_store_product_id VARCHAR(255);
+ALTER TABLE plans ADD COLUMN IF NOT EXISTS google_play_product_id VARCHAR(255);
+
+CREATE INDEX IF NOT EXISTS idx_plans_app_store_product_id ON plans(app_store_product_id);
+CREATE INDEX IF NOT EXISTS idx_plans_google_play_product_id ON plans(google_play_product_id);
+
+COMMENT ON COLUMN plans.app_store_product_id IS 'Product ID of the auto-renewable subscription in App Store Connect';
+COMMENT ON COLUMN plans.google_play_product_id IS 'Product ID of the subscription in the Google Play Console';
+COMMENT ON COLUMN subscriptions.provider_subscription_id IS 'Subscription ID at providers without a dedicated column: the Apple original transaction ID or the Google Play purchase token';
+COMMENT ON COLUMN payments.provider_payment_id IS 'Payment ID at providers without a dedicated column: the Apple transaction ID or the Google Play order ID';
@@ -0,0 +1,13 @@
+-- Migration: Add scheduled plan changes to subscriptions
+-- Description: Records downgrades that take effect at the end of the current billing period
+-- Version: 028
+
+ALTER TABLE subscriptions ADD COLUMN IF NOT EXISTS scheduled_plan_id INTEGER REFERENCES plans(id) ON DELETE SET NULL;
+ALTER TABLE subscriptions ADD COLUMN IF NOT EXISTS scheduled_quantity INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE subscriptions ADD COLUMN IF NOT EXISTS scheduled_change_at TIMESTAMP WITH TIME ZONE;
+
+CREATE INDEX IF NOT EXISTS idx_subscriptions_scheduled_change_at ON subscriptions(scheduled_change_at) WHERE scheduled_change_at IS NOT NULL;
+
+COMMENT ON COLUMN subscriptions.scheduled_plan_id IS 'Plan the subscription moves to at scheduled_change_at';
+COMMENT ON COLUMN subscriptions.scheduled_quantity IS 'Quantity the subscription moves to at scheduled_change_at, 0 to keep the current one';
+COMMENT ON COLUMN subscriptions.scheduled_change_at IS 'End of the billing period when the scheduled plan change takes effect';
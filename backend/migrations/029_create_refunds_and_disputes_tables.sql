@@ -0,0 +1,60 @@
+-- Migration: Create refunds and disputes tables
+-- Description: Records refunds issued by admins or providers and chargebacks opened by banks
+-- Version: 029
+
+CREATE TABLE IF NOT EXISTS refunds (
+    id SERIAL PRIMARY KEY,
+    payment_id INTEGER NOT NULL REFERENCES payments(id) ON DELETE CASCADE,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    amount INTEGER NOT NULL CHECK (amount > 0),
+    currency VARCHAR(3) NOT NULL,
+    status VARCHAR(20) NOT NULL DEFAULT 'pending' CHECK (status IN ('pending', 'succeeded', 'failed', 'canceled')),
+    reason VARCHAR(50),
+    payment_method VARCHAR(50) NOT NULL,
+    provider_refund_id VARCHAR(255),
+    requested_by INTEGER REFERENCES users(id) ON DELETE SET NULL,
+    revoke_access BOOLEAN DEFAULT FALSE,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    deleted_at TIMESTAMP WITH TIME ZONE
+);
+
+CREATE INDEX IF NOT EXISTS idx_refunds_payment_id ON refunds(payment_id);
+CREATE INDEX IF NOT EXISTS idx_refunds_user_id ON refunds(user_id);
+CREATE INDEX IF NOT EXISTS idx_refunds_provider_refund_id ON refunds(provider_refund_id);
+CREATE INDEX IF NOT EXISTS idx_refunds_deleted_at ON refunds(deleted_at);
+
+CREATE TABLE IF NOT EXISTS disputes (
+    id SERIAL PRIMARY KEY,
+    payment_id INTEGER NOT NULL REFERENCES payments(id) ON DELETE CASCADE,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    amount INTEGER NOT NULL,
+    currency VARCHAR(3) NOT NULL,
+    status VARCHAR(30) NOT NULL,
+    reason VARCHAR(50),
+    payment_method VARCHAR(50) NOT NULL,
+    provider_dispute_id VARCHAR(255) NOT NULL,
+    evidence_due_by TIMESTAMP WITH TIME ZONE,
+    closed_at TIMESTAMP WITH TIME ZONE,
+    access_revoked BOOLEAN DEFAULT FALSE,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    deleted_at TIMESTAMP WITH TIME ZONE
+);
+
+CREATE INDEX IF NOT EXISTS idx_disputes_payment_id ON disputes(payment_id);
+CREATE INDEX IF NOT EXISTS idx_disputes_user_id ON disputes(user_id);
+CREATE INDEX IF NOT EXISTS idx_disputes_status ON disputes(status);
+CREATE INDEX IF NOT EXISTS idx_disputes_provider_dispute_id ON disputes(provider_dispute_id);
+CREATE INDEX IF NOT EXISTS idx_disputes_deleted_at ON disputes(deleted_at);
+
+-- Payments with an open or lost chargeback are marked disputed
+ALTER TABLE payments DROP CONSTRAINT IF EXISTS payments_status_check;
+ALTER TABLE payments ADD CONSTRAINT payments_status_check
+    CHECK (status IN ('pending', 'succeeded', 'failed', 'canceled', 'refunded', 'partially_refunded', 'disputed'));
+
+COMMENT ON TABLE refunds IS 'Refunds issued through the admin API or reported by payment provider webhooks';
+COMMENT ON COLUMN refunds.requested_by IS 'Admin who issued the refund; NULL for refunds made at the provider';
+COMMENT ON COLUMN refunds.revoke_access IS 'Whether the user loses pro access when the refund goes through';
+COMMENT ON TABLE disputes IS 'Chargebacks and inquiries opened by the customer''s bank';
+COMMENT ON COLUMN disputes.access_revoked IS 'Whether the user lost pro access while the dispute is open';
@@ -0,0 +1,28 @@
+-- Migration: Create subscription dunnings table
+-- Description: Tracks the grace period and reminders of subscriptions whose payment failed
+-- Version: 030
+
+CREATE TABLE IF NOT EXISTS subscription_dunnings (
+    id SERIAL PRIMARY KEY,
+    subscription_id INTEGER NOT NULL REFERENCES subscriptions(id) ON DELETE CASCADE,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    state VARCHAR(20) NOT NULL DEFAULT 'grace' CHECK (state IN ('grace', 'final_notice', 'downgraded', 'recovered', 'canceled')),
+    started_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    grace_ends_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    reminders_sent INTEGER DEFAULT 0,
+    last_reminder_at TIMESTAMP WITH TIME ZONE,
+    next_reminder_at TIMESTAMP WITH TIME ZONE,
+    downgraded_at TIMESTAMP WITH TIME ZONE,
+    resolved_at TIMESTAMP WITH TIME ZONE,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    deleted_at TIMESTAMP WITH TIME ZONE
+);
+
+CREATE INDEX IF NOT EXISTS idx_subscription_dunnings_subscription_id ON subscription_dunnings(subscription_id);
+CREATE INDEX IF NOT EXISTS idx_subscription_dunnings_user_id ON subscription_dunnings(user_id);
+CREATE INDEX IF NOT EXISTS idx_subscription_dunnings_state ON subscription_dunnings(state);
+CREATE INDEX IF NOT EXISTS idx_subscription_dunnings_deleted_at ON subscription_dunnings(deleted_at);
+
+-- A subscription has at most one unresolved dunning
+CREATE UNIQUE INDEX IF NOT EXISTS idx_subscription_dunnings_open ON subscription_dunnings(subscription_id) WHERE resolved_at IS NULL;
@@ -0,0 +1,8 @@
+-- Migration: Make provider subscription IDs unique
+-- Description: Stops concurrent verifications of the same store purchase from creating two subscriptions
+-- Version: 031
+
+-- Subscriptions at providers with a dedicated ID column leave provider_subscription_id empty
+CREATE UNIQUE INDEX IF NOT EXISTS idx_subscriptions_provider_subscription
+    ON subscriptions(payment_method, provider_subscription_id)
+    WHERE provider_subscription_id <> '' AND deleted_at IS NULL;
@@ -0,0 +1,7 @@
+-- Migration: Add guest secrets
+-- Description: Requires the secret issued at guest creation to sign in as an existing guest
+-- Version: 032
+
+ALTER TABLE users ADD COLUMN IF NOT EXISTS guest_secret_hash VARCHAR(64);
+
+COMMENT ON COLUMN users.guest_secret_hash IS 'SHA-256 of the secret the guest''s device presents to sign in again; guests created before it keep their session through refresh tokens only';
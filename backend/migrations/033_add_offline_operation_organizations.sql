@@ -0,0 +1,7 @@
+-- Migration: Add offline operation organizations
+-- Description: Records the organization an offline operation was queued in, so sync writes to tenant-owned tables stay in it
+-- Version: 033
+
+ALTER TABLE offline_operations ADD COLUMN IF NOT EXISTS organization_id INTEGER REFERENCES organizations(id) ON DELETE CASCADE;
+
+CREATE INDEX IF NOT EXISTS idx_offline_operations_organization_id ON offline_operations(organization_id);
@@ -0,0 +1,57 @@
+package models
+
+import (
+	"strings"
+	"time"
+)
+
+// API key scopes. Each scope opens one route group to key-authenticated requests.
+const (
+	APIKeyScopeProfile = "profile"
+	APIKeyScopeUploads = "uploads"
+	APIKeyScopeSync    = "sync"
+)
+
+// APIKeyScopes lists every scope a key can be granted
+var APIKeyScopes = []string{APIKeyScopeProfile, APIKeyScopeUploads, APIKeyScopeSync}
+
+// APIKey is a long-lived credential for server-to-server clients. Only the hash of the
+// key is stored; the prefix identifies the key in listings and logs.
+type APIKey struct {
+	BaseModel
+	UserID         uint       `json:"user_id" gorm:"not null;index"`
+	OrganizationID *uint      `json:"organization_id,omitempty" gorm:"index"`
+	Name           string     `json:"name" gorm:"size:100;not null"`
+	Prefix         string     `json:"prefix" gorm:"size:32;uniqueIndex;not null"`
+	KeyHash        string     `json:"-" gorm:"size:64;not null"`
+	Scopes         string     `json:"-" gorm:"type:text"` // space separated
+	ExpiresAt      *time.Time `json:"expires_at,omitempty"`
+	LastUsedAt     *time.Time `json:"last_used_at,omitempty"`
+	LastUsedIP     string     `json:"last_used_ip,omitempty" gorm:"size:64"`
+	RevokedAt      *time.Time `json:"revoked_at,omitempty"`
+
+	User User `json:"-" gorm:"foreignKey:UserID"`
+}
+
+// ScopeList returns the scopes granted to the key
+func (k *APIKey) ScopeList() []string {
+	return strings.Fields(k.Scopes)
+}
+
+// HasScope reports whether the key was granted the scope
+func (k *APIKey) HasScope(scope string) bool {
+	for _, s := range k.ScopeList() {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// IsUsable reports whether the key is neither revoked nor expired
+func (k *APIKey) IsUsable() bool {
+	if k.RevokedAt != nil {
+		return false
+	}
+	return k.ExpiresAt == nil || time.Now().Before(*k.ExpiresAt)
+}
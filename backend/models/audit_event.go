@@ -0,0 +1,157 @@
+package models
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Audit actor types
+const (
+	AuditActorUser      = "user"
+	AuditActorAPIKey    = "api_key"
+	AuditActorAnonymous = "anonymous"
+	AuditActorSystem    = "system"
+)
+
+// Audited actions
+const (
+	AuditActionRegister              = "auth.register"
+	AuditActionLogin                 = "auth.login"
+	AuditActionLoginFailed           = "auth.login_failed"
+	AuditActionLogout                = "auth.logout"
+	AuditActionLogoutAll             = "auth.logout_all"
+	AuditActionPasswordReset         = "auth.password_reset"
+	AuditActionPasswordChanged       = "auth.password_changed"
+	AuditActionEmailVerified         = "auth.email_verified"
+	AuditActionSessionRevoked        = "auth.session_revoked"
+	AuditActionSessionsRevoked       = "auth.sessions_revoked"
+	AuditActionTokensRevoked         = "auth.tokens_revoked"
+	AuditActionAccountUnlocked       = "auth.account_unlocked"
+	AuditActionMFAEnabled            = "auth.mfa_enabled"
+	AuditActionMFADisabled           = "auth.mfa_disabled"
+	AuditActionRecoveryCodesReset    = "auth.mfa_recovery_codes_regenerated"
+	AuditActionImpersonationStarted  = "auth.impersonation_started"
+	AuditActionImpersonationStopped  = "auth.impersonation_stopped"
+	AuditActionGuestCreated          = "auth.guest_created"
+	AuditActionGuestUpgraded         = "auth.guest_upgraded"
+	AuditActionUserSuspended         = "user.suspended"
+	AuditActionUserReactivated       = "user.reactivated"
+	AuditActionPasswordResetForced   = "user.password_reset_forced"
+	AuditActionBulkUserAction        = "user.bulk_action_queued"
+	AuditActionDeviceRenamed         = "device.renamed"
+	AuditActionDeviceTrusted         = "device.trusted"
+	AuditActionDeviceUntrusted       = "device.untrusted"
+	AuditActionDeviceRevoked         = "device.revoked"
+	AuditActionProfileUpdated        = "profile.updated"
+	AuditActionProfileDeleted        = "profile.deleted"
+	AuditActionRoleAssigned          = "role.assigned"
+	AuditActionRoleRevoked           = "role.revoked"
+	AuditActionSubscriptionCreated   = "subscription.created"
+	AuditActionSubscriptionCancelled = "subscription.cancelled"
+	AuditActionSubscriptionChanged   = "subscription.changed"
+	AuditActionPaymentCreated        = "payment.created"
+	AuditActionCheckoutCreated       = "payment.checkout_created"
+	AuditActionPaymentRefunded       = "payment.refunded"
+	AuditActionCacheCleared          = "cache.cleared"
+	AuditActionCacheInvalidated      = "cache.invalidated"
+	AuditActionDataExportRequested   = "privacy.export_requested"
+	AuditActionErasureRequested      = "privacy.erasure_requested"
+	AuditActionErasureCancelled      = "privacy.erasure_cancelled"
+	AuditActionAccountErased         = "privacy.account_erased"
+)
+
+// ErrAuditEventImmutable is returned when something tries to change a recorded audit event
+var ErrAuditEventImmutable = errors.New("audit events are append-only")
+
+// AuditEvent is an append-only record of a security- or billing-relevant action. Each
+// event's Hash covers its content and the previous event's hash, so editing or removing
+// a row breaks the chain from that point on.
+type AuditEvent struct {
+	ID             uint      `json:"id" gorm:"primaryKey"`
+	CreatedAt      time.Time `json:"created_at" gorm:"not null;index"`
+	ActorID        *uint     `json:"actor_id,omitempty" gorm:"index"`
+	ActorType      string    `json:"actor_type" gorm:"not null;size:20"`
+	ActorEmail     string    `json:"actor_email,omitempty" gorm:"size:255"`
+	Action         string    `json:"action" gorm:"not null;size:100;index"`
+	ResourceType   string    `json:"resource_type,omitempty" gorm:"size:50;index:idx_audit_events_resource"`
+	ResourceID     string    `json:"resource_id,omitempty" gorm:"size:100;index:idx_audit_events_resource"`
+	OrganizationID *uint     `json:"organization_id,omitempty" gorm:"index"`
+	Before         JSONMap   `json:"before,omitempty" gorm:"type:jsonb"`
+	After          JSONMap   `json:"after,omitempty" gorm:"type:jsonb"`
+	Metadata       JSONMap   `json:"metadata,omitempty" gorm:"type:jsonb"`
+	IPAddress      string    `json:"ip_address,omitempty" gorm:"size:64"`
+	UserAgent      string    `json:"user_agent,omitempty"`
+	RequestID      string    `json:"request_id,omitempty" gorm:"size:64;index"`
+	PrevHash       string    `json:"prev_hash" gorm:"not null;size:64"`
+	Hash           string    `json:"hash" gorm:"not null;size:64;uniqueIndex"`
+}
+
+// BeforeUpdate refuses to modify recorded events
+func (e *AuditEvent) BeforeUpdate(tx *gorm.DB) error {
+	return ErrAuditEventImmutable
+}
+
+// BeforeDelete refuses to remove recorded events
+func (e *AuditEvent) BeforeDelete(tx *gorm.DB) error {
+	return ErrAuditEventImmutable
+}
+
+// ComputeHash returns the SHA-256 over the event's content and PrevHash
+func (e *AuditEvent) ComputeHash() (string, error) {
+	// Fixed field order; maps are encoded with sorted keys
+	payload, err := json.Marshal([]interface{}{
+		e.PrevHash,
+		e.CreatedAt.UTC().Format(time.RFC3339Nano),
+		e.ActorID,
+		e.ActorType,
+		e.ActorEmail,
+		e.Action,
+		e.ResourceType,
+		e.ResourceID,
+		e.OrganizationID,
+		e.Before,
+		e.After,
+		e.Metadata,
+		e.IPAddress,
+		e.UserAgent,
+		e.RequestID,
+	})
+	if err != nil {
+		return "", err
+	}
+
+	sum := sha256.Sum256(payload)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// AuditDiff reduces before and after to the keys whose values differ, so events only
+// carry what changed
+func AuditDiff(before, after map[string]interface{}) (JSONMap, JSONMap) {
+	changedBefore, changedAfter := JSONMap{}, JSONMap{}
+	for key, oldValue := range before {
+		newValue, ok := after[key]
+		if !ok || !jsonEqual(oldValue, newValue) {
+			changedBefore[key] = oldValue
+			if ok {
+				changedAfter[key] = newValue
+			}
+		}
+	}
+	for key, newValue := range after {
+		if _, ok := before[key]; !ok {
+			changedAfter[key] = newValue
+		}
+	}
+	return changedBefore, changedAfter
+}
+
+func jsonEqual(a, b interface{}) bool {
+	aJSON, errA := json.Marshal(a)
+	bJSON, errB := json.Marshal(b)
+	return errA == nil && errB == nil && string(aJSON) == string(bJSON)
+}
@@ -0,0 +1,41 @@
+package models
+
+import (
+	"time"
+)
+
+// Bulk user actions an administrator can run
+const (
+	BulkUserActionSuspend            = "suspend"
+	BulkUserActionReactivate         = "reactivate"
+	BulkUserActionForcePasswordReset = "force_password_reset"
+	BulkUserActionRevokeSessions     = "revoke_sessions"
+)
+
+// Bulk user action statuses
+const (
+	BulkUserActionPending    = "pending"
+	BulkUserActionProcessing = "processing"
+	BulkUserActionCompleted  = "completed"
+	BulkUserActionFailed     = "failed"
+)
+
+// BulkUserActionResultOK marks a user the action was applied to in Results
+const BulkUserActionResultOK = "ok"
+
+// BulkUserAction tracks an administrator's action on many users, which runs as a
+// background job. Results maps each user ID to "ok" or the reason it failed.
+type BulkUserAction struct {
+	BaseModel
+	ActorID     uint       `json:"actor_id" gorm:"not null;index"`
+	Action      string     `json:"action" gorm:"not null;size:50"`
+	Reason      string     `json:"reason,omitempty" gorm:"size:500"`
+	Status      string     `json:"status" gorm:"not null;size:20;default:'pending';index"`
+	UserIDs     []uint     `json:"user_ids" gorm:"serializer:json;type:text;not null"`
+	Results     JSONMap    `json:"results,omitempty" gorm:"type:jsonb"`
+	Succeeded   int        `json:"succeeded"`
+	Failed      int        `json:"failed"`
+	StartedAt   *time.Time `json:"started_at,omitempty"`
+	CompletedAt *time.Time `json:"completed_at,omitempty"`
+	Error       string     `json:"error,omitempty" gorm:"type:text"`
+}
@@ -11,10 +11,11 @@ type Category struct {
 	CreatedAt time.Time      `json:"created_at"`
 	UpdatedAt time.Time      `json:"updated_at"`
 	DeletedAt gorm.DeletedAt `json:"-" gorm:"index"`
+	OrganizationID *uint `json:"organization_id,omitempty" gorm:"uniqueIndex:idx_categories_org_name;uniqueIndex:idx_categories_org_slug"` // Owning organization
 	
-	Name string `json:"name" gorm:"not null;uniqueIndex"` // Category name
+	Name string `json:"name" gorm:"not null;uniqueIndex:idx_categories_org_name"` // Category name, unique within the organization
 	Description string `json:"description" gorm:"type:text"` // Category description
-	Slug string `json:"slug" gorm:"not null;uniqueIndex"` // URL-friendly category identifier
+	Slug string `json:"slug" gorm:"not null;uniqueIndex:idx_categories_org_slug"` // URL-friendly category identifier, unique within the organization
 	ParentID *uint `json:"parent_id,omitempty" gorm:"index"` // Parent category ID for hierarchical structure
 	IsActive bool `json:"is_active" gorm:"default:true"` // Whether the category is active
 	SortOrder int `json:"sort_order" gorm:"default:0"` // Sort order for display
@@ -0,0 +1,49 @@
+package models
+
+import (
+	"time"
+)
+
+// Data request types
+const (
+	DataRequestExport  = "export"
+	DataRequestErasure = "erasure"
+)
+
+// Data request statuses
+const (
+	DataRequestPending    = "pending"
+	DataRequestProcessing = "processing"
+	DataRequestCompleted  = "completed"
+	DataRequestFailed     = "failed"
+	DataRequestCancelled  = "cancelled"
+)
+
+// DataRequest tracks a user's request to export or erase their personal data. Exports
+// are processed right away; erasures wait until ScheduledFor so they can be cancelled.
+type DataRequest struct {
+	BaseModel
+	UserID       uint       `json:"user_id" gorm:"not null;index"`
+	Type         string     `json:"type" gorm:"not null;size:20"`
+	Status       string     `json:"status" gorm:"not null;size:20;default:'pending';index"`
+	ScheduledFor *time.Time `json:"scheduled_for,omitempty"`
+	StartedAt    *time.Time `json:"started_at,omitempty"`
+	CompletedAt  *time.Time `json:"completed_at,omitempty"`
+	CancelledAt  *time.Time `json:"cancelled_at,omitempty"`
+	// FilePath is where a finished export archive is stored until ExpiresAt
+	FilePath  string     `json:"-" gorm:"size:500"`
+	FileSize  int64      `json:"file_size,omitempty"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+	Error     string     `json:"error,omitempty" gorm:"type:text"`
+}
+
+// IsOpen reports whether the request has not yet finished, failed or been cancelled
+func (r *DataRequest) IsOpen() bool {
+	return r.Status == DataRequestPending || r.Status == DataRequestProcessing
+}
+
+// IsDownloadable reports whether the request is a finished export that has not expired
+func (r *DataRequest) IsDownloadable() bool {
+	return r.Type == DataRequestExport && r.Status == DataRequestCompleted &&
+		r.FilePath != "" && r.ExpiresAt != nil && time.Now().Before(*r.ExpiresAt)
+}
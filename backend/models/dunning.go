@@ -0,0 +1,45 @@
+package models
+
+import (
+	"time"
+)
+
+// Dunning states. A subscription whose payment fails starts in grace and keeps pro
+// access while reminders go out; the last reminder moves it to final_notice. When the
+// grace period runs out it is downgraded. A payment that goes through recovers it at any
+// point, and a subscription that ends cancels it.
+const (
+	DunningStateGrace       = "grace"
+	DunningStateFinalNotice = "final_notice"
+	DunningStateDowngraded  = "downgraded"
+	DunningStateRecovered   = "recovered"
+	DunningStateCanceled    = "canceled"
+)
+
+// SubscriptionDunning tracks one period of failed payments of a subscription, from the
+// first failure until the subscription recovers or ends
+type SubscriptionDunning struct {
+	BaseModel
+	SubscriptionID uint      `json:"subscription_id" gorm:"not null;index"`
+	UserID         uint      `json:"user_id" gorm:"not null;index"`
+	State          string    `json:"state" gorm:"not null;default:'grace';index" validate:"oneof=grace final_notice downgraded recovered canceled"`
+	StartedAt      time.Time `json:"started_at" gorm:"not null"`
+	GraceEndsAt    time.Time `json:"grace_ends_at" gorm:"not null"`
+	// RemindersSent is also the step of the next reminder in the dunning schedule
+	RemindersSent  int        `json:"reminders_sent" gorm:"default:0"`
+	LastReminderAt *time.Time `json:"last_reminder_at,omitempty"`
+	NextReminderAt *time.Time `json:"next_reminder_at,omitempty"`
+	DowngradedAt   *time.Time `json:"downgraded_at,omitempty"`
+	// ResolvedAt is set once the subscription recovers or ends
+	ResolvedAt *time.Time `json:"resolved_at,omitempty"`
+}
+
+// IsOpen reports whether the subscription is still past due
+func (d *SubscriptionDunning) IsOpen() bool {
+	return d.ResolvedAt == nil
+}
+
+// HasAccess reports whether the user keeps pro access at t
+func (d *SubscriptionDunning) HasAccess(t time.Time) bool {
+	return (d.State == DunningStateGrace || d.State == DunningStateFinalNotice) && t.Before(d.GraceEndsAt)
+}
@@ -0,0 +1,25 @@
+package models
+
+import (
+	"time"
+)
+
+// IdempotencyKey remembers the response to a request sent with an Idempotency-Key header
+// so that a retried request gets the original response instead of being run again. Keys
+// are scoped to the user; StatusCode stays zero while the first request is in flight.
+type IdempotencyKey struct {
+	ID           uint       `json:"id" gorm:"primaryKey"`
+	CreatedAt    time.Time  `json:"created_at"`
+	UserID       uint       `json:"user_id" gorm:"not null;uniqueIndex:idx_idempotency_keys_user_key"`
+	Key          string     `json:"key" gorm:"size:255;not null;uniqueIndex:idx_idempotency_keys_user_key"`
+	RequestHash  string     `json:"-" gorm:"size:64;not null"`
+	StatusCode   int        `json:"status_code"`
+	ResponseBody string     `json:"-" gorm:"type:text"`
+	CompletedAt  *time.Time `json:"completed_at,omitempty"`
+	ExpiresAt    time.Time  `json:"expires_at" gorm:"not null;index"`
+}
+
+// IsCompleted reports whether the original request has finished and its response was stored
+func (k *IdempotencyKey) IsCompleted() bool {
+	return k.CompletedAt != nil
+}
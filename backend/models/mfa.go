@@ -0,0 +1,33 @@
+package models
+
+import (
+	"time"
+)
+
+// UserMFA holds a user's TOTP enrollment. A row with Enabled=false is a pending
+// enrollment that becomes active once the user confirms a code from their app.
+type UserMFA struct {
+	BaseModel
+	UserID    uint       `json:"user_id" gorm:"not null;uniqueIndex"`
+	Secret    string     `json:"-" gorm:"size:64;not null"`
+	Enabled   bool       `json:"enabled" gorm:"default:false"`
+	EnabledAt *time.Time `json:"enabled_at,omitempty"`
+	// LastUsedStep is the TOTP time step of the last accepted code, used to reject replays
+	LastUsedStep int64 `json:"-" gorm:"default:0"`
+
+	User User `json:"-" gorm:"foreignKey:UserID"`
+}
+
+// TableName returns the table name for UserMFA
+func (UserMFA) TableName() string {
+	return "user_mfa"
+}
+
+// MFARecoveryCode is a single-use backup code for users who lost their authenticator.
+// Only the hash of the code is stored.
+type MFARecoveryCode struct {
+	BaseModel
+	UserID   uint       `json:"user_id" gorm:"not null;index"`
+	CodeHash string     `json:"-" gorm:"size:64;not null;index"`
+	UsedAt   *time.Time `json:"used_at,omitempty"`
+}
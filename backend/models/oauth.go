@@ -0,0 +1,46 @@
+package models
+
+import (
+	"time"
+)
+
+// OAuth provider types
+const (
+	OAuthProviderTypeOAuth2 = "oauth2" // plain OAuth2 with a userinfo endpoint, e.g. GitHub
+	OAuthProviderTypeOIDC   = "oidc"   // OpenID Connect with discovery and id_token validation
+	OAuthProviderTypeApple  = "apple"  // Sign in with Apple: OIDC with a signed client secret and form_post callbacks
+)
+
+// OAuthProvider is an identity provider configured in the database, typically a
+// customer's own OIDC IdP. Rows override env-configured providers of the same name.
+type OAuthProvider struct {
+	BaseModel
+	Name         string `json:"name" gorm:"size:50;uniqueIndex;not null"`
+	DisplayName  string `json:"display_name" gorm:"size:100"`
+	Type         string `json:"type" gorm:"size:20;not null;default:'oidc'"`
+	ClientID     string `json:"client_id" gorm:"not null"`
+	ClientSecret string `json:"-" gorm:"type:text"`
+	RedirectURL  string `json:"redirect_url"`
+	IssuerURL    string `json:"issuer_url"`
+	AuthURL      string `json:"auth_url,omitempty"`
+	TokenURL     string `json:"token_url,omitempty"`
+	UserInfoURL  string `json:"userinfo_url,omitempty"`
+	Scopes       string `json:"scopes,omitempty"` // space separated
+	// NativeClientIDs are extra id_token audiences accepted from native SDKs, such as
+	// iOS bundle IDs or Android client IDs (space separated)
+	NativeClientIDs string `json:"native_client_ids,omitempty" gorm:"type:text"`
+	Enabled         bool   `json:"enabled" gorm:"default:true"`
+}
+
+// UserIdentity links an account at an external provider to a user. A user can have
+// several identities, and each provider subject belongs to exactly one user.
+type UserIdentity struct {
+	BaseModel
+	UserID      uint       `json:"user_id" gorm:"not null;index"`
+	Provider    string     `json:"provider" gorm:"size:50;not null;uniqueIndex:idx_user_identities_provider_subject"`
+	Subject     string     `json:"-" gorm:"size:255;not null;uniqueIndex:idx_user_identities_provider_subject"`
+	Email       string     `json:"email,omitempty"`
+	LastLoginAt *time.Time `json:"last_login_at,omitempty"`
+
+	User User `json:"-" gorm:"foreignKey:UserID"`
+}
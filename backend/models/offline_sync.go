@@ -20,6 +20,9 @@ type OfflineOperation struct {
 	MaxRetries    int        `json:"max_retries" gorm:"default:3"`
 	ErrorMessage  string     `json:"error_message"`
 	ProcessedAt   *time.Time `json:"processed_at"`
+	// OrganizationID is the organization the operation was queued in; its writes to
+	// tenant-owned tables are confined to that organization
+	OrganizationID *uint `json:"organization_id,omitempty" gorm:"index"`
 
 	// Relationships
 	User *User `json:"user,omitempty" gorm:"foreignKey:UserID"`
@@ -11,8 +11,9 @@ type Order struct {
 	CreatedAt time.Time      `json:"created_at"`
 	UpdatedAt time.Time      `json:"updated_at"`
 	DeletedAt gorm.DeletedAt `json:"-" gorm:"index"`
+	OrganizationID *uint `json:"organization_id,omitempty" gorm:"uniqueIndex:idx_orders_org_order_number"` // Owning organization
 	
-	OrderNumber string `json:"order_number" gorm:"not null;uniqueIndex"` // Unique order number
+	OrderNumber string `json:"order_number" gorm:"not null;uniqueIndex:idx_orders_org_order_number"` // Unique order number within the organization
 	CustomerID uint `json:"customer_id" gorm:"not null;index"` // Customer ID
 	TotalAmount float64 `json:"total_amount" gorm:"type:decimal(10,2);not null"` // Total order amount
 	Status string `json:"status" gorm:"not null;default:'pending'"` // Order status
@@ -0,0 +1,75 @@
+package models
+
+import (
+	"time"
+)
+
+// Organization roles, from most to least privileged
+const (
+	OrganizationRoleOwner  = "owner"
+	OrganizationRoleAdmin  = "admin"
+	OrganizationRoleMember = "member"
+)
+
+// OrganizationRoles lists the roles a membership can hold
+var OrganizationRoles = []string{OrganizationRoleOwner, OrganizationRoleAdmin, OrganizationRoleMember}
+
+// IsValidOrganizationRole reports whether role is a known organization role
+func IsValidOrganizationRole(role string) bool {
+	for _, r := range OrganizationRoles {
+		if r == role {
+			return true
+		}
+	}
+	return false
+}
+
+// Organization is a team of users sharing tenant-owned data such as products and orders
+type Organization struct {
+	BaseModel
+	Name      string `json:"name" gorm:"not null;size:255"`
+	Slug      string `json:"slug" gorm:"not null;size:100;uniqueIndex"`
+	CreatedBy uint   `json:"created_by" gorm:"not null;index"`
+
+	// Relationships
+	Memberships []OrganizationMembership `json:"memberships,omitempty" gorm:"foreignKey:OrganizationID"`
+}
+
+// OrganizationMembership grants a user a role within an organization
+type OrganizationMembership struct {
+	BaseModel
+	OrganizationID uint   `json:"organization_id" gorm:"not null;uniqueIndex:idx_organization_memberships_org_user"`
+	UserID         uint   `json:"user_id" gorm:"not null;uniqueIndex:idx_organization_memberships_org_user;index"`
+	Role           string `json:"role" gorm:"not null;size:20;default:'member'"`
+
+	// Relationships
+	Organization *Organization `json:"organization,omitempty" gorm:"foreignKey:OrganizationID"`
+	User         *User         `json:"user,omitempty" gorm:"foreignKey:UserID"`
+}
+
+// CanManage reports whether the member may manage the organization's members and invitations
+func (m *OrganizationMembership) CanManage() bool {
+	return m.Role == OrganizationRoleOwner || m.Role == OrganizationRoleAdmin
+}
+
+// OrganizationInvitation invites an email address to join an organization. Only the hash
+// of the invitation token is stored.
+type OrganizationInvitation struct {
+	BaseModel
+	OrganizationID uint       `json:"organization_id" gorm:"not null;index"`
+	Email          string     `json:"email" gorm:"not null;size:255;index"`
+	Role           string     `json:"role" gorm:"not null;size:20"`
+	TokenHash      string     `json:"-" gorm:"not null;size:64;uniqueIndex"`
+	InvitedBy      uint       `json:"invited_by" gorm:"not null"`
+	ExpiresAt      time.Time  `json:"expires_at" gorm:"not null"`
+	AcceptedAt     *time.Time `json:"accepted_at,omitempty"`
+	RevokedAt      *time.Time `json:"revoked_at,omitempty"`
+
+	// Relationships
+	Organization *Organization `json:"organization,omitempty" gorm:"foreignKey:OrganizationID"`
+}
+
+// IsPending reports whether the invitation can still be accepted
+func (i *OrganizationInvitation) IsPending() bool {
+	return i.AcceptedAt == nil && i.RevokedAt == nil && time.Now().Before(i.ExpiresAt)
+}
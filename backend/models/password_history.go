@@ -0,0 +1,14 @@
+package models
+
+import (
+	"time"
+)
+
+// PasswordHistory keeps the hash of a password the user replaced, so the password
+// policy can refuse reusing it
+type PasswordHistory struct {
+	ID           uint      `json:"id" gorm:"primaryKey"`
+	UserID       uint      `json:"user_id" gorm:"not null;index"`
+	PasswordHash string    `json:"-" gorm:"not null"`
+	CreatedAt    time.Time `json:"created_at"`
+}
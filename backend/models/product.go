@@ -24,6 +24,9 @@ type Product struct {
 	StripeProductID string `json:"stripe_product_id,omitempty"`
 	PolarProductID  string `json:"polar_product_id,omitempty"`
 
+	// Owning organization, nil for products in the global catalog
+	OrganizationID *uint `json:"organization_id,omitempty" gorm:"index"`
+
 	// Relationships
 	Subscriptions []Subscription `json:"subscriptions,omitempty" gorm:"foreignKey:ProductID"`
 	Payments      []Payment      `json:"payments,omitempty" gorm:"foreignKey:ProductID"`
@@ -43,9 +46,12 @@ type Plan struct {
 	TrialDays     int     `json:"trial_days,omitempty"`
 	Metadata      JSONMap `json:"metadata,omitempty" gorm:"type:jsonb"`
 
-	// External IDs for payment providers
-	StripePriceID string `json:"stripe_price_id,omitempty"`
-	PolarPlanID   string `json:"polar_plan_id,omitempty"`
+	// External IDs for payment providers. The store IDs are the product IDs configured in
+	// App Store Connect and the Google Play Console.
+	StripePriceID       string `json:"stripe_price_id,omitempty"`
+	PolarPlanID         string `json:"polar_plan_id,omitempty"`
+	AppStoreProductID   string `json:"app_store_product_id,omitempty" gorm:"index"`
+	GooglePlayProductID string `json:"google_play_product_id,omitempty" gorm:"index"`
 
 	// Relationships
 	Product       Product        `json:"product,omitempty" gorm:"foreignKey:ProductID"`
@@ -68,10 +74,17 @@ type Subscription struct {
 	Quantity           int        `json:"quantity" gorm:"default:1" validate:"min=1"`
 	Metadata           JSONMap    `json:"metadata,omitempty" gorm:"type:jsonb"`
 
-	// External IDs for payment providers
-	StripeSubscriptionID string `json:"stripe_subscription_id,omitempty"`
-	PolarSubscriptionID  string `json:"polar_subscription_id,omitempty"`
-	PaymentMethod        string `json:"payment_method,omitempty"`
+	// A downgrade waiting for the end of the current period
+	ScheduledPlanID   *uint      `json:"scheduled_plan_id,omitempty"`
+	ScheduledQuantity int        `json:"scheduled_quantity,omitempty"`
+	ScheduledChangeAt *time.Time `json:"scheduled_change_at,omitempty" gorm:"index"`
+
+	// External IDs for payment providers. ProviderSubscriptionID holds the ID at
+	// providers without a column of their own, and is unique per provider.
+	StripeSubscriptionID   string `json:"stripe_subscription_id,omitempty"`
+	PolarSubscriptionID    string `json:"polar_subscription_id,omitempty"`
+	ProviderSubscriptionID string `json:"provider_subscription_id,omitempty" gorm:"index;uniqueIndex:idx_subscriptions_provider_subscription,priority:2"`
+	PaymentMethod          string `json:"payment_method,omitempty" gorm:"uniqueIndex:idx_subscriptions_provider_subscription,priority:1,where:provider_subscription_id <> '' AND deleted_at IS NULL"`
 
 	// Relationships
 	User     User      `json:"user,omitempty" gorm:"foreignKey:UserID"`
@@ -88,15 +101,21 @@ type Payment struct {
 	SubscriptionID *uint   `json:"subscription_id,omitempty"`
 	Amount         int64   `json:"amount" gorm:"not null" validate:"min=0"` // Amount in cents
 	Currency       string  `json:"currency" gorm:"not null" validate:"required,len=3"`
-	Status         string  `json:"status" gorm:"not null;default:'pending'" validate:"oneof=pending succeeded failed canceled refunded"`
-	PaymentMethod  string  `json:"payment_method" gorm:"not null" validate:"required,oneof=stripe polar"`
+	Status         string  `json:"status" gorm:"not null;default:'pending'" validate:"oneof=pending succeeded failed canceled refunded partially_refunded disputed"`
+	PaymentMethod  string  `json:"payment_method" gorm:"not null" validate:"required"`
 	Description    string  `json:"description,omitempty"`
 	Metadata       JSONMap `json:"metadata,omitempty" gorm:"type:jsonb"`
 
-	// External IDs for payment providers
+	// Refunds that have gone through, in cents
+	RefundedAmount int64      `json:"refunded_amount" gorm:"default:0"`
+	RefundedAt     *time.Time `json:"refunded_at,omitempty"`
+
+	// External IDs for payment providers. ProviderPaymentID holds the ID at providers
+	// without a column of their own.
 	StripePaymentIntentID string `json:"stripe_payment_intent_id,omitempty"`
 	StripeChargeID        string `json:"stripe_charge_id,omitempty"`
 	PolarPaymentID        string `json:"polar_payment_id,omitempty"`
+	ProviderPaymentID     string `json:"provider_payment_id,omitempty" gorm:"index"`
 
 	// Relationships
 	User         User          `json:"user,omitempty" gorm:"foreignKey:UserID"`
@@ -127,7 +146,7 @@ type PaymentMethod struct {
 // WebhookEvent represents a webhook event from payment providers
 type WebhookEvent struct {
 	BaseModel
-	Provider    string     `json:"provider" gorm:"not null" validate:"required,oneof=stripe polar"`
+	Provider    string     `json:"provider" gorm:"not null" validate:"required"`
 	EventType   string     `json:"event_type" gorm:"not null"`
 	EventID     string     `json:"event_id" gorm:"not null;uniqueIndex"`
 	Processed   bool       `json:"processed" gorm:"default:false"`
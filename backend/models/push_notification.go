@@ -64,12 +64,13 @@ type NotificationTemplate struct {
 // NotificationSegment represents a user segment for targeting
 type NotificationSegment struct {
 	BaseModel
-	Name        string `json:"name" gorm:"not null;uniqueIndex"`
-	Description string `json:"description"`
-	Query       string `json:"query"`      // SQL query or filter criteria
-	UserCount   int    `json:"user_count"` // Cached user count
-	IsActive    bool   `json:"is_active" gorm:"default:true"`
-	CreatedBy   uint   `json:"created_by"`
+	OrganizationID *uint  `json:"organization_id,omitempty" gorm:"uniqueIndex:idx_notification_segments_org_name"`
+	Name           string `json:"name" gorm:"not null;uniqueIndex:idx_notification_segments_org_name"`
+	Description    string `json:"description"`
+	Query          string `json:"query"`      // SQL query or filter criteria
+	UserCount      int    `json:"user_count"` // Cached user count
+	IsActive       bool   `json:"is_active" gorm:"default:true"`
+	CreatedBy      uint   `json:"created_by"`
 
 	// Relationships
 	Creator *User `json:"creator,omitempty" gorm:"foreignKey:CreatedBy"`
@@ -0,0 +1,87 @@
+package models
+
+import (
+	"time"
+)
+
+// Refund statuses
+const (
+	RefundStatusPending   = "pending"
+	RefundStatusSucceeded = "succeeded"
+	RefundStatusFailed    = "failed"
+	RefundStatusCanceled  = "canceled"
+)
+
+// Refund reasons an admin can give. Providers may report others.
+const (
+	RefundReasonDuplicate           = "duplicate"
+	RefundReasonFraudulent          = "fraudulent"
+	RefundReasonRequestedByCustomer = "requested_by_customer"
+)
+
+// Dispute statuses, as reported by Stripe. Disputes starting with warning_ are inquiries
+// that don't withdraw funds yet.
+const (
+	DisputeStatusWarningNeedsResponse = "warning_needs_response"
+	DisputeStatusWarningUnderReview   = "warning_under_review"
+	DisputeStatusWarningClosed        = "warning_closed"
+	DisputeStatusNeedsResponse        = "needs_response"
+	DisputeStatusUnderReview          = "under_review"
+	DisputeStatusWon                  = "won"
+	DisputeStatusLost                 = "lost"
+)
+
+// Refund represents money returned for a payment, either issued by an admin or reported
+// by the payment provider
+type Refund struct {
+	BaseModel
+	PaymentID        uint   `json:"payment_id" gorm:"not null;index"`
+	UserID           uint   `json:"user_id" gorm:"not null;index"`
+	Amount           int64  `json:"amount" gorm:"not null"` // Amount in cents
+	Currency         string `json:"currency" gorm:"not null"`
+	Status           string `json:"status" gorm:"not null;default:'pending'" validate:"oneof=pending succeeded failed canceled"`
+	Reason           string `json:"reason,omitempty"`
+	PaymentMethod    string `json:"payment_method" gorm:"not null"`
+	ProviderRefundID string `json:"provider_refund_id,omitempty" gorm:"index"`
+	// RequestedBy is the admin who issued the refund; nil for refunds made at the provider
+	RequestedBy  *uint `json:"requested_by,omitempty"`
+	RevokeAccess bool  `json:"revoke_access" gorm:"default:false"`
+
+	// Relationships
+	Payment Payment `json:"-" gorm:"foreignKey:PaymentID"`
+}
+
+// Dispute represents a chargeback or inquiry opened by the customer's bank
+type Dispute struct {
+	BaseModel
+	PaymentID         uint       `json:"payment_id" gorm:"not null;index"`
+	UserID            uint       `json:"user_id" gorm:"not null;index"`
+	Amount            int64      `json:"amount" gorm:"not null"` // Amount in cents
+	Currency          string     `json:"currency" gorm:"not null"`
+	Status            string     `json:"status" gorm:"not null;index"`
+	Reason            string     `json:"reason,omitempty"`
+	PaymentMethod     string     `json:"payment_method" gorm:"not null"`
+	ProviderDisputeID string     `json:"provider_dispute_id" gorm:"not null;index"`
+	EvidenceDueBy     *time.Time `json:"evidence_due_by,omitempty"`
+	ClosedAt          *time.Time `json:"closed_at,omitempty"`
+	// AccessRevoked records that the user lost pro access when the dispute was opened
+	AccessRevoked bool `json:"access_revoked" gorm:"default:false"`
+
+	// Relationships
+	Payment Payment `json:"-" gorm:"foreignKey:PaymentID"`
+}
+
+// IsClosed checks if the dispute has been decided
+func (d *Dispute) IsClosed() bool {
+	return d.Status == DisputeStatusWon || d.Status == DisputeStatusLost || d.Status == DisputeStatusWarningClosed
+}
+
+// IsWithdrawn checks if the disputed funds are held back from us: the dispute is a
+// chargeback that is still open or was lost
+func (d *Dispute) IsWithdrawn() bool {
+	switch d.Status {
+	case DisputeStatusNeedsResponse, DisputeStatusUnderReview, DisputeStatusLost:
+		return true
+	}
+	return false
+}
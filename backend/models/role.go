@@ -0,0 +1,95 @@
+package models
+
+import (
+	"time"
+)
+
+// Built-in role names
+const (
+	RoleSuperAdmin = "superadmin"
+	RoleAdmin      = "admin"
+	RoleStaff      = "staff"
+)
+
+// Built-in permission names
+const (
+	PermissionSubscriptionsRead = "subscriptions:read"
+	PermissionProductsManage    = "products:manage"
+	PermissionJobsManage        = "jobs:manage"
+	PermissionGeneratorManage   = "generator:manage"
+	PermissionCacheManage       = "cache:manage"
+	PermissionRolesManage       = "roles:manage"
+	PermissionUsersManage       = "users:manage"
+	PermissionAuditRead         = "audit:read"
+	PermissionUsersImpersonate  = "users:impersonate"
+	PermissionPaymentsRefund    = "payments:refund"
+)
+
+// DefaultRolePermissions maps each built-in role to the permissions it is seeded with.
+// The superadmin role implicitly holds every permission and is not listed here.
+var DefaultRolePermissions = map[string][]string{
+	RoleAdmin: {
+		PermissionSubscriptionsRead,
+		PermissionProductsManage,
+		PermissionJobsManage,
+		PermissionGeneratorManage,
+		PermissionCacheManage,
+		PermissionRolesManage,
+		PermissionUsersManage,
+		PermissionAuditRead,
+		PermissionUsersImpersonate,
+		PermissionPaymentsRefund,
+	},
+	RoleStaff: {
+		PermissionSubscriptionsRead,
+	},
+}
+
+// Role represents a named set of permissions that can be granted to users
+type Role struct {
+	BaseModel
+	Name        string `json:"name" gorm:"uniqueIndex;not null" validate:"required,min=2,max=50"`
+	Description string `json:"description,omitempty"`
+	IsSystem    bool   `json:"is_system" gorm:"default:false"` // Built-in roles cannot be deleted
+
+	// Relationships
+	Permissions []Permission `json:"permissions,omitempty" gorm:"many2many:role_permissions"`
+}
+
+// Permission represents a single capability such as "jobs:manage"
+type Permission struct {
+	BaseModel
+	Name        string `json:"name" gorm:"uniqueIndex;not null" validate:"required,min=2,max=100"`
+	Description string `json:"description,omitempty"`
+}
+
+// UserRole represents the assignment of a role to a user
+type UserRole struct {
+	ID        uint      `json:"id" gorm:"primaryKey"`
+	UserID    uint      `json:"user_id" gorm:"not null;uniqueIndex:idx_user_roles_user_role"`
+	RoleID    uint      `json:"role_id" gorm:"not null;uniqueIndex:idx_user_roles_user_role"`
+	GrantedBy *uint     `json:"granted_by,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+
+	// Relationships
+	User User `json:"-" gorm:"foreignKey:UserID"`
+	Role Role `json:"role,omitempty" gorm:"foreignKey:RoleID"`
+}
+
+// IsSuperAdmin checks if the role is the superadmin role
+func (r *Role) IsSuperAdmin() bool {
+	return r.Name == RoleSuperAdmin
+}
+
+// HasPermission checks if the role grants the given permission
+func (r *Role) HasPermission(name string) bool {
+	if r.IsSuperAdmin() {
+		return true
+	}
+	for _, permission := range r.Permissions {
+		if permission.Name == name {
+			return true
+		}
+	}
+	return false
+}
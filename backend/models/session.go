@@ -4,12 +4,46 @@ import (
 	"time"
 )
 
+// Session revocation reasons
+const (
+	SessionRevokedLogout          = "logout"
+	SessionRevokedByUser          = "revoked_by_user"
+	SessionRevokedTokenReuse      = "refresh_token_reuse"
+	SessionRevokedLogoutAll       = "logout_all"
+	SessionRevokedPasswordReset   = "password_reset"
+	SessionRevokedPasswordChanged = "password_changed"
+	SessionRevokedByAdmin         = "revoked_by_admin"
+	SessionRevokedAccountErased   = "account_erased"
+	SessionRevokedSuspended       = "account_suspended"
+	SessionRevokedResetRequired   = "password_reset_required"
+	SessionRevokedDeviceRevoked   = "device_revoked"
+	SessionRevokedDeviceMismatch  = "guest_device_mismatch"
+)
+
+// Session represents a refresh token family bound to a single device login.
+// Token holds the hash of the only refresh token ID that may currently be used;
+// every refresh rotates it, and presenting an older one revokes the family.
 type Session struct {
 	BaseModel
-	UserID    uint      `json:"user_id" gorm:"not null;index"`
-	Token     string    `json:"token" gorm:"uniqueIndex;not null"`
-	ExpiresAt time.Time `json:"expires_at" gorm:"not null"`
-	IsActive  bool      `json:"is_active" gorm:"default:true"`
-	UserAgent string    `json:"user_agent,omitempty"`
-	IPAddress string    `json:"ip_address,omitempty"`
+	UserID        uint       `json:"user_id" gorm:"not null;index"`
+	FamilyID      string     `json:"-" gorm:"size:64;uniqueIndex;not null"`
+	Token         string     `json:"-" gorm:"uniqueIndex;not null"`
+	ExpiresAt     time.Time  `json:"expires_at" gorm:"not null"`
+	IsActive      bool       `json:"is_active" gorm:"default:true"`
+	UserAgent     string     `json:"user_agent,omitempty"`
+	IPAddress     string     `json:"ip_address,omitempty"`
+	DeviceID      string     `json:"device_id,omitempty" gorm:"size:255;index"`
+	DeviceName    string     `json:"device_name,omitempty" gorm:"size:255"`
+	UserDeviceID  *uint      `json:"user_device_id,omitempty" gorm:"index"`
+	LastUsedAt    *time.Time `json:"last_used_at,omitempty"`
+	RevokedAt     *time.Time `json:"revoked_at,omitempty"`
+	RevokedReason string     `json:"revoked_reason,omitempty" gorm:"size:50"`
+
+	// Active organization embedded in the session's access tokens
+	OrganizationID *uint `json:"organization_id,omitempty"`
+}
+
+// IsValid reports whether the session can still be used to refresh tokens
+func (s *Session) IsValid() bool {
+	return s.IsActive && s.RevokedAt == nil && time.Now().Before(s.ExpiresAt)
 }
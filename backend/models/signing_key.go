@@ -0,0 +1,17 @@
+package models
+
+import (
+	"time"
+)
+
+// SigningKey is a persisted JWT signing key shared by all API instances.
+// PrivateKey holds PKCS#8 PEM, encrypted when JWT_KEY_ENCRYPTION_KEY is set.
+type SigningKey struct {
+	BaseModel
+	KID         string     `json:"kid" gorm:"size:64;uniqueIndex;not null"`
+	Algorithm   string     `json:"algorithm" gorm:"size:20;not null"`
+	PrivateKey  string     `json:"-" gorm:"type:text;not null"`
+	Encrypted   bool       `json:"encrypted" gorm:"default:false"`
+	ActivatesAt time.Time  `json:"activates_at" gorm:"not null;index"`
+	ExpiresAt   *time.Time `json:"expires_at,omitempty" gorm:"index"`
+}
@@ -0,0 +1,158 @@
+package models
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// ErrTenantRequired fails statements on tenant-owned models whose context has neither an
+// organization nor the WithoutTenantScope marker
+var ErrTenantRequired = errors.New("tenant-owned query without an organization")
+
+type (
+	tenantContextKey  struct{}
+	tenantUnscopedKey struct{}
+)
+
+// TenantOwned is implemented by models whose rows belong to an organization. Their
+// queries are filtered to the organization carried by the statement's context, see
+// RegisterTenantScope.
+type TenantOwned interface {
+	tenantOwned()
+}
+
+func (Product) tenantOwned()             {}
+func (Order) tenantOwned()               {}
+func (Category) tenantOwned()            {}
+func (NotificationSegment) tenantOwned() {}
+
+// tenantOwnedModels are the models implementing TenantOwned
+var tenantOwnedModels = []interface{}{&Product{}, &Order{}, &Category{}, &NotificationSegment{}}
+
+// IsTenantOwnedTable reports whether table belongs to a tenant-owned model, for code that
+// names tables itself and so isn't covered by the tenant scope
+func IsTenantOwnedTable(db *gorm.DB, table string) bool {
+	for _, model := range tenantOwnedModels {
+		stmt := &gorm.Statement{DB: db}
+		if err := stmt.Parse(model); err == nil && strings.EqualFold(stmt.Schema.Table, table) {
+			return true
+		}
+	}
+	return false
+}
+
+// WithOrganization returns a context that scopes tenant-owned queries to the organization
+func WithOrganization(ctx context.Context, organizationID uint) context.Context {
+	return context.WithValue(ctx, tenantContextKey{}, organizationID)
+}
+
+// OrganizationFromContext returns the organization set by WithOrganization, if any
+func OrganizationFromContext(ctx context.Context) (uint, bool) {
+	if ctx == nil {
+		return 0, false
+	}
+	organizationID, ok := ctx.Value(tenantContextKey{}).(uint)
+	return organizationID, ok && organizationID != 0
+}
+
+// WithoutTenantScope returns a context whose statements on tenant-owned models see the
+// rows of every organization. Code that works across tenants, such as billing, webhooks
+// and background jobs, must opt out with it explicitly.
+func WithoutTenantScope(ctx context.Context) context.Context {
+	return context.WithValue(ctx, tenantUnscopedKey{}, true)
+}
+
+// AcrossTenants returns a handle on db whose statements opt out of the tenant scope, for
+// services that work across organizations, such as billing against the global catalog
+func AcrossTenants(db *gorm.DB) *gorm.DB {
+	if db == nil {
+		return nil
+	}
+	ctx := db.Statement.Context
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	return db.WithContext(WithoutTenantScope(ctx))
+}
+
+// isTenantUnscoped reports whether ctx was marked by WithoutTenantScope
+func isTenantUnscoped(ctx context.Context) bool {
+	if ctx == nil {
+		return false
+	}
+	unscoped, _ := ctx.Value(tenantUnscopedKey{}).(bool)
+	return unscoped
+}
+
+// RegisterTenantScope installs callbacks that confine tenant-owned models to the
+// organization of the statement's context: queries, updates and deletes only match its
+// rows, and created or updated rows are assigned to it. Statements whose context has no
+// organization fail with ErrTenantRequired unless the context was marked with
+// WithoutTenantScope, so request handlers must pass the request context with
+// db.WithContext.
+func RegisterTenantScope(db *gorm.DB) error {
+	callbacks := db.Callback()
+	if err := callbacks.Create().Before("gorm:create").Register("tenant:assign", assignTenant); err != nil {
+		return fmt.Errorf("failed to register tenant create callback: %w", err)
+	}
+	if err := callbacks.Query().Before("gorm:query").Register("tenant:scope", scopeToTenant); err != nil {
+		return fmt.Errorf("failed to register tenant query callback: %w", err)
+	}
+	if err := callbacks.Update().Before("gorm:update").Register("tenant:scope", func(db *gorm.DB) {
+		assignTenant(db)
+		scopeToTenant(db)
+	}); err != nil {
+		return fmt.Errorf("failed to register tenant update callback: %w", err)
+	}
+	if err := callbacks.Delete().Before("gorm:delete").Register("tenant:scope", scopeToTenant); err != nil {
+		return fmt.Errorf("failed to register tenant delete callback: %w", err)
+	}
+	if err := callbacks.Row().Before("gorm:row").Register("tenant:scope", scopeToTenant); err != nil {
+		return fmt.Errorf("failed to register tenant row callback: %w", err)
+	}
+	return nil
+}
+
+// tenantFor returns the organization a statement on a tenant-owned model is scoped to.
+// It fails the statement when there is none and the context didn't opt out.
+func tenantFor(db *gorm.DB) (uint, bool) {
+	if db.Error != nil || db.Statement.Schema == nil {
+		return 0, false
+	}
+	if _, ok := reflect.New(db.Statement.Schema.ModelType).Interface().(TenantOwned); !ok {
+		return 0, false
+	}
+	if organizationID, ok := OrganizationFromContext(db.Statement.Context); ok {
+		return organizationID, true
+	}
+	if !isTenantUnscoped(db.Statement.Context) {
+		db.AddError(fmt.Errorf("%w: %s", ErrTenantRequired, db.Statement.Schema.Table))
+	}
+	return 0, false
+}
+
+func scopeToTenant(db *gorm.DB) {
+	organizationID, ok := tenantFor(db)
+	if !ok {
+		return
+	}
+	db.Statement.AddClause(clause.Where{Exprs: []clause.Expression{
+		clause.Eq{Column: clause.Column{Table: clause.CurrentTable, Name: "organization_id"}, Value: organizationID},
+	}})
+}
+
+// assignTenant overwrites the organization of the written rows, so a client can't move
+// a record into another tenant by sending a different organization_id
+func assignTenant(db *gorm.DB) {
+	organizationID, ok := tenantFor(db)
+	if !ok {
+		return
+	}
+	db.Statement.SetColumn("OrganizationID", &organizationID, true)
+}
@@ -3,7 +3,8 @@ package models
 import (
 	"time"
 
-	"golang.org/x/crypto/bcrypt"
+	"mobile-backend/utils"
+
 	"gorm.io/gorm"
 )
 
@@ -15,6 +16,31 @@ type User struct {
 	IsActive  bool       `json:"is_active" gorm:"default:true"`
 	LastLogin *time.Time `json:"last_login,omitempty"`
 
+	// EmailVerifiedAt is set once the user proves ownership of their email address
+	EmailVerifiedAt *time.Time `json:"email_verified_at,omitempty"`
+
+	// LockedUntil blocks password logins after repeated failures until it passes
+	LockedUntil *time.Time `json:"locked_until,omitempty"`
+
+	// PasswordChangedAt is when the password was last set; nil for accounts that predate it
+	PasswordChangedAt *time.Time `json:"password_changed_at,omitempty"`
+
+	// PasswordResetRequired blocks password logins until the user resets their password
+	PasswordResetRequired bool `json:"password_reset_required" gorm:"default:false"`
+
+	// IsGuest marks an anonymous account created by guest sign in. Guests have a
+	// placeholder email and no usable password until they upgrade to a full account.
+	IsGuest bool `json:"is_guest" gorm:"default:false;index"`
+	// GuestDeviceHash binds a guest to the device it signed in from
+	GuestDeviceHash *string `json:"-" gorm:"size:64;uniqueIndex"`
+	// GuestSecretHash is the hash of the secret the device got when the guest was
+	// created, which it has to present to sign in as the guest again
+	GuestSecretHash *string `json:"-" gorm:"size:64"`
+
+	// SuspendedAt and SuspensionReason are set when an administrator deactivates the account
+	SuspendedAt      *time.Time `json:"suspended_at,omitempty"`
+	SuspensionReason string     `json:"suspension_reason,omitempty" gorm:"size:500"`
+
 	// Subscription status fields
 	SubscriptionStatus string     `json:"subscription_status" gorm:"default:'free'" validate:"oneof=free trial active canceled past_due"`
 	IsPro              bool       `json:"is_pro" gorm:"default:false"`
@@ -26,19 +52,19 @@ type User struct {
 	ActiveSubscription *Subscription `json:"active_subscription,omitempty" gorm:"foreignKey:SubscriptionID"`
 }
 
-// HashPassword hashes the user's password
+// HashPassword hashes the user's password with the configured algorithm and cost
 func (u *User) HashPassword(password string) error {
-	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	hashedPassword, err := utils.HashPassword(password)
 	if err != nil {
 		return err
 	}
-	u.Password = string(hashedPassword)
+	u.Password = hashedPassword
 	return nil
 }
 
 // CheckPassword verifies the user's password
 func (u *User) CheckPassword(password string) error {
-	return bcrypt.CompareHashAndPassword([]byte(u.Password), []byte(password))
+	return utils.VerifyPassword(password, u.Password)
 }
 
 // BeforeCreate hook to hash password before creating user
@@ -49,9 +75,26 @@ func (u *User) BeforeCreate(tx *gorm.DB) error {
 	return nil
 }
 
-// IsSubscriptionActive checks if user has an active subscription
+// IsSubscriptionActive checks if user has an active subscription. Past due subscriptions
+// count while their grace period lasts.
 func (u *User) IsSubscriptionActive() bool {
-	return u.SubscriptionStatus == "active" || u.SubscriptionStatus == "trial"
+	return u.SubscriptionStatus == "active" || u.SubscriptionStatus == "trial" || u.IsInGracePeriod()
+}
+
+// IsInGracePeriod reports whether a payment failed but the user keeps access while it
+// is retried
+func (u *User) IsInGracePeriod() bool {
+	return u.SubscriptionStatus == "past_due" && u.IsPro
+}
+
+// IsLocked reports whether password logins are currently locked out
+func (u *User) IsLocked() bool {
+	return u.LockedUntil != nil && time.Now().Before(*u.LockedUntil)
+}
+
+// IsEmailVerified checks if the user has verified their email address
+func (u *User) IsEmailVerified() bool {
+	return u.EmailVerifiedAt != nil
 }
 
 // IsProUser checks if user has pro access
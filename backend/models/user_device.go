@@ -0,0 +1,40 @@
+package models
+
+import (
+	"time"
+)
+
+// PlatformUnknown is used for devices whose platform can't be told from the request
+const PlatformUnknown = "unknown"
+
+// UserDevice is a device a user has signed in from. Devices are recognised by a
+// fingerprint of the client-supplied device ID, or of the user agent when the client
+// sends none, so repeated logins from the same device update one record.
+type UserDevice struct {
+	BaseModel
+	UserID      uint   `json:"user_id" gorm:"not null;uniqueIndex:idx_user_devices_user_fingerprint"`
+	Fingerprint string `json:"-" gorm:"size:64;not null;uniqueIndex:idx_user_devices_user_fingerprint"`
+	// DeviceID is the identifier the client sent in X-Device-ID, if any; push tokens
+	// registered with the same device ID belong to this device
+	DeviceID    string     `json:"device_id,omitempty" gorm:"size:255;index"`
+	Name        string     `json:"name" gorm:"size:255"`
+	Platform    string     `json:"platform" gorm:"size:20;not null;default:'unknown'"`
+	AppVersion  string     `json:"app_version,omitempty" gorm:"size:50"`
+	OSVersion   string     `json:"os_version,omitempty" gorm:"size:50"`
+	UserAgent   string     `json:"user_agent,omitempty"`
+	FirstSeenAt time.Time  `json:"first_seen_at" gorm:"not null"`
+	LastSeenAt  time.Time  `json:"last_seen_at" gorm:"not null"`
+	LastIP      string     `json:"last_ip,omitempty" gorm:"size:64"`
+	TrustedAt   *time.Time `json:"trusted_at,omitempty"`
+	RevokedAt   *time.Time `json:"revoked_at,omitempty"`
+}
+
+// IsTrusted reports whether the user has marked the device as trusted
+func (d *UserDevice) IsTrusted() bool {
+	return d.TrustedAt != nil && d.RevokedAt == nil
+}
+
+// IsRevoked reports whether the user has signed the device out
+func (d *UserDevice) IsRevoked() bool {
+	return d.RevokedAt != nil
+}
@@ -0,0 +1,29 @@
+package models
+
+import (
+	"time"
+)
+
+// Verification token purposes
+const (
+	TokenPurposeEmailVerification = "email_verification"
+	TokenPurposePasswordReset     = "password_reset"
+)
+
+// VerificationToken is a single-use token emailed to a user. Only the hash of the
+// token is stored; the raw value exists solely in the email link.
+type VerificationToken struct {
+	BaseModel
+	UserID    uint       `json:"user_id" gorm:"not null;index"`
+	Purpose   string     `json:"purpose" gorm:"size:50;not null;index"`
+	TokenHash string     `json:"-" gorm:"size:64;uniqueIndex;not null"`
+	ExpiresAt time.Time  `json:"expires_at" gorm:"not null"`
+	UsedAt    *time.Time `json:"used_at,omitempty"`
+
+	User User `json:"-" gorm:"foreignKey:UserID"`
+}
+
+// IsUsable reports whether the token is unused and not expired
+func (t *VerificationToken) IsUsable() bool {
+	return t.UsedAt == nil && time.Now().Before(t.ExpiresAt)
+}
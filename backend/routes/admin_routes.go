@@ -0,0 +1,47 @@
+package routes
+
+import (
+	"mobile-backend/controllers"
+	"mobile-backend/middleware"
+	"mobile-backend/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// SetupAdminRoutes sets up role, permission and user administration routes
+func SetupAdminRoutes(r *gin.Engine, roleController *controllers.RoleController, authController *controllers.AuthController, adminUserController *controllers.AdminUserController) {
+	admin := r.Group("/api/v1/admin")
+	admin.Use(middleware.AuthMiddleware(), middleware.BlockImpersonation())
+
+	roles := admin.Group("")
+	roles.Use(middleware.RequirePermission(models.PermissionRolesManage))
+	{
+		// Roles
+		roles.GET("/roles", roleController.ListRoles)
+
+		// User role assignments
+		roles.GET("/users/:id/roles", roleController.GetUserRoles)
+		roles.POST("/users/:id/roles", roleController.AssignRole)
+		roles.DELETE("/users/:id/roles/:role", roleController.RevokeRole)
+	}
+
+	users := admin.Group("")
+	users.Use(middleware.RequirePermission(models.PermissionUsersManage))
+	{
+		users.GET("/users", adminUserController.ListUsers)
+		users.GET("/users/:id", adminUserController.GetUser)
+		users.POST("/users/:id/suspend", adminUserController.SuspendUser)
+		users.POST("/users/:id/reactivate", adminUserController.ReactivateUser)
+		users.POST("/users/:id/force-password-reset", adminUserController.ForcePasswordReset)
+		users.POST("/users/bulk", adminUserController.BulkAction)
+		users.GET("/users/bulk/:id", adminUserController.GetBulkAction)
+		users.POST("/users/:id/revoke-tokens", authController.RevokeUserTokens)
+		users.POST("/users/:id/unlock", authController.UnlockUser)
+	}
+
+	impersonation := admin.Group("")
+	impersonation.Use(middleware.RequirePermission(models.PermissionUsersImpersonate))
+	{
+		impersonation.POST("/users/:id/impersonate", authController.ImpersonateUser)
+	}
+}
@@ -0,0 +1,20 @@
+package routes
+
+import (
+	"mobile-backend/controllers"
+	"mobile-backend/middleware"
+
+	"github.com/gin-gonic/gin"
+)
+
+// SetupAPIKeyRoutes sets up API key management routes. Keys are managed with a bearer
+// token only, so a leaked key can't be used to mint new ones.
+func SetupAPIKeyRoutes(r *gin.Engine, apiKeyController *controllers.APIKeyController) {
+	apiKeys := r.Group("/api/v1/auth/api-keys")
+	apiKeys.Use(middleware.AuthMiddleware(), middleware.BlockImpersonation())
+	{
+		apiKeys.GET("", apiKeyController.ListKeys)
+		apiKeys.POST("", apiKeyController.CreateKey)
+		apiKeys.DELETE("/:id", apiKeyController.RevokeKey)
+	}
+}
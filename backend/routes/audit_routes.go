@@ -0,0 +1,21 @@
+package routes
+
+import (
+	"mobile-backend/controllers"
+	"mobile-backend/middleware"
+	"mobile-backend/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// SetupAuditRoutes sets up audit log query and export routes
+func SetupAuditRoutes(r *gin.Engine, auditController *controllers.AuditController) {
+	audit := r.Group("/api/v1/admin/audit-events")
+	audit.Use(middleware.AuthMiddleware())
+	audit.Use(middleware.RequirePermission(models.PermissionAuditRead))
+	{
+		audit.GET("", auditController.ListEvents)
+		audit.GET("/export", auditController.ExportEvents)
+		audit.GET("/verify", auditController.VerifyChain)
+	}
+}
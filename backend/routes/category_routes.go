@@ -3,18 +3,25 @@ package routes
 import (
 	"mobile-backend/controllers"
 	"mobile-backend/middleware"
+	"mobile-backend/models"
 	"github.com/gin-gonic/gin"
 )
 
 // SetupCategoryRoutes sets up Category routes
 func SetupCategoryRoutes(r *gin.Engine, categoryController *controllers.CategoryController) {
 	category := r.Group("/api/v1/category")
-	category.Use(middleware.AuthMiddleware())
+	category.Use(middleware.AuthMiddleware(), middleware.TenantMiddleware())
 	{
 		category.GET("/", categoryController.GetCategoryList)
 		category.GET("/:id", categoryController.GetCategory)
-		category.POST("/", categoryController.CreateCategory)
-		category.PUT("/:id", categoryController.UpdateCategory)
-		category.DELETE("/:id", categoryController.DeleteCategory)
+	}
+
+	// Only organization owners and admins can change the catalog
+	manage := category.Group("")
+	manage.Use(middleware.RequireOrganizationRole(models.OrganizationRoleOwner, models.OrganizationRoleAdmin))
+	{
+		manage.POST("/", categoryController.CreateCategory)
+		manage.PUT("/:id", categoryController.UpdateCategory)
+		manage.DELETE("/:id", categoryController.DeleteCategory)
 	}
 }
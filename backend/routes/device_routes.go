@@ -0,0 +1,27 @@
+package routes
+
+import (
+	"mobile-backend/controllers"
+	"mobile-backend/middleware"
+
+	"github.com/gin-gonic/gin"
+)
+
+// SetupDeviceRoutes sets up the routes for managing the devices signed in to an account
+func SetupDeviceRoutes(r *gin.Engine, deviceController *controllers.DeviceController) {
+	devices := r.Group("/api/v1/devices")
+	devices.Use(middleware.AuthMiddleware())
+	{
+		devices.GET("", deviceController.ListDevices)
+
+		// Changing devices is left to the account owner, not an impersonating admin
+		manage := devices.Group("")
+		manage.Use(middleware.BlockImpersonation())
+		{
+			manage.PATCH("/:id", deviceController.RenameDevice)
+			manage.DELETE("/:id", deviceController.RevokeDevice)
+			manage.POST("/:id/trust", deviceController.TrustDevice)
+			manage.DELETE("/:id/trust", deviceController.UntrustDevice)
+		}
+	}
+}
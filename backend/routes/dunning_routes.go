@@ -0,0 +1,21 @@
+package routes
+
+import (
+	"mobile-backend/controllers"
+	"mobile-backend/middleware"
+	"mobile-backend/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// SetupDunningRoutes sets up admin routes showing past due subscriptions and their
+// dunning state
+func SetupDunningRoutes(r *gin.Engine, dunningController *controllers.DunningController) {
+	admin := r.Group("/api/v1/admin")
+	admin.Use(middleware.AuthMiddleware(), middleware.BlockImpersonation())
+	admin.Use(middleware.RequirePermission(models.PermissionSubscriptionsRead))
+	{
+		admin.GET("/dunning", dunningController.ListDunning)
+		admin.GET("/subscriptions/:id/dunning", dunningController.GetSubscriptionDunning)
+	}
+}
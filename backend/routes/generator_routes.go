@@ -3,6 +3,7 @@ package routes
 import (
 	"mobile-backend/controllers"
 	"mobile-backend/middleware"
+	"mobile-backend/models"
 
 	"github.com/gin-gonic/gin"
 )
@@ -13,6 +14,7 @@ func SetupGeneratorRoutes(r *gin.Engine, generatorController *controllers.Genera
 	api := r.Group("/api/v1")
 	generator := api.Group("/schema")
 	generator.Use(middleware.AuthMiddleware())
+	generator.Use(middleware.RequirePermission(models.PermissionGeneratorManage))
 	{
 		// Schema-based generation
 		generator.POST("/generate", generatorController.GenerateFromSchema)
@@ -0,0 +1,24 @@
+package routes
+
+import (
+	"mobile-backend/controllers"
+	"mobile-backend/middleware"
+
+	"github.com/gin-gonic/gin"
+)
+
+// SetupGuestRoutes sets up anonymous guest sign in and guest upgrade routes. Guest sign in
+// creates accounts without any credentials, so it is rate limited like the other auth routes.
+func SetupGuestRoutes(r *gin.Engine, guestController *controllers.GuestController, rateLimiter *middleware.RateLimiter) {
+	guest := r.Group("/api/v1/auth/guest")
+	{
+		guest.POST("", rateLimiter.AuthRateLimit(), guestController.SignIn)
+
+		upgrade := guest.Group("/upgrade")
+		upgrade.Use(middleware.AuthMiddleware(), middleware.BlockImpersonation())
+		{
+			upgrade.POST("", guestController.Upgrade)
+			upgrade.POST("/oauth2/:provider", guestController.UpgradeWithIDToken)
+		}
+	}
+}
@@ -0,0 +1,27 @@
+package routes
+
+import (
+	"mobile-backend/controllers"
+	"mobile-backend/middleware"
+
+	"github.com/gin-gonic/gin"
+)
+
+// SetupInAppPurchaseRoutes sets up App Store and Google Play purchase verification and
+// the stores' notification webhooks
+func SetupInAppPurchaseRoutes(r *gin.Engine, iapController *controllers.InAppPurchaseController) {
+	// Mobile clients sign these requests like the payment routes
+	iap := r.Group("/api/v1/iap", middleware.RequireSignedRequest())
+	iap.Use(middleware.AuthMiddleware(), middleware.BlockImpersonation())
+	{
+		iap.POST("/app-store/transactions", iapController.VerifyAppStoreTransaction)
+		iap.POST("/google-play/purchases", iapController.VerifyGooglePlayPurchase)
+	}
+
+	// Store notifications (no auth required); payloads are verified by the service
+	webhooks := r.Group("/api/v1/webhooks")
+	{
+		webhooks.POST("/app-store", iapController.AppStoreNotification)
+		webhooks.POST("/google-play", iapController.GooglePlayNotification)
+	}
+}
@@ -2,6 +2,8 @@ package routes
 
 import (
 	"mobile-backend/controllers"
+	"mobile-backend/middleware"
+	"mobile-backend/models"
 
 	"github.com/gin-gonic/gin"
 )
@@ -10,6 +12,8 @@ import (
 func SetupJobQueueRoutes(r *gin.Engine, jobQueueController *controllers.JobQueueController, metricsController *controllers.JobQueueMetricsController) {
 	// Job queue API group
 	jobGroup := r.Group("/api/v1/jobs")
+	jobGroup.Use(middleware.AuthMiddleware())
+	jobGroup.Use(middleware.RequirePermission(models.PermissionJobsManage))
 	{
 		// Queue statistics
 		jobGroup.GET("/stats", jobQueueController.GetQueueStats)
@@ -0,0 +1,12 @@
+package routes
+
+import (
+	"mobile-backend/controllers"
+
+	"github.com/gin-gonic/gin"
+)
+
+// SetupJWKSRoutes sets up the public key discovery endpoint
+func SetupJWKSRoutes(r *gin.Engine, jwksController *controllers.JWKSController) {
+	r.GET("/.well-known/jwks.json", jwksController.GetJWKS)
+}
@@ -0,0 +1,29 @@
+package routes
+
+import (
+	"mobile-backend/controllers"
+	"mobile-backend/middleware"
+
+	"github.com/gin-gonic/gin"
+)
+
+// SetupMFARoutes sets up two-factor authentication routes. The login challenge exchange
+// is rate limited per IP like the other unauthenticated auth endpoints.
+func SetupMFARoutes(r *gin.Engine, mfaController *controllers.MFAController, rateLimiter *middleware.RateLimiter) {
+	mfa := r.Group("/api/v1/auth/mfa")
+	{
+		// Login challenge exchange (authenticated by the mfa_token itself)
+		mfa.POST("/verify", rateLimiter.AuthRateLimit(), mfaController.VerifyChallenge)
+
+		// Enrollment management
+		protected := mfa.Group("")
+		protected.Use(middleware.AuthMiddleware(), middleware.BlockImpersonation())
+		{
+			protected.GET("", mfaController.GetStatus)
+			protected.POST("/enroll", mfaController.Enroll)
+			protected.POST("/enable", mfaController.Enable)
+			protected.POST("/disable", mfaController.Disable)
+			protected.POST("/recovery-codes", mfaController.RegenerateRecoveryCodes)
+		}
+	}
+}
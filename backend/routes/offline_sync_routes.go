@@ -3,18 +3,22 @@ package routes
 import (
 	"mobile-backend/controllers"
 	"mobile-backend/middleware"
+	"mobile-backend/models"
 
 	"github.com/gin-gonic/gin"
 )
 
 // SetupOfflineSyncRoutes sets up offline sync routes
 func SetupOfflineSyncRoutes(router *gin.Engine, offlineSyncController *controllers.OfflineSyncController) {
-	// Create a group for offline sync routes with authentication middleware
+	// Create a group for offline sync routes that accepts a bearer token or an API key
+	// with the sync scope. Requests from mobile clients are signed. Operations on
+	// organization data are queued in the organization the request names.
 	offlineSync := router.Group("/api/v1/sync")
-	offlineSync.Use(middleware.AuthMiddleware())
+	offlineSync.Use(middleware.AuthOrAPIKeyMiddleware(), middleware.RequireAPIKeyScope(models.APIKeyScopeSync), middleware.RequireSignedRequest())
+	offlineSync.Use(middleware.OptionalTenantMiddleware())
 
-	// Queue operations
-	offlineSync.POST("/queue", offlineSyncController.QueueOperation)
+	// Queue operations; retries with the same Idempotency-Key aren't queued twice
+	offlineSync.POST("/queue", middleware.Idempotency(), offlineSyncController.QueueOperation)
 
 	// Sync status and operations
 	offlineSync.GET("/status", offlineSyncController.GetSyncStatus)
@@ -9,7 +9,7 @@ import (
 // SetupOrderRoutes sets up Order routes
 func SetupOrderRoutes(r *gin.Engine, orderController *controllers.OrderController) {
 	order := r.Group("/api/v1/order")
-	order.Use(middleware.AuthMiddleware())
+	order.Use(middleware.AuthMiddleware(), middleware.TenantMiddleware())
 	{
 		order.GET("/", orderController.GetOrderList)
 		order.GET("/:id", orderController.GetOrder)
@@ -0,0 +1,39 @@
+package routes
+
+import (
+	"mobile-backend/controllers"
+	"mobile-backend/middleware"
+	"mobile-backend/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// SetupOrganizationRoutes sets up organization, membership and invitation routes
+func SetupOrganizationRoutes(r *gin.Engine, organizationController *controllers.OrganizationController) {
+	organizations := r.Group("/api/v1/organizations")
+	organizations.Use(middleware.AuthMiddleware())
+	{
+		organizations.GET("", organizationController.ListOrganizations)
+		organizations.POST("", organizationController.CreateOrganization)
+		organizations.POST("/invitations/accept", organizationController.AcceptInvitation)
+	}
+
+	// Routes on a single organization require membership in it
+	organization := organizations.Group("/:id")
+	organization.Use(middleware.TenantFromParamMiddleware("id"))
+	{
+		organization.GET("", organizationController.GetOrganization)
+		organization.POST("/switch", organizationController.SwitchOrganization)
+		organization.GET("/members", organizationController.ListMembers)
+		organization.DELETE("/members/:user_id", organizationController.RemoveMember)
+	}
+
+	managers := organization.Group("")
+	managers.Use(middleware.RequireOrganizationRole(models.OrganizationRoleOwner, models.OrganizationRoleAdmin))
+	{
+		managers.PUT("/members/:user_id", organizationController.UpdateMemberRole)
+		managers.GET("/invitations", organizationController.ListInvitations)
+		managers.POST("/invitations", organizationController.InviteMember)
+		managers.DELETE("/invitations/:invitation_id", organizationController.RevokeInvitation)
+	}
+}
@@ -0,0 +1,17 @@
+package routes
+
+import (
+	"mobile-backend/controllers"
+
+	"github.com/gin-gonic/gin"
+)
+
+// SetupPasswordlessRoutes sets up magic link and email code sign-in routes
+func SetupPasswordlessRoutes(r *gin.Engine, passwordlessController *controllers.PasswordlessController) {
+	passwordless := r.Group("/api/v1/auth/passwordless")
+	{
+		passwordless.POST("/start", passwordlessController.Start)
+		passwordless.POST("/verify-link", passwordlessController.VerifyLink)
+		passwordless.POST("/verify-code", passwordlessController.VerifyCode)
+	}
+}
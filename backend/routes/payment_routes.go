@@ -3,6 +3,7 @@ package routes
 import (
 	"mobile-backend/controllers"
 	"mobile-backend/middleware"
+	"mobile-backend/models"
 
 	"github.com/gin-gonic/gin"
 )
@@ -11,39 +12,39 @@ func SetupPaymentRoutes(router *gin.RouterGroup, paymentController *controllers.
 	// Product routes
 	products := router.Group("/products")
 	{
-		products.POST("", middleware.AuthMiddleware(), paymentController.CreateProduct)
+		products.POST("", middleware.AuthMiddleware(), middleware.RequirePermission(models.PermissionProductsManage), paymentController.CreateProduct)
 		products.GET("", middleware.AuthMiddleware(), paymentController.GetProducts)
 		products.GET("/:id", middleware.AuthMiddleware(), paymentController.GetProduct)
-		products.PUT("/:id", middleware.AuthMiddleware(), paymentController.UpdateProduct)
+		products.PUT("/:id", middleware.AuthMiddleware(), middleware.RequirePermission(models.PermissionProductsManage), paymentController.UpdateProduct)
 	}
 
 	// Plan routes
 	plans := router.Group("/plans")
 	{
-		plans.POST("", middleware.AuthMiddleware(), paymentController.CreatePlan)
+		plans.POST("", middleware.AuthMiddleware(), middleware.RequirePermission(models.PermissionProductsManage), paymentController.CreatePlan)
 		plans.GET("", middleware.AuthMiddleware(), paymentController.GetPlans)
 	}
 
-	// Payment routes
-	payments := router.Group("/payments")
+	// Payment routes. Mobile clients sign these requests and may retry creates with an
+	// Idempotency-Key header
+	payments := router.Group("/payments", middleware.RequireSignedRequest())
 	{
-		payments.POST("", middleware.AuthMiddleware(), paymentController.CreatePayment)
-		payments.POST("/checkout", middleware.AuthMiddleware(), paymentController.CreateCheckoutSession)
+		payments.POST("", middleware.AuthMiddleware(), middleware.BlockImpersonation(), middleware.Idempotency(), paymentController.CreatePayment)
+		payments.POST("/checkout", middleware.AuthMiddleware(), middleware.BlockImpersonation(), paymentController.CreateCheckoutSession)
 		payments.GET("", middleware.AuthMiddleware(), paymentController.GetPayments)
 	}
 
 	// Subscription routes
-	subscriptions := router.Group("/subscriptions")
+	subscriptions := router.Group("/subscriptions", middleware.RequireSignedRequest())
 	{
-		subscriptions.POST("", middleware.AuthMiddleware(), paymentController.CreateSubscription)
+		subscriptions.POST("", middleware.AuthMiddleware(), middleware.BlockImpersonation(), middleware.Idempotency(), paymentController.CreateSubscription)
 		subscriptions.GET("", middleware.AuthMiddleware(), paymentController.GetSubscriptions)
-		subscriptions.POST("/:id/cancel", middleware.AuthMiddleware(), paymentController.CancelSubscription)
+		subscriptions.POST("/:id/cancel", middleware.AuthMiddleware(), middleware.BlockImpersonation(), paymentController.CancelSubscription)
 	}
 
-	// Webhook routes (no auth required)
+	// Webhook routes (no auth required), one per registered payment provider
 	webhooks := router.Group("/webhooks")
 	{
-		webhooks.POST("/stripe", paymentController.StripeWebhook)
-		webhooks.POST("/polar", paymentController.PolarWebhook)
+		webhooks.POST("/:provider", paymentController.ProviderWebhook)
 	}
 }
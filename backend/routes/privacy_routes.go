@@ -0,0 +1,22 @@
+package routes
+
+import (
+	"mobile-backend/controllers"
+	"mobile-backend/middleware"
+
+	"github.com/gin-gonic/gin"
+)
+
+// SetupPrivacyRoutes sets up personal data export and account deletion routes
+func SetupPrivacyRoutes(r *gin.Engine, privacyController *controllers.PrivacyController) {
+	privacy := r.Group("/api/v1/privacy")
+	privacy.Use(middleware.AuthMiddleware(), middleware.BlockImpersonation())
+	{
+		privacy.POST("/exports", privacyController.RequestExport)
+		privacy.GET("/exports/:id/download", privacyController.DownloadExport)
+		privacy.POST("/erasure", privacyController.RequestErasure)
+		privacy.GET("/requests", privacyController.ListRequests)
+		privacy.GET("/requests/:id", privacyController.GetRequest)
+		privacy.POST("/requests/:id/cancel", privacyController.CancelRequest)
+	}
+}
@@ -3,18 +3,25 @@ package routes
 import (
 	"mobile-backend/controllers"
 	"mobile-backend/middleware"
+	"mobile-backend/models"
 	"github.com/gin-gonic/gin"
 )
 
 // SetupProductRoutes sets up Product routes
 func SetupProductRoutes(r *gin.Engine, productController *controllers.ProductController) {
 	product := r.Group("/api/v1/product")
-	product.Use(middleware.AuthMiddleware())
+	product.Use(middleware.AuthMiddleware(), middleware.TenantMiddleware())
 	{
 		product.GET("/", productController.GetProductList)
 		product.GET("/:id", productController.GetProduct)
-		product.POST("/", productController.CreateProduct)
-		product.PUT("/:id", productController.UpdateProduct)
-		product.DELETE("/:id", productController.DeleteProduct)
+	}
+
+	// Only organization owners and admins can change the catalog
+	manage := product.Group("")
+	manage.Use(middleware.RequireOrganizationRole(models.OrganizationRoleOwner, models.OrganizationRoleAdmin))
+	{
+		manage.POST("/", productController.CreateProduct)
+		manage.PUT("/:id", productController.UpdateProduct)
+		manage.DELETE("/:id", productController.DeleteProduct)
 	}
 }
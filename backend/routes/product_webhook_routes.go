@@ -3,6 +3,7 @@ package routes
 import (
 	"mobile-backend/controllers"
 	"mobile-backend/middleware"
+	"mobile-backend/models"
 
 	"github.com/gin-gonic/gin"
 )
@@ -11,13 +12,13 @@ func SetupProductWebhookRoutes(router *gin.RouterGroup, productWebhookController
 	// Webhook endpoints (no auth required for webhooks)
 	webhookGroup := router.Group("/webhooks")
 	{
-		webhookGroup.POST("/stripe/products", productWebhookController.HandleStripeWebhook)
-		webhookGroup.POST("/polar/products", productWebhookController.HandlePolarWebhook)
+		webhookGroup.POST("/:provider/products", productWebhookController.HandleProviderWebhook)
 	}
 
 	// Admin endpoints (require auth)
 	adminGroup := router.Group("/admin/products")
 	adminGroup.Use(middleware.AuthMiddleware())
+	adminGroup.Use(middleware.RequirePermission(models.PermissionProductsManage))
 	{
 		// Sync statistics
 		adminGroup.GET("/sync/stats", productWebhookController.GetProductSyncStats)
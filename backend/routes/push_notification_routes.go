@@ -26,8 +26,9 @@ func SetupPushNotificationRoutes(router *gin.Engine, pushController *controllers
 		templates.GET("/", pushController.GetTemplates)
 	}
 
-	// Segment management
+	// Segment management, scoped to the current organization
 	segments := pushGroup.Group("/segments")
+	segments.Use(middleware.TenantMiddleware())
 	{
 		segments.POST("/", pushController.CreateSegment)
 		segments.GET("/", pushController.GetSegments)
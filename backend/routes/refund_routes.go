@@ -0,0 +1,29 @@
+package routes
+
+import (
+	"mobile-backend/controllers"
+	"mobile-backend/middleware"
+	"mobile-backend/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// SetupRefundRoutes sets up admin refund and dispute routes. Provider refund and dispute
+// events arrive through the payment webhooks.
+func SetupRefundRoutes(r *gin.Engine, refundController *controllers.RefundController) {
+	admin := r.Group("/api/v1/admin")
+	admin.Use(middleware.AuthMiddleware(), middleware.BlockImpersonation())
+
+	read := admin.Group("")
+	read.Use(middleware.RequirePermission(models.PermissionSubscriptionsRead))
+	{
+		read.GET("/payments/:id/refunds", refundController.ListPaymentRefunds)
+		read.GET("/disputes", refundController.ListDisputes)
+	}
+
+	refunds := admin.Group("")
+	refunds.Use(middleware.RequirePermission(models.PermissionPaymentsRefund))
+	{
+		refunds.POST("/payments/:id/refunds", refundController.RefundPayment)
+	}
+}
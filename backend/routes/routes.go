@@ -3,6 +3,7 @@ package routes
 import (
 	"mobile-backend/controllers"
 	"mobile-backend/middleware"
+	"mobile-backend/models"
 
 	"github.com/gin-gonic/gin"
 	"github.com/go-redis/redis/v8"
@@ -13,7 +14,7 @@ func SetupRoutes(r *gin.Engine, healthController *controllers.HealthController,
 	uploadController *controllers.UploadController, generatorController *controllers.GeneratorController,
 	oauth2Controller *controllers.OAuth2Controller, cacheController *controllers.CacheController,
 	paymentController *controllers.PaymentController, websocketController *controllers.WebSocketController,
-	offlineSyncController *controllers.OfflineSyncController) {
+	offlineSyncController *controllers.OfflineSyncController, rateLimiter *middleware.RateLimiter) {
 
 	// Health check routes
 	r.GET("/health", healthController.HealthCheck)
@@ -23,13 +24,17 @@ func SetupRoutes(r *gin.Engine, healthController *controllers.HealthController,
 	// API v1 routes
 	api := r.Group("/api/v1")
 	{
-		// Public routes with rate limiting
+		// Public routes; those taking credentials or sending email are rate limited per IP
 		auth := api.Group("/auth")
-		// Note: Rate limiting will be applied in main.go
 		{
-			auth.POST("/register", authController.Register)
-			auth.POST("/login", authController.Login)
-			auth.POST("/refresh", authController.RefreshToken)
+			auth.POST("/register", rateLimiter.AuthRateLimit(), authController.Register)
+			auth.POST("/login", rateLimiter.AuthRateLimit(), authController.Login)
+			auth.POST("/change-expired-password", rateLimiter.AuthRateLimit(), authController.ChangeExpiredPassword)
+			auth.POST("/refresh", rateLimiter.AuthRateLimit(), authController.RefreshToken)
+			auth.POST("/forgot-password", rateLimiter.AuthRateLimit(), authController.ForgotPassword)
+			auth.POST("/reset-password", rateLimiter.AuthRateLimit(), authController.ResetPassword)
+			auth.POST("/verify-email", rateLimiter.AuthRateLimit(), authController.VerifyEmail)
+			auth.POST("/resend-verification", rateLimiter.AuthRateLimit(), authController.ResendVerification)
 
 			// OAuth2 routes
 			oauth2 := auth.Group("/oauth2")
@@ -37,6 +42,8 @@ func SetupRoutes(r *gin.Engine, healthController *controllers.HealthController,
 				oauth2.GET("/providers", oauth2Controller.OAuth2Providers)
 				oauth2.GET("/:provider", oauth2Controller.OAuth2Login)
 				oauth2.GET("/callback", oauth2Controller.OAuth2Callback)
+				oauth2.POST("/callback", oauth2Controller.OAuth2Callback) // Sign in with Apple form_post
+				oauth2.POST("/:provider/token", rateLimiter.AuthRateLimit(), oauth2Controller.OAuth2Token)
 			}
 		}
 
@@ -46,21 +53,26 @@ func SetupRoutes(r *gin.Engine, healthController *controllers.HealthController,
 		{
 			// Auth routes
 			protected.POST("/auth/logout", authController.Logout)
+			protected.GET("/auth/sessions", authController.ListSessions)
+			protected.GET("/auth/identities", oauth2Controller.ListIdentities)
+			protected.POST("/auth/impersonation/stop", authController.StopImpersonation)
 
-			// User routes
-			protected.GET("/profile", userController.GetProfile)
-			protected.PUT("/profile", userController.UpdateProfile)
-			protected.DELETE("/profile", userController.DeleteProfile)
-			protected.GET("/users/:id", userController.GetUserByID)
-
-			// Upload routes
-			protected.POST("/upload", uploadController.UploadFile)
-			protected.POST("/upload/multiple", uploadController.UploadMultipleFiles)
-			protected.GET("/uploads/:filename", uploadController.GetFile)
-			protected.DELETE("/uploads/:filename", uploadController.DeleteFile)
+			// Account changes that staff impersonating the user must not make
+			sensitive := protected.Group("/")
+			sensitive.Use(middleware.BlockImpersonation())
+			{
+				sensitive.POST("/auth/change-password", authController.ChangePassword)
+				sensitive.POST("/auth/logout-all", authController.LogoutAll)
+				sensitive.DELETE("/auth/sessions", authController.RevokeAllSessions)
+				sensitive.DELETE("/auth/sessions/:id", authController.RevokeSession)
+				sensitive.POST("/auth/oauth2/:provider/link", oauth2Controller.OAuth2Link)
+				sensitive.DELETE("/auth/identities/:id", oauth2Controller.UnlinkIdentity)
+				sensitive.DELETE("/profile", userController.DeleteProfile)
+			}
 
 			// Cache management routes
 			cache := protected.Group("/cache")
+			cache.Use(middleware.RequirePermission(models.PermissionCacheManage))
 			{
 				cache.GET("/stats", cacheController.GetCacheStats)
 				cache.GET("/metrics", cacheController.GetCacheMetrics)
@@ -75,6 +87,30 @@ func SetupRoutes(r *gin.Engine, healthController *controllers.HealthController,
 			}
 		}
 
+		// Routes that also accept API keys holding the matching scope
+		keyAccessible := api.Group("/")
+		keyAccessible.Use(middleware.AuthOrAPIKeyMiddleware())
+		{
+			// User routes
+			profile := keyAccessible.Group("/")
+			profile.Use(middleware.RequireAPIKeyScope(models.APIKeyScopeProfile))
+			{
+				profile.GET("/profile", userController.GetProfile)
+				profile.PUT("/profile", userController.UpdateProfile)
+				profile.GET("/users/:id", userController.GetUserByID)
+			}
+
+			// Upload routes
+			uploads := keyAccessible.Group("/")
+			uploads.Use(middleware.RequireAPIKeyScope(models.APIKeyScopeUploads))
+			{
+				uploads.POST("/upload", uploadController.UploadFile)
+				uploads.POST("/upload/multiple", uploadController.UploadMultipleFiles)
+				uploads.GET("/uploads/:filename", uploadController.GetFile)
+				uploads.DELETE("/uploads/:filename", uploadController.DeleteFile)
+			}
+		}
+
 		// Payment routes (separate group for better organization)
 		SetupPaymentRoutes(api, paymentController)
 
@@ -107,6 +143,11 @@ func SetupRoutesWithRateLimit(r *gin.Engine, healthController *controllers.Healt
 		{
 			auth.POST("/register", authController.Register)
 			auth.POST("/login", authController.Login)
+			auth.POST("/change-expired-password", authController.ChangeExpiredPassword)
+			auth.POST("/forgot-password", authController.ForgotPassword)
+			auth.POST("/reset-password", authController.ResetPassword)
+			auth.POST("/verify-email", authController.VerifyEmail)
+			auth.POST("/resend-verification", authController.ResendVerification)
 		}
 
 		// Protected routes with higher rate limit
@@ -116,6 +157,10 @@ func SetupRoutesWithRateLimit(r *gin.Engine, healthController *controllers.Healt
 		{
 			// Auth routes
 			protected.POST("/auth/logout", authController.Logout)
+			protected.POST("/auth/logout-all", authController.LogoutAll)
+			protected.GET("/auth/sessions", authController.ListSessions)
+			protected.DELETE("/auth/sessions", authController.RevokeAllSessions)
+			protected.DELETE("/auth/sessions/:id", authController.RevokeSession)
 
 			// User routes
 			protected.GET("/profile", userController.GetProfile)
@@ -7,6 +7,7 @@ import (
 
 	"mobile-backend/controllers"
 	"mobile-backend/middleware"
+	"mobile-backend/models"
 	"mobile-backend/services"
 )
 
@@ -15,8 +16,9 @@ func SetupSubscriptionManagementRoutes(
 	router *gin.RouterGroup,
 	db *gorm.DB,
 	subscriptionStatusService *services.SubscriptionStatusService,
-	stripeService *services.StripeService,
-	polarService *services.PolarService,
+	providers *services.PaymentProviderRegistry,
+	changeService *services.SubscriptionChangeService,
+	auditService *services.AuditService,
 	subscriptionMiddleware *middleware.SubscriptionMiddleware,
 	logger *zap.Logger,
 ) {
@@ -24,8 +26,9 @@ func SetupSubscriptionManagementRoutes(
 	subscriptionController := controllers.NewSubscriptionManagementController(
 		db,
 		subscriptionStatusService,
-		stripeService,
-		polarService,
+		providers,
+		changeService,
+		auditService,
 		logger,
 	)
 
@@ -40,17 +43,21 @@ func SetupSubscriptionManagementRoutes(
 		subscription.GET("/plans", subscriptionController.GetSubscriptionPlans)
 
 		// Create new subscription
-		subscription.POST("", subscriptionController.CreateSubscription)
+		subscription.POST("", middleware.BlockImpersonation(), subscriptionController.CreateSubscription)
 
 		// Cancel subscription
-		subscription.POST("/cancel", subscriptionController.CancelSubscription)
+		subscription.POST("/cancel", middleware.BlockImpersonation(), subscriptionController.CancelSubscription)
+
+		// Change plan or quantity
+		subscription.POST("/change", middleware.BlockImpersonation(), subscriptionController.ChangePlan)
+		subscription.POST("/change/preview", subscriptionController.PreviewPlanChange)
 
 		// Get subscription history
 		subscription.GET("/history", subscriptionController.GetSubscriptionHistory)
 
 		// Admin routes
 		admin := subscription.Group("/admin")
-		// Note: Role-based middleware would need to be implemented
+		admin.Use(middleware.RequirePermission(models.PermissionSubscriptionsRead))
 		{
 			// Get subscription statistics
 			admin.GET("/stats", subscriptionController.GetSubscriptionStats)
@@ -22,6 +22,9 @@ func migrate() {
 		&models.Plan{},
 		&models.Subscription{},
 		&models.Payment{},
+		&models.Refund{},
+		&models.Dispute{},
+		&models.SubscriptionDunning{},
 		&models.PaymentMethod{},
 		&models.WebhookEvent{},
 	); err != nil {
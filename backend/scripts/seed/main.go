@@ -1,10 +1,12 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"log"
 	"mobile-backend/config"
 	"mobile-backend/models"
+	"mobile-backend/services"
 
 	"golang.org/x/crypto/bcrypt"
 )
@@ -32,6 +34,17 @@ func seed() {
 		log.Println("Admin user created successfully")
 	}
 
+	// Seed roles and make the admin user the initial superadmin
+	roleService := services.NewRoleService(db)
+	if err := roleService.EnsureDefaultRoles(context.Background()); err != nil {
+		log.Fatal("Failed to seed roles:", err)
+	}
+	if err := roleService.BootstrapSuperAdmin(context.Background(), admin.Email); err != nil {
+		log.Printf("Failed to grant superadmin role: %v", err)
+	} else {
+		log.Println("Superadmin role granted to admin user")
+	}
+
 	// Create test users
 	for i := 1; i <= 10; i++ {
 		hashedPassword, _ := bcrypt.GenerateFromPassword([]byte("password123"), bcrypt.DefaultCost)
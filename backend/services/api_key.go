@@ -0,0 +1,173 @@
+package services
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"mobile-backend/config"
+	"mobile-backend/models"
+	"mobile-backend/utils"
+
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+const (
+	// apiKeyPrefix marks our keys so secret scanners and humans can recognize them
+	apiKeyPrefix = "mbk_"
+	// apiKeyLastUsedInterval limits last-used bookkeeping to one write per key per interval
+	apiKeyLastUsedInterval = time.Minute
+)
+
+var (
+	ErrInvalidAPIKey       = errors.New("invalid API key")
+	ErrAPIKeyNotFound      = errors.New("API key not found")
+	ErrInvalidAPIKeyScope  = errors.New("invalid API key scope")
+	ErrInvalidAPIKeyExpiry = errors.New("API key expiry must be in the future")
+)
+
+// APIKeyService issues, authenticates and revokes API keys. A key looks like
+// mbk_<id>_<secret>; the mbk_<id> prefix is stored in clear for lookup and display,
+// and the whole key only as a hash.
+type APIKeyService struct {
+	db     *gorm.DB
+	logger *config.Logger
+}
+
+// NewAPIKeyService creates a new API key service
+func NewAPIKeyService(db *gorm.DB, logger *config.Logger) *APIKeyService {
+	return &APIKeyService{
+		db:     db,
+		logger: logger,
+	}
+}
+
+// CreateKey issues a new key for the user and returns it with its raw value, which is
+// shown only once
+func (s *APIKeyService) CreateKey(ctx context.Context, userID uint, organizationID *uint, name string, scopes []string, expiresAt *time.Time) (*models.APIKey, string, error) {
+	for _, scope := range scopes {
+		if !isAPIKeyScope(scope) {
+			return nil, "", fmt.Errorf("%w: %s", ErrInvalidAPIKeyScope, scope)
+		}
+	}
+	if expiresAt != nil && !expiresAt.After(time.Now()) {
+		return nil, "", ErrInvalidAPIKeyExpiry
+	}
+
+	id, err := utils.GenerateRandomString(6)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to generate key: %w", err)
+	}
+	secret, err := utils.GenerateAPIKey()
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to generate key: %w", err)
+	}
+	prefix := apiKeyPrefix + id
+	raw := prefix + "_" + secret
+
+	key := &models.APIKey{
+		UserID:         userID,
+		OrganizationID: organizationID,
+		Name:           strings.TrimSpace(name),
+		Prefix:         prefix,
+		KeyHash:        utils.HashToken(raw),
+		Scopes:         strings.Join(scopes, " "),
+		ExpiresAt:      expiresAt,
+	}
+	if err := s.db.WithContext(ctx).Create(key).Error; err != nil {
+		return nil, "", fmt.Errorf("failed to store API key: %w", err)
+	}
+
+	s.logger.LogSecurityEvent(ctx, "api_key_created", "low",
+		zap.Uint("user_id", userID),
+		zap.String("prefix", prefix),
+		zap.Strings("scopes", scopes),
+	)
+	return key, raw, nil
+}
+
+// ListKeys returns the user's keys, including revoked and expired ones
+func (s *APIKeyService) ListKeys(ctx context.Context, userID uint) ([]models.APIKey, error) {
+	var keys []models.APIKey
+	if err := s.db.WithContext(ctx).Where("user_id = ?", userID).Order("created_at DESC").Find(&keys).Error; err != nil {
+		return nil, fmt.Errorf("failed to list API keys: %w", err)
+	}
+	return keys, nil
+}
+
+// RevokeKey revokes one of the user's keys
+func (s *APIKeyService) RevokeKey(ctx context.Context, userID, keyID uint) error {
+	result := s.db.WithContext(ctx).Model(&models.APIKey{}).
+		Where("id = ? AND user_id = ? AND revoked_at IS NULL", keyID, userID).
+		Update("revoked_at", time.Now())
+	if result.Error != nil {
+		return fmt.Errorf("failed to revoke API key: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return ErrAPIKeyNotFound
+	}
+
+	s.logger.LogSecurityEvent(ctx, "api_key_revoked", "low", zap.Uint("user_id", userID), zap.Uint("api_key_id", keyID))
+	return nil
+}
+
+// AuthenticateAPIKey resolves a raw key to a usable key whose owner is active and
+// records when and from where it was last used
+func (s *APIKeyService) AuthenticateAPIKey(ctx context.Context, rawKey, clientIP string) (*models.APIKey, error) {
+	prefix, ok := apiKeyLookupPrefix(rawKey)
+	if !ok {
+		return nil, ErrInvalidAPIKey
+	}
+
+	var key models.APIKey
+	if err := s.db.WithContext(ctx).Preload("User").Where("prefix = ?", prefix).First(&key).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrInvalidAPIKey
+		}
+		return nil, fmt.Errorf("failed to load API key: %w", err)
+	}
+
+	if subtle.ConstantTimeCompare([]byte(key.KeyHash), []byte(utils.HashToken(rawKey))) != 1 {
+		return nil, ErrInvalidAPIKey
+	}
+	if !key.IsUsable() || !key.User.IsActive {
+		return nil, ErrInvalidAPIKey
+	}
+
+	now := time.Now()
+	if key.LastUsedAt == nil || now.Sub(*key.LastUsedAt) > apiKeyLastUsedInterval || key.LastUsedIP != clientIP {
+		if err := s.db.WithContext(ctx).Model(&key).Updates(map[string]interface{}{
+			"last_used_at": now,
+			"last_used_ip": clientIP,
+		}).Error; err != nil {
+			s.logger.WarnWithContext(ctx, "Failed to record API key use", zap.Uint("api_key_id", key.ID), zap.Error(err))
+		}
+	}
+
+	return &key, nil
+}
+
+// apiKeyLookupPrefix extracts the stored mbk_<id> prefix from a raw key
+func apiKeyLookupPrefix(rawKey string) (string, bool) {
+	if !strings.HasPrefix(rawKey, apiKeyPrefix) {
+		return "", false
+	}
+	separator := strings.Index(rawKey[len(apiKeyPrefix):], "_")
+	if separator <= 0 {
+		return "", false
+	}
+	return rawKey[:len(apiKeyPrefix)+separator], true
+}
+
+func isAPIKeyScope(scope string) bool {
+	for _, s := range models.APIKeyScopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
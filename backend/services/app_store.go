@@ -0,0 +1,241 @@
+package services
+
+import (
+	"crypto/ecdsa"
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"mobile-backend/utils"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+var (
+	// appleLeafCertificateOID marks the certificates Apple signs App Store payloads with
+	appleLeafCertificateOID = asn1.ObjectIdentifier{1, 2, 840, 113635, 100, 6, 11, 1}
+	// appleIntermediateCertificateOID marks the Apple Worldwide Developer Relations intermediate
+	appleIntermediateCertificateOID = asn1.ObjectIdentifier{1, 2, 840, 113635, 100, 6, 2, 1}
+)
+
+// App Store transaction types and offer discount types we act on
+const (
+	appStoreAutoRenewableType = "Auto-Renewable Subscription"
+	appStoreFreeTrialOffer    = "FREE_TRIAL"
+)
+
+// AppStoreTransaction is the decoded payload of a JWSTransaction signed by the App Store.
+// Dates are milliseconds since the epoch and Price is in milliunits of Currency.
+type AppStoreTransaction struct {
+	TransactionID         string `json:"transactionId"`
+	OriginalTransactionID string `json:"originalTransactionId"`
+	BundleID              string `json:"bundleId"`
+	ProductID             string `json:"productId"`
+	Type                  string `json:"type"`
+	PurchaseDate          int64  `json:"purchaseDate"`
+	ExpiresDate           int64  `json:"expiresDate,omitempty"`
+	Quantity              int    `json:"quantity,omitempty"`
+	Price                 int64  `json:"price,omitempty"`
+	Currency              string `json:"currency,omitempty"`
+	OfferDiscountType     string `json:"offerDiscountType,omitempty"`
+	RevocationDate        int64  `json:"revocationDate,omitempty"`
+	RevocationReason      *int   `json:"revocationReason,omitempty"`
+	AppAccountToken       string `json:"appAccountToken,omitempty"`
+	Environment           string `json:"environment,omitempty"`
+	jwt.RegisteredClaims
+}
+
+// AppStoreRenewalInfo is the decoded payload of a JWSRenewalInfo signed by the App Store
+type AppStoreRenewalInfo struct {
+	OriginalTransactionID  string `json:"originalTransactionId"`
+	AutoRenewProductID     string `json:"autoRenewProductId,omitempty"`
+	AutoRenewStatus        int    `json:"autoRenewStatus"`
+	IsInBillingRetryPeriod bool   `json:"isInBillingRetryPeriod,omitempty"`
+	GracePeriodExpiresDate int64  `json:"gracePeriodExpiresDate,omitempty"`
+	Environment            string `json:"environment,omitempty"`
+	jwt.RegisteredClaims
+}
+
+// AppStoreNotification is the decoded payload of an App Store Server Notification V2
+type AppStoreNotification struct {
+	NotificationType string                   `json:"notificationType"`
+	Subtype          string                   `json:"subtype,omitempty"`
+	NotificationUUID string                   `json:"notificationUUID"`
+	Data             AppStoreNotificationData `json:"data"`
+	jwt.RegisteredClaims
+}
+
+// AppStoreNotificationData carries the signed transaction and renewal info of a notification
+type AppStoreNotificationData struct {
+	BundleID              string `json:"bundleId"`
+	Environment           string `json:"environment,omitempty"`
+	SignedTransactionInfo string `json:"signedTransactionInfo,omitempty"`
+	SignedRenewalInfo     string `json:"signedRenewalInfo,omitempty"`
+}
+
+// AppStoreVerifier verifies JWS payloads signed by the App Store. Each payload carries its
+// certificate chain in the x5c header; the chain must lead to one of the configured Apple
+// roots, and the leaf key must have signed the payload with ES256.
+type AppStoreVerifier struct {
+	bundleID string
+	roots    *x509.CertPool
+}
+
+// NewAppStoreVerifier creates a verifier for payloads of the app with bundleID that chain
+// to one of roots
+func NewAppStoreVerifier(bundleID string, roots *x509.CertPool) *AppStoreVerifier {
+	return &AppStoreVerifier{bundleID: bundleID, roots: roots}
+}
+
+// LoadAppStoreRootCertificates reads the Apple root certificates from the given PEM or
+// DER files, e.g. AppleRootCA-G3.cer downloaded from apple.com/certificateauthority
+func LoadAppStoreRootCertificates(paths []string) (*x509.CertPool, error) {
+	pool := x509.NewCertPool()
+	loaded := 0
+	for _, path := range paths {
+		path = strings.TrimSpace(path)
+		if path == "" {
+			continue
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read Apple root certificate: %w", err)
+		}
+		if block, _ := pem.Decode(data); block != nil {
+			data = block.Bytes
+		}
+		cert, err := x509.ParseCertificate(data)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse Apple root certificate %s: %w", path, err)
+		}
+		pool.AddCert(cert)
+		loaded++
+	}
+	if loaded == 0 {
+		return nil, errors.New("no Apple root certificates configured")
+	}
+	return pool, nil
+}
+
+// VerifyTransaction verifies a signed transaction and checks it belongs to our app
+func (v *AppStoreVerifier) VerifyTransaction(signed string) (*AppStoreTransaction, error) {
+	tx := &AppStoreTransaction{}
+	if err := v.verify(signed, tx); err != nil {
+		return nil, err
+	}
+	if tx.BundleID != v.bundleID {
+		return nil, fmt.Errorf("%w: transaction is for bundle %q", ErrInvalidStorePurchase, tx.BundleID)
+	}
+	if tx.TransactionID == "" || tx.OriginalTransactionID == "" {
+		return nil, fmt.Errorf("%w: transaction is missing its IDs", ErrInvalidStorePurchase)
+	}
+	return tx, nil
+}
+
+// VerifyRenewalInfo verifies signed renewal info
+func (v *AppStoreVerifier) VerifyRenewalInfo(signed string) (*AppStoreRenewalInfo, error) {
+	info := &AppStoreRenewalInfo{}
+	if err := v.verify(signed, info); err != nil {
+		return nil, err
+	}
+	return info, nil
+}
+
+// VerifyNotification verifies the signed payload of a server notification and checks
+// it belongs to our app. The transaction and renewal info inside are verified separately.
+func (v *AppStoreVerifier) VerifyNotification(signed string) (*AppStoreNotification, error) {
+	notification := &AppStoreNotification{}
+	if err := v.verify(signed, notification); err != nil {
+		return nil, err
+	}
+	if notification.NotificationUUID == "" {
+		return nil, fmt.Errorf("%w: notification has no UUID", ErrInvalidStorePurchase)
+	}
+	// TEST notifications carry no app data
+	if notification.Data.BundleID != "" && notification.Data.BundleID != v.bundleID {
+		return nil, fmt.Errorf("%w: notification is for bundle %q", ErrInvalidStorePurchase, notification.Data.BundleID)
+	}
+	return notification, nil
+}
+
+func (v *AppStoreVerifier) verify(signed string, claims jwt.Claims) error {
+	_, err := jwt.ParseWithClaims(signed, claims, func(token *jwt.Token) (interface{}, error) {
+		chain, err := parseCertificateChain(token.Header["x5c"])
+		if err != nil {
+			return nil, err
+		}
+		leaf := chain[0]
+
+		intermediates := x509.NewCertPool()
+		for _, cert := range chain[1:] {
+			intermediates.AddCert(cert)
+		}
+		if _, err := leaf.Verify(x509.VerifyOptions{
+			Roots:         v.roots,
+			Intermediates: intermediates,
+			KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageAny},
+		}); err != nil {
+			return nil, fmt.Errorf("certificate chain is not trusted: %w", err)
+		}
+		if !hasCertificateExtension(leaf, appleLeafCertificateOID) || !hasCertificateExtension(chain[1], appleIntermediateCertificateOID) {
+			return nil, errors.New("certificate chain is not an App Store signing chain")
+		}
+
+		key, ok := leaf.PublicKey.(*ecdsa.PublicKey)
+		if !ok {
+			return nil, utils.ErrAlgorithmMismatch
+		}
+		return key, nil
+	}, jwt.WithValidMethods([]string{"ES256"}))
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidStorePurchase, err)
+	}
+	return nil
+}
+
+// parseCertificateChain decodes an x5c header: base64 DER certificates, leaf first,
+// followed by at least the intermediate
+func parseCertificateChain(header interface{}) ([]*x509.Certificate, error) {
+	entries, ok := header.([]interface{})
+	if !ok || len(entries) < 2 {
+		return nil, errors.New("missing x5c certificate chain")
+	}
+
+	chain := make([]*x509.Certificate, 0, len(entries))
+	for _, entry := range entries {
+		encoded, ok := entry.(string)
+		if !ok {
+			return nil, errors.New("malformed x5c certificate")
+		}
+		der, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil {
+			return nil, fmt.Errorf("malformed x5c certificate: %w", err)
+		}
+		cert, err := x509.ParseCertificate(der)
+		if err != nil {
+			return nil, fmt.Errorf("malformed x5c certificate: %w", err)
+		}
+		chain = append(chain, cert)
+	}
+	return chain, nil
+}
+
+func hasCertificateExtension(cert *x509.Certificate, oid asn1.ObjectIdentifier) bool {
+	for _, ext := range cert.Extensions {
+		if ext.Id.Equal(oid) {
+			return true
+		}
+	}
+	return false
+}
+
+// appStoreTime converts an App Store millisecond timestamp
+func appStoreTime(ms int64) time.Time {
+	return time.UnixMilli(ms)
+}
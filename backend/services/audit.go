@@ -0,0 +1,288 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"mobile-backend/config"
+	"mobile-backend/models"
+
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+const (
+	// auditChainLockKey is the postgres advisory lock that serializes appends across instances
+	auditChainLockKey = 7_301_947_113
+	// auditBatchSize bounds how many events are loaded at once when exporting or verifying
+	auditBatchSize = 500
+)
+
+var ErrInvalidAuditFilter = errors.New("invalid audit filter")
+
+// AuditFilter selects audit events. Zero values are ignored. An Action ending in ".*"
+// matches every action with that prefix, such as "auth.*".
+type AuditFilter struct {
+	ActorID        *uint
+	Action         string
+	ResourceType   string
+	ResourceID     string
+	OrganizationID *uint
+	From           *time.Time
+	To             *time.Time
+	Page           int
+	Limit          int
+}
+
+// AuditChainVerification reports the result of re-checking the hash chain
+type AuditChainVerification struct {
+	Valid          bool  `json:"valid"`
+	EventsChecked  int64 `json:"events_checked"`
+	FirstInvalidID *uint `json:"first_invalid_id,omitempty"`
+}
+
+// AuditService appends events to the persistent audit log and queries it. Events are
+// chained by hash so that edits or deletions made directly in the database are detectable.
+type AuditService struct {
+	db     *gorm.DB
+	logger *config.Logger
+	mu     sync.Mutex
+}
+
+// NewAuditService creates a new audit service
+func NewAuditService(db *gorm.DB, logger *config.Logger) *AuditService {
+	return &AuditService{
+		db:     db,
+		logger: logger,
+	}
+}
+
+// Record appends an event to the audit log. Auditing never fails the action being
+// audited, so errors are logged rather than returned. Safe to call on a nil service.
+func (s *AuditService) Record(ctx context.Context, event *models.AuditEvent) {
+	if s == nil || event == nil {
+		return
+	}
+
+	if err := s.append(ctx, event); err != nil {
+		s.logger.LogError(ctx, err, "Failed to record audit event",
+			zap.String("audit_action", event.Action),
+			zap.String("audit_resource", event.ResourceType),
+		)
+		return
+	}
+
+	s.logger.LogAudit(ctx, event.Action, event.ResourceType,
+		zap.Uint("audit_event_id", event.ID),
+		zap.String("resource_id", event.ResourceID),
+		zap.String("actor_type", event.ActorType),
+	)
+}
+
+func (s *AuditService) append(ctx context.Context, event *models.AuditEvent) error {
+	if event.Action == "" {
+		return errors.New("audit event has no action")
+	}
+	if event.ActorType == "" {
+		event.ActorType = models.AuditActorSystem
+		if event.ActorID != nil {
+			event.ActorType = models.AuditActorUser
+		}
+	}
+
+	// Store maps in the form they are read back in so the hash can be recomputed later
+	var err error
+	if event.Before, err = normalizeAuditMap(event.Before); err != nil {
+		return err
+	}
+	if event.After, err = normalizeAuditMap(event.After); err != nil {
+		return err
+	}
+	if event.Metadata, err = normalizeAuditMap(event.Metadata); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if tx.Dialector.Name() == "postgres" {
+			if err := tx.Exec("SELECT pg_advisory_xact_lock(?)", auditChainLockKey).Error; err != nil {
+				return fmt.Errorf("failed to lock audit chain: %w", err)
+			}
+		}
+
+		var last models.AuditEvent
+		err := tx.Select("hash").Order("id DESC").Limit(1).Take(&last).Error
+		if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+			return fmt.Errorf("failed to load audit chain head: %w", err)
+		}
+
+		// Postgres keeps microseconds, so the hash must not cover anything finer
+		event.CreatedAt = time.Now().UTC().Truncate(time.Microsecond)
+		event.PrevHash = last.Hash
+		if event.Hash, err = event.ComputeHash(); err != nil {
+			return fmt.Errorf("failed to hash audit event: %w", err)
+		}
+
+		if err := tx.Create(event).Error; err != nil {
+			return fmt.Errorf("failed to store audit event: %w", err)
+		}
+		return nil
+	})
+}
+
+// ListEvents returns a page of events matching the filter, newest first, and the total count
+func (s *AuditService) ListEvents(ctx context.Context, filter AuditFilter) ([]models.AuditEvent, int64, error) {
+	query, err := s.filteredQuery(ctx, filter)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	var total int64
+	if err := query.Model(&models.AuditEvent{}).Count(&total).Error; err != nil {
+		return nil, 0, fmt.Errorf("failed to count audit events: %w", err)
+	}
+
+	page, limit := filter.Page, filter.Limit
+	if page < 1 {
+		page = 1
+	}
+	if limit < 1 || limit > 100 {
+		limit = 20
+	}
+
+	var events []models.AuditEvent
+	if err := query.Order("id DESC").Offset((page - 1) * limit).Limit(limit).Find(&events).Error; err != nil {
+		return nil, 0, fmt.Errorf("failed to list audit events: %w", err)
+	}
+	return events, total, nil
+}
+
+// ExportEvents streams every event matching the filter to fn, oldest first, in batches.
+// Pagination fields of the filter are ignored.
+func (s *AuditService) ExportEvents(ctx context.Context, filter AuditFilter, fn func(*models.AuditEvent) error) error {
+	query, err := s.filteredQuery(ctx, filter)
+	if err != nil {
+		return err
+	}
+
+	var batch []models.AuditEvent
+	result := query.FindInBatches(&batch, auditBatchSize, func(tx *gorm.DB, _ int) error {
+		for i := range batch {
+			if err := fn(&batch[i]); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if result.Error != nil {
+		return fmt.Errorf("failed to export audit events: %w", result.Error)
+	}
+	return nil
+}
+
+// VerifyChain recomputes every event's hash and checks that it links to its predecessor.
+// It reports the first event at which the chain no longer holds.
+func (s *AuditService) VerifyChain(ctx context.Context) (*AuditChainVerification, error) {
+	verification := &AuditChainVerification{Valid: true}
+	prevHash := ""
+
+	var batch []models.AuditEvent
+	result := s.db.WithContext(ctx).Model(&models.AuditEvent{}).FindInBatches(&batch, auditBatchSize, func(tx *gorm.DB, _ int) error {
+		for i := range batch {
+			event := &batch[i]
+			verification.EventsChecked++
+
+			hash, err := event.ComputeHash()
+			if err != nil {
+				return fmt.Errorf("failed to hash audit event %d: %w", event.ID, err)
+			}
+			if event.PrevHash != prevHash || event.Hash != hash {
+				id := event.ID
+				verification.Valid = false
+				verification.FirstInvalidID = &id
+				return errAuditChainBroken
+			}
+			prevHash = event.Hash
+		}
+		return nil
+	})
+	if result.Error != nil && !errors.Is(result.Error, errAuditChainBroken) {
+		return nil, fmt.Errorf("failed to verify audit chain: %w", result.Error)
+	}
+
+	if !verification.Valid {
+		s.logger.LogSecurityEvent(ctx, "audit_chain_broken", "critical",
+			zap.Uint("first_invalid_id", *verification.FirstInvalidID),
+		)
+	}
+	return verification, nil
+}
+
+// auditLikeEscaper escapes LIKE wildcards so action names match literally
+var auditLikeEscaper = strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`)
+
+// errAuditChainBroken stops verification at the first broken link
+var errAuditChainBroken = errors.New("audit chain broken")
+
+func (s *AuditService) filteredQuery(ctx context.Context, filter AuditFilter) (*gorm.DB, error) {
+	query := s.db.WithContext(ctx).Model(&models.AuditEvent{})
+
+	if filter.ActorID != nil {
+		query = query.Where("actor_id = ?", *filter.ActorID)
+	}
+	if filter.Action != "" {
+		if prefix, ok := strings.CutSuffix(filter.Action, ".*"); ok {
+			if prefix == "" || strings.Contains(prefix, "*") {
+				return nil, fmt.Errorf("%w: action pattern %q", ErrInvalidAuditFilter, filter.Action)
+			}
+			query = query.Where(`action LIKE ? ESCAPE '\'`, auditLikeEscaper.Replace(prefix)+".%")
+		} else {
+			query = query.Where("action = ?", filter.Action)
+		}
+	}
+	if filter.ResourceType != "" {
+		query = query.Where("resource_type = ?", filter.ResourceType)
+	}
+	if filter.ResourceID != "" {
+		query = query.Where("resource_id = ?", filter.ResourceID)
+	}
+	if filter.OrganizationID != nil {
+		query = query.Where("organization_id = ?", *filter.OrganizationID)
+	}
+	if filter.From != nil {
+		query = query.Where("created_at >= ?", filter.From.UTC())
+	}
+	if filter.To != nil {
+		query = query.Where("created_at < ?", filter.To.UTC())
+	}
+	if filter.From != nil && filter.To != nil && !filter.From.Before(*filter.To) {
+		return nil, fmt.Errorf("%w: from must be before to", ErrInvalidAuditFilter)
+	}
+	// A new session so counting and then finding on the same query don't interfere
+	return query.Session(&gorm.Session{}), nil
+}
+
+// normalizeAuditMap round-trips a map through JSON so numbers and nested values take the
+// same shape they have after being read from the database. Empty maps become nil.
+func normalizeAuditMap(m models.JSONMap) (models.JSONMap, error) {
+	if len(m) == 0 {
+		return nil, nil
+	}
+
+	data, err := json.Marshal(m)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode audit details: %w", err)
+	}
+	var normalized models.JSONMap
+	if err := json.Unmarshal(data, &normalized); err != nil {
+		return nil, fmt.Errorf("failed to encode audit details: %w", err)
+	}
+	return normalized, nil
+}
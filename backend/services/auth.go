@@ -3,39 +3,93 @@ package services
 import (
 	"context"
 	"errors"
+	"fmt"
+	"strings"
 	"time"
 
+	"mobile-backend/config"
 	"mobile-backend/models"
 	"mobile-backend/utils"
 
+	"go.uber.org/zap"
 	"gorm.io/gorm"
 )
 
+var (
+	ErrInvalidRefreshToken = errors.New("invalid refresh token")
+	ErrUserNotFound        = errors.New("user not found")
+	// ErrImpersonationNotAllowed is returned when the target user cannot be impersonated
+	ErrImpersonationNotAllowed = errors.New("this user cannot be impersonated")
+	ErrInvalidCurrentPassword  = errors.New("current password is incorrect")
+	// ErrPasswordResetRequired is returned when an administrator has forced a password reset
+	ErrPasswordResetRequired = errors.New("password reset required")
+	// ErrPasswordExpired is returned with a password change token when a login finds the
+	// password older than the policy allows
+	ErrPasswordExpired = errors.New("password expired")
+	// ErrInvalidPasswordChangeToken is returned for a missing, expired or used password change token
+	ErrInvalidPasswordChangeToken = errors.New("invalid or expired password change token")
+	ErrUserAlreadyExists          = errors.New("user already exists")
+	ErrAccountDeactivated         = errors.New("account is deactivated")
+)
+
 type AuthService struct {
-	db    *gorm.DB
-	cache *CacheService
+	db          *gorm.DB
+	cache       *CacheService
+	revocations *TokenBlacklistService
+	roles       *RoleService
+	sessions    *SessionService
+	mfa         *MFAService
+	lockout     *LoginLockoutService
+	passwords   *PasswordPolicyService
+	devices     *DeviceService
+	logger      *config.Logger
 }
 
-func NewAuthService(db *gorm.DB, cache *CacheService) *AuthService {
+// NewAuthService creates a new auth service. lockout may be nil to disable failed-login
+// tracking, and passwords may be nil to accept any password.
+func NewAuthService(db *gorm.DB, cache *CacheService, revocations *TokenBlacklistService, lockout *LoginLockoutService, passwords *PasswordPolicyService, logger *config.Logger) *AuthService {
+	mfa := NewMFAService(db, logger)
+	mfa.SetLoginLockout(lockout)
+
 	return &AuthService{
-		db:    db,
-		cache: cache,
+		db:          db,
+		cache:       cache,
+		revocations: revocations,
+		lockout:     lockout,
+		passwords:   passwords,
+		roles:       NewRoleService(db),
+		sessions:    NewSessionService(db, revocations, logger),
+		mfa:         mfa,
+		logger:      logger,
 	}
 }
 
+// SetDeviceRegistry records the device of every login in devices; nil stops tracking devices
+func (s *AuthService) SetDeviceRegistry(devices *DeviceService) {
+	s.devices = devices
+}
+
 func (s *AuthService) RegisterUser(email, password, name string) (*models.User, error) {
+	email = normalizeEmail(email)
+
 	// Check if user already exists
 	var existingUser models.User
-	if err := s.db.Where("email = ?", email).First(&existingUser).Error; err == nil {
-		return nil, errors.New("user already exists")
+	if err := s.db.Where("LOWER(email) = ?", email).First(&existingUser).Error; err == nil {
+		return nil, ErrUserAlreadyExists
+	}
+
+	if err := s.passwords.Validate(context.Background(), nil, password); err != nil {
+		return nil, err
 	}
 
 	// Create new user
+	now := time.Now()
 	user := &models.User{
-		Email:    email,
-		Password: password, // Will be hashed by GORM BeforeCreate hook
-		Name:     name,
-		IsActive: true,
+		Email:             email,
+		Password:          password, // Will be hashed by GORM BeforeCreate hook
+		Name:              name,
+		IsActive:          true,
+		PasswordChangedAt: &now,
 	}
 
 	// Save user to database
@@ -46,11 +100,21 @@ func (s *AuthService) RegisterUser(email, password, name string) (*models.User,
 	return user, nil
 }
 
-func (s *AuthService) LoginUser(email, password string) (*models.User, string, error) {
+// LoginUser checks the user's password. Failed attempts are tracked per account and per
+// client IP; once too many fail, attempts are refused with a *LoginRetryError.
+func (s *AuthService) LoginUser(ctx context.Context, email, password, clientIP string) (*models.User, string, error) {
+	email = normalizeEmail(email)
+	if s.lockout != nil {
+		if err := s.lockout.Check(ctx, email, clientIP); err != nil {
+			return nil, "", err
+		}
+	}
+
 	// Find user by email
 	var user models.User
-	if err := s.db.Where("email = ?", email).First(&user).Error; err != nil {
+	if err := s.db.WithContext(ctx).Where("LOWER(email) = ?", email).First(&user).Error; err != nil {
 		if err == gorm.ErrRecordNotFound {
+			s.recordLoginFailure(ctx, nil, email, clientIP)
 			return nil, "", errors.New("invalid credentials")
 		}
 		return nil, "", err
@@ -58,13 +122,39 @@ func (s *AuthService) LoginUser(email, password string) (*models.User, string, e
 
 	// Check if user is active
 	if !user.IsActive {
-		return nil, "", errors.New("account is deactivated")
+		return nil, "", ErrAccountDeactivated
+	}
+
+	if user.IsLocked() {
+		return nil, "", &LoginRetryError{Err: ErrAccountLocked, RetryAfter: time.Until(*user.LockedUntil)}
 	}
 
 	// Verify password
 	if err := user.CheckPassword(password); err != nil {
+		s.recordLoginFailure(ctx, &user, email, clientIP)
 		return nil, "", errors.New("invalid credentials")
 	}
+	if user.PasswordResetRequired {
+		return nil, "", ErrPasswordResetRequired
+	}
+	s.upgradePasswordHash(ctx, &user, password)
+
+	if config.RequireVerifiedEmailForLogin() && !user.IsEmailVerified() {
+		return nil, "", ErrEmailNotVerified
+	}
+
+	// Users with two-factor enabled get a challenge token instead of a session. Their
+	// failures are only cleared once the second factor checks out too, so logging in
+	// again with the password doesn't buy more guesses at the code.
+	if challenge, err := s.mfaChallenge(ctx, &user, utils.AuthMethodPassword); err != nil {
+		return &user, challenge, err
+	}
+	s.recordLoginSuccess(ctx, &user, email)
+
+	// An expired password gets a password change token instead of a session
+	if changeToken, err := s.passwordChangeChallenge(&user); err != nil {
+		return &user, changeToken, err
+	}
 
 	// Update last login
 	now := time.Now()
@@ -89,6 +179,499 @@ func (s *AuthService) LoginUser(email, password string) (*models.User, string, e
 	return &user, token, nil
 }
 
+// recordLoginFailure counts a failed password attempt. Tracking errors are logged rather
+// than returned so they never change the response to a wrong password.
+func (s *AuthService) recordLoginFailure(ctx context.Context, user *models.User, email, clientIP string) {
+	if s.lockout == nil {
+		return
+	}
+	if err := s.lockout.RecordFailure(ctx, user, email, clientIP); err != nil {
+		s.logger.WarnWithContext(ctx, "Failed to record login failure", zap.Error(err))
+	}
+}
+
+// recordLoginSuccess clears the account's failed attempts once a login has completed
+func (s *AuthService) recordLoginSuccess(ctx context.Context, user *models.User, email string) {
+	if s.lockout == nil {
+		return
+	}
+	if err := s.lockout.RecordSuccess(ctx, email); err != nil {
+		s.logger.WarnWithContext(ctx, "Failed to reset login failures", zap.Uint("user_id", user.ID), zap.Error(err))
+	}
+}
+
+// LoginExternalUser completes a login whose first factor was verified elsewhere, such as
+// by an OAuth2 provider or a passwordless sign in. Like LoginUser it refuses locked
+// accounts and accounts waiting for an administrator-forced password reset, and returns
+// ErrMFARequired with a challenge token when the user has two-factor authentication enabled.
+func (s *AuthService) LoginExternalUser(ctx context.Context, user *models.User, clientIP string) (string, error) {
+	if s.lockout != nil {
+		if err := s.lockout.Check(ctx, user.Email, clientIP); err != nil {
+			return "", err
+		}
+	}
+	if !user.IsActive {
+		return "", ErrAccountDeactivated
+	}
+	if user.IsLocked() {
+		return "", &LoginRetryError{Err: ErrAccountLocked, RetryAfter: time.Until(*user.LockedUntil)}
+	}
+	if user.PasswordResetRequired {
+		return "", ErrPasswordResetRequired
+	}
+
+	if challenge, err := s.mfaChallenge(ctx, user, utils.AuthMethodExternal); err != nil {
+		return challenge, err
+	}
+	s.recordLoginSuccess(ctx, user, user.Email)
+
+	now := time.Now()
+	user.LastLogin = &now
+	if err := s.db.WithContext(ctx).Model(user).Update("last_login", now).Error; err != nil {
+		return "", err
+	}
+	return "", nil
+}
+
+// mfaChallenge returns ErrMFARequired and a challenge token when the user has two-factor
+// enabled. authMethod records how the user passed the first step.
+func (s *AuthService) mfaChallenge(ctx context.Context, user *models.User, authMethod string) (string, error) {
+	mfaEnabled, err := s.mfa.IsEnabled(ctx, user.ID)
+	if err != nil {
+		return "", err
+	}
+	if !mfaEnabled {
+		return "", nil
+	}
+
+	challenge, err := utils.GenerateMFAChallengeToken(user.ID, user.Email, authMethod)
+	if err != nil {
+		return "", err
+	}
+	return challenge, ErrMFARequired
+}
+
+// passwordChangeChallenge returns ErrPasswordExpired and a password change token when the
+// user's password is older than the policy allows
+func (s *AuthService) passwordChangeChallenge(user *models.User) (string, error) {
+	if !s.PasswordExpired(user) {
+		return "", nil
+	}
+
+	changeToken, err := utils.GeneratePasswordChangeToken(user.ID, user.Email)
+	if err != nil {
+		return "", err
+	}
+	return changeToken, ErrPasswordExpired
+}
+
+// GenerateTokens starts a new session for the user and issues its first access/refresh
+// token pair, embedding the user's current roles and permissions in the access token
+func (s *AuthService) GenerateTokens(ctx context.Context, user *models.User, meta SessionMetadata) (string, string, error) {
+	// A failure to track the device shouldn't stop the user from signing in
+	if s.devices != nil {
+		device, _, err := s.devices.RecordLogin(ctx, user.ID, meta)
+		if err != nil {
+			s.logger.LogError(ctx, err, "Failed to record login device", zap.Uint("user_id", user.ID))
+		} else {
+			meta.UserDeviceID = &device.ID
+		}
+	}
+
+	session, refreshTokenID, err := s.sessions.CreateSession(ctx, user.ID, meta)
+	if err != nil {
+		return "", "", err
+	}
+
+	return s.issueTokens(ctx, user, session, refreshTokenID)
+}
+
+// RefreshTokens rotates the session the refresh token belongs to and issues a new token pair.
+// Presenting a refresh token that was already rotated revokes the whole session.
+func (s *AuthService) RefreshTokens(ctx context.Context, refreshToken string, meta SessionMetadata) (*models.User, string, string, error) {
+	claims, err := utils.ValidateRefreshToken(refreshToken)
+	if err != nil {
+		return nil, "", "", ErrInvalidRefreshToken
+	}
+
+	// Refresh tokens issued before sessions were introduced can't be rotated
+	if claims.SessionID == "" || claims.ID == "" {
+		return nil, "", "", ErrInvalidRefreshToken
+	}
+
+	session, nextTokenID, err := s.sessions.RotateSession(ctx, claims.SessionID, claims.ID, meta)
+	if err != nil {
+		if errors.Is(err, ErrSessionNotFound) || errors.Is(err, ErrSessionRevoked) {
+			return nil, "", "", ErrInvalidRefreshToken
+		}
+		return nil, "", "", err
+	}
+
+	// Reload the user so role changes and deletions take effect on refresh
+	user, err := s.GetUserByID(session.UserID)
+	if err != nil || !user.IsActive {
+		if revokeErr := s.sessions.RevokeSessionByFamily(ctx, session.FamilyID, models.SessionRevokedLogout); revokeErr != nil {
+			return nil, "", "", revokeErr
+		}
+		return nil, "", "", ErrInvalidRefreshToken
+	}
+
+	// A guest is bound to its device, so its refresh token is only good on that device
+	if user.IsGuest && meta.DeviceID != session.DeviceID {
+		if revokeErr := s.sessions.RevokeSessionByFamily(ctx, session.FamilyID, models.SessionRevokedDeviceMismatch); revokeErr != nil {
+			return nil, "", "", revokeErr
+		}
+		return nil, "", "", ErrInvalidRefreshToken
+	}
+
+	if s.devices != nil && session.UserDeviceID != nil {
+		if err := s.devices.Touch(ctx, *session.UserDeviceID, meta.IPAddress); err != nil {
+			s.logger.LogError(ctx, err, "Failed to update login device", zap.Uint("user_id", user.ID))
+		}
+	}
+
+	accessToken, newRefreshToken, err := s.issueTokens(ctx, user, session, nextTokenID)
+	if err != nil {
+		return nil, "", "", err
+	}
+
+	return user, accessToken, newRefreshToken, nil
+}
+
+// VerifyMFAChallenge completes a login that required a second factor. It returns the
+// user once both the challenge token and the TOTP or recovery code are valid. Wrong
+// codes count as failed logins of the account, and a challenge is revoked after a few
+// of them so a new one needs the first factor again. Like LoginUser it returns
+// ErrPasswordExpired with a password change token when the login started with an
+// expired password.
+func (s *AuthService) VerifyMFAChallenge(ctx context.Context, challengeToken, code, clientIP string) (*models.User, string, error) {
+	claims, err := utils.ValidateMFAChallengeToken(challengeToken)
+	if err != nil {
+		return nil, "", ErrInvalidMFAToken
+	}
+
+	revoked, err := s.revocations.IsRevoked(ctx, claims)
+	if err != nil {
+		return nil, "", err
+	}
+	if revoked {
+		return nil, "", ErrInvalidMFAToken
+	}
+
+	user, err := s.GetUserByID(claims.UserID)
+	if err != nil || !user.IsActive {
+		return nil, "", ErrInvalidMFAToken
+	}
+
+	if err := s.mfa.VerifyAttempt(ctx, user, code, clientIP); err != nil {
+		if errors.Is(err, ErrInvalidMFACode) {
+			s.recordChallengeFailure(ctx, claims, user, clientIP)
+		}
+		return nil, "", err
+	}
+
+	// A challenge token completes a single login
+	if err := s.revocations.RevokeToken(ctx, claims.ID, claims.ExpiresAt.Time); err != nil {
+		return nil, "", err
+	}
+
+	// Logins through an external provider never saw the password, so only password
+	// logins are held up by its age
+	if claims.AuthMethod == utils.AuthMethodPassword {
+		if changeToken, err := s.passwordChangeChallenge(user); err != nil {
+			return user, changeToken, err
+		}
+	}
+
+	// Mirror the bookkeeping of a single-factor login
+	now := time.Now()
+	user.LastLogin = &now
+	if err := s.db.WithContext(ctx).Model(user).Update("last_login", now).Error; err != nil {
+		return nil, "", err
+	}
+
+	return user, "", nil
+}
+
+// recordChallengeFailure counts a wrong code against the challenge and revokes the
+// challenge once it has run out of attempts
+func (s *AuthService) recordChallengeFailure(ctx context.Context, claims *utils.Claims, user *models.User, clientIP string) {
+	if s.lockout == nil {
+		return
+	}
+
+	exhausted, err := s.lockout.RecordChallengeFailure(ctx, claims.ID, claims.ExpiresAt.Time)
+	if err != nil {
+		s.logger.WarnWithContext(ctx, "Failed to record mfa challenge failure", zap.Uint("user_id", user.ID), zap.Error(err))
+		return
+	}
+	if !exhausted {
+		return
+	}
+
+	if err := s.revocations.RevokeToken(ctx, claims.ID, claims.ExpiresAt.Time); err != nil {
+		s.logger.WarnWithContext(ctx, "Failed to revoke mfa challenge", zap.Uint("user_id", user.ID), zap.Error(err))
+		return
+	}
+	s.logger.LogSecurityEvent(ctx, "mfa_challenge_revoked", "medium", zap.Uint("user_id", user.ID), zap.String("ip", clientIP))
+}
+
+// SwitchOrganization makes organizationID the active organization of the session the
+// refresh token belongs to and rotates it, returning a token pair carrying the new
+// org_id claim. The caller must have checked the user's membership.
+func (s *AuthService) SwitchOrganization(ctx context.Context, userID uint, refreshToken string, organizationID *uint, meta SessionMetadata) (*models.User, string, string, error) {
+	claims, err := utils.ValidateRefreshToken(refreshToken)
+	if err != nil || claims.UserID != userID || claims.SessionID == "" {
+		return nil, "", "", ErrInvalidRefreshToken
+	}
+
+	if err := s.sessions.SetOrganization(ctx, claims.SessionID, organizationID); err != nil {
+		if errors.Is(err, ErrSessionNotFound) {
+			return nil, "", "", ErrInvalidRefreshToken
+		}
+		return nil, "", "", err
+	}
+
+	return s.RefreshTokens(ctx, refreshToken, meta)
+}
+
+func (s *AuthService) issueTokens(ctx context.Context, user *models.User, session *models.Session, refreshTokenID string) (string, string, error) {
+	roles, permissions, err := s.roles.GetUserAuthorization(ctx, user.ID)
+	if err != nil {
+		return "", "", err
+	}
+
+	opts := utils.TokenOptions{
+		Roles:          roles,
+		Permissions:    permissions,
+		SessionID:      session.FamilyID,
+		RefreshTokenID: refreshTokenID,
+	}
+	if session.OrganizationID != nil {
+		opts.OrganizationID = *session.OrganizationID
+	}
+
+	accessToken, refreshToken, err := utils.GenerateAccessAndRefreshTokensWithOptions(user.ID, user.Email, opts)
+	if err != nil {
+		return "", "", fmt.Errorf("failed to sign tokens: %w", err)
+	}
+
+	return accessToken, refreshToken, nil
+}
+
+// ListSessions returns the user's active sessions
+func (s *AuthService) ListSessions(ctx context.Context, userID uint) ([]models.Session, error) {
+	return s.sessions.ListActiveSessions(ctx, userID)
+}
+
+// RevokeSession revokes one of the user's sessions
+func (s *AuthService) RevokeSession(ctx context.Context, userID, sessionID uint) error {
+	return s.sessions.RevokeSession(ctx, userID, sessionID, models.SessionRevokedByUser)
+}
+
+// RevokeAllSessions revokes all of the user's sessions except the one identified by exceptSessionID, if set
+func (s *AuthService) RevokeAllSessions(ctx context.Context, userID uint, exceptSessionID string) error {
+	return s.sessions.RevokeAllSessions(ctx, userID, exceptSessionID, models.SessionRevokedLogoutAll)
+}
+
+// RevokeAllTokens signs the user out everywhere on an administrator's behalf: every
+// session ends and every access token already issued stops working
+func (s *AuthService) RevokeAllTokens(ctx context.Context, userID, revokedBy uint) error {
+	if _, err := s.GetUserByID(userID); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrUserNotFound
+		}
+		return err
+	}
+
+	if err := s.sessions.RevokeAllSessions(ctx, userID, "", models.SessionRevokedByAdmin); err != nil {
+		return err
+	}
+
+	s.logger.LogSecurityEvent(ctx, "user_tokens_revoked", "medium",
+		zap.Uint("user_id", userID),
+		zap.Uint("revoked_by", revokedBy),
+	)
+	return nil
+}
+
+// UnlockUser lifts a failed-login lockout on the user's account
+func (s *AuthService) UnlockUser(ctx context.Context, userID, unlockedBy uint) error {
+	if s.lockout == nil {
+		if err := s.db.WithContext(ctx).Model(&models.User{}).Where("id = ?", userID).Update("locked_until", nil).Error; err != nil {
+			return fmt.Errorf("failed to unlock user: %w", err)
+		}
+		return nil
+	}
+	return s.lockout.Unlock(ctx, userID, unlockedBy)
+}
+
+// ChangePassword replaces the user's password after checking the current one and the
+// password policy, then signs the user out of every other session.
+func (s *AuthService) ChangePassword(ctx context.Context, userID uint, currentPassword, newPassword, currentSessionID string) error {
+	user, err := s.GetUserByID(userID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrUserNotFound
+		}
+		return err
+	}
+
+	if err := user.CheckPassword(currentPassword); err != nil {
+		return ErrInvalidCurrentPassword
+	}
+	if err := s.passwords.Validate(ctx, user, newPassword); err != nil {
+		return err
+	}
+
+	if err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		return s.passwords.SetPassword(tx, user, newPassword)
+	}); err != nil {
+		return err
+	}
+
+	if err := s.sessions.RevokeAllSessions(ctx, userID, currentSessionID, models.SessionRevokedPasswordChanged); err != nil {
+		return err
+	}
+
+	s.logger.LogSecurityEvent(ctx, "password_changed", "medium", zap.Uint("user_id", userID))
+	return nil
+}
+
+// ChangeExpiredPassword sets a new password with the token a login issued in place of a
+// session because the old one had expired. The token is good for a single change; the
+// user is returned so the caller can start the session the login was held back from.
+func (s *AuthService) ChangeExpiredPassword(ctx context.Context, changeToken, newPassword string) (*models.User, error) {
+	claims, err := utils.ValidatePasswordChangeToken(changeToken)
+	if err != nil {
+		return nil, ErrInvalidPasswordChangeToken
+	}
+
+	revoked, err := s.revocations.IsRevoked(ctx, claims)
+	if err != nil {
+		return nil, err
+	}
+	if revoked {
+		return nil, ErrInvalidPasswordChangeToken
+	}
+
+	user, err := s.GetUserByID(claims.UserID)
+	if err != nil || !user.IsActive {
+		return nil, ErrInvalidPasswordChangeToken
+	}
+
+	if err := s.passwords.Validate(ctx, user, newPassword); err != nil {
+		return nil, err
+	}
+
+	if err := s.revocations.RevokeToken(ctx, claims.ID, claims.ExpiresAt.Time); err != nil {
+		return nil, err
+	}
+
+	if err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		return s.passwords.SetPassword(tx, user, newPassword)
+	}); err != nil {
+		return nil, err
+	}
+
+	if err := s.sessions.RevokeAllSessions(ctx, user.ID, "", models.SessionRevokedPasswordChanged); err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	user.LastLogin = &now
+	if err := s.db.WithContext(ctx).Model(user).Update("last_login", now).Error; err != nil {
+		return nil, err
+	}
+
+	s.logger.LogSecurityEvent(ctx, "password_changed", "medium", zap.Uint("user_id", user.ID), zap.String("reason", "expired"))
+	return user, nil
+}
+
+// PasswordExpired reports whether the user's password is older than the policy allows
+func (s *AuthService) PasswordExpired(user *models.User) bool {
+	return s.passwords.IsExpired(user)
+}
+
+// upgradePasswordHash rehashes a just-verified password when its hash uses an outdated
+// algorithm or cost. Failures are only logged; the old hash keeps working.
+func (s *AuthService) upgradePasswordHash(ctx context.Context, user *models.User, password string) {
+	if !utils.PasswordNeedsRehash(user.Password) {
+		return
+	}
+
+	hash, err := utils.HashPassword(password)
+	if err == nil {
+		err = s.db.WithContext(ctx).Model(user).Update("password", hash).Error
+	}
+	if err != nil {
+		s.logger.WarnWithContext(ctx, "Failed to upgrade password hash", zap.Uint("user_id", user.ID), zap.Error(err))
+		return
+	}
+	user.Password = hash
+}
+
+// Impersonate issues a short-lived access token that lets the actor see the app as the
+// target user. The token carries an act claim naming the actor but none of the target's
+// roles or permissions, so staff can't borrow the target's privileges while impersonating.
+// Users cannot impersonate themselves, inactive users or administrators.
+func (s *AuthService) Impersonate(ctx context.Context, actorID, targetID uint) (*models.User, string, time.Time, error) {
+	if actorID == targetID {
+		return nil, "", time.Time{}, ErrImpersonationNotAllowed
+	}
+
+	actor, err := s.GetUserByID(actorID)
+	if err != nil {
+		return nil, "", time.Time{}, err
+	}
+	target, err := s.GetUserByID(targetID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, "", time.Time{}, ErrUserNotFound
+		}
+		return nil, "", time.Time{}, err
+	}
+	if !target.IsActive {
+		return nil, "", time.Time{}, ErrImpersonationNotAllowed
+	}
+
+	roles, _, err := s.roles.GetUserAuthorization(ctx, target.ID)
+	if err != nil {
+		return nil, "", time.Time{}, err
+	}
+	for _, role := range roles {
+		if role == models.RoleSuperAdmin || role == models.RoleAdmin {
+			return nil, "", time.Time{}, ErrImpersonationNotAllowed
+		}
+	}
+
+	token, expiresAt, err := utils.GenerateImpersonationToken(target.ID, target.Email,
+		utils.Actor{UserID: actor.ID, Email: actor.Email})
+	if err != nil {
+		return nil, "", time.Time{}, fmt.Errorf("failed to sign impersonation token: %w", err)
+	}
+
+	s.logger.LogSecurityEvent(ctx, "impersonation_started", "high",
+		zap.Uint("user_id", target.ID),
+		zap.Uint("actor_id", actor.ID),
+	)
+	return target, token, expiresAt, nil
+}
+
+// StopImpersonation revokes the impersonation token with the given ID. Impersonation
+// tokens never outlive ImpersonationTokenTTL, so the revocation lasts as long.
+func (s *AuthService) StopImpersonation(ctx context.Context, tokenID string, actorID, userID uint) error {
+	if err := s.revocations.RevokeToken(ctx, tokenID, time.Now().Add(utils.ImpersonationTokenTTL)); err != nil {
+		return err
+	}
+
+	s.logger.LogSecurityEvent(ctx, "impersonation_stopped", "medium",
+		zap.Uint("user_id", userID),
+		zap.Uint("actor_id", actorID),
+	)
+	return nil
+}
+
 func (s *AuthService) GetUserByID(userID uint) (*models.User, error) {
 	var user models.User
 	if err := s.db.First(&user, userID).Error; err != nil {
@@ -137,6 +720,26 @@ func (s *AuthService) ValidateToken(token string) (*models.User, error) {
 }
 
 func (s *AuthService) Logout(token string) error {
+	ctx := context.Background()
+	if claims, err := utils.ValidateToken(token); err == nil {
+		if err := s.revocations.RevokeToken(ctx, claims.ID, claims.ExpiresAt.Time); err != nil {
+			return err
+		}
+
+		// End the refresh token family the access token was issued for
+		if claims.SessionID != "" {
+			if err := s.sessions.RevokeSessionByFamily(ctx, claims.SessionID, models.SessionRevokedLogout); err != nil {
+				return err
+			}
+		}
+	}
+
 	sessionKey := "session:" + token
 	return s.cache.Delete(context.Background(), sessionKey)
 }
+
+// normalizeEmail is the form of an address stored on accounts and used to look them up, so
+// every sign up and sign in path agrees on whether an address is taken
+func normalizeEmail(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
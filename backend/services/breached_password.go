@@ -0,0 +1,80 @@
+package services
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// breachPrefixLength is the number of SHA-1 hex digits that name a range file
+const breachPrefixLength = 5
+
+// BreachedPasswordChecker reports how often a password appears in known data breaches
+type BreachedPasswordChecker interface {
+	BreachCount(ctx context.Context, password string) (int, error)
+}
+
+// HashPrefixBreachChecker looks passwords up in an offline copy of a breached-password
+// corpus split into k-anonymity ranges, as served by the Pwned Passwords range API. The
+// directory holds one file per 5-digit SHA-1 prefix, such as "21BD1.txt", whose lines are
+// "SUFFIX:COUNT" for the remaining 35 hex digits. Only the range file for the password's
+// prefix is ever read.
+type HashPrefixBreachChecker struct {
+	dir string
+}
+
+// NewHashPrefixBreachChecker creates a checker for the range files in dir
+func NewHashPrefixBreachChecker(dir string) (*HashPrefixBreachChecker, error) {
+	info, err := os.Stat(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open breached password dataset: %w", err)
+	}
+	if !info.IsDir() {
+		return nil, fmt.Errorf("breached password dataset %s is not a directory", dir)
+	}
+	return &HashPrefixBreachChecker{dir: dir}, nil
+}
+
+// BreachCount returns how many times the password appears in the dataset, or zero
+func (c *HashPrefixBreachChecker) BreachCount(ctx context.Context, password string) (int, error) {
+	sum := sha1.Sum([]byte(password))
+	hash := strings.ToUpper(hex.EncodeToString(sum[:]))
+	prefix, suffix := hash[:breachPrefixLength], hash[breachPrefixLength:]
+
+	file, err := os.Open(filepath.Join(c.dir, prefix+".txt"))
+	if err != nil {
+		// A corpus with no entries for a range may omit its file
+		if errors.Is(err, os.ErrNotExist) {
+			return 0, nil
+		}
+		return 0, fmt.Errorf("failed to read breached password range: %w", err)
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		if err := ctx.Err(); err != nil {
+			return 0, err
+		}
+		entry, count, found := strings.Cut(strings.TrimSpace(scanner.Text()), ":")
+		if !found || !strings.EqualFold(entry, suffix) {
+			continue
+		}
+		n, err := strconv.Atoi(count)
+		if err != nil {
+			return 0, fmt.Errorf("malformed breached password range %s: %w", prefix, err)
+		}
+		return n, nil
+	}
+	if err := scanner.Err(); err != nil {
+		return 0, fmt.Errorf("failed to read breached password range: %w", err)
+	}
+	return 0, nil
+}
@@ -0,0 +1,355 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"mobile-backend/config"
+	"mobile-backend/models"
+	"mobile-backend/utils"
+
+	"github.com/hibiken/asynq"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+var ErrDeviceNotFound = errors.New("device not found")
+
+// DeviceService keeps the per-user registry of devices that have signed in. Every login
+// records its device; the first login from a device the user hasn't used before sends
+// them a new-device alert by email and push. Revoking a device ends its sessions and
+// deactivates its push tokens.
+type DeviceService struct {
+	db            *gorm.DB
+	sessions      *SessionService
+	jobQueue      *JobQueueService
+	push          *PushNotificationService
+	logger        *config.Logger
+	alertsEnabled bool
+}
+
+// NewDeviceService creates a new device service and registers its job handler with
+// jobQueue. push may be nil to send new-device alerts by email only.
+func NewDeviceService(db *gorm.DB, jobQueue *JobQueueService, revocations *TokenBlacklistService, push *PushNotificationService, logger *config.Logger) *DeviceService {
+	s := &DeviceService{
+		db:            db,
+		sessions:      NewSessionService(db, revocations, logger),
+		jobQueue:      jobQueue,
+		push:          push,
+		logger:        logger,
+		alertsEnabled: utils.ParseBool(os.Getenv("NEW_DEVICE_ALERTS"), true),
+	}
+
+	if jobQueue != nil {
+		jobQueue.RegisterHandler(TypeNewDeviceAlert, s.handleNewDeviceAlert)
+	}
+	return s
+}
+
+// RecordLogin registers the device a login came from, or refreshes it when the user
+// has signed in from it before. isNew reports a device the user had not used yet; a
+// device the user revoked counts as new again.
+func (s *DeviceService) RecordLogin(ctx context.Context, userID uint, meta SessionMetadata) (*models.UserDevice, bool, error) {
+	now := time.Now()
+	fingerprint := deviceFingerprint(meta)
+	platform := detectPlatform(meta.Platform, meta.UserAgent)
+
+	var device models.UserDevice
+	err := s.db.WithContext(ctx).
+		Where("user_id = ? AND fingerprint = ?", userID, fingerprint).
+		First(&device).Error
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, false, fmt.Errorf("failed to load device: %w", err)
+	}
+
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		device = models.UserDevice{
+			UserID:      userID,
+			Fingerprint: fingerprint,
+			DeviceID:    meta.DeviceID,
+			Name:        deviceName(meta.DeviceName, platform),
+			Platform:    platform,
+			AppVersion:  meta.AppVersion,
+			OSVersion:   meta.OSVersion,
+			UserAgent:   meta.UserAgent,
+			FirstSeenAt: now,
+			LastSeenAt:  now,
+			LastIP:      meta.IPAddress,
+		}
+		if err := s.db.WithContext(ctx).Create(&device).Error; err != nil {
+			return nil, false, fmt.Errorf("failed to register device: %w", err)
+		}
+		s.alert(ctx, &device)
+		return &device, true, nil
+	}
+
+	isNew := device.IsRevoked()
+	updates := map[string]interface{}{
+		"platform":     platform,
+		"user_agent":   meta.UserAgent,
+		"last_seen_at": now,
+		"last_ip":      meta.IPAddress,
+	}
+	if meta.AppVersion != "" {
+		updates["app_version"] = meta.AppVersion
+	}
+	if meta.OSVersion != "" {
+		updates["os_version"] = meta.OSVersion
+	}
+	if isNew {
+		updates["first_seen_at"] = now
+		updates["revoked_at"] = nil
+		updates["trusted_at"] = nil
+	}
+	if err := s.db.WithContext(ctx).Model(&device).Updates(updates).Error; err != nil {
+		return nil, false, fmt.Errorf("failed to update device: %w", err)
+	}
+
+	if isNew {
+		s.alert(ctx, &device)
+	}
+	return &device, isNew, nil
+}
+
+// Touch records activity on a device, such as a token refresh
+func (s *DeviceService) Touch(ctx context.Context, deviceID uint, ipAddress string) error {
+	updates := map[string]interface{}{"last_seen_at": time.Now()}
+	if ipAddress != "" {
+		updates["last_ip"] = ipAddress
+	}
+	if err := s.db.WithContext(ctx).Model(&models.UserDevice{}).
+		Where("id = ? AND revoked_at IS NULL", deviceID).
+		Updates(updates).Error; err != nil {
+		return fmt.Errorf("failed to update device: %w", err)
+	}
+	return nil
+}
+
+// ListDevices returns the user's devices that haven't been revoked, most recently used first
+func (s *DeviceService) ListDevices(ctx context.Context, userID uint) ([]models.UserDevice, error) {
+	var devices []models.UserDevice
+	if err := s.db.WithContext(ctx).
+		Where("user_id = ? AND revoked_at IS NULL", userID).
+		Order("last_seen_at DESC").
+		Find(&devices).Error; err != nil {
+		return nil, fmt.Errorf("failed to list devices: %w", err)
+	}
+	return devices, nil
+}
+
+// GetDevice returns one of the user's devices that hasn't been revoked
+func (s *DeviceService) GetDevice(ctx context.Context, userID, deviceID uint) (*models.UserDevice, error) {
+	var device models.UserDevice
+	if err := s.db.WithContext(ctx).
+		Where("id = ? AND user_id = ? AND revoked_at IS NULL", deviceID, userID).
+		First(&device).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrDeviceNotFound
+		}
+		return nil, fmt.Errorf("failed to load device: %w", err)
+	}
+	return &device, nil
+}
+
+// RenameDevice changes the name the user sees for one of their devices
+func (s *DeviceService) RenameDevice(ctx context.Context, userID, deviceID uint, name string) (*models.UserDevice, error) {
+	device, err := s.GetDevice(ctx, userID, deviceID)
+	if err != nil {
+		return nil, err
+	}
+	name = strings.TrimSpace(name)
+	if err := s.db.WithContext(ctx).Model(device).Update("name", name).Error; err != nil {
+		return nil, fmt.Errorf("failed to rename device: %w", err)
+	}
+	device.Name = name
+	return device, nil
+}
+
+// SetTrusted marks one of the user's devices as trusted, or removes the mark
+func (s *DeviceService) SetTrusted(ctx context.Context, userID, deviceID uint, trusted bool) (*models.UserDevice, error) {
+	device, err := s.GetDevice(ctx, userID, deviceID)
+	if err != nil {
+		return nil, err
+	}
+
+	var trustedAt *time.Time
+	if trusted {
+		now := time.Now()
+		trustedAt = &now
+	}
+	if err := s.db.WithContext(ctx).Model(device).Update("trusted_at", trustedAt).Error; err != nil {
+		return nil, fmt.Errorf("failed to update device: %w", err)
+	}
+	device.TrustedAt = trustedAt
+	return device, nil
+}
+
+// RevokeDevice signs one of the user's devices out: its sessions are revoked, its push
+// tokens deactivated, and the next login from it is treated as a new device
+func (s *DeviceService) RevokeDevice(ctx context.Context, userID, deviceID uint) error {
+	device, err := s.GetDevice(ctx, userID, deviceID)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	if err := s.db.WithContext(ctx).Model(device).Updates(map[string]interface{}{
+		"revoked_at": now,
+		"trusted_at": nil,
+	}).Error; err != nil {
+		return fmt.Errorf("failed to revoke device: %w", err)
+	}
+
+	scope := s.db.Where("user_id = ? AND user_device_id = ?", userID, device.ID)
+	if err := s.sessions.revoke(ctx, scope, models.SessionRevokedDeviceRevoked); err != nil {
+		return err
+	}
+
+	if device.DeviceID != "" {
+		if err := s.db.WithContext(ctx).Model(&models.DeviceToken{}).
+			Where("user_id = ? AND device_id = ?", userID, device.DeviceID).
+			Update("is_active", false).Error; err != nil {
+			return fmt.Errorf("failed to deactivate push tokens: %w", err)
+		}
+	}
+
+	s.logger.LogSecurityEvent(ctx, "device_revoked", "low",
+		zap.Uint("user_id", userID),
+		zap.Uint("user_device_id", device.ID),
+	)
+	return nil
+}
+
+// SendNewDeviceAlert tells the user about a login from a device they hadn't used before
+func (s *DeviceService) SendNewDeviceAlert(ctx context.Context, deviceID uint) error {
+	var device models.UserDevice
+	if err := s.db.WithContext(ctx).First(&device, deviceID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil
+		}
+		return fmt.Errorf("failed to load device: %w", err)
+	}
+
+	var user models.User
+	if err := s.db.WithContext(ctx).First(&user, device.UserID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil
+		}
+		return fmt.Errorf("failed to load user: %w", err)
+	}
+	// Guests have no real email address and only ever one device
+	if user.IsGuest {
+		return nil
+	}
+
+	subject, body := NewDeviceLoginEmail(user.Name, device.Name, device.LastIP, device.LastSeenAt)
+	if _, err := s.jobQueue.EnqueueEmailNotification(EmailNotificationPayload{
+		UserID:   user.ID,
+		Email:    user.Email,
+		Subject:  subject,
+		Body:     body,
+		Template: "new_device_login",
+		Priority: 1,
+	}, asynq.Queue("critical"), asynq.MaxRetry(5)); err != nil {
+		return fmt.Errorf("failed to enqueue new device email: %w", err)
+	}
+
+	if s.push != nil {
+		notification := &models.PushNotification{
+			Title:    "New sign-in",
+			Body:     fmt.Sprintf("Your account was signed in on %s. If this wasn't you, revoke the device and change your password.", device.Name),
+			Data:     models.JSONMap{"type": "new_device_login", "user_device_id": device.ID},
+			Target:   models.NotificationTarget{Type: models.TargetTypeUser, UserIDs: []uint{user.ID}},
+			Priority: "high",
+			UserID:   &user.ID,
+		}
+		if err := s.push.SendNotification(ctx, notification); err != nil {
+			s.logger.LogError(ctx, err, "Failed to send new device push", zap.Uint("user_id", user.ID))
+		}
+	}
+	return nil
+}
+
+// alert queues a new-device alert unless this is the first device the user signs in from
+func (s *DeviceService) alert(ctx context.Context, device *models.UserDevice) {
+	if !s.alertsEnabled || s.jobQueue == nil {
+		return
+	}
+
+	var others int64
+	if err := s.db.WithContext(ctx).Model(&models.UserDevice{}).
+		Where("user_id = ? AND id <> ?", device.UserID, device.ID).
+		Count(&others).Error; err != nil {
+		s.logger.LogError(ctx, err, "Failed to count user devices", zap.Uint("user_id", device.UserID))
+		return
+	}
+	if others == 0 {
+		return
+	}
+
+	if _, err := s.jobQueue.EnqueueNewDeviceAlert(NewDeviceAlertPayload{UserDeviceID: device.ID},
+		asynq.Queue("critical"), asynq.MaxRetry(3)); err != nil {
+		s.logger.LogError(ctx, err, "Failed to enqueue new device alert", zap.Uint("user_id", device.UserID))
+	}
+}
+
+func (s *DeviceService) handleNewDeviceAlert(ctx context.Context, t *asynq.Task) error {
+	var payload NewDeviceAlertPayload
+	if err := json.Unmarshal(t.Payload(), &payload); err != nil {
+		return fmt.Errorf("failed to unmarshal new device alert payload: %w", err)
+	}
+	return s.SendNewDeviceAlert(ctx, payload.UserDeviceID)
+}
+
+// deviceFingerprint identifies a device by the ID the client sends, falling back to its
+// user agent for clients that send none
+func deviceFingerprint(meta SessionMetadata) string {
+	if meta.DeviceID != "" {
+		return utils.HashToken("id:" + meta.DeviceID)
+	}
+	return utils.HashToken("ua:" + meta.UserAgent)
+}
+
+// detectPlatform uses the platform the client reported, or guesses it from the user agent
+func detectPlatform(reported, userAgent string) string {
+	switch strings.ToLower(strings.TrimSpace(reported)) {
+	case models.PlatformIOS:
+		return models.PlatformIOS
+	case models.PlatformAndroid:
+		return models.PlatformAndroid
+	case models.PlatformWeb:
+		return models.PlatformWeb
+	}
+
+	ua := strings.ToLower(userAgent)
+	switch {
+	case strings.Contains(ua, "iphone"), strings.Contains(ua, "ipad"), strings.Contains(ua, "cfnetwork"):
+		return models.PlatformIOS
+	case strings.Contains(ua, "android"), strings.Contains(ua, "okhttp"):
+		return models.PlatformAndroid
+	case strings.Contains(ua, "mozilla"):
+		return models.PlatformWeb
+	}
+	return models.PlatformUnknown
+}
+
+// deviceName uses the name the client sent, or describes the platform
+func deviceName(name, platform string) string {
+	if name = strings.TrimSpace(name); name != "" {
+		return name
+	}
+	switch platform {
+	case models.PlatformIOS:
+		return "iOS device"
+	case models.PlatformAndroid:
+		return "Android device"
+	case models.PlatformWeb:
+		return "Web browser"
+	}
+	return "Unknown device"
+}
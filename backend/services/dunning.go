@@ -0,0 +1,528 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"mobile-backend/models"
+
+	"github.com/hibiken/asynq"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+// Reminder types sent while a subscription is past due
+const (
+	ReminderTypePaymentFailed = "payment_failed"
+	ReminderTypePaymentRetry  = "payment_retry"
+	ReminderTypeFinalNotice   = "final_notice"
+	ReminderTypeAccessEnded   = "access_ended"
+)
+
+var ErrSubscriptionNotFound = errors.New("subscription not found")
+
+// openDunningStates are the states in which the user still has access
+var openDunningStates = []string{models.DunningStateGrace, models.DunningStateFinalNotice}
+
+// DunningStep is one reminder of a subscription's dunning schedule
+type DunningStep struct {
+	Step         int       `json:"step"`
+	ReminderType string    `json:"reminder_type"`
+	SendAt       time.Time `json:"send_at"`
+	Sent         bool      `json:"sent"`
+}
+
+// SubscriptionDunningStatus shows admins where a subscription is in dunning
+type SubscriptionDunningStatus struct {
+	SubscriptionID uint                        `json:"subscription_id"`
+	Status         string                      `json:"status"`
+	Current        *models.SubscriptionDunning `json:"current,omitempty"`
+	// Schedule lists the reminders of the current dunning, sent or not
+	Schedule []DunningStep                `json:"schedule,omitempty"`
+	History  []models.SubscriptionDunning `json:"history"`
+}
+
+// DunningService keeps pro access for subscriptions whose payment failed while the
+// provider retries the charge. The user gets a grace period of DUNNING_GRACE_PERIOD and
+// reminders at the offsets in DUNNING_REMINDER_SCHEDULE, escalating from an email to
+// email and push and ending with a final notice. When the grace period runs out without
+// a successful payment the user is downgraded. App Store and Google Play subscriptions
+// are left to the stores' own grace periods.
+type DunningService struct {
+	db                        *gorm.DB
+	subscriptionStatusService *SubscriptionStatusService
+	jobQueue                  *JobQueueService
+	push                      *PushNotificationService
+	logger                    *zap.Logger
+
+	gracePeriod time.Duration
+	reminders   []time.Duration // offsets from the failed payment
+}
+
+// NewDunningService creates a new dunning service configured from the environment and
+// registers the subscription reminder job handler with jobQueue. Without a job queue,
+// reminders are sent as they fall due by ProcessDunning; push may be nil to send
+// reminders by email only.
+func NewDunningService(db *gorm.DB, subscriptionStatusService *SubscriptionStatusService, jobQueue *JobQueueService, push *PushNotificationService, logger *zap.Logger) (*DunningService, error) {
+	gracePeriod, err := time.ParseDuration(getEnvOrDefault("DUNNING_GRACE_PERIOD", "168h"))
+	if err != nil || gracePeriod < 0 {
+		return nil, fmt.Errorf("invalid DUNNING_GRACE_PERIOD: %q", os.Getenv("DUNNING_GRACE_PERIOD"))
+	}
+
+	var reminders []time.Duration
+	if gracePeriod > 0 {
+		for _, value := range strings.Split(getEnvOrDefault("DUNNING_REMINDER_SCHEDULE", "0h,72h,144h"), ",") {
+			value = strings.TrimSpace(value)
+			if value == "" {
+				continue
+			}
+			offset, err := time.ParseDuration(value)
+			if err != nil {
+				return nil, fmt.Errorf("invalid DUNNING_REMINDER_SCHEDULE: %w", err)
+			}
+			if offset < 0 || offset >= gracePeriod {
+				return nil, fmt.Errorf("invalid DUNNING_REMINDER_SCHEDULE: %s is not within the %s grace period", value, gracePeriod)
+			}
+			if len(reminders) > 0 && offset < reminders[len(reminders)-1] {
+				return nil, fmt.Errorf("invalid DUNNING_REMINDER_SCHEDULE: reminders must be in order")
+			}
+			reminders = append(reminders, offset)
+		}
+	}
+
+	s := &DunningService{
+		db:                        db,
+		subscriptionStatusService: subscriptionStatusService,
+		jobQueue:                  jobQueue,
+		push:                      push,
+		logger:                    logger,
+		gracePeriod:               gracePeriod,
+		reminders:                 reminders,
+	}
+
+	if jobQueue != nil {
+		jobQueue.RegisterHandler(TypeSubscriptionReminder, s.handleSubscriptionReminder)
+	}
+	return s, nil
+}
+
+// Enabled reports whether past due subscriptions get a grace period.
+// DUNNING_GRACE_PERIOD=0 downgrades users as soon as a payment fails.
+func (s *DunningService) Enabled() bool {
+	return s.gracePeriod > 0
+}
+
+// Track returns the dunning of a past due subscription, starting it and scheduling the
+// first reminder when the payment has just failed. It returns nil for store
+// subscriptions.
+func (s *DunningService) Track(ctx context.Context, subscription *models.Subscription) (*models.SubscriptionDunning, error) {
+	if IsStorePaymentMethod(subscription.PaymentMethod) {
+		return nil, nil
+	}
+
+	dunning, err := s.currentDunning(ctx, subscription.ID)
+	if err != nil || dunning != nil {
+		return dunning, err
+	}
+
+	now := time.Now()
+	dunning = &models.SubscriptionDunning{
+		SubscriptionID: subscription.ID,
+		UserID:         subscription.UserID,
+		State:          models.DunningStateGrace,
+		StartedAt:      now,
+		GraceEndsAt:    now.Add(s.gracePeriod),
+	}
+	dunning.NextReminderAt = s.reminderTime(dunning, 0)
+	if err := s.db.WithContext(ctx).Create(dunning).Error; err != nil {
+		// Another webhook for the same failure may have started it first
+		if current, lookupErr := s.currentDunning(ctx, subscription.ID); lookupErr == nil && current != nil {
+			return current, nil
+		}
+		return nil, fmt.Errorf("failed to start dunning: %w", err)
+	}
+
+	s.logger.Info("Subscription payment failed, grace period started",
+		zap.Uint("subscription_id", subscription.ID),
+		zap.Uint("user_id", subscription.UserID),
+		zap.Time("grace_ends_at", dunning.GraceEndsAt),
+	)
+	s.scheduleReminder(ctx, dunning)
+	return dunning, nil
+}
+
+// Resolve ends the dunning of a subscription that is no longer past due: it recovered
+// if it is active again and was canceled otherwise
+func (s *DunningService) Resolve(ctx context.Context, subscription *models.Subscription) error {
+	state := models.DunningStateCanceled
+	if subscription.Status == "active" || subscription.Status == "trialing" {
+		state = models.DunningStateRecovered
+	}
+
+	result := s.db.WithContext(ctx).Model(&models.SubscriptionDunning{}).
+		Where("subscription_id = ? AND resolved_at IS NULL", subscription.ID).
+		Updates(map[string]interface{}{
+			"state":            state,
+			"resolved_at":      time.Now(),
+			"next_reminder_at": nil,
+		})
+	if result.Error != nil {
+		return fmt.Errorf("failed to resolve dunning: %w", result.Error)
+	}
+	if result.RowsAffected > 0 {
+		s.logger.Info("Subscription left dunning",
+			zap.Uint("subscription_id", subscription.ID),
+			zap.String("state", state),
+		)
+	}
+	return nil
+}
+
+// ProcessDunning downgrades users whose grace period ran out and sends reminders that
+// are due but were never delivered. It returns the number of users downgraded.
+func (s *DunningService) ProcessDunning(ctx context.Context) (int, error) {
+	now := time.Now()
+
+	var expired []models.SubscriptionDunning
+	if err := s.db.WithContext(ctx).
+		Where("state IN ? AND grace_ends_at <= ?", openDunningStates, now).
+		Find(&expired).Error; err != nil {
+		return 0, fmt.Errorf("failed to find expired grace periods: %w", err)
+	}
+
+	downgraded := 0
+	for i := range expired {
+		if err := s.downgrade(ctx, &expired[i]); err != nil {
+			s.logger.Error("Failed to end grace period",
+				zap.Uint("dunning_id", expired[i].ID),
+				zap.Uint("subscription_id", expired[i].SubscriptionID),
+				zap.Error(err),
+			)
+			continue
+		}
+		downgraded++
+	}
+
+	var due []models.SubscriptionDunning
+	if err := s.db.WithContext(ctx).
+		Where("state IN ? AND next_reminder_at <= ?", openDunningStates, now).
+		Find(&due).Error; err != nil {
+		return downgraded, fmt.Errorf("failed to find due reminders: %w", err)
+	}
+	for i := range due {
+		s.scheduleReminder(ctx, &due[i])
+	}
+
+	return downgraded, nil
+}
+
+// SendReminder sends a subscription reminder. Dunning reminders that are out of date
+// because the subscription recovered or the step was already sent are skipped.
+func (s *DunningService) SendReminder(ctx context.Context, payload SubscriptionReminderPayload) error {
+	if payload.DunningID == 0 {
+		s.logger.Info("Skipping subscription reminder without a dunning",
+			zap.Uint("subscription_id", payload.SubscriptionID),
+			zap.String("reminder_type", payload.ReminderType),
+		)
+		return nil
+	}
+
+	var dunning models.SubscriptionDunning
+	if err := s.db.WithContext(ctx).First(&dunning, payload.DunningID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil
+		}
+		return fmt.Errorf("failed to load dunning: %w", err)
+	}
+
+	if payload.ReminderType == ReminderTypeAccessEnded {
+		if dunning.State == models.DunningStateDowngraded && dunning.IsOpen() {
+			s.notify(ctx, &dunning, ReminderTypeAccessEnded)
+		}
+		return nil
+	}
+
+	step := payload.Step
+	if step != dunning.RemindersSent || step >= len(s.reminders) {
+		return nil
+	}
+	reminderType := s.reminderType(step)
+	state := dunning.State
+	if reminderType == ReminderTypeFinalNotice {
+		state = models.DunningStateFinalNotice
+	}
+	next := s.reminderTime(&dunning, step+1)
+
+	// Claim the step so a reminder enqueued twice is only sent once
+	result := s.db.WithContext(ctx).Model(&models.SubscriptionDunning{}).
+		Where("id = ? AND reminders_sent = ? AND state IN ? AND resolved_at IS NULL", dunning.ID, step, openDunningStates).
+		Updates(map[string]interface{}{
+			"state":            state,
+			"reminders_sent":   step + 1,
+			"last_reminder_at": time.Now(),
+			"next_reminder_at": next,
+		})
+	if result.Error != nil {
+		return fmt.Errorf("failed to update dunning: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return nil
+	}
+
+	dunning.State = state
+	dunning.RemindersSent = step + 1
+	dunning.NextReminderAt = next
+	s.notify(ctx, &dunning, reminderType)
+	s.scheduleReminder(ctx, &dunning)
+	return nil
+}
+
+// GetSubscriptionDunning returns a subscription's current dunning with its reminder
+// schedule and its past dunning periods
+func (s *DunningService) GetSubscriptionDunning(ctx context.Context, subscriptionID uint) (*SubscriptionDunningStatus, error) {
+	var subscription models.Subscription
+	if err := s.db.WithContext(ctx).First(&subscription, subscriptionID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrSubscriptionNotFound
+		}
+		return nil, fmt.Errorf("failed to load subscription: %w", err)
+	}
+
+	status := &SubscriptionDunningStatus{
+		SubscriptionID: subscription.ID,
+		Status:         subscription.Status,
+	}
+	if err := s.db.WithContext(ctx).
+		Where("subscription_id = ?", subscription.ID).
+		Order("started_at DESC").
+		Find(&status.History).Error; err != nil {
+		return nil, fmt.Errorf("failed to list dunning: %w", err)
+	}
+
+	if len(status.History) > 0 && status.History[0].IsOpen() {
+		current := status.History[0]
+		status.Current = &current
+		for step := range s.reminders {
+			status.Schedule = append(status.Schedule, DunningStep{
+				Step:         step,
+				ReminderType: s.reminderType(step),
+				SendAt:       current.StartedAt.Add(s.reminders[step]),
+				Sent:         step < current.RemindersSent,
+			})
+		}
+	}
+	return status, nil
+}
+
+// ListDunning returns dunning periods, most recently started first, optionally only
+// those in state
+func (s *DunningService) ListDunning(ctx context.Context, state string, page, limit int) ([]models.SubscriptionDunning, int64, error) {
+	query := s.db.WithContext(ctx).Model(&models.SubscriptionDunning{})
+	if state != "" {
+		query = query.Where("state = ?", state)
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, fmt.Errorf("failed to count dunning: %w", err)
+	}
+
+	var dunning []models.SubscriptionDunning
+	if err := query.Order("started_at DESC").Offset((page - 1) * limit).Limit(limit).Find(&dunning).Error; err != nil {
+		return nil, 0, fmt.Errorf("failed to list dunning: %w", err)
+	}
+	return dunning, total, nil
+}
+
+// currentDunning returns the subscription's unresolved dunning, or nil
+func (s *DunningService) currentDunning(ctx context.Context, subscriptionID uint) (*models.SubscriptionDunning, error) {
+	var dunning models.SubscriptionDunning
+	err := s.db.WithContext(ctx).
+		Where("subscription_id = ? AND resolved_at IS NULL", subscriptionID).
+		Order("started_at DESC").
+		First(&dunning).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to load dunning: %w", err)
+	}
+	return &dunning, nil
+}
+
+// downgrade ends the grace period of a subscription that is still past due. The user
+// loses access before the dunning is marked downgraded, so a failed downgrade leaves the
+// dunning open for the next ProcessDunning run to retry.
+func (s *DunningService) downgrade(ctx context.Context, dunning *models.SubscriptionDunning) error {
+	var subscription models.Subscription
+	if err := s.db.WithContext(ctx).First(&subscription, dunning.SubscriptionID).Error; err != nil {
+		return fmt.Errorf("failed to load subscription: %w", err)
+	}
+	if err := s.subscriptionStatusService.UpdateUserSubscriptionStatus(ctx, subscription.UserID, &subscription); err != nil {
+		return err
+	}
+
+	result := s.db.WithContext(ctx).Model(&models.SubscriptionDunning{}).
+		Where("id = ? AND state IN ?", dunning.ID, openDunningStates).
+		Updates(map[string]interface{}{
+			"state":            models.DunningStateDowngraded,
+			"downgraded_at":    time.Now(),
+			"next_reminder_at": nil,
+		})
+	if result.Error != nil {
+		return fmt.Errorf("failed to update dunning: %w", result.Error)
+	}
+	// Another run already downgraded it and told the user
+	if result.RowsAffected == 0 {
+		return nil
+	}
+
+	s.logger.Info("Grace period ended, user downgraded",
+		zap.Uint("subscription_id", subscription.ID),
+		zap.Uint("user_id", subscription.UserID),
+	)
+	s.enqueueReminder(ctx, SubscriptionReminderPayload{
+		SubscriptionID: dunning.SubscriptionID,
+		DunningID:      dunning.ID,
+		ReminderType:   ReminderTypeAccessEnded,
+	}, asynq.TaskID(fmt.Sprintf("%s:%d:%s", TypeSubscriptionReminder, dunning.ID, ReminderTypeAccessEnded)))
+	return nil
+}
+
+// scheduleReminder enqueues the dunning's next reminder for when it is due
+func (s *DunningService) scheduleReminder(ctx context.Context, dunning *models.SubscriptionDunning) {
+	if dunning.NextReminderAt == nil {
+		return
+	}
+	if s.jobQueue == nil && dunning.NextReminderAt.After(time.Now()) {
+		return
+	}
+
+	step := dunning.RemindersSent
+	s.enqueueReminder(ctx, SubscriptionReminderPayload{
+		SubscriptionID: dunning.SubscriptionID,
+		DunningID:      dunning.ID,
+		Step:           step,
+		ReminderType:   s.reminderType(step),
+		DaysBefore:     int(time.Until(dunning.GraceEndsAt).Hours() / 24),
+	}, asynq.ProcessAt(*dunning.NextReminderAt), asynq.TaskID(fmt.Sprintf("%s:%d:%d", TypeSubscriptionReminder, dunning.ID, step)))
+}
+
+// enqueueReminder enqueues a reminder, or sends it right away without a job queue. A
+// reminder that is already queued is left alone.
+func (s *DunningService) enqueueReminder(ctx context.Context, payload SubscriptionReminderPayload, opts ...asynq.Option) {
+	if s.jobQueue == nil {
+		if err := s.SendReminder(ctx, payload); err != nil {
+			s.logger.Error("Failed to send subscription reminder", zap.Uint("dunning_id", payload.DunningID), zap.Error(err))
+		}
+		return
+	}
+
+	opts = append(opts, asynq.MaxRetry(3))
+	if _, err := s.jobQueue.EnqueueSubscriptionReminder(payload, opts...); err != nil && !errors.Is(err, asynq.ErrTaskIDConflict) {
+		s.logger.Error("Failed to enqueue subscription reminder",
+			zap.Uint("dunning_id", payload.DunningID),
+			zap.String("reminder_type", payload.ReminderType),
+			zap.Error(err),
+		)
+	}
+}
+
+// reminderTime returns when the dunning's reminder at step is due, or nil after the last
+func (s *DunningService) reminderTime(dunning *models.SubscriptionDunning, step int) *time.Time {
+	if step >= len(s.reminders) {
+		return nil
+	}
+	at := dunning.StartedAt.Add(s.reminders[step])
+	return &at
+}
+
+// reminderType escalates from the first reminder to the final notice
+func (s *DunningService) reminderType(step int) string {
+	switch {
+	case step == 0:
+		return ReminderTypePaymentFailed
+	case step == len(s.reminders)-1:
+		return ReminderTypeFinalNotice
+	default:
+		return ReminderTypePaymentRetry
+	}
+}
+
+// notify tells the user about their failed payment. The first reminder is an email;
+// later ones are also pushed.
+func (s *DunningService) notify(ctx context.Context, dunning *models.SubscriptionDunning, reminderType string) {
+	var user models.User
+	if err := s.db.WithContext(ctx).First(&user, dunning.UserID).Error; err != nil {
+		s.logger.Error("Failed to load user for subscription reminder", zap.Uint("user_id", dunning.UserID), zap.Error(err))
+		return
+	}
+	var subscription models.Subscription
+	if err := s.db.WithContext(models.WithoutTenantScope(ctx)).Preload("Product").First(&subscription, dunning.SubscriptionID).Error; err != nil {
+		s.logger.Error("Failed to load subscription for reminder", zap.Uint("subscription_id", dunning.SubscriptionID), zap.Error(err))
+		return
+	}
+
+	// Guests have no real email address
+	if s.jobQueue != nil && !user.IsGuest {
+		subject, body := DunningReminderEmail(user.Name, reminderType, subscription.Product.Name, dunning.GraceEndsAt)
+		opts := []asynq.Option{asynq.MaxRetry(5)}
+		if reminderType != ReminderTypePaymentFailed {
+			opts = append(opts, asynq.Queue("critical"))
+		}
+		if _, err := s.jobQueue.EnqueueEmailNotification(EmailNotificationPayload{
+			UserID:   user.ID,
+			Email:    user.Email,
+			Subject:  subject,
+			Body:     body,
+			Template: "dunning_" + reminderType,
+			Priority: 1,
+		}, opts...); err != nil {
+			s.logger.Error("Failed to enqueue subscription reminder email", zap.Uint("user_id", user.ID), zap.Error(err))
+		}
+	}
+
+	if s.push == nil || reminderType == ReminderTypePaymentFailed {
+		return
+	}
+	var title, body string
+	switch reminderType {
+	case ReminderTypePaymentRetry:
+		title = "Update your payment method"
+		body = fmt.Sprintf("We still couldn't charge you for %s. Update your card to keep Pro.", subscription.Product.Name)
+	case ReminderTypeFinalNotice:
+		title = "Your Pro access ends soon"
+		body = fmt.Sprintf("Update your payment method before %s to keep Pro.", dunning.GraceEndsAt.UTC().Format("January 2"))
+	default:
+		title = "Your Pro access has ended"
+		body = "Update your payment method to get Pro back."
+	}
+	notification := &models.PushNotification{
+		Title: title,
+		Body:  body,
+		Data: models.JSONMap{
+			"type":            "dunning",
+			"reminder_type":   reminderType,
+			"subscription_id": dunning.SubscriptionID,
+		},
+		Target:   models.NotificationTarget{Type: models.TargetTypeUser, UserIDs: []uint{user.ID}},
+		Priority: "high",
+		UserID:   &user.ID,
+	}
+	if err := s.push.SendNotification(ctx, notification); err != nil {
+		s.logger.Error("Failed to send subscription reminder push", zap.Uint("user_id", user.ID), zap.Error(err))
+	}
+}
+
+func (s *DunningService) handleSubscriptionReminder(ctx context.Context, t *asynq.Task) error {
+	var payload SubscriptionReminderPayload
+	if err := json.Unmarshal(t.Payload(), &payload); err != nil {
+		return fmt.Errorf("failed to unmarshal subscription reminder payload: %w", err)
+	}
+	return s.SendReminder(ctx, payload)
+}
@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"net/smtp"
 	"os"
+	"time"
 )
 
 type EmailService struct {
@@ -52,7 +53,18 @@ The Mobile Backend Team
 	return e.SendEmail(to, subject, body)
 }
 
+// IsConfigured reports whether SMTP settings are present
+func (e *EmailService) IsConfigured() bool {
+	return e.smtpHost != "" && e.fromEmail != ""
+}
+
 func (e *EmailService) SendPasswordResetEmail(to, resetToken string) error {
+	subject, body := PasswordResetEmail(resetToken)
+	return e.SendEmail(to, subject, body)
+}
+
+// PasswordResetEmail builds the subject and body of a password reset email
+func PasswordResetEmail(resetToken string) (string, string) {
 	subject := "Password Reset Request"
 	body := fmt.Sprintf(`
 You have requested to reset your password.
@@ -68,5 +80,223 @@ Best regards,
 The Mobile Backend Team
 `, os.Getenv("FRONTEND_URL"), resetToken)
 
-	return e.SendEmail(to, subject, body)
+	return subject, body
+}
+
+// VerificationEmail builds the subject and body of an email address verification email
+func VerificationEmail(name, verificationToken string) (string, string) {
+	subject := "Verify your email address"
+	body := fmt.Sprintf(`
+Hello %s,
+
+Please confirm your email address by clicking the following link:
+%s/verify-email?token=%s
+
+This link will expire in 24 hours.
+
+If you did not create an account, please ignore this email.
+
+Best regards,
+The Mobile Backend Team
+`, name, os.Getenv("FRONTEND_URL"), verificationToken)
+
+	return subject, body
+}
+
+// MagicLinkEmail builds the subject and body of a passwordless sign-in link email
+func MagicLinkEmail(token string, ttl time.Duration) (string, string) {
+	subject := "Your sign-in link"
+	body := fmt.Sprintf(`
+Hello,
+
+Click the following link to sign in:
+%s/magic-link?token=%s
+
+This link will expire in %d minutes and can only be used once.
+
+If you did not try to sign in, please ignore this email.
+
+Best regards,
+The Mobile Backend Team
+`, os.Getenv("FRONTEND_URL"), token, int(ttl.Minutes()))
+
+	return subject, body
+}
+
+// LoginCodeEmail builds the subject and body of a passwordless sign-in code email
+func LoginCodeEmail(code string, ttl time.Duration) (string, string) {
+	subject := fmt.Sprintf("Your sign-in code is %s", code)
+	body := fmt.Sprintf(`
+Hello,
+
+Your sign-in code is:
+
+%s
+
+This code will expire in %d minutes and can only be used once.
+
+If you did not try to sign in, please ignore this email.
+
+Best regards,
+The Mobile Backend Team
+`, code, int(ttl.Minutes()))
+
+	return subject, body
+}
+
+// OrganizationInvitationEmail builds the subject and body of an organization invitation email
+func OrganizationInvitationEmail(organizationName, token string, ttl time.Duration) (string, string) {
+	subject := fmt.Sprintf("You have been invited to join %s", organizationName)
+	body := fmt.Sprintf(`
+Hello,
+
+You have been invited to join %s. Click the following link to accept the invitation:
+%s/accept-invitation?token=%s
+
+This invitation will expire in %d days. Sign in with this email address to accept it.
+
+If you were not expecting this invitation, please ignore this email.
+
+Best regards,
+The Mobile Backend Team
+`, organizationName, os.Getenv("FRONTEND_URL"), token, int(ttl.Hours()/24))
+
+	return subject, body
+}
+
+// DataExportReadyEmail builds the subject and body of the email sent when a personal data export is ready
+func DataExportReadyEmail(name string, requestID uint, ttl time.Duration) (string, string) {
+	subject := "Your data export is ready"
+	body := fmt.Sprintf(`
+Hello %s,
+
+The copy of your data you requested is ready. Sign in and download it from:
+%s/account/privacy?export=%d
+
+The download will be available for %d days.
+
+If you did not request this export, please change your password.
+
+Best regards,
+The Mobile Backend Team
+`, name, os.Getenv("FRONTEND_URL"), requestID, int(ttl.Hours()/24))
+
+	return subject, body
+}
+
+// AccountErasureScheduledEmail builds the subject and body of the email confirming a scheduled account deletion
+func AccountErasureScheduledEmail(name string, scheduledFor time.Time) (string, string) {
+	subject := "Your account is scheduled for deletion"
+	body := fmt.Sprintf(`
+Hello %s,
+
+Your account and personal data will be permanently deleted on %s.
+
+Until then you can cancel the deletion by signing in and visiting:
+%s/account/privacy
+
+If you did not request this, please cancel the deletion and change your password.
+
+Best regards,
+The Mobile Backend Team
+`, name, scheduledFor.UTC().Format("January 2, 2006 15:04 MST"), os.Getenv("FRONTEND_URL"))
+
+	return subject, body
+}
+
+// NewDeviceLoginEmail builds the subject and body of the email sent when an account is signed in on a new device
+func NewDeviceLoginEmail(name, deviceName, ipAddress string, signedInAt time.Time) (string, string) {
+	subject := "New sign-in to your account"
+	body := fmt.Sprintf(`
+Hello %s,
+
+Your account was just signed in on a device you haven't used before:
+
+Device: %s
+IP address: %s
+Time: %s
+
+If this was you, there's nothing else to do. If it wasn't, revoke the device and change your password at:
+%s/account/devices
+
+Best regards,
+The Mobile Backend Team
+`, name, deviceName, ipAddress, signedInAt.UTC().Format("January 2, 2006 15:04 MST"), os.Getenv("FRONTEND_URL"))
+
+	return subject, body
+}
+
+// RefundIssuedEmail builds the subject and body of the email sent when a payment is refunded
+func RefundIssuedEmail(name, amount, description string) (string, string) {
+	subject := "Your refund is on its way"
+	body := fmt.Sprintf(`
+Hello %s,
+
+We've refunded %s for "%s". Depending on your bank, it can take 5 to 10 business days to appear on your statement.
+
+You can review your payments at:
+%s/account/billing
+
+Best regards,
+The Mobile Backend Team
+`, name, amount, description, os.Getenv("FRONTEND_URL"))
+
+	return subject, body
+}
+
+// DisputeOpenedEmail builds the subject and body of the email sent when a payment is
+// disputed with the user's bank
+func DisputeOpenedEmail(name, amount string, accessPaused bool) (string, string) {
+	subject := "A payment on your account was disputed"
+	access := ""
+	if accessPaused {
+		access = "\nYour Pro access is paused while the dispute is open.\n"
+	}
+	body := fmt.Sprintf(`
+Hello %s,
+
+Your bank told us you disputed a payment of %s. We'll work with the bank to resolve it.
+%s
+If you didn't mean to dispute this payment, please contact your bank or reply to this email.
+
+Best regards,
+The Mobile Backend Team
+`, name, amount, access)
+
+	return subject, body
+}
+
+// DunningReminderEmail builds the subject and body of the reminders sent while a
+// subscription payment is failing, from the first failure to the end of Pro access
+func DunningReminderEmail(name, reminderType, productName string, graceEndsAt time.Time) (string, string) {
+	var subject, message string
+	deadline := graceEndsAt.UTC().Format("January 2, 2006")
+	switch reminderType {
+	case ReminderTypePaymentFailed:
+		subject = "We couldn't process your payment"
+		message = fmt.Sprintf("We couldn't charge your payment method for %s. We'll try again over the next few days, and you keep Pro access until %s in the meantime.", productName, deadline)
+	case ReminderTypeFinalNotice:
+		subject = "Your Pro access ends soon"
+		message = fmt.Sprintf("This is a final reminder that your payment for %s is still failing. Unless you update your payment method, your Pro access ends on %s.", productName, deadline)
+	case ReminderTypeAccessEnded:
+		subject = "Your Pro access has ended"
+		message = fmt.Sprintf("We still couldn't charge your payment method for %s, so your Pro access has ended. Update your payment method to get it back.", productName)
+	default:
+		subject = "Your payment is still failing"
+		message = fmt.Sprintf("We tried again but still couldn't charge your payment method for %s. Please update it before %s to keep Pro access.", productName, deadline)
+	}
+
+	body := fmt.Sprintf(`
+Hello %s,
+
+%s
+
+You can update your payment method at:
+%s/account/billing
+
+Best regards,
+The Mobile Backend Team
+`, name, message, os.Getenv("FRONTEND_URL"))
+
+	return subject, body
 }
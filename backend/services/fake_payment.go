@@ -0,0 +1,557 @@
+package services
+
+import (
+	"context"
+	"crypto/hmac"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"mobile-backend/models"
+	"mobile-backend/utils"
+
+	"gorm.io/gorm"
+)
+
+// FakePaymentProviderName is the key the fake provider is registered under
+const FakePaymentProviderName = "fake"
+
+// FakeDeclinedPaymentMethod is a payment method ID the fake provider always declines
+const FakeDeclinedPaymentMethod = "pm_fake_declined"
+
+// Webhook events sent by the fake provider. ObjectID is the provider ID of the payment
+// for payment events and of the subscription for subscription events.
+const (
+	FakeEventPaymentSucceeded          = "payment.succeeded"
+	FakeEventPaymentFailed             = "payment.failed"
+	FakeEventSubscriptionRenewed       = "subscription.renewed"
+	FakeEventSubscriptionPaymentFailed = "subscription.payment_failed"
+	FakeEventSubscriptionCanceled      = "subscription.canceled"
+)
+
+// FakeWebhookEvent is the body of a webhook sent by the fake provider
+type FakeWebhookEvent struct {
+	ID       string `json:"id"`
+	Type     string `json:"type"`
+	ObjectID string `json:"object_id"`
+	Created  int64  `json:"created"`
+}
+
+// FakePaymentProvider is an in-process PaymentProvider for tests and local development.
+// It never touches the network: charges succeed unless they use
+// FakeDeclinedPaymentMethod, one-time payments stay pending until a webhook settles them,
+// and webhooks are built with NewWebhook and signed with HMAC-SHA256 like a real
+// provider's, so they can be posted to the webhook endpoints.
+type FakePaymentProvider struct {
+	db                        *gorm.DB
+	subscriptionStatusService *SubscriptionStatusService
+	webhookSecret             string
+}
+
+// NewFakePaymentProvider creates the fake provider. Webhooks are signed with
+// FAKE_PAYMENT_WEBHOOK_SECRET, or with a random secret when it isn't set.
+func NewFakePaymentProvider(db *gorm.DB, subscriptionStatusService *SubscriptionStatusService) (*FakePaymentProvider, error) {
+	secret := getEnvOrDefault("FAKE_PAYMENT_WEBHOOK_SECRET", "")
+	if secret == "" {
+		generated, err := utils.GenerateRandomString(32)
+		if err != nil {
+			return nil, fmt.Errorf("failed to generate fake webhook secret: %w", err)
+		}
+		secret = generated
+	}
+
+	return &FakePaymentProvider{
+		db:                        db,
+		subscriptionStatusService: subscriptionStatusService,
+		webhookSecret:             secret,
+	}, nil
+}
+
+// Name returns the provider key the fake is registered under
+func (f *FakePaymentProvider) Name() string {
+	return FakePaymentProviderName
+}
+
+// WebhookSignatureHeader returns the header the fake signs webhooks in
+func (f *FakePaymentProvider) WebhookSignatureHeader() string {
+	return "X-Fake-Signature"
+}
+
+// catalog reads and writes products of the global billing catalog, which is shared by
+// every organization
+func (f *FakePaymentProvider) catalog(ctx context.Context) *gorm.DB {
+	return f.db.WithContext(models.WithoutTenantScope(ctx))
+}
+
+// CreateProduct saves the product; the fake keeps no catalog of its own
+func (f *FakePaymentProvider) CreateProduct(ctx context.Context, productData *models.Product) (*models.Product, error) {
+	if err := f.catalog(ctx).Create(productData).Error; err != nil {
+		return nil, fmt.Errorf("failed to save product to database: %w", err)
+	}
+	return productData, nil
+}
+
+// UpdateProduct updates the product in our database
+func (f *FakePaymentProvider) UpdateProduct(ctx context.Context, productID uint, updates *models.Product) (*models.Product, error) {
+	var existingProduct models.Product
+	if err := f.catalog(ctx).First(&existingProduct, productID).Error; err != nil {
+		return nil, fmt.Errorf("product not found: %w", err)
+	}
+
+	if err := f.catalog(ctx).Model(&existingProduct).Updates(updates).Error; err != nil {
+		return nil, fmt.Errorf("failed to update product in database: %w", err)
+	}
+	return &existingProduct, nil
+}
+
+// CreatePrice saves the plan
+func (f *FakePaymentProvider) CreatePrice(ctx context.Context, planData *models.Plan) (*models.Plan, error) {
+	if err := f.db.WithContext(ctx).Create(planData).Error; err != nil {
+		return nil, fmt.Errorf("failed to save plan to database: %w", err)
+	}
+	return planData, nil
+}
+
+// CreateCustomer returns a customer ID derived from the user ID
+func (f *FakePaymentProvider) CreateCustomer(ctx context.Context, user *models.User) (string, error) {
+	return fmt.Sprintf("fake_cus_%d", user.ID), nil
+}
+
+// CreatePayment records a pending one-time payment. Like a payment intent, it is settled
+// by a payment.succeeded or payment.failed webhook.
+func (f *FakePaymentProvider) CreatePayment(ctx context.Context, userID uint, productID uint, amount int64, currency string) (*models.Payment, error) {
+	var user models.User
+	if err := f.db.WithContext(ctx).First(&user, userID).Error; err != nil {
+		return nil, fmt.Errorf("user not found: %w", err)
+	}
+
+	var product models.Product
+	if err := f.catalog(ctx).First(&product, productID).Error; err != nil {
+		return nil, fmt.Errorf("product not found: %w", err)
+	}
+
+	providerID, err := fakeObjectID("fake_pay_")
+	if err != nil {
+		return nil, err
+	}
+
+	payment := &models.Payment{
+		UserID:            userID,
+		ProductID:         productID,
+		Amount:            amount,
+		Currency:          currency,
+		Status:            "pending",
+		PaymentMethod:     FakePaymentProviderName,
+		ProviderPaymentID: providerID,
+		Description:       fmt.Sprintf("Payment for %s", product.Name),
+	}
+	if err := f.db.WithContext(ctx).Create(payment).Error; err != nil {
+		return nil, fmt.Errorf("failed to create payment record: %w", err)
+	}
+	return payment, nil
+}
+
+// CreateSubscription subscribes the user to a plan and charges the first period straight
+// away. Plans with trial days start in a trial without a charge, and a declined charge
+// leaves the subscription incomplete. The user's subscription status is updated as the
+// provider's subscription-created webhook would.
+func (f *FakePaymentProvider) CreateSubscription(ctx context.Context, userID uint, planID uint, paymentMethodID string) (*models.Subscription, error) {
+	var user models.User
+	if err := f.db.WithContext(ctx).First(&user, userID).Error; err != nil {
+		return nil, fmt.Errorf("user not found: %w", err)
+	}
+
+	var plan models.Plan
+	if err := f.catalog(ctx).Preload("Product").First(&plan, planID).Error; err != nil {
+		return nil, fmt.Errorf("plan not found: %w", err)
+	}
+
+	providerID, err := fakeObjectID("fake_sub_")
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	sub := &models.Subscription{
+		UserID:                 userID,
+		ProductID:              plan.ProductID,
+		PlanID:                 &planID,
+		Status:                 "active",
+		CurrentPeriodStart:     now,
+		CurrentPeriodEnd:       addPlanInterval(now, &plan),
+		ProviderSubscriptionID: providerID,
+		PaymentMethod:          FakePaymentProviderName,
+		Quantity:               1,
+	}
+
+	var charge *models.Payment
+	switch {
+	case plan.TrialDays > 0:
+		trialEnd := now.AddDate(0, 0, plan.TrialDays)
+		sub.Status = "trialing"
+		sub.TrialStart = &now
+		sub.TrialEnd = &trialEnd
+		sub.CurrentPeriodEnd = trialEnd
+	case paymentMethodID == FakeDeclinedPaymentMethod:
+		sub.Status = "incomplete"
+		charge, err = f.subscriptionCharge(sub, &plan, "failed")
+	default:
+		charge, err = f.subscriptionCharge(sub, &plan, "succeeded")
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	err = f.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(sub).Error; err != nil {
+			return fmt.Errorf("failed to create subscription record: %w", err)
+		}
+		if charge != nil {
+			charge.SubscriptionID = &sub.ID
+			if err := tx.Create(charge).Error; err != nil {
+				return fmt.Errorf("failed to create payment record: %w", err)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if err := f.updateUserStatus(ctx, sub); err != nil {
+		return nil, err
+	}
+	return sub, nil
+}
+
+// CancelSubscription cancels a subscription at the end of its period or immediately
+func (f *FakePaymentProvider) CancelSubscription(ctx context.Context, subscriptionID uint, immediately bool) error {
+	var sub models.Subscription
+	if err := f.db.WithContext(ctx).First(&sub, subscriptionID).Error; err != nil {
+		return fmt.Errorf("subscription not found: %w", err)
+	}
+
+	if sub.PaymentMethod != FakePaymentProviderName {
+		return fmt.Errorf("subscription does not belong to the fake provider")
+	}
+
+	updates := map[string]interface{}{
+		"cancel_at_period_end": !immediately,
+	}
+	if immediately {
+		now := time.Now()
+		updates["status"] = "canceled"
+		updates["canceled_at"] = &now
+		sub.Status = "canceled"
+		sub.CanceledAt = &now
+	}
+
+	if err := f.db.WithContext(ctx).Model(&sub).Updates(updates).Error; err != nil {
+		return fmt.Errorf("failed to update subscription in database: %w", err)
+	}
+
+	if immediately {
+		return f.updateUserStatus(ctx, &sub)
+	}
+	return nil
+}
+
+// ChangePlan charges the previewed proration of an immediate change. Scheduled changes
+// are applied when the subscription renews.
+func (f *FakePaymentProvider) ChangePlan(ctx context.Context, sub *models.Subscription, plan *models.Plan, preview *ProrationPreview) error {
+	if sub.PaymentMethod != FakePaymentProviderName {
+		return fmt.Errorf("subscription does not belong to the fake provider")
+	}
+	if preview.Timing != PlanChangeImmediate || preview.AmountDue <= 0 {
+		return nil
+	}
+
+	providerID, err := fakeObjectID("fake_pay_")
+	if err != nil {
+		return err
+	}
+	charge := &models.Payment{
+		UserID:            sub.UserID,
+		ProductID:         plan.ProductID,
+		SubscriptionID:    &sub.ID,
+		Amount:            preview.AmountDue,
+		Currency:          preview.Currency,
+		Status:            "succeeded",
+		PaymentMethod:     FakePaymentProviderName,
+		ProviderPaymentID: providerID,
+		Description:       fmt.Sprintf("Proration for %s", sub.ProviderSubscriptionID),
+	}
+	if err := f.db.WithContext(ctx).Create(charge).Error; err != nil {
+		return fmt.Errorf("failed to create payment record: %w", err)
+	}
+	return nil
+}
+
+// RefundPayment refunds a fake payment; fake refunds always succeed at once
+func (f *FakePaymentProvider) RefundPayment(ctx context.Context, payment *models.Payment, refund *models.Refund) error {
+	if payment.PaymentMethod != FakePaymentProviderName {
+		return fmt.Errorf("payment does not belong to the fake provider")
+	}
+
+	providerID, err := fakeObjectID("fake_re_")
+	if err != nil {
+		return err
+	}
+	refund.ProviderRefundID = providerID
+	refund.Status = models.RefundStatusSucceeded
+	return nil
+}
+
+// NewWebhook builds a signed webhook of the given type about the payment or
+// subscription with providerID. Post payload with the signature in the
+// X-Fake-Signature header, or pass both to HandleWebhook.
+func (f *FakePaymentProvider) NewWebhook(eventType, providerID string) ([]byte, string, error) {
+	eventID, err := fakeObjectID("evt_fake_")
+	if err != nil {
+		return nil, "", err
+	}
+
+	payload, err := json.Marshal(FakeWebhookEvent{
+		ID:       eventID,
+		Type:     eventType,
+		ObjectID: providerID,
+		Created:  time.Now().Unix(),
+	})
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to marshal webhook event: %w", err)
+	}
+	return payload, f.SignWebhook(payload), nil
+}
+
+// SignWebhook returns the hex-encoded HMAC-SHA256 of payload under the webhook secret
+func (f *FakePaymentProvider) SignWebhook(payload []byte) string {
+	return utils.SignRequest(f.webhookSecret, string(payload))
+}
+
+// HandleWebhook verifies and processes a webhook built by NewWebhook
+func (f *FakePaymentProvider) HandleWebhook(ctx context.Context, payload []byte, signature string) error {
+	if !hmac.Equal([]byte(f.SignWebhook(payload)), []byte(signature)) {
+		return fmt.Errorf("invalid webhook signature")
+	}
+
+	var event FakeWebhookEvent
+	if err := json.Unmarshal(payload, &event); err != nil {
+		return fmt.Errorf("failed to unmarshal webhook event: %w", err)
+	}
+
+	// Redelivered events are acknowledged without being applied twice
+	var webhookEvent models.WebhookEvent
+	err := f.db.WithContext(ctx).Where("event_id = ?", event.ID).First(&webhookEvent).Error
+	switch {
+	case err == nil && webhookEvent.Processed:
+		return nil
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		webhookEvent = models.WebhookEvent{
+			Provider:  FakePaymentProviderName,
+			EventType: event.Type,
+			EventID:   event.ID,
+			Data:      models.JSONMap{"object_id": event.ObjectID},
+		}
+		if err := f.db.WithContext(ctx).Create(&webhookEvent).Error; err != nil {
+			return fmt.Errorf("failed to create webhook event record: %w", err)
+		}
+	case err != nil:
+		return fmt.Errorf("failed to load webhook event: %w", err)
+	}
+
+	switch event.Type {
+	case FakeEventPaymentSucceeded:
+		err = f.settlePayment(ctx, event.ObjectID, "succeeded")
+	case FakeEventPaymentFailed:
+		err = f.settlePayment(ctx, event.ObjectID, "failed")
+	case FakeEventSubscriptionRenewed:
+		err = f.renewSubscription(ctx, event.ObjectID)
+	case FakeEventSubscriptionPaymentFailed:
+		err = f.failSubscriptionPayment(ctx, event.ObjectID)
+	case FakeEventSubscriptionCanceled:
+		err = f.endSubscription(ctx, event.ObjectID)
+	}
+	if err != nil {
+		f.db.WithContext(ctx).Model(&webhookEvent).Update("error", err.Error())
+		return err
+	}
+
+	return f.db.WithContext(ctx).Model(&webhookEvent).Updates(map[string]interface{}{
+		"processed":    true,
+		"processed_at": time.Now(),
+	}).Error
+}
+
+func (f *FakePaymentProvider) settlePayment(ctx context.Context, providerID, status string) error {
+	result := f.db.WithContext(ctx).Model(&models.Payment{}).
+		Where("payment_method = ? AND provider_payment_id = ?", FakePaymentProviderName, providerID).
+		Update("status", status)
+	if result.Error != nil {
+		return fmt.Errorf("failed to update payment status: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return fmt.Errorf("failed to find payment record: %s", providerID)
+	}
+	return nil
+}
+
+// renewSubscription charges the next period and moves the subscription into it
+func (f *FakePaymentProvider) renewSubscription(ctx context.Context, providerID string) error {
+	sub, err := f.findSubscription(ctx, providerID)
+	if err != nil {
+		return err
+	}
+
+	sub.Status = "active"
+	sub.CurrentPeriodStart = sub.CurrentPeriodEnd
+
+	err = f.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		// A scheduled downgrade takes effect with the renewal
+		if err := applyScheduledPlanChange(tx, sub); err != nil {
+			return err
+		}
+
+		sub.CurrentPeriodEnd = addPlanInterval(sub.CurrentPeriodStart, sub.Plan)
+		charge, err := f.subscriptionCharge(sub, sub.Plan, "succeeded")
+		if err != nil {
+			return err
+		}
+
+		if err := tx.Model(sub).Updates(map[string]interface{}{
+			"status":               sub.Status,
+			"current_period_start": sub.CurrentPeriodStart,
+			"current_period_end":   sub.CurrentPeriodEnd,
+		}).Error; err != nil {
+			return fmt.Errorf("failed to update subscription: %w", err)
+		}
+		if err := tx.Create(charge).Error; err != nil {
+			return fmt.Errorf("failed to create payment record: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	return f.updateUserStatus(ctx, sub)
+}
+
+// failSubscriptionPayment records a declined renewal and marks the subscription past due
+func (f *FakePaymentProvider) failSubscriptionPayment(ctx context.Context, providerID string) error {
+	sub, err := f.findSubscription(ctx, providerID)
+	if err != nil {
+		return err
+	}
+
+	sub.Status = "past_due"
+	charge, err := f.subscriptionCharge(sub, sub.Plan, "failed")
+	if err != nil {
+		return err
+	}
+
+	err = f.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(sub).Update("status", sub.Status).Error; err != nil {
+			return fmt.Errorf("failed to update subscription: %w", err)
+		}
+		if err := tx.Create(charge).Error; err != nil {
+			return fmt.Errorf("failed to create payment record: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	return f.updateUserStatus(ctx, sub)
+}
+
+// endSubscription cancels a subscription on the provider's side
+func (f *FakePaymentProvider) endSubscription(ctx context.Context, providerID string) error {
+	sub, err := f.findSubscription(ctx, providerID)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	sub.Status = "canceled"
+	sub.CanceledAt = &now
+	if err := f.db.WithContext(ctx).Model(sub).Updates(map[string]interface{}{
+		"status":      sub.Status,
+		"canceled_at": sub.CanceledAt,
+	}).Error; err != nil {
+		return fmt.Errorf("failed to update subscription: %w", err)
+	}
+	return f.updateUserStatus(ctx, sub)
+}
+
+func (f *FakePaymentProvider) findSubscription(ctx context.Context, providerID string) (*models.Subscription, error) {
+	var sub models.Subscription
+	if err := f.db.WithContext(ctx).Preload("Plan").
+		Where("payment_method = ? AND provider_subscription_id = ?", FakePaymentProviderName, providerID).
+		First(&sub).Error; err != nil {
+		return nil, fmt.Errorf("failed to find subscription: %w", err)
+	}
+	if sub.Plan == nil {
+		return nil, fmt.Errorf("subscription %d has no plan", sub.ID)
+	}
+	return &sub, nil
+}
+
+// subscriptionCharge builds the payment record for one period of a subscription
+func (f *FakePaymentProvider) subscriptionCharge(sub *models.Subscription, plan *models.Plan, status string) (*models.Payment, error) {
+	providerID, err := fakeObjectID("fake_pay_")
+	if err != nil {
+		return nil, err
+	}
+
+	charge := &models.Payment{
+		UserID:            sub.UserID,
+		ProductID:         sub.ProductID,
+		Amount:            plan.Price * int64(sub.Quantity),
+		Currency:          plan.Currency,
+		Status:            status,
+		PaymentMethod:     FakePaymentProviderName,
+		ProviderPaymentID: providerID,
+		Description:       fmt.Sprintf("Subscription payment for %s", sub.ProviderSubscriptionID),
+	}
+	if sub.ID != 0 {
+		charge.SubscriptionID = &sub.ID
+	}
+	return charge, nil
+}
+
+func (f *FakePaymentProvider) updateUserStatus(ctx context.Context, sub *models.Subscription) error {
+	if f.subscriptionStatusService == nil {
+		return nil
+	}
+	if err := f.subscriptionStatusService.UpdateUserSubscriptionStatus(ctx, sub.UserID, sub); err != nil {
+		return fmt.Errorf("failed to update user subscription status: %w", err)
+	}
+	return nil
+}
+
+// addPlanInterval returns the end of a billing period of plan that starts at start
+func addPlanInterval(start time.Time, plan *models.Plan) time.Time {
+	count := plan.IntervalCount
+	if count < 1 {
+		count = 1
+	}
+
+	switch plan.Interval {
+	case "day":
+		return start.AddDate(0, 0, count)
+	case "week":
+		return start.AddDate(0, 0, 7*count)
+	case "year":
+		return start.AddDate(count, 0, 0)
+	default:
+		return start.AddDate(0, count, 0)
+	}
+}
+
+func fakeObjectID(prefix string) (string, error) {
+	suffix, err := utils.GenerateRandomString(12)
+	if err != nil {
+		return "", fmt.Errorf("failed to generate fake provider ID: %w", err)
+	}
+	return prefix + suffix, nil
+}
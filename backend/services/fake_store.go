@@ -0,0 +1,184 @@
+package services
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// FakeAppStoreSigner signs App Store payloads with a generated certificate chain shaped
+// like Apple's: a root, an intermediate and a leaf carrying Apple's marker extensions.
+// Trust its root with NewAppStoreVerifier(bundleID, signer.RootPool()) to verify
+// transactions and notifications offline.
+type FakeAppStoreSigner struct {
+	root  *x509.Certificate
+	chain []string
+	key   *ecdsa.PrivateKey
+}
+
+// NewFakeAppStoreSigner generates a fresh signing chain
+func NewFakeAppStoreSigner() (*FakeAppStoreSigner, error) {
+	rootKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate root key: %w", err)
+	}
+	root, err := fakeCertificate("Fake Apple Root CA", nil, rootKey, rootKey, nil, true)
+	if err != nil {
+		return nil, err
+	}
+
+	intermediateKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate intermediate key: %w", err)
+	}
+	intermediate, err := fakeCertificate("Fake Apple WWDR CA", root, intermediateKey, rootKey, appleIntermediateCertificateOID, true)
+	if err != nil {
+		return nil, err
+	}
+
+	leafKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate leaf key: %w", err)
+	}
+	leaf, err := fakeCertificate("Fake App Store Signing", intermediate, leafKey, intermediateKey, appleLeafCertificateOID, false)
+	if err != nil {
+		return nil, err
+	}
+
+	return &FakeAppStoreSigner{
+		root: root,
+		chain: []string{
+			base64.StdEncoding.EncodeToString(leaf.Raw),
+			base64.StdEncoding.EncodeToString(intermediate.Raw),
+			base64.StdEncoding.EncodeToString(root.Raw),
+		},
+		key: leafKey,
+	}, nil
+}
+
+// RootPool returns a pool trusting the signer's root
+func (s *FakeAppStoreSigner) RootPool() *x509.CertPool {
+	pool := x509.NewCertPool()
+	pool.AddCert(s.root)
+	return pool
+}
+
+// RootPEM returns the signer's root certificate, for use as APPLE_ROOT_CERTIFICATES
+func (s *FakeAppStoreSigner) RootPEM() []byte {
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: s.root.Raw})
+}
+
+// Sign signs a transaction, renewal info or notification as the App Store does
+func (s *FakeAppStoreSigner) Sign(claims jwt.Claims) (string, error) {
+	token := jwt.NewWithClaims(jwt.SigningMethodES256, claims)
+	token.Header["x5c"] = s.chain
+	return token.SignedString(s.key)
+}
+
+func fakeCertificate(name string, parent *x509.Certificate, key, parentKey *ecdsa.PrivateKey, marker asn1.ObjectIdentifier, isCA bool) (*x509.Certificate, error) {
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 62))
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate certificate serial: %w", err)
+	}
+
+	template := &x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{CommonName: name},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().AddDate(1, 0, 0),
+		KeyUsage:              x509.KeyUsageDigitalSignature,
+		BasicConstraintsValid: true,
+		IsCA:                  isCA,
+	}
+	if isCA {
+		template.KeyUsage |= x509.KeyUsageCertSign
+	}
+	if marker != nil {
+		template.ExtraExtensions = []pkix.Extension{{Id: marker, Value: []byte{0x05, 0x00}}}
+	}
+	if parent == nil {
+		parent = template
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, parent, &key.PublicKey, parentKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create certificate %s: %w", name, err)
+	}
+	return x509.ParseCertificate(der)
+}
+
+// FixturePlayClient is a PlayDeveloperClient that serves subscription purchases from
+// JSON fixtures instead of the Play Developer API. The purchase for a token is read from
+// <dir>/<token>.json on every call, so tests can change a subscription's state by
+// rewriting its fixture.
+type FixturePlayClient struct {
+	dir string
+
+	mu           sync.Mutex
+	acknowledged map[string]bool
+}
+
+// NewFixturePlayClient creates a client reading fixtures from dir
+func NewFixturePlayClient(dir string) *FixturePlayClient {
+	return &FixturePlayClient{dir: dir, acknowledged: make(map[string]bool)}
+}
+
+// GetSubscription reads the fixture for purchaseToken. Missing fixtures return
+// ErrStorePurchaseNotFound, as unknown tokens do on the real API.
+func (f *FixturePlayClient) GetSubscription(ctx context.Context, packageName, purchaseToken string) (*PlaySubscriptionPurchase, error) {
+	if purchaseToken == "" || strings.ContainsAny(purchaseToken, `/\`) || strings.HasPrefix(purchaseToken, ".") {
+		return nil, ErrStorePurchaseNotFound
+	}
+
+	data, err := os.ReadFile(filepath.Join(f.dir, purchaseToken+".json"))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, ErrStorePurchaseNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read play fixture: %w", err)
+	}
+
+	var purchase PlaySubscriptionPurchase
+	if err := json.Unmarshal(data, &purchase); err != nil {
+		return nil, fmt.Errorf("failed to parse play fixture %s: %w", purchaseToken, err)
+	}
+
+	f.mu.Lock()
+	if f.acknowledged[purchaseToken] {
+		purchase.AcknowledgementState = "ACKNOWLEDGEMENT_STATE_ACKNOWLEDGED"
+	}
+	f.mu.Unlock()
+	return &purchase, nil
+}
+
+// AcknowledgeSubscription records the acknowledgement
+func (f *FixturePlayClient) AcknowledgeSubscription(ctx context.Context, packageName, productID, purchaseToken string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.acknowledged[purchaseToken] = true
+	return nil
+}
+
+// Acknowledged reports whether the purchase with purchaseToken has been acknowledged
+func (f *FixturePlayClient) Acknowledged(purchaseToken string) bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.acknowledged[purchaseToken]
+}
@@ -0,0 +1,263 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"crypto/rsa"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const (
+	googlePlayDefaultAPIURL = "https://androidpublisher.googleapis.com"
+	googlePlayScope         = "https://www.googleapis.com/auth/androidpublisher"
+	// googleAccessTokenLeeway refreshes cached access tokens before they expire
+	googleAccessTokenLeeway = time.Minute
+)
+
+// Play subscription states reported by purchases.subscriptionsv2
+const (
+	PlaySubscriptionStatePending      = "SUBSCRIPTION_STATE_PENDING"
+	PlaySubscriptionStateActive       = "SUBSCRIPTION_STATE_ACTIVE"
+	PlaySubscriptionStatePaused       = "SUBSCRIPTION_STATE_PAUSED"
+	PlaySubscriptionStateInGrace      = "SUBSCRIPTION_STATE_IN_GRACE_PERIOD"
+	PlaySubscriptionStateOnHold       = "SUBSCRIPTION_STATE_ON_HOLD"
+	PlaySubscriptionStateCanceled     = "SUBSCRIPTION_STATE_CANCELED"
+	PlaySubscriptionStateExpired      = "SUBSCRIPTION_STATE_EXPIRED"
+	playAcknowledgementStatePending   = "ACKNOWLEDGEMENT_STATE_PENDING"
+	playVoidedProductTypeSubscription = 1
+)
+
+// PlaySubscriptionPurchase is the subset of a SubscriptionPurchaseV2 we use
+type PlaySubscriptionPurchase struct {
+	StartTime            string                     `json:"startTime,omitempty"`
+	SubscriptionState    string                     `json:"subscriptionState"`
+	LatestOrderID        string                     `json:"latestOrderId,omitempty"`
+	LinkedPurchaseToken  string                     `json:"linkedPurchaseToken,omitempty"`
+	AcknowledgementState string                     `json:"acknowledgementState,omitempty"`
+	TestPurchase         *struct{}                  `json:"testPurchase,omitempty"`
+	LineItems            []PlaySubscriptionLineItem `json:"lineItems"`
+}
+
+// PlaySubscriptionLineItem is one subscribed product of a Play purchase
+type PlaySubscriptionLineItem struct {
+	ProductID        string                `json:"productId"`
+	ExpiryTime       string                `json:"expiryTime,omitempty"`
+	AutoRenewingPlan *PlayAutoRenewingPlan `json:"autoRenewingPlan,omitempty"`
+}
+
+// PlayAutoRenewingPlan describes the renewal of an auto-renewing line item
+type PlayAutoRenewingPlan struct {
+	AutoRenewEnabled bool `json:"autoRenewEnabled"`
+}
+
+// PlayDeveloperNotification is a Real-time developer notification (RTDN) published by
+// Google Play to our Pub/Sub topic
+type PlayDeveloperNotification struct {
+	Version                  string                          `json:"version"`
+	PackageName              string                          `json:"packageName"`
+	EventTimeMillis          string                          `json:"eventTimeMillis"`
+	SubscriptionNotification *PlaySubscriptionNotification   `json:"subscriptionNotification,omitempty"`
+	VoidedPurchase           *PlayVoidedPurchaseNotification `json:"voidedPurchaseNotification,omitempty"`
+	TestNotification         *struct {
+		Version string `json:"version"`
+	} `json:"testNotification,omitempty"`
+}
+
+// PlaySubscriptionNotification reports a change to a subscription purchase
+type PlaySubscriptionNotification struct {
+	Version          string `json:"version"`
+	NotificationType int    `json:"notificationType"`
+	PurchaseToken    string `json:"purchaseToken"`
+	SubscriptionID   string `json:"subscriptionId"`
+}
+
+// PlayVoidedPurchaseNotification reports a refunded, charged back or revoked purchase
+type PlayVoidedPurchaseNotification struct {
+	PurchaseToken string `json:"purchaseToken"`
+	OrderID       string `json:"orderId"`
+	ProductType   int    `json:"productType"`
+}
+
+// PlayDeveloperClient is the part of the Google Play Developer API used for subscriptions
+type PlayDeveloperClient interface {
+	GetSubscription(ctx context.Context, packageName, purchaseToken string) (*PlaySubscriptionPurchase, error)
+	AcknowledgeSubscription(ctx context.Context, packageName, productID, purchaseToken string) error
+}
+
+// googleServiceAccount is the subset of a service account key file we use
+type googleServiceAccount struct {
+	ClientEmail string `json:"client_email"`
+	PrivateKey  string `json:"private_key"`
+	TokenURI    string `json:"token_uri"`
+}
+
+// GooglePlayAPIClient calls the Google Play Developer API as a service account. Access
+// tokens come from the OAuth 2.0 JWT bearer flow and are cached until shortly before
+// they expire.
+type GooglePlayAPIClient struct {
+	httpClient  *http.Client
+	baseURL     string
+	clientEmail string
+	privateKey  *rsa.PrivateKey
+	tokenURI    string
+
+	mu          sync.Mutex
+	accessToken string
+	expiresAt   time.Time
+}
+
+// NewGooglePlayAPIClient creates a client from a service account key file's contents.
+// baseURL defaults to the public API endpoint.
+func NewGooglePlayAPIClient(serviceAccountJSON []byte, httpClient *http.Client, baseURL string) (*GooglePlayAPIClient, error) {
+	var account googleServiceAccount
+	if err := json.Unmarshal(serviceAccountJSON, &account); err != nil {
+		return nil, fmt.Errorf("failed to parse Google service account: %w", err)
+	}
+	if account.ClientEmail == "" || account.PrivateKey == "" || account.TokenURI == "" {
+		return nil, fmt.Errorf("google service account is missing client_email, private_key or token_uri")
+	}
+
+	key, err := jwt.ParseRSAPrivateKeyFromPEM([]byte(account.PrivateKey))
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse Google service account key: %w", err)
+	}
+
+	if baseURL == "" {
+		baseURL = googlePlayDefaultAPIURL
+	}
+
+	return &GooglePlayAPIClient{
+		httpClient:  httpClient,
+		baseURL:     strings.TrimSuffix(baseURL, "/"),
+		clientEmail: account.ClientEmail,
+		privateKey:  key,
+		tokenURI:    account.TokenURI,
+	}, nil
+}
+
+// GetSubscription fetches the current state of a subscription purchase. Unknown tokens
+// return ErrStorePurchaseNotFound.
+func (g *GooglePlayAPIClient) GetSubscription(ctx context.Context, packageName, purchaseToken string) (*PlaySubscriptionPurchase, error) {
+	endpoint := fmt.Sprintf("%s/androidpublisher/v3/applications/%s/purchases/subscriptionsv2/tokens/%s",
+		g.baseURL, url.PathEscape(packageName), url.PathEscape(purchaseToken))
+
+	var purchase PlaySubscriptionPurchase
+	if err := g.do(ctx, http.MethodGet, endpoint, nil, &purchase); err != nil {
+		return nil, err
+	}
+	return &purchase, nil
+}
+
+// AcknowledgeSubscription acknowledges a purchase. Google refunds purchases that aren't
+// acknowledged within three days.
+func (g *GooglePlayAPIClient) AcknowledgeSubscription(ctx context.Context, packageName, productID, purchaseToken string) error {
+	endpoint := fmt.Sprintf("%s/androidpublisher/v3/applications/%s/purchases/subscriptions/%s/tokens/%s:acknowledge",
+		g.baseURL, url.PathEscape(packageName), url.PathEscape(productID), url.PathEscape(purchaseToken))
+	return g.do(ctx, http.MethodPost, endpoint, []byte("{}"), nil)
+}
+
+func (g *GooglePlayAPIClient) do(ctx context.Context, method, endpoint string, body []byte, out interface{}) error {
+	token, err := g.token(ctx)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set("Accept", "application/json")
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := g.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("google play request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode == http.StatusNotFound || resp.StatusCode == http.StatusGone:
+		return ErrStorePurchaseNotFound
+	case resp.StatusCode >= 300:
+		detail, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("google play returned status %d: %s", resp.StatusCode, strings.TrimSpace(string(detail)))
+	}
+
+	if out == nil {
+		return nil
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("failed to decode google play response: %w", err)
+	}
+	return nil
+}
+
+// token returns a cached access token, exchanging a freshly signed assertion when the
+// cached one is about to expire
+func (g *GooglePlayAPIClient) token(ctx context.Context) (string, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if g.accessToken != "" && time.Now().Add(googleAccessTokenLeeway).Before(g.expiresAt) {
+		return g.accessToken, nil
+	}
+
+	now := time.Now()
+	assertion, err := jwt.NewWithClaims(jwt.SigningMethodRS256, jwt.MapClaims{
+		"iss":   g.clientEmail,
+		"scope": googlePlayScope,
+		"aud":   g.tokenURI,
+		"iat":   now.Unix(),
+		"exp":   now.Add(time.Hour).Unix(),
+	}).SignedString(g.privateKey)
+	if err != nil {
+		return "", fmt.Errorf("failed to sign Google token assertion: %w", err)
+	}
+
+	form := url.Values{
+		"grant_type": {"urn:ietf:params:oauth:grant-type:jwt-bearer"},
+		"assertion":  {assertion},
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, g.tokenURI, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	resp, err := g.httpClient.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("google token request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("google token endpoint returned status %d", resp.StatusCode)
+	}
+
+	var result struct {
+		AccessToken string `json:"access_token"`
+		ExpiresIn   int64  `json:"expires_in"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return "", fmt.Errorf("failed to decode google token response: %w", err)
+	}
+	if result.AccessToken == "" {
+		return "", fmt.Errorf("google token endpoint returned no access token")
+	}
+
+	g.accessToken = result.AccessToken
+	g.expiresAt = now.Add(time.Duration(result.ExpiresIn) * time.Second)
+	return g.accessToken, nil
+}
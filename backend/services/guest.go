@@ -0,0 +1,255 @@
+package services
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"mobile-backend/config"
+	"mobile-backend/models"
+	"mobile-backend/utils"
+
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+// GuestEmailDomain is the reserved domain of the placeholder addresses guests get, which
+// can never receive mail
+const GuestEmailDomain = "guest.invalid"
+
+var (
+	ErrGuestAccountsDisabled = errors.New("guest accounts are disabled")
+	ErrGuestDeviceRequired   = errors.New("a device ID is required for guest sign in")
+	ErrInvalidGuestSecret    = errors.New("invalid guest secret")
+	ErrNotGuestAccount       = errors.New("account is not a guest account")
+)
+
+// GuestService lets people use the app before registering. A guest is an ordinary user
+// row flagged as a guest and bound to the device it signed in from; upgrading converts
+// that row in place, so everything the guest created stays with the account. Device IDs
+// aren't secret, so signing in as an existing guest also takes the secret the device was
+// given when the guest was created.
+type GuestService struct {
+	db        *gorm.DB
+	passwords *PasswordPolicyService
+	privacy   *PrivacyService
+	logger    *config.Logger
+	enabled   bool
+	ttl       time.Duration
+}
+
+// NewGuestService creates a new guest service configured from the environment. privacy
+// erases stale guests; passwords may be nil to accept any password on upgrade.
+func NewGuestService(db *gorm.DB, passwords *PasswordPolicyService, privacy *PrivacyService, logger *config.Logger) (*GuestService, error) {
+	ttl, err := time.ParseDuration(getEnvOrDefault("GUEST_ACCOUNT_TTL", "720h"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid GUEST_ACCOUNT_TTL: %w", err)
+	}
+	if ttl < 24*time.Hour {
+		return nil, fmt.Errorf("invalid GUEST_ACCOUNT_TTL: must be at least 24h")
+	}
+
+	return &GuestService{
+		db:        db,
+		passwords: passwords,
+		privacy:   privacy,
+		logger:    logger,
+		enabled:   utils.ParseBool(os.Getenv("GUEST_ACCOUNTS_ENABLED"), true),
+		ttl:       ttl,
+	}, nil
+}
+
+// SignIn returns the guest bound to the device, creating one on the device's first
+// guest sign in. A new guest comes with a secret that is only returned this once; the
+// device has to present it to sign in as the guest again, and a guest whose device lost
+// it can only carry on through its refresh token.
+func (s *GuestService) SignIn(ctx context.Context, deviceID, secret string) (*models.User, string, error) {
+	if !s.enabled {
+		return nil, "", ErrGuestAccountsDisabled
+	}
+	deviceID = strings.TrimSpace(deviceID)
+	if deviceID == "" {
+		return nil, "", ErrGuestDeviceRequired
+	}
+	deviceHash := utils.HashToken(deviceID)
+
+	user, err := s.findGuest(ctx, deviceHash)
+	if err != nil {
+		return nil, "", err
+	}
+	if user != nil {
+		if err := s.checkSecret(ctx, user, secret); err != nil {
+			return nil, "", err
+		}
+		if !user.IsActive {
+			return nil, "", ErrAccountDeactivated
+		}
+		now := time.Now()
+		if err := s.db.WithContext(ctx).Model(user).Update("last_login", now).Error; err != nil {
+			return nil, "", fmt.Errorf("failed to update guest: %w", err)
+		}
+		return user, "", nil
+	}
+
+	suffix, err := utils.GenerateRandomString(12)
+	if err != nil {
+		return nil, "", err
+	}
+	// Guests get an unusable random password; upgrading sets a real one
+	password, err := utils.GenerateRandomString(32)
+	if err != nil {
+		return nil, "", err
+	}
+	newSecret, err := utils.GenerateRandomString(32)
+	if err != nil {
+		return nil, "", err
+	}
+	secretHash := utils.HashToken(newSecret)
+	now := time.Now()
+	user = &models.User{
+		Email:           fmt.Sprintf("guest-%s@%s", suffix, GuestEmailDomain),
+		Password:        password, // Will be hashed by GORM BeforeCreate hook
+		Name:            "Guest",
+		IsActive:        true,
+		IsGuest:         true,
+		GuestDeviceHash: &deviceHash,
+		GuestSecretHash: &secretHash,
+		LastLogin:       &now,
+	}
+	if err := s.db.WithContext(ctx).Create(user).Error; err != nil {
+		// Another request from the same device may have created the guest first; only
+		// that request got the secret
+		if existing, findErr := s.findGuest(ctx, deviceHash); findErr == nil && existing != nil {
+			return nil, "", s.checkSecret(ctx, existing, secret)
+		}
+		return nil, "", fmt.Errorf("failed to create guest: %w", err)
+	}
+
+	s.logger.LogBusinessEvent(ctx, "guest_created", zap.Uint("user_id", user.ID))
+	return user, newSecret, nil
+}
+
+// checkSecret returns ErrInvalidGuestSecret unless secret is the one the guest was created
+// with. Guests created before secrets were issued have none and can't sign in again.
+func (s *GuestService) checkSecret(ctx context.Context, user *models.User, secret string) error {
+	if user.GuestSecretHash != nil && secret != "" &&
+		subtle.ConstantTimeCompare([]byte(*user.GuestSecretHash), []byte(utils.HashToken(secret))) == 1 {
+		return nil
+	}
+	s.logger.LogSecurityEvent(ctx, "guest_secret_rejected", "medium", zap.Uint("user_id", user.ID))
+	return ErrInvalidGuestSecret
+}
+
+// UpgradeWithPassword turns a guest into a full account with an email and password. The
+// user keeps their ID, so their data, sessions and devices are kept.
+func (s *GuestService) UpgradeWithPassword(ctx context.Context, userID uint, email, password, name string) (*models.User, error) {
+	var user models.User
+	if err := s.db.WithContext(ctx).First(&user, userID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrUserNotFound
+		}
+		return nil, fmt.Errorf("failed to load user: %w", err)
+	}
+	if !user.IsGuest {
+		return nil, ErrNotGuestAccount
+	}
+
+	email = normalizeEmail(email)
+	if err := s.passwords.Validate(ctx, nil, password); err != nil {
+		return nil, err
+	}
+
+	err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var taken int64
+		if err := tx.Model(&models.User{}).Where("LOWER(email) = ? AND id <> ?", email, user.ID).
+			Count(&taken).Error; err != nil {
+			return fmt.Errorf("failed to check email: %w", err)
+		}
+		if taken > 0 {
+			return ErrUserAlreadyExists
+		}
+
+		if err := tx.Model(&user).Updates(guestUpgradeUpdates(email, name, nil)).Error; err != nil {
+			return fmt.Errorf("failed to upgrade guest: %w", err)
+		}
+		// The guest's random password isn't worth keeping in the history
+		user.Password = ""
+		return s.passwords.SetPassword(tx, &user, password)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	s.logger.LogBusinessEvent(ctx, "guest_upgraded", zap.Uint("user_id", user.ID), zap.String("method", "password"))
+	return s.reload(ctx, user.ID)
+}
+
+// PurgeStaleGuests erases guests that haven't signed in or refreshed a session within
+// GUEST_ACCOUNT_TTL. Guests that can't be erased yet, such as those with an active
+// subscription, are skipped and retried on the next run.
+func (s *GuestService) PurgeStaleGuests(ctx context.Context) (int, error) {
+	cutoff := time.Now().Add(-s.ttl)
+	recentSessions := s.db.Model(&models.Session{}).Select("user_id").Where("last_used_at >= ?", cutoff)
+
+	var guestIDs []uint
+	if err := s.db.WithContext(ctx).Model(&models.User{}).
+		Where("is_guest = ? AND COALESCE(last_login, created_at) < ?", true, cutoff).
+		Where("id NOT IN (?)", recentSessions).
+		Pluck("id", &guestIDs).Error; err != nil {
+		return 0, fmt.Errorf("failed to load stale guests: %w", err)
+	}
+
+	purged := 0
+	for _, userID := range guestIDs {
+		if _, err := s.privacy.EraseNow(ctx, userID); err != nil {
+			s.logger.LogError(ctx, err, "Failed to purge stale guest", zap.Uint("user_id", userID))
+			continue
+		}
+		purged++
+	}
+
+	if purged > 0 {
+		s.logger.LogBusinessEvent(ctx, "stale_guests_purged", zap.Int("count", purged))
+	}
+	return purged, nil
+}
+
+func (s *GuestService) findGuest(ctx context.Context, deviceHash string) (*models.User, error) {
+	var user models.User
+	err := s.db.WithContext(ctx).Where("is_guest = ? AND guest_device_hash = ?", true, deviceHash).First(&user).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to load guest: %w", err)
+	}
+	return &user, nil
+}
+
+func (s *GuestService) reload(ctx context.Context, userID uint) (*models.User, error) {
+	var user models.User
+	if err := s.db.WithContext(ctx).First(&user, userID).Error; err != nil {
+		return nil, fmt.Errorf("failed to load user: %w", err)
+	}
+	return &user, nil
+}
+
+// guestUpgradeUpdates are the column changes that turn a guest into a full account.
+// verifiedAt is set when the new email is already known to belong to the user.
+func guestUpgradeUpdates(email, name string, verifiedAt *time.Time) map[string]interface{} {
+	updates := map[string]interface{}{
+		"email":             email,
+		"is_guest":          false,
+		"guest_device_hash": nil,
+		"guest_secret_hash": nil,
+		"email_verified_at": verifiedAt,
+	}
+	if name = strings.TrimSpace(name); name != "" {
+		updates["name"] = name
+	}
+	return updates
+}
@@ -0,0 +1,635 @@
+package services
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"mobile-backend/models"
+
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Payment methods recorded on subscriptions and payments bought through the app stores
+const (
+	AppStorePaymentMethod   = "app_store"
+	GooglePlayPaymentMethod = "google_play"
+)
+
+var (
+	ErrStoreNotConfigured              = errors.New("store is not configured")
+	ErrInvalidStorePurchase            = errors.New("invalid store purchase")
+	ErrStorePurchaseNotFound           = errors.New("store purchase not found")
+	ErrUnknownStoreProduct             = errors.New("store product is not linked to a plan")
+	ErrStorePurchaseOwnedByAnotherUser = errors.New("store purchase belongs to another user")
+	ErrInvalidStoreNotification        = errors.New("invalid store notification")
+
+	// errStorePurchaseRecorded is returned when another request created the purchase's
+	// subscription between looking it up and creating it
+	errStorePurchaseRecorded = errors.New("store purchase already recorded")
+)
+
+// IsStorePaymentMethod reports whether a subscription or payment was bought through an
+// app store. Store subscriptions can only be managed by the user in the store.
+func IsStorePaymentMethod(paymentMethod string) bool {
+	return paymentMethod == AppStorePaymentMethod || paymentMethod == GooglePlayPaymentMethod
+}
+
+// storePurchase is a store subscription purchase translated into our subscription and
+// payment records
+type storePurchase struct {
+	paymentMethod  string
+	storeProductID string
+	// subscriptionID is the Apple original transaction ID or the Play purchase token;
+	// previousSubscriptionID is the purchase token a Play upgrade or resubscribe replaced
+	subscriptionID         string
+	previousSubscriptionID string
+	// latest is set when the purchase is the store's current state rather than a
+	// transaction that may be older than what we've already recorded
+	latest bool
+
+	status            string
+	periodStart       time.Time
+	periodEnd         time.Time
+	cancelAtPeriodEnd bool
+	canceledAt        *time.Time
+	trial             bool
+	quantity          int
+	metadata          models.JSONMap
+
+	// orderID identifies the charge for the period; it's empty when nothing was charged.
+	// A zero amount is charged at the plan's price.
+	orderID       string
+	amount        int64
+	currency      string
+	paymentStatus string
+}
+
+// InAppPurchaseService verifies App Store and Google Play subscription purchases and
+// keeps them in sync through the stores' server notifications. Store purchases are
+// recorded as Subscription and Payment rows with an app_store or google_play payment
+// method, so User.IsPro is derived the same way wherever the user paid.
+type InAppPurchaseService struct {
+	db                        *gorm.DB
+	subscriptionStatusService *SubscriptionStatusService
+	logger                    *zap.Logger
+
+	appStore        *AppStoreVerifier
+	play            PlayDeveloperClient
+	playPackageName string
+	rtdnToken       string
+}
+
+// NewInAppPurchaseService creates the service from the environment. The App Store is
+// enabled by APPLE_BUNDLE_ID and Google Play by GOOGLE_PLAY_PACKAGE_NAME; a store that
+// isn't configured answers with ErrStoreNotConfigured.
+func NewInAppPurchaseService(db *gorm.DB, subscriptionStatusService *SubscriptionStatusService, logger *zap.Logger) (*InAppPurchaseService, error) {
+	s := &InAppPurchaseService{
+		db:                        db,
+		subscriptionStatusService: subscriptionStatusService,
+		logger:                    logger,
+		playPackageName:           getEnvOrDefault("GOOGLE_PLAY_PACKAGE_NAME", ""),
+		rtdnToken:                 getEnvOrDefault("GOOGLE_PLAY_RTDN_TOKEN", ""),
+	}
+
+	if bundleID := getEnvOrDefault("APPLE_BUNDLE_ID", ""); bundleID != "" {
+		roots, err := LoadAppStoreRootCertificates(strings.Split(getEnvOrDefault("APPLE_ROOT_CERTIFICATES", ""), ","))
+		if err != nil {
+			return nil, err
+		}
+		s.appStore = NewAppStoreVerifier(bundleID, roots)
+	}
+
+	if s.playPackageName != "" {
+		fixturesDir := getEnvOrDefault("GOOGLE_PLAY_FIXTURES_DIR", "")
+		serviceAccountFile := getEnvOrDefault("GOOGLE_PLAY_SERVICE_ACCOUNT_FILE", "")
+		switch {
+		case fixturesDir != "":
+			s.play = NewFixturePlayClient(fixturesDir)
+		case serviceAccountFile != "":
+			serviceAccount, err := os.ReadFile(serviceAccountFile)
+			if err != nil {
+				return nil, fmt.Errorf("failed to read Google Play service account: %w", err)
+			}
+			client, err := NewGooglePlayAPIClient(serviceAccount, &http.Client{Timeout: 10 * time.Second}, getEnvOrDefault("GOOGLE_PLAY_API_URL", ""))
+			if err != nil {
+				return nil, err
+			}
+			s.play = client
+		default:
+			return nil, errors.New("GOOGLE_PLAY_SERVICE_ACCOUNT_FILE is required when GOOGLE_PLAY_PACKAGE_NAME is set")
+		}
+	}
+
+	return s, nil
+}
+
+// VerifyAppStoreTransaction verifies a signed transaction the app received from StoreKit
+// after a purchase or restore, and links its subscription to userID. created reports
+// whether the subscription is new to us.
+func (s *InAppPurchaseService) VerifyAppStoreTransaction(ctx context.Context, userID uint, signedTransaction string) (sub *models.Subscription, created bool, err error) {
+	if s.appStore == nil {
+		return nil, false, fmt.Errorf("%w: App Store", ErrStoreNotConfigured)
+	}
+
+	tx, err := s.appStore.VerifyTransaction(signedTransaction)
+	if err != nil {
+		return nil, false, err
+	}
+	if tx.Type != appStoreAutoRenewableType {
+		return nil, false, fmt.Errorf("%w: %s purchases are not supported", ErrInvalidStorePurchase, tx.Type)
+	}
+
+	return s.apply(ctx, &userID, appStorePurchase(tx, nil, time.Now()))
+}
+
+// VerifyGooglePlayPurchase looks up a purchase token the app received from Play Billing,
+// links its subscription to userID and acknowledges the purchase. created reports
+// whether the subscription is new to us.
+func (s *InAppPurchaseService) VerifyGooglePlayPurchase(ctx context.Context, userID uint, productID, purchaseToken string) (sub *models.Subscription, created bool, err error) {
+	if s.play == nil {
+		return nil, false, fmt.Errorf("%w: Google Play", ErrStoreNotConfigured)
+	}
+	return s.refreshGooglePlaySubscription(ctx, &userID, productID, purchaseToken)
+}
+
+// HandleAppStoreNotification processes an App Store Server Notification V2. Notifications
+// about subscriptions no user has linked yet are acknowledged and ignored; the app links
+// them when it posts the transaction.
+func (s *InAppPurchaseService) HandleAppStoreNotification(ctx context.Context, signedPayload string) error {
+	if s.appStore == nil {
+		return fmt.Errorf("%w: App Store", ErrStoreNotConfigured)
+	}
+
+	notification, err := s.appStore.VerifyNotification(signedPayload)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidStoreNotification, err)
+	}
+
+	eventType := notification.NotificationType
+	if notification.Subtype != "" {
+		eventType += "." + notification.Subtype
+	}
+	data := models.JSONMap{"environment": notification.Data.Environment}
+
+	return s.processNotification(ctx, AppStorePaymentMethod, notification.NotificationUUID, eventType, data, func() error {
+		// TEST and summary notifications carry no transaction
+		if notification.Data.SignedTransactionInfo == "" {
+			return nil
+		}
+
+		tx, err := s.appStore.VerifyTransaction(notification.Data.SignedTransactionInfo)
+		if err != nil {
+			return err
+		}
+		if tx.Type != appStoreAutoRenewableType {
+			return nil
+		}
+
+		var renewal *AppStoreRenewalInfo
+		if notification.Data.SignedRenewalInfo != "" {
+			if renewal, err = s.appStore.VerifyRenewalInfo(notification.Data.SignedRenewalInfo); err != nil {
+				return err
+			}
+		}
+
+		_, _, err = s.apply(ctx, nil, appStorePurchase(tx, renewal, time.Now()))
+		return s.ignoreUnknownProduct(err)
+	})
+}
+
+// HandleGooglePlayNotification processes a real-time developer notification pushed by
+// Pub/Sub. The push subscription's endpoint must carry GOOGLE_PLAY_RTDN_TOKEN as its
+// token query parameter. Notifications only say that a purchase changed, so its current
+// state is fetched from the Play Developer API.
+func (s *InAppPurchaseService) HandleGooglePlayNotification(ctx context.Context, token string, body []byte) error {
+	if s.play == nil || s.rtdnToken == "" {
+		return fmt.Errorf("%w: Google Play", ErrStoreNotConfigured)
+	}
+	if subtle.ConstantTimeCompare([]byte(token), []byte(s.rtdnToken)) != 1 {
+		return fmt.Errorf("%w: bad push token", ErrInvalidStoreNotification)
+	}
+
+	var push struct {
+		Message struct {
+			Data      string `json:"data"`
+			MessageID string `json:"messageId"`
+		} `json:"message"`
+	}
+	if err := json.Unmarshal(body, &push); err != nil || push.Message.MessageID == "" {
+		return fmt.Errorf("%w: malformed push message", ErrInvalidStoreNotification)
+	}
+	decoded, err := base64.StdEncoding.DecodeString(push.Message.Data)
+	if err != nil {
+		return fmt.Errorf("%w: malformed push data", ErrInvalidStoreNotification)
+	}
+
+	var notification PlayDeveloperNotification
+	if err := json.Unmarshal(decoded, &notification); err != nil {
+		return fmt.Errorf("%w: malformed developer notification", ErrInvalidStoreNotification)
+	}
+	if notification.PackageName != s.playPackageName {
+		return fmt.Errorf("%w: notification is for package %q", ErrInvalidStoreNotification, notification.PackageName)
+	}
+
+	eventType := "test"
+	data := models.JSONMap{}
+	switch {
+	case notification.SubscriptionNotification != nil:
+		eventType = fmt.Sprintf("subscription.%d", notification.SubscriptionNotification.NotificationType)
+		data["subscription_id"] = notification.SubscriptionNotification.SubscriptionID
+	case notification.VoidedPurchase != nil:
+		eventType = "voided_purchase"
+		data["order_id"] = notification.VoidedPurchase.OrderID
+	}
+
+	return s.processNotification(ctx, GooglePlayPaymentMethod, push.Message.MessageID, eventType, data, func() error {
+		switch {
+		case notification.SubscriptionNotification != nil:
+			n := notification.SubscriptionNotification
+			_, _, err := s.refreshGooglePlaySubscription(ctx, nil, n.SubscriptionID, n.PurchaseToken)
+			return s.ignoreUnknownProduct(err)
+		case notification.VoidedPurchase != nil && notification.VoidedPurchase.ProductType == playVoidedProductTypeSubscription:
+			return s.voidGooglePlayPurchase(ctx, notification.VoidedPurchase)
+		}
+		return nil
+	})
+}
+
+// refreshGooglePlaySubscription fetches a purchase from Play and applies it. Purchases
+// that are still pending payment are acknowledged once they go through.
+func (s *InAppPurchaseService) refreshGooglePlaySubscription(ctx context.Context, userID *uint, productID, purchaseToken string) (*models.Subscription, bool, error) {
+	purchase, err := s.play.GetSubscription(ctx, s.playPackageName, purchaseToken)
+	if err != nil {
+		return nil, false, err
+	}
+
+	p, err := playPurchase(purchaseToken, purchase, time.Now())
+	if err != nil {
+		return nil, false, err
+	}
+	if productID != "" && p.storeProductID != productID {
+		return nil, false, fmt.Errorf("%w: purchase is for product %q", ErrInvalidStorePurchase, p.storeProductID)
+	}
+
+	sub, created, err := s.apply(ctx, userID, p)
+	if err != nil || sub == nil {
+		return sub, created, err
+	}
+
+	if purchase.AcknowledgementState == playAcknowledgementStatePending && purchase.SubscriptionState != PlaySubscriptionStatePending {
+		// Unacknowledged purchases are acknowledged again on the next notification
+		if err := s.play.AcknowledgeSubscription(ctx, s.playPackageName, p.storeProductID, purchaseToken); err != nil {
+			s.logger.Warn("Failed to acknowledge Google Play purchase",
+				zap.Uint("subscription_id", sub.ID),
+				zap.Error(err),
+			)
+		}
+	}
+	return sub, created, nil
+}
+
+// voidGooglePlayPurchase marks a refunded or charged back order and refreshes the
+// subscription it belonged to
+func (s *InAppPurchaseService) voidGooglePlayPurchase(ctx context.Context, voided *PlayVoidedPurchaseNotification) error {
+	if err := s.db.WithContext(ctx).Model(&models.Payment{}).
+		Where("payment_method = ? AND provider_payment_id = ?", GooglePlayPaymentMethod, voided.OrderID).
+		Update("status", "refunded").Error; err != nil {
+		return fmt.Errorf("failed to update payment status: %w", err)
+	}
+
+	sub, err := s.findSubscription(ctx, GooglePlayPaymentMethod, voided.PurchaseToken)
+	if err != nil || sub == nil {
+		return err
+	}
+	_, _, err = s.refreshGooglePlaySubscription(ctx, nil, "", voided.PurchaseToken)
+	if errors.Is(err, ErrStorePurchaseNotFound) {
+		return nil
+	}
+	return s.ignoreUnknownProduct(err)
+}
+
+// apply records a store purchase. A purchase is linked to the first user that verifies
+// it; after that it can only be updated by notifications or by the same user. Without a
+// userID, purchases nobody has linked yet are skipped and a nil subscription returned.
+func (s *InAppPurchaseService) apply(ctx context.Context, userID *uint, p *storePurchase) (*models.Subscription, bool, error) {
+	sub, created, err := s.applyOnce(ctx, userID, p)
+	if errors.Is(err, errStorePurchaseRecorded) {
+		// Another request recorded the purchase first, so update its subscription instead
+		return s.applyOnce(ctx, userID, p)
+	}
+	return sub, created, err
+}
+
+func (s *InAppPurchaseService) applyOnce(ctx context.Context, userID *uint, p *storePurchase) (*models.Subscription, bool, error) {
+	planColumn := "app_store_product_id"
+	if p.paymentMethod == GooglePlayPaymentMethod {
+		planColumn = "google_play_product_id"
+	}
+
+	var plan models.Plan
+	if err := s.db.WithContext(ctx).Where(planColumn+" = ?", p.storeProductID).First(&plan).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, false, fmt.Errorf("%w: %s", ErrUnknownStoreProduct, p.storeProductID)
+		}
+		return nil, false, fmt.Errorf("failed to find plan: %w", err)
+	}
+
+	sub, err := s.findSubscription(ctx, p.paymentMethod, p.subscriptionID)
+	if err == nil && sub == nil && p.previousSubscriptionID != "" {
+		sub, err = s.findSubscription(ctx, p.paymentMethod, p.previousSubscriptionID)
+	}
+	if err != nil {
+		return nil, false, err
+	}
+
+	switch {
+	case sub == nil && userID == nil:
+		s.logger.Info("Ignoring store purchase no user has linked",
+			zap.String("payment_method", p.paymentMethod),
+			zap.String("product_id", p.storeProductID),
+		)
+		return nil, false, nil
+	case sub != nil && userID != nil && sub.UserID != *userID:
+		return nil, false, ErrStorePurchaseOwnedByAnotherUser
+	}
+
+	created := sub == nil
+	if created {
+		sub = &models.Subscription{UserID: *userID, PaymentMethod: p.paymentMethod}
+	}
+
+	// An older transaction only records its payment; the subscription already reflects
+	// a later period
+	stale := !created && !p.latest && p.periodEnd.Before(sub.CurrentPeriodEnd)
+	if !stale {
+		periodStart := p.periodStart
+		// Play only reports when the subscription started, so a renewal's period starts
+		// where the previous one ended
+		if p.paymentMethod == GooglePlayPaymentMethod && !created && p.periodEnd.After(sub.CurrentPeriodEnd) && sub.CurrentPeriodEnd.After(periodStart) {
+			periodStart = sub.CurrentPeriodEnd
+		}
+
+		sub.ProductID = plan.ProductID
+		sub.PlanID = &plan.ID
+		sub.Status = p.status
+		sub.CurrentPeriodStart = periodStart
+		sub.CurrentPeriodEnd = p.periodEnd
+		sub.CancelAtPeriodEnd = p.cancelAtPeriodEnd
+		sub.CanceledAt = p.canceledAt
+		sub.Quantity = p.quantity
+		sub.Metadata = p.metadata
+		sub.ProviderSubscriptionID = p.subscriptionID
+		if p.trial {
+			sub.TrialStart = &periodStart
+			sub.TrialEnd = &p.periodEnd
+		}
+	}
+
+	err = s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if created {
+			// The unique index on the store's subscription ID settles concurrent
+			// verifications of the same purchase
+			result := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(sub)
+			if result.Error != nil {
+				return fmt.Errorf("failed to save subscription: %w", result.Error)
+			}
+			if result.RowsAffected == 0 {
+				return errStorePurchaseRecorded
+			}
+		} else if err := tx.Save(sub).Error; err != nil {
+			return fmt.Errorf("failed to save subscription: %w", err)
+		}
+		if p.orderID == "" {
+			return nil
+		}
+		return s.recordPayment(tx, sub, &plan, p)
+	})
+	if err != nil {
+		return nil, false, err
+	}
+
+	if !stale && s.subscriptionStatusService != nil {
+		if err := s.subscriptionStatusService.UpdateUserSubscriptionStatus(ctx, sub.UserID, sub); err != nil {
+			return nil, false, fmt.Errorf("failed to update user subscription status: %w", err)
+		}
+	}
+	return sub, created, nil
+}
+
+// recordPayment creates or updates the payment for the purchase's order. Refunded
+// payments stay refunded.
+func (s *InAppPurchaseService) recordPayment(tx *gorm.DB, sub *models.Subscription, plan *models.Plan, p *storePurchase) error {
+	var payment models.Payment
+	err := tx.Where("payment_method = ? AND provider_payment_id = ?", p.paymentMethod, p.orderID).First(&payment).Error
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		amount, currency := p.amount, strings.ToLower(p.currency)
+		if amount == 0 {
+			amount = plan.Price * int64(sub.Quantity)
+		}
+		if currency == "" {
+			currency = plan.Currency
+		}
+		payment = models.Payment{
+			UserID:            sub.UserID,
+			ProductID:         sub.ProductID,
+			SubscriptionID:    &sub.ID,
+			Amount:            amount,
+			Currency:          currency,
+			PaymentMethod:     p.paymentMethod,
+			ProviderPaymentID: p.orderID,
+			Description:       fmt.Sprintf("Store subscription payment for %s", plan.Name),
+		}
+	case err != nil:
+		return fmt.Errorf("failed to load payment: %w", err)
+	case payment.Status == "refunded":
+		return nil
+	}
+
+	payment.Status = p.paymentStatus
+	if err := tx.Save(&payment).Error; err != nil {
+		return fmt.Errorf("failed to save payment: %w", err)
+	}
+	return nil
+}
+
+// processNotification records a store notification and applies it once; redelivered
+// notifications are acknowledged without being applied again
+func (s *InAppPurchaseService) processNotification(ctx context.Context, provider, eventID, eventType string, data models.JSONMap, apply func() error) error {
+	var webhookEvent models.WebhookEvent
+	err := s.db.WithContext(ctx).Where("event_id = ?", eventID).First(&webhookEvent).Error
+	switch {
+	case err == nil && webhookEvent.Processed:
+		return nil
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		webhookEvent = models.WebhookEvent{
+			Provider:  provider,
+			EventType: eventType,
+			EventID:   eventID,
+			Data:      data,
+		}
+		if err := s.db.WithContext(ctx).Create(&webhookEvent).Error; err != nil {
+			return fmt.Errorf("failed to create webhook event record: %w", err)
+		}
+	case err != nil:
+		return fmt.Errorf("failed to load webhook event: %w", err)
+	}
+
+	if err := apply(); err != nil {
+		s.db.WithContext(ctx).Model(&webhookEvent).Update("error", err.Error())
+		return err
+	}
+
+	return s.db.WithContext(ctx).Model(&webhookEvent).Updates(map[string]interface{}{
+		"processed":    true,
+		"processed_at": time.Now(),
+	}).Error
+}
+
+// ignoreUnknownProduct drops errors for store products without a plan, which the store
+// can't fix by redelivering the notification
+func (s *InAppPurchaseService) ignoreUnknownProduct(err error) error {
+	if errors.Is(err, ErrUnknownStoreProduct) {
+		s.logger.Warn("Ignoring store notification for a product without a plan", zap.Error(err))
+		return nil
+	}
+	return err
+}
+
+func (s *InAppPurchaseService) findSubscription(ctx context.Context, paymentMethod, storeID string) (*models.Subscription, error) {
+	var sub models.Subscription
+	err := s.db.WithContext(ctx).
+		Where("payment_method = ? AND provider_subscription_id = ?", paymentMethod, storeID).
+		First(&sub).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to find subscription: %w", err)
+	}
+	return &sub, nil
+}
+
+// appStorePurchase maps a transaction, and the renewal info sent along with
+// notifications, to our subscription states. An expired subscription stays active
+// during Apple's billing grace period and is past due while Apple retries the charge.
+func appStorePurchase(tx *AppStoreTransaction, renewal *AppStoreRenewalInfo, now time.Time) *storePurchase {
+	p := &storePurchase{
+		paymentMethod:     AppStorePaymentMethod,
+		storeProductID:    tx.ProductID,
+		subscriptionID:    tx.OriginalTransactionID,
+		periodStart:       appStoreTime(tx.PurchaseDate),
+		periodEnd:         appStoreTime(tx.ExpiresDate),
+		cancelAtPeriodEnd: renewal != nil && renewal.AutoRenewStatus == 0,
+		trial:             tx.OfferDiscountType == appStoreFreeTrialOffer,
+		quantity:          tx.Quantity,
+		metadata:          models.JSONMap{"environment": tx.Environment},
+		orderID:           tx.TransactionID,
+		// Apple reports prices in milliunits
+		amount:        tx.Price / 10,
+		currency:      tx.Currency,
+		paymentStatus: "succeeded",
+	}
+	if p.quantity < 1 {
+		p.quantity = 1
+	}
+	if p.trial {
+		p.orderID = ""
+	}
+
+	switch {
+	case tx.RevocationDate != 0:
+		revokedAt := appStoreTime(tx.RevocationDate)
+		p.status = "canceled"
+		p.canceledAt = &revokedAt
+		p.paymentStatus = "refunded"
+	case p.periodEnd.After(now):
+		p.status = "active"
+		if p.trial {
+			p.status = "trialing"
+		}
+	case renewal != nil && appStoreTime(renewal.GracePeriodExpiresDate).After(now):
+		p.status = "active"
+		p.periodEnd = appStoreTime(renewal.GracePeriodExpiresDate)
+	case renewal != nil && renewal.IsInBillingRetryPeriod:
+		p.status = "past_due"
+	default:
+		expiredAt := p.periodEnd
+		p.status = "canceled"
+		p.canceledAt = &expiredAt
+	}
+	return p
+}
+
+// playPurchase maps a Play subscription purchase to our subscription states
+func playPurchase(purchaseToken string, purchase *PlaySubscriptionPurchase, now time.Time) (*storePurchase, error) {
+	if len(purchase.LineItems) == 0 {
+		return nil, fmt.Errorf("%w: purchase has no line items", ErrInvalidStorePurchase)
+	}
+	item := purchase.LineItems[0]
+
+	periodStart, periodEnd := now, now
+	if purchase.StartTime != "" {
+		start, err := time.Parse(time.RFC3339Nano, purchase.StartTime)
+		if err != nil {
+			return nil, fmt.Errorf("%w: malformed start time", ErrInvalidStorePurchase)
+		}
+		periodStart = start
+	}
+	if item.ExpiryTime != "" {
+		expiry, err := time.Parse(time.RFC3339Nano, item.ExpiryTime)
+		if err != nil {
+			return nil, fmt.Errorf("%w: malformed expiry time", ErrInvalidStorePurchase)
+		}
+		periodEnd = expiry
+	}
+
+	p := &storePurchase{
+		paymentMethod:          GooglePlayPaymentMethod,
+		storeProductID:         item.ProductID,
+		subscriptionID:         purchaseToken,
+		previousSubscriptionID: purchase.LinkedPurchaseToken,
+		latest:                 true,
+		periodStart:            periodStart,
+		periodEnd:              periodEnd,
+		cancelAtPeriodEnd:      item.AutoRenewingPlan != nil && !item.AutoRenewingPlan.AutoRenewEnabled,
+		quantity:               1,
+		metadata:               models.JSONMap{"test_purchase": purchase.TestPurchase != nil},
+		orderID:                purchase.LatestOrderID,
+		paymentStatus:          "succeeded",
+	}
+
+	switch purchase.SubscriptionState {
+	case PlaySubscriptionStateActive, PlaySubscriptionStateInGrace:
+		p.status = "active"
+	case PlaySubscriptionStateCanceled:
+		// Canceled subscriptions keep access until the end of the paid period
+		p.status = "active"
+		p.cancelAtPeriodEnd = true
+		if !periodEnd.After(now) {
+			p.status = "canceled"
+			p.canceledAt = &periodEnd
+		}
+	case PlaySubscriptionStateOnHold:
+		p.status = "past_due"
+	case PlaySubscriptionStatePaused:
+		p.status = "paused"
+	case PlaySubscriptionStatePending:
+		p.status = "incomplete"
+		p.paymentStatus = "pending"
+	default:
+		p.status = "canceled"
+		p.canceledAt = &periodEnd
+	}
+	return p, nil
+}
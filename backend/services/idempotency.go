@@ -0,0 +1,115 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"mobile-backend/config"
+	"mobile-backend/models"
+
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// idempotencyLockTimeout is how long an unfinished request holds its key. A key still in
+// flight after that belonged to a request that crashed, and the next retry takes it over.
+const idempotencyLockTimeout = time.Minute
+
+// IdempotencyService stores the responses to requests sent with an Idempotency-Key
+// header, so that retried payment, subscription and sync calls return the original
+// response instead of creating duplicates.
+type IdempotencyService struct {
+	db     *gorm.DB
+	logger *config.Logger
+	ttl    time.Duration
+}
+
+// NewIdempotencyService creates a new idempotency service configured from the environment
+func NewIdempotencyService(db *gorm.DB, logger *config.Logger) (*IdempotencyService, error) {
+	ttl, err := time.ParseDuration(getEnvOrDefault("IDEMPOTENCY_KEY_TTL", "24h"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid IDEMPOTENCY_KEY_TTL: %w", err)
+	}
+	if ttl < time.Hour {
+		return nil, fmt.Errorf("invalid IDEMPOTENCY_KEY_TTL: must be at least 1h")
+	}
+
+	return &IdempotencyService{db: db, logger: logger, ttl: ttl}, nil
+}
+
+// Begin claims key for a request. created reports that the caller claimed it and must run
+// the request and then Complete or Release the key. Otherwise the existing key is
+// returned: it is either still in flight or holds the stored response, and its
+// RequestHash tells whether it was used for the same request.
+func (s *IdempotencyService) Begin(ctx context.Context, userID uint, key, requestHash string) (*models.IdempotencyKey, bool, error) {
+	for attempt := 0; attempt < 2; attempt++ {
+		now := time.Now()
+		record := &models.IdempotencyKey{
+			UserID:      userID,
+			Key:         key,
+			RequestHash: requestHash,
+			ExpiresAt:   now.Add(s.ttl),
+		}
+		result := s.db.WithContext(ctx).Clauses(clause.OnConflict{DoNothing: true}).Create(record)
+		if result.Error != nil {
+			return nil, false, fmt.Errorf("failed to store idempotency key: %w", result.Error)
+		}
+		if result.RowsAffected == 1 {
+			return record, true, nil
+		}
+
+		var existing models.IdempotencyKey
+		if err := s.db.WithContext(ctx).Where("user_id = ? AND key = ?", userID, key).First(&existing).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				continue // released in the meantime
+			}
+			return nil, false, fmt.Errorf("failed to load idempotency key: %w", err)
+		}
+
+		abandoned := !existing.IsCompleted() && now.Sub(existing.CreatedAt) > idempotencyLockTimeout
+		if now.Before(existing.ExpiresAt) && !abandoned {
+			return &existing, false, nil
+		}
+		// Expired or abandoned keys are dropped and claimed again
+		if err := s.db.WithContext(ctx).Delete(&models.IdempotencyKey{}, existing.ID).Error; err != nil {
+			return nil, false, fmt.Errorf("failed to release idempotency key: %w", err)
+		}
+	}
+	return nil, false, fmt.Errorf("failed to claim idempotency key")
+}
+
+// Complete stores the response to the request that claimed the key
+func (s *IdempotencyService) Complete(ctx context.Context, record *models.IdempotencyKey, statusCode int, body []byte) error {
+	now := time.Now()
+	if err := s.db.WithContext(ctx).Model(record).Updates(map[string]interface{}{
+		"status_code":   statusCode,
+		"response_body": string(body),
+		"completed_at":  now,
+	}).Error; err != nil {
+		return fmt.Errorf("failed to store idempotent response: %w", err)
+	}
+	return nil
+}
+
+// Release frees a key whose request failed in a way worth retrying, such as a server error
+func (s *IdempotencyService) Release(ctx context.Context, record *models.IdempotencyKey) error {
+	if err := s.db.WithContext(ctx).Delete(&models.IdempotencyKey{}, record.ID).Error; err != nil {
+		return fmt.Errorf("failed to release idempotency key: %w", err)
+	}
+	return nil
+}
+
+// PurgeExpired deletes keys past their TTL
+func (s *IdempotencyService) PurgeExpired(ctx context.Context) (int64, error) {
+	result := s.db.WithContext(ctx).Where("expires_at < ?", time.Now()).Delete(&models.IdempotencyKey{})
+	if result.Error != nil {
+		return 0, fmt.Errorf("failed to purge idempotency keys: %w", result.Error)
+	}
+	if result.RowsAffected > 0 {
+		s.logger.LogBusinessEvent(ctx, "idempotency_keys_purged", zap.Int64("count", result.RowsAffected))
+	}
+	return result.RowsAffected, nil
+}
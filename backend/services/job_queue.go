@@ -13,12 +13,13 @@ import (
 
 // JobQueueService handles background job processing
 type JobQueueService struct {
-	client    *asynq.Client
-	server    *asynq.Server
-	mux       *asynq.ServeMux
-	db        *gorm.DB
-	logger    *zap.Logger
-	redisAddr string
+	client       *asynq.Client
+	server       *asynq.Server
+	mux          *asynq.ServeMux
+	db           *gorm.DB
+	logger       *zap.Logger
+	redisAddr    string
+	emailService *EmailService
 }
 
 // Job types
@@ -33,6 +34,10 @@ const (
 	TypeUserActivity          = "user:activity"
 	TypeSubscriptionReminder  = "subscription:reminder"
 	TypeBackupTask            = "backup:task"
+	TypeUserDataExport        = "privacy:export"
+	TypeUserErasure           = "privacy:erasure"
+	TypeBulkUserAction        = "admin:bulk_user_action"
+	TypeNewDeviceAlert        = "device:new_device_alert"
 )
 
 // Job payloads
@@ -89,8 +94,11 @@ type UserActivityPayload struct {
 
 type SubscriptionReminderPayload struct {
 	SubscriptionID uint   `json:"subscription_id"`
-	ReminderType   string `json:"reminder_type"` // trial_ending, payment_due, expired
+	ReminderType   string `json:"reminder_type"` // payment_failed, payment_retry, final_notice, access_ended
 	DaysBefore     int    `json:"days_before"`
+	// DunningID and Step identify a dunning reminder (see DunningService)
+	DunningID uint `json:"dunning_id,omitempty"`
+	Step      int  `json:"step,omitempty"`
 }
 
 type BackupTaskPayload struct {
@@ -101,6 +109,21 @@ type BackupTaskPayload struct {
 	Metadata    map[string]interface{} `json:"metadata"`
 }
 
+// DataRequestPayload identifies the models.DataRequest a privacy job works on
+type DataRequestPayload struct {
+	RequestID uint `json:"request_id"`
+}
+
+// BulkUserActionPayload identifies the models.BulkUserAction a bulk admin job works on
+type BulkUserActionPayload struct {
+	ActionID uint `json:"action_id"`
+}
+
+// NewDeviceAlertPayload identifies the models.UserDevice a new-device alert is about
+type NewDeviceAlertPayload struct {
+	UserDeviceID uint `json:"user_device_id"`
+}
+
 // NewJobQueueService creates a new job queue service
 func NewJobQueueService(redisAddr string, db *gorm.DB, logger *zap.Logger) *JobQueueService {
 	// Redis client for enqueueing jobs
@@ -125,12 +148,13 @@ func NewJobQueueService(redisAddr string, db *gorm.DB, logger *zap.Logger) *JobQ
 	mux := asynq.NewServeMux()
 
 	service := &JobQueueService{
-		client:    client,
-		server:    server,
-		mux:       mux,
-		db:        db,
-		logger:    logger,
-		redisAddr: redisAddr,
+		client:       client,
+		server:       server,
+		mux:          mux,
+		db:           db,
+		logger:       logger,
+		redisAddr:    redisAddr,
+		emailService: NewEmailService(),
 	}
 
 	// Register job handlers
@@ -156,10 +180,15 @@ func (j *JobQueueService) registerHandlers() {
 	// System jobs
 	j.mux.HandleFunc(TypeCacheWarmup, j.handleCacheWarmup)
 	j.mux.HandleFunc(TypeUserActivity, j.handleUserActivity)
-	j.mux.HandleFunc(TypeSubscriptionReminder, j.handleSubscriptionReminder)
 	j.mux.HandleFunc(TypeBackupTask, j.handleBackupTask)
 }
 
+// RegisterHandler registers a handler for a job type owned by another service. It must
+// be called before Start.
+func (j *JobQueueService) RegisterHandler(taskType string, handler asynq.HandlerFunc) {
+	j.mux.Handle(taskType, handler)
+}
+
 // Start starts the job queue server
 func (j *JobQueueService) Start() error {
 	j.logger.Info("Starting job queue server...")
@@ -278,6 +307,46 @@ func (j *JobQueueService) EnqueueBackupTask(payload BackupTaskPayload, opts ...a
 	return j.client.Enqueue(task, opts...)
 }
 
+// EnqueueUserDataExport enqueues a personal data export job
+func (j *JobQueueService) EnqueueUserDataExport(payload DataRequestPayload, opts ...asynq.Option) (*asynq.TaskInfo, error) {
+	payloadBytes, err := json.Marshal(payload)
+	if err != nil {
+		return nil, err
+	}
+	task := asynq.NewTask(TypeUserDataExport, payloadBytes)
+	return j.client.Enqueue(task, opts...)
+}
+
+// EnqueueUserErasure enqueues an account erasure job
+func (j *JobQueueService) EnqueueUserErasure(payload DataRequestPayload, opts ...asynq.Option) (*asynq.TaskInfo, error) {
+	payloadBytes, err := json.Marshal(payload)
+	if err != nil {
+		return nil, err
+	}
+	task := asynq.NewTask(TypeUserErasure, payloadBytes)
+	return j.client.Enqueue(task, opts...)
+}
+
+// EnqueueBulkUserAction enqueues an administrator's action on many users
+func (j *JobQueueService) EnqueueBulkUserAction(payload BulkUserActionPayload, opts ...asynq.Option) (*asynq.TaskInfo, error) {
+	payloadBytes, err := json.Marshal(payload)
+	if err != nil {
+		return nil, err
+	}
+	task := asynq.NewTask(TypeBulkUserAction, payloadBytes)
+	return j.client.Enqueue(task, opts...)
+}
+
+// EnqueueNewDeviceAlert enqueues the alert sent when a user signs in from a new device
+func (j *JobQueueService) EnqueueNewDeviceAlert(payload NewDeviceAlertPayload, opts ...asynq.Option) (*asynq.TaskInfo, error) {
+	payloadBytes, err := json.Marshal(payload)
+	if err != nil {
+		return nil, err
+	}
+	task := asynq.NewTask(TypeNewDeviceAlert, payloadBytes)
+	return j.client.Enqueue(task, opts...)
+}
+
 // Job Handlers
 
 func (j *JobQueueService) handleEmailNotification(ctx context.Context, t *asynq.Task) error {
@@ -291,9 +360,16 @@ func (j *JobQueueService) handleEmailNotification(ctx context.Context, t *asynq.
 		zap.String("email", payload.Email),
 		zap.String("subject", payload.Subject))
 
-	// TODO: Implement actual email sending logic
-	// This would integrate with your email service
-	fmt.Printf("Sending email to %s: %s\n", payload.Email, payload.Subject)
+	if !j.emailService.IsConfigured() {
+		j.logger.Warn("SMTP is not configured, dropping email notification",
+			zap.String("email", payload.Email),
+			zap.String("subject", payload.Subject))
+		return nil
+	}
+
+	if err := j.emailService.SendEmail(payload.Email, payload.Subject, payload.Body); err != nil {
+		return fmt.Errorf("failed to send email: %w", err)
+	}
 
 	return nil
 }
@@ -420,23 +496,6 @@ func (j *JobQueueService) handleUserActivity(ctx context.Context, t *asynq.Task)
 	return nil
 }
 
-func (j *JobQueueService) handleSubscriptionReminder(ctx context.Context, t *asynq.Task) error {
-	var payload SubscriptionReminderPayload
-	if err := json.Unmarshal(t.Payload(), &payload); err != nil {
-		return fmt.Errorf("failed to unmarshal subscription reminder payload: %w", err)
-	}
-
-	j.logger.Info("Processing subscription reminder",
-		zap.Uint("subscription_id", payload.SubscriptionID),
-		zap.String("reminder_type", payload.ReminderType),
-		zap.Int("days_before", payload.DaysBefore))
-
-	// TODO: Implement subscription reminder logic
-	fmt.Printf("Sending %s reminder for subscription %d\n", payload.ReminderType, payload.SubscriptionID)
-
-	return nil
-}
-
 func (j *JobQueueService) handleBackupTask(ctx context.Context, t *asynq.Task) error {
 	var payload BackupTaskPayload
 	if err := json.Unmarshal(t.Payload(), &payload); err != nil {
@@ -0,0 +1,251 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+
+	"mobile-backend/models"
+	"mobile-backend/utils"
+
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	// keyringReloadInterval is how often instances pick up keys created elsewhere
+	keyringReloadInterval = time.Minute
+	// keyPublishDelay is how long a new key is published in the JWKS before it signs,
+	// so every instance and downstream verifier knows it before tokens appear
+	keyPublishDelay = 5 * keyringReloadInterval
+)
+
+// KeyringService persists JWT signing keys in the database so all instances share them,
+// keeps the in-memory keyring in sync, and rotates keys on a schedule.
+type KeyringService struct {
+	db               *gorm.DB
+	logger           *zap.Logger
+	keyring          *utils.Keyring
+	algorithm        string
+	rotationInterval time.Duration
+	encryptionKey    string
+}
+
+// NewKeyringService creates a new keyring service configured from the environment
+func NewKeyringService(db *gorm.DB, logger *zap.Logger) (*KeyringService, error) {
+	algorithm := getEnvOrDefault("JWT_SIGNING_ALG", utils.SigningAlgEdDSA)
+	if algorithm != utils.SigningAlgEdDSA && algorithm != utils.SigningAlgRS256 {
+		return nil, fmt.Errorf("unsupported JWT_SIGNING_ALG %q", algorithm)
+	}
+
+	rotationInterval, err := time.ParseDuration(getEnvOrDefault("JWT_KEY_ROTATION_INTERVAL", "720h"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid JWT_KEY_ROTATION_INTERVAL: %w", err)
+	}
+
+	// Legacy HS256 tokens are only accepted during an explicit migration window
+	var legacySecret string
+	var legacyUntil time.Time
+	if until := os.Getenv("JWT_LEGACY_HS256_UNTIL"); until != "" {
+		legacyUntil, err = time.Parse(time.RFC3339, until)
+		if err != nil {
+			return nil, fmt.Errorf("invalid JWT_LEGACY_HS256_UNTIL: %w", err)
+		}
+		legacySecret = os.Getenv("JWT_SECRET")
+	}
+
+	return &KeyringService{
+		db:               db,
+		logger:           logger,
+		keyring:          utils.NewKeyring(nil, legacySecret, legacyUntil),
+		algorithm:        algorithm,
+		rotationInterval: rotationInterval,
+		encryptionKey:    os.Getenv("JWT_KEY_ENCRYPTION_KEY"),
+	}, nil
+}
+
+// Keyring returns the in-memory keyring kept in sync by the service
+func (s *KeyringService) Keyring() *utils.Keyring {
+	return s.keyring
+}
+
+// Initialize loads the stored keys, creating the first signing key if none exists
+func (s *KeyringService) Initialize(ctx context.Context) error {
+	if err := s.Reload(ctx); err != nil {
+		return err
+	}
+
+	if _, err := s.keyring.SigningKey(); err == nil {
+		return nil
+	}
+
+	// First start: the key signs immediately since nothing has been issued yet
+	if _, err := s.createKey(s.db.WithContext(ctx), time.Now()); err != nil {
+		return err
+	}
+	return s.Reload(ctx)
+}
+
+// Start periodically reloads keys and rotates the signing key when it is due
+func (s *KeyringService) Start(ctx context.Context) {
+	ticker := time.NewTicker(keyringReloadInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := s.RotateIfDue(ctx); err != nil {
+				s.logger.Error("Failed to rotate JWT signing key", zap.Error(err))
+			}
+			if err := s.Reload(ctx); err != nil {
+				s.logger.Error("Failed to reload JWT signing keys", zap.Error(err))
+			}
+		}
+	}
+}
+
+// Reload replaces the in-memory keyring with the unexpired keys from the database
+func (s *KeyringService) Reload(ctx context.Context) error {
+	var records []models.SigningKey
+	err := s.db.WithContext(ctx).
+		Where("expires_at IS NULL OR expires_at > ?", time.Now()).
+		Find(&records).Error
+	if err != nil {
+		return fmt.Errorf("failed to load signing keys: %w", err)
+	}
+
+	keys := make([]*utils.SigningKey, 0, len(records))
+	for _, record := range records {
+		key, err := s.decode(record)
+		if err != nil {
+			s.logger.Error("Skipping unreadable JWT signing key", zap.String("kid", record.KID), zap.Error(err))
+			continue
+		}
+		keys = append(keys, key)
+	}
+
+	s.keyring.SetKeys(keys)
+	return nil
+}
+
+// RotateIfDue publishes a new signing key once the newest key is older than the rotation interval
+func (s *KeyringService) RotateIfDue(ctx context.Context) error {
+	return s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		// Lock the newest key so concurrent instances don't both rotate
+		var newest models.SigningKey
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Order("activates_at DESC").
+			First(&newest).Error
+		if err != nil {
+			return fmt.Errorf("failed to load newest signing key: %w", err)
+		}
+
+		if time.Since(newest.ActivatesAt) < s.rotationInterval {
+			return nil
+		}
+
+		return s.rotate(tx)
+	})
+}
+
+// Rotate publishes a new signing key immediately, regardless of schedule
+func (s *KeyringService) Rotate(ctx context.Context) error {
+	err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		return s.rotate(tx)
+	})
+	if err != nil {
+		return err
+	}
+	return s.Reload(ctx)
+}
+
+// rotate creates the next key and schedules expiry of the current ones once every
+// token they could have signed has expired
+func (s *KeyringService) rotate(tx *gorm.DB) error {
+	activatesAt := time.Now().Add(keyPublishDelay)
+	key, err := s.createKey(tx, activatesAt)
+	if err != nil {
+		return err
+	}
+
+	expiresAt := activatesAt.Add(utils.RefreshTokenTTL)
+	if err := tx.Model(&models.SigningKey{}).
+		Where("kid <> ? AND expires_at IS NULL", key.KID).
+		Update("expires_at", expiresAt).Error; err != nil {
+		return fmt.Errorf("failed to schedule signing key expiry: %w", err)
+	}
+
+	s.logger.Info("Rotated JWT signing key",
+		zap.String("kid", key.KID),
+		zap.String("algorithm", key.Algorithm),
+		zap.Time("activates_at", activatesAt),
+	)
+	return nil
+}
+
+func (s *KeyringService) createKey(tx *gorm.DB, activatesAt time.Time) (*models.SigningKey, error) {
+	key, err := utils.GenerateSigningKey(s.algorithm)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate signing key: %w", err)
+	}
+
+	privatePEM, err := utils.MarshalPrivateKeyPEM(key.PrivateKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode signing key: %w", err)
+	}
+
+	record := &models.SigningKey{
+		KID:         key.ID,
+		Algorithm:   key.Algorithm,
+		PrivateKey:  privatePEM,
+		ActivatesAt: activatesAt,
+	}
+	if s.encryptionKey != "" {
+		encrypted, err := utils.EncryptString(privatePEM, s.encryptionKey)
+		if err != nil {
+			return nil, fmt.Errorf("failed to encrypt signing key: %w", err)
+		}
+		record.PrivateKey = encrypted
+		record.Encrypted = true
+	}
+
+	if err := tx.Create(record).Error; err != nil {
+		return nil, fmt.Errorf("failed to store signing key: %w", err)
+	}
+	return record, nil
+}
+
+func (s *KeyringService) decode(record models.SigningKey) (*utils.SigningKey, error) {
+	privatePEM := record.PrivateKey
+	if record.Encrypted {
+		if s.encryptionKey == "" {
+			return nil, fmt.Errorf("key is encrypted but JWT_KEY_ENCRYPTION_KEY is not set")
+		}
+		decrypted, err := utils.DecryptString(privatePEM, s.encryptionKey)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decrypt: %w", err)
+		}
+		privatePEM = decrypted
+	}
+
+	private, err := utils.ParsePrivateKeyPEM(privatePEM)
+	if err != nil {
+		return nil, err
+	}
+
+	key := &utils.SigningKey{
+		ID:          record.KID,
+		Algorithm:   record.Algorithm,
+		PrivateKey:  private,
+		PublicKey:   private.Public(),
+		ActivatesAt: record.ActivatesAt,
+	}
+	if record.ExpiresAt != nil {
+		key.ExpiresAt = *record.ExpiresAt
+	}
+	return key, nil
+}
@@ -0,0 +1,258 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"strings"
+	"time"
+
+	"mobile-backend/config"
+	"mobile-backend/models"
+	"mobile-backend/utils"
+
+	"github.com/go-redis/redis/v8"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+var (
+	ErrAccountLocked        = errors.New("account temporarily locked")
+	ErrTooManyLoginAttempts = errors.New("too many login attempts")
+)
+
+// LoginRetryError is returned when a login attempt is refused before the password is
+// checked. It wraps ErrAccountLocked or ErrTooManyLoginAttempts.
+type LoginRetryError struct {
+	Err        error
+	RetryAfter time.Duration
+}
+
+func (e *LoginRetryError) Error() string {
+	return fmt.Sprintf("%v, retry after %s", e.Err, e.RetryAfter.Round(time.Second))
+}
+
+func (e *LoginRetryError) Unwrap() error {
+	return e.Err
+}
+
+// LoginLockoutService tracks failed logins per account and per client IP in Redis.
+// Repeated account failures first slow down further attempts, then lock the account for
+// progressively longer periods; an IP that fails too often is blocked. Wrong codes for
+// a two-factor login challenge are also counted per challenge, which is revoked once it
+// runs out of attempts.
+type LoginLockoutService struct {
+	db     *gorm.DB
+	redis  *redis.Client
+	logger *config.Logger
+
+	delayAfter     int64         // account failures before attempts are delayed
+	lockAfter      int64         // account failures that lock the account
+	ipLimit        int64         // failures per IP within the window before it is blocked
+	challengeLimit int64         // wrong codes a single MFA challenge accepts
+	window         time.Duration // how long failures are remembered
+	lockoutBase    time.Duration // first lockout; each further lockout doubles it
+	lockoutMax     time.Duration
+	lockoutHistory time.Duration // how long past lockouts count towards the next one
+}
+
+// NewLoginLockoutService creates a new lockout service configured from the environment
+func NewLoginLockoutService(db *gorm.DB, redis *redis.Client, logger *config.Logger) (*LoginLockoutService, error) {
+	window, err := time.ParseDuration(getEnvOrDefault("LOGIN_FAILURE_WINDOW", "15m"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid LOGIN_FAILURE_WINDOW: %w", err)
+	}
+	lockoutBase, err := time.ParseDuration(getEnvOrDefault("LOGIN_LOCKOUT_DURATION", "15m"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid LOGIN_LOCKOUT_DURATION: %w", err)
+	}
+	lockoutMax, err := time.ParseDuration(getEnvOrDefault("LOGIN_LOCKOUT_MAX_DURATION", "24h"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid LOGIN_LOCKOUT_MAX_DURATION: %w", err)
+	}
+
+	return &LoginLockoutService{
+		db:             db,
+		redis:          redis,
+		logger:         logger,
+		delayAfter:     int64(utils.ParseInt(os.Getenv("LOGIN_DELAY_AFTER_FAILURES"), 3)),
+		lockAfter:      int64(utils.ParseInt(os.Getenv("LOGIN_LOCK_AFTER_FAILURES"), 10)),
+		ipLimit:        int64(utils.ParseInt(os.Getenv("LOGIN_IP_FAILURE_LIMIT"), 50)),
+		challengeLimit: int64(utils.ParseInt(os.Getenv("MFA_CHALLENGE_MAX_FAILURES"), 5)),
+		window:         window,
+		lockoutBase:    lockoutBase,
+		lockoutMax:     lockoutMax,
+		lockoutHistory: 24 * time.Hour,
+	}, nil
+}
+
+// Check refuses an attempt while the account or IP is locked out or inside its
+// progressive delay. Unknown emails are throttled the same way so responses don't
+// reveal which accounts exist.
+func (s *LoginLockoutService) Check(ctx context.Context, email, clientIP string) error {
+	account := loginAccountKey(email)
+
+	pipe := s.redis.Pipeline()
+	lockTTL := pipe.PTTL(ctx, "login:locked:"+account)
+	nextAttempt := pipe.Get(ctx, "login:next_attempt:"+account)
+	ipFailures := pipe.Get(ctx, "login:failures:ip:"+clientIP)
+	ipTTL := pipe.PTTL(ctx, "login:failures:ip:"+clientIP)
+	if _, err := pipe.Exec(ctx); err != nil && !errors.Is(err, redis.Nil) {
+		return fmt.Errorf("failed to check login attempts: %w", err)
+	}
+
+	if ttl := lockTTL.Val(); ttl > 0 {
+		return &LoginRetryError{Err: ErrAccountLocked, RetryAfter: ttl}
+	}
+	if failures, _ := ipFailures.Int64(); failures >= s.ipLimit {
+		return &LoginRetryError{Err: ErrTooManyLoginAttempts, RetryAfter: ipTTL.Val()}
+	}
+	if next, err := nextAttempt.Int64(); err == nil {
+		if wait := time.Until(time.UnixMilli(next)); wait > 0 {
+			return &LoginRetryError{Err: ErrTooManyLoginAttempts, RetryAfter: wait}
+		}
+	}
+	return nil
+}
+
+// RecordFailure counts a failed attempt. user is nil when no account has the email.
+func (s *LoginLockoutService) RecordFailure(ctx context.Context, user *models.User, email, clientIP string) error {
+	account := loginAccountKey(email)
+	accountKey := "login:failures:account:" + account
+	ipKey := "login:failures:ip:" + clientIP
+
+	pipe := s.redis.TxPipeline()
+	accountFailures := pipe.Incr(ctx, accountKey)
+	pipe.Expire(ctx, accountKey, s.window)
+	ipFailures := pipe.Incr(ctx, ipKey)
+	pipe.Expire(ctx, ipKey, s.window)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return fmt.Errorf("failed to record login failure: %w", err)
+	}
+
+	failures := accountFailures.Val()
+	fields := []zap.Field{zap.String("ip", clientIP), zap.Int64("failures", failures)}
+	if user != nil {
+		fields = append(fields, zap.Uint("user_id", user.ID))
+	}
+	s.logger.LogSecurityEvent(ctx, "login_failed", "low", fields...)
+
+	if ipFailures.Val() == s.ipLimit {
+		s.logger.LogSecurityEvent(ctx, "login_ip_blocked", "high", zap.String("ip", clientIP), zap.Int64("failures", ipFailures.Val()))
+	}
+
+	switch {
+	case failures >= s.lockAfter:
+		return s.lock(ctx, user, account, fields)
+	case failures >= s.delayAfter:
+		delay := s.progressiveDelay(failures)
+		return s.redis.Set(ctx, "login:next_attempt:"+account, time.Now().Add(delay).UnixMilli(), delay).Err()
+	}
+	return nil
+}
+
+// RecordSuccess clears the account's failure count after a successful login
+func (s *LoginLockoutService) RecordSuccess(ctx context.Context, email string) error {
+	account := loginAccountKey(email)
+	return s.redis.Del(ctx, "login:failures:account:"+account, "login:next_attempt:"+account).Err()
+}
+
+// RecordChallengeFailure counts a wrong code entered for the MFA challenge challengeID
+// until the challenge expires. It reports whether the challenge has used up its
+// attempts and must be revoked.
+func (s *LoginLockoutService) RecordChallengeFailure(ctx context.Context, challengeID string, expiresAt time.Time) (bool, error) {
+	key := "login:failures:challenge:" + challengeID
+
+	pipe := s.redis.TxPipeline()
+	failures := pipe.Incr(ctx, key)
+	pipe.Expire(ctx, key, time.Until(expiresAt))
+	if _, err := pipe.Exec(ctx); err != nil {
+		return false, fmt.Errorf("failed to record mfa challenge failure: %w", err)
+	}
+	return failures.Val() >= s.challengeLimit, nil
+}
+
+// Unlock lifts a lockout early and forgets the account's failures and past lockouts
+func (s *LoginLockoutService) Unlock(ctx context.Context, userID, unlockedBy uint) error {
+	var user models.User
+	if err := s.db.WithContext(ctx).First(&user, userID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrUserNotFound
+		}
+		return fmt.Errorf("failed to load user: %w", err)
+	}
+
+	if err := s.db.WithContext(ctx).Model(&user).Update("locked_until", nil).Error; err != nil {
+		return fmt.Errorf("failed to unlock user: %w", err)
+	}
+
+	account := loginAccountKey(user.Email)
+	if err := s.redis.Del(ctx,
+		"login:locked:"+account,
+		"login:lockouts:"+account,
+		"login:failures:account:"+account,
+		"login:next_attempt:"+account,
+	).Err(); err != nil {
+		return fmt.Errorf("failed to clear login failures: %w", err)
+	}
+
+	s.logger.LogSecurityEvent(ctx, "account_unlocked", "medium",
+		zap.Uint("user_id", userID),
+		zap.Uint("unlocked_by", unlockedBy),
+	)
+	return nil
+}
+
+// lock locks the account for the base duration, doubled for every lockout within the
+// lockout history and capped at the maximum
+func (s *LoginLockoutService) lock(ctx context.Context, user *models.User, account string, fields []zap.Field) error {
+	lockouts, err := s.redis.Incr(ctx, "login:lockouts:"+account).Result()
+	if err != nil {
+		return fmt.Errorf("failed to record lockout: %w", err)
+	}
+	s.redis.Expire(ctx, "login:lockouts:"+account, s.lockoutHistory)
+
+	duration := time.Duration(float64(s.lockoutBase) * math.Pow(2, float64(lockouts-1)))
+	if duration > s.lockoutMax || duration <= 0 {
+		duration = s.lockoutMax
+	}
+	lockedUntil := time.Now().Add(duration)
+
+	pipe := s.redis.TxPipeline()
+	pipe.Set(ctx, "login:locked:"+account, lockedUntil.Unix(), duration)
+	pipe.Del(ctx, "login:failures:account:"+account, "login:next_attempt:"+account)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return fmt.Errorf("failed to lock account: %w", err)
+	}
+
+	// The database copy survives a Redis flush and shows up for admins
+	if user != nil {
+		if err := s.db.WithContext(ctx).Model(user).Update("locked_until", lockedUntil).Error; err != nil {
+			return fmt.Errorf("failed to lock account: %w", err)
+		}
+	}
+
+	s.logger.LogSecurityEvent(ctx, "account_locked", "high",
+		append(fields, zap.Duration("duration", duration), zap.Int64("lockouts", lockouts))...)
+	return nil
+}
+
+// progressiveDelay doubles the wait with every failure past the delay threshold, from
+// one second up to a minute
+func (s *LoginLockoutService) progressiveDelay(failures int64) time.Duration {
+	exponent := failures - s.delayAfter
+	if exponent > 6 {
+		exponent = 6
+	}
+	delay := time.Second << exponent
+	if delay > time.Minute {
+		delay = time.Minute
+	}
+	return delay
+}
+
+func loginAccountKey(email string) string {
+	return utils.HashToken(strings.ToLower(strings.TrimSpace(email)))
+}
@@ -0,0 +1,368 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"mobile-backend/config"
+	"mobile-backend/models"
+	"mobile-backend/utils"
+
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+const (
+	// mfaRecoveryCodeCount is the number of recovery codes issued per enrollment
+	mfaRecoveryCodeCount = 10
+	// mfaClockSkew is the number of TOTP steps accepted either side of the current one
+	mfaClockSkew = 1
+)
+
+var (
+	ErrMFARequired       = errors.New("mfa required")
+	ErrMFANotEnabled     = errors.New("mfa not enabled")
+	ErrMFAAlreadyEnabled = errors.New("mfa already enabled")
+	ErrMFANotEnrolled    = errors.New("mfa enrollment not started")
+	ErrInvalidMFACode    = errors.New("invalid mfa code")
+	ErrInvalidMFAToken   = errors.New("invalid or expired mfa token")
+)
+
+// MFAEnrollment is returned when a user starts TOTP enrollment
+type MFAEnrollment struct {
+	Secret          string `json:"secret"`
+	ProvisioningURI string `json:"otpauth_uri"`
+}
+
+// MFAStatus describes a user's two-factor configuration
+type MFAStatus struct {
+	Enabled                bool       `json:"enabled"`
+	EnabledAt              *time.Time `json:"enabled_at,omitempty"`
+	RecoveryCodesRemaining int64      `json:"recovery_codes_remaining"`
+}
+
+// MFAService manages TOTP enrollment, verification and recovery codes
+type MFAService struct {
+	db      *gorm.DB
+	lockout *LoginLockoutService
+	logger  *config.Logger
+	issuer  string
+}
+
+// NewMFAService creates a new MFA service
+func NewMFAService(db *gorm.DB, logger *config.Logger) *MFAService {
+	issuer := os.Getenv("MFA_ISSUER")
+	if issuer == "" {
+		issuer = "Mobile Backend"
+	}
+
+	return &MFAService{
+		db:     db,
+		logger: logger,
+		issuer: issuer,
+	}
+}
+
+// SetLoginLockout counts wrong codes as failed logins of the account in lockout, and
+// refuses codes while the account is locked out; nil stops tracking them
+func (s *MFAService) SetLoginLockout(lockout *LoginLockoutService) {
+	s.lockout = lockout
+}
+
+// IsEnabled checks whether the user has completed TOTP enrollment
+func (s *MFAService) IsEnabled(ctx context.Context, userID uint) (bool, error) {
+	var count int64
+	err := s.db.WithContext(ctx).Model(&models.UserMFA{}).
+		Where("user_id = ? AND enabled = ?", userID, true).
+		Count(&count).Error
+	if err != nil {
+		return false, fmt.Errorf("failed to check mfa status: %w", err)
+	}
+	return count > 0, nil
+}
+
+// GetStatus returns the user's two-factor configuration
+func (s *MFAService) GetStatus(ctx context.Context, userID uint) (*MFAStatus, error) {
+	status := &MFAStatus{}
+
+	mfa, err := s.getEnrollment(ctx, userID)
+	if err != nil && !errors.Is(err, ErrMFANotEnrolled) {
+		return nil, err
+	}
+	if mfa == nil || !mfa.Enabled {
+		return status, nil
+	}
+
+	status.Enabled = true
+	status.EnabledAt = mfa.EnabledAt
+	if err := s.db.WithContext(ctx).Model(&models.MFARecoveryCode{}).
+		Where("user_id = ? AND used_at IS NULL", userID).
+		Count(&status.RecoveryCodesRemaining).Error; err != nil {
+		return nil, fmt.Errorf("failed to count recovery codes: %w", err)
+	}
+
+	return status, nil
+}
+
+// BeginEnrollment generates a new TOTP secret for the user. The secret is inactive
+// until ConfirmEnrollment succeeds; starting again replaces any pending secret.
+func (s *MFAService) BeginEnrollment(ctx context.Context, user *models.User) (*MFAEnrollment, error) {
+	existing, err := s.getEnrollment(ctx, user.ID)
+	if err != nil && !errors.Is(err, ErrMFANotEnrolled) {
+		return nil, err
+	}
+	if existing != nil && existing.Enabled {
+		return nil, ErrMFAAlreadyEnabled
+	}
+
+	secret, err := utils.GenerateTOTPSecret()
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate mfa secret: %w", err)
+	}
+
+	if existing != nil {
+		err = s.db.WithContext(ctx).Model(existing).Updates(map[string]interface{}{
+			"secret":         secret,
+			"last_used_step": 0,
+		}).Error
+	} else {
+		err = s.db.WithContext(ctx).Create(&models.UserMFA{
+			UserID: user.ID,
+			Secret: secret,
+		}).Error
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to save mfa enrollment: %w", err)
+	}
+
+	return &MFAEnrollment{
+		Secret:          secret,
+		ProvisioningURI: utils.TOTPProvisioningURI(s.issuer, user.Email, secret),
+	}, nil
+}
+
+// ConfirmEnrollment activates the pending secret once the user proves their app
+// produces valid codes, and returns a fresh set of recovery codes
+func (s *MFAService) ConfirmEnrollment(ctx context.Context, userID uint, code string) ([]string, error) {
+	mfa, err := s.getEnrollment(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if mfa.Enabled {
+		return nil, ErrMFAAlreadyEnabled
+	}
+
+	step, ok := utils.ValidateTOTPCode(mfa.Secret, code, time.Now(), mfaClockSkew)
+	if !ok {
+		return nil, ErrInvalidMFACode
+	}
+
+	var codes []string
+	err = s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		now := time.Now()
+		if err := tx.Model(mfa).Updates(map[string]interface{}{
+			"enabled":        true,
+			"enabled_at":     now,
+			"last_used_step": step,
+		}).Error; err != nil {
+			return fmt.Errorf("failed to enable mfa: %w", err)
+		}
+
+		codes, err = s.replaceRecoveryCodes(tx, userID)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	s.logger.LogSecurityEvent(ctx, "mfa_enabled", "low", zap.Uint("user_id", userID))
+	return codes, nil
+}
+
+// Verify checks a TOTP code or an unused recovery code for a user with MFA enabled.
+// Each TOTP code and recovery code is accepted at most once.
+func (s *MFAService) Verify(ctx context.Context, userID uint, code string) error {
+	mfa, err := s.getEnrollment(ctx, userID)
+	if err != nil {
+		if errors.Is(err, ErrMFANotEnrolled) {
+			return ErrMFANotEnabled
+		}
+		return err
+	}
+	if !mfa.Enabled {
+		return ErrMFANotEnabled
+	}
+
+	if step, ok := utils.ValidateTOTPCode(mfa.Secret, code, time.Now(), mfaClockSkew); ok {
+		// Only advance forward so a code can't be replayed within its validity window
+		result := s.db.WithContext(ctx).Model(&models.UserMFA{}).
+			Where("id = ? AND last_used_step < ?", mfa.ID, step).
+			Update("last_used_step", step)
+		if result.Error != nil {
+			return fmt.Errorf("failed to record mfa code: %w", result.Error)
+		}
+		if result.RowsAffected == 0 {
+			return ErrInvalidMFACode
+		}
+		return nil
+	}
+
+	if err := s.useRecoveryCode(ctx, userID, code); err != nil {
+		return err
+	}
+
+	s.logger.LogSecurityEvent(ctx, "mfa_recovery_code_used", "medium", zap.Uint("user_id", userID))
+	return nil
+}
+
+// VerifyAttempt checks a code like Verify for a user entering it from clientIP. While
+// the account is locked out or throttled the code is refused with a *LoginRetryError,
+// and a wrong code counts as a failed login.
+func (s *MFAService) VerifyAttempt(ctx context.Context, user *models.User, code, clientIP string) error {
+	if s.lockout == nil {
+		return s.Verify(ctx, user.ID, code)
+	}
+
+	if user.IsLocked() {
+		return &LoginRetryError{Err: ErrAccountLocked, RetryAfter: time.Until(*user.LockedUntil)}
+	}
+	if err := s.lockout.Check(ctx, user.Email, clientIP); err != nil {
+		return err
+	}
+
+	err := s.Verify(ctx, user.ID, code)
+	switch {
+	case errors.Is(err, ErrInvalidMFACode):
+		if recordErr := s.lockout.RecordFailure(ctx, user, user.Email, clientIP); recordErr != nil {
+			s.logger.WarnWithContext(ctx, "Failed to record login failure", zap.Uint("user_id", user.ID), zap.Error(recordErr))
+		}
+	case err == nil:
+		if recordErr := s.lockout.RecordSuccess(ctx, user.Email); recordErr != nil {
+			s.logger.WarnWithContext(ctx, "Failed to reset login failures", zap.Uint("user_id", user.ID), zap.Error(recordErr))
+		}
+	}
+	return err
+}
+
+// verifyUserAttempt is VerifyAttempt for a signed-in user known by ID
+func (s *MFAService) verifyUserAttempt(ctx context.Context, userID uint, code, clientIP string) error {
+	var user models.User
+	if err := s.db.WithContext(ctx).First(&user, userID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrUserNotFound
+		}
+		return fmt.Errorf("failed to load user: %w", err)
+	}
+	return s.VerifyAttempt(ctx, &user, code, clientIP)
+}
+
+// Disable removes the user's TOTP enrollment and recovery codes after verifying a code
+// entered from clientIP
+func (s *MFAService) Disable(ctx context.Context, userID uint, code, clientIP string) error {
+	if err := s.verifyUserAttempt(ctx, userID, code, clientIP); err != nil {
+		return err
+	}
+
+	err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Unscoped().Where("user_id = ?", userID).Delete(&models.MFARecoveryCode{}).Error; err != nil {
+			return fmt.Errorf("failed to delete recovery codes: %w", err)
+		}
+		if err := tx.Unscoped().Where("user_id = ?", userID).Delete(&models.UserMFA{}).Error; err != nil {
+			return fmt.Errorf("failed to delete mfa enrollment: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	s.logger.LogSecurityEvent(ctx, "mfa_disabled", "medium", zap.Uint("user_id", userID))
+	return nil
+}
+
+// RegenerateRecoveryCodes invalidates the existing recovery codes and issues new ones
+// after verifying a code entered from clientIP
+func (s *MFAService) RegenerateRecoveryCodes(ctx context.Context, userID uint, code, clientIP string) ([]string, error) {
+	if err := s.verifyUserAttempt(ctx, userID, code, clientIP); err != nil {
+		return nil, err
+	}
+
+	var codes []string
+	err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var err error
+		codes, err = s.replaceRecoveryCodes(tx, userID)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	s.logger.LogSecurityEvent(ctx, "mfa_recovery_codes_regenerated", "low", zap.Uint("user_id", userID))
+	return codes, nil
+}
+
+func (s *MFAService) getEnrollment(ctx context.Context, userID uint) (*models.UserMFA, error) {
+	var mfa models.UserMFA
+	if err := s.db.WithContext(ctx).Where("user_id = ?", userID).First(&mfa).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrMFANotEnrolled
+		}
+		return nil, fmt.Errorf("failed to load mfa enrollment: %w", err)
+	}
+	return &mfa, nil
+}
+
+func (s *MFAService) replaceRecoveryCodes(tx *gorm.DB, userID uint) ([]string, error) {
+	if err := tx.Unscoped().Where("user_id = ?", userID).Delete(&models.MFARecoveryCode{}).Error; err != nil {
+		return nil, fmt.Errorf("failed to delete recovery codes: %w", err)
+	}
+
+	codes := make([]string, 0, mfaRecoveryCodeCount)
+	records := make([]models.MFARecoveryCode, 0, mfaRecoveryCodeCount)
+	for i := 0; i < mfaRecoveryCodeCount; i++ {
+		raw, err := utils.GenerateRandomString(5)
+		if err != nil {
+			return nil, fmt.Errorf("failed to generate recovery code: %w", err)
+		}
+		code := raw[:5] + "-" + raw[5:]
+		codes = append(codes, code)
+		records = append(records, models.MFARecoveryCode{
+			UserID:   userID,
+			CodeHash: utils.HashToken(normalizeRecoveryCode(code)),
+		})
+	}
+
+	if err := tx.Create(&records).Error; err != nil {
+		return nil, fmt.Errorf("failed to store recovery codes: %w", err)
+	}
+	return codes, nil
+}
+
+func (s *MFAService) useRecoveryCode(ctx context.Context, userID uint, code string) error {
+	normalized := normalizeRecoveryCode(code)
+	if normalized == "" {
+		return ErrInvalidMFACode
+	}
+
+	result := s.db.WithContext(ctx).Model(&models.MFARecoveryCode{}).
+		Where("user_id = ? AND code_hash = ? AND used_at IS NULL", userID, utils.HashToken(normalized)).
+		Update("used_at", time.Now())
+	if result.Error != nil {
+		return fmt.Errorf("failed to use recovery code: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return ErrInvalidMFACode
+	}
+	return nil
+}
+
+// normalizeRecoveryCode makes recovery codes tolerant of case, spaces and dashes
+func normalizeRecoveryCode(code string) string {
+	code = strings.ToLower(code)
+	code = strings.ReplaceAll(code, "-", "")
+	return strings.ReplaceAll(code, " ", "")
+}
@@ -2,215 +2,729 @@ package services
 
 import (
 	"context"
+	"crypto/ecdsa"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
-	"os"
+	"net/url"
+	"strings"
+	"sync"
 	"time"
 
 	"mobile-backend/models"
 	"mobile-backend/utils"
 
 	"github.com/go-redis/redis/v8"
+	"github.com/golang-jwt/jwt/v5"
 	"gorm.io/gorm"
 )
 
 type OAuth2Provider string
 
 const (
-	GoogleProvider OAuth2Provider = "google"
-	GitHubProvider OAuth2Provider = "github"
+	GoogleProvider    OAuth2Provider = "google"
+	GitHubProvider    OAuth2Provider = "github"
+	AppleProvider     OAuth2Provider = "apple"
+	MicrosoftProvider OAuth2Provider = "microsoft"
+)
+
+// oauthStateTTL is how long a login started at a provider may take to complete
+const oauthStateTTL = 10 * time.Minute
+
+var (
+	ErrUnsupportedOAuth2Provider = errors.New("unsupported OAuth2 provider")
+	ErrInvalidOAuthState         = errors.New("invalid or expired state")
+	ErrOAuthEmailRequired        = errors.New("provider did not return an email address")
+	ErrOAuthAccountExists        = errors.New("an account with this email already exists")
+	ErrIdentityAlreadyLinked     = errors.New("identity is linked to another account")
+	ErrIdentityNotFound          = errors.New("identity not found")
+	ErrIDTokenExchangeNotAllowed = errors.New("provider does not issue id tokens")
 )
 
 type OAuth2Service struct {
-	db    *gorm.DB
-	redis *redis.Client
+	db         *gorm.DB
+	redis      *redis.Client
+	httpClient *http.Client
+	oidc       *OIDCClient
+
+	mu        sync.RWMutex
+	providers map[string]*OAuth2Config
 }
 
 func NewOAuth2Service(db *gorm.DB, redis *redis.Client) *OAuth2Service {
-	return &OAuth2Service{db: db, redis: redis}
+	httpClient := &http.Client{Timeout: 30 * time.Second}
+	return &OAuth2Service{
+		db:         db,
+		redis:      redis,
+		httpClient: httpClient,
+		oidc:       NewOIDCClient(httpClient),
+		providers:  make(map[string]*OAuth2Config),
+	}
 }
 
+// OAuth2User is the identity asserted by a provider
 type OAuth2User struct {
-	ID       string `json:"id"`
-	Email    string `json:"email"`
-	Name     string `json:"name"`
-	Picture  string `json:"picture"`
-	Provider string `json:"provider"`
+	ID            string `json:"id"` // the provider's stable subject identifier
+	Email         string `json:"email"`
+	EmailVerified bool   `json:"email_verified"`
+	Name          string `json:"name"`
+	Picture       string `json:"picture"`
+	Provider      string `json:"provider"`
 }
 
+// OAuth2Config describes a registered identity provider
 type OAuth2Config struct {
+	Name         string
+	DisplayName  string
+	Type         string // one of the models.OAuthProviderType* values
 	ClientID     string
 	ClientSecret string
 	RedirectURL  string
+	IssuerURL    string // OIDC issuer; endpoints not set explicitly are discovered from it
 	AuthURL      string
 	TokenURL     string
 	UserInfoURL  string
+	Scopes       []string
+	// NativeClientIDs are accepted as id_token audiences in addition to ClientID, for
+	// tokens that native apps obtain from the platform SDK
+	NativeClientIDs []string
+
+	// Sign in with Apple uses a short-lived JWT signed with a team key as client secret
+	AppleTeamID     string
+	AppleKeyID      string
+	ApplePrivateKey string
+}
+
+// oauthState is stored server-side for the duration of a login started at a provider
+type oauthState struct {
+	Provider     OAuth2Provider `json:"provider"`
+	CodeVerifier string         `json:"code_verifier"`
+	Nonce        string         `json:"nonce,omitempty"`
+	LinkUserID   uint           `json:"link_user_id,omitempty"` // set when linking to a signed-in user
 }
 
-func (o *OAuth2Service) GetConfig(provider OAuth2Provider) (*OAuth2Config, error) {
-	switch provider {
-	case GoogleProvider:
-		return &OAuth2Config{
-			ClientID:     os.Getenv("GOOGLE_CLIENT_ID"),
-			ClientSecret: os.Getenv("GOOGLE_CLIENT_SECRET"),
-			RedirectURL:  os.Getenv("GOOGLE_REDIRECT_URL"),
-			AuthURL:      "https://accounts.google.com/o/oauth2/auth",
-			TokenURL:     "https://oauth2.googleapis.com/token",
-			UserInfoURL:  "https://www.googleapis.com/oauth2/v2/userinfo",
-		}, nil
-	case GitHubProvider:
-		return &OAuth2Config{
-			ClientID:     os.Getenv("GITHUB_CLIENT_ID"),
-			ClientSecret: os.Getenv("GITHUB_CLIENT_SECRET"),
-			RedirectURL:  os.Getenv("GITHUB_REDIRECT_URL"),
-			AuthURL:      "https://github.com/login/oauth/authorize",
-			TokenURL:     "https://github.com/login/oauth/access_token",
-			UserInfoURL:  "https://api.github.com/user",
-		}, nil
-	default:
-		return nil, fmt.Errorf("unsupported OAuth2 provider: %s", provider)
-	}
-}
-
-func (o *OAuth2Service) GetAuthURL(provider OAuth2Provider, state string) (string, error) {
-	config, err := o.GetConfig(provider)
+// OAuth2CallbackParams are the values a provider sends back to the callback URL
+type OAuth2CallbackParams struct {
+	Code  string
+	State string
+	// AppleUser is the JSON "user" form field Apple posts on the first login only
+	AppleUser string
+}
+
+// OAuth2CallbackResult is the outcome of a completed provider round trip
+type OAuth2CallbackResult struct {
+	User     *models.User
+	Identity *models.UserIdentity
+	Linked   bool // the identity was linked to a signed-in user rather than used to log in
+	Upgraded bool // the signed-in user was a guest, now converted to a full account
+}
+
+// BeginLogin starts an authorization code flow with PKCE. When linkUserID is set, the
+// resulting identity is linked to that user instead of logging in.
+func (o *OAuth2Service) BeginLogin(ctx context.Context, provider OAuth2Provider, linkUserID uint) (string, string, error) {
+	cfg, err := o.GetConfig(provider)
 	if err != nil {
-		return "", err
+		return "", "", err
+	}
+
+	state, err := utils.GenerateRandomString(16)
+	if err != nil {
+		return "", "", err
+	}
+	verifier, err := utils.GeneratePKCEVerifier()
+	if err != nil {
+		return "", "", err
 	}
+	stored := oauthState{Provider: provider, CodeVerifier: verifier, LinkUserID: linkUserID}
 
-	authURL := fmt.Sprintf("%s?client_id=%s&redirect_uri=%s&response_type=code&scope=email profile&state=%s",
-		config.AuthURL, config.ClientID, config.RedirectURL, state)
+	authURL, err := o.authEndpoint(ctx, cfg)
+	if err != nil {
+		return "", "", err
+	}
 
-	return authURL, nil
-}
+	params := url.Values{}
+	params.Set("client_id", cfg.ClientID)
+	params.Set("redirect_uri", cfg.RedirectURL)
+	params.Set("response_type", "code")
+	params.Set("scope", strings.Join(cfg.Scopes, " "))
+	params.Set("state", state)
+	params.Set("code_challenge", utils.PKCEChallengeS256(verifier))
+	params.Set("code_challenge_method", "S256")
+
+	if cfg.Type != models.OAuthProviderTypeOAuth2 {
+		if stored.Nonce, err = utils.GenerateRandomString(16); err != nil {
+			return "", "", err
+		}
+		params.Set("nonce", stored.Nonce)
+	}
+	// Apple requires form_post whenever name or email is requested
+	if cfg.Type == models.OAuthProviderTypeApple && len(cfg.Scopes) > 0 {
+		params.Set("response_mode", "form_post")
+	}
 
-func (o *OAuth2Service) ExchangeCodeForToken(provider OAuth2Provider, code string) (string, error) {
-	config, err := o.GetConfig(provider)
+	data, err := json.Marshal(stored)
 	if err != nil {
-		return "", err
+		return "", "", err
+	}
+	if err := o.redis.Set(ctx, "oauth_state:"+state, data, oauthStateTTL).Err(); err != nil {
+		return "", "", fmt.Errorf("failed to store OAuth state: %w", err)
 	}
 
-	// Exchange code for access token
-	// tokenReq := map[string]string{
-	// 	"client_id":     config.ClientID,
-	// 	"client_secret": config.ClientSecret,
-	// 	"code":          code,
-	// 	"redirect_uri":  config.RedirectURL,
-	// 	"grant_type":    "authorization_code",
-	// }
+	return authURL + "?" + params.Encode(), state, nil
+}
 
-	// This is a simplified implementation
-	// In production, you'd use a proper OAuth2 library
-	req, err := http.NewRequest("POST", config.TokenURL, nil)
+// HandleCallback completes a flow started by BeginLogin: it exchanges the code, validates
+// the provider's identity and resolves it to a user
+func (o *OAuth2Service) HandleCallback(ctx context.Context, params OAuth2CallbackParams) (*OAuth2CallbackResult, error) {
+	state, err := o.consumeState(ctx, params.State)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
 
-	req.Header.Set("Accept", "application/json")
-	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	cfg, err := o.GetConfig(state.Provider)
+	if err != nil {
+		return nil, err
+	}
 
-	client := &http.Client{Timeout: 30 * time.Second}
-	resp, err := client.Do(req)
+	oauthUser, err := o.fetchIdentity(ctx, cfg, params, state)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
-	defer resp.Body.Close()
 
-	var tokenResp struct {
-		AccessToken string `json:"access_token"`
-		TokenType   string `json:"token_type"`
-		ExpiresIn   int    `json:"expires_in"`
+	if state.LinkUserID != 0 {
+		var user models.User
+		if err := o.db.WithContext(ctx).First(&user, state.LinkUserID).Error; err != nil {
+			return nil, err
+		}
+		if user.IsGuest {
+			return o.upgradeGuest(ctx, &user, oauthUser)
+		}
+		identity, err := o.LinkIdentity(ctx, state.LinkUserID, oauthUser)
+		if err != nil {
+			return nil, err
+		}
+		return &OAuth2CallbackResult{User: &user, Identity: identity, Linked: true}, nil
 	}
 
-	if err := json.NewDecoder(resp.Body).Decode(&tokenResp); err != nil {
-		return "", err
+	user, identity, err := o.resolveUser(ctx, oauthUser)
+	if err != nil {
+		return nil, err
 	}
+	return &OAuth2CallbackResult{User: user, Identity: identity}, nil
+}
 
-	return tokenResp.AccessToken, nil
+// IDTokenExchangeParams carry an id_token a native app obtained from the provider's SDK
+type IDTokenExchangeParams struct {
+	IDToken string
+	// Nonce is the raw nonce the app passed to the SDK. Apple's SDK embeds its SHA-256
+	// hex digest instead, so either form is accepted.
+	Nonce string
+	// Name is the display name Apple only hands to the app, on the first sign in
+	Name string
 }
 
-func (o *OAuth2Service) GetUserInfo(provider OAuth2Provider, accessToken string) (*OAuth2User, error) {
-	config, err := o.GetConfig(provider)
+// ExchangeIDToken logs in with an id_token obtained by a native app instead of the
+// browser redirect flow. The token must be signed by the provider's published keys and
+// issued to the web client ID or one of the provider's native client IDs.
+func (o *OAuth2Service) ExchangeIDToken(ctx context.Context, provider OAuth2Provider, params IDTokenExchangeParams) (*OAuth2CallbackResult, error) {
+	oauthUser, err := o.verifyIDToken(ctx, provider, params)
 	if err != nil {
 		return nil, err
 	}
 
-	req, err := http.NewRequest("GET", config.UserInfoURL, nil)
+	user, identity, err := o.resolveUser(ctx, oauthUser)
 	if err != nil {
 		return nil, err
 	}
+	return &OAuth2CallbackResult{User: user, Identity: identity}, nil
+}
 
-	req.Header.Set("Authorization", "Bearer "+accessToken)
-	req.Header.Set("Accept", "application/json")
+// UpgradeGuestWithIDToken converts a guest into a full account using an id_token a native
+// app obtained from the provider's SDK, linking the identity to the guest's user
+func (o *OAuth2Service) UpgradeGuestWithIDToken(ctx context.Context, userID uint, provider OAuth2Provider, params IDTokenExchangeParams) (*OAuth2CallbackResult, error) {
+	var user models.User
+	if err := o.db.WithContext(ctx).First(&user, userID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrUserNotFound
+		}
+		return nil, err
+	}
+	if !user.IsGuest {
+		return nil, ErrNotGuestAccount
+	}
 
-	client := &http.Client{Timeout: 30 * time.Second}
-	resp, err := client.Do(req)
+	oauthUser, err := o.verifyIDToken(ctx, provider, params)
 	if err != nil {
 		return nil, err
 	}
-	defer resp.Body.Close()
+	return o.upgradeGuest(ctx, &user, oauthUser)
+}
 
-	var userInfo OAuth2User
-	if err := json.NewDecoder(resp.Body).Decode(&userInfo); err != nil {
+// verifyIDToken checks an id_token from a native app and returns the identity it asserts
+func (o *OAuth2Service) verifyIDToken(ctx context.Context, provider OAuth2Provider, params IDTokenExchangeParams) (*OAuth2User, error) {
+	cfg, err := o.GetConfig(provider)
+	if err != nil {
+		return nil, err
+	}
+	if cfg.Type == models.OAuthProviderTypeOAuth2 {
+		return nil, ErrIDTokenExchangeNotAllowed
+	}
+
+	audiences := append([]string{cfg.ClientID}, cfg.NativeClientIDs...)
+	claims, err := o.oidc.ValidateIDToken(ctx, cfg.IssuerURL, params.IDToken, "", audiences...)
+	if err != nil {
 		return nil, err
 	}
 
-	userInfo.Provider = string(provider)
-	return &userInfo, nil
+	// A token bound to a nonce is only accepted together with that nonce, so an
+	// intercepted token can't be replayed on its own
+	if claims.Nonce != "" || params.Nonce != "" {
+		if claims.Nonce != params.Nonce && claims.Nonce != utils.HashToken(params.Nonce) {
+			return nil, fmt.Errorf("%w: nonce mismatch", ErrInvalidIDToken)
+		}
+	}
+
+	oauthUser := &OAuth2User{
+		ID:            claims.Subject,
+		Email:         claims.Email,
+		EmailVerified: bool(claims.EmailVerified),
+		Name:          claims.Name,
+		Picture:       claims.Picture,
+		Provider:      cfg.Name,
+	}
+	if oauthUser.Name == "" {
+		oauthUser.Name = strings.TrimSpace(params.Name)
+	}
+	return oauthUser, nil
 }
 
+// CreateOrUpdateUser returns the user for a provider identity, creating the user if needed
 func (o *OAuth2Service) CreateOrUpdateUser(ctx context.Context, oauthUser *OAuth2User) (*models.User, error) {
+	user, _, err := o.resolveUser(ctx, oauthUser)
+	return user, err
+}
+
+// resolveUser finds the user linked to the identity. Unknown identities are linked to the
+// account with the same email only when the provider verified that email, so an
+// unverified address can't be used to take over an existing account.
+func (o *OAuth2Service) resolveUser(ctx context.Context, oauthUser *OAuth2User) (*models.User, *models.UserIdentity, error) {
 	var user models.User
+	var identity models.UserIdentity
+
+	err := o.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		now := time.Now()
+
+		err := tx.Where("provider = ? AND subject = ?", oauthUser.Provider, oauthUser.ID).First(&identity).Error
+		if err == nil {
+			if err := tx.First(&user, identity.UserID).Error; err != nil {
+				return err
+			}
+			updates := map[string]interface{}{"last_login_at": now}
+			if oauthUser.Email != "" {
+				updates["email"] = oauthUser.Email
+			}
+			return tx.Model(&identity).Updates(updates).Error
+		}
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			return err
+		}
 
-	// Try to find existing user by email
-	err := o.db.Where("email = ?", oauthUser.Email).First(&user).Error
-	if err != nil && err != gorm.ErrRecordNotFound {
+		if oauthUser.Email == "" {
+			return ErrOAuthEmailRequired
+		}
+
+		err = tx.Where("email = ?", oauthUser.Email).First(&user).Error
+		switch {
+		case err == nil:
+			if !oauthUser.EmailVerified {
+				return ErrOAuthAccountExists
+			}
+			// The provider vouches for the address, so the existing account's email is verified too
+			if user.EmailVerifiedAt == nil {
+				if err := tx.Model(&user).Update("email_verified_at", now).Error; err != nil {
+					return err
+				}
+			}
+		case errors.Is(err, gorm.ErrRecordNotFound):
+			user = models.User{
+				Email:    oauthUser.Email,
+				Name:     oauthUser.Name,
+				IsActive: true,
+			}
+			if oauthUser.EmailVerified {
+				user.EmailVerifiedAt = &now
+			}
+			// OAuth users get an unusable random password until they set one via reset
+			randomPassword, err := utils.GenerateRandomString(32)
+			if err != nil {
+				return err
+			}
+			if err := user.HashPassword(randomPassword); err != nil {
+				return err
+			}
+			if err := tx.Create(&user).Error; err != nil {
+				return err
+			}
+		default:
+			return err
+		}
+
+		identity = models.UserIdentity{
+			UserID:      user.ID,
+			Provider:    oauthUser.Provider,
+			Subject:     oauthUser.ID,
+			Email:       oauthUser.Email,
+			LastLoginAt: &now,
+		}
+		return tx.Create(&identity).Error
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return &user, &identity, nil
+}
+
+// upgradeGuest converts the guest into a full account with the provider identity's email
+// and links the identity to it. The user keeps their ID, so everything they created as a
+// guest stays with the account.
+func (o *OAuth2Service) upgradeGuest(ctx context.Context, user *models.User, oauthUser *OAuth2User) (*OAuth2CallbackResult, error) {
+	if oauthUser.Email == "" {
+		return nil, ErrOAuthEmailRequired
+	}
+
+	var identity models.UserIdentity
+	err := o.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var linked int64
+		if err := tx.Model(&models.UserIdentity{}).Where("provider = ? AND subject = ?", oauthUser.Provider, oauthUser.ID).
+			Count(&linked).Error; err != nil {
+			return err
+		}
+		if linked > 0 {
+			return ErrIdentityAlreadyLinked
+		}
+
+		var taken int64
+		if err := tx.Model(&models.User{}).Where("LOWER(email) = LOWER(?) AND id <> ?", oauthUser.Email, user.ID).
+			Count(&taken).Error; err != nil {
+			return err
+		}
+		if taken > 0 {
+			return ErrOAuthAccountExists
+		}
+
+		now := time.Now()
+		var verifiedAt *time.Time
+		if oauthUser.EmailVerified {
+			verifiedAt = &now
+		}
+		if err := tx.Model(user).Updates(guestUpgradeUpdates(oauthUser.Email, oauthUser.Name, verifiedAt)).Error; err != nil {
+			return fmt.Errorf("failed to upgrade guest: %w", err)
+		}
+
+		identity = models.UserIdentity{
+			UserID:      user.ID,
+			Provider:    oauthUser.Provider,
+			Subject:     oauthUser.ID,
+			Email:       oauthUser.Email,
+			LastLoginAt: &now,
+		}
+		return tx.Create(&identity).Error
+	})
+	if err != nil {
 		return nil, err
 	}
 
-	if err == gorm.ErrRecordNotFound {
-		// Create new user
-		user = models.User{
-			Email:    oauthUser.Email,
-			Name:     oauthUser.Name,
-			IsActive: true,
+	if err := o.db.WithContext(ctx).First(user, user.ID).Error; err != nil {
+		return nil, err
+	}
+	return &OAuth2CallbackResult{User: user, Identity: &identity, Linked: true, Upgraded: true}, nil
+}
+
+// LinkIdentity attaches a provider identity to a signed-in user
+func (o *OAuth2Service) LinkIdentity(ctx context.Context, userID uint, oauthUser *OAuth2User) (*models.UserIdentity, error) {
+	var identity models.UserIdentity
+	err := o.db.WithContext(ctx).Where("provider = ? AND subject = ?", oauthUser.Provider, oauthUser.ID).First(&identity).Error
+	if err == nil {
+		if identity.UserID != userID {
+			return nil, ErrIdentityAlreadyLinked
 		}
-		// Generate a random password for OAuth users
-		randomPassword, _ := utils.GenerateRandomString(32)
-		if err := user.HashPassword(randomPassword); err != nil {
+		return &identity, nil
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, err
+	}
+
+	identity = models.UserIdentity{
+		UserID:   userID,
+		Provider: oauthUser.Provider,
+		Subject:  oauthUser.ID,
+		Email:    oauthUser.Email,
+	}
+	if err := o.db.WithContext(ctx).Create(&identity).Error; err != nil {
+		return nil, fmt.Errorf("failed to link identity: %w", err)
+	}
+	return &identity, nil
+}
+
+// ListIdentities returns the provider identities linked to the user
+func (o *OAuth2Service) ListIdentities(ctx context.Context, userID uint) ([]models.UserIdentity, error) {
+	var identities []models.UserIdentity
+	if err := o.db.WithContext(ctx).Where("user_id = ?", userID).Order("created_at").Find(&identities).Error; err != nil {
+		return nil, fmt.Errorf("failed to list identities: %w", err)
+	}
+	return identities, nil
+}
+
+// UnlinkIdentity removes one of the user's provider identities
+func (o *OAuth2Service) UnlinkIdentity(ctx context.Context, userID, identityID uint) error {
+	// Hard delete so the same identity can be linked again later
+	result := o.db.WithContext(ctx).Unscoped().Where("id = ? AND user_id = ?", identityID, userID).Delete(&models.UserIdentity{})
+	if result.Error != nil {
+		return fmt.Errorf("failed to unlink identity: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return ErrIdentityNotFound
+	}
+	return nil
+}
+
+// consumeState loads and deletes the stored state so it can only be used once
+func (o *OAuth2Service) consumeState(ctx context.Context, state string) (*oauthState, error) {
+	if state == "" {
+		return nil, ErrInvalidOAuthState
+	}
+
+	data, err := o.redis.GetDel(ctx, "oauth_state:"+state).Bytes()
+	if err == redis.Nil {
+		return nil, ErrInvalidOAuthState
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var stored oauthState
+	if err := json.Unmarshal(data, &stored); err != nil {
+		return nil, ErrInvalidOAuthState
+	}
+	return &stored, nil
+}
+
+func (o *OAuth2Service) authEndpoint(ctx context.Context, cfg *OAuth2Config) (string, error) {
+	if cfg.AuthURL != "" {
+		return cfg.AuthURL, nil
+	}
+	doc, err := o.oidc.Discover(ctx, cfg.IssuerURL)
+	if err != nil {
+		return "", err
+	}
+	return doc.AuthorizationEndpoint, nil
+}
+
+type oauthTokenResponse struct {
+	AccessToken      string `json:"access_token"`
+	IDToken          string `json:"id_token"`
+	TokenType        string `json:"token_type"`
+	ExpiresIn        int    `json:"expires_in"`
+	Error            string `json:"error"`
+	ErrorDescription string `json:"error_description"`
+}
+
+// exchangeCode redeems an authorization code at the provider's token endpoint
+func (o *OAuth2Service) exchangeCode(ctx context.Context, cfg *OAuth2Config, code, verifier string) (*oauthTokenResponse, error) {
+	tokenURL := cfg.TokenURL
+	if tokenURL == "" {
+		doc, err := o.oidc.Discover(ctx, cfg.IssuerURL)
+		if err != nil {
 			return nil, err
 		}
+		tokenURL = doc.TokenEndpoint
+	}
 
-		if err := o.db.Create(&user).Error; err != nil {
+	clientSecret := cfg.ClientSecret
+	if cfg.Type == models.OAuthProviderTypeApple {
+		secret, err := appleClientSecret(cfg)
+		if err != nil {
 			return nil, err
 		}
-	} else {
-		// Update existing user
-		user.Name = oauthUser.Name
-		user.IsActive = true
-		if err := o.db.Save(&user).Error; err != nil {
-			return nil, err
+		clientSecret = secret
+	}
+
+	form := url.Values{}
+	form.Set("grant_type", "authorization_code")
+	form.Set("code", code)
+	form.Set("redirect_uri", cfg.RedirectURL)
+	form.Set("client_id", cfg.ClientID)
+	form.Set("client_secret", clientSecret)
+	form.Set("code_verifier", verifier)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, tokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	resp, err := o.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to exchange code: %w", err)
+	}
+	defer resp.Body.Close()
+
+	var tokens oauthTokenResponse
+	if err := json.NewDecoder(resp.Body).Decode(&tokens); err != nil {
+		return nil, fmt.Errorf("failed to decode token response: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK || tokens.Error != "" {
+		return nil, fmt.Errorf("token exchange failed: %s %s", tokens.Error, tokens.ErrorDescription)
+	}
+	return &tokens, nil
+}
+
+// fetchIdentity exchanges the code and builds the provider identity, from the validated
+// id_token for OIDC providers or from the userinfo endpoint for plain OAuth2 ones
+func (o *OAuth2Service) fetchIdentity(ctx context.Context, cfg *OAuth2Config, params OAuth2CallbackParams, state *oauthState) (*OAuth2User, error) {
+	tokens, err := o.exchangeCode(ctx, cfg, params.Code, state.CodeVerifier)
+	if err != nil {
+		return nil, err
+	}
+
+	if cfg.Type == models.OAuthProviderTypeOAuth2 {
+		return o.fetchUserInfo(ctx, cfg, tokens.AccessToken)
+	}
+
+	if tokens.IDToken == "" {
+		return nil, fmt.Errorf("%w: provider returned no id_token", ErrInvalidIDToken)
+	}
+	claims, err := o.oidc.ValidateIDToken(ctx, cfg.IssuerURL, tokens.IDToken, state.Nonce, cfg.ClientID)
+	if err != nil {
+		return nil, err
+	}
+
+	oauthUser := &OAuth2User{
+		ID:            claims.Subject,
+		Email:         claims.Email,
+		EmailVerified: bool(claims.EmailVerified),
+		Name:          claims.Name,
+		Picture:       claims.Picture,
+		Provider:      cfg.Name,
+	}
+	if cfg.Type == models.OAuthProviderTypeApple && params.AppleUser != "" {
+		oauthUser.Name = appleUserName(params.AppleUser)
+	}
+	return oauthUser, nil
+}
+
+// fetchUserInfo reads the identity from a plain OAuth2 userinfo endpoint
+func (o *OAuth2Service) fetchUserInfo(ctx context.Context, cfg *OAuth2Config, accessToken string) (*OAuth2User, error) {
+	var info map[string]interface{}
+	if err := o.getWithToken(ctx, cfg.UserInfoURL, accessToken, &info); err != nil {
+		return nil, fmt.Errorf("failed to get user info: %w", err)
+	}
+
+	oauthUser := &OAuth2User{
+		ID:       firstString(info, "sub", "id"),
+		Email:    firstString(info, "email"),
+		Name:     firstString(info, "name", "login"),
+		Picture:  firstString(info, "picture", "avatar_url"),
+		Provider: cfg.Name,
+	}
+	if verified, ok := info["email_verified"].(bool); ok {
+		oauthUser.EmailVerified = verified
+	}
+	if oauthUser.ID == "" {
+		return nil, errors.New("provider returned no user id")
+	}
+
+	// GitHub only exposes the public email on /user; verification status lives on /user/emails
+	if cfg.Name == string(GitHubProvider) {
+		var emails []struct {
+			Email    string `json:"email"`
+			Primary  bool   `json:"primary"`
+			Verified bool   `json:"verified"`
+		}
+		if err := o.getWithToken(ctx, "https://api.github.com/user/emails", accessToken, &emails); err == nil {
+			for _, email := range emails {
+				if email.Primary {
+					oauthUser.Email = email.Email
+					oauthUser.EmailVerified = email.Verified
+				}
+			}
 		}
 	}
 
-	return &user, nil
+	return oauthUser, nil
 }
 
-func (o *OAuth2Service) StoreOAuthState(ctx context.Context, state string, provider OAuth2Provider) error {
-	return o.redis.Set(ctx, "oauth_state:"+state, string(provider), 10*time.Minute).Err()
+func (o *OAuth2Service) getWithToken(ctx context.Context, url, accessToken string, out interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+accessToken)
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := o.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status %d from %s", resp.StatusCode, url)
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
 }
 
-func (o *OAuth2Service) ValidateOAuthState(ctx context.Context, state string) (OAuth2Provider, error) {
-	result := o.redis.Get(ctx, "oauth_state:"+state)
-	if result.Err() == redis.Nil {
-		return "", fmt.Errorf("invalid or expired state")
+// appleClientSecret signs the ES256 client secret JWT Apple expects in place of a static secret
+func appleClientSecret(cfg *OAuth2Config) (string, error) {
+	key, err := utils.ParsePrivateKeyPEM(cfg.ApplePrivateKey)
+	if err != nil {
+		return "", fmt.Errorf("invalid Apple private key: %w", err)
 	}
-	if result.Err() != nil {
-		return "", result.Err()
+	ecKey, ok := key.(*ecdsa.PrivateKey)
+	if !ok {
+		return "", errors.New("apple private key must be an EC key")
 	}
 
-	provider := OAuth2Provider(result.Val())
-	o.redis.Del(ctx, "oauth_state:"+state) // Remove used state
-	return provider, nil
+	now := time.Now()
+	token := jwt.NewWithClaims(jwt.SigningMethodES256, jwt.RegisteredClaims{
+		Issuer:    cfg.AppleTeamID,
+		Subject:   cfg.ClientID,
+		Audience:  jwt.ClaimStrings{appleIssuer},
+		IssuedAt:  jwt.NewNumericDate(now),
+		ExpiresAt: jwt.NewNumericDate(now.Add(5 * time.Minute)),
+	})
+	token.Header["kid"] = cfg.AppleKeyID
+	return token.SignedString(ecKey)
+}
+
+// appleUserName extracts the display name from the "user" field Apple posts on first login
+func appleUserName(raw string) string {
+	var appleUser struct {
+		Name struct {
+			FirstName string `json:"firstName"`
+			LastName  string `json:"lastName"`
+		} `json:"name"`
+	}
+	if err := json.Unmarshal([]byte(raw), &appleUser); err != nil {
+		return ""
+	}
+	return strings.TrimSpace(appleUser.Name.FirstName + " " + appleUser.Name.LastName)
+}
+
+// firstString returns the first non-empty value among keys, formatting numeric IDs as strings
+func firstString(values map[string]interface{}, keys ...string) string {
+	for _, key := range keys {
+		switch v := values[key].(type) {
+		case string:
+			if v != "" {
+				return v
+			}
+		case float64:
+			return fmt.Sprintf("%.0f", v)
+		}
+	}
+	return ""
 }
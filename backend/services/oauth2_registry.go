@@ -0,0 +1,232 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"mobile-backend/models"
+)
+
+// Built-in provider endpoints
+const (
+	googleIssuer       = "https://accounts.google.com"
+	appleIssuer        = "https://appleid.apple.com"
+	microsoftIssuerFmt = "https://login.microsoftonline.com/%s/v2.0"
+)
+
+// reservedProviderNames collide with the static routes under /auth/oauth2
+var reservedProviderNames = map[string]bool{"providers": true, "callback": true}
+
+// OAuth2ProviderInfo is the public description of a configured provider
+type OAuth2ProviderInfo struct {
+	Name        string `json:"name"`
+	DisplayName string `json:"display_name"`
+	Type        string `json:"type"`
+}
+
+// RegisterProvider adds or replaces a provider in the registry
+func (o *OAuth2Service) RegisterProvider(cfg *OAuth2Config) error {
+	if err := cfg.validate(); err != nil {
+		return err
+	}
+
+	o.mu.Lock()
+	o.providers[cfg.Name] = cfg
+	o.mu.Unlock()
+	return nil
+}
+
+// LoadProviders rebuilds the registry from the environment and the oauth_providers
+// table. Database rows override env providers with the same name.
+func (o *OAuth2Service) LoadProviders(ctx context.Context) error {
+	providers := make(map[string]*OAuth2Config)
+	for _, cfg := range providersFromEnv() {
+		if err := cfg.validate(); err != nil {
+			return err
+		}
+		providers[cfg.Name] = cfg
+	}
+
+	var records []models.OAuthProvider
+	if err := o.db.WithContext(ctx).Where("enabled = ?", true).Find(&records).Error; err != nil {
+		return fmt.Errorf("failed to load OAuth providers: %w", err)
+	}
+	for _, record := range records {
+		cfg := &OAuth2Config{
+			Name:         record.Name,
+			DisplayName:  record.DisplayName,
+			Type:         record.Type,
+			ClientID:     record.ClientID,
+			ClientSecret: record.ClientSecret,
+			RedirectURL:  record.RedirectURL,
+			IssuerURL:    record.IssuerURL,
+			AuthURL:      record.AuthURL,
+			TokenURL:     record.TokenURL,
+			UserInfoURL:  record.UserInfoURL,
+			Scopes:       strings.Fields(record.Scopes),
+
+			NativeClientIDs: strings.Fields(record.NativeClientIDs),
+		}
+		if err := cfg.validate(); err != nil {
+			return err
+		}
+		providers[cfg.Name] = cfg
+	}
+
+	o.mu.Lock()
+	o.providers = providers
+	o.mu.Unlock()
+	return nil
+}
+
+// GetConfig returns the configuration of a registered provider
+func (o *OAuth2Service) GetConfig(provider OAuth2Provider) (*OAuth2Config, error) {
+	o.mu.RLock()
+	defer o.mu.RUnlock()
+
+	cfg, ok := o.providers[string(provider)]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnsupportedOAuth2Provider, provider)
+	}
+	return cfg, nil
+}
+
+// Providers lists the registered providers ordered by name
+func (o *OAuth2Service) Providers() []OAuth2ProviderInfo {
+	o.mu.RLock()
+	defer o.mu.RUnlock()
+
+	providers := make([]OAuth2ProviderInfo, 0, len(o.providers))
+	for _, cfg := range o.providers {
+		providers = append(providers, OAuth2ProviderInfo{Name: cfg.Name, DisplayName: cfg.DisplayName, Type: cfg.Type})
+	}
+	sort.Slice(providers, func(i, j int) bool { return providers[i].Name < providers[j].Name })
+	return providers
+}
+
+func (cfg *OAuth2Config) validate() error {
+	if cfg.Name == "" || reservedProviderNames[cfg.Name] {
+		return fmt.Errorf("invalid OAuth provider name %q", cfg.Name)
+	}
+	if cfg.ClientID == "" {
+		return fmt.Errorf("OAuth provider %s: client id is required", cfg.Name)
+	}
+	if cfg.DisplayName == "" {
+		cfg.DisplayName = cfg.Name
+	}
+
+	switch cfg.Type {
+	case models.OAuthProviderTypeOIDC, models.OAuthProviderTypeApple:
+		if cfg.IssuerURL == "" {
+			return fmt.Errorf("OAuth provider %s: issuer url is required", cfg.Name)
+		}
+		if cfg.Type == models.OAuthProviderTypeApple && (cfg.AppleTeamID == "" || cfg.AppleKeyID == "" || cfg.ApplePrivateKey == "") {
+			return fmt.Errorf("OAuth provider %s: team id, key id and private key are required", cfg.Name)
+		}
+		if len(cfg.Scopes) == 0 {
+			cfg.Scopes = []string{"openid", "email", "profile"}
+		}
+	case models.OAuthProviderTypeOAuth2:
+		if cfg.AuthURL == "" || cfg.TokenURL == "" || cfg.UserInfoURL == "" {
+			return fmt.Errorf("OAuth provider %s: auth, token and userinfo urls are required", cfg.Name)
+		}
+	default:
+		return fmt.Errorf("OAuth provider %s: unsupported type %q", cfg.Name, cfg.Type)
+	}
+	return nil
+}
+
+// providersFromEnv builds the built-in providers whose credentials are set, plus any
+// generic OIDC providers listed in OIDC_PROVIDERS
+func providersFromEnv() []*OAuth2Config {
+	var providers []*OAuth2Config
+
+	if clientID := os.Getenv("GOOGLE_CLIENT_ID"); clientID != "" {
+		providers = append(providers, &OAuth2Config{
+			Name:         string(GoogleProvider),
+			DisplayName:  "Google",
+			Type:         models.OAuthProviderTypeOIDC,
+			ClientID:     clientID,
+			ClientSecret: os.Getenv("GOOGLE_CLIENT_SECRET"),
+			RedirectURL:  os.Getenv("GOOGLE_REDIRECT_URL"),
+			IssuerURL:    googleIssuer,
+
+			NativeClientIDs: splitList(os.Getenv("GOOGLE_NATIVE_CLIENT_IDS")),
+		})
+	}
+
+	if clientID := os.Getenv("GITHUB_CLIENT_ID"); clientID != "" {
+		providers = append(providers, &OAuth2Config{
+			Name:         string(GitHubProvider),
+			DisplayName:  "GitHub",
+			Type:         models.OAuthProviderTypeOAuth2,
+			ClientID:     clientID,
+			ClientSecret: os.Getenv("GITHUB_CLIENT_SECRET"),
+			RedirectURL:  os.Getenv("GITHUB_REDIRECT_URL"),
+			AuthURL:      "https://github.com/login/oauth/authorize",
+			TokenURL:     "https://github.com/login/oauth/access_token",
+			UserInfoURL:  "https://api.github.com/user",
+			Scopes:       []string{"read:user", "user:email"},
+		})
+	}
+
+	if clientID := os.Getenv("APPLE_CLIENT_ID"); clientID != "" {
+		providers = append(providers, &OAuth2Config{
+			Name:            string(AppleProvider),
+			DisplayName:     "Apple",
+			Type:            models.OAuthProviderTypeApple,
+			ClientID:        clientID,
+			RedirectURL:     os.Getenv("APPLE_REDIRECT_URL"),
+			IssuerURL:       appleIssuer,
+			Scopes:          []string{"name", "email"},
+			AppleTeamID:     os.Getenv("APPLE_TEAM_ID"),
+			AppleKeyID:      os.Getenv("APPLE_KEY_ID"),
+			ApplePrivateKey: os.Getenv("APPLE_PRIVATE_KEY"),
+			NativeClientIDs: splitList(os.Getenv("APPLE_NATIVE_CLIENT_IDS")),
+		})
+	}
+
+	if clientID := os.Getenv("MICROSOFT_CLIENT_ID"); clientID != "" {
+		providers = append(providers, &OAuth2Config{
+			Name:         string(MicrosoftProvider),
+			DisplayName:  "Microsoft",
+			Type:         models.OAuthProviderTypeOIDC,
+			ClientID:     clientID,
+			ClientSecret: os.Getenv("MICROSOFT_CLIENT_SECRET"),
+			RedirectURL:  os.Getenv("MICROSOFT_REDIRECT_URL"),
+			IssuerURL:    fmt.Sprintf(microsoftIssuerFmt, getEnvOrDefault("MICROSOFT_TENANT_ID", "common")),
+
+			NativeClientIDs: splitList(os.Getenv("MICROSOFT_NATIVE_CLIENT_IDS")),
+		})
+	}
+
+	for _, name := range strings.Split(os.Getenv("OIDC_PROVIDERS"), ",") {
+		name = strings.TrimSpace(strings.ToLower(name))
+		if name == "" {
+			continue
+		}
+		prefix := "OIDC_" + strings.ToUpper(strings.ReplaceAll(name, "-", "_")) + "_"
+		providers = append(providers, &OAuth2Config{
+			Name:         name,
+			DisplayName:  os.Getenv(prefix + "DISPLAY_NAME"),
+			Type:         models.OAuthProviderTypeOIDC,
+			ClientID:     os.Getenv(prefix + "CLIENT_ID"),
+			ClientSecret: os.Getenv(prefix + "CLIENT_SECRET"),
+			RedirectURL:  os.Getenv(prefix + "REDIRECT_URL"),
+			IssuerURL:    os.Getenv(prefix + "ISSUER"),
+			Scopes:       strings.Fields(os.Getenv(prefix + "SCOPES")),
+
+			NativeClientIDs: splitList(os.Getenv(prefix + "NATIVE_CLIENT_IDS")),
+		})
+	}
+
+	return providers
+}
+
+// splitList splits a comma or space separated env value
+func splitList(value string) []string {
+	return strings.FieldsFunc(value, func(r rune) bool { return r == ',' || r == ' ' })
+}
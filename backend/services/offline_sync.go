@@ -4,7 +4,9 @@ import (
 	"context"
 	"crypto/md5"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"regexp"
 	"strconv"
 	"time"
 
@@ -15,6 +17,12 @@ import (
 	"mobile-backend/models"
 )
 
+// ErrInvalidSyncTable is returned for operations on tables sync can't write to
+var ErrInvalidSyncTable = errors.New("table can't be synced")
+
+// syncTableName matches the plain table names generic operations may write to
+var syncTableName = regexp.MustCompile(`^[a-z_][a-z0-9_]*$`)
+
 // OfflineSyncService handles offline-first data synchronization
 type OfflineSyncService struct {
 	db               *gorm.DB
@@ -37,11 +45,19 @@ func NewOfflineSyncService(db *gorm.DB, redis *redis.Client, cache *CacheService
 	}
 }
 
-// QueueOperation queues an operation for offline sync
+// QueueOperation queues an operation for offline sync. The operation is bound to the
+// organization of ctx, which operations on tenant-owned tables require.
 func (os *OfflineSyncService) QueueOperation(ctx context.Context, userID uint, operation *models.OfflineOperation) error {
 	// Set user ID
 	operation.UserID = userID
 
+	operation.OrganizationID = nil
+	if organizationID, ok := models.OrganizationFromContext(ctx); ok {
+		operation.OrganizationID = &organizationID
+	} else if models.IsTenantOwnedTable(os.db, operation.TableName) {
+		return fmt.Errorf("%w: %s", models.ErrTenantRequired, operation.TableName)
+	}
+
 	// Generate operation ID if not provided
 	if operation.OperationID == "" {
 		operation.OperationID = generateOperationID()
@@ -256,8 +272,15 @@ func (os *OfflineSyncService) SyncUserDataSelective(ctx context.Context, userID
 	return nil
 }
 
-// processOperation processes a single offline operation
+// processOperation processes a single offline operation in the organization it was queued
+// in, whichever organization the sync itself runs in
 func (os *OfflineSyncService) processOperation(ctx context.Context, operation *models.OfflineOperation) error {
+	var organizationID uint
+	if operation.OrganizationID != nil {
+		organizationID = *operation.OrganizationID
+	}
+	ctx = models.WithOrganization(ctx, organizationID)
+
 	operation.MarkAsProcessing()
 	os.db.Save(operation)
 
@@ -761,7 +784,7 @@ func (os *OfflineSyncService) createProductRecord(ctx context.Context, operation
 		}
 	}
 
-	return os.db.Create(&product).Error
+	return os.db.WithContext(ctx).Create(&product).Error
 }
 
 // updateProductRecord updates a product record
@@ -780,7 +803,7 @@ func (os *OfflineSyncService) updateProductRecord(ctx context.Context, operation
 		return fmt.Errorf("invalid record ID: %w", err)
 	}
 
-	return os.db.Model(&models.Product{}).Where("id = ?", uint(id)).Updates(&product).Error
+	return checkSyncedRecord(os.db.WithContext(ctx).Model(&models.Product{}).Where("id = ?", uint(id)).Updates(&product))
 }
 
 // deleteProductRecord deletes a product record
@@ -790,7 +813,7 @@ func (os *OfflineSyncService) deleteProductRecord(ctx context.Context, operation
 		return fmt.Errorf("invalid record ID: %w", err)
 	}
 
-	return os.db.Delete(&models.Product{}, uint(id)).Error
+	return checkSyncedRecord(os.db.WithContext(ctx).Delete(&models.Product{}, uint(id)))
 }
 
 // createOrderRecord creates an order record
@@ -810,7 +833,7 @@ func (os *OfflineSyncService) createOrderRecord(ctx context.Context, operation *
 		}
 	}
 
-	return os.db.Create(&order).Error
+	return os.db.WithContext(ctx).Create(&order).Error
 }
 
 // updateOrderRecord updates an order record
@@ -829,7 +852,7 @@ func (os *OfflineSyncService) updateOrderRecord(ctx context.Context, operation *
 		return fmt.Errorf("invalid record ID: %w", err)
 	}
 
-	return os.db.Model(&models.Order{}).Where("id = ?", uint(id)).Updates(&order).Error
+	return checkSyncedRecord(os.db.WithContext(ctx).Model(&models.Order{}).Where("id = ?", uint(id)).Updates(&order))
 }
 
 // deleteOrderRecord deletes an order record
@@ -839,11 +862,35 @@ func (os *OfflineSyncService) deleteOrderRecord(ctx context.Context, operation *
 		return fmt.Errorf("invalid record ID: %w", err)
 	}
 
-	return os.db.Delete(&models.Order{}, uint(id)).Error
+	return checkSyncedRecord(os.db.WithContext(ctx).Delete(&models.Order{}, uint(id)))
+}
+
+// checkSyncedRecord fails an update or delete that matched no record, such as one of
+// another organization
+func checkSyncedRecord(result *gorm.DB) error {
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
+
+// checkGenericTable refuses raw writes to tables that aren't plain names or that are
+// tenant-owned, since raw SQL bypasses the tenant scope
+func (os *OfflineSyncService) checkGenericTable(table string) error {
+	if !syncTableName.MatchString(table) || models.IsTenantOwnedTable(os.db, table) {
+		return fmt.Errorf("%w: %s", ErrInvalidSyncTable, table)
+	}
+	return nil
 }
 
 // createGenericRecord creates a record in any table
 func (os *OfflineSyncService) createGenericRecord(ctx context.Context, operation *models.OfflineOperation) error {
+	if err := os.checkGenericTable(operation.TableName); err != nil {
+		return err
+	}
 	// For generic records, we'll use raw SQL
 	query := fmt.Sprintf("INSERT INTO %s (data) VALUES (?)", operation.TableName)
 	return os.db.Exec(query, operation.Data).Error
@@ -851,12 +898,18 @@ func (os *OfflineSyncService) createGenericRecord(ctx context.Context, operation
 
 // updateGenericRecord updates a record in any table
 func (os *OfflineSyncService) updateGenericRecord(ctx context.Context, operation *models.OfflineOperation) error {
+	if err := os.checkGenericTable(operation.TableName); err != nil {
+		return err
+	}
 	query := fmt.Sprintf("UPDATE %s SET data = ? WHERE id = ?", operation.TableName)
 	return os.db.Exec(query, operation.Data, operation.RecordID).Error
 }
 
 // deleteGenericRecord deletes a record from any table
 func (os *OfflineSyncService) deleteGenericRecord(ctx context.Context, operation *models.OfflineOperation) error {
+	if err := os.checkGenericTable(operation.TableName); err != nil {
+		return err
+	}
 	query := fmt.Sprintf("DELETE FROM %s WHERE id = ?", operation.TableName)
 	return os.db.Exec(query, operation.RecordID).Error
 }
@@ -903,10 +956,25 @@ func (os *OfflineSyncService) getSelectiveSyncData(ctx context.Context, userID u
 
 	// Check each table for modifications
 	tables := []string{"users", "products", "orders"}
+	conditions := make(map[string]string)
+	args := make(map[string][]interface{})
 	for _, table := range tables {
+		conditions[table] = "updated_at > ?"
+		args[table] = []interface{}{lastSyncTime}
+		if models.IsTenantOwnedTable(os.db, table) {
+			// Raw queries bypass the tenant scope, so organization data is filtered here and
+			// only synced within an organization
+			organizationID, ok := models.OrganizationFromContext(ctx)
+			if !ok {
+				continue
+			}
+			conditions[table] += " AND organization_id = ?"
+			args[table] = append(args[table], organizationID)
+		}
+
 		var count int64
-		query := fmt.Sprintf("SELECT COUNT(*) FROM %s WHERE updated_at > ?", table)
-		if err := os.db.Raw(query, lastSyncTime).Scan(&count).Error; err != nil {
+		query := fmt.Sprintf("SELECT COUNT(*) FROM %s WHERE %s", table, conditions[table])
+		if err := os.db.Raw(query, args[table]...).Scan(&count).Error; err != nil {
 			continue // Skip tables that don't exist or have errors
 		}
 
@@ -918,10 +986,10 @@ func (os *OfflineSyncService) getSelectiveSyncData(ctx context.Context, userID u
 	// Build selective sync data
 	syncData := make(map[string]interface{})
 	for _, table := range modifiedTables {
-		query := fmt.Sprintf("SELECT * FROM %s WHERE updated_at > ? ORDER BY updated_at ASC", table)
+		query := fmt.Sprintf("SELECT * FROM %s WHERE %s ORDER BY updated_at ASC", table, conditions[table])
 		var results []map[string]interface{}
 
-		if err := os.db.Raw(query, lastSyncTime).Scan(&results).Error; err != nil {
+		if err := os.db.Raw(query, args[table]...).Scan(&results).Error; err != nil {
 			os.logger.Error("Failed to get selective sync data",
 				zap.String("table", table),
 				zap.Error(err))
@@ -0,0 +1,238 @@
+package services
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"mobile-backend/utils"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const (
+	// oidcCacheTTL is how long discovery documents and key sets are reused
+	oidcCacheTTL = time.Hour
+	// oidcKeyRefreshInterval limits refetching a key set when a token names an unknown kid
+	oidcKeyRefreshInterval = time.Minute
+)
+
+var ErrInvalidIDToken = errors.New("invalid id token")
+
+// OIDCDiscovery is the subset of an OpenID Provider configuration document we use
+type OIDCDiscovery struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	UserInfoEndpoint      string `json:"userinfo_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+// IDTokenClaims are the standard claims read from a validated id_token
+type IDTokenClaims struct {
+	Nonce         string       `json:"nonce,omitempty"`
+	Email         string       `json:"email,omitempty"`
+	EmailVerified flexibleBool `json:"email_verified,omitempty"`
+	Name          string       `json:"name,omitempty"`
+	Picture       string       `json:"picture,omitempty"`
+	TenantID      string       `json:"tid,omitempty"` // Microsoft tenant, used for multi-tenant issuers
+	Username      string       `json:"preferred_username,omitempty"`
+	jwt.RegisteredClaims
+}
+
+// flexibleBool accepts both JSON booleans and the "true"/"false" strings Apple sends
+type flexibleBool bool
+
+func (b *flexibleBool) UnmarshalJSON(data []byte) error {
+	switch strings.Trim(string(data), `"`) {
+	case "true":
+		*b = true
+	default:
+		*b = false
+	}
+	return nil
+}
+
+type cachedDiscovery struct {
+	doc       *OIDCDiscovery
+	fetchedAt time.Time
+}
+
+type cachedKeySet struct {
+	keys      map[string]crypto.PublicKey
+	fetchedAt time.Time
+}
+
+// OIDCClient fetches and caches provider discovery documents and signing keys and
+// validates id_tokens against them
+type OIDCClient struct {
+	httpClient *http.Client
+
+	mu        sync.Mutex
+	discovery map[string]cachedDiscovery
+	keySets   map[string]cachedKeySet
+}
+
+// NewOIDCClient creates a new OIDC client
+func NewOIDCClient(httpClient *http.Client) *OIDCClient {
+	return &OIDCClient{
+		httpClient: httpClient,
+		discovery:  make(map[string]cachedDiscovery),
+		keySets:    make(map[string]cachedKeySet),
+	}
+}
+
+// Discover returns the provider configuration published under the issuer
+func (o *OIDCClient) Discover(ctx context.Context, issuer string) (*OIDCDiscovery, error) {
+	o.mu.Lock()
+	cached, ok := o.discovery[issuer]
+	o.mu.Unlock()
+	if ok && time.Since(cached.fetchedAt) < oidcCacheTTL {
+		return cached.doc, nil
+	}
+
+	var doc OIDCDiscovery
+	url := strings.TrimSuffix(issuer, "/") + "/.well-known/openid-configuration"
+	if err := o.getJSON(ctx, url, &doc); err != nil {
+		return nil, fmt.Errorf("failed to fetch discovery document: %w", err)
+	}
+	if doc.JWKSURI == "" || doc.TokenEndpoint == "" {
+		return nil, fmt.Errorf("discovery document for %s is incomplete", issuer)
+	}
+
+	o.mu.Lock()
+	o.discovery[issuer] = cachedDiscovery{doc: &doc, fetchedAt: time.Now()}
+	o.mu.Unlock()
+	return &doc, nil
+}
+
+// ValidateIDToken verifies the id_token signature against the issuer's published keys
+// and checks issuer, audience, expiry and, when expectedNonce is set, the nonce.
+// Any of the given audiences is accepted.
+func (o *OIDCClient) ValidateIDToken(ctx context.Context, issuer, rawIDToken, expectedNonce string, audiences ...string) (*IDTokenClaims, error) {
+	doc, err := o.Discover(ctx, issuer)
+	if err != nil {
+		return nil, err
+	}
+
+	claims := &IDTokenClaims{}
+	_, err = jwt.ParseWithClaims(rawIDToken, claims, func(token *jwt.Token) (interface{}, error) {
+		kid, _ := token.Header["kid"].(string)
+		key, err := o.key(ctx, doc.JWKSURI, kid)
+		if err != nil {
+			return nil, err
+		}
+		// The algorithm must match the key type to prevent algorithm confusion
+		switch key.(type) {
+		case *ecdsa.PublicKey:
+			if _, ok := token.Method.(*jwt.SigningMethodECDSA); !ok {
+				return nil, utils.ErrAlgorithmMismatch
+			}
+		default:
+			if _, ok := token.Method.(*jwt.SigningMethodRSA); !ok {
+				return nil, utils.ErrAlgorithmMismatch
+			}
+		}
+		return key, nil
+	}, jwt.WithValidMethods([]string{"RS256", "RS384", "RS512", "ES256", "ES384"}))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidIDToken, err)
+	}
+
+	// Multi-tenant issuers (Microsoft "common") publish a templated issuer
+	expectedIssuer := strings.Replace(doc.Issuer, "{tenantid}", claims.TenantID, 1)
+	if claims.Issuer != expectedIssuer {
+		return nil, fmt.Errorf("%w: unexpected issuer %q", ErrInvalidIDToken, claims.Issuer)
+	}
+
+	audienceOK := false
+	for _, audience := range audiences {
+		for _, aud := range claims.Audience {
+			if aud == audience && audience != "" {
+				audienceOK = true
+			}
+		}
+	}
+	if !audienceOK {
+		return nil, fmt.Errorf("%w: unexpected audience", ErrInvalidIDToken)
+	}
+
+	if expectedNonce != "" && claims.Nonce != expectedNonce {
+		return nil, fmt.Errorf("%w: nonce mismatch", ErrInvalidIDToken)
+	}
+	if claims.Subject == "" || claims.ExpiresAt == nil {
+		return nil, fmt.Errorf("%w: missing subject or expiry", ErrInvalidIDToken)
+	}
+
+	return claims, nil
+}
+
+// key returns the public key with the given kid, refetching the key set when the kid
+// is unknown so provider key rotations are picked up
+func (o *OIDCClient) key(ctx context.Context, jwksURI, kid string) (crypto.PublicKey, error) {
+	o.mu.Lock()
+	cached, ok := o.keySets[jwksURI]
+	o.mu.Unlock()
+
+	if ok && time.Since(cached.fetchedAt) < oidcCacheTTL {
+		if key, found := cached.keys[kid]; found {
+			return key, nil
+		}
+		if time.Since(cached.fetchedAt) < oidcKeyRefreshInterval {
+			return nil, utils.ErrUnknownKeyID
+		}
+	}
+
+	var set utils.JWKSet
+	if err := o.getJSON(ctx, jwksURI, &set); err != nil {
+		return nil, fmt.Errorf("failed to fetch signing keys: %w", err)
+	}
+
+	keys := make(map[string]crypto.PublicKey, len(set.Keys))
+	for _, jwk := range set.Keys {
+		if jwk.Use != "" && jwk.Use != "sig" {
+			continue
+		}
+		key, err := jwk.PublicKey()
+		if err != nil {
+			continue
+		}
+		keys[jwk.KeyID] = key
+	}
+
+	o.mu.Lock()
+	o.keySets[jwksURI] = cachedKeySet{keys: keys, fetchedAt: time.Now()}
+	o.mu.Unlock()
+
+	key, found := keys[kid]
+	if !found {
+		return nil, utils.ErrUnknownKeyID
+	}
+	return key, nil
+}
+
+func (o *OIDCClient) getJSON(ctx context.Context, url string, out interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := o.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status %d from %s", resp.StatusCode, url)
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
@@ -0,0 +1,394 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"mobile-backend/config"
+	"mobile-backend/models"
+	"mobile-backend/utils"
+
+	"github.com/hibiken/asynq"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+var (
+	ErrOrganizationNotFound      = errors.New("organization not found")
+	ErrNotOrganizationMember     = errors.New("not a member of the organization")
+	ErrAlreadyOrganizationMember = errors.New("user is already a member of the organization")
+	ErrInvalidOrganizationRole   = errors.New("invalid organization role")
+	ErrLastOrganizationOwner     = errors.New("an organization must keep at least one owner")
+	ErrInvalidInvitation         = errors.New("invalid or expired invitation")
+	ErrInvitationEmailMismatch   = errors.New("invitation was sent to a different email address")
+)
+
+var slugInvalidChars = regexp.MustCompile(`[^a-z0-9]+`)
+
+// OrganizationService manages organizations, their memberships and invitations.
+// Tenant-owned data is scoped to an organization by models.RegisterTenantScope.
+type OrganizationService struct {
+	db            *gorm.DB
+	jobQueue      *JobQueueService
+	logger        *config.Logger
+	invitationTTL time.Duration
+}
+
+// NewOrganizationService creates a new organization service configured from the environment
+func NewOrganizationService(db *gorm.DB, jobQueue *JobQueueService, logger *config.Logger) (*OrganizationService, error) {
+	invitationTTL, err := time.ParseDuration(getEnvOrDefault("ORGANIZATION_INVITATION_TTL", "168h"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid ORGANIZATION_INVITATION_TTL: %w", err)
+	}
+	if invitationTTL < 24*time.Hour {
+		return nil, fmt.Errorf("invalid ORGANIZATION_INVITATION_TTL: must be at least 24h")
+	}
+
+	return &OrganizationService{
+		db:            db,
+		jobQueue:      jobQueue,
+		logger:        logger,
+		invitationTTL: invitationTTL,
+	}, nil
+}
+
+// CreateOrganization creates an organization owned by the given user
+func (s *OrganizationService) CreateOrganization(ctx context.Context, ownerID uint, name string) (*models.Organization, error) {
+	suffix, err := utils.GenerateRandomString(3)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate slug: %w", err)
+	}
+	slug := strings.Trim(slugInvalidChars.ReplaceAllString(strings.ToLower(name), "-"), "-")
+	if len(slug) > 80 {
+		slug = strings.TrimRight(slug[:80], "-")
+	}
+	if slug == "" {
+		slug = "org"
+	}
+
+	organization := &models.Organization{
+		Name:      strings.TrimSpace(name),
+		Slug:      slug + "-" + suffix,
+		CreatedBy: ownerID,
+	}
+
+	err = s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(organization).Error; err != nil {
+			return err
+		}
+		return tx.Create(&models.OrganizationMembership{
+			OrganizationID: organization.ID,
+			UserID:         ownerID,
+			Role:           models.OrganizationRoleOwner,
+		}).Error
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create organization: %w", err)
+	}
+
+	s.logger.LogBusinessEvent(ctx, "organization_created", zap.Uint("organization_id", organization.ID), zap.Uint("user_id", ownerID))
+	return organization, nil
+}
+
+// ListOrganizations returns the user's memberships with their organizations
+func (s *OrganizationService) ListOrganizations(ctx context.Context, userID uint) ([]models.OrganizationMembership, error) {
+	var memberships []models.OrganizationMembership
+	if err := s.db.WithContext(ctx).Preload("Organization").
+		Where("user_id = ?", userID).
+		Order("created_at").
+		Find(&memberships).Error; err != nil {
+		return nil, fmt.Errorf("failed to list organizations: %w", err)
+	}
+	return memberships, nil
+}
+
+// GetOrganization returns an organization by ID
+func (s *OrganizationService) GetOrganization(ctx context.Context, organizationID uint) (*models.Organization, error) {
+	var organization models.Organization
+	if err := s.db.WithContext(ctx).First(&organization, organizationID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrOrganizationNotFound
+		}
+		return nil, fmt.Errorf("failed to load organization: %w", err)
+	}
+	return &organization, nil
+}
+
+// GetMembership returns the user's membership in the organization
+func (s *OrganizationService) GetMembership(ctx context.Context, organizationID, userID uint) (*models.OrganizationMembership, error) {
+	var membership models.OrganizationMembership
+	if err := s.db.WithContext(ctx).
+		Where("organization_id = ? AND user_id = ?", organizationID, userID).
+		First(&membership).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrNotOrganizationMember
+		}
+		return nil, fmt.Errorf("failed to load membership: %w", err)
+	}
+	return &membership, nil
+}
+
+// ListMembers returns the organization's memberships with their users
+func (s *OrganizationService) ListMembers(ctx context.Context, organizationID uint) ([]models.OrganizationMembership, error) {
+	var memberships []models.OrganizationMembership
+	if err := s.db.WithContext(ctx).Preload("User").
+		Where("organization_id = ?", organizationID).
+		Order("created_at").
+		Find(&memberships).Error; err != nil {
+		return nil, fmt.Errorf("failed to list members: %w", err)
+	}
+	return memberships, nil
+}
+
+// UpdateMemberRole changes a member's role. The last owner can't be demoted.
+func (s *OrganizationService) UpdateMemberRole(ctx context.Context, organizationID, userID uint, role string) (*models.OrganizationMembership, error) {
+	if !models.IsValidOrganizationRole(role) {
+		return nil, ErrInvalidOrganizationRole
+	}
+
+	var membership *models.OrganizationMembership
+	err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var err error
+		membership, err = s.findMembership(tx, organizationID, userID)
+		if err != nil {
+			return err
+		}
+		if membership.Role == models.OrganizationRoleOwner && role != models.OrganizationRoleOwner {
+			if err := s.ensureAnotherOwner(tx, organizationID, userID); err != nil {
+				return err
+			}
+		}
+		membership.Role = role
+		return tx.Model(membership).Update("role", role).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	s.logger.LogSecurityEvent(ctx, "organization_role_changed", "medium",
+		zap.Uint("organization_id", organizationID),
+		zap.Uint("user_id", userID),
+		zap.String("role", role),
+	)
+	return membership, nil
+}
+
+// RemoveMember removes a user from the organization. The last owner can't be removed.
+func (s *OrganizationService) RemoveMember(ctx context.Context, organizationID, userID uint) error {
+	err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		membership, err := s.findMembership(tx, organizationID, userID)
+		if err != nil {
+			return err
+		}
+		if membership.Role == models.OrganizationRoleOwner {
+			if err := s.ensureAnotherOwner(tx, organizationID, userID); err != nil {
+				return err
+			}
+		}
+		// Hard delete so the unique membership index doesn't block rejoining later
+		return tx.Unscoped().Delete(membership).Error
+	})
+	if err != nil {
+		return err
+	}
+
+	s.logger.LogSecurityEvent(ctx, "organization_member_removed", "medium",
+		zap.Uint("organization_id", organizationID),
+		zap.Uint("user_id", userID),
+	)
+	return nil
+}
+
+// CreateInvitation invites an email address to the organization and returns the raw
+// invitation token. Only its hash is persisted. Pending invitations to the same address
+// are replaced.
+func (s *OrganizationService) CreateInvitation(ctx context.Context, organizationID, invitedBy uint, email, role string) (*models.OrganizationInvitation, string, error) {
+	if !models.IsValidOrganizationRole(role) {
+		return nil, "", ErrInvalidOrganizationRole
+	}
+	email = strings.ToLower(strings.TrimSpace(email))
+
+	var existing int64
+	if err := s.db.WithContext(ctx).Model(&models.OrganizationMembership{}).
+		Joins("JOIN users ON users.id = organization_memberships.user_id").
+		Where("organization_memberships.organization_id = ? AND LOWER(users.email) = ?", organizationID, email).
+		Count(&existing).Error; err != nil {
+		return nil, "", fmt.Errorf("failed to check membership: %w", err)
+	}
+	if existing > 0 {
+		return nil, "", ErrAlreadyOrganizationMember
+	}
+
+	raw, err := utils.GenerateRandomString(32)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to generate invitation token: %w", err)
+	}
+
+	invitation := &models.OrganizationInvitation{
+		OrganizationID: organizationID,
+		Email:          email,
+		Role:           role,
+		TokenHash:      utils.HashToken(raw),
+		InvitedBy:      invitedBy,
+		ExpiresAt:      time.Now().Add(s.invitationTTL),
+	}
+
+	err = s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&models.OrganizationInvitation{}).
+			Where("organization_id = ? AND email = ? AND accepted_at IS NULL AND revoked_at IS NULL", organizationID, email).
+			Update("revoked_at", time.Now()).Error; err != nil {
+			return err
+		}
+		return tx.Create(invitation).Error
+	})
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to create invitation: %w", err)
+	}
+
+	return invitation, raw, nil
+}
+
+// InviteMember creates an invitation and emails it to the invitee
+func (s *OrganizationService) InviteMember(ctx context.Context, organizationID, invitedBy uint, email, role string) (*models.OrganizationInvitation, error) {
+	organization, err := s.GetOrganization(ctx, organizationID)
+	if err != nil {
+		return nil, err
+	}
+
+	invitation, raw, err := s.CreateInvitation(ctx, organizationID, invitedBy, email, role)
+	if err != nil {
+		return nil, err
+	}
+
+	subject, body := OrganizationInvitationEmail(organization.Name, raw, s.invitationTTL)
+	if _, err := s.jobQueue.EnqueueEmailNotification(EmailNotificationPayload{
+		Email:    invitation.Email,
+		Subject:  subject,
+		Body:     body,
+		Template: "organization_invitation",
+		Priority: 1,
+	}, asynq.Queue("critical"), asynq.MaxRetry(5)); err != nil {
+		return nil, fmt.Errorf("failed to enqueue email: %w", err)
+	}
+
+	s.logger.LogSecurityEvent(ctx, "organization_member_invited", "low",
+		zap.Uint("organization_id", organizationID),
+		zap.Uint("invited_by", invitedBy),
+		zap.String("role", role),
+	)
+	return invitation, nil
+}
+
+// ListInvitations returns the organization's pending invitations
+func (s *OrganizationService) ListInvitations(ctx context.Context, organizationID uint) ([]models.OrganizationInvitation, error) {
+	var invitations []models.OrganizationInvitation
+	if err := s.db.WithContext(ctx).
+		Where("organization_id = ? AND accepted_at IS NULL AND revoked_at IS NULL AND expires_at > ?", organizationID, time.Now()).
+		Order("created_at DESC").
+		Find(&invitations).Error; err != nil {
+		return nil, fmt.Errorf("failed to list invitations: %w", err)
+	}
+	return invitations, nil
+}
+
+// RevokeInvitation cancels a pending invitation
+func (s *OrganizationService) RevokeInvitation(ctx context.Context, organizationID, invitationID uint) error {
+	result := s.db.WithContext(ctx).Model(&models.OrganizationInvitation{}).
+		Where("id = ? AND organization_id = ? AND accepted_at IS NULL AND revoked_at IS NULL", invitationID, organizationID).
+		Update("revoked_at", time.Now())
+	if result.Error != nil {
+		return fmt.Errorf("failed to revoke invitation: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return ErrInvalidInvitation
+	}
+	return nil
+}
+
+// AcceptInvitation adds the user to the invitation's organization. The invitation must
+// have been sent to the user's email address.
+func (s *OrganizationService) AcceptInvitation(ctx context.Context, user *models.User, rawToken string) (*models.OrganizationMembership, error) {
+	var membership *models.OrganizationMembership
+	err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var invitation models.OrganizationInvitation
+		if err := tx.Where("token_hash = ?", utils.HashToken(rawToken)).First(&invitation).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return ErrInvalidInvitation
+			}
+			return fmt.Errorf("failed to load invitation: %w", err)
+		}
+		if !invitation.IsPending() {
+			return ErrInvalidInvitation
+		}
+		if !strings.EqualFold(invitation.Email, strings.TrimSpace(user.Email)) {
+			return ErrInvitationEmailMismatch
+		}
+
+		// Conditional update so an invitation can only be accepted once
+		result := tx.Model(&models.OrganizationInvitation{}).
+			Where("id = ? AND accepted_at IS NULL", invitation.ID).
+			Update("accepted_at", time.Now())
+		if result.Error != nil {
+			return fmt.Errorf("failed to accept invitation: %w", result.Error)
+		}
+		if result.RowsAffected == 0 {
+			return ErrInvalidInvitation
+		}
+
+		var count int64
+		if err := tx.Model(&models.OrganizationMembership{}).
+			Where("organization_id = ? AND user_id = ?", invitation.OrganizationID, user.ID).
+			Count(&count).Error; err != nil {
+			return fmt.Errorf("failed to check membership: %w", err)
+		}
+		if count > 0 {
+			return ErrAlreadyOrganizationMember
+		}
+
+		membership = &models.OrganizationMembership{
+			OrganizationID: invitation.OrganizationID,
+			UserID:         user.ID,
+			Role:           invitation.Role,
+		}
+		return tx.Create(membership).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	s.logger.LogSecurityEvent(ctx, "organization_invitation_accepted", "low",
+		zap.Uint("organization_id", membership.OrganizationID),
+		zap.Uint("user_id", user.ID),
+		zap.String("role", membership.Role),
+	)
+	return membership, nil
+}
+
+func (s *OrganizationService) findMembership(tx *gorm.DB, organizationID, userID uint) (*models.OrganizationMembership, error) {
+	var membership models.OrganizationMembership
+	if err := tx.Where("organization_id = ? AND user_id = ?", organizationID, userID).First(&membership).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrNotOrganizationMember
+		}
+		return nil, fmt.Errorf("failed to load membership: %w", err)
+	}
+	return &membership, nil
+}
+
+// ensureAnotherOwner fails unless the organization has an owner besides the given user
+func (s *OrganizationService) ensureAnotherOwner(tx *gorm.DB, organizationID, userID uint) error {
+	var owners int64
+	if err := tx.Model(&models.OrganizationMembership{}).
+		Where("organization_id = ? AND role = ? AND user_id <> ?", organizationID, models.OrganizationRoleOwner, userID).
+		Count(&owners).Error; err != nil {
+		return fmt.Errorf("failed to count owners: %w", err)
+	}
+	if owners == 0 {
+		return ErrLastOrganizationOwner
+	}
+	return nil
+}
@@ -0,0 +1,260 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"mobile-backend/models"
+	"mobile-backend/utils"
+
+	"gorm.io/gorm"
+)
+
+// Character classes a password policy can require
+const (
+	PasswordClassLower  = "lower"
+	PasswordClassUpper  = "upper"
+	PasswordClassDigit  = "digit"
+	PasswordClassSymbol = "symbol"
+)
+
+// ErrWeakPassword is wrapped by *PasswordPolicyError
+var ErrWeakPassword = errors.New("password does not meet the password policy")
+
+// PasswordPolicyError lists every rule a password breaks
+type PasswordPolicyError struct {
+	Violations []string
+}
+
+func (e *PasswordPolicyError) Error() string {
+	return fmt.Sprintf("%v: %s", ErrWeakPassword, strings.Join(e.Violations, "; "))
+}
+
+func (e *PasswordPolicyError) Unwrap() error {
+	return ErrWeakPassword
+}
+
+// passwordClassRules describes each character class and how to recognise it
+var passwordClassRules = map[string]struct {
+	description string
+	matches     func(rune) bool
+}{
+	PasswordClassLower:  {"a lowercase letter", unicode.IsLower},
+	PasswordClassUpper:  {"an uppercase letter", unicode.IsUpper},
+	PasswordClassDigit:  {"a digit", unicode.IsDigit},
+	PasswordClassSymbol: {"a symbol", func(r rune) bool { return unicode.IsPunct(r) || unicode.IsSymbol(r) }},
+}
+
+// PasswordPolicyService enforces the password rules: minimum length, required character
+// classes, no reuse of recent passwords, no passwords known from data breaches, and a
+// maximum age. It also stores password changes so the history stays current.
+type PasswordPolicyService struct {
+	db       *gorm.DB
+	breaches BreachedPasswordChecker
+
+	minLength   int
+	classes     []string      // character classes every password must contain
+	historySize int           // number of most recent passwords, the current one included, that can't be reused
+	maxAge      time.Duration // zero means passwords never expire
+	hashParams  utils.PasswordHashParams
+}
+
+// NewPasswordPolicyService creates a password policy configured from the environment
+func NewPasswordPolicyService(db *gorm.DB) (*PasswordPolicyService, error) {
+	maxAge, err := time.ParseDuration(getEnvOrDefault("PASSWORD_MAX_AGE", "0s"))
+	if err != nil || maxAge < 0 {
+		return nil, fmt.Errorf("invalid PASSWORD_MAX_AGE: %q", os.Getenv("PASSWORD_MAX_AGE"))
+	}
+
+	var classes []string
+	for _, class := range strings.Split(getEnvOrDefault("PASSWORD_REQUIRED_CLASSES", "lower,upper,digit"), ",") {
+		class = strings.TrimSpace(class)
+		if class == "" {
+			continue
+		}
+		if _, ok := passwordClassRules[class]; !ok {
+			return nil, fmt.Errorf("invalid PASSWORD_REQUIRED_CLASSES: unknown class %q", class)
+		}
+		classes = append(classes, class)
+	}
+
+	defaults := utils.DefaultPasswordHashParams
+	hashParams := utils.PasswordHashParams{
+		Algorithm:     getEnvOrDefault("PASSWORD_HASH_ALGORITHM", defaults.Algorithm),
+		BcryptCost:    utils.ParseInt(os.Getenv("PASSWORD_BCRYPT_COST"), defaults.BcryptCost),
+		Argon2Time:    uint32(utils.ParseInt(os.Getenv("PASSWORD_ARGON2_TIME"), int(defaults.Argon2Time))),
+		Argon2Memory:  uint32(utils.ParseInt(os.Getenv("PASSWORD_ARGON2_MEMORY"), int(defaults.Argon2Memory))),
+		Argon2Threads: uint8(utils.ParseInt(os.Getenv("PASSWORD_ARGON2_THREADS"), int(defaults.Argon2Threads))),
+	}
+	if err := hashParams.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid password hash settings: %w", err)
+	}
+
+	policy := &PasswordPolicyService{
+		db:          db,
+		minLength:   utils.ParseInt(os.Getenv("PASSWORD_MIN_LENGTH"), 10),
+		classes:     classes,
+		historySize: utils.ParseInt(os.Getenv("PASSWORD_HISTORY"), 5),
+		maxAge:      maxAge,
+		hashParams:  hashParams,
+	}
+	if policy.minLength < 1 || policy.minLength > hashParams.MaxPasswordBytes() {
+		return nil, fmt.Errorf("invalid PASSWORD_MIN_LENGTH: must be between 1 and %d", hashParams.MaxPasswordBytes())
+	}
+	if policy.historySize < 0 {
+		return nil, errors.New("invalid PASSWORD_HISTORY: must not be negative")
+	}
+
+	if dir := os.Getenv("PASSWORD_BREACH_DATASET_DIR"); dir != "" {
+		breaches, err := NewHashPrefixBreachChecker(dir)
+		if err != nil {
+			return nil, err
+		}
+		policy.breaches = breaches
+	}
+
+	return policy, nil
+}
+
+// HashParams returns the configured password hashing algorithm and cost
+func (p *PasswordPolicyService) HashParams() utils.PasswordHashParams {
+	return p.hashParams
+}
+
+// SetBreachChecker replaces the breached-password lookup; nil disables it
+func (p *PasswordPolicyService) SetBreachChecker(checker BreachedPasswordChecker) {
+	p.breaches = checker
+}
+
+// Validate checks a new password against the policy. user is nil for a new account;
+// otherwise the password must not match the user's recent passwords. A nil policy
+// accepts any password.
+func (p *PasswordPolicyService) Validate(ctx context.Context, user *models.User, password string) error {
+	if p == nil {
+		return nil
+	}
+
+	var violations []string
+	if utf8.RuneCountInString(password) < p.minLength {
+		violations = append(violations, fmt.Sprintf("must be at least %d characters long", p.minLength))
+	}
+	if limit := p.hashParams.MaxPasswordBytes(); len(password) > limit {
+		violations = append(violations, fmt.Sprintf("must be at most %d bytes long", limit))
+	}
+	for _, class := range p.classes {
+		rule := passwordClassRules[class]
+		if !strings.ContainsFunc(password, rule.matches) {
+			violations = append(violations, "must contain "+rule.description)
+		}
+	}
+
+	if user != nil && p.historySize > 0 {
+		reused, err := p.matchesRecentPassword(ctx, user, password)
+		if err != nil {
+			return err
+		}
+		if reused {
+			violations = append(violations, fmt.Sprintf("must not match any of your last %d passwords", p.historySize))
+		}
+	}
+
+	if p.breaches != nil {
+		count, err := p.breaches.BreachCount(ctx, password)
+		if err != nil {
+			return fmt.Errorf("failed to check breached passwords: %w", err)
+		}
+		if count > 0 {
+			violations = append(violations, "has appeared in a data breach and must not be used")
+		}
+	}
+
+	if len(violations) > 0 {
+		return &PasswordPolicyError{Violations: violations}
+	}
+	return nil
+}
+
+// SetPassword hashes and stores the user's new password inside tx, moving the old hash
+// into the password history and clearing any forced reset. Callers validate the password first.
+func (p *PasswordPolicyService) SetPassword(tx *gorm.DB, user *models.User, password string) error {
+	previous := user.Password
+	if err := user.HashPassword(password); err != nil {
+		return fmt.Errorf("failed to hash password: %w", err)
+	}
+	now := time.Now()
+	user.PasswordChangedAt = &now
+	user.PasswordResetRequired = false
+
+	if err := tx.Model(user).Updates(map[string]interface{}{
+		"password":                user.Password,
+		"password_changed_at":     now,
+		"password_reset_required": false,
+	}).Error; err != nil {
+		return fmt.Errorf("failed to update password: %w", err)
+	}
+
+	if p == nil || previous == "" {
+		return nil
+	}
+
+	// The current password counts towards the history, so keep one fewer old hash
+	keep := p.historySize - 1
+	var keepIDs []uint
+	if keep > 0 {
+		if err := tx.Create(&models.PasswordHistory{UserID: user.ID, PasswordHash: previous}).Error; err != nil {
+			return fmt.Errorf("failed to record password history: %w", err)
+		}
+		if err := tx.Model(&models.PasswordHistory{}).Where("user_id = ?", user.ID).Order("id DESC").Limit(keep).Pluck("id", &keepIDs).Error; err != nil {
+			return fmt.Errorf("failed to load password history: %w", err)
+		}
+	}
+	stale := tx.Where("user_id = ?", user.ID)
+	if len(keepIDs) > 0 {
+		stale = stale.Where("id NOT IN ?", keepIDs)
+	}
+	if err := stale.Delete(&models.PasswordHistory{}).Error; err != nil {
+		return fmt.Errorf("failed to prune password history: %w", err)
+	}
+	return nil
+}
+
+// IsExpired reports whether the user's password is older than the maximum age
+func (p *PasswordPolicyService) IsExpired(user *models.User) bool {
+	if p == nil || p.maxAge == 0 {
+		return false
+	}
+	changedAt := user.CreatedAt
+	if user.PasswordChangedAt != nil {
+		changedAt = *user.PasswordChangedAt
+	}
+	return time.Since(changedAt) > p.maxAge
+}
+
+// matchesRecentPassword compares the password with the current one and the most recent
+// entries of the user's password history
+func (p *PasswordPolicyService) matchesRecentPassword(ctx context.Context, user *models.User, password string) (bool, error) {
+	hashes := []string{user.Password}
+
+	if p.historySize > 1 {
+		var history []models.PasswordHistory
+		if err := p.db.WithContext(ctx).Where("user_id = ?", user.ID).Order("id DESC").Limit(p.historySize - 1).Find(&history).Error; err != nil {
+			return false, fmt.Errorf("failed to load password history: %w", err)
+		}
+		for _, entry := range history {
+			hashes = append(hashes, entry.PasswordHash)
+		}
+	}
+
+	for _, hash := range hashes {
+		if hash != "" && utils.CheckPasswordHash(password, hash) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
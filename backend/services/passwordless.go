@@ -0,0 +1,331 @@
+package services
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"mobile-backend/config"
+	"mobile-backend/models"
+	"mobile-backend/utils"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/hibiken/asynq"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+// Passwordless sign-in methods
+const (
+	PasswordlessMethodLink = "link" // a single-use link, for web and deep-linked apps
+	PasswordlessMethodCode = "code" // a 6-digit code typed into the app
+)
+
+// loginCodeDigits is the length of emailed sign-in codes
+const loginCodeDigits = 6
+
+var (
+	ErrInvalidPasswordlessCode = errors.New("invalid or expired sign-in code")
+	ErrPasswordlessRateLimited = errors.New("too many sign-in emails requested")
+)
+
+// PasswordlessService signs users in with magic links and emailed one-time codes.
+// Links and codes are single use and live in Redis until they expire.
+type PasswordlessService struct {
+	db       *gorm.DB
+	redis    *redis.Client
+	jobQueue *JobQueueService
+	lockout  *LoginLockoutService
+	logger   *config.Logger
+
+	linkTTL      time.Duration
+	codeTTL      time.Duration
+	maxAttempts  int64
+	emailLimit   int64
+	ipLimit      int64
+	rateWindow   time.Duration
+	autoRegister bool
+}
+
+// NewPasswordlessService creates a new passwordless service configured from the environment
+func NewPasswordlessService(db *gorm.DB, redis *redis.Client, jobQueue *JobQueueService, logger *config.Logger) (*PasswordlessService, error) {
+	linkTTL, err := time.ParseDuration(getEnvOrDefault("PASSWORDLESS_LINK_TTL", "15m"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid PASSWORDLESS_LINK_TTL: %w", err)
+	}
+	codeTTL, err := time.ParseDuration(getEnvOrDefault("PASSWORDLESS_CODE_TTL", "10m"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid PASSWORDLESS_CODE_TTL: %w", err)
+	}
+	rateWindow, err := time.ParseDuration(getEnvOrDefault("PASSWORDLESS_RATE_WINDOW", "1h"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid PASSWORDLESS_RATE_WINDOW: %w", err)
+	}
+
+	return &PasswordlessService{
+		db:           db,
+		redis:        redis,
+		jobQueue:     jobQueue,
+		logger:       logger,
+		linkTTL:      linkTTL,
+		codeTTL:      codeTTL,
+		maxAttempts:  int64(utils.ParseInt(os.Getenv("PASSWORDLESS_CODE_MAX_ATTEMPTS"), 5)),
+		emailLimit:   int64(utils.ParseInt(os.Getenv("PASSWORDLESS_EMAIL_RATE_LIMIT"), 5)),
+		ipLimit:      int64(utils.ParseInt(os.Getenv("PASSWORDLESS_IP_RATE_LIMIT"), 20)),
+		rateWindow:   rateWindow,
+		autoRegister: utils.ParseBool(os.Getenv("PASSWORDLESS_AUTO_SIGNUP"), false),
+	}, nil
+}
+
+// SetLoginLockout counts wrong sign-in codes as failed logins of the account in lockout,
+// and refuses codes while the account is locked out; nil stops tracking them
+func (s *PasswordlessService) SetLoginLockout(lockout *LoginLockoutService) {
+	s.lockout = lockout
+}
+
+// Start emails a sign-in link or code to the address. Unknown addresses are silently
+// ignored unless automatic signup is enabled, so callers can't probe for accounts.
+func (s *PasswordlessService) Start(ctx context.Context, email, method, clientIP string) error {
+	email = normalizeEmail(email)
+
+	if err := s.checkRateLimit(ctx, "email:"+utils.HashToken(email), s.emailLimit); err != nil {
+		return err
+	}
+	if err := s.checkRateLimit(ctx, "ip:"+clientIP, s.ipLimit); err != nil {
+		return err
+	}
+
+	var user models.User
+	err := s.db.WithContext(ctx).Where("LOWER(email) = ?", email).First(&user).Error
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		if !s.autoRegister {
+			return nil
+		}
+	case err != nil:
+		return fmt.Errorf("failed to load user: %w", err)
+	case !user.IsActive:
+		return nil
+	}
+
+	var subject, body string
+	switch method {
+	case PasswordlessMethodCode:
+		code, err := utils.GenerateNumericCode(loginCodeDigits)
+		if err != nil {
+			return fmt.Errorf("failed to generate code: %w", err)
+		}
+		// A new code replaces the previous one and resets its attempt counter
+		pipe := s.redis.TxPipeline()
+		pipe.Set(ctx, loginCodeKey(email), utils.HashToken(code), s.codeTTL)
+		pipe.Del(ctx, loginCodeAttemptsKey(email))
+		if _, err := pipe.Exec(ctx); err != nil {
+			return fmt.Errorf("failed to store code: %w", err)
+		}
+		subject, body = LoginCodeEmail(code, s.codeTTL)
+	default:
+		token, err := utils.GenerateRandomString(32)
+		if err != nil {
+			return fmt.Errorf("failed to generate token: %w", err)
+		}
+		if err := s.redis.Set(ctx, magicLinkKey(token), email, s.linkTTL).Err(); err != nil {
+			return fmt.Errorf("failed to store token: %w", err)
+		}
+		subject, body = MagicLinkEmail(token, s.linkTTL)
+	}
+
+	recipient := email
+	if user.ID != 0 {
+		recipient = user.Email
+	}
+	_, err = s.jobQueue.EnqueueEmailNotification(EmailNotificationPayload{
+		UserID:   user.ID,
+		Email:    recipient,
+		Subject:  subject,
+		Body:     body,
+		Template: "passwordless_" + method,
+		Priority: 1,
+	}, asynq.Queue("critical"), asynq.MaxRetry(3))
+	if err != nil {
+		return fmt.Errorf("failed to enqueue email: %w", err)
+	}
+	return nil
+}
+
+// VerifyLink consumes a magic link token and returns the user it signs in
+func (s *PasswordlessService) VerifyLink(ctx context.Context, token string) (*models.User, error) {
+	email, err := s.redis.GetDel(ctx, magicLinkKey(token)).Result()
+	if err != nil {
+		if errors.Is(err, redis.Nil) {
+			return nil, ErrInvalidPasswordlessCode
+		}
+		return nil, fmt.Errorf("failed to load token: %w", err)
+	}
+
+	return s.signIn(ctx, email, PasswordlessMethodLink)
+}
+
+// VerifyCode checks an emailed code entered from clientIP. After too many wrong guesses
+// the code is discarded and a new one has to be requested; wrong codes also count as
+// failed logins of the account.
+func (s *PasswordlessService) VerifyCode(ctx context.Context, email, code, clientIP string) (*models.User, error) {
+	email = normalizeEmail(email)
+
+	if s.lockout != nil {
+		if err := s.lockout.Check(ctx, email, clientIP); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := s.consumeCode(ctx, email, code); err != nil {
+		if errors.Is(err, ErrInvalidPasswordlessCode) {
+			s.recordLoginFailure(ctx, email, clientIP)
+		}
+		return nil, err
+	}
+
+	return s.signIn(ctx, email, PasswordlessMethodCode)
+}
+
+// consumeCode checks a code against the one emailed to the address and deletes it once
+// it matches, or once too many attempts have been made
+func (s *PasswordlessService) consumeCode(ctx context.Context, email, code string) error {
+	codeKey := loginCodeKey(email)
+	attemptsKey := loginCodeAttemptsKey(email)
+
+	attempts, err := s.redis.Incr(ctx, attemptsKey).Result()
+	if err != nil {
+		return fmt.Errorf("failed to count attempts: %w", err)
+	}
+	s.redis.Expire(ctx, attemptsKey, s.codeTTL)
+	if attempts > s.maxAttempts {
+		s.redis.Del(ctx, codeKey)
+		return ErrInvalidPasswordlessCode
+	}
+
+	expected, err := s.redis.Get(ctx, codeKey).Result()
+	if err != nil {
+		if errors.Is(err, redis.Nil) {
+			return ErrInvalidPasswordlessCode
+		}
+		return fmt.Errorf("failed to load code: %w", err)
+	}
+	if subtle.ConstantTimeCompare([]byte(expected), []byte(utils.HashToken(strings.TrimSpace(code)))) != 1 {
+		return ErrInvalidPasswordlessCode
+	}
+
+	// Only the request that deletes the code may use it
+	deleted, err := s.redis.Del(ctx, codeKey).Result()
+	if err != nil {
+		return fmt.Errorf("failed to consume code: %w", err)
+	}
+	if deleted == 0 {
+		return ErrInvalidPasswordlessCode
+	}
+	s.redis.Del(ctx, attemptsKey)
+	return nil
+}
+
+// recordLoginFailure counts a wrong code against the account, if there is one. Tracking
+// errors are logged rather than returned so they never change the response.
+func (s *PasswordlessService) recordLoginFailure(ctx context.Context, email, clientIP string) {
+	if s.lockout == nil {
+		return
+	}
+
+	var user *models.User
+	var existing models.User
+	if err := s.db.WithContext(ctx).Where("LOWER(email) = ?", email).First(&existing).Error; err == nil {
+		user = &existing
+	}
+	if err := s.lockout.RecordFailure(ctx, user, email, clientIP); err != nil {
+		s.logger.WarnWithContext(ctx, "Failed to record login failure", zap.Error(err))
+	}
+}
+
+// signIn returns the account for a proven email address, creating it when automatic
+// signup is enabled. Receiving the email proves ownership, so the address is marked verified.
+// Addresses match regardless of case, like they do when a guest upgrades.
+func (s *PasswordlessService) signIn(ctx context.Context, email, method string) (*models.User, error) {
+	email = normalizeEmail(email)
+
+	var user models.User
+	created := false
+	err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		now := time.Now()
+
+		err := tx.Where("LOWER(email) = ?", email).First(&user).Error
+		if err == nil {
+			if user.EmailVerifiedAt == nil {
+				return tx.Model(&user).Update("email_verified_at", now).Error
+			}
+			return nil
+		}
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			return err
+		}
+		if !s.autoRegister {
+			return ErrInvalidPasswordlessCode
+		}
+
+		user = models.User{
+			Email:           email,
+			Name:            strings.SplitN(email, "@", 2)[0],
+			IsActive:        true,
+			EmailVerifiedAt: &now,
+		}
+		// Passwordless users get an unusable random password until they set one via reset
+		randomPassword, err := utils.GenerateRandomString(32)
+		if err != nil {
+			return err
+		}
+		if err := user.HashPassword(randomPassword); err != nil {
+			return err
+		}
+		created = true
+		return tx.Create(&user).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	s.logger.LogSecurityEvent(ctx, "passwordless_login", "low",
+		zap.Uint("user_id", user.ID),
+		zap.String("method", method),
+		zap.Bool("signup", created),
+	)
+	return &user, nil
+}
+
+// checkRateLimit counts a request against a fixed window shared by all instances
+func (s *PasswordlessService) checkRateLimit(ctx context.Context, subject string, limit int64) error {
+	windowStart := time.Now().Truncate(s.rateWindow)
+	key := fmt.Sprintf("passwordless:rate:%s:%d", subject, windowStart.Unix())
+
+	pipe := s.redis.Pipeline()
+	incr := pipe.Incr(ctx, key)
+	pipe.Expire(ctx, key, s.rateWindow)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return fmt.Errorf("failed to check rate limit: %w", err)
+	}
+	if incr.Val() > limit {
+		return ErrPasswordlessRateLimited
+	}
+	return nil
+}
+
+func magicLinkKey(token string) string {
+	return "passwordless:link:" + utils.HashToken(token)
+}
+
+func loginCodeKey(email string) string {
+	return "passwordless:code:" + utils.HashToken(email)
+}
+
+func loginCodeAttemptsKey(email string) string {
+	return "passwordless:code_attempts:" + utils.HashToken(email)
+}
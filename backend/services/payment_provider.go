@@ -0,0 +1,104 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+
+	"mobile-backend/models"
+)
+
+// ErrUnsupportedPaymentProvider is returned for a provider name that isn't registered
+var ErrUnsupportedPaymentProvider = errors.New("unsupported payment provider")
+
+// PaymentProvider is implemented by every payment backend. Implementations keep our
+// products, plans, payments and subscriptions in sync with the provider, and record the
+// provider's name in Payment.PaymentMethod and Subscription.PaymentMethod so later calls
+// can be routed back to it.
+type PaymentProvider interface {
+	// Name is the key the provider is registered under, e.g. "stripe"
+	Name() string
+	// WebhookSignatureHeader is the request header carrying the webhook signature
+	WebhookSignatureHeader() string
+
+	CreateProduct(ctx context.Context, productData *models.Product) (*models.Product, error)
+	UpdateProduct(ctx context.Context, productID uint, updates *models.Product) (*models.Product, error)
+	CreatePrice(ctx context.Context, planData *models.Plan) (*models.Plan, error)
+	CreateCustomer(ctx context.Context, user *models.User) (string, error)
+	CreatePayment(ctx context.Context, userID uint, productID uint, amount int64, currency string) (*models.Payment, error)
+	// CreateSubscription subscribes the user to a plan. paymentMethodID is optional and
+	// ignored by providers that collect payment details themselves.
+	CreateSubscription(ctx context.Context, userID uint, planID uint, paymentMethodID string) (*models.Subscription, error)
+	CancelSubscription(ctx context.Context, subscriptionID uint, immediately bool) error
+	// ChangePlan moves the subscription to plan and the preview's quantity at the
+	// provider, charging the preview's proration for immediate changes. The caller
+	// records the change.
+	ChangePlan(ctx context.Context, sub *models.Subscription, plan *models.Plan, preview *ProrationPreview) error
+	// RefundPayment refunds refund.Amount of payment at the provider and sets the
+	// refund's ProviderRefundID and Status. The caller records the refund.
+	RefundPayment(ctx context.Context, payment *models.Payment, refund *models.Refund) error
+	HandleWebhook(ctx context.Context, payload []byte, signature string) error
+}
+
+// PaymentProviderRegistry looks up payment providers by name
+type PaymentProviderRegistry struct {
+	mu              sync.RWMutex
+	providers       map[string]PaymentProvider
+	defaultProvider string
+}
+
+// NewPaymentProviderRegistry creates an empty registry. defaultProvider names the
+// provider used for catalog changes; when it's empty the first registered provider is used.
+func NewPaymentProviderRegistry(defaultProvider string) *PaymentProviderRegistry {
+	return &PaymentProviderRegistry{
+		providers:       make(map[string]PaymentProvider),
+		defaultProvider: defaultProvider,
+	}
+}
+
+// Register adds or replaces a provider in the registry
+func (r *PaymentProviderRegistry) Register(provider PaymentProvider) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.providers[provider.Name()] = provider
+	if r.defaultProvider == "" {
+		r.defaultProvider = provider.Name()
+	}
+}
+
+// Get returns the provider registered under name
+func (r *PaymentProviderRegistry) Get(name string) (PaymentProvider, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	provider, ok := r.providers[name]
+	if !ok {
+		return nil, fmt.Errorf("%w: %q", ErrUnsupportedPaymentProvider, name)
+	}
+	return provider, nil
+}
+
+// Default returns the provider that products and plans are created with
+func (r *PaymentProviderRegistry) Default() (PaymentProvider, error) {
+	r.mu.RLock()
+	name := r.defaultProvider
+	r.mu.RUnlock()
+
+	return r.Get(name)
+}
+
+// Names returns the registered provider names in alphabetical order
+func (r *PaymentProviderRegistry) Names() []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	names := make([]string, 0, len(r.providers))
+	for name := range r.providers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
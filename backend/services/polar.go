@@ -16,6 +16,7 @@ import (
 	"gorm.io/gorm"
 )
 
+// PolarService is the Polar PaymentProvider
 type PolarService struct {
 	db                        *gorm.DB
 	cache                     *CacheService
@@ -23,9 +24,13 @@ type PolarService struct {
 	baseURL                   string
 	webhookSecret             string
 	subscriptionStatusService *SubscriptionStatusService
+	refunds                   *RefundService
 }
 
 func NewPolarService(db *gorm.DB, cache *CacheService, subscriptionStatusService *SubscriptionStatusService) *PolarService {
+	// Products are the global billing catalog, shared by every organization
+	db = models.AcrossTenants(db)
+
 	return &PolarService{
 		db:                        db,
 		cache:                     cache,
@@ -36,6 +41,21 @@ func NewPolarService(db *gorm.DB, cache *CacheService, subscriptionStatusService
 	}
 }
 
+// Name returns the provider key Polar is registered under
+func (p *PolarService) Name() string {
+	return "polar"
+}
+
+// WebhookSignatureHeader returns the header Polar signs webhooks in
+func (p *PolarService) WebhookSignatureHeader() string {
+	return "X-Polar-Signature"
+}
+
+// SetRefundService records the refunds reported by Polar webhooks
+func (p *PolarService) SetRefundService(refunds *RefundService) {
+	p.refunds = refunds
+}
+
 // Polar API Types
 type PolarProduct struct {
 	ID          string                 `json:"id"`
@@ -303,8 +323,9 @@ func (p *PolarService) CreatePayment(ctx context.Context, userID uint, productID
 
 // Subscription Management
 
-// CreateSubscription creates a subscription in Polar
-func (p *PolarService) CreateSubscription(ctx context.Context, userID uint, planID uint) (*models.Subscription, error) {
+// CreateSubscription creates a subscription in Polar. Polar collects payment details
+// itself, so paymentMethodID is ignored.
+func (p *PolarService) CreateSubscription(ctx context.Context, userID uint, planID uint, paymentMethodID string) (*models.Subscription, error) {
 	var user models.User
 	if err := p.db.First(&user, userID).Error; err != nil {
 		return nil, fmt.Errorf("user not found: %w", err)
@@ -354,6 +375,7 @@ func (p *PolarService) CreateSubscription(ctx context.Context, userID uint, plan
 		CurrentPeriodEnd:    currentPeriodEnd,
 		CancelAtPeriodEnd:   createdSubscription.CancelAtPeriodEnd,
 		PolarSubscriptionID: createdSubscription.ID,
+		PaymentMethod:       "polar",
 		Quantity:            1,
 	}
 
@@ -423,6 +445,59 @@ func (p *PolarService) CancelSubscription(ctx context.Context, subscriptionID ui
 	return nil
 }
 
+// ChangePlan moves a subscription to another price and invoices the proration right
+// away. Polar always prorates plan changes, so downgrades can't wait for the end of the
+// period.
+func (p *PolarService) ChangePlan(ctx context.Context, sub *models.Subscription, plan *models.Plan, preview *ProrationPreview) error {
+	if sub.PolarSubscriptionID == "" {
+		return fmt.Errorf("subscription does not have Polar ID")
+	}
+	if plan.PolarPlanID == "" {
+		return fmt.Errorf("plan does not have Polar price ID")
+	}
+	if preview.Timing != PlanChangeImmediate {
+		return ErrPlanChangeUnsupported
+	}
+
+	err := p.updatePolarSubscription(ctx, sub.PolarSubscriptionID, map[string]interface{}{
+		"price_id":           plan.PolarPlanID,
+		"quantity":           preview.NewQuantity,
+		"proration_behavior": "invoice",
+	})
+	if err != nil {
+		return fmt.Errorf("failed to update Polar subscription: %w", err)
+	}
+	return nil
+}
+
+// RefundPayment refunds a Polar payment
+func (p *PolarService) RefundPayment(ctx context.Context, payment *models.Payment, refund *models.Refund) error {
+	if payment.PolarPaymentID == "" {
+		return fmt.Errorf("payment does not have Polar ID")
+	}
+
+	result, err := p.makePolarRequest(ctx, "POST", "/refunds", map[string]interface{}{
+		"payment_id": payment.PolarPaymentID,
+		"amount":     refund.Amount,
+		"reason":     polarRefundReason(refund.Reason),
+		"metadata": map[string]interface{}{
+			"refund_id": strconv.FormatUint(uint64(refund.ID), 10),
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create Polar refund: %w", err)
+	}
+
+	refundData, ok := result.(map[string]interface{})
+	if !ok {
+		return fmt.Errorf("invalid refund in Polar response")
+	}
+	refund.ProviderRefundID, _ = refundData["id"].(string)
+	status, _ := refundData["status"].(string)
+	refund.Status = polarRefundStatus(status)
+	return nil
+}
+
 // Webhook Handling
 
 // HandleWebhook processes Polar webhook events
@@ -481,6 +556,8 @@ func (p *PolarService) HandleWebhook(ctx context.Context, payload []byte, signat
 		return p.handlePlanUpdated(ctx, event)
 	case "plan.deleted":
 		return p.handlePlanDeleted(ctx, event)
+	case "refund.created", "refund.updated":
+		return p.handleRefund(ctx, event)
 	default:
 		// Mark as processed even if we don't handle it
 		p.db.Model(webhookEvent).Updates(map[string]interface{}{
@@ -814,6 +891,45 @@ func (p *PolarService) makePolarRequest(ctx context.Context, method, endpoint st
 	return result, nil
 }
 
+func (p *PolarService) handleRefund(ctx context.Context, event PolarWebhookEvent) error {
+	refundData, ok := event.Data["refund"].(map[string]interface{})
+	if !ok {
+		return fmt.Errorf("invalid refund data in webhook")
+	}
+	if p.refunds == nil {
+		return p.markWebhookProcessed(ctx, event.ID)
+	}
+
+	paymentID, _ := refundData["payment_id"].(string)
+	var payment models.Payment
+	if err := p.db.Where("polar_payment_id = ?", paymentID).First(&payment).Error; err != nil {
+		return fmt.Errorf("failed to find payment record: %w", err)
+	}
+
+	reported := ProviderRefund{}
+	reported.ID, _ = refundData["id"].(string)
+	reported.Currency, _ = refundData["currency"].(string)
+	reported.Reason, _ = refundData["reason"].(string)
+	status, _ := refundData["status"].(string)
+	reported.Status = polarRefundStatus(status)
+	if amount, ok := refundData["amount"].(float64); ok {
+		reported.Amount = int64(amount)
+	}
+	if metadata, ok := refundData["metadata"].(map[string]interface{}); ok {
+		if refundID, ok := metadata["refund_id"].(string); ok {
+			if id, err := strconv.ParseUint(refundID, 10, 64); err == nil {
+				reported.RefundID = uint(id)
+			}
+		}
+	}
+
+	if err := p.refunds.RecordRefund(ctx, &payment, reported); err != nil {
+		return err
+	}
+
+	return p.markWebhookProcessed(ctx, event.ID)
+}
+
 // Helper Methods
 
 func (p *PolarService) markWebhookProcessed(ctx context.Context, eventID string) error {
@@ -1164,3 +1280,27 @@ func (p *PolarService) convertPolarMetadataToMap(data map[string]interface{}) mo
 	}
 	return result
 }
+
+// polarRefundReason maps a models.RefundReason* to the reason Polar expects
+func polarRefundReason(reason string) string {
+	switch reason {
+	case models.RefundReasonDuplicate, models.RefundReasonFraudulent:
+		return reason
+	case models.RefundReasonRequestedByCustomer:
+		return "customer_request"
+	}
+	return "other"
+}
+
+// polarRefundStatus maps a Polar refund status to a models.RefundStatus*
+func polarRefundStatus(status string) string {
+	switch status {
+	case "succeeded":
+		return models.RefundStatusSucceeded
+	case "failed":
+		return models.RefundStatusFailed
+	case "canceled":
+		return models.RefundStatusCanceled
+	}
+	return models.RefundStatusPending
+}
@@ -0,0 +1,793 @@
+package services
+
+import (
+	"archive/zip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"mobile-backend/config"
+	"mobile-backend/models"
+	"mobile-backend/utils"
+
+	"github.com/hibiken/asynq"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+var (
+	ErrDataRequestNotFound       = errors.New("data request not found")
+	ErrDataRequestNotCancellable = errors.New("data request can no longer be cancelled")
+	ErrDataExportUnavailable     = errors.New("data export is not available")
+	ErrErasureAlreadyScheduled   = errors.New("account deletion is already scheduled")
+	ErrErasureBlocked            = errors.New("account cannot be deleted yet")
+	ErrErasureNotDue             = errors.New("account deletion is not due yet")
+)
+
+// notificationTables hold per-user notification records. gorm can't map their models
+// (NotificationTarget holds slices), so they are read and erased by table name.
+var notificationTables = []string{"push_notifications", "notification_analytics"}
+
+// exportRelationKeys are associations serialized by the models that carry no data of their own
+var exportRelationKeys = []string{"user", "product", "plan", "subscription", "payments", "organization", "notification", "template", "segment"}
+
+// PrivacyService handles personal data export and right-to-erasure requests. Both run as
+// background jobs; erasures wait out a grace period during which the user can cancel.
+type PrivacyService struct {
+	db                 *gorm.DB
+	jobQueue           *JobQueueService
+	sessions           *SessionService
+	auditService       *AuditService
+	logger             *config.Logger
+	exportDir          string
+	exportTTL          time.Duration
+	erasureGracePeriod time.Duration
+}
+
+// NewPrivacyService creates a new privacy service configured from the environment and
+// registers its job handlers with jobQueue
+func NewPrivacyService(db *gorm.DB, jobQueue *JobQueueService, revocations *TokenBlacklistService, auditService *AuditService, logger *config.Logger) (*PrivacyService, error) {
+	exportTTL, err := time.ParseDuration(getEnvOrDefault("DATA_EXPORT_TTL", "168h"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid DATA_EXPORT_TTL: %w", err)
+	}
+	if exportTTL < time.Hour {
+		return nil, fmt.Errorf("invalid DATA_EXPORT_TTL: must be at least 1h")
+	}
+	gracePeriod, err := time.ParseDuration(getEnvOrDefault("ACCOUNT_ERASURE_GRACE_PERIOD", "336h"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid ACCOUNT_ERASURE_GRACE_PERIOD: %w", err)
+	}
+	if gracePeriod < 0 {
+		return nil, fmt.Errorf("invalid ACCOUNT_ERASURE_GRACE_PERIOD: must not be negative")
+	}
+
+	s := &PrivacyService{
+		db:                 db,
+		jobQueue:           jobQueue,
+		sessions:           NewSessionService(db, revocations, logger),
+		auditService:       auditService,
+		logger:             logger,
+		exportDir:          getEnvOrDefault("DATA_EXPORT_DIR", "./exports"),
+		exportTTL:          exportTTL,
+		erasureGracePeriod: gracePeriod,
+	}
+
+	if jobQueue != nil {
+		jobQueue.RegisterHandler(TypeUserDataExport, s.handleExport)
+		jobQueue.RegisterHandler(TypeUserErasure, s.handleErasure)
+	}
+	return s, nil
+}
+
+// CreateExportRequest records a data export request for the user. An export that is
+// still waiting to be processed is returned instead of creating another.
+func (s *PrivacyService) CreateExportRequest(ctx context.Context, userID uint) (*models.DataRequest, error) {
+	var existing models.DataRequest
+	err := s.db.WithContext(ctx).
+		Where("user_id = ? AND type = ? AND status IN ?", userID, models.DataRequestExport,
+			[]string{models.DataRequestPending, models.DataRequestProcessing}).
+		First(&existing).Error
+	if err == nil {
+		return &existing, nil
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, fmt.Errorf("failed to load data requests: %w", err)
+	}
+
+	request := &models.DataRequest{
+		UserID: userID,
+		Type:   models.DataRequestExport,
+		Status: models.DataRequestPending,
+	}
+	if err := s.db.WithContext(ctx).Create(request).Error; err != nil {
+		return nil, fmt.Errorf("failed to create data request: %w", err)
+	}
+	return request, nil
+}
+
+// RequestExport records a data export request and enqueues the job that builds the archive
+func (s *PrivacyService) RequestExport(ctx context.Context, userID uint) (*models.DataRequest, error) {
+	request, err := s.CreateExportRequest(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if request.Status != models.DataRequestPending {
+		return request, nil
+	}
+
+	// The task ID keeps a repeated request from queueing the same export twice
+	_, err = s.jobQueue.EnqueueUserDataExport(DataRequestPayload{RequestID: request.ID},
+		asynq.TaskID(dataRequestTaskID(request)), asynq.MaxRetry(3))
+	if err != nil && !errors.Is(err, asynq.ErrTaskIDConflict) {
+		return nil, fmt.Errorf("failed to enqueue data export: %w", err)
+	}
+
+	s.logger.LogSecurityEvent(ctx, "data_export_requested", "low",
+		zap.Uint("user_id", userID),
+		zap.Uint("data_request_id", request.ID),
+	)
+	return request, nil
+}
+
+// ScheduleErasure records a request to erase the user's account once the grace period
+// has passed. Users with an active subscription, or who are the only owner of an
+// organization that has other members, must resolve that first.
+func (s *PrivacyService) ScheduleErasure(ctx context.Context, userID uint) (*models.DataRequest, error) {
+	var open int64
+	if err := s.db.WithContext(ctx).Model(&models.DataRequest{}).
+		Where("user_id = ? AND type = ? AND status IN ?", userID, models.DataRequestErasure,
+			[]string{models.DataRequestPending, models.DataRequestProcessing}).
+		Count(&open).Error; err != nil {
+		return nil, fmt.Errorf("failed to load data requests: %w", err)
+	}
+	if open > 0 {
+		return nil, ErrErasureAlreadyScheduled
+	}
+
+	if err := s.checkErasureAllowed(s.db.WithContext(ctx), userID); err != nil {
+		return nil, err
+	}
+
+	scheduledFor := time.Now().Add(s.erasureGracePeriod)
+	request := &models.DataRequest{
+		UserID:       userID,
+		Type:         models.DataRequestErasure,
+		Status:       models.DataRequestPending,
+		ScheduledFor: &scheduledFor,
+	}
+	if err := s.db.WithContext(ctx).Create(request).Error; err != nil {
+		return nil, fmt.Errorf("failed to create data request: %w", err)
+	}
+	return request, nil
+}
+
+// EraseNow erases the user's account straight away instead of after the grace period.
+// It is meant for accounts no one could cancel a deletion for, such as stale guests.
+func (s *PrivacyService) EraseNow(ctx context.Context, userID uint) (*models.DataRequest, error) {
+	if err := s.checkErasureAllowed(s.db.WithContext(ctx), userID); err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	request := &models.DataRequest{
+		UserID:       userID,
+		Type:         models.DataRequestErasure,
+		Status:       models.DataRequestPending,
+		ScheduledFor: &now,
+	}
+	if err := s.db.WithContext(ctx).Create(request).Error; err != nil {
+		return nil, fmt.Errorf("failed to create data request: %w", err)
+	}
+
+	if err := s.ProcessErasure(ctx, request.ID); err != nil {
+		return nil, err
+	}
+	if err := s.db.WithContext(ctx).First(request, request.ID).Error; err != nil {
+		return nil, fmt.Errorf("failed to load data request: %w", err)
+	}
+	if request.Status != models.DataRequestCompleted {
+		return request, fmt.Errorf("account erasure did not complete: %s", request.Error)
+	}
+	return request, nil
+}
+
+// RequestErasure schedules the erasure of the user's account, enqueues the job that will
+// carry it out and emails the user how to cancel
+func (s *PrivacyService) RequestErasure(ctx context.Context, userID uint) (*models.DataRequest, error) {
+	var user models.User
+	if err := s.db.WithContext(ctx).First(&user, userID).Error; err != nil {
+		return nil, fmt.Errorf("failed to load user: %w", err)
+	}
+
+	request, err := s.ScheduleErasure(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := s.jobQueue.EnqueueUserErasure(DataRequestPayload{RequestID: request.ID},
+		asynq.TaskID(dataRequestTaskID(request)), asynq.ProcessAt(*request.ScheduledFor), asynq.MaxRetry(10)); err != nil {
+		s.db.WithContext(ctx).Model(request).Updates(map[string]interface{}{
+			"status": models.DataRequestFailed,
+			"error":  "failed to schedule erasure",
+		})
+		return nil, fmt.Errorf("failed to enqueue account erasure: %w", err)
+	}
+
+	subject, body := AccountErasureScheduledEmail(user.Name, *request.ScheduledFor)
+	if _, err := s.jobQueue.EnqueueEmailNotification(EmailNotificationPayload{
+		UserID:   user.ID,
+		Email:    user.Email,
+		Subject:  subject,
+		Body:     body,
+		Template: "account_erasure_scheduled",
+		Priority: 1,
+	}, asynq.Queue("critical"), asynq.MaxRetry(5)); err != nil {
+		s.logger.LogError(ctx, err, "Failed to enqueue account erasure email", zap.Uint("user_id", userID))
+	}
+
+	s.logger.LogSecurityEvent(ctx, "account_erasure_scheduled", "medium",
+		zap.Uint("user_id", userID),
+		zap.Uint("data_request_id", request.ID),
+		zap.Time("scheduled_for", *request.ScheduledFor),
+	)
+	return request, nil
+}
+
+// CancelRequest cancels one of the user's requests that has not started yet. Cancelling
+// an erasure during its grace period keeps the account.
+func (s *PrivacyService) CancelRequest(ctx context.Context, userID, requestID uint) (*models.DataRequest, error) {
+	request, err := s.GetRequest(ctx, userID, requestID)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	result := s.db.WithContext(ctx).Model(&models.DataRequest{}).
+		Where("id = ? AND status = ?", request.ID, models.DataRequestPending).
+		Updates(map[string]interface{}{
+			"status":       models.DataRequestCancelled,
+			"cancelled_at": now,
+		})
+	if result.Error != nil {
+		return nil, fmt.Errorf("failed to cancel data request: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return nil, ErrDataRequestNotCancellable
+	}
+	request.Status = models.DataRequestCancelled
+	request.CancelledAt = &now
+
+	// The job skips cancelled requests, so a task that can't be removed is harmless
+	if s.jobQueue != nil {
+		if err := s.jobQueue.DeleteTask("default", dataRequestTaskID(request)); err != nil {
+			s.logger.Debug("Queued data request task not removed", zap.Uint("data_request_id", request.ID), zap.Error(err))
+		}
+	}
+
+	s.logger.LogSecurityEvent(ctx, "data_request_cancelled", "low",
+		zap.Uint("user_id", userID),
+		zap.Uint("data_request_id", request.ID),
+		zap.String("type", request.Type),
+	)
+	return request, nil
+}
+
+// ListRequests returns the user's export and erasure requests, newest first
+func (s *PrivacyService) ListRequests(ctx context.Context, userID uint) ([]models.DataRequest, error) {
+	var requests []models.DataRequest
+	if err := s.db.WithContext(ctx).Where("user_id = ?", userID).Order("id DESC").Find(&requests).Error; err != nil {
+		return nil, fmt.Errorf("failed to list data requests: %w", err)
+	}
+	return requests, nil
+}
+
+// GetRequest returns one of the user's requests
+func (s *PrivacyService) GetRequest(ctx context.Context, userID, requestID uint) (*models.DataRequest, error) {
+	var request models.DataRequest
+	if err := s.db.WithContext(ctx).Where("id = ? AND user_id = ?", requestID, userID).First(&request).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrDataRequestNotFound
+		}
+		return nil, fmt.Errorf("failed to load data request: %w", err)
+	}
+	return &request, nil
+}
+
+// GetExport returns one of the user's finished exports that can still be downloaded
+func (s *PrivacyService) GetExport(ctx context.Context, userID, requestID uint) (*models.DataRequest, error) {
+	request, err := s.GetRequest(ctx, userID, requestID)
+	if err != nil {
+		return nil, err
+	}
+	if !request.IsDownloadable() {
+		return nil, ErrDataExportUnavailable
+	}
+	if _, err := os.Stat(request.FilePath); err != nil {
+		return nil, ErrDataExportUnavailable
+	}
+	return request, nil
+}
+
+// ProcessExport builds the ZIP archive of everything stored about the user. Requests that
+// are no longer pending are skipped.
+func (s *PrivacyService) ProcessExport(ctx context.Context, requestID uint) error {
+	request, ok, err := s.claim(ctx, requestID, models.DataRequestExport)
+	if err != nil || !ok {
+		return err
+	}
+
+	var user models.User
+	if err := s.db.WithContext(ctx).Unscoped().First(&user, request.UserID).Error; err != nil {
+		return s.fail(ctx, request, fmt.Errorf("failed to load user: %w", err))
+	}
+
+	path, size, err := s.writeExport(ctx, request, &user)
+	if err != nil {
+		return s.fail(ctx, request, err)
+	}
+
+	now := time.Now()
+	expiresAt := now.Add(s.exportTTL)
+	if err := s.db.WithContext(ctx).Model(request).Updates(map[string]interface{}{
+		"status":       models.DataRequestCompleted,
+		"completed_at": now,
+		"file_path":    path,
+		"file_size":    size,
+		"expires_at":   expiresAt,
+		"error":        "",
+	}).Error; err != nil {
+		os.Remove(path)
+		return s.fail(ctx, request, fmt.Errorf("failed to complete data request: %w", err))
+	}
+
+	if s.jobQueue != nil && !user.DeletedAt.Valid {
+		subject, body := DataExportReadyEmail(user.Name, request.ID, s.exportTTL)
+		if _, err := s.jobQueue.EnqueueEmailNotification(EmailNotificationPayload{
+			UserID:   user.ID,
+			Email:    user.Email,
+			Subject:  subject,
+			Body:     body,
+			Template: "data_export_ready",
+			Priority: 1,
+		}, asynq.MaxRetry(5)); err != nil {
+			s.logger.LogError(ctx, err, "Failed to enqueue data export email", zap.Uint("user_id", user.ID))
+		}
+	}
+
+	s.logger.LogBusinessEvent(ctx, "data_export_completed",
+		zap.Uint("user_id", user.ID),
+		zap.Uint("data_request_id", request.ID),
+		zap.Int64("file_size", size),
+	)
+	return nil
+}
+
+// ProcessErasure permanently removes the user's personal data. Credentials, sessions,
+// devices, conversations, sync and notification records are deleted and the user row is
+// anonymized. Subscriptions, payments, orders and the audit log are kept as business
+// records, linked only to the anonymized user ID.
+func (s *PrivacyService) ProcessErasure(ctx context.Context, requestID uint) error {
+	var pending models.DataRequest
+	if err := s.db.WithContext(ctx).First(&pending, requestID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil
+		}
+		return fmt.Errorf("failed to load data request: %w", err)
+	}
+	if pending.Status == models.DataRequestPending && pending.ScheduledFor != nil && time.Now().Before(*pending.ScheduledFor) {
+		return ErrErasureNotDue
+	}
+
+	request, ok, err := s.claim(ctx, requestID, models.DataRequestErasure)
+	if err != nil || !ok {
+		return err
+	}
+	userID := request.UserID
+
+	if err := s.checkErasureAllowed(s.db.WithContext(ctx), userID); err != nil {
+		// Retrying won't help until the user resolves it, so the request ends here
+		s.fail(ctx, request, err)
+		return nil
+	}
+
+	// Revoke first so that no token issued to the account outlives it
+	if err := s.sessions.RevokeAllSessions(ctx, userID, "", models.SessionRevokedAccountErased); err != nil {
+		return s.retry(ctx, request, err)
+	}
+
+	var exportPaths []string
+	err = s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var user models.User
+		if err := tx.Unscoped().First(&user, userID).Error; err != nil {
+			return fmt.Errorf("failed to load user: %w", err)
+		}
+
+		var organizationIDs []uint
+		if err := tx.Model(&models.OrganizationMembership{}).Where("user_id = ?", userID).
+			Pluck("organization_id", &organizationIDs).Error; err != nil {
+			return fmt.Errorf("failed to load memberships: %w", err)
+		}
+
+		deletions := []struct {
+			model interface{}
+			where string
+		}{
+			{&models.Session{}, "user_id = ?"},
+			{&models.PasswordHistory{}, "user_id = ?"},
+			{&models.VerificationToken{}, "user_id = ?"},
+			{&models.UserMFA{}, "user_id = ?"},
+			{&models.MFARecoveryCode{}, "user_id = ?"},
+			{&models.UserIdentity{}, "user_id = ?"},
+			{&models.APIKey{}, "user_id = ?"},
+			{&models.UserRole{}, "user_id = ?"},
+			{&models.OrganizationMembership{}, "user_id = ?"},
+			{&models.PaymentMethod{}, "user_id = ?"},
+			{&models.GeminiConversation{}, "user_id = ?"},
+			{&models.OfflineOperation{}, "user_id = ?"},
+			{&models.SyncConflict{}, "user_id = ?"},
+			{&models.DataVersion{}, "user_id = ?"},
+			{&models.SyncStatus{}, "user_id = ?"},
+			{&models.SyncHistory{}, "user_id = ?"},
+			{&models.DeviceToken{}, "user_id = ?"},
+			{&models.UserDevice{}, "user_id = ?"},
+			{&models.IdempotencyKey{}, "user_id = ?"},
+		}
+		for _, d := range deletions {
+			if err := tx.Unscoped().Where(d.where, userID).Delete(d.model).Error; err != nil {
+				return fmt.Errorf("failed to erase %T: %w", d.model, err)
+			}
+		}
+		for _, table := range notificationTables {
+			if err := tx.Exec("DELETE FROM "+table+" WHERE user_id = ?", userID).Error; err != nil {
+				return fmt.Errorf("failed to erase %s: %w", table, err)
+			}
+		}
+		if err := tx.Unscoped().Where("LOWER(email) = LOWER(?)", user.Email).Delete(&models.OrganizationInvitation{}).Error; err != nil {
+			return fmt.Errorf("failed to erase invitations: %w", err)
+		}
+
+		// Organizations the user leaves empty have no one left to manage them
+		for _, organizationID := range organizationIDs {
+			var members int64
+			if err := tx.Model(&models.OrganizationMembership{}).Where("organization_id = ?", organizationID).Count(&members).Error; err != nil {
+				return fmt.Errorf("failed to count members: %w", err)
+			}
+			if members == 0 {
+				if err := tx.Delete(&models.Organization{}, organizationID).Error; err != nil {
+					return fmt.Errorf("failed to delete organization: %w", err)
+				}
+			}
+		}
+
+		if err := tx.Unscoped().Model(&models.User{}).Where("id = ?", userID).Updates(map[string]interface{}{
+			"email":               fmt.Sprintf("erased-%d@users.invalid", userID),
+			"password":            "",
+			"name":                "",
+			"is_active":           false,
+			"last_login":          nil,
+			"email_verified_at":   nil,
+			"locked_until":        nil,
+			"password_changed_at": nil,
+			"suspension_reason":   "",
+			"guest_device_hash":   nil,
+			"guest_secret_hash":   nil,
+		}).Error; err != nil {
+			return fmt.Errorf("failed to anonymize user: %w", err)
+		}
+		if err := tx.Delete(&models.User{}, userID).Error; err != nil {
+			return fmt.Errorf("failed to delete user: %w", err)
+		}
+
+		if err := tx.Model(&models.DataRequest{}).
+			Where("user_id = ? AND type = ? AND file_path <> ''", userID, models.DataRequestExport).
+			Pluck("file_path", &exportPaths).Error; err != nil {
+			return fmt.Errorf("failed to load exports: %w", err)
+		}
+		if err := tx.Model(&models.DataRequest{}).
+			Where("user_id = ? AND type = ? AND file_path <> ''", userID, models.DataRequestExport).
+			Update("file_path", "").Error; err != nil {
+			return fmt.Errorf("failed to clear exports: %w", err)
+		}
+
+		return tx.Model(request).Updates(map[string]interface{}{
+			"status":       models.DataRequestCompleted,
+			"completed_at": time.Now(),
+			"error":        "",
+		}).Error
+	})
+	if err != nil {
+		return s.retry(ctx, request, err)
+	}
+
+	for _, path := range exportPaths {
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			s.logger.LogError(ctx, err, "Failed to remove data export", zap.Uint("user_id", userID))
+		}
+	}
+
+	s.auditService.Record(ctx, &models.AuditEvent{
+		ActorType:    models.AuditActorSystem,
+		Action:       models.AuditActionAccountErased,
+		ResourceType: "user",
+		ResourceID:   strconv.FormatUint(uint64(userID), 10),
+		Metadata:     models.JSONMap{"data_request_id": request.ID},
+	})
+	s.logger.LogSecurityEvent(ctx, "account_erased", "medium",
+		zap.Uint("user_id", userID),
+		zap.Uint("data_request_id", request.ID),
+	)
+	return nil
+}
+
+// PurgeExpiredExports deletes export archives whose download window has passed
+func (s *PrivacyService) PurgeExpiredExports(ctx context.Context) (int, error) {
+	var expired []models.DataRequest
+	if err := s.db.WithContext(ctx).
+		Where("type = ? AND file_path <> '' AND expires_at < ?", models.DataRequestExport, time.Now()).
+		Find(&expired).Error; err != nil {
+		return 0, fmt.Errorf("failed to load expired exports: %w", err)
+	}
+
+	purged := 0
+	for i := range expired {
+		if err := os.Remove(expired[i].FilePath); err != nil && !os.IsNotExist(err) {
+			s.logger.LogError(ctx, err, "Failed to remove data export", zap.Uint("data_request_id", expired[i].ID))
+			continue
+		}
+		if err := s.db.WithContext(ctx).Model(&expired[i]).Update("file_path", "").Error; err != nil {
+			return purged, fmt.Errorf("failed to update data request: %w", err)
+		}
+		purged++
+	}
+	return purged, nil
+}
+
+func (s *PrivacyService) handleExport(ctx context.Context, t *asynq.Task) error {
+	var payload DataRequestPayload
+	if err := json.Unmarshal(t.Payload(), &payload); err != nil {
+		return fmt.Errorf("failed to unmarshal data request payload: %w", err)
+	}
+	return s.ProcessExport(ctx, payload.RequestID)
+}
+
+func (s *PrivacyService) handleErasure(ctx context.Context, t *asynq.Task) error {
+	var payload DataRequestPayload
+	if err := json.Unmarshal(t.Payload(), &payload); err != nil {
+		return fmt.Errorf("failed to unmarshal data request payload: %w", err)
+	}
+	return s.ProcessErasure(ctx, payload.RequestID)
+}
+
+// claim moves a pending request to processing. It reports false without an error when
+// the request is gone, cancelled or already handled.
+func (s *PrivacyService) claim(ctx context.Context, requestID uint, requestType string) (*models.DataRequest, bool, error) {
+	result := s.db.WithContext(ctx).Model(&models.DataRequest{}).
+		Where("id = ? AND type = ? AND status = ?", requestID, requestType, models.DataRequestPending).
+		Updates(map[string]interface{}{
+			"status":     models.DataRequestProcessing,
+			"started_at": time.Now(),
+		})
+	if result.Error != nil {
+		return nil, false, fmt.Errorf("failed to claim data request: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		s.logger.Debug("Skipping data request that is no longer pending", zap.Uint("data_request_id", requestID))
+		return nil, false, nil
+	}
+
+	var request models.DataRequest
+	if err := s.db.WithContext(ctx).First(&request, requestID).Error; err != nil {
+		return nil, false, fmt.Errorf("failed to load data request: %w", err)
+	}
+	return &request, true, nil
+}
+
+// fail marks the request as failed and returns cause
+func (s *PrivacyService) fail(ctx context.Context, request *models.DataRequest, cause error) error {
+	if err := s.db.WithContext(ctx).Model(request).Updates(map[string]interface{}{
+		"status": models.DataRequestFailed,
+		"error":  cause.Error(),
+	}).Error; err != nil {
+		s.logger.LogError(ctx, err, "Failed to update data request", zap.Uint("data_request_id", request.ID))
+	}
+	s.logger.LogError(ctx, cause, "Data request failed", zap.Uint("data_request_id", request.ID), zap.String("type", request.Type))
+	return cause
+}
+
+// retry puts the request back to pending so the job can run again, and returns cause
+func (s *PrivacyService) retry(ctx context.Context, request *models.DataRequest, cause error) error {
+	if err := s.db.WithContext(ctx).Model(request).Updates(map[string]interface{}{
+		"status": models.DataRequestPending,
+		"error":  cause.Error(),
+	}).Error; err != nil {
+		s.logger.LogError(ctx, err, "Failed to update data request", zap.Uint("data_request_id", request.ID))
+	}
+	s.logger.LogError(ctx, cause, "Data request will be retried", zap.Uint("data_request_id", request.ID), zap.String("type", request.Type))
+	return cause
+}
+
+func (s *PrivacyService) checkErasureAllowed(db *gorm.DB, userID uint) error {
+	var activeSubscriptions int64
+	if err := db.Model(&models.Subscription{}).
+		Where("user_id = ? AND status IN ?", userID, []string{"active", "trialing", "past_due"}).
+		Count(&activeSubscriptions).Error; err != nil {
+		return fmt.Errorf("failed to load subscriptions: %w", err)
+	}
+	if activeSubscriptions > 0 {
+		return fmt.Errorf("%w: cancel your active subscription first", ErrErasureBlocked)
+	}
+
+	var owned []models.OrganizationMembership
+	if err := db.Preload("Organization").
+		Where("user_id = ? AND role = ?", userID, models.OrganizationRoleOwner).
+		Find(&owned).Error; err != nil {
+		return fmt.Errorf("failed to load memberships: %w", err)
+	}
+	for _, membership := range owned {
+		var owners, members int64
+		if err := db.Model(&models.OrganizationMembership{}).
+			Where("organization_id = ? AND role = ?", membership.OrganizationID, models.OrganizationRoleOwner).
+			Count(&owners).Error; err != nil {
+			return fmt.Errorf("failed to count owners: %w", err)
+		}
+		if err := db.Model(&models.OrganizationMembership{}).
+			Where("organization_id = ?", membership.OrganizationID).
+			Count(&members).Error; err != nil {
+			return fmt.Errorf("failed to count members: %w", err)
+		}
+		if owners == 1 && members > 1 {
+			name := ""
+			if membership.Organization != nil {
+				name = membership.Organization.Name
+			}
+			return fmt.Errorf("%w: transfer ownership of organization %q first", ErrErasureBlocked, name)
+		}
+	}
+	return nil
+}
+
+// writeExport writes the archive for the request and returns its path and size
+func (s *PrivacyService) writeExport(ctx context.Context, request *models.DataRequest, user *models.User) (string, int64, error) {
+	if err := os.MkdirAll(s.exportDir, 0o700); err != nil {
+		return "", 0, fmt.Errorf("failed to create export directory: %w", err)
+	}
+	suffix, err := utils.GenerateRandomString(8)
+	if err != nil {
+		return "", 0, fmt.Errorf("failed to generate export name: %w", err)
+	}
+	path := filepath.Join(s.exportDir, fmt.Sprintf("user-%d-export-%d-%s.zip", user.ID, request.ID, suffix))
+
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o600)
+	if err != nil {
+		return "", 0, fmt.Errorf("failed to create export file: %w", err)
+	}
+
+	if err := s.writeArchive(ctx, zip.NewWriter(file), user); err != nil {
+		file.Close()
+		os.Remove(path)
+		return "", 0, err
+	}
+	info, err := file.Stat()
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(path)
+		return "", 0, fmt.Errorf("failed to write export file: %w", err)
+	}
+	return path, info.Size(), nil
+}
+
+func (s *PrivacyService) writeArchive(ctx context.Context, archive *zip.Writer, user *models.User) error {
+	// A new session so each dataset starts from a clean query. The user's orders are
+	// exported from every organization.
+	db := s.db.WithContext(models.WithoutTenantScope(ctx)).Unscoped().Session(&gorm.Session{})
+
+	datasets := []struct {
+		name  string
+		dest  interface{}
+		where string
+		arg   interface{}
+	}{
+		{"sessions", &[]models.Session{}, "user_id = ?", user.ID},
+		{"linked_accounts", &[]models.UserIdentity{}, "user_id = ?", user.ID},
+		{"api_keys", &[]models.APIKey{}, "user_id = ?", user.ID},
+		{"roles", &[]models.UserRole{}, "user_id = ?", user.ID},
+		{"mfa", &[]models.UserMFA{}, "user_id = ?", user.ID},
+		{"mfa_recovery_codes", &[]models.MFARecoveryCode{}, "user_id = ?", user.ID},
+		{"organization_memberships", &[]models.OrganizationMembership{}, "user_id = ?", user.ID},
+		{"organization_invitations", &[]models.OrganizationInvitation{}, "LOWER(email) = LOWER(?)", user.Email},
+		{"subscriptions", &[]models.Subscription{}, "user_id = ?", user.ID},
+		{"payments", &[]models.Payment{}, "user_id = ?", user.ID},
+		{"payment_methods", &[]models.PaymentMethod{}, "user_id = ?", user.ID},
+		{"orders", &[]models.Order{}, "customer_id = ?", user.ID},
+		{"gemini_conversations", &[]models.GeminiConversation{}, "user_id = ?", user.ID},
+		{"offline_operations", &[]models.OfflineOperation{}, "user_id = ?", user.ID},
+		{"sync_conflicts", &[]models.SyncConflict{}, "user_id = ?", user.ID},
+		{"data_versions", &[]models.DataVersion{}, "user_id = ?", user.ID},
+		{"sync_status", &[]models.SyncStatus{}, "user_id = ?", user.ID},
+		{"sync_history", &[]models.SyncHistory{}, "user_id = ?", user.ID},
+		{"device_tokens", &[]models.DeviceToken{}, "user_id = ?", user.ID},
+		{"devices", &[]models.UserDevice{}, "user_id = ?", user.ID},
+		{notificationTables[0], &[]map[string]interface{}{}, "user_id = ?", user.ID},
+		{notificationTables[1], &[]map[string]interface{}{}, "user_id = ?", user.ID},
+		{"audit_events", &[]models.AuditEvent{}, "actor_id = ?", user.ID},
+		{"data_requests", &[]models.DataRequest{}, "user_id = ?", user.ID},
+	}
+
+	counts := map[string]int{"profile": 1}
+	if err := writeArchiveJSON(archive, "profile.json", user); err != nil {
+		return err
+	}
+	for _, dataset := range datasets {
+		query := db
+		if _, ok := dataset.dest.(*[]map[string]interface{}); ok {
+			query = db.Table(dataset.name)
+		}
+		if err := query.Where(dataset.where, dataset.arg).Order("created_at").Find(dataset.dest).Error; err != nil {
+			return fmt.Errorf("failed to load %s: %w", dataset.name, err)
+		}
+		rows, err := exportRows(dataset.dest)
+		if err != nil {
+			return fmt.Errorf("failed to encode %s: %w", dataset.name, err)
+		}
+		if err := writeArchiveJSON(archive, dataset.name+".json", rows); err != nil {
+			return err
+		}
+		counts[dataset.name] = len(rows)
+	}
+
+	manifest := map[string]interface{}{
+		"user_id":      user.ID,
+		"generated_at": time.Now().UTC(),
+		"records":      counts,
+	}
+	if err := writeArchiveJSON(archive, "manifest.json", manifest); err != nil {
+		return err
+	}
+	if err := archive.Close(); err != nil {
+		return fmt.Errorf("failed to write export archive: %w", err)
+	}
+	return nil
+}
+
+// exportRows converts loaded models to plain JSON objects without their empty associations
+func exportRows(dest interface{}) ([]map[string]interface{}, error) {
+	data, err := json.Marshal(dest)
+	if err != nil {
+		return nil, err
+	}
+	rows := []map[string]interface{}{}
+	if err := json.Unmarshal(data, &rows); err != nil {
+		return nil, err
+	}
+	for _, row := range rows {
+		for _, key := range exportRelationKeys {
+			delete(row, key)
+		}
+	}
+	return rows, nil
+}
+
+func writeArchiveJSON(archive *zip.Writer, name string, v interface{}) error {
+	w, err := archive.Create(name)
+	if err != nil {
+		return fmt.Errorf("failed to add %s to export: %w", name, err)
+	}
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(v); err != nil {
+		return fmt.Errorf("failed to write %s to export: %w", name, err)
+	}
+	return nil
+}
+
+func dataRequestTaskID(request *models.DataRequest) string {
+	return fmt.Sprintf("privacy:%s:%d", request.Type, request.ID)
+}
@@ -15,6 +15,9 @@ type ProductSyncService struct {
 }
 
 func NewProductSyncService(db *gorm.DB) *ProductSyncService {
+	// Products are the global billing catalog, shared by every organization
+	db = models.AcrossTenants(db)
+
 	return &ProductSyncService{
 		db: db,
 	}
@@ -207,7 +207,7 @@ func (pns *PushNotificationService) CreateSegment(ctx context.Context, segment *
 		pns.logger.Warn("Failed to update segment user count", zap.Error(err))
 	}
 
-	if err := pns.db.Create(segment).Error; err != nil {
+	if err := pns.db.WithContext(ctx).Create(segment).Error; err != nil {
 		return fmt.Errorf("failed to create segment: %w", err)
 	}
 
@@ -0,0 +1,495 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"mobile-backend/models"
+	"mobile-backend/utils"
+
+	"github.com/hibiken/asynq"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	ErrPaymentNotFound      = errors.New("payment not found")
+	ErrPaymentNotRefundable = errors.New("payment can't be refunded")
+	ErrInvalidRefundAmount  = errors.New("invalid refund amount")
+	ErrStoreRefund          = errors.New("store purchases are refunded by the store")
+)
+
+// RefundRequest describes a refund issued by an admin
+type RefundRequest struct {
+	// Amount in cents; 0 refunds everything not refunded yet
+	Amount int64
+	Reason string
+	// RevokeAccess downgrades the user from pro once the refund goes through
+	RevokeAccess bool
+	RequestedBy  uint
+}
+
+// ProviderRefund is a refund as reported by a payment provider's webhook
+type ProviderRefund struct {
+	ID string
+	// RefundID is our Refund's ID for refunds issued through RefundPayment, taken from the
+	// metadata the refund was created with
+	RefundID uint
+	Amount   int64
+	Currency string
+	Status   string
+	Reason   string
+}
+
+// ProviderDispute is a dispute as reported by a payment provider's webhook
+type ProviderDispute struct {
+	ID            string
+	Amount        int64
+	Currency      string
+	Status        string
+	Reason        string
+	EvidenceDueBy *time.Time
+}
+
+// RefundService issues refunds through the payment providers and records the refunds
+// and disputes they report. Users are told by email and push when a payment is refunded
+// or disputed, and lose pro access when a refund asks for it or, unless
+// DISPUTE_REVOKES_PRO_ACCESS is false, while a chargeback is open.
+type RefundService struct {
+	db                        *gorm.DB
+	providers                 *PaymentProviderRegistry
+	subscriptionStatusService *SubscriptionStatusService
+	jobQueue                  *JobQueueService
+	push                      *PushNotificationService
+	revokeOnDispute           bool
+	logger                    *zap.Logger
+}
+
+// NewRefundService creates a new refund service. jobQueue and push may be nil to skip
+// the email or push notifications.
+func NewRefundService(db *gorm.DB, providers *PaymentProviderRegistry, subscriptionStatusService *SubscriptionStatusService, jobQueue *JobQueueService, push *PushNotificationService, logger *zap.Logger) *RefundService {
+	return &RefundService{
+		db:                        db,
+		providers:                 providers,
+		subscriptionStatusService: subscriptionStatusService,
+		jobQueue:                  jobQueue,
+		push:                      push,
+		revokeOnDispute:           utils.ParseBool(os.Getenv("DISPUTE_REVOKES_PRO_ACCESS"), true),
+		logger:                    logger,
+	}
+}
+
+// RefundPayment refunds all or part of a payment through its provider. Refunds that the
+// provider settles later are recorded as pending and completed by its webhook.
+func (s *RefundService) RefundPayment(ctx context.Context, paymentID uint, req RefundRequest) (*models.Refund, error) {
+	var payment models.Payment
+	var provider PaymentProvider
+	refund := &models.Refund{}
+	// The payment stays locked from summing its refunds until the new one is recorded, so
+	// concurrent refunds can't together reserve more than was paid
+	err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&payment, paymentID).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return ErrPaymentNotFound
+			}
+			return fmt.Errorf("failed to load payment: %w", err)
+		}
+
+		if IsStorePaymentMethod(payment.PaymentMethod) {
+			return ErrStoreRefund
+		}
+		switch payment.Status {
+		case "succeeded", "partially_refunded", "disputed":
+		default:
+			return fmt.Errorf("%w: payment is %s", ErrPaymentNotRefundable, payment.Status)
+		}
+
+		// Pending refunds hold their amount until they settle
+		var reserved int64
+		if err := tx.Model(&models.Refund{}).
+			Where("payment_id = ? AND status IN ?", payment.ID, []string{models.RefundStatusPending, models.RefundStatusSucceeded}).
+			Select("COALESCE(SUM(amount), 0)").Scan(&reserved).Error; err != nil {
+			return fmt.Errorf("failed to sum refunds: %w", err)
+		}
+		refundable := payment.Amount - reserved
+
+		amount := req.Amount
+		if amount == 0 {
+			amount = refundable
+		}
+		if amount <= 0 || amount > refundable {
+			return fmt.Errorf("%w: %d of %d %s can be refunded", ErrInvalidRefundAmount, refundable, payment.Amount, payment.Currency)
+		}
+
+		var err error
+		provider, err = s.providers.Get(payment.PaymentMethod)
+		if err != nil {
+			return err
+		}
+
+		requestedBy := req.RequestedBy
+		*refund = models.Refund{
+			PaymentID:     payment.ID,
+			UserID:        payment.UserID,
+			Amount:        amount,
+			Currency:      payment.Currency,
+			Status:        models.RefundStatusPending,
+			Reason:        req.Reason,
+			PaymentMethod: payment.PaymentMethod,
+			RequestedBy:   &requestedBy,
+			RevokeAccess:  req.RevokeAccess,
+		}
+		if err := tx.Create(refund).Error; err != nil {
+			return fmt.Errorf("failed to create refund record: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if err := provider.RefundPayment(ctx, &payment, refund); err != nil {
+		s.db.WithContext(ctx).Model(refund).Update("status", models.RefundStatusFailed)
+		return nil, fmt.Errorf("failed to refund payment at %s: %w", provider.Name(), err)
+	}
+
+	if err := s.db.WithContext(ctx).Model(refund).Updates(map[string]interface{}{
+		"status":             refund.Status,
+		"provider_refund_id": refund.ProviderRefundID,
+	}).Error; err != nil {
+		return nil, fmt.Errorf("failed to update refund record: %w", err)
+	}
+
+	if refund.Status == models.RefundStatusSucceeded {
+		if err := s.settleRefund(ctx, &payment, refund); err != nil {
+			return nil, err
+		}
+	}
+	return refund, nil
+}
+
+// RecordRefund records a refund reported by payment's provider. Refunds issued through
+// RefundPayment are matched by ID and completed; refunds made in the provider's
+// dashboard are added.
+func (s *RefundService) RecordRefund(ctx context.Context, payment *models.Payment, reported ProviderRefund) error {
+	var refund models.Refund
+	query := s.db.WithContext(ctx).Where("payment_id = ?", payment.ID)
+	if reported.RefundID != 0 {
+		query = query.Where("id = ? OR provider_refund_id = ?", reported.RefundID, reported.ID)
+	} else {
+		query = query.Where("provider_refund_id = ?", reported.ID)
+	}
+	err := query.First(&refund).Error
+
+	previousStatus := ""
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		refund = models.Refund{
+			PaymentID:        payment.ID,
+			UserID:           payment.UserID,
+			Amount:           reported.Amount,
+			Currency:         reported.Currency,
+			Status:           reported.Status,
+			Reason:           reported.Reason,
+			PaymentMethod:    payment.PaymentMethod,
+			ProviderRefundID: reported.ID,
+		}
+		if refund.Currency == "" {
+			refund.Currency = payment.Currency
+		}
+		if err := s.db.WithContext(ctx).Create(&refund).Error; err != nil {
+			return fmt.Errorf("failed to create refund record: %w", err)
+		}
+	case err != nil:
+		return fmt.Errorf("failed to load refund: %w", err)
+	default:
+		previousStatus = refund.Status
+		refund.Status = reported.Status
+		refund.ProviderRefundID = reported.ID
+		if err := s.db.WithContext(ctx).Model(&refund).Updates(map[string]interface{}{
+			"status":             refund.Status,
+			"provider_refund_id": refund.ProviderRefundID,
+		}).Error; err != nil {
+			return fmt.Errorf("failed to update refund record: %w", err)
+		}
+	}
+
+	if refund.Status == models.RefundStatusSucceeded && previousStatus != models.RefundStatusSucceeded {
+		return s.settleRefund(ctx, payment, &refund)
+	}
+	if previousStatus == models.RefundStatusSucceeded {
+		// A refund the provider reverses no longer counts against the payment
+		return s.updatePaymentStatus(ctx, payment)
+	}
+	return nil
+}
+
+// RecordDispute records a dispute opened or updated at payment's provider. While a
+// chargeback is open the payment is marked disputed and, if configured, the user loses
+// pro access until the dispute is won.
+func (s *RefundService) RecordDispute(ctx context.Context, payment *models.Payment, reported ProviderDispute) error {
+	var dispute models.Dispute
+	err := s.db.WithContext(ctx).
+		Where("payment_method = ? AND provider_dispute_id = ?", payment.PaymentMethod, reported.ID).
+		First(&dispute).Error
+
+	var wasWithdrawn, wasClosed bool
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		dispute = models.Dispute{
+			PaymentID:         payment.ID,
+			UserID:            payment.UserID,
+			Amount:            reported.Amount,
+			Currency:          reported.Currency,
+			PaymentMethod:     payment.PaymentMethod,
+			ProviderDisputeID: reported.ID,
+		}
+		if dispute.Currency == "" {
+			dispute.Currency = payment.Currency
+		}
+	case err != nil:
+		return fmt.Errorf("failed to load dispute: %w", err)
+	default:
+		wasWithdrawn = dispute.IsWithdrawn()
+		wasClosed = dispute.IsClosed()
+	}
+
+	dispute.Status = reported.Status
+	dispute.Reason = reported.Reason
+	dispute.EvidenceDueBy = reported.EvidenceDueBy
+	if dispute.IsClosed() && !wasClosed {
+		now := time.Now()
+		dispute.ClosedAt = &now
+	}
+
+	opened := dispute.IsWithdrawn() && !wasWithdrawn && !dispute.IsClosed()
+	if opened && s.revokeOnDispute && !dispute.AccessRevoked {
+		if err := s.revokeAccess(ctx, payment.UserID, "dispute"); err != nil {
+			return err
+		}
+		dispute.AccessRevoked = true
+	}
+	// Won disputes, and inquiries that closed without a chargeback, give access back
+	restored := dispute.AccessRevoked && (dispute.Status == models.DisputeStatusWon || dispute.Status == models.DisputeStatusWarningClosed)
+	if restored {
+		dispute.AccessRevoked = false
+	}
+
+	if err := s.db.WithContext(ctx).Save(&dispute).Error; err != nil {
+		return fmt.Errorf("failed to save dispute: %w", err)
+	}
+
+	if err := s.updatePaymentStatus(ctx, payment); err != nil {
+		return err
+	}
+	if restored {
+		if err := s.restoreAccess(ctx, payment); err != nil {
+			return err
+		}
+	}
+	if opened {
+		s.notifyDispute(ctx, payment, &dispute)
+	}
+	return nil
+}
+
+// ListRefunds returns a payment's refunds, newest first
+func (s *RefundService) ListRefunds(ctx context.Context, paymentID uint) ([]models.Refund, error) {
+	var payment models.Payment
+	if err := s.db.WithContext(ctx).Select("id").First(&payment, paymentID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrPaymentNotFound
+		}
+		return nil, fmt.Errorf("failed to load payment: %w", err)
+	}
+
+	var refunds []models.Refund
+	if err := s.db.WithContext(ctx).Where("payment_id = ?", paymentID).Order("created_at DESC").Find(&refunds).Error; err != nil {
+		return nil, fmt.Errorf("failed to list refunds: %w", err)
+	}
+	return refunds, nil
+}
+
+// ListDisputes returns disputes, newest first. open limits the list to undecided
+// disputes when true and to decided ones when false.
+func (s *RefundService) ListDisputes(ctx context.Context, open *bool, page, limit int) ([]models.Dispute, int64, error) {
+	query := s.db.WithContext(ctx).Model(&models.Dispute{})
+	if open != nil {
+		if *open {
+			query = query.Where("closed_at IS NULL")
+		} else {
+			query = query.Where("closed_at IS NOT NULL")
+		}
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, fmt.Errorf("failed to count disputes: %w", err)
+	}
+
+	var disputes []models.Dispute
+	if err := query.Order("created_at DESC").Offset((page - 1) * limit).Limit(limit).Find(&disputes).Error; err != nil {
+		return nil, 0, fmt.Errorf("failed to list disputes: %w", err)
+	}
+	return disputes, total, nil
+}
+
+// settleRefund updates the payment for a refund that went through, revokes access if the
+// refund asked for it and tells the user
+func (s *RefundService) settleRefund(ctx context.Context, payment *models.Payment, refund *models.Refund) error {
+	if err := s.updatePaymentStatus(ctx, payment); err != nil {
+		return err
+	}
+	if refund.RevokeAccess {
+		if err := s.revokeAccess(ctx, payment.UserID, "refund"); err != nil {
+			return err
+		}
+	}
+	s.notifyRefund(ctx, payment, refund)
+	return nil
+}
+
+// updatePaymentStatus derives the payment's refunded amount and status from its refunds
+// and disputes
+func (s *RefundService) updatePaymentStatus(ctx context.Context, payment *models.Payment) error {
+	var refunded int64
+	if err := s.db.WithContext(ctx).Model(&models.Refund{}).
+		Where("payment_id = ? AND status = ?", payment.ID, models.RefundStatusSucceeded).
+		Select("COALESCE(SUM(amount), 0)").Scan(&refunded).Error; err != nil {
+		return fmt.Errorf("failed to sum refunds: %w", err)
+	}
+
+	var disputes []models.Dispute
+	if err := s.db.WithContext(ctx).Where("payment_id = ?", payment.ID).Find(&disputes).Error; err != nil {
+		return fmt.Errorf("failed to load disputes: %w", err)
+	}
+	disputed := false
+	for i := range disputes {
+		if disputes[i].IsWithdrawn() {
+			disputed = true
+		}
+	}
+
+	status := "succeeded"
+	switch {
+	case refunded >= payment.Amount:
+		status = "refunded"
+	case disputed:
+		status = "disputed"
+	case refunded > 0:
+		status = "partially_refunded"
+	}
+
+	updates := map[string]interface{}{
+		"status":          status,
+		"refunded_amount": refunded,
+	}
+	if refunded > 0 && refunded != payment.RefundedAmount {
+		updates["refunded_at"] = time.Now()
+	}
+	if err := s.db.WithContext(ctx).Model(payment).Updates(updates).Error; err != nil {
+		return fmt.Errorf("failed to update payment: %w", err)
+	}
+	return nil
+}
+
+func (s *RefundService) revokeAccess(ctx context.Context, userID uint, reason string) error {
+	if s.subscriptionStatusService == nil {
+		return nil
+	}
+	if err := s.subscriptionStatusService.DowngradeUserFromPro(ctx, userID, reason); err != nil {
+		return fmt.Errorf("failed to revoke pro access: %w", err)
+	}
+	return nil
+}
+
+// restoreAccess gives a user back the access of the subscription the payment was for
+func (s *RefundService) restoreAccess(ctx context.Context, payment *models.Payment) error {
+	if s.subscriptionStatusService == nil || payment.SubscriptionID == nil {
+		return nil
+	}
+
+	var subscription models.Subscription
+	if err := s.db.WithContext(ctx).First(&subscription, *payment.SubscriptionID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil
+		}
+		return fmt.Errorf("failed to load subscription: %w", err)
+	}
+	if err := s.subscriptionStatusService.UpdateUserSubscriptionStatus(ctx, payment.UserID, &subscription); err != nil {
+		return fmt.Errorf("failed to restore pro access: %w", err)
+	}
+	return nil
+}
+
+func (s *RefundService) notifyRefund(ctx context.Context, payment *models.Payment, refund *models.Refund) {
+	amount := formatAmount(refund.Amount, refund.Currency)
+	description := payment.Description
+	if description == "" {
+		description = "your purchase"
+	}
+	s.notify(ctx, payment.UserID, "refund_issued",
+		func(name string) (string, string) { return RefundIssuedEmail(name, amount, description) },
+		"Refund issued", fmt.Sprintf("We've refunded %s to your original payment method.", amount),
+		models.JSONMap{"type": "refund_issued", "payment_id": payment.ID, "refund_id": refund.ID})
+}
+
+func (s *RefundService) notifyDispute(ctx context.Context, payment *models.Payment, dispute *models.Dispute) {
+	amount := formatAmount(dispute.Amount, dispute.Currency)
+	body := fmt.Sprintf("Your bank told us you disputed a payment of %s.", amount)
+	if dispute.AccessRevoked {
+		body += " Pro access is paused until it's resolved."
+	}
+	s.notify(ctx, payment.UserID, "dispute_opened",
+		func(name string) (string, string) { return DisputeOpenedEmail(name, amount, dispute.AccessRevoked) },
+		"Payment disputed", body,
+		models.JSONMap{"type": "dispute_opened", "payment_id": payment.ID, "dispute_id": dispute.ID})
+}
+
+// notify emails and pushes a billing notification to a user. Failures are logged; they
+// never undo the refund or dispute being recorded.
+func (s *RefundService) notify(ctx context.Context, userID uint, template string, email func(name string) (string, string), title, body string, data models.JSONMap) {
+	var user models.User
+	if err := s.db.WithContext(ctx).First(&user, userID).Error; err != nil {
+		s.logger.Error("Failed to load user for billing notification", zap.Uint("user_id", userID), zap.Error(err))
+		return
+	}
+	// Guests have no real email address
+	if s.jobQueue != nil && !user.IsGuest {
+		subject, content := email(user.Name)
+		if _, err := s.jobQueue.EnqueueEmailNotification(EmailNotificationPayload{
+			UserID:   user.ID,
+			Email:    user.Email,
+			Subject:  subject,
+			Body:     content,
+			Template: template,
+			Priority: 1,
+		}, asynq.MaxRetry(5)); err != nil {
+			s.logger.Error("Failed to enqueue billing email", zap.Uint("user_id", user.ID), zap.String("template", template), zap.Error(err))
+		}
+	}
+
+	if s.push != nil {
+		notification := &models.PushNotification{
+			Title:    title,
+			Body:     body,
+			Data:     data,
+			Target:   models.NotificationTarget{Type: models.TargetTypeUser, UserIDs: []uint{user.ID}},
+			Priority: "high",
+			UserID:   &user.ID,
+		}
+		if err := s.push.SendNotification(ctx, notification); err != nil {
+			s.logger.Error("Failed to send billing push", zap.Uint("user_id", user.ID), zap.String("template", template), zap.Error(err))
+		}
+	}
+}
+
+// formatAmount formats an amount in cents for people, e.g. "12.50 USD"
+func formatAmount(amount int64, currency string) string {
+	return fmt.Sprintf("%.2f %s", float64(amount)/100, strings.ToUpper(currency))
+}
@@ -0,0 +1,146 @@
+package services
+
+import (
+	"context"
+	"crypto/hmac"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"mobile-backend/config"
+	"mobile-backend/utils"
+
+	"github.com/go-redis/redis/v8"
+	"go.uber.org/zap"
+)
+
+// Request signing headers sent by mobile clients
+const (
+	SigningClientIDHeader  = "X-Client-ID"
+	SigningTimestampHeader = "X-Timestamp"
+	SigningNonceHeader     = "X-Nonce"
+	SignatureHeader        = "X-Signature"
+)
+
+// Request signing modes. In optional mode unsigned requests are let through, but a
+// request that carries a signature must verify.
+const (
+	RequestSigningOff      = "off"
+	RequestSigningOptional = "optional"
+	RequestSigningRequired = "required"
+)
+
+// RequestSigningService verifies HMAC signatures on requests from mobile clients. Each
+// client build has its own secret; a signature covers the method, path, timestamp, a
+// client chosen nonce and the body hash, and each nonce is remembered in Redis so a
+// captured request can't be replayed within the window.
+type RequestSigningService struct {
+	redis   *redis.Client
+	logger  *config.Logger
+	mode    string
+	secrets map[string]string // client ID -> secret
+	window  time.Duration
+}
+
+// NewRequestSigningService creates a new request signing service configured from the
+// environment. REQUEST_SIGNING_SECRETS lists client_id:secret pairs separated by commas.
+func NewRequestSigningService(redis *redis.Client, logger *config.Logger) (*RequestSigningService, error) {
+	mode := strings.ToLower(getEnvOrDefault("REQUEST_SIGNING_MODE", RequestSigningOff))
+	switch mode {
+	case RequestSigningOff, RequestSigningOptional, RequestSigningRequired:
+	default:
+		return nil, fmt.Errorf("invalid REQUEST_SIGNING_MODE %q", mode)
+	}
+
+	window, err := time.ParseDuration(getEnvOrDefault("REQUEST_SIGNING_WINDOW", "5m"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid REQUEST_SIGNING_WINDOW: %w", err)
+	}
+	if window <= 0 {
+		return nil, fmt.Errorf("invalid REQUEST_SIGNING_WINDOW: must be positive")
+	}
+
+	secrets := make(map[string]string)
+	for _, pair := range strings.Split(os.Getenv("REQUEST_SIGNING_SECRETS"), ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		clientID, secret, ok := strings.Cut(pair, ":")
+		if !ok || clientID == "" || len(secret) < 32 {
+			return nil, fmt.Errorf("invalid REQUEST_SIGNING_SECRETS: each entry must be client_id:secret with a secret of at least 32 characters")
+		}
+		secrets[clientID] = secret
+	}
+	if mode != RequestSigningOff && len(secrets) == 0 {
+		return nil, fmt.Errorf("REQUEST_SIGNING_SECRETS is required when REQUEST_SIGNING_MODE is %s", mode)
+	}
+
+	return &RequestSigningService{
+		redis:   redis,
+		logger:  logger,
+		mode:    mode,
+		secrets: secrets,
+		window:  window,
+	}, nil
+}
+
+// Enabled reports whether signatures are checked at all
+func (s *RequestSigningService) Enabled() bool {
+	return s.mode != RequestSigningOff
+}
+
+// VerifyRequest checks the signature headers of r against body and returns the ID of the
+// client that signed it. In optional mode an unsigned request returns an empty client ID.
+func (s *RequestSigningService) VerifyRequest(ctx context.Context, r *http.Request, body []byte) (string, error) {
+	if !s.Enabled() {
+		return "", nil
+	}
+
+	clientID := r.Header.Get(SigningClientIDHeader)
+	timestamp := r.Header.Get(SigningTimestampHeader)
+	nonce := r.Header.Get(SigningNonceHeader)
+	signature := r.Header.Get(SignatureHeader)
+	if signature == "" && s.mode == RequestSigningOptional {
+		return "", nil
+	}
+	if clientID == "" || timestamp == "" || nonce == "" || signature == "" {
+		return "", utils.ErrRequestSignatureMissing
+	}
+	if len(nonce) < 16 || len(nonce) > 128 {
+		return "", fmt.Errorf("%w: nonce must be between 16 and 128 characters", utils.ErrInvalidRequestSignature)
+	}
+
+	secret, ok := s.secrets[clientID]
+	if !ok {
+		return "", utils.ErrUnknownSigningClient
+	}
+
+	unix, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return "", fmt.Errorf("%w: timestamp must be Unix seconds", utils.ErrInvalidRequestSignature)
+	}
+	if skew := time.Since(time.Unix(unix, 0)); skew > s.window || skew < -s.window {
+		return "", utils.ErrRequestSignatureExpired
+	}
+
+	expected := utils.SignRequest(secret, utils.RequestSigningPayload(r.Method, r.URL.RequestURI(), timestamp, nonce, body))
+	if !hmac.Equal([]byte(strings.ToLower(signature)), []byte(expected)) {
+		return "", utils.ErrInvalidRequestSignature
+	}
+
+	// Only verified requests claim their nonce, so forged requests can't burn a client's
+	// nonces. The nonce outlives the window on both sides of the server clock.
+	claimed, err := s.redis.SetNX(ctx, "request_nonce:"+clientID+":"+nonce, timestamp, 2*s.window).Result()
+	if err != nil {
+		return "", fmt.Errorf("failed to record request nonce: %w", err)
+	}
+	if !claimed {
+		s.logger.LogSecurityEvent(ctx, "request_replayed", "medium", zap.String("client_id", clientID), zap.String("path", r.URL.Path))
+		return "", utils.ErrRequestReplayed
+	}
+	return clientID, nil
+}
@@ -0,0 +1,203 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+
+	"mobile-backend/models"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	ErrRoleNotFound        = errors.New("role not found")
+	ErrRoleAlreadyAssigned = errors.New("role already assigned")
+	ErrRoleNotAssigned     = errors.New("role not assigned")
+)
+
+// RoleService manages roles, permissions and user-role assignments
+type RoleService struct {
+	db *gorm.DB
+}
+
+// NewRoleService creates a new role service
+func NewRoleService(db *gorm.DB) *RoleService {
+	return &RoleService{db: db}
+}
+
+// EnsureDefaultRoles creates the built-in roles and permissions if they don't exist yet.
+// It is safe to call on every startup.
+func (s *RoleService) EnsureDefaultRoles(ctx context.Context) error {
+	return s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		permissions := make(map[string]*models.Permission)
+		for _, names := range models.DefaultRolePermissions {
+			for _, name := range names {
+				if _, ok := permissions[name]; ok {
+					continue
+				}
+				permission := models.Permission{Name: name}
+				if err := tx.Where(models.Permission{Name: name}).FirstOrCreate(&permission).Error; err != nil {
+					return fmt.Errorf("failed to ensure permission %s: %w", name, err)
+				}
+				permissions[name] = &permission
+			}
+		}
+
+		roles := map[string]string{
+			models.RoleSuperAdmin: "Full access to every resource",
+			models.RoleAdmin:      "Operational access to admin endpoints",
+			models.RoleStaff:      "Read-only access for support staff",
+		}
+		for name, description := range roles {
+			role := models.Role{Name: name, Description: description, IsSystem: true}
+			if err := tx.Where(models.Role{Name: name}).FirstOrCreate(&role).Error; err != nil {
+				return fmt.Errorf("failed to ensure role %s: %w", name, err)
+			}
+
+			var rolePermissions []models.Permission
+			for _, permissionName := range models.DefaultRolePermissions[name] {
+				rolePermissions = append(rolePermissions, *permissions[permissionName])
+			}
+			if len(rolePermissions) == 0 {
+				continue
+			}
+			if err := tx.Model(&role).Association("Permissions").Append(rolePermissions); err != nil {
+				return fmt.Errorf("failed to attach permissions to role %s: %w", name, err)
+			}
+		}
+
+		return nil
+	})
+}
+
+// BootstrapSuperAdmin grants the superadmin role to the user with the given email.
+// It is a no-op if the user already holds the role.
+func (s *RoleService) BootstrapSuperAdmin(ctx context.Context, email string) error {
+	var user models.User
+	if err := s.db.WithContext(ctx).Where("email = ?", email).First(&user).Error; err != nil {
+		return fmt.Errorf("user not found: %w", err)
+	}
+
+	if err := s.AssignRole(ctx, user.ID, models.RoleSuperAdmin, nil); err != nil && !errors.Is(err, ErrRoleAlreadyAssigned) {
+		return err
+	}
+	return nil
+}
+
+// ListRoles returns all roles with their permissions
+func (s *RoleService) ListRoles(ctx context.Context) ([]models.Role, error) {
+	var roles []models.Role
+	if err := s.db.WithContext(ctx).Preload("Permissions").Order("name ASC").Find(&roles).Error; err != nil {
+		return nil, fmt.Errorf("failed to list roles: %w", err)
+	}
+	return roles, nil
+}
+
+// GetUserRoles returns the roles assigned to a user, with permissions preloaded
+func (s *RoleService) GetUserRoles(ctx context.Context, userID uint) ([]models.Role, error) {
+	var roles []models.Role
+	err := s.db.WithContext(ctx).
+		Preload("Permissions").
+		Joins("JOIN user_roles ON user_roles.role_id = roles.id").
+		Where("user_roles.user_id = ?", userID).
+		Order("roles.name ASC").
+		Find(&roles).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to get user roles: %w", err)
+	}
+	return roles, nil
+}
+
+// GetUserAuthorization returns the role and permission names held by a user,
+// suitable for embedding in token claims
+func (s *RoleService) GetUserAuthorization(ctx context.Context, userID uint) ([]string, []string, error) {
+	roles, err := s.GetUserRoles(ctx, userID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	roleNames := make([]string, 0, len(roles))
+	permissionSet := make(map[string]struct{})
+	for _, role := range roles {
+		roleNames = append(roleNames, role.Name)
+		for _, permission := range role.Permissions {
+			permissionSet[permission.Name] = struct{}{}
+		}
+	}
+
+	permissionNames := make([]string, 0, len(permissionSet))
+	for name := range permissionSet {
+		permissionNames = append(permissionNames, name)
+	}
+	sort.Strings(permissionNames)
+
+	return roleNames, permissionNames, nil
+}
+
+// AssignRole grants a role to a user
+func (s *RoleService) AssignRole(ctx context.Context, userID uint, roleName string, grantedBy *uint) error {
+	var role models.Role
+	if err := s.db.WithContext(ctx).Where("name = ?", roleName).First(&role).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return ErrRoleNotFound
+		}
+		return fmt.Errorf("failed to find role: %w", err)
+	}
+
+	var user models.User
+	if err := s.db.WithContext(ctx).First(&user, userID).Error; err != nil {
+		return fmt.Errorf("user not found: %w", err)
+	}
+
+	userRole := models.UserRole{
+		UserID:    userID,
+		RoleID:    role.ID,
+		GrantedBy: grantedBy,
+	}
+	result := s.db.WithContext(ctx).Clauses(clause.OnConflict{DoNothing: true}).Create(&userRole)
+	if result.Error != nil {
+		return fmt.Errorf("failed to assign role: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return ErrRoleAlreadyAssigned
+	}
+
+	return nil
+}
+
+// RevokeRole removes a role from a user
+func (s *RoleService) RevokeRole(ctx context.Context, userID uint, roleName string) error {
+	var role models.Role
+	if err := s.db.WithContext(ctx).Where("name = ?", roleName).First(&role).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return ErrRoleNotFound
+		}
+		return fmt.Errorf("failed to find role: %w", err)
+	}
+
+	result := s.db.WithContext(ctx).Where("user_id = ? AND role_id = ?", userID, role.ID).Delete(&models.UserRole{})
+	if result.Error != nil {
+		return fmt.Errorf("failed to revoke role: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return ErrRoleNotAssigned
+	}
+
+	return nil
+}
+
+// HasRole checks if a user holds the given role
+func (s *RoleService) HasRole(ctx context.Context, userID uint, roleName string) (bool, error) {
+	var count int64
+	err := s.db.WithContext(ctx).Model(&models.UserRole{}).
+		Joins("JOIN roles ON roles.id = user_roles.role_id").
+		Where("user_roles.user_id = ? AND roles.name = ?", userID, roleName).
+		Count(&count).Error
+	if err != nil {
+		return false, fmt.Errorf("failed to check user role: %w", err)
+	}
+	return count > 0, nil
+}
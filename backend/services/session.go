@@ -0,0 +1,272 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"mobile-backend/config"
+	"mobile-backend/models"
+	"mobile-backend/utils"
+
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+var (
+	ErrSessionNotFound    = errors.New("session not found")
+	ErrSessionRevoked     = errors.New("session revoked or expired")
+	ErrRefreshTokenReused = errors.New("refresh token reuse detected")
+)
+
+// SessionMetadata describes the client a session was created or refreshed from
+type SessionMetadata struct {
+	UserAgent  string
+	IPAddress  string
+	DeviceID   string
+	DeviceName string
+	Platform   string
+	AppVersion string
+	OSVersion  string
+	// UserDeviceID links the session to the user's device registry entry, if known
+	UserDeviceID *uint
+}
+
+// SessionService persists refresh token families and enforces single-use rotation
+type SessionService struct {
+	db          *gorm.DB
+	revocations *TokenBlacklistService
+	logger      *config.Logger
+}
+
+// NewSessionService creates a new session service. Revoking a session also revokes the
+// access tokens issued for it through revocations; when nil, they stay valid until expiry.
+func NewSessionService(db *gorm.DB, revocations *TokenBlacklistService, logger *config.Logger) *SessionService {
+	return &SessionService{
+		db:          db,
+		revocations: revocations,
+		logger:      logger,
+	}
+}
+
+// CreateSession starts a new token family for the user and returns the session
+// together with the refresh token ID that must be embedded in the first refresh token
+func (s *SessionService) CreateSession(ctx context.Context, userID uint, meta SessionMetadata) (*models.Session, string, error) {
+	familyID, err := utils.GenerateRandomString(16)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to generate session id: %w", err)
+	}
+	tokenID, err := utils.GenerateRandomString(16)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to generate refresh token id: %w", err)
+	}
+
+	now := time.Now()
+	session := &models.Session{
+		UserID:     userID,
+		FamilyID:   familyID,
+		Token:      utils.HashToken(tokenID),
+		ExpiresAt:  now.Add(utils.RefreshTokenTTL),
+		IsActive:   true,
+		UserAgent:  meta.UserAgent,
+		IPAddress:  meta.IPAddress,
+		DeviceID:   meta.DeviceID,
+		DeviceName: meta.DeviceName,
+		LastUsedAt: &now,
+
+		UserDeviceID: meta.UserDeviceID,
+	}
+
+	if err := s.db.WithContext(ctx).Create(session).Error; err != nil {
+		return nil, "", fmt.Errorf("failed to create session: %w", err)
+	}
+
+	return session, tokenID, nil
+}
+
+// RotateSession consumes the presented refresh token ID and issues the next one.
+// If the presented ID is not the current one, the token has already been used and
+// the whole family is revoked.
+func (s *SessionService) RotateSession(ctx context.Context, familyID, presentedTokenID string, meta SessionMetadata) (*models.Session, string, error) {
+	var session models.Session
+	if err := s.db.WithContext(ctx).Where("family_id = ?", familyID).First(&session).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, "", ErrSessionNotFound
+		}
+		return nil, "", fmt.Errorf("failed to load session: %w", err)
+	}
+
+	if !session.IsValid() {
+		return nil, "", ErrSessionRevoked
+	}
+
+	presentedHash := utils.HashToken(presentedTokenID)
+	if session.Token != presentedHash {
+		s.handleReuse(ctx, &session, meta)
+		return nil, "", ErrRefreshTokenReused
+	}
+
+	nextTokenID, err := utils.GenerateRandomString(16)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to generate refresh token id: %w", err)
+	}
+
+	now := time.Now()
+	updates := map[string]interface{}{
+		"token":        utils.HashToken(nextTokenID),
+		"last_used_at": now,
+		"expires_at":   now.Add(utils.RefreshTokenTTL),
+	}
+	if meta.UserAgent != "" {
+		updates["user_agent"] = meta.UserAgent
+	}
+	if meta.IPAddress != "" {
+		updates["ip_address"] = meta.IPAddress
+	}
+
+	// Conditional update so two concurrent refreshes with the same token can't both win
+	result := s.db.WithContext(ctx).Model(&models.Session{}).
+		Where("id = ? AND token = ?", session.ID, presentedHash).
+		Updates(updates)
+	if result.Error != nil {
+		return nil, "", fmt.Errorf("failed to rotate session: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		s.handleReuse(ctx, &session, meta)
+		return nil, "", ErrRefreshTokenReused
+	}
+
+	session.Token = updates["token"].(string)
+	session.LastUsedAt = &now
+	session.ExpiresAt = now.Add(utils.RefreshTokenTTL)
+
+	return &session, nextTokenID, nil
+}
+
+// handleReuse revokes a token family after an already-used refresh token was presented
+func (s *SessionService) handleReuse(ctx context.Context, session *models.Session, meta SessionMetadata) {
+	if err := s.revoke(ctx, s.db.Where("id = ?", session.ID), models.SessionRevokedTokenReuse); err != nil {
+		s.logger.Error("Failed to revoke session after refresh token reuse",
+			zap.Error(err),
+			zap.Uint("session_id", session.ID),
+		)
+	}
+
+	s.logger.LogSecurityEvent(ctx, "refresh_token_reuse", "high",
+		zap.Uint("user_id", session.UserID),
+		zap.Uint("session_id", session.ID),
+		zap.String("device_id", session.DeviceID),
+		zap.String("ip_address", meta.IPAddress),
+		zap.String("user_agent", meta.UserAgent),
+	)
+}
+
+// ListActiveSessions returns the user's sessions that can still be refreshed, most recently used first
+func (s *SessionService) ListActiveSessions(ctx context.Context, userID uint) ([]models.Session, error) {
+	var sessions []models.Session
+	err := s.db.WithContext(ctx).
+		Where("user_id = ? AND is_active = ? AND revoked_at IS NULL AND expires_at > ?", userID, true, time.Now()).
+		Order("last_used_at DESC").
+		Find(&sessions).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to list sessions: %w", err)
+	}
+	return sessions, nil
+}
+
+// IsSessionActive checks whether the token family is still valid
+func (s *SessionService) IsSessionActive(ctx context.Context, familyID string) (bool, error) {
+	var session models.Session
+	if err := s.db.WithContext(ctx).Where("family_id = ?", familyID).First(&session).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return false, nil
+		}
+		return false, fmt.Errorf("failed to load session: %w", err)
+	}
+	return session.IsValid(), nil
+}
+
+// RevokeSession revokes one of the user's sessions by its ID
+func (s *SessionService) RevokeSession(ctx context.Context, userID, sessionID uint, reason string) error {
+	var session models.Session
+	if err := s.db.WithContext(ctx).Where("id = ? AND user_id = ?", sessionID, userID).First(&session).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrSessionNotFound
+		}
+		return fmt.Errorf("failed to load session: %w", err)
+	}
+
+	return s.revoke(ctx, s.db.Where("id = ?", session.ID), reason)
+}
+
+// SetOrganization changes the active organization of a session. Tokens issued from the
+// next rotation on carry it; nil clears it.
+func (s *SessionService) SetOrganization(ctx context.Context, familyID string, organizationID *uint) error {
+	result := s.db.WithContext(ctx).Model(&models.Session{}).
+		Where("family_id = ? AND revoked_at IS NULL", familyID).
+		Update("organization_id", organizationID)
+	if result.Error != nil {
+		return fmt.Errorf("failed to update session: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return ErrSessionNotFound
+	}
+	return nil
+}
+
+// RevokeSessionByFamily revokes the session owning the given token family
+func (s *SessionService) RevokeSessionByFamily(ctx context.Context, familyID, reason string) error {
+	return s.revoke(ctx, s.db.Where("family_id = ?", familyID), reason)
+}
+
+// RevokeAllSessions revokes every active session of the user, optionally keeping one family alive.
+// Without an exception every token ever issued to the user is revoked too.
+func (s *SessionService) RevokeAllSessions(ctx context.Context, userID uint, exceptFamilyID, reason string) error {
+	query := s.db.Where("user_id = ?", userID)
+	if exceptFamilyID != "" {
+		query = query.Where("family_id <> ?", exceptFamilyID)
+	}
+	if err := s.revoke(ctx, query, reason); err != nil {
+		return err
+	}
+
+	if exceptFamilyID == "" && s.revocations != nil {
+		return s.revocations.RevokeAllForUser(ctx, userID)
+	}
+	return nil
+}
+
+func (s *SessionService) revoke(ctx context.Context, scope *gorm.DB, reason string) error {
+	var familyIDs []string
+	if err := scope.WithContext(ctx).Model(&models.Session{}).
+		Where("revoked_at IS NULL").
+		Pluck("family_id", &familyIDs).Error; err != nil {
+		return fmt.Errorf("failed to load sessions: %w", err)
+	}
+	if len(familyIDs) == 0 {
+		return nil
+	}
+
+	now := time.Now()
+	err := s.db.WithContext(ctx).Model(&models.Session{}).
+		Where("family_id IN ? AND revoked_at IS NULL", familyIDs).
+		Updates(map[string]interface{}{
+			"is_active":      false,
+			"revoked_at":     now,
+			"revoked_reason": reason,
+		}).Error
+	if err != nil {
+		return fmt.Errorf("failed to revoke session: %w", err)
+	}
+
+	// Access tokens carry the family as their sid, so they stop working with the session
+	if s.revocations != nil {
+		for _, familyID := range familyIDs {
+			if err := s.revocations.RevokeSession(ctx, familyID); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
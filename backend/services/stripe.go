@@ -16,22 +16,28 @@ import (
 	"github.com/stripe/stripe-go/v78/paymentintent"
 	"github.com/stripe/stripe-go/v78/price"
 	"github.com/stripe/stripe-go/v78/product"
+	"github.com/stripe/stripe-go/v78/refund"
 	"github.com/stripe/stripe-go/v78/subscription"
 	"github.com/stripe/stripe-go/v78/webhook"
 	"gorm.io/gorm"
 )
 
+// StripeService is the Stripe PaymentProvider
 type StripeService struct {
 	db                        *gorm.DB
 	cache                     *CacheService
 	websocketService          *WebSocketService
 	subscriptionStatusService *SubscriptionStatusService
+	refunds                   *RefundService
 }
 
 func NewStripeService(db *gorm.DB, cache *CacheService, websocketService *WebSocketService, subscriptionStatusService *SubscriptionStatusService) *StripeService {
 	// Initialize Stripe with API key
 	stripe.Key = os.Getenv("STRIPE_SECRET_KEY")
 
+	// Products are the global billing catalog, shared by every organization
+	db = models.AcrossTenants(db)
+
 	return &StripeService{
 		db:                        db,
 		cache:                     cache,
@@ -40,6 +46,21 @@ func NewStripeService(db *gorm.DB, cache *CacheService, websocketService *WebSoc
 	}
 }
 
+// Name returns the provider key Stripe is registered under
+func (s *StripeService) Name() string {
+	return "stripe"
+}
+
+// WebhookSignatureHeader returns the header Stripe signs webhooks in
+func (s *StripeService) WebhookSignatureHeader() string {
+	return "Stripe-Signature"
+}
+
+// SetRefundService records the refunds and disputes reported by Stripe webhooks
+func (s *StripeService) SetRefundService(refunds *RefundService) {
+	s.refunds = refunds
+}
+
 // Product Management
 
 // CreateProduct creates a product in Stripe and our database
@@ -230,6 +251,12 @@ func (s *StripeService) CreatePaymentIntent(ctx context.Context, userID uint, pr
 	return payment, nil
 }
 
+// CreatePayment creates a payment intent; it is CreatePaymentIntent under the
+// PaymentProvider name
+func (s *StripeService) CreatePayment(ctx context.Context, userID uint, productID uint, amount int64, currency string) (*models.Payment, error) {
+	return s.CreatePaymentIntent(ctx, userID, productID, amount, currency)
+}
+
 // CreateCheckoutSession creates a Stripe checkout session
 func (s *StripeService) CreateCheckoutSession(ctx context.Context, userID uint, productID uint, successURL, cancelURL string) (*stripe.CheckoutSession, error) {
 	var user models.User
@@ -330,6 +357,7 @@ func (s *StripeService) CreateSubscription(ctx context.Context, userID uint, pla
 		CurrentPeriodEnd:     time.Unix(stripeSubscription.CurrentPeriodEnd, 0),
 		CancelAtPeriodEnd:    stripeSubscription.CancelAtPeriodEnd,
 		StripeSubscriptionID: stripeSubscription.ID,
+		PaymentMethod:        "stripe",
 		Quantity:             1,
 	}
 
@@ -396,6 +424,77 @@ func (s *StripeService) CancelSubscription(ctx context.Context, subscriptionID u
 	return nil
 }
 
+// ChangePlan swaps the price and quantity of a subscription. Immediate changes are
+// invoiced right away with the previewed proration; scheduled changes are made without
+// proration so Stripe bills the new price from the next renewal.
+func (s *StripeService) ChangePlan(ctx context.Context, sub *models.Subscription, plan *models.Plan, preview *ProrationPreview) error {
+	if sub.StripeSubscriptionID == "" {
+		return fmt.Errorf("subscription does not have Stripe ID")
+	}
+	if plan.StripePriceID == "" {
+		return fmt.Errorf("plan does not have Stripe price ID")
+	}
+
+	stripeSubscription, err := subscription.Get(sub.StripeSubscriptionID, nil)
+	if err != nil {
+		return fmt.Errorf("failed to get Stripe subscription: %w", err)
+	}
+	if stripeSubscription.Items == nil || len(stripeSubscription.Items.Data) == 0 {
+		return fmt.Errorf("Stripe subscription has no items")
+	}
+
+	params := &stripe.SubscriptionParams{
+		Items: []*stripe.SubscriptionItemsParams{
+			{
+				ID:       stripe.String(stripeSubscription.Items.Data[0].ID),
+				Price:    stripe.String(plan.StripePriceID),
+				Quantity: stripe.Int64(int64(preview.NewQuantity)),
+			},
+		},
+		ProrationBehavior: stripe.String("none"),
+	}
+	if preview.Prorated() {
+		params.ProrationBehavior = stripe.String("always_invoice")
+		params.ProrationDate = stripe.Int64(preview.ProrationDate)
+	}
+
+	if _, err := subscription.Update(sub.StripeSubscriptionID, params); err != nil {
+		return fmt.Errorf("failed to update Stripe subscription: %w", err)
+	}
+	return nil
+}
+
+// RefundPayment refunds a payment intent or charge. Most card refunds succeed at once;
+// the rest are completed by the charge.refund.updated webhook.
+func (s *StripeService) RefundPayment(ctx context.Context, payment *models.Payment, record *models.Refund) error {
+	params := &stripe.RefundParams{
+		Amount: stripe.Int64(record.Amount),
+	}
+	switch {
+	case payment.StripePaymentIntentID != "":
+		params.PaymentIntent = stripe.String(payment.StripePaymentIntentID)
+	case payment.StripeChargeID != "":
+		params.Charge = stripe.String(payment.StripeChargeID)
+	default:
+		return fmt.Errorf("payment does not have Stripe ID")
+	}
+	switch record.Reason {
+	case models.RefundReasonDuplicate, models.RefundReasonFraudulent, models.RefundReasonRequestedByCustomer:
+		params.Reason = stripe.String(record.Reason)
+	}
+	// Lets the webhooks find the refund before its Stripe ID is saved
+	params.AddMetadata("refund_id", strconv.FormatUint(uint64(record.ID), 10))
+
+	stripeRefund, err := refund.New(params)
+	if err != nil {
+		return fmt.Errorf("failed to create Stripe refund: %w", err)
+	}
+
+	record.ProviderRefundID = stripeRefund.ID
+	record.Status = stripeRefundStatus(stripeRefund.Status)
+	return nil
+}
+
 // Webhook Handling
 
 // HandleWebhook processes Stripe webhook events
@@ -447,6 +546,12 @@ func (s *StripeService) HandleWebhook(ctx context.Context, payload []byte, signa
 		return s.handleInvoicePaymentSucceeded(ctx, event)
 	case "invoice.payment_failed":
 		return s.handleInvoicePaymentFailed(ctx, event)
+	case "charge.refunded":
+		return s.handleChargeRefunded(ctx, event)
+	case "charge.refund.updated":
+		return s.handleRefundUpdated(ctx, event)
+	case "charge.dispute.created", "charge.dispute.updated", "charge.dispute.closed":
+		return s.handleDispute(ctx, event)
 	case "product.created":
 		return s.handleProductCreated(ctx, event)
 	case "product.updated":
@@ -718,8 +823,163 @@ func (s *StripeService) handleInvoicePaymentFailed(ctx context.Context, event st
 	return s.markWebhookProcessed(ctx, event.ID)
 }
 
+func (s *StripeService) handleChargeRefunded(ctx context.Context, event stripe.Event) error {
+	var charge stripe.Charge
+	if err := json.Unmarshal(event.Data.Raw, &charge); err != nil {
+		return fmt.Errorf("failed to unmarshal charge: %w", err)
+	}
+	if s.refunds == nil {
+		return s.markWebhookProcessed(ctx, event.ID)
+	}
+
+	paymentIntentID := ""
+	if charge.PaymentIntent != nil {
+		paymentIntentID = charge.PaymentIntent.ID
+	}
+	payment, err := s.findChargePayment(charge.ID, paymentIntentID)
+	if err != nil {
+		return err
+	}
+
+	// Recent API versions leave the charge's refunds out of the event
+	var refunds []*stripe.Refund
+	if charge.Refunds != nil && len(charge.Refunds.Data) > 0 {
+		refunds = charge.Refunds.Data
+	} else {
+		iter := refund.List(&stripe.RefundListParams{Charge: stripe.String(charge.ID)})
+		for iter.Next() {
+			refunds = append(refunds, iter.Refund())
+		}
+		if err := iter.Err(); err != nil {
+			return fmt.Errorf("failed to list Stripe refunds: %w", err)
+		}
+	}
+
+	for _, stripeRefund := range refunds {
+		if err := s.refunds.RecordRefund(ctx, payment, stripeProviderRefund(stripeRefund)); err != nil {
+			return err
+		}
+	}
+
+	return s.markWebhookProcessed(ctx, event.ID)
+}
+
+func (s *StripeService) handleRefundUpdated(ctx context.Context, event stripe.Event) error {
+	var stripeRefund stripe.Refund
+	if err := json.Unmarshal(event.Data.Raw, &stripeRefund); err != nil {
+		return fmt.Errorf("failed to unmarshal refund: %w", err)
+	}
+	if s.refunds == nil {
+		return s.markWebhookProcessed(ctx, event.ID)
+	}
+
+	chargeID, paymentIntentID := "", ""
+	if stripeRefund.Charge != nil {
+		chargeID = stripeRefund.Charge.ID
+	}
+	if stripeRefund.PaymentIntent != nil {
+		paymentIntentID = stripeRefund.PaymentIntent.ID
+	}
+	payment, err := s.findChargePayment(chargeID, paymentIntentID)
+	if err != nil {
+		return err
+	}
+
+	if err := s.refunds.RecordRefund(ctx, payment, stripeProviderRefund(&stripeRefund)); err != nil {
+		return err
+	}
+
+	return s.markWebhookProcessed(ctx, event.ID)
+}
+
+func (s *StripeService) handleDispute(ctx context.Context, event stripe.Event) error {
+	var dispute stripe.Dispute
+	if err := json.Unmarshal(event.Data.Raw, &dispute); err != nil {
+		return fmt.Errorf("failed to unmarshal dispute: %w", err)
+	}
+	if s.refunds == nil {
+		return s.markWebhookProcessed(ctx, event.ID)
+	}
+
+	chargeID, paymentIntentID := "", ""
+	if dispute.Charge != nil {
+		chargeID = dispute.Charge.ID
+	}
+	if dispute.PaymentIntent != nil {
+		paymentIntentID = dispute.PaymentIntent.ID
+	}
+	payment, err := s.findChargePayment(chargeID, paymentIntentID)
+	if err != nil {
+		return err
+	}
+
+	reported := ProviderDispute{
+		ID:       dispute.ID,
+		Amount:   dispute.Amount,
+		Currency: string(dispute.Currency),
+		Status:   string(dispute.Status),
+		Reason:   string(dispute.Reason),
+	}
+	if dispute.EvidenceDetails != nil && dispute.EvidenceDetails.DueBy > 0 {
+		dueBy := time.Unix(dispute.EvidenceDetails.DueBy, 0)
+		reported.EvidenceDueBy = &dueBy
+	}
+	if err := s.refunds.RecordDispute(ctx, payment, reported); err != nil {
+		return err
+	}
+
+	return s.markWebhookProcessed(ctx, event.ID)
+}
+
 // Helper Methods
 
+// findChargePayment finds the payment a charge belongs to by the charge or its payment intent
+func (s *StripeService) findChargePayment(chargeID, paymentIntentID string) (*models.Payment, error) {
+	var payment models.Payment
+	var err error
+	switch {
+	case chargeID != "" && paymentIntentID != "":
+		err = s.db.Where("stripe_charge_id = ? OR stripe_payment_intent_id = ?", chargeID, paymentIntentID).First(&payment).Error
+	case chargeID != "":
+		err = s.db.Where("stripe_charge_id = ?", chargeID).First(&payment).Error
+	case paymentIntentID != "":
+		err = s.db.Where("stripe_payment_intent_id = ?", paymentIntentID).First(&payment).Error
+	default:
+		return nil, fmt.Errorf("event has no charge or payment intent")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to find payment record: %w", err)
+	}
+	return &payment, nil
+}
+
+func stripeProviderRefund(stripeRefund *stripe.Refund) ProviderRefund {
+	reported := ProviderRefund{
+		ID:       stripeRefund.ID,
+		Amount:   stripeRefund.Amount,
+		Currency: string(stripeRefund.Currency),
+		Status:   stripeRefundStatus(stripeRefund.Status),
+		Reason:   string(stripeRefund.Reason),
+	}
+	if id, err := strconv.ParseUint(stripeRefund.Metadata["refund_id"], 10, 64); err == nil {
+		reported.RefundID = uint(id)
+	}
+	return reported
+}
+
+// stripeRefundStatus maps a Stripe refund status to a models.RefundStatus*
+func stripeRefundStatus(status stripe.RefundStatus) string {
+	switch status {
+	case stripe.RefundStatusSucceeded:
+		return models.RefundStatusSucceeded
+	case stripe.RefundStatusFailed:
+		return models.RefundStatusFailed
+	case stripe.RefundStatusCanceled:
+		return models.RefundStatusCanceled
+	}
+	return models.RefundStatusPending
+}
+
 func (s *StripeService) markWebhookProcessed(ctx context.Context, eventID string) error {
 	return s.db.Model(&models.WebhookEvent{}).
 		Where("event_id = ?", eventID).
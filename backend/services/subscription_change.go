@@ -0,0 +1,336 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"time"
+
+	"mobile-backend/models"
+
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+// When a plan change takes effect
+const (
+	PlanChangeImmediate = "immediate"
+	PlanChangePeriodEnd = "period_end"
+)
+
+// prorationQuoteTTL is how long the proration date of a preview can be confirmed
+const prorationQuoteTTL = time.Hour
+
+var (
+	ErrNoActiveSubscription    = errors.New("no active subscription")
+	ErrInvalidPlanChange       = errors.New("invalid plan change")
+	ErrStoreSubscriptionChange = errors.New("store subscriptions are changed in the store")
+	ErrProrationQuoteExpired   = errors.New("proration quote has expired")
+	ErrPlanChangeUnsupported   = errors.New("payment provider does not support this plan change")
+)
+
+// PlanChangeRequest asks to move the user's subscription to another plan or quantity.
+// Zero fields keep the current plan or quantity.
+type PlanChangeRequest struct {
+	PlanID   uint
+	Quantity int
+	// ProrationDate pins the proration to the moment a preview was computed, so the user
+	// is charged what they were shown
+	ProrationDate time.Time
+}
+
+// ProrationPreview is the outcome of a plan change. Upgrades, including seat increases,
+// take effect immediately and charge the prorated difference; downgrades take effect
+// at the end of the current period without a charge.
+type ProrationPreview struct {
+	SubscriptionID  uint      `json:"subscription_id"`
+	CurrentPlanID   uint      `json:"current_plan_id"`
+	NewPlanID       uint      `json:"new_plan_id"`
+	CurrentQuantity int       `json:"current_quantity"`
+	NewQuantity     int       `json:"new_quantity"`
+	Timing          string    `json:"timing"`
+	EffectiveAt     time.Time `json:"effective_at"`
+	// ProrationDate is sent back when confirming the change
+	ProrationDate int64  `json:"proration_date"`
+	Currency      string `json:"currency"`
+	// Credit is the unused part of the current period and Charge the new plan's price for
+	// the rest of it, or for a full period when the billing interval changes. AmountDue is
+	// charged now; a negative amount is credited.
+	Credit    int64 `json:"credit"`
+	Charge    int64 `json:"charge"`
+	AmountDue int64 `json:"amount_due"`
+	// The billing period and recurring amount once the change has taken effect
+	PeriodStart     time.Time `json:"period_start"`
+	PeriodEnd       time.Time `json:"period_end"`
+	RecurringAmount int64     `json:"recurring_amount"`
+}
+
+// Prorated reports whether the provider should charge or credit the change now
+func (p *ProrationPreview) Prorated() bool {
+	return p.Timing == PlanChangeImmediate && (p.Credit != 0 || p.Charge != 0)
+}
+
+// SubscriptionChangeService changes the plan and quantity of subscriptions
+type SubscriptionChangeService struct {
+	db                        *gorm.DB
+	providers                 *PaymentProviderRegistry
+	subscriptionStatusService *SubscriptionStatusService
+	logger                    *zap.Logger
+}
+
+// NewSubscriptionChangeService creates a new subscription change service
+func NewSubscriptionChangeService(db *gorm.DB, providers *PaymentProviderRegistry, subscriptionStatusService *SubscriptionStatusService, logger *zap.Logger) *SubscriptionChangeService {
+	return &SubscriptionChangeService{
+		db:                        db,
+		providers:                 providers,
+		subscriptionStatusService: subscriptionStatusService,
+		logger:                    logger,
+	}
+}
+
+// PreviewChange computes what a plan change would cost without making it
+func (s *SubscriptionChangeService) PreviewChange(ctx context.Context, userID uint, req PlanChangeRequest) (*ProrationPreview, error) {
+	_, _, preview, err := s.prepare(ctx, userID, req)
+	return preview, err
+}
+
+// ChangePlan changes the user's subscription at its payment provider and records the
+// change. Downgrades are recorded as scheduled and applied by ApplyScheduledChanges
+// once the period ends; requesting the current plan and quantity again drops a
+// scheduled downgrade.
+func (s *SubscriptionChangeService) ChangePlan(ctx context.Context, userID uint, req PlanChangeRequest) (*models.Subscription, *ProrationPreview, error) {
+	sub, plan, preview, err := s.prepare(ctx, userID, req)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	provider, err := s.providers.Get(sub.PaymentMethod)
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := provider.ChangePlan(ctx, sub, plan, preview); err != nil {
+		return nil, nil, fmt.Errorf("failed to change plan at %s: %w", provider.Name(), err)
+	}
+
+	var updates map[string]interface{}
+	if preview.Timing == PlanChangeImmediate {
+		updates = map[string]interface{}{
+			"plan_id":              plan.ID,
+			"product_id":           plan.ProductID,
+			"quantity":             preview.NewQuantity,
+			"current_period_start": preview.PeriodStart,
+			"current_period_end":   preview.PeriodEnd,
+			"scheduled_plan_id":    nil,
+			"scheduled_quantity":   0,
+			"scheduled_change_at":  nil,
+		}
+	} else {
+		updates = map[string]interface{}{
+			"scheduled_plan_id":   plan.ID,
+			"scheduled_quantity":  preview.NewQuantity,
+			"scheduled_change_at": preview.EffectiveAt,
+		}
+	}
+	// Updating through sub would write its preloaded plan's ID back over plan_id
+	if err := s.db.WithContext(ctx).Model(&models.Subscription{}).Where("id = ?", sub.ID).Updates(updates).Error; err != nil {
+		return nil, nil, fmt.Errorf("failed to update subscription: %w", err)
+	}
+
+	if err := s.db.WithContext(ctx).Preload("Plan").First(sub, sub.ID).Error; err != nil {
+		return nil, nil, fmt.Errorf("failed to reload subscription: %w", err)
+	}
+
+	if preview.Timing == PlanChangeImmediate && s.subscriptionStatusService != nil {
+		if err := s.subscriptionStatusService.UpdateUserSubscriptionStatus(ctx, sub.UserID, sub); err != nil {
+			return nil, nil, fmt.Errorf("failed to update user subscription status: %w", err)
+		}
+	}
+
+	return sub, preview, nil
+}
+
+// ApplyScheduledChanges moves subscriptions whose period has ended onto their scheduled
+// plan and quantity. Providers already bill the new plan from the renewal on, so this only
+// updates our records.
+func (s *SubscriptionChangeService) ApplyScheduledChanges(ctx context.Context) (int, error) {
+	var due []models.Subscription
+	if err := s.db.WithContext(ctx).
+		Where("scheduled_change_at <= ? AND status IN ?", time.Now(), []string{"active", "trialing", "past_due"}).
+		Find(&due).Error; err != nil {
+		return 0, fmt.Errorf("failed to find scheduled plan changes: %w", err)
+	}
+
+	applied := 0
+	for i := range due {
+		if err := applyScheduledPlanChange(s.db.WithContext(ctx), &due[i]); err != nil {
+			s.logger.Error("Failed to apply scheduled plan change", zap.Uint("subscription_id", due[i].ID), zap.Error(err))
+			continue
+		}
+		applied++
+	}
+
+	if applied > 0 {
+		s.logger.Info("Applied scheduled plan changes", zap.Int("count", applied))
+	}
+	return applied, nil
+}
+
+// prepare loads the user's subscription and the target plan and computes the preview
+func (s *SubscriptionChangeService) prepare(ctx context.Context, userID uint, req PlanChangeRequest) (*models.Subscription, *models.Plan, *ProrationPreview, error) {
+	var sub models.Subscription
+	err := s.db.WithContext(ctx).Preload("Plan").
+		Where("user_id = ? AND status IN ?", userID, []string{"active", "trialing"}).
+		Order("created_at DESC").
+		First(&sub).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil, nil, ErrNoActiveSubscription
+	}
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("failed to find subscription: %w", err)
+	}
+
+	if IsStorePaymentMethod(sub.PaymentMethod) {
+		return nil, nil, nil, ErrStoreSubscriptionChange
+	}
+	if sub.Plan == nil {
+		return nil, nil, nil, fmt.Errorf("%w: subscription has no plan", ErrInvalidPlanChange)
+	}
+
+	plan := sub.Plan
+	if req.PlanID != 0 && req.PlanID != plan.ID {
+		var target models.Plan
+		if err := s.db.WithContext(ctx).Where("id = ? AND is_active = ?", req.PlanID, true).First(&target).Error; err != nil {
+			return nil, nil, nil, fmt.Errorf("%w: plan not found", ErrInvalidPlanChange)
+		}
+		if target.Currency != plan.Currency {
+			return nil, nil, nil, fmt.Errorf("%w: plans are billed in different currencies", ErrInvalidPlanChange)
+		}
+		plan = &target
+	}
+
+	quantity := req.Quantity
+	if quantity == 0 {
+		quantity = sub.Quantity
+	}
+	if quantity < 1 {
+		return nil, nil, nil, fmt.Errorf("%w: quantity must be at least 1", ErrInvalidPlanChange)
+	}
+
+	now := time.Now()
+	at := now
+	if !req.ProrationDate.IsZero() {
+		if req.ProrationDate.After(now.Add(time.Minute)) || now.Sub(req.ProrationDate) > prorationQuoteTTL || req.ProrationDate.Before(sub.CurrentPeriodStart) {
+			return nil, nil, nil, ErrProrationQuoteExpired
+		}
+		at = req.ProrationDate
+	}
+
+	preview, err := calculateProration(&sub, plan, quantity, at)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	return &sub, plan, preview, nil
+}
+
+// calculateProration prices moving sub to plan and quantity at the given moment. Changes
+// that bill at least as much per day are upgrades; they credit the unused part of the
+// current period and charge the new plan for the rest of it, or start a new period when
+// the billing interval changes.
+func calculateProration(sub *models.Subscription, plan *models.Plan, quantity int, at time.Time) (*ProrationPreview, error) {
+	current := sub.Plan
+	preview := &ProrationPreview{
+		SubscriptionID:  sub.ID,
+		CurrentPlanID:   current.ID,
+		NewPlanID:       plan.ID,
+		CurrentQuantity: sub.Quantity,
+		NewQuantity:     quantity,
+		Timing:          PlanChangeImmediate,
+		EffectiveAt:     at,
+		ProrationDate:   at.Unix(),
+		Currency:        plan.Currency,
+		PeriodStart:     sub.CurrentPeriodStart,
+		PeriodEnd:       sub.CurrentPeriodEnd,
+		RecurringAmount: plan.Price * int64(quantity),
+	}
+
+	if plan.ID == current.ID && quantity == sub.Quantity {
+		// Confirming the current plan only drops a scheduled downgrade
+		if sub.ScheduledPlanID == nil {
+			return nil, fmt.Errorf("%w: the subscription is already on this plan", ErrInvalidPlanChange)
+		}
+		return preview, nil
+	}
+
+	// Trials switch plans without a charge and keep their end date
+	if sub.Status == "trialing" {
+		return preview, nil
+	}
+
+	currentAmount := current.Price * int64(sub.Quantity)
+	currentLength := addPlanInterval(sub.CurrentPeriodStart, current).Sub(sub.CurrentPeriodStart).Seconds()
+	newLength := addPlanInterval(sub.CurrentPeriodStart, plan).Sub(sub.CurrentPeriodStart).Seconds()
+	if float64(preview.RecurringAmount)*currentLength < float64(currentAmount)*newLength {
+		preview.Timing = PlanChangePeriodEnd
+		preview.EffectiveAt = sub.CurrentPeriodEnd
+		preview.PeriodStart = sub.CurrentPeriodEnd
+		preview.PeriodEnd = addPlanInterval(sub.CurrentPeriodEnd, plan)
+		return preview, nil
+	}
+
+	total := sub.CurrentPeriodEnd.Sub(sub.CurrentPeriodStart)
+	remaining := sub.CurrentPeriodEnd.Sub(at)
+	if remaining < 0 {
+		remaining = 0
+	}
+	if total <= 0 || remaining > total {
+		remaining, total = 1, 1
+	}
+
+	preview.Credit = prorateAmount(currentAmount, remaining, total)
+	if plan.Interval == current.Interval && plan.IntervalCount == current.IntervalCount {
+		preview.Charge = prorateAmount(preview.RecurringAmount, remaining, total)
+	} else {
+		preview.Charge = preview.RecurringAmount
+		preview.PeriodStart = at
+		preview.PeriodEnd = addPlanInterval(at, plan)
+	}
+	preview.AmountDue = preview.Charge - preview.Credit
+	return preview, nil
+}
+
+// prorateAmount returns the share of amount for part of a period, rounded to the nearest cent
+func prorateAmount(amount int64, part, whole time.Duration) int64 {
+	return int64(math.Round(float64(amount) * part.Seconds() / whole.Seconds()))
+}
+
+// applyScheduledPlanChange moves a subscription onto its scheduled plan and quantity
+func applyScheduledPlanChange(db *gorm.DB, sub *models.Subscription) error {
+	if sub.ScheduledPlanID == nil {
+		return nil
+	}
+
+	var plan models.Plan
+	if err := db.First(&plan, *sub.ScheduledPlanID).Error; err != nil {
+		return fmt.Errorf("scheduled plan not found: %w", err)
+	}
+
+	sub.PlanID = &plan.ID
+	sub.Plan = &plan
+	sub.ProductID = plan.ProductID
+	if sub.ScheduledQuantity > 0 {
+		sub.Quantity = sub.ScheduledQuantity
+	}
+	sub.ScheduledPlanID = nil
+	sub.ScheduledQuantity = 0
+	sub.ScheduledChangeAt = nil
+
+	return db.Model(&models.Subscription{}).Where("id = ?", sub.ID).Updates(map[string]interface{}{
+		"plan_id":             plan.ID,
+		"product_id":          plan.ProductID,
+		"quantity":            sub.Quantity,
+		"scheduled_plan_id":   nil,
+		"scheduled_quantity":  0,
+		"scheduled_change_at": nil,
+	}).Error
+}
@@ -13,8 +13,9 @@ import (
 
 // SubscriptionStatusService handles subscription status management
 type SubscriptionStatusService struct {
-	db     *gorm.DB
-	logger *zap.Logger
+	db      *gorm.DB
+	dunning *DunningService
+	logger  *zap.Logger
 }
 
 // NewSubscriptionStatusService creates a new subscription status service
@@ -25,6 +26,12 @@ func NewSubscriptionStatusService(db *gorm.DB, logger *zap.Logger) *Subscription
 	}
 }
 
+// SetDunningService lets past due subscriptions keep access during the dunning grace
+// period. Without it, users lose pro access as soon as a payment fails.
+func (s *SubscriptionStatusService) SetDunningService(dunning *DunningService) {
+	s.dunning = dunning
+}
+
 // UpdateUserSubscriptionStatus updates user's subscription status based on subscription
 func (s *SubscriptionStatusService) UpdateUserSubscriptionStatus(ctx context.Context, userID uint, subscription *models.Subscription) error {
 	var user models.User
@@ -66,10 +73,26 @@ func (s *SubscriptionStatusService) UpdateUserSubscriptionStatus(ctx context.Con
 			status = "past_due"
 			isPro = false
 			subscriptionEndsAt = &subscription.CurrentPeriodEnd
+			if s.dunning != nil {
+				dunning, err := s.dunning.Track(ctx, subscription)
+				if err != nil {
+					return err
+				}
+				if dunning != nil && dunning.HasAccess(time.Now()) {
+					isPro = true
+					subscriptionEndsAt = &dunning.GraceEndsAt
+				}
+			}
 		default:
 			status = "free"
 			isPro = false
 		}
+
+		if s.dunning != nil && subscription.Status != "past_due" {
+			if err := s.dunning.Resolve(ctx, subscription); err != nil {
+				return err
+			}
+		}
 	}
 
 	// Update user subscription status
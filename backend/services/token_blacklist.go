@@ -2,17 +2,43 @@ package services
 
 import (
 	"context"
+	"fmt"
+	"strconv"
+	"sync/atomic"
 	"time"
 
+	"mobile-backend/utils"
+
 	"github.com/go-redis/redis/v8"
 )
 
+const (
+	// revocationCacheSize bounds the in-process cache of revocation verdicts
+	revocationCacheSize = 10000
+	// revocationNegativeTTL is how long a "not revoked" verdict is trusted locally, which
+	// bounds how late other instances notice a revocation
+	revocationNegativeTTL = 5 * time.Second
+)
+
 type TokenBlacklistService struct {
 	redis *redis.Client
+	// verdicts caches IsRevoked results per token ID in front of Redis
+	verdicts *utils.TTLCache[revocationVerdict]
+	// epoch is bumped on every session or user revocation made by this instance so
+	// cached "not revoked" verdicts are dropped immediately here
+	epoch atomic.Uint64
+}
+
+type revocationVerdict struct {
+	revoked bool
+	epoch   uint64
 }
 
 func NewTokenBlacklistService(redis *redis.Client) *TokenBlacklistService {
-	return &TokenBlacklistService{redis: redis}
+	return &TokenBlacklistService{
+		redis:    redis,
+		verdicts: utils.NewTTLCache[revocationVerdict](revocationCacheSize),
+	}
 }
 
 // AddToBlacklist adds a token to the blacklist
@@ -42,3 +68,100 @@ func (t *TokenBlacklistService) CleanupExpiredTokens(ctx context.Context) error
 	// Redis automatically removes expired keys, but we can add custom cleanup logic here
 	return nil
 }
+
+// RevokeToken revokes a single token by its jti until the token expires
+func (t *TokenBlacklistService) RevokeToken(ctx context.Context, tokenID string, expiresAt time.Time) error {
+	ttl := time.Until(expiresAt)
+	if tokenID == "" || ttl <= 0 {
+		return nil
+	}
+
+	if err := t.redis.Set(ctx, revokedTokenKey(tokenID), "1", ttl).Err(); err != nil {
+		return fmt.Errorf("failed to revoke token: %w", err)
+	}
+	t.verdicts.Set(tokenID, revocationVerdict{revoked: true}, ttl)
+	return nil
+}
+
+// RevokeSession revokes every access token issued for a session. Access tokens are
+// short-lived, so the entry only needs to outlive the longest one.
+func (t *TokenBlacklistService) RevokeSession(ctx context.Context, sessionID string) error {
+	if sessionID == "" {
+		return nil
+	}
+
+	if err := t.redis.Set(ctx, revokedSessionKey(sessionID), "1", utils.AccessTokenTTL).Err(); err != nil {
+		return fmt.Errorf("failed to revoke session tokens: %w", err)
+	}
+	t.epoch.Add(1)
+	return nil
+}
+
+// RevokeAllForUser revokes every token issued to the user up to now. Token issue times only
+// have second precision, so tokens issued during the current second are revoked as well.
+func (t *TokenBlacklistService) RevokeAllForUser(ctx context.Context, userID uint) error {
+	cutoff := strconv.FormatInt(time.Now().Unix(), 10)
+	if err := t.redis.Set(ctx, revokedUserKey(userID), cutoff, utils.RefreshTokenTTL).Err(); err != nil {
+		return fmt.Errorf("failed to revoke user tokens: %w", err)
+	}
+	t.epoch.Add(1)
+	return nil
+}
+
+// IsRevoked reports whether the token was revoked by ID, through its session, or by a
+// revocation of all the user's tokens made in or after the second it was issued.
+// Impersonation tokens are also revoked with the tokens of the staff member who holds them.
+func (t *TokenBlacklistService) IsRevoked(ctx context.Context, claims *utils.Claims) (bool, error) {
+	epoch := t.epoch.Load()
+	if claims.ID != "" {
+		if verdict, ok := t.verdicts.Get(claims.ID); ok && (verdict.revoked || verdict.epoch == epoch) {
+			return verdict.revoked, nil
+		}
+	}
+
+	pipe := t.redis.Pipeline()
+	var tokenCmd, sessionCmd *redis.IntCmd
+	if claims.ID != "" {
+		tokenCmd = pipe.Exists(ctx, revokedTokenKey(claims.ID))
+	}
+	if claims.SessionID != "" {
+		sessionCmd = pipe.Exists(ctx, revokedSessionKey(claims.SessionID))
+	}
+	userCmds := []*redis.StringCmd{pipe.Get(ctx, revokedUserKey(claims.UserID))}
+	if claims.Actor != nil {
+		userCmds = append(userCmds, pipe.Get(ctx, revokedUserKey(claims.Actor.UserID)))
+	}
+	if _, err := pipe.Exec(ctx); err != nil && err != redis.Nil {
+		return false, fmt.Errorf("failed to check token revocation: %w", err)
+	}
+
+	revoked := (tokenCmd != nil && tokenCmd.Val() > 0) || (sessionCmd != nil && sessionCmd.Val() > 0)
+	if !revoked && claims.IssuedAt != nil {
+		for _, userCmd := range userCmds {
+			if cutoff, err := userCmd.Int64(); err == nil && claims.IssuedAt.Unix() <= cutoff {
+				revoked = true
+			}
+		}
+	}
+
+	if claims.ID != "" {
+		ttl := revocationNegativeTTL
+		if revoked && claims.ExpiresAt != nil {
+			ttl = time.Until(claims.ExpiresAt.Time)
+		}
+		t.verdicts.Set(claims.ID, revocationVerdict{revoked: revoked, epoch: epoch}, ttl)
+	}
+	return revoked, nil
+}
+
+func revokedTokenKey(tokenID string) string {
+	return "blacklist:jti:" + tokenID
+}
+
+func revokedSessionKey(sessionID string) string {
+	return "blacklist:session:" + sessionID
+}
+
+func revokedUserKey(userID uint) string {
+	return "blacklist:user:" + strconv.FormatUint(uint64(userID), 10)
+}
@@ -0,0 +1,278 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"mobile-backend/config"
+	"mobile-backend/models"
+	"mobile-backend/utils"
+
+	"github.com/hibiken/asynq"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+const (
+	emailVerificationTokenTTL = 24 * time.Hour
+	passwordResetTokenTTL     = time.Hour
+	// verificationResendCooldown limits how often a new email can be requested per user and purpose
+	verificationResendCooldown = time.Minute
+)
+
+var (
+	ErrInvalidVerificationToken = errors.New("invalid or expired token")
+	ErrEmailAlreadyVerified     = errors.New("email already verified")
+	ErrEmailNotVerified         = errors.New("email not verified")
+)
+
+// VerificationService issues and consumes the single-use tokens behind email
+// verification and password reset. Emails are delivered through the job queue.
+type VerificationService struct {
+	db        *gorm.DB
+	jobQueue  *JobQueueService
+	sessions  *SessionService
+	passwords *PasswordPolicyService
+	logger    *config.Logger
+}
+
+// NewVerificationService creates a new verification service. passwords may be nil to
+// accept any new password on reset.
+func NewVerificationService(db *gorm.DB, jobQueue *JobQueueService, revocations *TokenBlacklistService, passwords *PasswordPolicyService, logger *config.Logger) *VerificationService {
+	return &VerificationService{
+		db:        db,
+		jobQueue:  jobQueue,
+		sessions:  NewSessionService(db, revocations, logger),
+		passwords: passwords,
+		logger:    logger,
+	}
+}
+
+// CreateToken issues a new single-use token for the user and returns its raw value.
+// Only the hash is persisted.
+func (s *VerificationService) CreateToken(ctx context.Context, userID uint, purpose string) (string, error) {
+	ttl := emailVerificationTokenTTL
+	if purpose == models.TokenPurposePasswordReset {
+		ttl = passwordResetTokenTTL
+	}
+
+	raw, err := utils.GenerateRandomString(32)
+	if err != nil {
+		return "", fmt.Errorf("failed to generate token: %w", err)
+	}
+
+	token := &models.VerificationToken{
+		UserID:    userID,
+		Purpose:   purpose,
+		TokenHash: utils.HashToken(raw),
+		ExpiresAt: time.Now().Add(ttl),
+	}
+	if err := s.db.WithContext(ctx).Create(token).Error; err != nil {
+		return "", fmt.Errorf("failed to store token: %w", err)
+	}
+
+	return raw, nil
+}
+
+// SendVerificationEmail emails the user a link to verify their address
+func (s *VerificationService) SendVerificationEmail(ctx context.Context, user *models.User) error {
+	if user.IsEmailVerified() {
+		return ErrEmailAlreadyVerified
+	}
+
+	token, err := s.CreateToken(ctx, user.ID, models.TokenPurposeEmailVerification)
+	if err != nil {
+		return err
+	}
+
+	subject, body := VerificationEmail(user.Name, token)
+	return s.enqueueEmail(user, subject, body, "email_verification")
+}
+
+// ResendVerification sends a fresh verification email to the account with the given email.
+// Unknown and already verified addresses are silently ignored so callers can't probe for accounts.
+func (s *VerificationService) ResendVerification(ctx context.Context, email string) error {
+	user, err := s.findUserByEmail(ctx, email)
+	if err != nil || user == nil || user.IsEmailVerified() {
+		return err
+	}
+
+	if s.recentlySent(ctx, user.ID, models.TokenPurposeEmailVerification) {
+		return nil
+	}
+
+	return s.SendVerificationEmail(ctx, user)
+}
+
+// VerifyEmail consumes a verification token and marks the owner's email as verified
+func (s *VerificationService) VerifyEmail(ctx context.Context, rawToken string) (*models.User, error) {
+	var user models.User
+	err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		token, err := s.consumeToken(tx, rawToken, models.TokenPurposeEmailVerification)
+		if err != nil {
+			return err
+		}
+
+		if err := tx.First(&user, token.UserID).Error; err != nil {
+			return fmt.Errorf("failed to load user: %w", err)
+		}
+
+		if user.EmailVerifiedAt == nil {
+			now := time.Now()
+			if err := tx.Model(&user).Update("email_verified_at", now).Error; err != nil {
+				return fmt.Errorf("failed to mark email verified: %w", err)
+			}
+			user.EmailVerifiedAt = &now
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	s.logger.LogBusinessEvent(ctx, "email_verified", zap.Uint("user_id", user.ID))
+	return &user, nil
+}
+
+// RequestPasswordReset emails a password reset link to the account with the given email.
+// Unknown addresses are silently ignored so callers can't probe for accounts.
+func (s *VerificationService) RequestPasswordReset(ctx context.Context, email string) error {
+	user, err := s.findUserByEmail(ctx, email)
+	if err != nil || user == nil || !user.IsActive {
+		return err
+	}
+
+	if s.recentlySent(ctx, user.ID, models.TokenPurposePasswordReset) {
+		return nil
+	}
+
+	if err := s.SendPasswordReset(ctx, user); err != nil {
+		return err
+	}
+
+	s.logger.LogSecurityEvent(ctx, "password_reset_requested", "low", zap.Uint("user_id", user.ID))
+	return nil
+}
+
+// SendPasswordReset issues a new password reset token and emails the link to the user,
+// without the resend cooldown applied to self-service requests
+func (s *VerificationService) SendPasswordReset(ctx context.Context, user *models.User) error {
+	token, err := s.CreateToken(ctx, user.ID, models.TokenPurposePasswordReset)
+	if err != nil {
+		return err
+	}
+
+	subject, body := PasswordResetEmail(token)
+	return s.enqueueEmail(user, subject, body, "password_reset")
+}
+
+// ResetPassword consumes a password reset token, sets the new password and signs the
+// user out everywhere. Completing a reset also proves ownership of the email address.
+// A password the policy refuses leaves the token unused.
+func (s *VerificationService) ResetPassword(ctx context.Context, rawToken, newPassword string) (*models.User, error) {
+	var user models.User
+	err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		token, err := s.consumeToken(tx, rawToken, models.TokenPurposePasswordReset)
+		if err != nil {
+			return err
+		}
+
+		if err := tx.First(&user, token.UserID).Error; err != nil {
+			return fmt.Errorf("failed to load user: %w", err)
+		}
+
+		if err := s.passwords.Validate(ctx, &user, newPassword); err != nil {
+			return err
+		}
+		if err := s.passwords.SetPassword(tx, &user, newPassword); err != nil {
+			return err
+		}
+
+		if user.EmailVerifiedAt == nil {
+			if err := tx.Model(&user).Update("email_verified_at", time.Now()).Error; err != nil {
+				return fmt.Errorf("failed to verify email: %w", err)
+			}
+		}
+
+		// Any other outstanding reset links are no longer valid
+		return tx.Model(&models.VerificationToken{}).
+			Where("user_id = ? AND purpose = ? AND used_at IS NULL", user.ID, models.TokenPurposePasswordReset).
+			Update("used_at", time.Now()).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.sessions.RevokeAllSessions(ctx, user.ID, "", models.SessionRevokedPasswordReset); err != nil {
+		return nil, err
+	}
+
+	s.logger.LogSecurityEvent(ctx, "password_reset_completed", "medium", zap.Uint("user_id", user.ID))
+	return &user, nil
+}
+
+// consumeToken marks a usable token as used. The conditional update guarantees a token
+// can only be consumed once even under concurrent requests.
+func (s *VerificationService) consumeToken(tx *gorm.DB, rawToken, purpose string) (*models.VerificationToken, error) {
+	var token models.VerificationToken
+	if err := tx.Where("token_hash = ? AND purpose = ?", utils.HashToken(rawToken), purpose).First(&token).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrInvalidVerificationToken
+		}
+		return nil, fmt.Errorf("failed to load token: %w", err)
+	}
+
+	if !token.IsUsable() {
+		return nil, ErrInvalidVerificationToken
+	}
+
+	result := tx.Model(&models.VerificationToken{}).
+		Where("id = ? AND used_at IS NULL", token.ID).
+		Update("used_at", time.Now())
+	if result.Error != nil {
+		return nil, fmt.Errorf("failed to consume token: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return nil, ErrInvalidVerificationToken
+	}
+
+	return &token, nil
+}
+
+// recentlySent reports whether a token of the given purpose was issued within the resend cooldown
+func (s *VerificationService) recentlySent(ctx context.Context, userID uint, purpose string) bool {
+	var count int64
+	s.db.WithContext(ctx).Model(&models.VerificationToken{}).
+		Where("user_id = ? AND purpose = ? AND created_at > ?", userID, purpose, time.Now().Add(-verificationResendCooldown)).
+		Count(&count)
+	return count > 0
+}
+
+func (s *VerificationService) findUserByEmail(ctx context.Context, email string) (*models.User, error) {
+	var user models.User
+	if err := s.db.WithContext(ctx).Where("LOWER(email) = ?", normalizeEmail(email)).First(&user).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to load user: %w", err)
+	}
+	return &user, nil
+}
+
+func (s *VerificationService) enqueueEmail(user *models.User, subject, body, template string) error {
+	_, err := s.jobQueue.EnqueueEmailNotification(EmailNotificationPayload{
+		UserID:   user.ID,
+		Email:    user.Email,
+		Subject:  subject,
+		Body:     body,
+		Template: template,
+		Priority: 1,
+	}, asynq.Queue("critical"), asynq.MaxRetry(5))
+	if err != nil {
+		return fmt.Errorf("failed to enqueue email: %w", err)
+	}
+	return nil
+}
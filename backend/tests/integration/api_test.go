@@ -1,3 +1,8 @@
+//go:build integration
+
+// These tests need PostgreSQL and Redis on localhost, so they only run with
+// -tags=integration (make test-integration).
+
 package integration
 
 import (
@@ -10,6 +15,7 @@ import (
 
 	"mobile-backend/config"
 	"mobile-backend/controllers"
+	"mobile-backend/middleware"
 	"mobile-backend/routes"
 	"mobile-backend/services"
 
@@ -37,7 +43,10 @@ func setupTestApp() *gin.Engine {
 	// Initialize services
 	cacheService := services.NewCacheService(redisClient)
 	cacheMetricsService := services.NewCacheMetricsService(redisClient)
-	authService := services.NewAuthService(config.GetDB(), cacheService)
+	tokenBlacklistService := services.NewTokenBlacklistService(redisClient)
+	authService := services.NewAuthService(config.GetDB(), cacheService, tokenBlacklistService, nil, nil, &config.Logger{Logger: zap.NewNop()})
+	jobQueueService := services.NewJobQueueService("localhost:6379", config.GetDB(), zap.NewNop())
+	verificationService := services.NewVerificationService(config.GetDB(), jobQueueService, tokenBlacklistService, nil, &config.Logger{Logger: zap.NewNop()})
 	oauth2Service := services.NewOAuth2Service(config.GetDB(), redisClient)
 
 	// Initialize subscription status service
@@ -48,24 +57,29 @@ func setupTestApp() *gin.Engine {
 	websocketService := services.NewWebSocketService(websocketHub, config.GetDB(), redisClient, cacheService, zap.NewNop())
 	stripeService := services.NewStripeService(config.GetDB(), cacheService, websocketService, subscriptionStatusService)
 	polarService := services.NewPolarService(config.GetDB(), cacheService, subscriptionStatusService)
+	paymentProviders := services.NewPaymentProviderRegistry("")
+	paymentProviders.Register(stripeService)
+	paymentProviders.Register(polarService)
 
 	// Initialize controllers
 	healthController := controllers.NewHealthController(config.GetDB())
-	authController := controllers.NewAuthController(authService)
-	userController := controllers.NewUserController(authService)
+	authController := controllers.NewAuthController(authService, verificationService, nil)
+	userController := controllers.NewUserController(authService, nil, nil)
 	uploadController := controllers.NewUploadController("./test-uploads")
 	generatorController := controllers.NewGeneratorController(config.GetDB())
 	oauth2Controller := controllers.NewOAuth2Controller(oauth2Service, authService)
-	cacheController := controllers.NewCacheController(cacheService, cacheMetricsService)
-	paymentController := controllers.NewPaymentController(stripeService, polarService, config.GetDB())
+	cacheController := controllers.NewCacheController(cacheService, cacheMetricsService, nil)
+	paymentController := controllers.NewPaymentController(paymentProviders, config.GetDB(), nil)
 	websocketController := controllers.NewWebSocketController(websocketService, websocketHub, zap.NewNop())
+	offlineSyncService := services.NewOfflineSyncService(config.GetDB(), redisClient, cacheService, websocketService, zap.NewNop())
+	offlineSyncController := controllers.NewOfflineSyncController(offlineSyncService, zap.NewNop())
 
 	// Setup Gin router
 	gin.SetMode(gin.TestMode)
 	r := gin.New()
 
 	// Setup routes
-	routes.SetupRoutes(r, healthController, authController, userController, uploadController, generatorController, oauth2Controller, cacheController, paymentController, websocketController)
+	routes.SetupRoutes(r, healthController, authController, userController, uploadController, generatorController, oauth2Controller, cacheController, paymentController, websocketController, offlineSyncController, middleware.NewRateLimiter(redisClient))
 
 	return r
 }
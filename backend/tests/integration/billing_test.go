@@ -0,0 +1,236 @@
+package integration
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"mobile-backend/controllers"
+	"mobile-backend/models"
+	"mobile-backend/routes"
+	"mobile-backend/services"
+	"mobile-backend/utils"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+// billingApp serves the payment routes backed by the fake payment provider, so full
+// billing flows run without a payment provider on the network
+type billingApp struct {
+	router *gin.Engine
+	db     *gorm.DB
+	fake   *services.FakePaymentProvider
+}
+
+func setupBillingApp(t *testing.T) *billingApp {
+	t.Setenv("JWT_SECRET", "test-secret")
+	gin.SetMode(gin.TestMode)
+
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	require.NoError(t, err)
+	require.NoError(t, db.AutoMigrate(
+		&models.User{},
+		&models.Product{},
+		&models.Plan{},
+		&models.Subscription{},
+		&models.Payment{},
+		&models.WebhookEvent{},
+	))
+
+	subscriptionStatusService := services.NewSubscriptionStatusService(db, zap.NewNop())
+	fake, err := services.NewFakePaymentProvider(db, subscriptionStatusService)
+	require.NoError(t, err)
+	providers := services.NewPaymentProviderRegistry("")
+	providers.Register(fake)
+
+	r := gin.New()
+	routes.SetupPaymentRoutes(r.Group("/api/v1"), controllers.NewPaymentController(providers, db, nil))
+	return &billingApp{router: r, db: db, fake: fake}
+}
+
+func (a *billingApp) createUser(t *testing.T, email string) (*models.User, string) {
+	user := &models.User{Email: email, Password: "password123", Name: "Billing User", IsActive: true}
+	require.NoError(t, a.db.Create(user).Error)
+	token, err := utils.GenerateToken(user.ID, user.Email)
+	require.NoError(t, err)
+	return user, token
+}
+
+func (a *billingApp) createPlan(t *testing.T, trialDays int) *models.Plan {
+	ctx := t.Context()
+	product, err := a.fake.CreateProduct(ctx, &models.Product{Name: "Pro", Price: 999, Currency: "usd", IsActive: true, IsRecurring: true})
+	require.NoError(t, err)
+	plan, err := a.fake.CreatePrice(ctx, &models.Plan{Name: "Pro monthly", ProductID: product.ID, Price: 999, Currency: "usd", Interval: "month", IsActive: true, TrialDays: trialDays})
+	require.NoError(t, err)
+	return plan
+}
+
+func (a *billingApp) request(t *testing.T, method, path, token string, body interface{}) (int, map[string]interface{}) {
+	var payload bytes.Buffer
+	if body != nil {
+		require.NoError(t, json.NewEncoder(&payload).Encode(body))
+	}
+	req := httptest.NewRequest(method, path, &payload)
+	req.Header.Set("Content-Type", "application/json")
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	w := httptest.NewRecorder()
+	a.router.ServeHTTP(w, req)
+
+	var response struct {
+		Data map[string]interface{} `json:"data"`
+	}
+	_ = json.Unmarshal(w.Body.Bytes(), &response)
+	return w.Code, response.Data
+}
+
+// sendWebhook posts a signed fake provider webhook and returns the status code
+func (a *billingApp) sendWebhook(t *testing.T, payload []byte, signature string) int {
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/webhooks/fake", bytes.NewReader(payload))
+	req.Header.Set(a.fake.WebhookSignatureHeader(), signature)
+	w := httptest.NewRecorder()
+	a.router.ServeHTTP(w, req)
+	return w.Code
+}
+
+func (a *billingApp) webhook(t *testing.T, eventType, providerID string) int {
+	payload, signature, err := a.fake.NewWebhook(eventType, providerID)
+	require.NoError(t, err)
+	return a.sendWebhook(t, payload, signature)
+}
+
+func (a *billingApp) reloadUser(t *testing.T, id uint) models.User {
+	var user models.User
+	require.NoError(t, a.db.First(&user, id).Error)
+	return user
+}
+
+func TestBilling_OneTimePayment(t *testing.T) {
+	app := setupBillingApp(t)
+	_, token := app.createUser(t, "buyer@example.com")
+	plan := app.createPlan(t, 0)
+
+	code, data := app.request(t, http.MethodPost, "/api/v1/payments", token, map[string]interface{}{
+		"product_id":     plan.ProductID,
+		"amount":         999,
+		"currency":       "usd",
+		"payment_method": services.FakePaymentProviderName,
+	})
+	require.Equal(t, http.StatusOK, code)
+	assert.Equal(t, "pending", data["status"])
+	providerID := data["provider_payment_id"].(string)
+
+	payload, signature, err := app.fake.NewWebhook(services.FakeEventPaymentSucceeded, providerID)
+	require.NoError(t, err)
+	assert.NotEqual(t, http.StatusOK, app.sendWebhook(t, payload, "forged"), "unsigned webhooks are rejected")
+	require.Equal(t, http.StatusOK, app.sendWebhook(t, payload, signature))
+
+	var payment models.Payment
+	require.NoError(t, app.db.Where("provider_payment_id = ?", providerID).First(&payment).Error)
+	assert.Equal(t, "succeeded", payment.Status)
+
+	// A redelivered event is acknowledged but not applied again
+	require.NoError(t, app.db.Model(&payment).Update("status", "refunded").Error)
+	assert.Equal(t, http.StatusOK, app.sendWebhook(t, payload, signature))
+	require.NoError(t, app.db.First(&payment, payment.ID).Error)
+	assert.Equal(t, "refunded", payment.Status)
+
+	code, _ = app.request(t, http.MethodPost, "/api/v1/payments", token, map[string]interface{}{
+		"product_id":     plan.ProductID,
+		"amount":         999,
+		"currency":       "usd",
+		"payment_method": "paypal",
+	})
+	assert.Equal(t, http.StatusBadRequest, code, "unregistered providers are refused")
+
+	code, _ = app.request(t, http.MethodPost, "/api/v1/webhooks/paypal", "", nil)
+	assert.Equal(t, http.StatusNotFound, code)
+}
+
+func TestBilling_SubscriptionLifecycle(t *testing.T) {
+	app := setupBillingApp(t)
+	user, token := app.createUser(t, "subscriber@example.com")
+	plan := app.createPlan(t, 0)
+
+	code, data := app.request(t, http.MethodPost, "/api/v1/subscriptions", token, map[string]interface{}{
+		"plan_id":        plan.ID,
+		"payment_method": services.FakePaymentProviderName,
+	})
+	require.Equal(t, http.StatusOK, code)
+	assert.Equal(t, "active", data["status"])
+	providerID := data["provider_subscription_id"].(string)
+	subscriptionID := uint(data["id"].(float64))
+	assert.True(t, app.reloadUser(t, user.ID).IsPro)
+
+	var sub models.Subscription
+	require.NoError(t, app.db.First(&sub, subscriptionID).Error)
+	firstPeriodEnd := sub.CurrentPeriodEnd
+
+	// Renewal charges the next period
+	require.Equal(t, http.StatusOK, app.webhook(t, services.FakeEventSubscriptionRenewed, providerID))
+	require.NoError(t, app.db.First(&sub, subscriptionID).Error)
+	assert.WithinDuration(t, firstPeriodEnd, sub.CurrentPeriodStart, 0)
+	assert.True(t, sub.CurrentPeriodEnd.After(firstPeriodEnd))
+
+	var charges int64
+	require.NoError(t, app.db.Model(&models.Payment{}).Where("subscription_id = ? AND status = ?", subscriptionID, "succeeded").Count(&charges).Error)
+	assert.EqualValues(t, 2, charges)
+
+	// A declined renewal makes the subscription past due, and a later one restores it
+	require.Equal(t, http.StatusOK, app.webhook(t, services.FakeEventSubscriptionPaymentFailed, providerID))
+	require.NoError(t, app.db.First(&sub, subscriptionID).Error)
+	assert.Equal(t, "past_due", sub.Status)
+	assert.False(t, app.reloadUser(t, user.ID).IsPro)
+
+	require.Equal(t, http.StatusOK, app.webhook(t, services.FakeEventSubscriptionRenewed, providerID))
+	assert.True(t, app.reloadUser(t, user.ID).IsPro)
+
+	code, _ = app.request(t, http.MethodPost, fmt.Sprintf("/api/v1/subscriptions/%d/cancel", subscriptionID), token, map[string]interface{}{"immediately": true})
+	require.Equal(t, http.StatusOK, code)
+	require.NoError(t, app.db.First(&sub, subscriptionID).Error)
+	assert.Equal(t, "canceled", sub.Status)
+	assert.False(t, app.reloadUser(t, user.ID).IsPro)
+}
+
+func TestBilling_TrialAndDeclinedCard(t *testing.T) {
+	app := setupBillingApp(t)
+	trialUser, trialToken := app.createUser(t, "trial@example.com")
+	declinedUser, declinedToken := app.createUser(t, "declined@example.com")
+
+	code, data := app.request(t, http.MethodPost, "/api/v1/subscriptions", trialToken, map[string]interface{}{
+		"plan_id":        app.createPlan(t, 14).ID,
+		"payment_method": services.FakePaymentProviderName,
+	})
+	require.Equal(t, http.StatusOK, code)
+	assert.Equal(t, "trialing", data["status"])
+	assert.Equal(t, "trial", app.reloadUser(t, trialUser.ID).SubscriptionStatus)
+
+	var charges int64
+	require.NoError(t, app.db.Model(&models.Payment{}).Where("user_id = ?", trialUser.ID).Count(&charges).Error)
+	assert.Zero(t, charges, "trials start without a charge")
+
+	code, data = app.request(t, http.MethodPost, "/api/v1/subscriptions", declinedToken, map[string]interface{}{
+		"plan_id":           app.createPlan(t, 0).ID,
+		"payment_method":    services.FakePaymentProviderName,
+		"payment_method_id": services.FakeDeclinedPaymentMethod,
+	})
+	require.Equal(t, http.StatusOK, code)
+	assert.Equal(t, "incomplete", data["status"])
+	assert.False(t, app.reloadUser(t, declinedUser.ID).IsPro)
+
+	var failed models.Payment
+	require.NoError(t, app.db.Where("user_id = ?", declinedUser.ID).First(&failed).Error)
+	assert.Equal(t, "failed", failed.Status)
+
+	code, _ = app.request(t, http.MethodPost, fmt.Sprintf("/api/v1/subscriptions/%d/cancel", uint(data["id"].(float64))), trialToken, map[string]interface{}{})
+	assert.Equal(t, http.StatusNotFound, code, "users can only cancel their own subscriptions")
+}
@@ -1,3 +1,8 @@
+//go:build integration
+
+// These tests need Redis on localhost, so they only run with -tags=integration
+// (make test-integration).
+
 package integration
 
 import (
@@ -16,12 +21,13 @@ import (
 	"gorm.io/driver/sqlite"
 	"gorm.io/gorm"
 
-	"mobile-backend-template/controllers"
-	"mobile-backend-template/middleware"
-	"mobile-backend-template/models"
-	"mobile-backend-template/routes"
-	"mobile-backend-template/services"
-	"mobile-backend-template/utils"
+	"mobile-backend/config"
+	"mobile-backend/controllers"
+	"mobile-backend/middleware"
+	"mobile-backend/models"
+	"mobile-backend/routes"
+	"mobile-backend/services"
+	"mobile-backend/utils"
 )
 
 func setupIntegrationTest() (*gin.Engine, *gorm.DB, *redis.Client, func()) {
@@ -52,13 +58,16 @@ func setupIntegrationTest() (*gin.Engine, *gorm.DB, *redis.Client, func()) {
 
 	// Initialize services
 	cacheService := services.NewCacheService(redisClient)
-	authService := services.NewAuthService(db, cacheService)
+	tokenBlacklistService := services.NewTokenBlacklistService(redisClient)
+	authService := services.NewAuthService(db, cacheService, tokenBlacklistService, nil, nil, &config.Logger{Logger: logger})
+	jobQueueService := services.NewJobQueueService("localhost:6379", db, logger)
+	verificationService := services.NewVerificationService(db, jobQueueService, tokenBlacklistService, nil, &config.Logger{Logger: logger})
 	websocketHub := services.NewHub(logger)
 	websocketService := services.NewWebSocketService(websocketHub, db, redisClient, cacheService, logger)
 	offlineSyncService := services.NewOfflineSyncService(db, redisClient, cacheService, websocketService, logger)
 
 	// Initialize controllers
-	authController := controllers.NewAuthController(authService)
+	authController := controllers.NewAuthController(authService, verificationService, nil)
 	offlineSyncController := controllers.NewOfflineSyncController(offlineSyncService, logger)
 
 	// Setup Gin router
@@ -100,13 +109,13 @@ func createTestUser(db *gorm.DB) (*models.User, string) {
 	db.Create(user)
 
 	// Create JWT token
-	token, _ := utils.GenerateJWT(user.ID, "test@example.com")
+	token, _ := utils.GenerateToken(user.ID, "test@example.com")
 
 	return user, token
 }
 
 func TestOfflineSyncAPI_QueueOperation(t *testing.T) {
-	router, db, redisClient, cleanup := setupIntegrationTest()
+	router, db, _, cleanup := setupIntegrationTest()
 	defer cleanup()
 
 	// Create test user
@@ -149,7 +158,7 @@ func TestOfflineSyncAPI_QueueOperation(t *testing.T) {
 }
 
 func TestOfflineSyncAPI_GetSyncStatus(t *testing.T) {
-	router, db, redisClient, cleanup := setupIntegrationTest()
+	router, db, _, cleanup := setupIntegrationTest()
 	defer cleanup()
 
 	// Create test user
@@ -189,7 +198,7 @@ func TestOfflineSyncAPI_GetSyncStatus(t *testing.T) {
 }
 
 func TestOfflineSyncAPI_SyncUserData(t *testing.T) {
-	router, db, redisClient, cleanup := setupIntegrationTest()
+	router, db, _, cleanup := setupIntegrationTest()
 	defer cleanup()
 
 	// Create test user
@@ -243,11 +252,11 @@ func TestOfflineSyncAPI_SyncUserData(t *testing.T) {
 }
 
 func TestOfflineSyncAPI_ForceSync(t *testing.T) {
-	router, db, redisClient, cleanup := setupIntegrationTest()
+	router, db, _, cleanup := setupIntegrationTest()
 	defer cleanup()
 
 	// Create test user
-	user, token := createTestUser(db)
+	_, token := createTestUser(db)
 
 	// Test force sync
 	req, _ := http.NewRequest("POST", "/api/v1/sync/force", nil)
@@ -271,7 +280,7 @@ func TestOfflineSyncAPI_ForceSync(t *testing.T) {
 }
 
 func TestOfflineSyncAPI_GetPendingOperations(t *testing.T) {
-	router, db, redisClient, cleanup := setupIntegrationTest()
+	router, db, _, cleanup := setupIntegrationTest()
 	defer cleanup()
 
 	// Create test user
@@ -324,7 +333,7 @@ func TestOfflineSyncAPI_GetPendingOperations(t *testing.T) {
 }
 
 func TestOfflineSyncAPI_GetConflicts(t *testing.T) {
-	router, db, redisClient, cleanup := setupIntegrationTest()
+	router, db, _, cleanup := setupIntegrationTest()
 	defer cleanup()
 
 	// Create test user
@@ -368,7 +377,7 @@ func TestOfflineSyncAPI_GetConflicts(t *testing.T) {
 }
 
 func TestOfflineSyncAPI_ResolveConflict(t *testing.T) {
-	router, db, redisClient, cleanup := setupIntegrationTest()
+	router, db, _, cleanup := setupIntegrationTest()
 	defer cleanup()
 
 	// Create test user
@@ -410,7 +419,7 @@ func TestOfflineSyncAPI_ResolveConflict(t *testing.T) {
 }
 
 func TestOfflineSyncAPI_SetUserOnline(t *testing.T) {
-	router, db, redisClient, cleanup := setupIntegrationTest()
+	router, db, _, cleanup := setupIntegrationTest()
 	defer cleanup()
 
 	// Create test user
@@ -443,7 +452,7 @@ func TestOfflineSyncAPI_SetUserOnline(t *testing.T) {
 }
 
 func TestOfflineSyncAPI_SetUserOffline(t *testing.T) {
-	router, db, redisClient, cleanup := setupIntegrationTest()
+	router, db, _, cleanup := setupIntegrationTest()
 	defer cleanup()
 
 	// Create test user
@@ -484,7 +493,7 @@ func TestOfflineSyncAPI_SetUserOffline(t *testing.T) {
 }
 
 func TestOfflineSyncAPI_GetSyncHistory(t *testing.T) {
-	router, db, redisClient, cleanup := setupIntegrationTest()
+	router, db, _, cleanup := setupIntegrationTest()
 	defer cleanup()
 
 	// Create test user
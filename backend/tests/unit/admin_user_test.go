@@ -0,0 +1,183 @@
+package unit
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"testing"
+	"time"
+
+	"mobile-backend/config"
+	"mobile-backend/middleware"
+	"mobile-backend/models"
+	"mobile-backend/services"
+	"mobile-backend/utils"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func setupAdminUsers(t *testing.T) (*gorm.DB, *services.AdminUserService) {
+	t.Setenv("JWT_SECRET", "test-secret")
+
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	require.NoError(t, err)
+	require.NoError(t, db.AutoMigrate(
+		&models.User{}, &models.Session{}, &models.Role{}, &models.Permission{}, &models.UserRole{},
+		&models.Product{}, &models.Plan{}, &models.Subscription{}, &models.DeviceToken{}, &models.SyncStatus{},
+		&models.AuditEvent{}, &models.BulkUserAction{}, &models.UserDevice{},
+	))
+	require.NoError(t, services.NewRoleService(db).EnsureDefaultRoles(context.Background()))
+
+	logger := &config.Logger{Logger: zap.NewNop()}
+	return db, services.NewAdminUserService(db, nil, nil, nil, services.NewAuditService(db, logger), logger)
+}
+
+func createAdminTestUser(t *testing.T, db *gorm.DB, email, name string, createdAt time.Time) *models.User {
+	user := &models.User{Email: email, Password: "password123", Name: name, IsActive: true}
+	require.NoError(t, db.Create(user).Error)
+	require.NoError(t, db.Model(user).Update("created_at", createdAt).Error)
+	return user
+}
+
+// userListQuery parses a query string the way the list users endpoint does
+func userListQuery(query string) utils.PaginationRequest {
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Request = httptest.NewRequest(http.MethodGet, "/admin/users?"+query, nil)
+	return utils.GetPaginationFromQuery(c)
+}
+
+func TestAdminUserService_ListUsers(t *testing.T) {
+	db, service := setupAdminUsers(t)
+	ctx := context.Background()
+
+	start := time.Now().Add(-time.Hour)
+	ada := createAdminTestUser(t, db, "ada@example.com", "Ada Lovelace", start)
+	grace := createAdminTestUser(t, db, "grace@example.com", "Grace Hopper", start.Add(time.Minute))
+	alan := createAdminTestUser(t, db, "alan@turing.org", "Alan Turing", start.Add(2*time.Minute))
+	require.NoError(t, db.Model(grace).Updates(map[string]interface{}{"is_pro": true, "subscription_status": "active"}).Error)
+	require.NoError(t, services.NewRoleService(db).AssignRole(ctx, alan.ID, models.RoleAdmin, nil))
+
+	list := func(req utils.PaginationRequest) []uint {
+		users, _, err := service.ListUsers(ctx, req)
+		require.NoError(t, err)
+		ids := make([]uint, 0, len(users))
+		for _, user := range users {
+			ids = append(ids, user.ID)
+		}
+		return ids
+	}
+
+	// Defaults: newest first
+	assert.Equal(t, []uint{alan.ID, grace.ID, ada.ID}, list(userListQuery("")))
+	assert.Equal(t, []uint{ada.ID, alan.ID, grace.ID}, list(userListQuery("sort=email&order=asc")))
+	assert.Equal(t, []uint{grace.ID, alan.ID, ada.ID}, list(userListQuery("sort=name:desc,password:asc")), "unknown sort fields are dropped")
+
+	// Search is case-insensitive over email and name
+	assert.Equal(t, []uint{alan.ID}, list(userListQuery("search=TURING")))
+	assert.Equal(t, []uint{grace.ID, ada.ID}, list(userListQuery("search=example.com")))
+
+	// Filters
+	assert.Equal(t, []uint{grace.ID}, list(userListQuery("is_pro=true&subscription_status=active")))
+	assert.Equal(t, []uint{alan.ID}, list(userListQuery("role=admin")))
+	assert.Equal(t, []uint{alan.ID, grace.ID}, list(userListQuery("created_after="+url.QueryEscape(start.Add(time.Minute).Format(time.RFC3339Nano)))))
+
+	// Paging reports the total across all pages
+	users, total, err := service.ListUsers(ctx, userListQuery("limit=2&page=2"))
+	require.NoError(t, err)
+	assert.EqualValues(t, 3, total)
+	require.Len(t, users, 1)
+	assert.Equal(t, ada.ID, users[0].ID)
+
+	_, _, err = service.ListUsers(ctx, userListQuery("is_active=maybe"))
+	assert.ErrorIs(t, err, services.ErrInvalidUserFilter)
+}
+
+func TestAdminUserService_SuspendRefusesTokens(t *testing.T) {
+	db, service := setupAdminUsers(t)
+	ctx := context.Background()
+	middleware.SetUserStatusChecker(service)
+	t.Cleanup(func() { middleware.SetUserStatusChecker(nil) })
+
+	admin := createAdminTestUser(t, db, "admin@example.com", "Admin", time.Now())
+	user := createAdminTestUser(t, db, "user@example.com", "User", time.Now())
+	require.NoError(t, db.Create(&models.DeviceToken{UserID: user.ID, Token: "device-1", Platform: "ios", IsActive: true}).Error)
+
+	token, _, err := utils.GenerateAccessAndRefreshTokens(user.ID, user.Email)
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusOK, performAuthRequest(token))
+
+	_, err = service.SuspendUser(ctx, admin.ID, admin.ID, "testing")
+	assert.ErrorIs(t, err, services.ErrCannotSuspendSelf)
+	_, err = service.SuspendUser(ctx, 9999, admin.ID, "testing")
+	assert.ErrorIs(t, err, services.ErrUserNotFound)
+
+	suspended, err := service.SuspendUser(ctx, user.ID, admin.ID, "chargeback fraud")
+	require.NoError(t, err)
+	assert.False(t, suspended.IsActive)
+	assert.Equal(t, http.StatusForbidden, performAuthRequest(token), "tokens of suspended users are refused")
+
+	overview, err := service.GetUserOverview(ctx, user.ID)
+	require.NoError(t, err)
+	assert.NotNil(t, overview.User.SuspendedAt)
+	assert.Equal(t, "chargeback fraud", overview.User.SuspensionReason)
+	require.Len(t, overview.PushTokens, 1)
+	assert.Nil(t, overview.SyncStatus)
+
+	_, err = service.ReactivateUser(ctx, user.ID, admin.ID)
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusOK, performAuthRequest(token))
+
+	active, err := service.IsUserActive(ctx, 9999)
+	require.NoError(t, err)
+	assert.False(t, active, "deleted or unknown users are not active")
+}
+
+func TestAdminUserService_ProcessBulkAction(t *testing.T) {
+	db, service := setupAdminUsers(t)
+	ctx := context.Background()
+
+	admin := createAdminTestUser(t, db, "admin@example.com", "Admin", time.Now())
+	first := createAdminTestUser(t, db, "first@example.com", "First", time.Now())
+	second := createAdminTestUser(t, db, "second@example.com", "Second", time.Now())
+
+	bulk := &models.BulkUserAction{
+		ActorID: admin.ID,
+		Action:  models.BulkUserActionSuspend,
+		Reason:  "spam wave",
+		Status:  models.BulkUserActionPending,
+		UserIDs: []uint{first.ID, second.ID, admin.ID, 9999},
+	}
+	require.NoError(t, db.Create(bulk).Error)
+
+	require.NoError(t, service.ProcessBulkAction(ctx, bulk.ID))
+	require.NoError(t, service.ProcessBulkAction(ctx, bulk.ID), "finished actions are skipped")
+
+	done, err := service.GetBulkAction(ctx, bulk.ID)
+	require.NoError(t, err)
+	assert.Equal(t, models.BulkUserActionCompleted, done.Status)
+	assert.Equal(t, 2, done.Succeeded)
+	assert.Equal(t, 2, done.Failed)
+	assert.Equal(t, models.BulkUserActionResultOK, done.Results[strconv.Itoa(int(first.ID))])
+	assert.Equal(t, services.ErrCannotSuspendSelf.Error(), done.Results[strconv.Itoa(int(admin.ID))])
+	assert.Equal(t, services.ErrUserNotFound.Error(), done.Results["9999"])
+
+	var suspended int64
+	require.NoError(t, db.Model(&models.User{}).Where("is_active = ?", false).Count(&suspended).Error)
+	assert.EqualValues(t, 2, suspended)
+
+	var events []models.AuditEvent
+	require.NoError(t, db.Where("action = ?", models.AuditActionUserSuspended).Find(&events).Error)
+	require.Len(t, events, 2, "each affected user is audited")
+	assert.Equal(t, admin.ID, *events[0].ActorID)
+	assert.Equal(t, "spam wave", events[0].Metadata["reason"])
+
+	_, err = service.GetBulkAction(ctx, 9999)
+	assert.ErrorIs(t, err, services.ErrBulkActionNotFound)
+}
@@ -0,0 +1,108 @@
+package unit
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"mobile-backend/config"
+	"mobile-backend/middleware"
+	"mobile-backend/models"
+	"mobile-backend/services"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func setupAPIKeyService(t *testing.T) (*services.APIKeyService, *models.User) {
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	require.NoError(t, err)
+	require.NoError(t, db.AutoMigrate(&models.User{}, &models.APIKey{}))
+
+	user := &models.User{Email: "server@example.com", Password: "password123", Name: "Server", IsActive: true}
+	require.NoError(t, db.Create(user).Error)
+
+	return services.NewAPIKeyService(db, &config.Logger{Logger: zap.NewNop()}), user
+}
+
+func TestAPIKeyService_CreateAndAuthenticate(t *testing.T) {
+	service, user := setupAPIKeyService(t)
+	ctx := context.Background()
+
+	key, raw, err := service.CreateKey(ctx, user.ID, nil, "CI", []string{models.APIKeyScopeSync}, nil)
+	require.NoError(t, err)
+	assert.Regexp(t, `^mbk_[0-9a-f]{12}_[0-9a-f]{64}$`, raw)
+	assert.True(t, strings.HasPrefix(raw, key.Prefix+"_"))
+	assert.NotContains(t, key.KeyHash, raw)
+
+	authenticated, err := service.AuthenticateAPIKey(ctx, raw, "10.0.0.1")
+	require.NoError(t, err)
+	assert.Equal(t, user.ID, authenticated.UserID)
+	assert.True(t, authenticated.HasScope(models.APIKeyScopeSync))
+
+	keys, err := service.ListKeys(ctx, user.ID)
+	require.NoError(t, err)
+	require.Len(t, keys, 1)
+	assert.NotNil(t, keys[0].LastUsedAt)
+	assert.Equal(t, "10.0.0.1", keys[0].LastUsedIP)
+
+	// A key with the right prefix but the wrong secret is rejected
+	_, err = service.AuthenticateAPIKey(ctx, key.Prefix+"_"+"0000", "10.0.0.1")
+	assert.ErrorIs(t, err, services.ErrInvalidAPIKey)
+
+	require.NoError(t, service.RevokeKey(ctx, user.ID, key.ID))
+	_, err = service.AuthenticateAPIKey(ctx, raw, "10.0.0.1")
+	assert.ErrorIs(t, err, services.ErrInvalidAPIKey)
+	assert.ErrorIs(t, service.RevokeKey(ctx, user.ID, key.ID), services.ErrAPIKeyNotFound)
+}
+
+func TestAPIKeyService_RejectsUnknownScopesAndPastExpiry(t *testing.T) {
+	service, user := setupAPIKeyService(t)
+	ctx := context.Background()
+
+	_, _, err := service.CreateKey(ctx, user.ID, nil, "CI", []string{"admin"}, nil)
+	assert.ErrorIs(t, err, services.ErrInvalidAPIKeyScope)
+
+	past := time.Now().Add(-time.Hour)
+	_, _, err = service.CreateKey(ctx, user.ID, nil, "CI", []string{models.APIKeyScopeSync}, &past)
+	assert.ErrorIs(t, err, services.ErrInvalidAPIKeyExpiry)
+}
+
+func TestAuthOrAPIKeyMiddleware_EnforcesScopes(t *testing.T) {
+	service, user := setupAPIKeyService(t)
+	middleware.SetAPIKeyAuthenticator(service)
+	t.Cleanup(func() { middleware.SetAPIKeyAuthenticator(nil) })
+
+	_, raw, err := service.CreateKey(context.Background(), user.ID, nil, "CI", []string{models.APIKeyScopeSync}, nil)
+	require.NoError(t, err)
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(middleware.AuthOrAPIKeyMiddleware())
+	handler := func(c *gin.Context) { c.JSON(http.StatusOK, gin.H{"user_id": c.GetUint("user_id")}) }
+	r.GET("/sync", middleware.RequireAPIKeyScope(models.APIKeyScopeSync), handler)
+	r.GET("/profile", middleware.RequireAPIKeyScope(models.APIKeyScopeProfile), handler)
+
+	perform := func(path, key string) int {
+		req, _ := http.NewRequest("GET", path, nil)
+		if key != "" {
+			req.Header.Set(middleware.APIKeyHeader, key)
+		}
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	assert.Equal(t, http.StatusOK, perform("/sync", raw))
+	assert.Equal(t, http.StatusForbidden, perform("/profile", raw))
+	assert.Equal(t, http.StatusUnauthorized, perform("/sync", "mbk_unknown_key"))
+	// Without a key the request falls through to bearer token authentication
+	assert.Equal(t, http.StatusUnauthorized, perform("/sync", ""))
+}
@@ -0,0 +1,172 @@
+package unit
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"mobile-backend/config"
+	"mobile-backend/controllers"
+	"mobile-backend/models"
+	"mobile-backend/services"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func setupAuditService(t *testing.T) (*services.AuditService, *gorm.DB) {
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	require.NoError(t, err)
+	require.NoError(t, db.AutoMigrate(&models.AuditEvent{}))
+
+	return services.NewAuditService(db, &config.Logger{Logger: zap.NewNop()}), db
+}
+
+func recordAuditEvent(service *services.AuditService, actorID uint, action string) {
+	service.Record(context.Background(), &models.AuditEvent{
+		ActorID:      &actorID,
+		Action:       action,
+		ResourceType: "user",
+		ResourceID:   "42",
+		Before:       models.JSONMap{"quantity": 1, "plan": map[string]interface{}{"id": 3}},
+		After:        models.JSONMap{"quantity": 2},
+		IPAddress:    "203.0.113.7",
+	})
+}
+
+func TestAuditService_ChainsAndDetectsTampering(t *testing.T) {
+	service, db := setupAuditService(t)
+	ctx := context.Background()
+
+	recordAuditEvent(service, 1, models.AuditActionLogin)
+	recordAuditEvent(service, 1, models.AuditActionProfileUpdated)
+	recordAuditEvent(service, 2, models.AuditActionRoleAssigned)
+
+	var events []models.AuditEvent
+	require.NoError(t, db.Order("id").Find(&events).Error)
+	require.Len(t, events, 3)
+	assert.Empty(t, events[0].PrevHash)
+	assert.Equal(t, events[0].Hash, events[1].PrevHash)
+	assert.Equal(t, events[1].Hash, events[2].PrevHash)
+	assert.Equal(t, models.AuditActorUser, events[0].ActorType)
+
+	verification, err := service.VerifyChain(ctx)
+	require.NoError(t, err)
+	assert.True(t, verification.Valid)
+	assert.Equal(t, int64(3), verification.EventsChecked)
+
+	// The model refuses changes; going around it is caught by verification
+	events[1].ActorEmail = "someone-else@example.com"
+	assert.ErrorIs(t, db.Save(&events[1]).Error, models.ErrAuditEventImmutable)
+	assert.ErrorIs(t, db.Delete(&events[1]).Error, models.ErrAuditEventImmutable)
+
+	require.NoError(t, db.Exec("UPDATE audit_events SET after = ? WHERE id = ?", `{"quantity":5}`, events[1].ID).Error)
+	verification, err = service.VerifyChain(ctx)
+	require.NoError(t, err)
+	assert.False(t, verification.Valid)
+	require.NotNil(t, verification.FirstInvalidID)
+	assert.Equal(t, events[1].ID, *verification.FirstInvalidID)
+}
+
+func TestAuditService_DetectsRemovedEvents(t *testing.T) {
+	service, db := setupAuditService(t)
+
+	recordAuditEvent(service, 1, models.AuditActionLogin)
+	recordAuditEvent(service, 1, models.AuditActionLogout)
+	recordAuditEvent(service, 1, models.AuditActionLogin)
+
+	require.NoError(t, db.Exec("DELETE FROM audit_events WHERE id = 2").Error)
+	verification, err := service.VerifyChain(context.Background())
+	require.NoError(t, err)
+	assert.False(t, verification.Valid)
+	require.NotNil(t, verification.FirstInvalidID)
+	assert.Equal(t, uint(3), *verification.FirstInvalidID)
+}
+
+func TestAuditService_ListEventsFilters(t *testing.T) {
+	service, _ := setupAuditService(t)
+	ctx := context.Background()
+
+	recordAuditEvent(service, 1, models.AuditActionLogin)
+	recordAuditEvent(service, 1, models.AuditActionLoginFailed)
+	recordAuditEvent(service, 2, models.AuditActionRoleAssigned)
+	recordAuditEvent(service, 2, "authz.checked")
+
+	events, total, err := service.ListEvents(ctx, services.AuditFilter{Action: "auth.*"})
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), total)
+	require.Len(t, events, 2)
+	assert.Equal(t, models.AuditActionLoginFailed, events[0].Action, "newest first")
+
+	actorID := uint(2)
+	_, total, err = service.ListEvents(ctx, services.AuditFilter{ActorID: &actorID, Action: models.AuditActionRoleAssigned})
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), total)
+
+	events, total, err = service.ListEvents(ctx, services.AuditFilter{Limit: 3, Page: 2})
+	require.NoError(t, err)
+	assert.Equal(t, int64(4), total)
+	assert.Len(t, events, 1)
+
+	_, _, err = service.ListEvents(ctx, services.AuditFilter{Action: "auth.*.*"})
+	assert.ErrorIs(t, err, services.ErrInvalidAuditFilter)
+}
+
+func TestAuditController_ExportEvents(t *testing.T) {
+	service, _ := setupAuditService(t)
+	recordAuditEvent(service, 1, models.AuditActionLogin)
+	recordAuditEvent(service, 2, models.AuditActionCacheCleared)
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	controller := controllers.NewAuditController(service, zap.NewNop())
+	r.GET("/audit-events/export", controller.ExportEvents)
+
+	perform := func(query string) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest("GET", "/audit-events/export"+query, nil)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	w := perform("?action=auth.*")
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Header().Get("Content-Disposition"), ".csv")
+	rows, err := csv.NewReader(strings.NewReader(w.Body.String())).ReadAll()
+	require.NoError(t, err)
+	require.Len(t, rows, 2)
+	assert.Equal(t, "action", rows[0][5])
+	assert.Equal(t, models.AuditActionLogin, rows[1][5])
+
+	w = perform("?format=json")
+	require.Equal(t, http.StatusOK, w.Code)
+	var exported []models.AuditEvent
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &exported))
+	require.Len(t, exported, 2)
+	assert.Equal(t, exported[0].Hash, exported[1].PrevHash)
+
+	w = perform("?format=json&action=billing.*")
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `[]`, w.Body.String())
+
+	assert.Equal(t, http.StatusBadRequest, perform("?format=xml").Code)
+	assert.Equal(t, http.StatusBadRequest, perform("?from=yesterday").Code)
+}
+
+func TestAuditDiff_KeepsOnlyChangedFields(t *testing.T) {
+	before, after := models.AuditDiff(
+		map[string]interface{}{"name": "Ada", "status": "active", "plan_id": uint(1)},
+		map[string]interface{}{"name": "Ada", "status": "canceled", "canceled_at": "2026-01-01"},
+	)
+
+	assert.Equal(t, models.JSONMap{"status": "active", "plan_id": uint(1)}, before)
+	assert.Equal(t, models.JSONMap{"status": "canceled", "canceled_at": "2026-01-01"}, after)
+}
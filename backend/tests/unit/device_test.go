@@ -0,0 +1,121 @@
+package unit
+
+import (
+	"context"
+	"testing"
+
+	"mobile-backend/config"
+	"mobile-backend/models"
+	"mobile-backend/services"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func setupDeviceService(t *testing.T) (*gorm.DB, *services.DeviceService) {
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	require.NoError(t, err)
+	require.NoError(t, db.AutoMigrate(&models.User{}, &models.Session{}, &models.UserDevice{}, &models.DeviceToken{}))
+
+	return db, services.NewDeviceService(db, nil, nil, nil, &config.Logger{Logger: zap.NewNop()})
+}
+
+func TestDeviceService_RecordLogin(t *testing.T) {
+	_, service := setupDeviceService(t)
+	ctx := context.Background()
+
+	phone := services.SessionMetadata{
+		UserAgent:  "MyApp/2.1 CFNetwork/1410 Darwin/22.6.0",
+		IPAddress:  "203.0.113.7",
+		DeviceID:   "phone-1",
+		DeviceName: "Ada's iPhone",
+		AppVersion: "2.1.0",
+	}
+	device, isNew, err := service.RecordLogin(ctx, 1, phone)
+	require.NoError(t, err)
+	assert.True(t, isNew)
+	assert.Equal(t, "Ada's iPhone", device.Name)
+	assert.Equal(t, models.PlatformIOS, device.Platform, "the platform is guessed from the user agent")
+
+	// Logging in again from the same device updates it
+	phone.IPAddress = "198.51.100.4"
+	phone.AppVersion = "2.2.0"
+	again, isNew, err := service.RecordLogin(ctx, 1, phone)
+	require.NoError(t, err)
+	assert.False(t, isNew)
+	assert.Equal(t, device.ID, again.ID)
+
+	devices, err := service.ListDevices(ctx, 1)
+	require.NoError(t, err)
+	require.Len(t, devices, 1)
+	assert.Equal(t, "198.51.100.4", devices[0].LastIP)
+	assert.Equal(t, "2.2.0", devices[0].AppVersion)
+
+	// Without a device ID the user agent identifies the device
+	browser := services.SessionMetadata{UserAgent: "Mozilla/5.0 (Macintosh)", Platform: "WEB"}
+	web, isNew, err := service.RecordLogin(ctx, 1, browser)
+	require.NoError(t, err)
+	assert.True(t, isNew)
+	assert.Equal(t, models.PlatformWeb, web.Platform)
+	assert.Equal(t, "Web browser", web.Name)
+
+	// Devices are tracked per user
+	_, isNew, err = service.RecordLogin(ctx, 2, phone)
+	require.NoError(t, err)
+	assert.True(t, isNew)
+}
+
+func TestDeviceService_RevokeDevice(t *testing.T) {
+	db, service := setupDeviceService(t)
+	ctx := context.Background()
+	sessions := services.NewSessionService(db, nil, &config.Logger{Logger: zap.NewNop()})
+
+	meta := services.SessionMetadata{DeviceID: "phone-1", Platform: "android"}
+	device, _, err := service.RecordLogin(ctx, 1, meta)
+	require.NoError(t, err)
+	meta.UserDeviceID = &device.ID
+	session, _, err := sessions.CreateSession(ctx, 1, meta)
+	require.NoError(t, err)
+	other, _, err := sessions.CreateSession(ctx, 1, services.SessionMetadata{DeviceID: "tablet-1"})
+	require.NoError(t, err)
+
+	require.NoError(t, db.Create(&models.DeviceToken{UserID: 1, Token: "push-1", Platform: "android", DeviceID: "phone-1", IsActive: true}).Error)
+	require.NoError(t, db.Create(&models.DeviceToken{UserID: 1, Token: "push-2", Platform: "ios", DeviceID: "tablet-1", IsActive: true}).Error)
+
+	trusted, err := service.SetTrusted(ctx, 1, device.ID, true)
+	require.NoError(t, err)
+	assert.True(t, trusted.IsTrusted())
+
+	_, err = service.RenameDevice(ctx, 2, device.ID, "Not mine")
+	assert.ErrorIs(t, err, services.ErrDeviceNotFound, "users can only manage their own devices")
+
+	require.NoError(t, service.RevokeDevice(ctx, 1, device.ID))
+	assert.ErrorIs(t, service.RevokeDevice(ctx, 1, device.ID), services.ErrDeviceNotFound)
+
+	active, err := sessions.IsSessionActive(ctx, session.FamilyID)
+	require.NoError(t, err)
+	assert.False(t, active, "the device's sessions are revoked")
+	active, err = sessions.IsSessionActive(ctx, other.FamilyID)
+	require.NoError(t, err)
+	assert.True(t, active, "other devices stay signed in")
+
+	var tokens []models.DeviceToken
+	require.NoError(t, db.Order("token").Find(&tokens).Error)
+	require.Len(t, tokens, 2)
+	assert.False(t, tokens[0].IsActive)
+	assert.True(t, tokens[1].IsActive)
+
+	devices, err := service.ListDevices(ctx, 1)
+	require.NoError(t, err)
+	assert.Empty(t, devices)
+
+	// Signing in again from a revoked device counts as a new, untrusted device
+	again, isNew, err := service.RecordLogin(ctx, 1, meta)
+	require.NoError(t, err)
+	assert.True(t, isNew)
+	assert.Equal(t, device.ID, again.ID)
+	assert.False(t, again.IsTrusted())
+}
@@ -0,0 +1,206 @@
+package unit
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"mobile-backend/models"
+	"mobile-backend/services"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+func newDunningFixture(t *testing.T, enabled bool) (*gorm.DB, *services.DunningService, *services.FakePaymentProvider, *models.Subscription) {
+	ctx := context.Background()
+	db := setupTestDB()
+	statusService := services.NewSubscriptionStatusService(db, zap.NewNop())
+	dunning, err := services.NewDunningService(db, statusService, nil, nil, zap.NewNop())
+	require.NoError(t, err)
+	if enabled {
+		statusService.SetDunningService(dunning)
+	}
+	fake, err := services.NewFakePaymentProvider(db, statusService)
+	require.NoError(t, err)
+
+	user := &models.User{Email: "dunning@example.com", Password: "password123", Name: "Dunning", IsActive: true}
+	require.NoError(t, db.Create(user).Error)
+	product, err := fake.CreateProduct(ctx, &models.Product{Name: "Pro", Price: 1000, Currency: "usd", IsActive: true})
+	require.NoError(t, err)
+	plan, err := fake.CreatePrice(ctx, &models.Plan{Name: "Pro monthly", ProductID: product.ID, Price: 1000, Currency: "usd", Interval: "month", IsActive: true})
+	require.NoError(t, err)
+	sub, err := fake.CreateSubscription(ctx, user.ID, plan.ID, "")
+	require.NoError(t, err)
+	return db, dunning, fake, sub
+}
+
+func sendFakeWebhook(t *testing.T, fake *services.FakePaymentProvider, eventType string, sub *models.Subscription) {
+	payload, signature, err := fake.NewWebhook(eventType, sub.ProviderSubscriptionID)
+	require.NoError(t, err)
+	require.NoError(t, fake.HandleWebhook(context.Background(), payload, signature))
+}
+
+func loadUser(t *testing.T, db *gorm.DB, id uint) *models.User {
+	var user models.User
+	require.NoError(t, db.First(&user, id).Error)
+	return &user
+}
+
+func loadDunning(t *testing.T, db *gorm.DB, id uint) *models.SubscriptionDunning {
+	var dunning models.SubscriptionDunning
+	require.NoError(t, db.First(&dunning, id).Error)
+	return &dunning
+}
+
+func TestDunning_GracePeriodRemindersAndDowngrade(t *testing.T) {
+	t.Setenv("DUNNING_GRACE_PERIOD", "72h")
+	t.Setenv("DUNNING_REMINDER_SCHEDULE", "0h,24h,48h")
+	ctx := context.Background()
+	db, dunningService, fake, sub := newDunningFixture(t, true)
+
+	sendFakeWebhook(t, fake, services.FakeEventSubscriptionPaymentFailed, sub)
+
+	user := loadUser(t, db, sub.UserID)
+	assert.Equal(t, "past_due", user.SubscriptionStatus)
+	assert.True(t, user.IsInGracePeriod())
+	assert.True(t, user.IsProUser(), "a failed payment keeps access during the grace period")
+
+	dunning := &models.SubscriptionDunning{}
+	require.NoError(t, db.Where("subscription_id = ?", sub.ID).First(dunning).Error)
+	assert.Equal(t, models.DunningStateGrace, dunning.State)
+	assert.Equal(t, 1, dunning.RemindersSent, "the first reminder goes out right away")
+	require.NotNil(t, dunning.NextReminderAt)
+	assert.WithinDuration(t, dunning.StartedAt.Add(24*time.Hour), *dunning.NextReminderAt, time.Second)
+	assert.WithinDuration(t, dunning.StartedAt.Add(72*time.Hour), dunning.GraceEndsAt, time.Second)
+
+	// The provider's retry fails too; it's still the same dunning
+	sendFakeWebhook(t, fake, services.FakeEventSubscriptionPaymentFailed, sub)
+	var count int64
+	require.NoError(t, db.Model(&models.SubscriptionDunning{}).Where("subscription_id = ?", sub.ID).Count(&count).Error)
+	assert.Equal(t, int64(1), count)
+
+	// Two days later both remaining reminders are due
+	startedAt := time.Now().Add(-49 * time.Hour)
+	require.NoError(t, db.Model(dunning).Updates(map[string]interface{}{
+		"started_at":       startedAt,
+		"next_reminder_at": startedAt.Add(24 * time.Hour),
+		"grace_ends_at":    startedAt.Add(72 * time.Hour),
+	}).Error)
+	downgraded, err := dunningService.ProcessDunning(ctx)
+	require.NoError(t, err)
+	assert.Zero(t, downgraded)
+	dunning = loadDunning(t, db, dunning.ID)
+	assert.Equal(t, models.DunningStateFinalNotice, dunning.State)
+	assert.Equal(t, 3, dunning.RemindersSent)
+	assert.Nil(t, dunning.NextReminderAt)
+	assert.True(t, loadUser(t, db, sub.UserID).IsProUser())
+
+	// A reminder delivered twice is only sent once
+	require.NoError(t, dunningService.SendReminder(ctx, services.SubscriptionReminderPayload{
+		SubscriptionID: sub.ID, DunningID: dunning.ID, Step: 2, ReminderType: services.ReminderTypeFinalNotice,
+	}))
+	dunning = loadDunning(t, db, dunning.ID)
+	assert.Equal(t, 3, dunning.RemindersSent)
+
+	// The grace period runs out
+	require.NoError(t, db.Model(dunning).Update("grace_ends_at", time.Now().Add(-time.Minute)).Error)
+	downgraded, err = dunningService.ProcessDunning(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 1, downgraded)
+
+	user = loadUser(t, db, sub.UserID)
+	assert.Equal(t, "past_due", user.SubscriptionStatus)
+	assert.False(t, user.IsPro)
+	assert.False(t, user.IsProUser())
+
+	status, err := dunningService.GetSubscriptionDunning(ctx, sub.ID)
+	require.NoError(t, err)
+	assert.Equal(t, "past_due", status.Status)
+	require.NotNil(t, status.Current)
+	assert.Equal(t, models.DunningStateDowngraded, status.Current.State)
+	assert.NotNil(t, status.Current.DowngradedAt)
+	require.Len(t, status.Schedule, 3)
+	assert.Equal(t, services.ReminderTypePaymentFailed, status.Schedule[0].ReminderType)
+	assert.Equal(t, services.ReminderTypePaymentRetry, status.Schedule[1].ReminderType)
+	assert.Equal(t, services.ReminderTypeFinalNotice, status.Schedule[2].ReminderType)
+	assert.True(t, status.Schedule[2].Sent)
+
+	// Failing again while downgraded doesn't start a new grace period
+	sendFakeWebhook(t, fake, services.FakeEventSubscriptionPaymentFailed, sub)
+	assert.False(t, loadUser(t, db, sub.UserID).IsPro)
+
+	// The card is updated and the renewal goes through
+	sendFakeWebhook(t, fake, services.FakeEventSubscriptionRenewed, sub)
+	assert.True(t, loadUser(t, db, sub.UserID).IsProUser())
+	dunning = loadDunning(t, db, dunning.ID)
+	assert.Equal(t, models.DunningStateRecovered, dunning.State)
+	assert.NotNil(t, dunning.ResolvedAt)
+
+	// The next failure starts over
+	sendFakeWebhook(t, fake, services.FakeEventSubscriptionPaymentFailed, sub)
+	assert.True(t, loadUser(t, db, sub.UserID).IsProUser())
+	status, err = dunningService.GetSubscriptionDunning(ctx, sub.ID)
+	require.NoError(t, err)
+	assert.Len(t, status.History, 2)
+	require.NotNil(t, status.Current)
+	assert.Equal(t, models.DunningStateGrace, status.Current.State)
+
+	periods, total, err := dunningService.ListDunning(ctx, models.DunningStateRecovered, 1, 20)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), total)
+	assert.Len(t, periods, 1)
+
+	_, err = dunningService.GetSubscriptionDunning(ctx, sub.ID+100)
+	assert.ErrorIs(t, err, services.ErrSubscriptionNotFound)
+}
+
+func TestDunning_FailedDowngradeIsRetried(t *testing.T) {
+	ctx := context.Background()
+	db, dunningService, fake, sub := newDunningFixture(t, true)
+
+	sendFakeWebhook(t, fake, services.FakeEventSubscriptionPaymentFailed, sub)
+	dunning := &models.SubscriptionDunning{}
+	require.NoError(t, db.Where("subscription_id = ?", sub.ID).First(dunning).Error)
+	require.NoError(t, db.Model(dunning).Update("grace_ends_at", time.Now().Add(-time.Minute)).Error)
+
+	// The user's status can't be updated, so the dunning stays open
+	require.NoError(t, db.Delete(&models.User{}, sub.UserID).Error)
+	downgraded, err := dunningService.ProcessDunning(ctx)
+	require.NoError(t, err)
+	assert.Zero(t, downgraded)
+	assert.Equal(t, models.DunningStateGrace, loadDunning(t, db, dunning.ID).State)
+
+	// The next run downgrades the user
+	require.NoError(t, db.Unscoped().Model(&models.User{}).Where("id = ?", sub.UserID).Update("deleted_at", nil).Error)
+	downgraded, err = dunningService.ProcessDunning(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 1, downgraded)
+	assert.False(t, loadUser(t, db, sub.UserID).IsPro)
+	assert.Equal(t, models.DunningStateDowngraded, loadDunning(t, db, dunning.ID).State)
+}
+
+func TestDunning_Configuration(t *testing.T) {
+	t.Setenv("DUNNING_GRACE_PERIOD", "0")
+	db, dunningService, fake, sub := newDunningFixture(t, false)
+	assert.False(t, dunningService.Enabled())
+
+	// Without a grace period a failed payment ends access right away
+	sendFakeWebhook(t, fake, services.FakeEventSubscriptionPaymentFailed, sub)
+	assert.False(t, loadUser(t, db, sub.UserID).IsPro)
+
+	t.Setenv("DUNNING_GRACE_PERIOD", "72h")
+	t.Setenv("DUNNING_REMINDER_SCHEDULE", "0h,96h")
+	_, err := services.NewDunningService(db, nil, nil, nil, zap.NewNop())
+	assert.Error(t, err, "reminders must fall within the grace period")
+
+	t.Setenv("DUNNING_REMINDER_SCHEDULE", "48h,24h")
+	_, err = services.NewDunningService(db, nil, nil, nil, zap.NewNop())
+	assert.Error(t, err)
+
+	t.Setenv("DUNNING_GRACE_PERIOD", "a week")
+	_, err = services.NewDunningService(db, nil, nil, nil, zap.NewNop())
+	assert.Error(t, err)
+}
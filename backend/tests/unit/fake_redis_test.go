@@ -0,0 +1,337 @@
+package unit
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeRedis is an in-process Redis server speaking just enough RESP for the services
+// under test: string keys with expiry, counters, pipelines and MULTI/EXEC transactions.
+// Its clock only moves with Advance, so tests can expire keys without sleeping.
+type fakeRedis struct {
+	mu     sync.Mutex
+	values map[string]string
+	expiry map[string]time.Time
+	offset time.Duration
+}
+
+type fakeRedisStatus string
+
+// newFakeRedis starts a fake server and returns a client connected to it. Both are
+// closed when the test ends.
+func newFakeRedis(t *testing.T) (*redis.Client, *fakeRedis) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	server := &fakeRedis{values: map[string]string{}, expiry: map[string]time.Time{}}
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go server.serve(conn)
+		}
+	}()
+
+	client := redis.NewClient(&redis.Options{Addr: listener.Addr().String(), MaxRetries: -1})
+	t.Cleanup(func() {
+		client.Close()
+		listener.Close()
+	})
+	return client, server
+}
+
+// Advance moves the server's clock forward, expiring keys whose TTL runs out
+func (f *fakeRedis) Advance(d time.Duration) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.offset += d
+}
+
+// Keys returns the live keys starting with prefix
+func (f *fakeRedis) Keys(prefix string) []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var keys []string
+	for key := range f.values {
+		if _, ok := f.get(key); ok && strings.HasPrefix(key, prefix) {
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
+
+func (f *fakeRedis) serve(conn net.Conn) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	w := bufio.NewWriter(conn)
+
+	var queued [][]string
+	inMulti := false
+	for {
+		args, err := readRESPCommand(r)
+		if err != nil {
+			return
+		}
+		if len(args) == 0 {
+			continue
+		}
+
+		var reply interface{}
+		switch strings.ToUpper(args[0]) {
+		case "MULTI":
+			inMulti, queued = true, nil
+			reply = fakeRedisStatus("OK")
+		case "DISCARD":
+			inMulti, queued = false, nil
+			reply = fakeRedisStatus("OK")
+		case "EXEC":
+			f.mu.Lock()
+			replies := make([]interface{}, len(queued))
+			for i, cmd := range queued {
+				replies[i] = f.exec(cmd)
+			}
+			f.mu.Unlock()
+			inMulti, queued = false, nil
+			reply = replies
+		default:
+			if inMulti {
+				queued = append(queued, args)
+				reply = fakeRedisStatus("QUEUED")
+			} else {
+				f.mu.Lock()
+				reply = f.exec(args)
+				f.mu.Unlock()
+			}
+		}
+
+		writeRESPReply(w, reply)
+		// Pipelined commands arrive together; answer them together
+		if r.Buffered() == 0 {
+			if err := w.Flush(); err != nil {
+				return
+			}
+		}
+	}
+}
+
+func (f *fakeRedis) now() time.Time {
+	return time.Now().Add(f.offset)
+}
+
+func (f *fakeRedis) get(key string) (string, bool) {
+	if at, ok := f.expiry[key]; ok && !f.now().Before(at) {
+		delete(f.values, key)
+		delete(f.expiry, key)
+	}
+	value, ok := f.values[key]
+	return value, ok
+}
+
+func (f *fakeRedis) del(key string) bool {
+	_, ok := f.get(key)
+	delete(f.values, key)
+	delete(f.expiry, key)
+	return ok
+}
+
+// exec runs one command. The caller holds f.mu.
+func (f *fakeRedis) exec(args []string) interface{} {
+	cmd, args := strings.ToUpper(args[0]), args[1:]
+	switch cmd {
+	case "PING":
+		return fakeRedisStatus("PONG")
+	case "SELECT":
+		return fakeRedisStatus("OK")
+	case "GET":
+		if value, ok := f.get(args[0]); ok {
+			return value
+		}
+		return nil
+	case "GETDEL":
+		value, ok := f.get(args[0])
+		if !ok {
+			return nil
+		}
+		f.del(args[0])
+		return value
+	case "SET", "SETNX":
+		key, value := args[0], args[1]
+		var ttl time.Duration
+		nx := cmd == "SETNX"
+		keepTTL := false
+		for i := 2; i < len(args); i++ {
+			switch strings.ToUpper(args[i]) {
+			case "EX", "PX":
+				n, err := strconv.ParseInt(args[i+1], 10, 64)
+				if err != nil {
+					return errors.New("value is not an integer or out of range")
+				}
+				ttl = time.Duration(n) * time.Millisecond
+				if strings.EqualFold(args[i], "EX") {
+					ttl = time.Duration(n) * time.Second
+				}
+				i++
+			case "NX":
+				nx = true
+			case "KEEPTTL":
+				keepTTL = true
+			}
+		}
+		if _, exists := f.get(key); exists && nx {
+			if cmd == "SETNX" {
+				return int64(0)
+			}
+			return nil
+		}
+		f.values[key] = value
+		if ttl > 0 {
+			f.expiry[key] = f.now().Add(ttl)
+		} else if !keepTTL {
+			delete(f.expiry, key)
+		}
+		if cmd == "SETNX" {
+			return int64(1)
+		}
+		return fakeRedisStatus("OK")
+	case "DEL", "UNLINK":
+		var n int64
+		for _, key := range args {
+			if f.del(key) {
+				n++
+			}
+		}
+		return n
+	case "EXISTS":
+		var n int64
+		for _, key := range args {
+			if _, ok := f.get(key); ok {
+				n++
+			}
+		}
+		return n
+	case "INCR", "INCRBY", "DECR":
+		delta := int64(1)
+		if cmd == "DECR" {
+			delta = -1
+		}
+		if cmd == "INCRBY" {
+			n, err := strconv.ParseInt(args[1], 10, 64)
+			if err != nil {
+				return errors.New("value is not an integer or out of range")
+			}
+			delta = n
+		}
+		current := int64(0)
+		if value, ok := f.get(args[0]); ok {
+			n, err := strconv.ParseInt(value, 10, 64)
+			if err != nil {
+				return errors.New("value is not an integer or out of range")
+			}
+			current = n
+		}
+		current += delta
+		f.values[args[0]] = strconv.FormatInt(current, 10)
+		return current
+	case "EXPIRE", "PEXPIRE":
+		if _, ok := f.get(args[0]); !ok {
+			return int64(0)
+		}
+		n, err := strconv.ParseInt(args[1], 10, 64)
+		if err != nil {
+			return errors.New("value is not an integer or out of range")
+		}
+		ttl := time.Duration(n) * time.Second
+		if cmd == "PEXPIRE" {
+			ttl = time.Duration(n) * time.Millisecond
+		}
+		f.expiry[args[0]] = f.now().Add(ttl)
+		return int64(1)
+	case "TTL", "PTTL":
+		if _, ok := f.get(args[0]); !ok {
+			return int64(-2)
+		}
+		at, ok := f.expiry[args[0]]
+		if !ok {
+			return int64(-1)
+		}
+		if cmd == "TTL" {
+			return int64(at.Sub(f.now()).Round(time.Second) / time.Second)
+		}
+		return int64(at.Sub(f.now()) / time.Millisecond)
+	default:
+		return fmt.Errorf("unknown command '%s'", strings.ToLower(cmd))
+	}
+}
+
+func readRESPCommand(r *bufio.Reader) ([]string, error) {
+	line, err := readRESPLine(r)
+	if err != nil {
+		return nil, err
+	}
+	if !strings.HasPrefix(line, "*") {
+		return strings.Fields(line), nil
+	}
+
+	n, err := strconv.Atoi(line[1:])
+	if err != nil {
+		return nil, err
+	}
+	args := make([]string, n)
+	for i := range args {
+		line, err := readRESPLine(r)
+		if err != nil {
+			return nil, err
+		}
+		size, err := strconv.Atoi(strings.TrimPrefix(line, "$"))
+		if err != nil {
+			return nil, err
+		}
+		buf := make([]byte, size+2)
+		if _, err := io.ReadFull(r, buf); err != nil {
+			return nil, err
+		}
+		args[i] = string(buf[:size])
+	}
+	return args, nil
+}
+
+func readRESPLine(r *bufio.Reader) (string, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimRight(line, "\r\n"), nil
+}
+
+func writeRESPReply(w *bufio.Writer, reply interface{}) {
+	switch v := reply.(type) {
+	case nil:
+		w.WriteString("$-1\r\n")
+	case fakeRedisStatus:
+		fmt.Fprintf(w, "+%s\r\n", v)
+	case error:
+		fmt.Fprintf(w, "-ERR %s\r\n", v)
+	case int64:
+		fmt.Fprintf(w, ":%d\r\n", v)
+	case string:
+		fmt.Fprintf(w, "$%d\r\n%s\r\n", len(v), v)
+	case []interface{}:
+		fmt.Fprintf(w, "*%d\r\n", len(v))
+		for _, item := range v {
+			writeRESPReply(w, item)
+		}
+	}
+}
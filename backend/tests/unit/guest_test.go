@@ -0,0 +1,148 @@
+package unit
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"mobile-backend/config"
+	"mobile-backend/models"
+	"mobile-backend/services"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+func setupGuestService(t *testing.T) (*services.GuestService, *gorm.DB) {
+	t.Setenv("GUEST_ACCOUNT_TTL", "24h")
+	privacy, db := setupPrivacyService(t, "0s")
+
+	service, err := services.NewGuestService(db, nil, privacy, &config.Logger{Logger: zap.NewNop()})
+	require.NoError(t, err)
+	return service, db
+}
+
+func TestGuestService_SignIn(t *testing.T) {
+	service, _ := setupGuestService(t)
+	ctx := context.Background()
+
+	_, _, err := service.SignIn(ctx, " ", "")
+	assert.ErrorIs(t, err, services.ErrGuestDeviceRequired)
+
+	guest, secret, err := service.SignIn(ctx, "phone-1", "")
+	require.NoError(t, err)
+	assert.NotEmpty(t, secret, "a new guest gets a secret")
+	assert.True(t, guest.IsGuest)
+	assert.Contains(t, guest.Email, "@"+services.GuestEmailDomain)
+
+	// Knowing the device ID alone isn't enough to sign in as the guest
+	_, _, err = service.SignIn(ctx, "phone-1", "")
+	assert.ErrorIs(t, err, services.ErrInvalidGuestSecret)
+	_, _, err = service.SignIn(ctx, "phone-1", "not-the-secret")
+	assert.ErrorIs(t, err, services.ErrInvalidGuestSecret)
+
+	// The same device gets the same guest back with its secret
+	again, newSecret, err := service.SignIn(ctx, "phone-1", secret)
+	require.NoError(t, err)
+	assert.Empty(t, newSecret)
+	assert.Equal(t, guest.ID, again.ID)
+
+	other, otherSecret, err := service.SignIn(ctx, "phone-2", "")
+	require.NoError(t, err)
+	assert.NotEmpty(t, otherSecret)
+	assert.NotEqual(t, secret, otherSecret)
+	assert.NotEqual(t, guest.ID, other.ID)
+}
+
+func TestGuestService_UpgradeWithPassword(t *testing.T) {
+	service, db := setupGuestService(t)
+	ctx := context.Background()
+
+	guest, _, err := service.SignIn(ctx, "phone-1", "")
+	require.NoError(t, err)
+	require.NoError(t, db.Create(&models.OfflineOperation{UserID: guest.ID, OperationID: "op-1", OperationType: "create", TableName: "notes", RecordID: "1", Status: "pending"}).Error)
+
+	existing := &models.User{Email: "taken@example.com", Password: "password123", Name: "Taken", IsActive: true}
+	require.NoError(t, db.Create(existing).Error)
+	_, err = service.UpgradeWithPassword(ctx, guest.ID, "TAKEN@example.com", "password123", "")
+	assert.ErrorIs(t, err, services.ErrUserAlreadyExists)
+
+	user, err := service.UpgradeWithPassword(ctx, guest.ID, "ada@example.com", "new-password-1", "Ada")
+	require.NoError(t, err)
+	assert.Equal(t, guest.ID, user.ID, "the guest is upgraded in place")
+	assert.False(t, user.IsGuest)
+	assert.Nil(t, user.GuestDeviceHash)
+	assert.Nil(t, user.GuestSecretHash)
+	assert.Equal(t, "ada@example.com", user.Email)
+	assert.Equal(t, "Ada", user.Name)
+	assert.Nil(t, user.EmailVerifiedAt)
+	assert.NoError(t, user.CheckPassword("new-password-1"))
+
+	var operations int64
+	require.NoError(t, db.Model(&models.OfflineOperation{}).Where("user_id = ?", user.ID).Count(&operations).Error)
+	assert.EqualValues(t, 1, operations, "the guest's data stays with the account")
+
+	_, err = service.UpgradeWithPassword(ctx, guest.ID, "ada2@example.com", "new-password-1", "")
+	assert.ErrorIs(t, err, services.ErrNotGuestAccount)
+
+	// The device no longer resolves to the upgraded account
+	fresh, secret, err := service.SignIn(ctx, "phone-1", "")
+	require.NoError(t, err)
+	assert.NotEmpty(t, secret)
+	assert.NotEqual(t, user.ID, fresh.ID)
+}
+
+func TestGuestService_UpgradeAndRegistrationAgreeOnEmails(t *testing.T) {
+	t.Setenv("JWT_SECRET", "test-secret")
+	service, db := setupGuestService(t)
+	client, _ := newFakeRedis(t)
+	auth := services.NewAuthService(db, services.NewCacheService(client), nil, nil, nil, &config.Logger{Logger: zap.NewNop()})
+	ctx := context.Background()
+
+	registered, err := auth.RegisterUser(" Grace@Example.com ", "password123", "Grace")
+	require.NoError(t, err)
+	assert.Equal(t, "grace@example.com", registered.Email, "emails are stored lowercased")
+
+	guest, _, err := service.SignIn(ctx, "phone-1", "")
+	require.NoError(t, err)
+	_, err = service.UpgradeWithPassword(ctx, guest.ID, "GRACE@example.com", "new-password-1", "")
+	assert.ErrorIs(t, err, services.ErrUserAlreadyExists)
+
+	upgraded, err := service.UpgradeWithPassword(ctx, guest.ID, "Ada@Example.com", "new-password-1", "Ada")
+	require.NoError(t, err)
+	assert.Equal(t, "ada@example.com", upgraded.Email)
+	_, err = auth.RegisterUser("ADA@example.com", "password123", "Ada")
+	assert.ErrorIs(t, err, services.ErrUserAlreadyExists)
+
+	user, _, err := auth.LoginUser(ctx, "Ada@Example.COM", "new-password-1", "10.0.0.1")
+	require.NoError(t, err)
+	assert.Equal(t, upgraded.ID, user.ID)
+}
+
+func TestGuestService_PurgeStaleGuests(t *testing.T) {
+	service, db := setupGuestService(t)
+	ctx := context.Background()
+
+	stale, _, err := service.SignIn(ctx, "phone-1", "")
+	require.NoError(t, err)
+	recent, _, err := service.SignIn(ctx, "phone-2", "")
+	require.NoError(t, err)
+
+	old := time.Now().Add(-48 * time.Hour)
+	require.NoError(t, db.Model(&models.User{}).Where("id = ?", stale.ID).
+		Updates(map[string]interface{}{"last_login": old, "created_at": old}).Error)
+
+	purged, err := service.PurgeStaleGuests(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 1, purged)
+
+	var remaining int64
+	require.NoError(t, db.Model(&models.User{}).Where("is_guest = ?", true).Count(&remaining).Error)
+	assert.EqualValues(t, 1, remaining)
+
+	var kept models.User
+	require.NoError(t, db.First(&kept, recent.ID).Error)
+	assert.True(t, kept.IsGuest)
+}
@@ -0,0 +1,332 @@
+package unit
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"mobile-backend/models"
+	"mobile-backend/services"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+const (
+	iapBundleID  = "com.example.mobile"
+	iapProductID = "com.example.mobile.pro.monthly"
+	iapRTDNToken = "rtdn-secret"
+)
+
+// iapFixture wires the in-app purchase service to a fake App Store signing chain and a
+// directory of Google Play fixtures
+type iapFixture struct {
+	db          *gorm.DB
+	service     *services.InAppPurchaseService
+	signer      *services.FakeAppStoreSigner
+	playFixture string
+	user        *models.User
+}
+
+func setupIAP(t *testing.T) *iapFixture {
+	signer, err := services.NewFakeAppStoreSigner()
+	require.NoError(t, err)
+
+	dir := t.TempDir()
+	rootFile := filepath.Join(dir, "root.pem")
+	require.NoError(t, os.WriteFile(rootFile, signer.RootPEM(), 0o600))
+
+	t.Setenv("APPLE_BUNDLE_ID", iapBundleID)
+	t.Setenv("APPLE_ROOT_CERTIFICATES", rootFile)
+	t.Setenv("GOOGLE_PLAY_PACKAGE_NAME", iapBundleID)
+	t.Setenv("GOOGLE_PLAY_FIXTURES_DIR", dir)
+	t.Setenv("GOOGLE_PLAY_RTDN_TOKEN", iapRTDNToken)
+
+	db := setupTestDB()
+	service, err := services.NewInAppPurchaseService(db, services.NewSubscriptionStatusService(db, zap.NewNop()), zap.NewNop())
+	require.NoError(t, err)
+
+	product := &models.Product{Name: "Pro", Price: 999, Currency: "usd", IsActive: true, IsRecurring: true}
+	require.NoError(t, db.Create(product).Error)
+	require.NoError(t, db.Create(&models.Plan{
+		Name:                "Pro monthly",
+		ProductID:           product.ID,
+		Price:               999,
+		Currency:            "usd",
+		Interval:            "month",
+		IsActive:            true,
+		AppStoreProductID:   iapProductID,
+		GooglePlayProductID: iapProductID,
+	}).Error)
+
+	return &iapFixture{
+		db:          db,
+		service:     service,
+		signer:      signer,
+		playFixture: dir,
+		user:        createIAPUser(t, db, "store@example.com"),
+	}
+}
+
+func createIAPUser(t *testing.T, db *gorm.DB, email string) *models.User {
+	user := &models.User{Email: email, Password: "password123", Name: "Store User", IsActive: true}
+	require.NoError(t, db.Create(user).Error)
+	return user
+}
+
+// appStoreTransaction loads the unsigned transaction fixture
+func appStoreTransaction(t *testing.T) *services.AppStoreTransaction {
+	data, err := os.ReadFile("../fixtures/app_store/transaction_monthly.json")
+	require.NoError(t, err)
+	var tx services.AppStoreTransaction
+	require.NoError(t, json.Unmarshal(data, &tx))
+	return &tx
+}
+
+func (f *iapFixture) sign(t *testing.T, claims jwt.Claims) string {
+	signed, err := f.signer.Sign(claims)
+	require.NoError(t, err)
+	return signed
+}
+
+// notification signs an App Store server notification about tx
+func (f *iapFixture) notification(t *testing.T, uuid, notificationType string, tx *services.AppStoreTransaction, renewal *services.AppStoreRenewalInfo) string {
+	data := services.AppStoreNotificationData{BundleID: iapBundleID, SignedTransactionInfo: f.sign(t, tx)}
+	if renewal != nil {
+		data.SignedRenewalInfo = f.sign(t, renewal)
+	}
+	return f.sign(t, &services.AppStoreNotification{NotificationType: notificationType, NotificationUUID: uuid, Data: data})
+}
+
+// usePlayFixture serves the named Google Play fixture for purchaseToken
+func (f *iapFixture) usePlayFixture(t *testing.T, purchaseToken, name string) {
+	data, err := os.ReadFile(filepath.Join("../fixtures/google_play", name+".json"))
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(filepath.Join(f.playFixture, purchaseToken+".json"), data, 0o600))
+}
+
+// rtdn builds a Pub/Sub push message carrying a developer notification
+func rtdn(t *testing.T, messageID string, notification services.PlayDeveloperNotification) []byte {
+	notification.PackageName = iapBundleID
+	data, err := json.Marshal(notification)
+	require.NoError(t, err)
+	body, err := json.Marshal(map[string]interface{}{
+		"message": map[string]string{"data": base64.StdEncoding.EncodeToString(data), "messageId": messageID},
+	})
+	require.NoError(t, err)
+	return body
+}
+
+func (f *iapFixture) reloadUser(t *testing.T) models.User {
+	var user models.User
+	require.NoError(t, f.db.First(&user, f.user.ID).Error)
+	return user
+}
+
+func TestInAppPurchase_AppStoreTransaction(t *testing.T) {
+	ctx := context.Background()
+	f := setupIAP(t)
+	tx := appStoreTransaction(t)
+
+	sub, created, err := f.service.VerifyAppStoreTransaction(ctx, f.user.ID, f.sign(t, tx))
+	require.NoError(t, err)
+	assert.True(t, created)
+	assert.Equal(t, "active", sub.Status)
+	assert.Equal(t, services.AppStorePaymentMethod, sub.PaymentMethod)
+	assert.Equal(t, tx.OriginalTransactionID, sub.ProviderSubscriptionID)
+	assert.True(t, f.reloadUser(t).IsPro)
+
+	var payment models.Payment
+	require.NoError(t, f.db.Where("provider_payment_id = ?", tx.TransactionID).First(&payment).Error)
+	assert.EqualValues(t, 999, payment.Amount, "Apple prices are in milliunits")
+	assert.Equal(t, "usd", payment.Currency)
+	assert.Equal(t, "succeeded", payment.Status)
+
+	// Restoring the purchase again is idempotent
+	again, created, err := f.service.VerifyAppStoreTransaction(ctx, f.user.ID, f.sign(t, tx))
+	require.NoError(t, err)
+	assert.False(t, created)
+	assert.Equal(t, sub.ID, again.ID)
+
+	other := createIAPUser(t, f.db, "other@example.com")
+	_, _, err = f.service.VerifyAppStoreTransaction(ctx, other.ID, f.sign(t, tx))
+	assert.ErrorIs(t, err, services.ErrStorePurchaseOwnedByAnotherUser)
+
+	untrusted, err := services.NewFakeAppStoreSigner()
+	require.NoError(t, err)
+	forged, err := untrusted.Sign(tx)
+	require.NoError(t, err)
+	_, _, err = f.service.VerifyAppStoreTransaction(ctx, other.ID, forged)
+	assert.ErrorIs(t, err, services.ErrInvalidStorePurchase, "transactions must chain to a configured root")
+
+	otherApp := appStoreTransaction(t)
+	otherApp.BundleID = "com.example.other"
+	_, _, err = f.service.VerifyAppStoreTransaction(ctx, other.ID, f.sign(t, otherApp))
+	assert.ErrorIs(t, err, services.ErrInvalidStorePurchase)
+
+	unknown := appStoreTransaction(t)
+	unknown.OriginalTransactionID = "2000000599999999"
+	unknown.ProductID = "com.example.mobile.unknown"
+	_, _, err = f.service.VerifyAppStoreTransaction(ctx, other.ID, f.sign(t, unknown))
+	assert.ErrorIs(t, err, services.ErrUnknownStoreProduct)
+}
+
+func TestInAppPurchase_ConcurrentVerificationsRecordOnce(t *testing.T) {
+	ctx := context.Background()
+	f := setupIAP(t)
+	tx := appStoreTransaction(t)
+
+	// Another request records the purchase right after this one found no subscription
+	var winner *models.Subscription
+	require.NoError(t, f.db.Callback().Query().After("gorm:query").Register("test:race", func(db *gorm.DB) {
+		if winner != nil || db.Statement.Table != "subscriptions" || db.RowsAffected != 0 {
+			return
+		}
+		winner = &models.Subscription{UserID: f.user.ID, PaymentMethod: services.AppStorePaymentMethod, ProviderSubscriptionID: tx.OriginalTransactionID, Status: "incomplete"}
+		require.NoError(t, f.db.Create(winner).Error)
+	}))
+
+	sub, created, err := f.service.VerifyAppStoreTransaction(ctx, f.user.ID, f.sign(t, tx))
+	require.NoError(t, err)
+	require.NotNil(t, winner)
+	assert.False(t, created)
+	assert.Equal(t, winner.ID, sub.ID)
+	assert.Equal(t, "active", sub.Status)
+
+	var count int64
+	require.NoError(t, f.db.Model(&models.Subscription{}).Where("provider_subscription_id = ?", tx.OriginalTransactionID).Count(&count).Error)
+	assert.EqualValues(t, 1, count)
+
+	// The database refuses a second subscription for the same purchase outright
+	duplicate := &models.Subscription{UserID: f.user.ID, PaymentMethod: services.AppStorePaymentMethod, ProviderSubscriptionID: tx.OriginalTransactionID}
+	assert.Error(t, f.db.Create(duplicate).Error)
+}
+
+func TestInAppPurchase_AppStoreNotifications(t *testing.T) {
+	ctx := context.Background()
+	f := setupIAP(t)
+	tx := appStoreTransaction(t)
+	tx.ExpiresDate = time.Now().Add(-time.Hour).UnixMilli()
+	_, _, err := f.service.VerifyAppStoreTransaction(ctx, f.user.ID, f.sign(t, tx))
+	require.NoError(t, err)
+
+	// A failed renewal of the period that just ended leaves the subscription past due
+	// while Apple retries the charge
+	retrying := &services.AppStoreRenewalInfo{OriginalTransactionID: tx.OriginalTransactionID, AutoRenewStatus: 1, IsInBillingRetryPeriod: true}
+	require.NoError(t, f.service.HandleAppStoreNotification(ctx, f.notification(t, "uuid-1", "DID_FAIL_TO_RENEW", tx, retrying)))
+
+	var sub models.Subscription
+	require.NoError(t, f.db.Where("provider_subscription_id = ?", tx.OriginalTransactionID).First(&sub).Error)
+	assert.Equal(t, "past_due", sub.Status)
+	assert.False(t, f.reloadUser(t).IsPro)
+
+	// A renewal charges a new transaction of the same subscription
+	renewed := appStoreTransaction(t)
+	renewed.TransactionID = "2000000512349999"
+	renewed.PurchaseDate = time.Now().UnixMilli()
+	renewing := &services.AppStoreRenewalInfo{OriginalTransactionID: tx.OriginalTransactionID, AutoRenewStatus: 0}
+	require.NoError(t, f.service.HandleAppStoreNotification(ctx, f.notification(t, "uuid-2", "DID_RENEW", renewed, renewing)))
+	require.NoError(t, f.db.First(&sub, sub.ID).Error)
+	assert.Equal(t, "active", sub.Status)
+	assert.True(t, sub.CancelAtPeriodEnd, "turning off auto-renew cancels at the period end")
+	assert.True(t, f.reloadUser(t).IsPro)
+
+	var charges int64
+	require.NoError(t, f.db.Model(&models.Payment{}).Where("subscription_id = ?", sub.ID).Count(&charges).Error)
+	assert.EqualValues(t, 2, charges)
+
+	// A refund revokes the transaction
+	renewed.RevocationDate = time.Now().UnixMilli()
+	refund := f.notification(t, "uuid-3", "REFUND", renewed, nil)
+	require.NoError(t, f.service.HandleAppStoreNotification(ctx, refund))
+	require.NoError(t, f.db.First(&sub, sub.ID).Error)
+	assert.Equal(t, "canceled", sub.Status)
+	assert.False(t, f.reloadUser(t).IsPro)
+
+	var payment models.Payment
+	require.NoError(t, f.db.Where("provider_payment_id = ?", renewed.TransactionID).First(&payment).Error)
+	assert.Equal(t, "refunded", payment.Status)
+
+	// Redelivered notifications are not applied twice
+	require.NoError(t, f.db.Model(&sub).Update("status", "active").Error)
+	require.NoError(t, f.service.HandleAppStoreNotification(ctx, refund))
+	require.NoError(t, f.db.First(&sub, sub.ID).Error)
+	assert.Equal(t, "active", sub.Status)
+
+	// Notifications about subscriptions nobody linked are acknowledged and ignored
+	unlinked := appStoreTransaction(t)
+	unlinked.OriginalTransactionID = "2000000577777777"
+	unlinked.TransactionID = unlinked.OriginalTransactionID
+	require.NoError(t, f.service.HandleAppStoreNotification(ctx, f.notification(t, "uuid-4", "SUBSCRIBED", unlinked, nil)))
+	var count int64
+	require.NoError(t, f.db.Model(&models.Subscription{}).Where("provider_subscription_id = ?", unlinked.OriginalTransactionID).Count(&count).Error)
+	assert.Zero(t, count)
+
+	assert.ErrorIs(t, f.service.HandleAppStoreNotification(ctx, "not-a-jws"), services.ErrInvalidStoreNotification)
+}
+
+func TestInAppPurchase_GooglePlay(t *testing.T) {
+	ctx := context.Background()
+	f := setupIAP(t)
+	const token = "play-token-1"
+	f.usePlayFixture(t, token, "subscription_active")
+
+	_, _, err := f.service.VerifyGooglePlayPurchase(ctx, f.user.ID, "com.example.mobile.other", token)
+	assert.ErrorIs(t, err, services.ErrInvalidStorePurchase, "the token must be for the claimed product")
+	_, _, err = f.service.VerifyGooglePlayPurchase(ctx, f.user.ID, iapProductID, "unknown-token")
+	assert.ErrorIs(t, err, services.ErrStorePurchaseNotFound)
+
+	sub, created, err := f.service.VerifyGooglePlayPurchase(ctx, f.user.ID, iapProductID, token)
+	require.NoError(t, err)
+	assert.True(t, created)
+	assert.Equal(t, "active", sub.Status)
+	assert.Equal(t, services.GooglePlayPaymentMethod, sub.PaymentMethod)
+	assert.True(t, f.reloadUser(t).IsPro)
+
+	var payment models.Payment
+	require.NoError(t, f.db.Where("provider_payment_id = ?", "GPA.3301-1234-5678-90123").First(&payment).Error)
+	assert.EqualValues(t, 999, payment.Amount, "Play charges are recorded at the plan price")
+
+	subscriptionChanged := func(messageID string) []byte {
+		return rtdn(t, messageID, services.PlayDeveloperNotification{
+			SubscriptionNotification: &services.PlaySubscriptionNotification{NotificationType: 5, PurchaseToken: token, SubscriptionID: iapProductID},
+		})
+	}
+
+	assert.ErrorIs(t, f.service.HandleGooglePlayNotification(ctx, "wrong", subscriptionChanged("m-0")), services.ErrInvalidStoreNotification)
+
+	f.usePlayFixture(t, token, "subscription_on_hold")
+	require.NoError(t, f.service.HandleGooglePlayNotification(ctx, iapRTDNToken, subscriptionChanged("m-1")))
+	require.NoError(t, f.db.First(sub, sub.ID).Error)
+	assert.Equal(t, "past_due", sub.Status)
+	assert.False(t, f.reloadUser(t).IsPro)
+
+	f.usePlayFixture(t, token, "subscription_canceled")
+	require.NoError(t, f.service.HandleGooglePlayNotification(ctx, iapRTDNToken, subscriptionChanged("m-2")))
+	require.NoError(t, f.db.First(sub, sub.ID).Error)
+	assert.Equal(t, "active", sub.Status, "canceled subscriptions run to the end of the period")
+	assert.True(t, sub.CancelAtPeriodEnd)
+	assert.True(t, f.reloadUser(t).IsPro)
+
+	// A voided order is refunded and the revoked subscription ends
+	f.usePlayFixture(t, token, "subscription_expired")
+	require.NoError(t, f.service.HandleGooglePlayNotification(ctx, iapRTDNToken, rtdn(t, "m-3", services.PlayDeveloperNotification{
+		VoidedPurchase: &services.PlayVoidedPurchaseNotification{PurchaseToken: token, OrderID: "GPA.3301-1234-5678-90123", ProductType: 1},
+	})))
+	require.NoError(t, f.db.First(sub, sub.ID).Error)
+	assert.Equal(t, "canceled", sub.Status)
+	assert.False(t, f.reloadUser(t).IsPro)
+	require.NoError(t, f.db.First(&payment, payment.ID).Error)
+	assert.Equal(t, "refunded", payment.Status)
+
+	other := createIAPUser(t, f.db, "other-play@example.com")
+	_, _, err = f.service.VerifyGooglePlayPurchase(ctx, other.ID, iapProductID, token)
+	assert.ErrorIs(t, err, services.ErrStorePurchaseOwnedByAnotherUser)
+}
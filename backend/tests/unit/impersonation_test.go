@@ -0,0 +1,145 @@
+package unit
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"mobile-backend/config"
+	"mobile-backend/controllers"
+	"mobile-backend/middleware"
+	"mobile-backend/models"
+	"mobile-backend/services"
+	"mobile-backend/utils"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func setupImpersonation(t *testing.T) (*gorm.DB, *services.AuthService, *models.User, *models.User) {
+	t.Setenv("JWT_SECRET", "test-secret")
+
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	require.NoError(t, err)
+	require.NoError(t, db.AutoMigrate(&models.User{}, &models.Role{}, &models.Permission{}, &models.UserRole{}, &models.AuditEvent{}))
+	require.NoError(t, services.NewRoleService(db).EnsureDefaultRoles(context.Background()))
+
+	staff := &models.User{Email: "support@example.com", Password: "password123", Name: "Support", IsActive: true}
+	target := &models.User{Email: "customer@example.com", Password: "password123", Name: "Customer", IsActive: true}
+	require.NoError(t, db.Create(staff).Error)
+	require.NoError(t, db.Create(target).Error)
+	require.NoError(t, services.NewRoleService(db).AssignRole(context.Background(), staff.ID, models.RoleAdmin, nil))
+	require.NoError(t, services.NewRoleService(db).AssignRole(context.Background(), target.ID, models.RoleStaff, nil))
+
+	return db, services.NewAuthService(db, nil, nil, nil, nil, &config.Logger{Logger: zap.NewNop()}), staff, target
+}
+
+func TestAuthService_Impersonate(t *testing.T) {
+	db, service, staff, target := setupImpersonation(t)
+	ctx := context.Background()
+
+	user, token, expiresAt, err := service.Impersonate(ctx, staff.ID, target.ID)
+	require.NoError(t, err)
+	assert.Equal(t, target.ID, user.ID)
+	assert.WithinDuration(t, time.Now().Add(utils.ImpersonationTokenTTL), expiresAt, 5*time.Second)
+
+	claims, err := utils.ValidateToken(token)
+	require.NoError(t, err)
+	assert.Equal(t, target.ID, claims.UserID)
+	assert.Equal(t, "access", claims.Type)
+	assert.Empty(t, claims.SessionID, "impersonation tokens belong to no session")
+	require.True(t, claims.IsImpersonation())
+	assert.Equal(t, staff.ID, claims.Actor.UserID)
+	assert.Equal(t, staff.Email, claims.Actor.Email)
+	assert.Empty(t, claims.Roles, "the token carries neither the actor's roles nor the target's")
+	assert.Empty(t, claims.Permissions)
+
+	_, _, _, err = service.Impersonate(ctx, staff.ID, staff.ID)
+	assert.ErrorIs(t, err, services.ErrImpersonationNotAllowed)
+
+	_, _, _, err = service.Impersonate(ctx, target.ID, staff.ID)
+	assert.ErrorIs(t, err, services.ErrImpersonationNotAllowed, "administrators cannot be impersonated")
+
+	_, _, _, err = service.Impersonate(ctx, staff.ID, 9999)
+	assert.ErrorIs(t, err, services.ErrUserNotFound)
+
+	require.NoError(t, db.Model(target).Update("is_active", false).Error)
+	_, _, _, err = service.Impersonate(ctx, staff.ID, target.ID)
+	assert.ErrorIs(t, err, services.ErrImpersonationNotAllowed)
+}
+
+func TestImpersonation_BlocksSensitiveRoutesAndAuditsStart(t *testing.T) {
+	db, service, staff, target := setupImpersonation(t)
+	auditService := services.NewAuditService(db, &config.Logger{Logger: zap.NewNop()})
+	authController := controllers.NewAuthController(service, nil, auditService)
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	routes := r.Group("/", middleware.AuthMiddleware())
+	routes.POST("/admin/users/:id/impersonate", middleware.BlockImpersonation(), authController.ImpersonateUser)
+	routes.POST("/payments", middleware.BlockImpersonation(), func(c *gin.Context) { c.Status(http.StatusCreated) })
+	routes.GET("/admin/subscriptions", middleware.RequirePermission(models.PermissionSubscriptionsRead), func(c *gin.Context) { c.Status(http.StatusOK) })
+	routes.GET("/profile", func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{"user_id": c.GetUint("user_id"), "impersonator_id": c.GetUint("impersonator_id")})
+	})
+
+	perform := func(method, path, token, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer "+token)
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	staffToken, _, err := utils.GenerateAccessAndRefreshTokens(staff.ID, staff.Email)
+	require.NoError(t, err)
+
+	impersonatePath := "/admin/users/" + strconv.Itoa(int(target.ID)) + "/impersonate"
+
+	// A reason is required
+	w := perform(http.MethodPost, impersonatePath, staffToken, `{}`)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	w = perform(http.MethodPost, impersonatePath, staffToken, `{"reason":"ticket 4711"}`)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var started struct {
+		Data utils.ImpersonationResponse `json:"data"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &started))
+	assert.Equal(t, target.ID, started.Data.User.ID)
+	token := started.Data.AccessToken
+
+	// Ordinary reads act as the target, with the actor recorded alongside
+	w = perform(http.MethodGet, "/profile", token, "")
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `{"user_id":`+strconv.Itoa(int(target.ID))+`,"impersonator_id":`+strconv.Itoa(int(staff.ID))+`}`, w.Body.String())
+
+	// Sensitive actions are refused, including starting another impersonation
+	assert.Equal(t, http.StatusForbidden, perform(http.MethodPost, "/payments", token, "").Code)
+	assert.Equal(t, http.StatusForbidden, perform(http.MethodPost, impersonatePath, token, `{"reason":"nested"}`).Code)
+	assert.Equal(t, http.StatusCreated, perform(http.MethodPost, "/payments", staffToken, "").Code)
+
+	// The target's staff permissions don't come along either
+	targetToken, _, err := utils.GenerateAccessAndRefreshTokensWithOptions(target.ID, target.Email,
+		utils.TokenOptions{Permissions: []string{models.PermissionSubscriptionsRead}})
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusOK, perform(http.MethodGet, "/admin/subscriptions", targetToken, "").Code)
+	assert.Equal(t, http.StatusForbidden, perform(http.MethodGet, "/admin/subscriptions", token, "").Code)
+
+	var event models.AuditEvent
+	require.NoError(t, db.Where("action = ?", models.AuditActionImpersonationStarted).First(&event).Error)
+	require.NotNil(t, event.ActorID)
+	assert.Equal(t, staff.ID, *event.ActorID)
+	assert.Equal(t, strconv.Itoa(int(target.ID)), event.ResourceID)
+	assert.Equal(t, "ticket 4711", event.Metadata["reason"])
+}
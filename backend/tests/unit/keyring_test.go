@@ -0,0 +1,134 @@
+package unit
+
+import (
+	"testing"
+	"time"
+
+	"mobile-backend/services"
+	"mobile-backend/utils"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+func withKeyring(t *testing.T, keyring *utils.Keyring) {
+	utils.SetDefaultKeyring(keyring)
+	t.Cleanup(func() { utils.SetDefaultKeyring(nil) })
+}
+
+func TestKeyring_SignAndVerify(t *testing.T) {
+	for _, alg := range []string{utils.SigningAlgEdDSA, utils.SigningAlgRS256} {
+		t.Run(alg, func(t *testing.T) {
+			key, err := utils.GenerateSigningKey(alg)
+			require.NoError(t, err)
+			withKeyring(t, utils.NewKeyring([]*utils.SigningKey{key}, "", time.Time{}))
+
+			accessToken, _, err := utils.GenerateAccessAndRefreshTokens(1, "user@example.com")
+			require.NoError(t, err)
+
+			parsed, _, err := jwt.NewParser().ParseUnverified(accessToken, &utils.Claims{})
+			require.NoError(t, err)
+			assert.Equal(t, key.ID, parsed.Header["kid"])
+			assert.Equal(t, alg, parsed.Method.Alg())
+
+			claims, err := utils.ValidateToken(accessToken)
+			require.NoError(t, err)
+			assert.Equal(t, uint(1), claims.UserID)
+		})
+	}
+}
+
+func TestKeyring_RotationKeepsOldTokensValid(t *testing.T) {
+	oldKey, err := utils.GenerateSigningKey(utils.SigningAlgEdDSA)
+	require.NoError(t, err)
+	oldKey.ActivatesAt = time.Now().Add(-time.Hour)
+	keyring := utils.NewKeyring([]*utils.SigningKey{oldKey}, "", time.Time{})
+	withKeyring(t, keyring)
+
+	oldToken, _, err := utils.GenerateAccessAndRefreshTokens(1, "user@example.com")
+	require.NoError(t, err)
+
+	// A newly published key doesn't sign until it activates
+	pending, err := utils.GenerateSigningKey(utils.SigningAlgEdDSA)
+	require.NoError(t, err)
+	pending.ActivatesAt = time.Now().Add(time.Hour)
+	keyring.SetKeys([]*utils.SigningKey{oldKey, pending})
+
+	current, err := keyring.SigningKey()
+	require.NoError(t, err)
+	assert.Equal(t, oldKey.ID, current.ID)
+	assert.Len(t, keyring.JWKS().Keys, 2)
+
+	// Once active, the new key signs and the old one still verifies
+	pending.ActivatesAt = time.Now().Add(-time.Minute)
+	current, err = keyring.SigningKey()
+	require.NoError(t, err)
+	assert.Equal(t, pending.ID, current.ID)
+
+	_, err = utils.ValidateToken(oldToken)
+	assert.NoError(t, err)
+
+	// Expired keys no longer verify
+	oldKey.ExpiresAt = time.Now().Add(-time.Second)
+	_, err = utils.ValidateToken(oldToken)
+	assert.Error(t, err)
+}
+
+func TestKeyring_RejectsAlgorithmConfusion(t *testing.T) {
+	key, err := utils.GenerateSigningKey(utils.SigningAlgRS256)
+	require.NoError(t, err)
+	withKeyring(t, utils.NewKeyring([]*utils.SigningKey{key}, "legacy-secret", time.Now().Add(time.Hour)))
+
+	// An HS256 token claiming the RSA key's kid must not verify
+	forged := jwt.NewWithClaims(jwt.SigningMethodHS256, utils.Claims{
+		UserID: 1,
+		Type:   "access",
+		RegisteredClaims: jwt.RegisteredClaims{
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Minute)),
+		},
+	})
+	forged.Header["kid"] = key.ID
+	forgedString, err := forged.SignedString([]byte("legacy-secret"))
+	require.NoError(t, err)
+
+	_, err = utils.ValidateToken(forgedString)
+	assert.Error(t, err)
+
+	// Legacy tokens without a kid are accepted during the migration window
+	legacy := jwt.NewWithClaims(jwt.SigningMethodHS256, utils.Claims{
+		UserID: 1,
+		Type:   "access",
+		RegisteredClaims: jwt.RegisteredClaims{
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Minute)),
+		},
+	})
+	legacyString, err := legacy.SignedString([]byte("legacy-secret"))
+	require.NoError(t, err)
+
+	_, err = utils.ValidateToken(legacyString)
+	assert.NoError(t, err)
+
+	// Once the window has passed the old secret no longer mints valid tokens
+	withKeyring(t, utils.NewKeyring([]*utils.SigningKey{key}, "legacy-secret", time.Now().Add(-time.Second)))
+	_, err = utils.ValidateToken(legacyString)
+	assert.Error(t, err)
+}
+
+func TestKeyringService_LegacySecretIsOptIn(t *testing.T) {
+	t.Setenv("JWT_SECRET", "legacy-secret")
+	t.Setenv("JWT_LEGACY_HS256_UNTIL", "")
+	service, err := services.NewKeyringService(nil, zap.NewNop())
+	require.NoError(t, err)
+	assert.NotContains(t, service.Keyring().ValidMethods(), jwt.SigningMethodHS256.Alg())
+
+	t.Setenv("JWT_LEGACY_HS256_UNTIL", time.Now().Add(time.Hour).Format(time.RFC3339))
+	service, err = services.NewKeyringService(nil, zap.NewNop())
+	require.NoError(t, err)
+	assert.Contains(t, service.Keyring().ValidMethods(), jwt.SigningMethodHS256.Alg())
+
+	t.Setenv("JWT_LEGACY_HS256_UNTIL", "next month")
+	_, err = services.NewKeyringService(nil, zap.NewNop())
+	assert.Error(t, err)
+}
@@ -0,0 +1,245 @@
+package unit
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"mobile-backend/config"
+	"mobile-backend/controllers"
+	"mobile-backend/models"
+	"mobile-backend/services"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func TestUser_IsLocked(t *testing.T) {
+	user := &models.User{}
+	assert.False(t, user.IsLocked())
+
+	past := time.Now().Add(-time.Minute)
+	user.LockedUntil = &past
+	assert.False(t, user.IsLocked(), "an expired lockout no longer applies")
+
+	future := time.Now().Add(time.Minute)
+	user.LockedUntil = &future
+	assert.True(t, user.IsLocked())
+}
+
+func TestAuthService_LoginUser_RefusesLockedAccounts(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	require.NoError(t, err)
+	require.NoError(t, db.AutoMigrate(&models.User{}))
+
+	lockedUntil := time.Now().Add(10 * time.Minute)
+	user := &models.User{Email: "locked@example.com", Password: "password123", Name: "Locked", IsActive: true, LockedUntil: &lockedUntil}
+	require.NoError(t, db.Create(user).Error)
+
+	service := services.NewAuthService(db, nil, nil, nil, nil, &config.Logger{Logger: zap.NewNop()})
+	ctx := context.Background()
+
+	// Even the right password is refused while the lockout lasts
+	_, _, err = service.LoginUser(ctx, user.Email, "password123", "10.0.0.1")
+	require.ErrorIs(t, err, services.ErrAccountLocked)
+
+	var retryErr *services.LoginRetryError
+	require.True(t, errors.As(err, &retryErr))
+	assert.InDelta(t, (10 * time.Minute).Seconds(), retryErr.RetryAfter.Seconds(), 5)
+
+	require.NoError(t, service.UnlockUser(ctx, user.ID, 1))
+	var reloaded models.User
+	require.NoError(t, db.First(&reloaded, user.ID).Error)
+	assert.Nil(t, reloaded.LockedUntil)
+}
+
+func TestExternalLogins_RefuseLockedAccounts(t *testing.T) {
+	provider, keyring := newTestOIDCProvider(t)
+	f := newPasswordlessFixture(t)
+	require.NoError(t, f.db.AutoMigrate(&models.UserIdentity{}, &models.OAuthProvider{}))
+	oauth2Service := services.NewOAuth2Service(f.db, nil)
+	require.NoError(t, oauth2Service.RegisterProvider(&services.OAuth2Config{
+		Name:      "apple",
+		Type:      models.OAuthProviderTypeOIDC,
+		ClientID:  "com.example.app",
+		IssuerURL: provider.URL,
+	}))
+
+	now := time.Now()
+	lockedUntil := now.Add(10 * time.Minute)
+	user := f.createUser(t, "user@example.com")
+	require.NoError(t, f.db.Model(user).Updates(map[string]interface{}{"email_verified_at": now, "locked_until": lockedUntil}).Error)
+
+	auth := services.NewAuthService(f.db, nil, nil, nil, nil, &config.Logger{Logger: zap.NewNop()})
+	passwordlessController := controllers.NewPasswordlessController(f.service, auth, zap.NewNop())
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.POST("/passwordless/verify-link", passwordlessController.VerifyLink)
+	r.POST("/passwordless/verify-code", passwordlessController.VerifyCode)
+	r.POST("/oauth2/:provider/token", controllers.NewOAuth2Controller(oauth2Service, auth).OAuth2Token)
+
+	// Each path issues fresh single-use credentials for the user
+	paths := map[string]func() (string, string){
+		"magic link": func() (string, string) {
+			f.issueLink(t, user.Email, "link-token")
+			return "/passwordless/verify-link", `{"token":"link-token"}`
+		},
+		"sign-in code": func() (string, string) {
+			f.issueCode(t, user.Email, "123456")
+			return "/passwordless/verify-code", `{"email":"user@example.com","code":"123456"}`
+		},
+		"oauth2": func() (string, string) {
+			token := signIDToken(t, keyring, provider.URL, "com.example.app", "")
+			return "/oauth2/apple/token", `{"id_token":"` + token + `"}`
+		},
+	}
+	perform := func(path, body string) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest(http.MethodPost, path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	for name, credentials := range paths {
+		w := perform(credentials())
+		assert.Equal(t, http.StatusTooManyRequests, w.Code, "%s: a locked account gets no session", name)
+		assert.NotEmpty(t, w.Header().Get("Retry-After"), name)
+	}
+
+	// An administrator-forced password reset holds back external logins too
+	require.NoError(t, f.db.Model(user).Updates(map[string]interface{}{"locked_until": nil, "password_reset_required": true}).Error)
+	for name, credentials := range paths {
+		w := perform(credentials())
+		assert.Equal(t, http.StatusForbidden, w.Code, "%s: the password must be reset first", name)
+		assert.Contains(t, w.Body.String(), "password_reset_required", name)
+	}
+}
+
+type lockoutFixture struct {
+	auth    *services.AuthService
+	lockout *services.LoginLockoutService
+	db      *gorm.DB
+	server  *fakeRedis
+	user    *models.User
+}
+
+func newLockoutFixture(t *testing.T) *lockoutFixture {
+	t.Setenv("JWT_SECRET", "test-secret")
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	require.NoError(t, err)
+	require.NoError(t, db.AutoMigrate(&models.User{}, &models.UserMFA{}, &models.MFARecoveryCode{}))
+
+	now := time.Now()
+	user := &models.User{Email: "lockout@example.com", Password: "password123", Name: "Lockout", IsActive: true, EmailVerifiedAt: &now}
+	require.NoError(t, db.Create(user).Error)
+
+	client, server := newFakeRedis(t)
+	logger := &config.Logger{Logger: zap.NewNop()}
+	lockout, err := services.NewLoginLockoutService(db, client, logger)
+	require.NoError(t, err)
+	auth := services.NewAuthService(db, services.NewCacheService(client), services.NewTokenBlacklistService(client), lockout, nil, logger)
+	return &lockoutFixture{auth: auth, lockout: lockout, db: db, server: server, user: user}
+}
+
+func (f *lockoutFixture) login(password string) error {
+	_, _, err := f.auth.LoginUser(context.Background(), f.user.Email, password, "10.0.0.1")
+	return err
+}
+
+func TestLoginLockout_ProgressiveDelay(t *testing.T) {
+	f := newLockoutFixture(t)
+	ctx := context.Background()
+
+	for i := 0; i < 3; i++ {
+		err := f.login("wrong-password")
+		require.Error(t, err)
+		require.False(t, errors.As(err, new(*services.LoginRetryError)), "attempt %d is not throttled yet", i+1)
+	}
+
+	// The third failure delays the next attempt, even with the right password
+	err := f.login("password123")
+	require.ErrorIs(t, err, services.ErrTooManyLoginAttempts)
+	var retryErr *services.LoginRetryError
+	require.ErrorAs(t, err, &retryErr)
+	assert.LessOrEqual(t, retryErr.RetryAfter, time.Second)
+
+	// Each further failure doubles the delay
+	f.server.Advance(time.Second)
+	require.NoError(t, f.lockout.RecordFailure(ctx, f.user, f.user.Email, "10.0.0.1"))
+	err = f.lockout.Check(ctx, f.user.Email, "10.0.0.1")
+	require.ErrorAs(t, err, &retryErr)
+	assert.Greater(t, retryErr.RetryAfter, time.Second)
+	assert.LessOrEqual(t, retryErr.RetryAfter, 2*time.Second)
+
+	// Once the delay has passed a successful login clears the failures
+	f.server.Advance(2 * time.Second)
+	require.NoError(t, f.login("password123"))
+	assert.Empty(t, f.server.Keys("login:failures:account:"))
+	assert.Empty(t, f.server.Keys("login:next_attempt:"))
+
+	require.Error(t, f.login("wrong-password"))
+	assert.NoError(t, f.login("password123"), "a single failure after the reset isn't throttled")
+}
+
+func TestLoginLockout_EscalatesToTimedLock(t *testing.T) {
+	t.Setenv("LOGIN_DELAY_AFTER_FAILURES", "100")
+	t.Setenv("LOGIN_LOCK_AFTER_FAILURES", "3")
+	f := newLockoutFixture(t)
+	ctx := context.Background()
+
+	for i := 0; i < 3; i++ {
+		require.Error(t, f.login("wrong-password"))
+	}
+	err := f.login("password123")
+	require.ErrorIs(t, err, services.ErrAccountLocked)
+	var retryErr *services.LoginRetryError
+	require.ErrorAs(t, err, &retryErr)
+	assert.InDelta(t, (15 * time.Minute).Seconds(), retryErr.RetryAfter.Seconds(), 5)
+
+	var reloaded models.User
+	require.NoError(t, f.db.First(&reloaded, f.user.ID).Error)
+	assert.True(t, reloaded.IsLocked(), "the lockout is also stored with the user")
+
+	// Every further lockout within the history doubles the duration
+	for i := 0; i < 3; i++ {
+		require.NoError(t, f.lockout.RecordFailure(ctx, nil, "unknown@example.com", "10.0.0.2"))
+	}
+	require.ErrorAs(t, f.lockout.Check(ctx, "unknown@example.com", "10.0.0.2"), &retryErr)
+	assert.InDelta(t, (15 * time.Minute).Seconds(), retryErr.RetryAfter.Seconds(), 5)
+
+	f.server.Advance(16 * time.Minute)
+	require.NoError(t, f.lockout.Check(ctx, "unknown@example.com", "10.0.0.2"))
+	for i := 0; i < 3; i++ {
+		require.NoError(t, f.lockout.RecordFailure(ctx, nil, "unknown@example.com", "10.0.0.2"))
+	}
+	require.ErrorAs(t, f.lockout.Check(ctx, "unknown@example.com", "10.0.0.2"), &retryErr)
+	assert.InDelta(t, (30 * time.Minute).Seconds(), retryErr.RetryAfter.Seconds(), 5)
+}
+
+func TestLoginLockout_AdminUnlock(t *testing.T) {
+	t.Setenv("LOGIN_DELAY_AFTER_FAILURES", "100")
+	t.Setenv("LOGIN_LOCK_AFTER_FAILURES", "3")
+	f := newLockoutFixture(t)
+	ctx := context.Background()
+
+	for i := 0; i < 3; i++ {
+		require.Error(t, f.login("wrong-password"))
+	}
+	require.ErrorIs(t, f.login("password123"), services.ErrAccountLocked)
+
+	require.NoError(t, f.auth.UnlockUser(ctx, f.user.ID, 1))
+	assert.Empty(t, f.server.Keys("login:locked:"))
+	assert.Empty(t, f.server.Keys("login:lockouts:"))
+	require.NoError(t, f.login("password123"))
+
+	assert.ErrorIs(t, f.auth.UnlockUser(ctx, f.user.ID+100, 1), services.ErrUserNotFound)
+}
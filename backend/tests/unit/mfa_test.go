@@ -0,0 +1,220 @@
+package unit
+
+import (
+	"context"
+	"encoding/base32"
+	"testing"
+	"time"
+
+	"mobile-backend/config"
+	"mobile-backend/models"
+	"mobile-backend/services"
+	"mobile-backend/utils"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func TestTOTP_RFC6238Vectors(t *testing.T) {
+	secret := base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString([]byte("12345678901234567890"))
+
+	vectors := map[int64]string{
+		59:         "287082",
+		1111111109: "081804",
+		1234567890: "005924",
+		2000000000: "279037",
+	}
+	for ts, expected := range vectors {
+		code, err := utils.GenerateTOTPCode(secret, utils.TOTPStep(time.Unix(ts, 0)))
+		require.NoError(t, err)
+		assert.Equal(t, expected, code, "timestamp %d", ts)
+	}
+}
+
+func TestTOTP_ValidateWithSkew(t *testing.T) {
+	secret, err := utils.GenerateTOTPSecret()
+	require.NoError(t, err)
+
+	now := time.Now()
+	previous, err := utils.GenerateTOTPCode(secret, utils.TOTPStep(now)-1)
+	require.NoError(t, err)
+
+	step, ok := utils.ValidateTOTPCode(secret, previous, now, 1)
+	assert.True(t, ok)
+	assert.Equal(t, utils.TOTPStep(now)-1, step)
+
+	_, ok = utils.ValidateTOTPCode(secret, previous, now, 0)
+	assert.False(t, ok)
+}
+
+func setupMFAService(t *testing.T) (*services.MFAService, *models.User) {
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	require.NoError(t, err)
+	require.NoError(t, db.AutoMigrate(&models.User{}, &models.UserMFA{}, &models.MFARecoveryCode{}))
+
+	user := &models.User{Email: "mfa@example.com", Password: "password123", Name: "MFA", IsActive: true}
+	require.NoError(t, db.Create(user).Error)
+
+	return services.NewMFAService(db, &config.Logger{Logger: zap.NewNop()}), user
+}
+
+func TestMFAService_EnrollmentAndVerify(t *testing.T) {
+	service, user := setupMFAService(t)
+	ctx := context.Background()
+
+	enrollment, err := service.BeginEnrollment(ctx, user)
+	require.NoError(t, err)
+	assert.Contains(t, enrollment.ProvisioningURI, "otpauth://totp/")
+
+	enabled, err := service.IsEnabled(ctx, user.ID)
+	require.NoError(t, err)
+	assert.False(t, enabled, "enrollment is pending until confirmed")
+
+	// Confirm with the previous step's code so the current one is still unused
+	confirmCode, err := utils.GenerateTOTPCode(enrollment.Secret, utils.TOTPStep(time.Now())-1)
+	require.NoError(t, err)
+	codes, err := service.ConfirmEnrollment(ctx, user.ID, confirmCode)
+	require.NoError(t, err)
+	assert.Len(t, codes, 10)
+
+	current, err := utils.GenerateTOTPCode(enrollment.Secret, utils.TOTPStep(time.Now()))
+	require.NoError(t, err)
+	assert.NoError(t, service.Verify(ctx, user.ID, current))
+
+	// The same code can't be replayed
+	assert.ErrorIs(t, service.Verify(ctx, user.ID, current), services.ErrInvalidMFACode)
+}
+
+func TestMFAService_RecoveryCodesAreSingleUse(t *testing.T) {
+	service, user := setupMFAService(t)
+	ctx := context.Background()
+
+	enrollment, err := service.BeginEnrollment(ctx, user)
+	require.NoError(t, err)
+	code, err := utils.GenerateTOTPCode(enrollment.Secret, utils.TOTPStep(time.Now()))
+	require.NoError(t, err)
+	codes, err := service.ConfirmEnrollment(ctx, user.ID, code)
+	require.NoError(t, err)
+
+	assert.NoError(t, service.Verify(ctx, user.ID, codes[0]))
+	assert.ErrorIs(t, service.Verify(ctx, user.ID, codes[0]), services.ErrInvalidMFACode)
+
+	status, err := service.GetStatus(ctx, user.ID)
+	require.NoError(t, err)
+	assert.True(t, status.Enabled)
+	assert.Equal(t, int64(9), status.RecoveryCodesRemaining)
+
+	// Disabling requires a valid code and removes the enrollment
+	require.NoError(t, service.Disable(ctx, user.ID, codes[1], "10.0.0.1"))
+	enabled, err := service.IsEnabled(ctx, user.ID)
+	require.NoError(t, err)
+	assert.False(t, enabled)
+}
+
+func setupMFAChallenge(t *testing.T) (*services.AuthService, *models.User, string, *fakeRedis) {
+	t.Setenv("JWT_SECRET", "test-secret")
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	require.NoError(t, err)
+	require.NoError(t, db.AutoMigrate(&models.User{}, &models.UserMFA{}, &models.MFARecoveryCode{}))
+
+	user := &models.User{Email: "challenge@example.com", Password: "password123", Name: "Challenge", IsActive: true}
+	require.NoError(t, db.Create(user).Error)
+
+	logger := &config.Logger{Logger: zap.NewNop()}
+	mfa := services.NewMFAService(db, logger)
+	ctx := context.Background()
+	enrollment, err := mfa.BeginEnrollment(ctx, user)
+	require.NoError(t, err)
+	code, err := utils.GenerateTOTPCode(enrollment.Secret, utils.TOTPStep(time.Now())-1)
+	require.NoError(t, err)
+	codes, err := mfa.ConfirmEnrollment(ctx, user.ID, code)
+	require.NoError(t, err)
+
+	client, server := newFakeRedis(t)
+	lockout, err := services.NewLoginLockoutService(db, client, logger)
+	require.NoError(t, err)
+	service := services.NewAuthService(db, nil, services.NewTokenBlacklistService(client), lockout, nil, logger)
+	return service, user, codes[0], server
+}
+
+func TestAuthService_VerifyMFAChallenge_RevokesChallengeAfterFailures(t *testing.T) {
+	// Keep the account-wide lockout out of the way
+	t.Setenv("LOGIN_DELAY_AFTER_FAILURES", "100")
+	t.Setenv("LOGIN_LOCK_AFTER_FAILURES", "100")
+	service, user, recoveryCode, server := setupMFAChallenge(t)
+	ctx := context.Background()
+
+	challenge, err := utils.GenerateMFAChallengeToken(user.ID, user.Email, utils.AuthMethodPassword)
+	require.NoError(t, err)
+	for i := 0; i < 5; i++ {
+		_, _, err := service.VerifyMFAChallenge(ctx, challenge, "wrong-code", "10.0.0.1")
+		require.ErrorIs(t, err, services.ErrInvalidMFACode, "attempt %d", i+1)
+	}
+
+	// The fifth wrong code used up the challenge, so even a valid code is refused
+	_, _, err = service.VerifyMFAChallenge(ctx, challenge, recoveryCode, "10.0.0.1")
+	require.ErrorIs(t, err, services.ErrInvalidMFAToken)
+	assert.NotEmpty(t, server.Keys("login:failures:account:"), "wrong codes count against the account")
+
+	// A new challenge needs the first factor again; completing it clears the failures
+	challenge, err = utils.GenerateMFAChallengeToken(user.ID, user.Email, utils.AuthMethodPassword)
+	require.NoError(t, err)
+	verified, _, err := service.VerifyMFAChallenge(ctx, challenge, recoveryCode, "10.0.0.1")
+	require.NoError(t, err)
+	assert.Equal(t, user.ID, verified.ID)
+	assert.Empty(t, server.Keys("login:failures:account:"))
+}
+
+func TestAuthService_VerifyMFAChallenge_ThrottlesAccount(t *testing.T) {
+	service, user, recoveryCode, _ := setupMFAChallenge(t)
+	ctx := context.Background()
+
+	// Every challenge is new, but the account's failures add up across them
+	for i := 0; i < 3; i++ {
+		challenge, err := utils.GenerateMFAChallengeToken(user.ID, user.Email, utils.AuthMethodPassword)
+		require.NoError(t, err)
+		_, _, err = service.VerifyMFAChallenge(ctx, challenge, "wrong-code", "10.0.0.1")
+		require.ErrorIs(t, err, services.ErrInvalidMFACode)
+	}
+
+	challenge, err := utils.GenerateMFAChallengeToken(user.ID, user.Email, utils.AuthMethodPassword)
+	require.NoError(t, err)
+	_, _, err = service.VerifyMFAChallenge(ctx, challenge, recoveryCode, "10.0.0.1")
+	require.ErrorIs(t, err, services.ErrTooManyLoginAttempts)
+
+	var retryErr *services.LoginRetryError
+	require.ErrorAs(t, err, &retryErr)
+	assert.Greater(t, retryErr.RetryAfter, time.Duration(0))
+}
+
+func TestMFAService_WrongCodesCountAsFailedLogins(t *testing.T) {
+	service, user := setupMFAService(t)
+	ctx := context.Background()
+
+	enrollment, err := service.BeginEnrollment(ctx, user)
+	require.NoError(t, err)
+	code, err := utils.GenerateTOTPCode(enrollment.Secret, utils.TOTPStep(time.Now()))
+	require.NoError(t, err)
+	codes, err := service.ConfirmEnrollment(ctx, user.ID, code)
+	require.NoError(t, err)
+
+	client, _ := newFakeRedis(t)
+	lockout, err := services.NewLoginLockoutService(nil, client, &config.Logger{Logger: zap.NewNop()})
+	require.NoError(t, err)
+	service.SetLoginLockout(lockout)
+
+	// Guessing codes to turn two-factor off is throttled like guessing passwords
+	for i := 0; i < 3; i++ {
+		require.ErrorIs(t, service.Disable(ctx, user.ID, "wrong-code", "10.0.0.1"), services.ErrInvalidMFACode)
+	}
+	require.ErrorIs(t, service.Disable(ctx, user.ID, codes[0], "10.0.0.1"), services.ErrTooManyLoginAttempts)
+	_, err = service.RegenerateRecoveryCodes(ctx, user.ID, codes[0], "10.0.0.1")
+	require.ErrorIs(t, err, services.ErrTooManyLoginAttempts)
+
+	enabled, err := service.IsEnabled(ctx, user.ID)
+	require.NoError(t, err)
+	assert.True(t, enabled)
+}
@@ -0,0 +1,191 @@
+package unit
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"mobile-backend/models"
+	"mobile-backend/services"
+	"mobile-backend/utils"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+// newTestOIDCProvider serves a discovery document and key set backed by a fresh RSA key
+func newTestOIDCProvider(t *testing.T) (*httptest.Server, *utils.Keyring) {
+	key, err := utils.GenerateSigningKey(utils.SigningAlgRS256)
+	require.NoError(t, err)
+	keyring := utils.NewKeyring([]*utils.SigningKey{key}, "", time.Time{})
+
+	mux := http.NewServeMux()
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(services.OIDCDiscovery{
+			Issuer:                server.URL,
+			AuthorizationEndpoint: server.URL + "/authorize",
+			TokenEndpoint:         server.URL + "/token",
+			JWKSURI:               server.URL + "/jwks",
+		})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(keyring.JWKS())
+	})
+
+	return server, keyring
+}
+
+func signIDToken(t *testing.T, keyring *utils.Keyring, issuer, audience, nonce string) string {
+	token, err := keyring.Sign(services.IDTokenClaims{
+		Nonce:         nonce,
+		Email:         "user@example.com",
+		EmailVerified: true,
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    issuer,
+			Subject:   "subject-1",
+			Audience:  jwt.ClaimStrings{audience},
+			IssuedAt:  jwt.NewNumericDate(time.Now()),
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Minute)),
+		},
+	})
+	require.NoError(t, err)
+	return token
+}
+
+func TestOIDCClient_ValidateIDToken(t *testing.T) {
+	server, keyring := newTestOIDCProvider(t)
+	client := services.NewOIDCClient(server.Client())
+	ctx := context.Background()
+
+	claims, err := client.ValidateIDToken(ctx, server.URL, signIDToken(t, keyring, server.URL, "client-id", "nonce-1"), "nonce-1", "client-id")
+	require.NoError(t, err)
+	assert.Equal(t, "subject-1", claims.Subject)
+	assert.True(t, bool(claims.EmailVerified))
+
+	_, err = client.ValidateIDToken(ctx, server.URL, signIDToken(t, keyring, server.URL, "client-id", "nonce-1"), "other-nonce", "client-id")
+	assert.ErrorIs(t, err, services.ErrInvalidIDToken)
+
+	_, err = client.ValidateIDToken(ctx, server.URL, signIDToken(t, keyring, server.URL, "another-client", "nonce-1"), "nonce-1", "client-id")
+	assert.ErrorIs(t, err, services.ErrInvalidIDToken)
+
+	_, err = client.ValidateIDToken(ctx, server.URL, signIDToken(t, keyring, "https://evil.example", "client-id", "nonce-1"), "nonce-1", "client-id")
+	assert.ErrorIs(t, err, services.ErrInvalidIDToken)
+}
+
+func setupOAuth2Service(t *testing.T) (*services.OAuth2Service, *gorm.DB) {
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	require.NoError(t, err)
+	require.NoError(t, db.AutoMigrate(&models.User{}, &models.UserIdentity{}, &models.OAuthProvider{}))
+
+	return services.NewOAuth2Service(db, nil), db
+}
+
+func TestOAuth2Service_LinksIdentitiesByVerifiedEmailOnly(t *testing.T) {
+	service, db := setupOAuth2Service(t)
+	ctx := context.Background()
+
+	existing := &models.User{Email: "user@example.com", Password: "password123", Name: "Existing", IsActive: true}
+	require.NoError(t, db.Create(existing).Error)
+
+	// An unverified email must not be used to take over the account
+	_, err := service.CreateOrUpdateUser(ctx, &services.OAuth2User{ID: "ms-1", Email: existing.Email, Provider: "microsoft"})
+	assert.ErrorIs(t, err, services.ErrOAuthAccountExists)
+
+	user, err := service.CreateOrUpdateUser(ctx, &services.OAuth2User{ID: "g-1", Email: existing.Email, EmailVerified: true, Provider: "google"})
+	require.NoError(t, err)
+	assert.Equal(t, existing.ID, user.ID)
+
+	// Later logins resolve by subject even if the provider email changes
+	user, err = service.CreateOrUpdateUser(ctx, &services.OAuth2User{ID: "g-1", Email: "renamed@example.com", EmailVerified: true, Provider: "google"})
+	require.NoError(t, err)
+	assert.Equal(t, existing.ID, user.ID)
+
+	// A second provider can be linked explicitly and the subject can't be claimed twice
+	_, err = service.LinkIdentity(ctx, existing.ID, &services.OAuth2User{ID: "ms-1", Email: existing.Email, Provider: "microsoft"})
+	require.NoError(t, err)
+	_, err = service.LinkIdentity(ctx, existing.ID+1, &services.OAuth2User{ID: "ms-1", Provider: "microsoft"})
+	assert.ErrorIs(t, err, services.ErrIdentityAlreadyLinked)
+
+	identities, err := service.ListIdentities(ctx, existing.ID)
+	require.NoError(t, err)
+	assert.Len(t, identities, 2)
+}
+
+func TestOAuth2Service_LoadProviders(t *testing.T) {
+	service, db := setupOAuth2Service(t)
+	t.Setenv("GITHUB_CLIENT_ID", "github-client")
+	t.Setenv("OIDC_PROVIDERS", "acme")
+	t.Setenv("OIDC_ACME_ISSUER", "https://sso.acme.example")
+	t.Setenv("OIDC_ACME_CLIENT_ID", "acme-client")
+
+	require.NoError(t, db.Create(&models.OAuthProvider{
+		Name:      "okta",
+		Type:      models.OAuthProviderTypeOIDC,
+		ClientID:  "okta-client",
+		IssuerURL: "https://example.okta.com",
+		Enabled:   true,
+	}).Error)
+
+	require.NoError(t, service.LoadProviders(context.Background()))
+
+	names := []string{}
+	for _, provider := range service.Providers() {
+		names = append(names, provider.Name)
+	}
+	assert.Equal(t, []string{"acme", "github", "okta"}, names)
+
+	cfg, err := service.GetConfig("acme")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"openid", "email", "profile"}, cfg.Scopes)
+
+	_, err = service.GetConfig("unknown")
+	assert.ErrorIs(t, err, services.ErrUnsupportedOAuth2Provider)
+}
+
+func TestOAuth2Service_ExchangeIDToken(t *testing.T) {
+	server, keyring := newTestOIDCProvider(t)
+	service, _ := setupOAuth2Service(t)
+	ctx := context.Background()
+
+	require.NoError(t, service.RegisterProvider(&services.OAuth2Config{
+		Name:            "apple",
+		Type:            models.OAuthProviderTypeOIDC,
+		ClientID:        "com.example.app.signin",
+		IssuerURL:       server.URL,
+		NativeClientIDs: []string{"com.example.app"},
+	}))
+
+	// Apple's SDK embeds the SHA-256 of the raw nonce the app generated
+	token := signIDToken(t, keyring, server.URL, "com.example.app", utils.HashToken("raw-nonce"))
+	result, err := service.ExchangeIDToken(ctx, services.AppleProvider, services.IDTokenExchangeParams{IDToken: token, Nonce: "raw-nonce", Name: "Jane Appleseed"})
+	require.NoError(t, err)
+	assert.Equal(t, "user@example.com", result.User.Email)
+	assert.Equal(t, "Jane Appleseed", result.User.Name)
+
+	_, err = service.ExchangeIDToken(ctx, services.AppleProvider, services.IDTokenExchangeParams{IDToken: token})
+	assert.ErrorIs(t, err, services.ErrInvalidIDToken, "a nonce-bound token needs its nonce")
+
+	token = signIDToken(t, keyring, server.URL, "com.other.app", "")
+	_, err = service.ExchangeIDToken(ctx, services.AppleProvider, services.IDTokenExchangeParams{IDToken: token})
+	assert.ErrorIs(t, err, services.ErrInvalidIDToken, "tokens issued to other apps are rejected")
+
+	require.NoError(t, service.RegisterProvider(&services.OAuth2Config{
+		Name:        "github",
+		Type:        models.OAuthProviderTypeOAuth2,
+		ClientID:    "github-client",
+		AuthURL:     server.URL + "/authorize",
+		TokenURL:    server.URL + "/token",
+		UserInfoURL: server.URL + "/user",
+	}))
+	_, err = service.ExchangeIDToken(ctx, services.GitHubProvider, services.IDTokenExchangeParams{IDToken: token})
+	assert.ErrorIs(t, err, services.ErrIDTokenExchangeNotAllowed)
+}
@@ -0,0 +1,304 @@
+package unit
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	"mobile-backend/config"
+	"mobile-backend/middleware"
+	"mobile-backend/models"
+	"mobile-backend/services"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func setupOrganizationService(t *testing.T) (*services.OrganizationService, *gorm.DB) {
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	require.NoError(t, err)
+	require.NoError(t, models.RegisterTenantScope(db))
+	require.NoError(t, db.AutoMigrate(
+		&models.User{},
+		&models.Organization{},
+		&models.OrganizationMembership{},
+		&models.OrganizationInvitation{},
+		&models.Product{},
+	))
+
+	service, err := services.NewOrganizationService(db, nil, &config.Logger{Logger: zap.NewNop()})
+	require.NoError(t, err)
+	return service, db
+}
+
+func createOrganizationUser(t *testing.T, db *gorm.DB, email string) *models.User {
+	user := &models.User{Email: email, Password: "password123", Name: "Member", IsActive: true}
+	require.NoError(t, db.Create(user).Error)
+	return user
+}
+
+func TestTenantScope_IsolatesTenantOwnedRows(t *testing.T) {
+	_, db := setupOrganizationService(t)
+	acme := models.WithOrganization(context.Background(), 1)
+	globex := models.WithOrganization(context.Background(), 2)
+
+	// The organization comes from the context, not from the record
+	otherTenant := uint(2)
+	widget := &models.Product{Name: "Widget", Price: 100, Currency: "usd", OrganizationID: &otherTenant}
+	require.NoError(t, db.WithContext(acme).Create(widget).Error)
+	require.NotNil(t, widget.OrganizationID)
+	assert.Equal(t, uint(1), *widget.OrganizationID)
+
+	gadget := &models.Product{Name: "Gadget", Price: 200, Currency: "usd"}
+	require.NoError(t, db.WithContext(globex).Create(gadget).Error)
+
+	var products []models.Product
+	require.NoError(t, db.WithContext(acme).Find(&products).Error)
+	require.Len(t, products, 1)
+	assert.Equal(t, "Widget", products[0].Name)
+
+	var product models.Product
+	assert.ErrorIs(t, db.WithContext(acme).First(&product, gadget.ID).Error, gorm.ErrRecordNotFound)
+
+	// Writes can't reach or move rows across tenants
+	result := db.WithContext(acme).Model(&models.Product{}).Where("id = ?", gadget.ID).Update("name", "Hijacked")
+	require.NoError(t, result.Error)
+	assert.Zero(t, result.RowsAffected)
+
+	result = db.WithContext(acme).Delete(&models.Product{}, gadget.ID)
+	require.NoError(t, result.Error)
+	assert.Zero(t, result.RowsAffected)
+
+	widget.OrganizationID = &otherTenant
+	require.NoError(t, db.WithContext(acme).Save(widget).Error)
+	require.NoError(t, db.WithContext(acme).First(&product, widget.ID).Error)
+	assert.Equal(t, uint(1), *product.OrganizationID)
+}
+
+func TestTenantScope_RejectsUnscopedContexts(t *testing.T) {
+	_, db := setupOrganizationService(t)
+	acme := models.WithOrganization(context.Background(), 1)
+
+	widget := &models.Product{Name: "Widget", Price: 100, Currency: "usd"}
+	require.NoError(t, db.WithContext(acme).Create(widget).Error)
+
+	// Forgetting the request context fails instead of reaching every tenant
+	var count int64
+	assert.ErrorIs(t, db.Model(&models.Product{}).Count(&count).Error, models.ErrTenantRequired)
+	var product models.Product
+	assert.ErrorIs(t, db.WithContext(context.Background()).First(&product, widget.ID).Error, models.ErrTenantRequired)
+	assert.ErrorIs(t, db.Create(&models.Product{Name: "Orphan", Price: 100, Currency: "usd"}).Error, models.ErrTenantRequired)
+	assert.ErrorIs(t, db.Model(&models.Product{}).Where("id = ?", widget.ID).Update("name", "Renamed").Error, models.ErrTenantRequired)
+	assert.ErrorIs(t, db.Delete(&models.Product{}, widget.ID).Error, models.ErrTenantRequired)
+
+	// Models that aren't tenant-owned are unaffected
+	require.NoError(t, db.Model(&models.User{}).Count(&count).Error)
+
+	// Cross-tenant code opts out explicitly
+	unscoped := models.WithoutTenantScope(context.Background())
+	require.NoError(t, db.WithContext(unscoped).Model(&models.Product{}).Count(&count).Error)
+	assert.Equal(t, int64(1), count)
+	require.NoError(t, db.WithContext(unscoped).First(&product, widget.ID).Error)
+	assert.Equal(t, "Widget", product.Name)
+}
+
+func TestTenantScope_BillingUsesGlobalCatalog(t *testing.T) {
+	_, db := setupOrganizationService(t)
+	require.NoError(t, db.AutoMigrate(&models.Payment{}))
+	user := createOrganizationUser(t, db, "buyer@example.com")
+
+	provider, err := services.NewFakePaymentProvider(db, nil)
+	require.NoError(t, err)
+
+	// Billing runs outside any organization and opts out of the scope itself
+	ctx := context.Background()
+	product, err := provider.CreateProduct(ctx, &models.Product{Name: "Pro", Price: 999, Currency: "usd"})
+	require.NoError(t, err)
+	assert.Nil(t, product.OrganizationID)
+
+	payment, err := provider.CreatePayment(ctx, user.ID, product.ID, product.Price, product.Currency)
+	require.NoError(t, err)
+	assert.Equal(t, "Payment for Pro", payment.Description)
+}
+
+func TestTenantScope_OfflineSyncStaysInOrganization(t *testing.T) {
+	_, db := setupOrganizationService(t)
+	require.NoError(t, db.AutoMigrate(&models.OfflineOperation{}, &models.SyncStatus{}, &models.SyncHistory{}, &models.SyncConflict{}, &models.DataVersion{}))
+	user := createOrganizationUser(t, db, "member@example.com")
+	acme := models.WithOrganization(context.Background(), 1)
+	globex := models.WithOrganization(context.Background(), 2)
+
+	gadget := &models.Product{Name: "Gadget", Price: 200, Currency: "usd"}
+	require.NoError(t, db.WithContext(globex).Create(gadget).Error)
+	gadgetID := strconv.FormatUint(uint64(gadget.ID), 10)
+
+	service := services.NewOfflineSyncService(db, nil, nil, nil, zap.NewNop())
+	queue := func(ctx context.Context, operationType, table, recordID string, data models.JSONMap) *models.OfflineOperation {
+		operation := &models.OfflineOperation{OperationType: operationType, TableName: table, RecordID: recordID, Data: data}
+		require.NoError(t, service.QueueOperation(ctx, user.ID, operation))
+		return operation
+	}
+
+	// Organization data can only be synced within an organization
+	err := service.QueueOperation(context.Background(), user.ID, &models.OfflineOperation{OperationType: models.OperationTypeDelete, TableName: "products", RecordID: gadgetID})
+	assert.ErrorIs(t, err, models.ErrTenantRequired)
+
+	update := queue(acme, models.OperationTypeUpdate, "products", gadgetID, models.JSONMap{"name": "Hijacked"})
+	remove := queue(acme, models.OperationTypeDelete, "products", gadgetID, nil)
+	rawDelete := queue(acme, models.OperationTypeDelete, "categories", "1", nil)
+	create := queue(acme, models.OperationTypeCreate, "products", "", models.JSONMap{"name": "Widget", "price": 100, "currency": "usd", "organization_id": 2})
+
+	// Operations run in the organization they were queued in, not the one syncing
+	require.NoError(t, service.SyncUserData(globex, user.ID))
+
+	status := func(operation *models.OfflineOperation) string {
+		var stored models.OfflineOperation
+		require.NoError(t, db.First(&stored, operation.ID).Error)
+		return stored.Status
+	}
+	assert.Equal(t, models.OperationStatusFailed, status(update))
+	assert.Equal(t, models.OperationStatusFailed, status(remove))
+	assert.Equal(t, models.OperationStatusFailed, status(rawDelete))
+	assert.Equal(t, models.OperationStatusCompleted, status(create))
+
+	var product models.Product
+	require.NoError(t, db.WithContext(globex).First(&product, gadget.ID).Error)
+	assert.Equal(t, "Gadget", product.Name)
+
+	var widget models.Product
+	require.NoError(t, db.WithContext(acme).Where("name = ?", "Widget").First(&widget).Error)
+	assert.Equal(t, uint(1), *widget.OrganizationID)
+}
+
+func TestOrganizationService_Invitations(t *testing.T) {
+	service, db := setupOrganizationService(t)
+	ctx := context.Background()
+	owner := createOrganizationUser(t, db, "owner@example.com")
+	invitee := createOrganizationUser(t, db, "invitee@example.com")
+	stranger := createOrganizationUser(t, db, "stranger@example.com")
+
+	organization, err := service.CreateOrganization(ctx, owner.ID, "Acme Inc")
+	require.NoError(t, err)
+	assert.Regexp(t, `^acme-inc-[0-9a-f]{6}$`, organization.Slug)
+
+	membership, err := service.GetMembership(ctx, organization.ID, owner.ID)
+	require.NoError(t, err)
+	assert.Equal(t, models.OrganizationRoleOwner, membership.Role)
+
+	_, _, err = service.CreateInvitation(ctx, organization.ID, owner.ID, "OWNER@example.com", models.OrganizationRoleMember)
+	assert.ErrorIs(t, err, services.ErrAlreadyOrganizationMember)
+
+	_, token, err := service.CreateInvitation(ctx, organization.ID, owner.ID, "Invitee@Example.com", models.OrganizationRoleAdmin)
+	require.NoError(t, err)
+
+	_, err = service.AcceptInvitation(ctx, stranger, token)
+	assert.ErrorIs(t, err, services.ErrInvitationEmailMismatch)
+
+	membership, err = service.AcceptInvitation(ctx, invitee, token)
+	require.NoError(t, err)
+	assert.Equal(t, organization.ID, membership.OrganizationID)
+	assert.Equal(t, models.OrganizationRoleAdmin, membership.Role)
+
+	_, err = service.AcceptInvitation(ctx, invitee, token)
+	assert.ErrorIs(t, err, services.ErrInvalidInvitation)
+
+	invitations, err := service.ListInvitations(ctx, organization.ID)
+	require.NoError(t, err)
+	assert.Empty(t, invitations)
+}
+
+func TestOrganizationService_KeepsLastOwner(t *testing.T) {
+	service, db := setupOrganizationService(t)
+	ctx := context.Background()
+	owner := createOrganizationUser(t, db, "owner@example.com")
+	member := createOrganizationUser(t, db, "member@example.com")
+
+	organization, err := service.CreateOrganization(ctx, owner.ID, "Acme")
+	require.NoError(t, err)
+	require.NoError(t, db.Create(&models.OrganizationMembership{
+		OrganizationID: organization.ID,
+		UserID:         member.ID,
+		Role:           models.OrganizationRoleMember,
+	}).Error)
+
+	_, err = service.UpdateMemberRole(ctx, organization.ID, owner.ID, models.OrganizationRoleAdmin)
+	assert.ErrorIs(t, err, services.ErrLastOrganizationOwner)
+	assert.ErrorIs(t, service.RemoveMember(ctx, organization.ID, owner.ID), services.ErrLastOrganizationOwner)
+
+	_, err = service.UpdateMemberRole(ctx, organization.ID, member.ID, "superuser")
+	assert.ErrorIs(t, err, services.ErrInvalidOrganizationRole)
+
+	// Once another owner exists the original one can step down
+	_, err = service.UpdateMemberRole(ctx, organization.ID, member.ID, models.OrganizationRoleOwner)
+	require.NoError(t, err)
+	require.NoError(t, service.RemoveMember(ctx, organization.ID, owner.ID))
+
+	_, err = service.GetMembership(ctx, organization.ID, owner.ID)
+	assert.ErrorIs(t, err, services.ErrNotOrganizationMember)
+}
+
+func TestTenantMiddleware_ResolvesOrganization(t *testing.T) {
+	service, db := setupOrganizationService(t)
+	middleware.SetMembershipResolver(service)
+	t.Cleanup(func() { middleware.SetMembershipResolver(nil) })
+
+	owner := createOrganizationUser(t, db, "owner@example.com")
+	outsider := createOrganizationUser(t, db, "outsider@example.com")
+	organization, err := service.CreateOrganization(context.Background(), owner.ID, "Acme")
+	require.NoError(t, err)
+	require.NoError(t, db.WithContext(models.WithOrganization(context.Background(), organization.ID)).
+		Create(&models.Product{Name: "Widget", Price: 100, Currency: "usd"}).Error)
+	require.NoError(t, db.WithContext(models.WithoutTenantScope(context.Background())).
+		Create(&models.Product{Name: "Unowned", Price: 100, Currency: "usd"}).Error)
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	// Stand in for AuthMiddleware
+	r.Use(func(c *gin.Context) {
+		if c.GetHeader("X-User") == "outsider" {
+			c.Set("user_id", outsider.ID)
+		} else {
+			c.Set("user_id", owner.ID)
+		}
+		if c.GetHeader("X-Claim") != "" {
+			c.Set("token_organization_id", organization.ID)
+		}
+	})
+	r.Use(middleware.TenantMiddleware())
+	r.GET("/products", func(c *gin.Context) {
+		var products []models.Product
+		db.WithContext(c.Request.Context()).Find(&products)
+		c.JSON(http.StatusOK, gin.H{"count": len(products)})
+	})
+	r.POST("/products", middleware.RequireOrganizationRole(models.OrganizationRoleMember), func(c *gin.Context) {
+		c.Status(http.StatusCreated)
+	})
+
+	perform := func(method string, headers map[string]string) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest(method, "/products", nil)
+		for k, v := range headers {
+			req.Header.Set(k, v)
+		}
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	orgHeader := map[string]string{middleware.OrganizationHeader: strconv.FormatUint(uint64(organization.ID), 10)}
+	w := perform("GET", orgHeader)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `{"count":1}`, w.Body.String())
+
+	assert.Equal(t, http.StatusOK, perform("GET", map[string]string{"X-Claim": "1"}).Code)
+	assert.Equal(t, http.StatusBadRequest, perform("GET", nil).Code)
+	assert.Equal(t, http.StatusBadRequest, perform("GET", map[string]string{middleware.OrganizationHeader: "acme"}).Code)
+	assert.Equal(t, http.StatusForbidden, perform("GET", map[string]string{middleware.OrganizationHeader: orgHeader[middleware.OrganizationHeader], "X-User": "outsider"}).Code)
+	// The owner doesn't hold the member role
+	assert.Equal(t, http.StatusForbidden, perform("POST", orgHeader).Code)
+}
@@ -0,0 +1,217 @@
+package unit
+
+import (
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"mobile-backend/config"
+	"mobile-backend/models"
+	"mobile-backend/services"
+	"mobile-backend/utils"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+// fastBcrypt and fastArgon2id keep hashing cheap in tests
+var (
+	fastBcrypt   = utils.PasswordHashParams{Algorithm: utils.PasswordHashBcrypt, BcryptCost: 4}
+	fastArgon2id = utils.PasswordHashParams{Algorithm: utils.PasswordHashArgon2id, Argon2Time: 1, Argon2Memory: 64, Argon2Threads: 1}
+)
+
+func usePasswordHashParams(t *testing.T, params utils.PasswordHashParams) {
+	previous := utils.CurrentPasswordHashParams()
+	require.NoError(t, utils.SetPasswordHashParams(params))
+	t.Cleanup(func() { _ = utils.SetPasswordHashParams(previous) })
+}
+
+// writeBreachRange stores a Pwned Passwords range file listing the given passwords
+func writeBreachRange(t *testing.T, dir string, passwords ...string) {
+	for _, password := range passwords {
+		sum := sha1.Sum([]byte(password))
+		hash := strings.ToUpper(hex.EncodeToString(sum[:]))
+		file, err := os.OpenFile(filepath.Join(dir, hash[:5]+".txt"), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+		require.NoError(t, err)
+		_, err = file.WriteString("0018A45C4D1DEF81644B54AB7F969B88D65:3\r\n" + hash[5:] + ":42\r\n")
+		require.NoError(t, err)
+		require.NoError(t, file.Close())
+	}
+}
+
+func setupPasswordPolicy(t *testing.T) (*gorm.DB, *services.PasswordPolicyService, *services.AuthService) {
+	t.Setenv("JWT_SECRET", "test-secret")
+	t.Setenv("PASSWORD_MIN_LENGTH", "10")
+	t.Setenv("PASSWORD_REQUIRED_CLASSES", "lower,upper,digit")
+	t.Setenv("PASSWORD_HISTORY", "3")
+	t.Setenv("PASSWORD_MAX_AGE", "2160h")
+	usePasswordHashParams(t, fastBcrypt)
+
+	breaches := t.TempDir()
+	writeBreachRange(t, breaches, "Password123")
+	t.Setenv("PASSWORD_BREACH_DATASET_DIR", breaches)
+
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	require.NoError(t, err)
+	require.NoError(t, db.AutoMigrate(&models.User{}, &models.PasswordHistory{}, &models.Session{}, &models.UserMFA{}, &models.Role{}, &models.Permission{}, &models.UserRole{}))
+
+	policy, err := services.NewPasswordPolicyService(db)
+	require.NoError(t, err)
+	// Logins cache the session; nothing listens here, so caching fails quietly
+	cache := services.NewCacheService(redis.NewClient(&redis.Options{Addr: "127.0.0.1:1", MaxRetries: -1}))
+	return db, policy, services.NewAuthService(db, cache, nil, nil, policy, &config.Logger{Logger: zap.NewNop()})
+}
+
+func policyViolations(t *testing.T, err error) []string {
+	var policyErr *services.PasswordPolicyError
+	require.True(t, errors.As(err, &policyErr), "expected a password policy error, got %v", err)
+	assert.ErrorIs(t, err, services.ErrWeakPassword)
+	return policyErr.Violations
+}
+
+func TestPasswordHashing_Argon2idAndRehash(t *testing.T) {
+	usePasswordHashParams(t, fastBcrypt)
+	bcryptHash, err := utils.HashPassword("Correct horse 1")
+	require.NoError(t, err)
+	assert.False(t, utils.PasswordNeedsRehash(bcryptHash))
+
+	usePasswordHashParams(t, fastArgon2id)
+	argonHash, err := utils.HashPassword("Correct horse 1")
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(argonHash, "$argon2id$v=19$m=64,t=1,p=1$"))
+
+	// Both formats keep verifying whatever the current algorithm is
+	for _, hash := range []string{bcryptHash, argonHash} {
+		assert.NoError(t, utils.VerifyPassword("Correct horse 1", hash))
+		assert.ErrorIs(t, utils.VerifyPassword("Correct horse 2", hash), utils.ErrPasswordMismatch)
+	}
+
+	assert.True(t, utils.PasswordNeedsRehash(bcryptHash), "bcrypt hashes are upgraded to argon2id")
+	assert.False(t, utils.PasswordNeedsRehash(argonHash))
+
+	stronger := fastArgon2id
+	stronger.Argon2Time = 2
+	usePasswordHashParams(t, stronger)
+	assert.True(t, utils.PasswordNeedsRehash(argonHash), "weaker argon2id parameters are upgraded")
+
+	assert.Error(t, utils.SetPasswordHashParams(utils.PasswordHashParams{Algorithm: "md5"}))
+}
+
+func TestPasswordPolicyService_Validate(t *testing.T) {
+	_, policy, _ := setupPasswordPolicy(t)
+	ctx := context.Background()
+
+	violations := policyViolations(t, policy.Validate(ctx, nil, "short"))
+	assert.Equal(t, []string{
+		"must be at least 10 characters long",
+		"must contain an uppercase letter",
+		"must contain a digit",
+	}, violations)
+
+	violations = policyViolations(t, policy.Validate(ctx, nil, "Password123"))
+	assert.Equal(t, []string{"has appeared in a data breach and must not be used"}, violations)
+
+	assert.NoError(t, policy.Validate(ctx, nil, "Tr0ub4dor&3x"))
+	violations = policyViolations(t, policy.Validate(ctx, nil, "Tr0ub4dor"+strings.Repeat("x", 70)))
+	assert.Equal(t, []string{"must be at most 72 bytes long"}, violations)
+}
+
+func TestAuthService_ChangePassword_EnforcesHistory(t *testing.T) {
+	db, _, service := setupPasswordPolicy(t)
+	ctx := context.Background()
+
+	_, err := service.RegisterUser("history@example.com", "short", "History")
+	policyViolations(t, err)
+
+	user, err := service.RegisterUser("history@example.com", "Original-pass1", "History")
+	require.NoError(t, err)
+	require.NotNil(t, user.PasswordChangedAt)
+
+	err = service.ChangePassword(ctx, user.ID, "Wrong-pass1", "Second-pass22", "")
+	assert.ErrorIs(t, err, services.ErrInvalidCurrentPassword)
+
+	err = service.ChangePassword(ctx, user.ID, "Original-pass1", "Original-pass1", "")
+	assert.Equal(t, []string{"must not match any of your last 3 passwords"}, policyViolations(t, err))
+
+	require.NoError(t, service.ChangePassword(ctx, user.ID, "Original-pass1", "Second-pass22", ""))
+	require.NoError(t, service.ChangePassword(ctx, user.ID, "Second-pass22", "Third-pass333", ""))
+
+	// The last three passwords, the current one included, can't be reused
+	for _, reused := range []string{"Original-pass1", "Second-pass22", "Third-pass333"} {
+		err = service.ChangePassword(ctx, user.ID, "Third-pass333", reused, "")
+		policyViolations(t, err)
+	}
+	require.NoError(t, service.ChangePassword(ctx, user.ID, "Third-pass333", "Fourth-pass4444", ""))
+	require.NoError(t, service.ChangePassword(ctx, user.ID, "Fourth-pass4444", "Original-pass1", ""), "passwords older than the history may be reused")
+
+	var history int64
+	require.NoError(t, db.Model(&models.PasswordHistory{}).Where("user_id = ?", user.ID).Count(&history).Error)
+	assert.EqualValues(t, 2, history, "history is pruned to the configured size")
+}
+
+func TestAuthService_LoginUser_UpgradesPasswordHash(t *testing.T) {
+	db, _, service := setupPasswordPolicy(t)
+	ctx := context.Background()
+
+	user, err := service.RegisterUser("rehash@example.com", "Original-pass1", "Rehash")
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(user.Password, "$2a$04$"))
+
+	usePasswordHashParams(t, fastArgon2id)
+	_, _, err = service.LoginUser(ctx, user.Email, "Original-pass1", "10.0.0.1")
+	require.NoError(t, err)
+
+	var reloaded models.User
+	require.NoError(t, db.First(&reloaded, user.ID).Error)
+	assert.True(t, strings.HasPrefix(reloaded.Password, "$argon2id$"))
+	assert.NoError(t, reloaded.CheckPassword("Original-pass1"))
+
+	// Password age is measured from the last change
+	assert.False(t, service.PasswordExpired(&reloaded))
+	old := reloaded.PasswordChangedAt.AddDate(0, -4, 0)
+	reloaded.PasswordChangedAt = &old
+	assert.True(t, service.PasswordExpired(&reloaded))
+}
+
+func TestAuthService_ExpiredPasswordHoldsBackLogin(t *testing.T) {
+	db, policy, _ := setupPasswordPolicy(t)
+	client, _ := newFakeRedis(t)
+	service := services.NewAuthService(db, services.NewCacheService(client), services.NewTokenBlacklistService(client), nil, policy, &config.Logger{Logger: zap.NewNop()})
+	ctx := context.Background()
+
+	user, err := service.RegisterUser("expired@example.com", "Original-pass1", "Expired")
+	require.NoError(t, err)
+	require.NoError(t, db.Model(user).Update("password_changed_at", time.Now().AddDate(0, -4, 0)).Error)
+
+	// The login only yields a token for changing the password, not a session
+	_, changeToken, err := service.LoginUser(ctx, user.Email, "Original-pass1", "10.0.0.1")
+	require.ErrorIs(t, err, services.ErrPasswordExpired)
+	_, err = utils.ValidateToken(changeToken)
+	assert.Error(t, err, "the change token is not an access token")
+
+	// The new password has to pass the policy, so the old one can't be kept
+	_, err = service.ChangeExpiredPassword(ctx, changeToken, "Original-pass1")
+	policyViolations(t, err)
+	_, err = service.ChangeExpiredPassword(ctx, "not-a-token", "Brand-new-pass2")
+	assert.ErrorIs(t, err, services.ErrInvalidPasswordChangeToken)
+
+	changed, err := service.ChangeExpiredPassword(ctx, changeToken, "Brand-new-pass2")
+	require.NoError(t, err)
+	assert.Equal(t, user.ID, changed.ID)
+
+	_, err = service.ChangeExpiredPassword(ctx, changeToken, "Another-pass33")
+	assert.ErrorIs(t, err, services.ErrInvalidPasswordChangeToken, "the change token works once")
+
+	_, _, err = service.LoginUser(ctx, user.Email, "Brand-new-pass2", "10.0.0.1")
+	assert.NoError(t, err)
+}
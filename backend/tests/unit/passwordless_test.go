@@ -0,0 +1,204 @@
+package unit
+
+import (
+	"context"
+	"regexp"
+	"testing"
+	"time"
+
+	"mobile-backend/config"
+	"mobile-backend/models"
+	"mobile-backend/services"
+	"mobile-backend/utils"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func TestGenerateNumericCode(t *testing.T) {
+	seen := make(map[string]bool)
+	for i := 0; i < 50; i++ {
+		code, err := utils.GenerateNumericCode(6)
+		require.NoError(t, err)
+		assert.Regexp(t, regexp.MustCompile(`^[0-9]{6}$`), code)
+		seen[code] = true
+	}
+	assert.Greater(t, len(seen), 1)
+}
+
+func TestLoginCodeEmail(t *testing.T) {
+	subject, body := services.LoginCodeEmail("042317", 10*time.Minute)
+	assert.Contains(t, subject, "042317")
+	assert.Contains(t, body, "042317")
+	assert.Contains(t, body, "10 minutes")
+}
+
+func TestNewPasswordlessService_RejectsInvalidConfig(t *testing.T) {
+	t.Setenv("PASSWORDLESS_LINK_TTL", "soon")
+
+	_, err := services.NewPasswordlessService(nil, nil, nil, nil)
+	assert.Error(t, err)
+}
+
+type passwordlessFixture struct {
+	service *services.PasswordlessService
+	db      *gorm.DB
+	redis   *redis.Client
+	server  *fakeRedis
+}
+
+func newPasswordlessFixture(t *testing.T) *passwordlessFixture {
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	require.NoError(t, err)
+	require.NoError(t, db.AutoMigrate(&models.User{}))
+
+	client, server := newFakeRedis(t)
+	service, err := services.NewPasswordlessService(db, client, nil, &config.Logger{Logger: zap.NewNop()})
+	require.NoError(t, err)
+	return &passwordlessFixture{service: service, db: db, redis: client, server: server}
+}
+
+// issueCode stores a sign-in code the way Start does, without emailing it
+func (f *passwordlessFixture) issueCode(t *testing.T, email, code string) {
+	require.NoError(t, f.redis.Set(context.Background(), "passwordless:code:"+utils.HashToken(email), utils.HashToken(code), 10*time.Minute).Err())
+}
+
+// issueLink stores a magic link token the way Start does, without emailing it
+func (f *passwordlessFixture) issueLink(t *testing.T, email, token string) {
+	require.NoError(t, f.redis.Set(context.Background(), "passwordless:link:"+utils.HashToken(token), email, 15*time.Minute).Err())
+}
+
+func (f *passwordlessFixture) createUser(t *testing.T, email string) *models.User {
+	user := &models.User{Email: email, Password: "password123", Name: "Passwordless", IsActive: true}
+	require.NoError(t, f.db.Create(user).Error)
+	return user
+}
+
+func (f *passwordlessFixture) userCount(t *testing.T) int64 {
+	var count int64
+	require.NoError(t, f.db.Model(&models.User{}).Count(&count).Error)
+	return count
+}
+
+func TestPasswordlessService_LinksAreSingleUse(t *testing.T) {
+	f := newPasswordlessFixture(t)
+	ctx := context.Background()
+	user := f.createUser(t, "Link@Example.com")
+
+	f.issueLink(t, "link@example.com", "link-token")
+	signedIn, err := f.service.VerifyLink(ctx, "link-token")
+	require.NoError(t, err)
+	assert.Equal(t, user.ID, signedIn.ID, "addresses match regardless of case")
+	assert.NotNil(t, signedIn.EmailVerifiedAt)
+
+	_, err = f.service.VerifyLink(ctx, "link-token")
+	assert.ErrorIs(t, err, services.ErrInvalidPasswordlessCode)
+	assert.Equal(t, int64(1), f.userCount(t))
+}
+
+func TestPasswordlessService_CodesAreSingleUse(t *testing.T) {
+	t.Setenv("PASSWORDLESS_AUTO_SIGNUP", "true")
+	f := newPasswordlessFixture(t)
+	ctx := context.Background()
+	user := f.createUser(t, "Code@Example.com")
+
+	f.issueCode(t, "code@example.com", "123456")
+	signedIn, err := f.service.VerifyCode(ctx, " CODE@example.com ", "123456", "10.0.0.1")
+	require.NoError(t, err)
+	assert.Equal(t, user.ID, signedIn.ID)
+	assert.Equal(t, int64(1), f.userCount(t), "an existing account in another case is not signed up again")
+
+	_, err = f.service.VerifyCode(ctx, "code@example.com", "123456", "10.0.0.1")
+	assert.ErrorIs(t, err, services.ErrInvalidPasswordlessCode)
+}
+
+func TestPasswordlessService_CodeAttemptsAreCapped(t *testing.T) {
+	f := newPasswordlessFixture(t)
+	ctx := context.Background()
+	f.createUser(t, "guess@example.com")
+
+	f.issueCode(t, "guess@example.com", "123456")
+	for i := 0; i < 5; i++ {
+		_, err := f.service.VerifyCode(ctx, "guess@example.com", "000000", "10.0.0.1")
+		require.ErrorIs(t, err, services.ErrInvalidPasswordlessCode)
+	}
+
+	// Past the cap the code is discarded, so even the right one fails
+	_, err := f.service.VerifyCode(ctx, "guess@example.com", "123456", "10.0.0.1")
+	assert.ErrorIs(t, err, services.ErrInvalidPasswordlessCode)
+	assert.Empty(t, f.server.Keys("passwordless:code:"))
+}
+
+func TestPasswordlessService_CodesAndLinksExpire(t *testing.T) {
+	f := newPasswordlessFixture(t)
+	ctx := context.Background()
+	f.createUser(t, "late@example.com")
+
+	f.issueCode(t, "late@example.com", "123456")
+	f.issueLink(t, "late@example.com", "link-token")
+	f.server.Advance(16 * time.Minute)
+
+	_, err := f.service.VerifyCode(ctx, "late@example.com", "123456", "10.0.0.1")
+	assert.ErrorIs(t, err, services.ErrInvalidPasswordlessCode)
+	_, err = f.service.VerifyLink(ctx, "link-token")
+	assert.ErrorIs(t, err, services.ErrInvalidPasswordlessCode)
+}
+
+func TestPasswordlessService_AutoSignup(t *testing.T) {
+	ctx := context.Background()
+
+	f := newPasswordlessFixture(t)
+	f.issueCode(t, "new@example.com", "123456")
+	_, err := f.service.VerifyCode(ctx, "new@example.com", "123456", "10.0.0.1")
+	assert.ErrorIs(t, err, services.ErrInvalidPasswordlessCode, "unknown addresses need automatic signup")
+	assert.Zero(t, f.userCount(t))
+
+	// Unknown addresses get no email either, so nothing is stored
+	require.NoError(t, f.service.Start(ctx, "new@example.com", services.PasswordlessMethodCode, "10.0.0.1"))
+	assert.Empty(t, f.server.Keys("passwordless:code:"))
+
+	t.Setenv("PASSWORDLESS_AUTO_SIGNUP", "true")
+	f = newPasswordlessFixture(t)
+	f.issueCode(t, "new@example.com", "123456")
+	user, err := f.service.VerifyCode(ctx, "New@Example.com", "123456", "10.0.0.1")
+	require.NoError(t, err)
+	assert.Equal(t, "new@example.com", user.Email)
+	assert.Equal(t, "new", user.Name)
+	assert.NotNil(t, user.EmailVerifiedAt)
+	assert.Equal(t, int64(1), f.userCount(t))
+}
+
+func TestPasswordlessService_StartRateLimitIgnoresCase(t *testing.T) {
+	t.Setenv("PASSWORDLESS_EMAIL_RATE_LIMIT", "2")
+	f := newPasswordlessFixture(t)
+	ctx := context.Background()
+
+	require.NoError(t, f.service.Start(ctx, "Limit@Example.com", services.PasswordlessMethodLink, "10.0.0.1"))
+	require.NoError(t, f.service.Start(ctx, "limit@example.com", services.PasswordlessMethodLink, "10.0.0.2"))
+	err := f.service.Start(ctx, " LIMIT@example.com", services.PasswordlessMethodLink, "10.0.0.3")
+	assert.ErrorIs(t, err, services.ErrPasswordlessRateLimited)
+}
+
+func TestPasswordlessService_WrongCodesCountAsFailedLogins(t *testing.T) {
+	f := newPasswordlessFixture(t)
+	ctx := context.Background()
+	f.createUser(t, "throttled@example.com")
+	lockout, err := services.NewLoginLockoutService(f.db, f.redis, &config.Logger{Logger: zap.NewNop()})
+	require.NoError(t, err)
+	f.service.SetLoginLockout(lockout)
+
+	f.issueCode(t, "throttled@example.com", "123456")
+	for i := 0; i < 3; i++ {
+		_, err := f.service.VerifyCode(ctx, "throttled@example.com", "000000", "10.0.0.1")
+		require.ErrorIs(t, err, services.ErrInvalidPasswordlessCode)
+	}
+
+	// The account is throttled like after wrong passwords, so the code isn't even checked
+	_, err = f.service.VerifyCode(ctx, "Throttled@example.com", "123456", "10.0.0.1")
+	require.ErrorIs(t, err, services.ErrTooManyLoginAttempts)
+	assert.NotEmpty(t, f.server.Keys("passwordless:code:"), "a refused attempt doesn't use up the code")
+}
@@ -0,0 +1,88 @@
+package unit
+
+import (
+	"context"
+	"testing"
+
+	"mobile-backend/models"
+	"mobile-backend/services"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+func TestPaymentProviderRegistry(t *testing.T) {
+	db := setupTestDB()
+	fake, err := services.NewFakePaymentProvider(db, nil)
+	require.NoError(t, err)
+	stripeService := services.NewStripeService(db, nil, nil, nil)
+
+	registry := services.NewPaymentProviderRegistry("")
+	_, err = registry.Default()
+	assert.ErrorIs(t, err, services.ErrUnsupportedPaymentProvider, "an empty registry has no default")
+
+	registry.Register(fake)
+	registry.Register(stripeService)
+	assert.Equal(t, []string{"fake", "stripe"}, registry.Names())
+
+	provider, err := registry.Default()
+	require.NoError(t, err)
+	assert.Equal(t, "fake", provider.Name(), "the first registered provider is the default")
+
+	provider, err = registry.Get("stripe")
+	require.NoError(t, err)
+	assert.Equal(t, "Stripe-Signature", provider.WebhookSignatureHeader())
+
+	_, err = registry.Get("paypal")
+	assert.ErrorIs(t, err, services.ErrUnsupportedPaymentProvider)
+
+	configured := services.NewPaymentProviderRegistry("stripe")
+	configured.Register(fake)
+	_, err = configured.Default()
+	assert.ErrorIs(t, err, services.ErrUnsupportedPaymentProvider, "a configured default must be registered")
+}
+
+func TestFakePaymentProvider_Webhooks(t *testing.T) {
+	t.Setenv("FAKE_PAYMENT_WEBHOOK_SECRET", "fake-webhook-secret")
+	ctx := context.Background()
+	db := setupTestDB()
+	fake, err := services.NewFakePaymentProvider(db, services.NewSubscriptionStatusService(db, zap.NewNop()))
+	require.NoError(t, err)
+
+	user := &models.User{Email: "yearly@example.com", Password: "password123", Name: "Yearly", IsActive: true}
+	require.NoError(t, db.Create(user).Error)
+	product, err := fake.CreateProduct(ctx, &models.Product{Name: "Pro", Price: 9900, Currency: "usd", IsActive: true})
+	require.NoError(t, err)
+	plan, err := fake.CreatePrice(ctx, &models.Plan{Name: "Pro yearly", ProductID: product.ID, Price: 9900, Currency: "usd", Interval: "year", IsActive: true})
+	require.NoError(t, err)
+
+	sub, err := fake.CreateSubscription(ctx, user.ID, plan.ID, "")
+	require.NoError(t, err)
+	assert.Equal(t, sub.CurrentPeriodStart.AddDate(1, 0, 0).Unix(), sub.CurrentPeriodEnd.Unix())
+
+	payload, signature, err := fake.NewWebhook(services.FakeEventSubscriptionCanceled, sub.ProviderSubscriptionID)
+	require.NoError(t, err)
+
+	// The secret comes from the environment, so another instance accepts the webhook too
+	other, err := services.NewFakePaymentProvider(db, nil)
+	require.NoError(t, err)
+	assert.Equal(t, signature, other.SignWebhook(payload))
+
+	assert.Error(t, fake.HandleWebhook(ctx, payload, signature[1:]+"0"), "tampered signatures are rejected")
+	assert.Error(t, fake.HandleWebhook(ctx, append(payload, ' '), signature), "the signature covers the payload")
+	require.NoError(t, fake.HandleWebhook(ctx, payload, signature))
+
+	var canceled models.Subscription
+	require.NoError(t, db.First(&canceled, sub.ID).Error)
+	assert.Equal(t, "canceled", canceled.Status)
+	assert.NotNil(t, canceled.CanceledAt)
+
+	var event models.WebhookEvent
+	require.NoError(t, db.Where("provider = ?", services.FakePaymentProviderName).First(&event).Error)
+	assert.True(t, event.Processed)
+
+	payload, signature, err = fake.NewWebhook(services.FakeEventPaymentSucceeded, "fake_pay_unknown")
+	require.NoError(t, err)
+	assert.Error(t, fake.HandleWebhook(ctx, payload, signature), "events about unknown payments fail so the provider retries")
+}
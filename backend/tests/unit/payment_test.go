@@ -208,6 +208,9 @@ func setupTestDB() *gorm.DB {
 		&models.Plan{},
 		&models.Subscription{},
 		&models.Payment{},
+		&models.Refund{},
+		&models.Dispute{},
+		&models.SubscriptionDunning{},
 		&models.PaymentMethod{},
 		&models.WebhookEvent{},
 	); err != nil {
@@ -0,0 +1,276 @@
+package unit
+
+import (
+	"archive/zip"
+	"context"
+	"encoding/json"
+	"io"
+	"os"
+	"testing"
+	"time"
+
+	"mobile-backend/config"
+	"mobile-backend/models"
+	"mobile-backend/services"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func setupPrivacyService(t *testing.T, gracePeriod string) (*services.PrivacyService, *gorm.DB) {
+	t.Setenv("DATA_EXPORT_DIR", t.TempDir())
+	t.Setenv("ACCOUNT_ERASURE_GRACE_PERIOD", gracePeriod)
+
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	require.NoError(t, err)
+	require.NoError(t, db.AutoMigrate(
+		&models.User{},
+		&models.Session{},
+		&models.PasswordHistory{},
+		&models.VerificationToken{},
+		&models.UserMFA{},
+		&models.MFARecoveryCode{},
+		&models.UserIdentity{},
+		&models.APIKey{},
+		&models.UserRole{},
+		&models.Organization{},
+		&models.OrganizationMembership{},
+		&models.OrganizationInvitation{},
+		&models.AuditEvent{},
+		&models.DataRequest{},
+		&models.Subscription{},
+		&models.Payment{},
+		&models.PaymentMethod{},
+		&models.Order{},
+		&models.GeminiConversation{},
+		&models.OfflineOperation{},
+		&models.SyncConflict{},
+		&models.DataVersion{},
+		&models.SyncStatus{},
+		&models.SyncHistory{},
+		&models.DeviceToken{},
+		&models.UserDevice{},
+		&models.IdempotencyKey{},
+	))
+	// The notification models can't be migrated by gorm, so their tables are created by hand
+	require.NoError(t, db.Exec("CREATE TABLE push_notifications (id INTEGER PRIMARY KEY, user_id INTEGER, title TEXT, created_at DATETIME)").Error)
+	require.NoError(t, db.Exec("CREATE TABLE notification_analytics (id INTEGER PRIMARY KEY, notification_id INTEGER, user_id INTEGER, event TEXT, created_at DATETIME)").Error)
+
+	logger := &config.Logger{Logger: zap.NewNop()}
+	service, err := services.NewPrivacyService(db, nil, nil, services.NewAuditService(db, logger), logger)
+	require.NoError(t, err)
+	return service, db
+}
+
+func createPrivacyUser(t *testing.T, db *gorm.DB) *models.User {
+	user := &models.User{Email: "ada@example.com", Password: "password123", Name: "Ada", IsActive: true}
+	require.NoError(t, db.Create(user).Error)
+
+	require.NoError(t, db.Create(&models.Session{UserID: user.ID, FamilyID: "family", Token: "hash", ExpiresAt: time.Now().Add(time.Hour), IsActive: true}).Error)
+	require.NoError(t, db.Create(&models.DeviceToken{UserID: user.ID, Token: "device-token", Platform: "ios", IsActive: true, LastUsedAt: time.Now()}).Error)
+	require.NoError(t, db.Create(&models.OfflineOperation{UserID: user.ID, OperationID: "op-1", OperationType: "create", TableName: "notes", RecordID: "1", Status: "pending"}).Error)
+	require.NoError(t, db.Exec("INSERT INTO notification_analytics (notification_id, user_id, event, created_at) VALUES (1, ?, 'opened', ?)", user.ID, time.Now()).Error)
+	require.NoError(t, db.Create(&models.Payment{UserID: user.ID, ProductID: 1, Amount: 999, Currency: "usd", Status: "succeeded", PaymentMethod: "stripe"}).Error)
+	return user
+}
+
+func readExportArchive(t *testing.T, path string) map[string][]byte {
+	archive, err := zip.OpenReader(path)
+	require.NoError(t, err)
+	defer archive.Close()
+
+	files := map[string][]byte{}
+	for _, f := range archive.File {
+		r, err := f.Open()
+		require.NoError(t, err)
+		data, err := io.ReadAll(r)
+		r.Close()
+		require.NoError(t, err)
+		files[f.Name] = data
+	}
+	return files
+}
+
+func TestPrivacyService_ExportBuildsArchive(t *testing.T) {
+	service, db := setupPrivacyService(t, "336h")
+	ctx := context.Background()
+	user := createPrivacyUser(t, db)
+
+	request, err := service.CreateExportRequest(ctx, user.ID)
+	require.NoError(t, err)
+	again, err := service.CreateExportRequest(ctx, user.ID)
+	require.NoError(t, err)
+	assert.Equal(t, request.ID, again.ID, "a pending export is reused")
+
+	_, err = service.GetExport(ctx, user.ID, request.ID)
+	assert.ErrorIs(t, err, services.ErrDataExportUnavailable)
+
+	require.NoError(t, service.ProcessExport(ctx, request.ID))
+	require.NoError(t, service.ProcessExport(ctx, request.ID), "finished requests are skipped")
+
+	export, err := service.GetExport(ctx, user.ID, request.ID)
+	require.NoError(t, err)
+	assert.Equal(t, models.DataRequestCompleted, export.Status)
+	assert.NotNil(t, export.ExpiresAt)
+	assert.Positive(t, export.FileSize)
+
+	_, err = service.GetExport(ctx, user.ID+1, request.ID)
+	assert.ErrorIs(t, err, services.ErrDataRequestNotFound)
+
+	files := readExportArchive(t, export.FilePath)
+	assert.NotContains(t, string(files["profile.json"]), `"password":`)
+	assert.Contains(t, string(files["profile.json"]), user.Email)
+
+	var devices []map[string]interface{}
+	require.NoError(t, json.Unmarshal(files["device_tokens.json"], &devices))
+	require.Len(t, devices, 1)
+	assert.Equal(t, "device-token", devices[0]["token"])
+	assert.NotContains(t, devices[0], "user")
+
+	var manifest struct {
+		UserID  uint           `json:"user_id"`
+		Records map[string]int `json:"records"`
+	}
+	require.NoError(t, json.Unmarshal(files["manifest.json"], &manifest))
+	assert.Equal(t, user.ID, manifest.UserID)
+	assert.Equal(t, 1, manifest.Records["sessions"])
+	assert.Equal(t, 1, manifest.Records["payments"])
+	assert.Equal(t, 1, manifest.Records["notification_analytics"])
+	assert.Equal(t, 0, manifest.Records["gemini_conversations"])
+
+	// Expired archives are removed and can no longer be downloaded
+	require.NoError(t, db.Model(&models.DataRequest{}).Where("id = ?", request.ID).Update("expires_at", time.Now().Add(-time.Minute)).Error)
+	purged, err := service.PurgeExpiredExports(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 1, purged)
+	_, err = os.Stat(export.FilePath)
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestPrivacyService_ErasureWaitsForGracePeriodAndCanBeCancelled(t *testing.T) {
+	service, db := setupPrivacyService(t, "1h")
+	ctx := context.Background()
+	user := createPrivacyUser(t, db)
+
+	request, err := service.ScheduleErasure(ctx, user.ID)
+	require.NoError(t, err)
+	require.NotNil(t, request.ScheduledFor)
+	assert.WithinDuration(t, time.Now().Add(time.Hour), *request.ScheduledFor, time.Minute)
+
+	_, err = service.ScheduleErasure(ctx, user.ID)
+	assert.ErrorIs(t, err, services.ErrErasureAlreadyScheduled)
+
+	assert.ErrorIs(t, service.ProcessErasure(ctx, request.ID), services.ErrErasureNotDue)
+
+	cancelled, err := service.CancelRequest(ctx, user.ID, request.ID)
+	require.NoError(t, err)
+	assert.Equal(t, models.DataRequestCancelled, cancelled.Status)
+	_, err = service.CancelRequest(ctx, user.ID, request.ID)
+	assert.ErrorIs(t, err, services.ErrDataRequestNotCancellable)
+
+	// A job that fires after cancellation leaves the account alone
+	require.NoError(t, db.Model(&models.DataRequest{}).Where("id = ?", request.ID).Update("scheduled_for", time.Now().Add(-time.Minute)).Error)
+	require.NoError(t, service.ProcessErasure(ctx, request.ID))
+
+	var stored models.User
+	require.NoError(t, db.First(&stored, user.ID).Error)
+	assert.Equal(t, "ada@example.com", stored.Email)
+
+	requests, err := service.ListRequests(ctx, user.ID)
+	require.NoError(t, err)
+	require.Len(t, requests, 1)
+	assert.Equal(t, models.DataRequestCancelled, requests[0].Status)
+}
+
+func TestPrivacyService_ErasureRemovesPersonalData(t *testing.T) {
+	service, db := setupPrivacyService(t, "0s")
+	ctx := context.Background()
+	user := createPrivacyUser(t, db)
+
+	organization := &models.Organization{Name: "Solo", Slug: "solo", CreatedBy: user.ID}
+	require.NoError(t, db.Create(organization).Error)
+	require.NoError(t, db.Create(&models.OrganizationMembership{OrganizationID: organization.ID, UserID: user.ID, Role: models.OrganizationRoleOwner}).Error)
+
+	export, err := service.CreateExportRequest(ctx, user.ID)
+	require.NoError(t, err)
+	require.NoError(t, service.ProcessExport(ctx, export.ID))
+	export, err = service.GetExport(ctx, user.ID, export.ID)
+	require.NoError(t, err)
+
+	request, err := service.ScheduleErasure(ctx, user.ID)
+	require.NoError(t, err)
+	require.NoError(t, service.ProcessErasure(ctx, request.ID))
+
+	request, err = service.GetRequest(ctx, user.ID, request.ID)
+	require.NoError(t, err)
+	assert.Equal(t, models.DataRequestCompleted, request.Status)
+
+	for _, model := range []interface{}{
+		&models.Session{},
+		&models.DeviceToken{},
+		&models.OfflineOperation{},
+		&models.OrganizationMembership{},
+	} {
+		var count int64
+		require.NoError(t, db.Unscoped().Model(model).Where("user_id = ?", user.ID).Count(&count).Error)
+		assert.Zero(t, count, "%T rows remain", model)
+	}
+	var analytics int64
+	require.NoError(t, db.Table("notification_analytics").Where("user_id = ?", user.ID).Count(&analytics).Error)
+	assert.Zero(t, analytics)
+
+	var erased models.User
+	require.NoError(t, db.Unscoped().First(&erased, user.ID).Error)
+	assert.True(t, erased.DeletedAt.Valid)
+	assert.NotEqual(t, "ada@example.com", erased.Email)
+	assert.Empty(t, erased.Name)
+	assert.Empty(t, erased.Password)
+	assert.False(t, erased.IsActive)
+
+	// Payments are kept as business records, linked only to the anonymized ID
+	var payments int64
+	require.NoError(t, db.Model(&models.Payment{}).Where("user_id = ?", user.ID).Count(&payments).Error)
+	assert.Equal(t, int64(1), payments)
+
+	var remaining int64
+	require.NoError(t, db.Model(&models.Organization{}).Count(&remaining).Error)
+	assert.Zero(t, remaining, "organizations left without members are deleted")
+
+	_, err = os.Stat(export.FilePath)
+	assert.True(t, os.IsNotExist(err), "exports are removed with the account")
+
+	var events []models.AuditEvent
+	require.NoError(t, db.Where("action = ?", models.AuditActionAccountErased).Find(&events).Error)
+	require.Len(t, events, 1)
+	assert.Equal(t, models.AuditActorSystem, events[0].ActorType)
+}
+
+func TestPrivacyService_ErasureBlockedByOpenObligations(t *testing.T) {
+	service, db := setupPrivacyService(t, "336h")
+	ctx := context.Background()
+	user := createPrivacyUser(t, db)
+
+	subscription := &models.Subscription{UserID: user.ID, ProductID: 1, Status: "active", CurrentPeriodStart: time.Now(), CurrentPeriodEnd: time.Now().AddDate(0, 1, 0)}
+	require.NoError(t, db.Create(subscription).Error)
+	_, err := service.ScheduleErasure(ctx, user.ID)
+	assert.ErrorIs(t, err, services.ErrErasureBlocked)
+	require.NoError(t, db.Model(subscription).Update("status", "canceled").Error)
+
+	// The only owner of a team must hand it over first
+	member := &models.User{Email: "grace@example.com", Password: "password123", Name: "Grace"}
+	require.NoError(t, db.Create(member).Error)
+	organization := &models.Organization{Name: "Team", Slug: "team", CreatedBy: user.ID}
+	require.NoError(t, db.Create(organization).Error)
+	require.NoError(t, db.Create(&models.OrganizationMembership{OrganizationID: organization.ID, UserID: user.ID, Role: models.OrganizationRoleOwner}).Error)
+	require.NoError(t, db.Create(&models.OrganizationMembership{OrganizationID: organization.ID, UserID: member.ID, Role: models.OrganizationRoleMember}).Error)
+
+	_, err = service.ScheduleErasure(ctx, user.ID)
+	assert.ErrorIs(t, err, services.ErrErasureBlocked)
+
+	require.NoError(t, db.Model(&models.OrganizationMembership{}).Where("user_id = ?", member.ID).Update("role", models.OrganizationRoleOwner).Error)
+	_, err = service.ScheduleErasure(ctx, user.ID)
+	assert.NoError(t, err)
+}
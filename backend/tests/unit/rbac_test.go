@@ -0,0 +1,77 @@
+package unit
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"mobile-backend/middleware"
+	"mobile-backend/models"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func setupRBACRouter(roles, permissions []string, guard gin.HandlerFunc) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(func(c *gin.Context) {
+		c.Set("user_id", uint(1))
+		c.Set("user_roles", roles)
+		c.Set("user_permissions", permissions)
+		c.Next()
+	})
+	r.GET("/admin", guard, func(c *gin.Context) {
+		c.Status(http.StatusOK)
+	})
+	return r
+}
+
+func performRBACRequest(r *gin.Engine) int {
+	req, _ := http.NewRequest("GET", "/admin", nil)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w.Code
+}
+
+func TestRequireRole(t *testing.T) {
+	guard := middleware.RequireRole(models.RoleAdmin, models.RoleStaff)
+
+	assert.Equal(t, http.StatusOK, performRBACRequest(setupRBACRouter([]string{models.RoleStaff}, nil, guard)))
+	assert.Equal(t, http.StatusOK, performRBACRequest(setupRBACRouter([]string{models.RoleSuperAdmin}, nil, guard)))
+	assert.Equal(t, http.StatusForbidden, performRBACRequest(setupRBACRouter(nil, nil, guard)))
+	assert.Equal(t, http.StatusForbidden, performRBACRequest(setupRBACRouter([]string{"editor"}, nil, guard)))
+}
+
+func TestRequirePermission(t *testing.T) {
+	guard := middleware.RequirePermission(models.PermissionJobsManage, models.PermissionCacheManage)
+
+	all := []string{models.PermissionJobsManage, models.PermissionCacheManage}
+	assert.Equal(t, http.StatusOK, performRBACRequest(setupRBACRouter([]string{models.RoleAdmin}, all, guard)))
+
+	// Every permission is required
+	partial := []string{models.PermissionJobsManage}
+	assert.Equal(t, http.StatusForbidden, performRBACRequest(setupRBACRouter([]string{models.RoleAdmin}, partial, guard)))
+
+	// Superadmins bypass permission checks
+	assert.Equal(t, http.StatusOK, performRBACRequest(setupRBACRouter([]string{models.RoleSuperAdmin}, nil, guard)))
+}
+
+func TestRequireAnyPermission(t *testing.T) {
+	guard := middleware.RequireAnyPermission(models.PermissionJobsManage, models.PermissionCacheManage)
+
+	assert.Equal(t, http.StatusOK, performRBACRequest(setupRBACRouter(nil, []string{models.PermissionCacheManage}, guard)))
+	assert.Equal(t, http.StatusForbidden, performRBACRequest(setupRBACRouter(nil, []string{models.PermissionRolesManage}, guard)))
+}
+
+func TestRoleModel_HasPermission(t *testing.T) {
+	role := models.Role{
+		Name:        models.RoleStaff,
+		Permissions: []models.Permission{{Name: models.PermissionSubscriptionsRead}},
+	}
+	assert.True(t, role.HasPermission(models.PermissionSubscriptionsRead))
+	assert.False(t, role.HasPermission(models.PermissionJobsManage))
+
+	superAdmin := models.Role{Name: models.RoleSuperAdmin}
+	assert.True(t, superAdmin.HasPermission(models.PermissionJobsManage))
+}
@@ -0,0 +1,226 @@
+package unit
+
+import (
+	"context"
+	"encoding/json"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"mobile-backend/models"
+	"mobile-backend/services"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/stripe/stripe-go/v78"
+	"github.com/stripe/stripe-go/v78/webhook"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+type refundFixture struct {
+	db            *gorm.DB
+	statusService *services.SubscriptionStatusService
+	providers     *services.PaymentProviderRegistry
+	refunds       *services.RefundService
+	user          *models.User
+	sub           *models.Subscription
+}
+
+func newRefundFixture(t *testing.T) *refundFixture {
+	ctx := context.Background()
+	db := setupTestDB()
+	statusService := services.NewSubscriptionStatusService(db, zap.NewNop())
+	fake, err := services.NewFakePaymentProvider(db, statusService)
+	require.NoError(t, err)
+	providers := services.NewPaymentProviderRegistry("")
+	providers.Register(fake)
+
+	user := &models.User{Email: "refund@example.com", Password: "password123", Name: "Refund", IsActive: true}
+	require.NoError(t, db.Create(user).Error)
+	product, err := fake.CreateProduct(ctx, &models.Product{Name: "Pro", Price: 1000, Currency: "usd", IsActive: true})
+	require.NoError(t, err)
+	plan, err := fake.CreatePrice(ctx, &models.Plan{Name: "Pro monthly", ProductID: product.ID, Price: 1000, Currency: "usd", Interval: "month", IsActive: true})
+	require.NoError(t, err)
+	sub, err := fake.CreateSubscription(ctx, user.ID, plan.ID, "")
+	require.NoError(t, err)
+
+	return &refundFixture{
+		db:            db,
+		statusService: statusService,
+		providers:     providers,
+		refunds:       services.NewRefundService(db, providers, statusService, nil, nil, zap.NewNop()),
+		user:          user,
+		sub:           sub,
+	}
+}
+
+func (f *refundFixture) payment(t *testing.T, id uint) *models.Payment {
+	var payment models.Payment
+	require.NoError(t, f.db.First(&payment, id).Error)
+	return &payment
+}
+
+func (f *refundFixture) isPro(t *testing.T) bool {
+	var user models.User
+	require.NoError(t, f.db.First(&user, f.user.ID).Error)
+	return user.IsPro
+}
+
+func TestRefundService_RefundPayment(t *testing.T) {
+	ctx := context.Background()
+	f := newRefundFixture(t)
+	require.True(t, f.isPro(t))
+
+	var charge models.Payment
+	require.NoError(t, f.db.Where("subscription_id = ?", f.sub.ID).First(&charge).Error)
+
+	refund, err := f.refunds.RefundPayment(ctx, charge.ID, services.RefundRequest{Amount: 300, Reason: models.RefundReasonRequestedByCustomer, RequestedBy: 99})
+	require.NoError(t, err)
+	assert.Equal(t, models.RefundStatusSucceeded, refund.Status)
+	assert.NotEmpty(t, refund.ProviderRefundID)
+	payment := f.payment(t, charge.ID)
+	assert.Equal(t, "partially_refunded", payment.Status)
+	assert.Equal(t, int64(300), payment.RefundedAmount)
+	assert.True(t, f.isPro(t), "refunds keep access unless asked to revoke it")
+
+	_, err = f.refunds.RefundPayment(ctx, charge.ID, services.RefundRequest{Amount: 800})
+	assert.ErrorIs(t, err, services.ErrInvalidRefundAmount, "only 700 is left to refund")
+
+	// Without an amount the rest is refunded
+	refund, err = f.refunds.RefundPayment(ctx, charge.ID, services.RefundRequest{RevokeAccess: true})
+	require.NoError(t, err)
+	assert.Equal(t, int64(700), refund.Amount)
+	payment = f.payment(t, charge.ID)
+	assert.Equal(t, "refunded", payment.Status)
+	assert.NotNil(t, payment.RefundedAt)
+	assert.False(t, f.isPro(t))
+
+	_, err = f.refunds.RefundPayment(ctx, charge.ID, services.RefundRequest{})
+	assert.ErrorIs(t, err, services.ErrPaymentNotRefundable)
+	_, err = f.refunds.RefundPayment(ctx, charge.ID+100, services.RefundRequest{})
+	assert.ErrorIs(t, err, services.ErrPaymentNotFound)
+
+	refunds, err := f.refunds.ListRefunds(ctx, charge.ID)
+	require.NoError(t, err)
+	assert.Len(t, refunds, 2)
+}
+
+func TestRefundService_ConcurrentRefundsStayWithinPayment(t *testing.T) {
+	ctx := context.Background()
+	f := newRefundFixture(t)
+	// A single connection makes a held transaction block the other refund
+	sqlDB, err := f.db.DB()
+	require.NoError(t, err)
+	sqlDB.SetMaxOpenConns(1)
+
+	var charge models.Payment
+	require.NoError(t, f.db.Where("subscription_id = ?", f.sub.ID).First(&charge).Error)
+
+	// A second admin refunds the same payment right after this refund loaded it
+	var raced int32
+	done := make(chan error, 1)
+	require.NoError(t, f.db.Callback().Query().After("gorm:query").Register("test:race", func(db *gorm.DB) {
+		if db.Statement.Table != "payments" || !atomic.CompareAndSwapInt32(&raced, 0, 1) {
+			return
+		}
+		go func() {
+			_, err := f.refunds.RefundPayment(ctx, charge.ID, services.RefundRequest{Amount: 600})
+			done <- err
+		}()
+		select {
+		case err := <-done:
+			done <- err
+		case <-time.After(200 * time.Millisecond):
+		}
+	}))
+
+	_, err = f.refunds.RefundPayment(ctx, charge.ID, services.RefundRequest{Amount: 600})
+	require.NoError(t, err)
+	assert.ErrorIs(t, <-done, services.ErrInvalidRefundAmount, "only 400 is left once the first refund is recorded")
+
+	refunds, err := f.refunds.ListRefunds(ctx, charge.ID)
+	require.NoError(t, err)
+	assert.Len(t, refunds, 1)
+	assert.Equal(t, int64(600), f.payment(t, charge.ID).RefundedAmount)
+}
+
+func TestStripeWebhook_RefundsAndDisputes(t *testing.T) {
+	t.Setenv("STRIPE_WEBHOOK_SECRET", "whsec_test")
+	ctx := context.Background()
+	f := newRefundFixture(t)
+
+	stripeService := services.NewStripeService(f.db, nil, nil, f.statusService)
+	stripeService.SetRefundService(f.refunds)
+	charge := &models.Payment{
+		UserID:         f.user.ID,
+		ProductID:      f.sub.ProductID,
+		SubscriptionID: &f.sub.ID,
+		Amount:         1000,
+		Currency:       "usd",
+		Status:         "succeeded",
+		PaymentMethod:  "stripe",
+		StripeChargeID: "ch_test",
+	}
+	require.NoError(t, f.db.Create(charge).Error)
+
+	send := func(id, eventType string, object map[string]interface{}) {
+		payload, err := json.Marshal(map[string]interface{}{
+			"id":          id,
+			"object":      "event",
+			"api_version": stripe.APIVersion,
+			"type":        eventType,
+			"data":        map[string]interface{}{"object": object},
+		})
+		require.NoError(t, err)
+		signed := webhook.GenerateTestSignedPayload(&webhook.UnsignedPayload{Payload: payload, Secret: "whsec_test"})
+		require.NoError(t, stripeService.HandleWebhook(ctx, signed.Payload, signed.Header))
+	}
+
+	// A refund made in the Stripe dashboard
+	send("evt_refund", "charge.refunded", map[string]interface{}{
+		"id":     "ch_test",
+		"object": "charge",
+		"refunds": map[string]interface{}{
+			"object": "list",
+			"data": []map[string]interface{}{
+				{"id": "re_test", "object": "refund", "amount": 250, "currency": "usd", "status": "succeeded", "charge": "ch_test"},
+			},
+		},
+	})
+	assert.Equal(t, "partially_refunded", f.payment(t, charge.ID).Status)
+	assert.Equal(t, int64(250), f.payment(t, charge.ID).RefundedAmount)
+
+	dispute := map[string]interface{}{
+		"id":               "dp_test",
+		"object":           "dispute",
+		"amount":           750,
+		"currency":         "usd",
+		"charge":           "ch_test",
+		"reason":           "fraudulent",
+		"status":           "needs_response",
+		"evidence_details": map[string]interface{}{"due_by": time.Now().Add(7 * 24 * time.Hour).Unix()},
+	}
+	send("evt_dispute_created", "charge.dispute.created", dispute)
+	assert.Equal(t, "disputed", f.payment(t, charge.ID).Status)
+	assert.False(t, f.isPro(t), "an open chargeback pauses pro access")
+
+	var recorded models.Dispute
+	require.NoError(t, f.db.Where("provider_dispute_id = ?", "dp_test").First(&recorded).Error)
+	assert.True(t, recorded.AccessRevoked)
+	assert.NotNil(t, recorded.EvidenceDueBy)
+
+	dispute["status"] = "won"
+	send("evt_dispute_closed", "charge.dispute.closed", dispute)
+	assert.Equal(t, "partially_refunded", f.payment(t, charge.ID).Status)
+	assert.True(t, f.isPro(t), "winning the dispute restores the subscription's access")
+
+	require.NoError(t, f.db.First(&recorded, recorded.ID).Error)
+	assert.NotNil(t, recorded.ClosedAt)
+
+	open := true
+	disputes, total, err := f.refunds.ListDisputes(ctx, &open, 1, 20)
+	require.NoError(t, err)
+	assert.Zero(t, total)
+	assert.Empty(t, disputes)
+}
@@ -0,0 +1,189 @@
+package unit
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"mobile-backend/config"
+	"mobile-backend/middleware"
+	"mobile-backend/models"
+	"mobile-backend/services"
+	"mobile-backend/utils"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-redis/redis/v8"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+const testSigningSecret = "0123456789abcdef0123456789abcdef"
+
+func setupRequestSigningService(t *testing.T, mode string) *services.RequestSigningService {
+	t.Setenv("REQUEST_SIGNING_MODE", mode)
+	t.Setenv("REQUEST_SIGNING_SECRETS", "ios:"+testSigningSecret)
+
+	// Nothing listens on this address, so claiming a nonce always fails
+	client := redis.NewClient(&redis.Options{Addr: "127.0.0.1:1", MaxRetries: -1})
+	service, err := services.NewRequestSigningService(client, &config.Logger{Logger: zap.NewNop()})
+	require.NoError(t, err)
+	return service
+}
+
+func signedRequest(path, body, secret string, at time.Time) *http.Request {
+	req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(body))
+	timestamp := strconv.FormatInt(at.Unix(), 10)
+	nonce := "nonce-0123456789abcdef"
+	req.Header.Set(services.SigningClientIDHeader, "ios")
+	req.Header.Set(services.SigningTimestampHeader, timestamp)
+	req.Header.Set(services.SigningNonceHeader, nonce)
+	req.Header.Set(services.SignatureHeader, utils.SignRequest(secret, utils.RequestSigningPayload(http.MethodPost, path, timestamp, nonce, []byte(body))))
+	return req
+}
+
+func TestRequestSigningService_VerifyRequest(t *testing.T) {
+	ctx := context.Background()
+	body := `{"amount":999}`
+
+	_, err := services.NewRequestSigningService(nil, nil)
+	require.NoError(t, err, "signing is off by default")
+
+	t.Setenv("REQUEST_SIGNING_MODE", services.RequestSigningRequired)
+	_, err = services.NewRequestSigningService(nil, nil)
+	assert.Error(t, err, "required mode needs client secrets")
+
+	optional := setupRequestSigningService(t, services.RequestSigningOptional)
+	clientID, err := optional.VerifyRequest(ctx, httptest.NewRequest(http.MethodPost, "/api/v1/payments", nil), nil)
+	require.NoError(t, err, "unsigned requests pass in optional mode")
+	assert.Empty(t, clientID)
+
+	service := setupRequestSigningService(t, services.RequestSigningRequired)
+	_, err = service.VerifyRequest(ctx, httptest.NewRequest(http.MethodPost, "/api/v1/payments", nil), nil)
+	assert.ErrorIs(t, err, utils.ErrRequestSignatureMissing)
+
+	req := signedRequest("/api/v1/payments", body, "a-different-secret-of-enough-length", time.Now())
+	_, err = service.VerifyRequest(ctx, req, []byte(body))
+	assert.ErrorIs(t, err, utils.ErrInvalidRequestSignature)
+
+	req = signedRequest("/api/v1/payments", body, testSigningSecret, time.Now())
+	_, err = service.VerifyRequest(ctx, req, []byte(`{"amount":1}`))
+	assert.ErrorIs(t, err, utils.ErrInvalidRequestSignature, "the signature covers the body")
+
+	req = signedRequest("/api/v1/payments", body, testSigningSecret, time.Now().Add(-10*time.Minute))
+	_, err = service.VerifyRequest(ctx, req, []byte(body))
+	assert.ErrorIs(t, err, utils.ErrRequestSignatureExpired)
+
+	req = signedRequest("/api/v1/payments", body, testSigningSecret, time.Now())
+	req.Header.Set(services.SigningClientIDHeader, "android")
+	_, err = service.VerifyRequest(ctx, req, []byte(body))
+	assert.ErrorIs(t, err, utils.ErrUnknownSigningClient)
+
+	// A valid signature still needs its nonce recorded; without Redis the request is refused
+	req = signedRequest("/api/v1/payments", body, testSigningSecret, time.Now())
+	_, err = service.VerifyRequest(ctx, req, []byte(body))
+	require.Error(t, err)
+	assert.NotErrorIs(t, err, utils.ErrInvalidRequestSignature)
+}
+
+type fakeRequestVerifier struct {
+	err error
+}
+
+func (f *fakeRequestVerifier) VerifyRequest(ctx context.Context, r *http.Request, body []byte) (string, error) {
+	return "ios", f.err
+}
+
+func TestRequireSignedRequest(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	verifier := &fakeRequestVerifier{}
+	middleware.SetRequestVerifier(verifier)
+	t.Cleanup(func() { middleware.SetRequestVerifier(nil) })
+
+	r := gin.New()
+	r.POST("/payments", middleware.RequireSignedRequest(), func(c *gin.Context) {
+		c.String(http.StatusOK, c.GetString("signing_client_id"))
+	})
+	perform := func() *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/payments", strings.NewReader("{}")))
+		return w
+	}
+
+	w := perform()
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "ios", w.Body.String())
+
+	verifier.err = utils.ErrRequestReplayed
+	assert.Equal(t, http.StatusUnauthorized, perform().Code)
+
+	verifier.err = assert.AnError
+	assert.Equal(t, http.StatusServiceUnavailable, perform().Code, "infrastructure failures don't look like bad signatures")
+}
+
+func TestIdempotencyMiddleware(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	require.NoError(t, err)
+	require.NoError(t, db.AutoMigrate(&models.IdempotencyKey{}))
+	store, err := services.NewIdempotencyService(db, &config.Logger{Logger: zap.NewNop()})
+	require.NoError(t, err)
+	middleware.SetIdempotencyStore(store)
+	t.Cleanup(func() { middleware.SetIdempotencyStore(nil) })
+
+	var calls, failures int32
+	r := gin.New()
+	r.POST("/payments", func(c *gin.Context) { c.Set("user_id", uint(1)); c.Next() }, middleware.Idempotency(), func(c *gin.Context) {
+		if atomic.LoadInt32(&failures) > 0 {
+			atomic.AddInt32(&failures, -1)
+			c.JSON(http.StatusBadGateway, gin.H{"error": "provider unavailable"})
+			return
+		}
+		n := atomic.AddInt32(&calls, 1)
+		c.JSON(http.StatusCreated, gin.H{"payment": n})
+	})
+	perform := func(key, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/payments", bytes.NewBufferString(body))
+		if key != "" {
+			req.Header.Set(middleware.IdempotencyKeyHeader, key)
+		}
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	first := perform("key-1", `{"amount":999}`)
+	require.Equal(t, http.StatusCreated, first.Code)
+
+	retry := perform("key-1", `{"amount":999}`)
+	assert.Equal(t, http.StatusCreated, retry.Code)
+	assert.Equal(t, first.Body.String(), retry.Body.String())
+	assert.Equal(t, "true", retry.Header().Get("Idempotent-Replayed"))
+	assert.EqualValues(t, 1, atomic.LoadInt32(&calls), "the retry didn't run the handler")
+
+	assert.Equal(t, http.StatusUnprocessableEntity, perform("key-1", `{"amount":1}`).Code, "a key can't be reused for another request")
+
+	// Without a key every request runs
+	perform("", `{"amount":999}`)
+	assert.EqualValues(t, 2, atomic.LoadInt32(&calls))
+
+	// Server errors release the key so the client can retry
+	atomic.StoreInt32(&failures, 1)
+	assert.Equal(t, http.StatusBadGateway, perform("key-2", `{}`).Code)
+	assert.Equal(t, http.StatusCreated, perform("key-2", `{}`).Code)
+	assert.EqualValues(t, 3, atomic.LoadInt32(&calls))
+
+	// A request still in flight blocks retries
+	_, created, err := store.Begin(context.Background(), 1, "key-3", utils.HashToken("POST /payments\n{}"))
+	require.NoError(t, err)
+	require.True(t, created)
+	assert.Equal(t, http.StatusConflict, perform("key-3", `{}`).Code)
+}
@@ -0,0 +1,91 @@
+package unit
+
+import (
+	"context"
+	"testing"
+
+	"mobile-backend/config"
+	"mobile-backend/models"
+	"mobile-backend/services"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func setupSessionService(t *testing.T) (*services.SessionService, *gorm.DB) {
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	require.NoError(t, err)
+	require.NoError(t, db.AutoMigrate(&models.User{}, &models.Session{}))
+
+	return services.NewSessionService(db, nil, &config.Logger{Logger: zap.NewNop()}), db
+}
+
+func TestSessionService_RotateSession(t *testing.T) {
+	service, _ := setupSessionService(t)
+	ctx := context.Background()
+
+	session, tokenID, err := service.CreateSession(ctx, 1, services.SessionMetadata{DeviceID: "device-1"})
+	require.NoError(t, err)
+
+	rotated, nextTokenID, err := service.RotateSession(ctx, session.FamilyID, tokenID, services.SessionMetadata{})
+	require.NoError(t, err)
+	assert.Equal(t, session.ID, rotated.ID)
+	assert.NotEqual(t, tokenID, nextTokenID)
+
+	// The rotated token is still usable
+	_, _, err = service.RotateSession(ctx, session.FamilyID, nextTokenID, services.SessionMetadata{})
+	assert.NoError(t, err)
+}
+
+func TestSessionService_RotateSession_ReuseRevokesFamily(t *testing.T) {
+	service, _ := setupSessionService(t)
+	ctx := context.Background()
+
+	session, tokenID, err := service.CreateSession(ctx, 1, services.SessionMetadata{})
+	require.NoError(t, err)
+
+	_, nextTokenID, err := service.RotateSession(ctx, session.FamilyID, tokenID, services.SessionMetadata{})
+	require.NoError(t, err)
+
+	// Presenting the consumed token again is treated as theft
+	_, _, err = service.RotateSession(ctx, session.FamilyID, tokenID, services.SessionMetadata{})
+	assert.ErrorIs(t, err, services.ErrRefreshTokenReused)
+
+	// The legitimate holder's token is revoked along with the family
+	_, _, err = service.RotateSession(ctx, session.FamilyID, nextTokenID, services.SessionMetadata{})
+	assert.ErrorIs(t, err, services.ErrSessionRevoked)
+
+	active, err := service.IsSessionActive(ctx, session.FamilyID)
+	require.NoError(t, err)
+	assert.False(t, active)
+}
+
+func TestSessionService_RevokeAllSessions(t *testing.T) {
+	service, _ := setupSessionService(t)
+	ctx := context.Background()
+
+	current, _, err := service.CreateSession(ctx, 1, services.SessionMetadata{DeviceID: "phone"})
+	require.NoError(t, err)
+	_, _, err = service.CreateSession(ctx, 1, services.SessionMetadata{DeviceID: "tablet"})
+	require.NoError(t, err)
+	_, _, err = service.CreateSession(ctx, 2, services.SessionMetadata{DeviceID: "other-user"})
+	require.NoError(t, err)
+
+	require.NoError(t, service.RevokeAllSessions(ctx, 1, current.FamilyID, models.SessionRevokedLogoutAll))
+
+	sessions, err := service.ListActiveSessions(ctx, 1)
+	require.NoError(t, err)
+	require.Len(t, sessions, 1)
+	assert.Equal(t, current.ID, sessions[0].ID)
+
+	// Other users' sessions are untouched
+	sessions, err = service.ListActiveSessions(ctx, 2)
+	require.NoError(t, err)
+	assert.Len(t, sessions, 1)
+
+	// Users can only revoke their own sessions
+	assert.ErrorIs(t, service.RevokeSession(ctx, 2, current.ID, models.SessionRevokedByUser), services.ErrSessionNotFound)
+}
@@ -0,0 +1,165 @@
+package unit
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"mobile-backend/models"
+	"mobile-backend/services"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+type planChangeFixture struct {
+	db      *gorm.DB
+	fake    *services.FakePaymentProvider
+	service *services.SubscriptionChangeService
+	user    *models.User
+	product *models.Product
+	sub     *models.Subscription
+	// at is halfway through the subscription's current period
+	at time.Time
+}
+
+func newPlanChangeFixture(t *testing.T) *planChangeFixture {
+	ctx := context.Background()
+	db := setupTestDB()
+	statusService := services.NewSubscriptionStatusService(db, zap.NewNop())
+	fake, err := services.NewFakePaymentProvider(db, statusService)
+	require.NoError(t, err)
+	providers := services.NewPaymentProviderRegistry("")
+	providers.Register(fake)
+
+	user := &models.User{Email: "seats@example.com", Password: "password123", Name: "Seats", IsActive: true}
+	require.NoError(t, db.Create(user).Error)
+	product, err := fake.CreateProduct(ctx, &models.Product{Name: "Team", Price: 1000, Currency: "usd", IsActive: true})
+	require.NoError(t, err)
+
+	f := &planChangeFixture{
+		db:      db,
+		fake:    fake,
+		service: services.NewSubscriptionChangeService(db, providers, statusService, zap.NewNop()),
+		user:    user,
+		product: product,
+		at:      time.Now().Truncate(time.Second),
+	}
+
+	basic := f.plan(t, "Team monthly", 1000, "month")
+	f.sub, err = fake.CreateSubscription(ctx, user.ID, basic.ID, "")
+	require.NoError(t, err)
+	require.NoError(t, db.Model(f.sub).Updates(map[string]interface{}{
+		"current_period_start": f.at.Add(-15 * 24 * time.Hour),
+		"current_period_end":   f.at.Add(15 * 24 * time.Hour),
+	}).Error)
+	return f
+}
+
+func (f *planChangeFixture) plan(t *testing.T, name string, price int64, interval string) *models.Plan {
+	plan, err := f.fake.CreatePrice(context.Background(), &models.Plan{Name: name, ProductID: f.product.ID, Price: price, Currency: "usd", Interval: interval, IsActive: true})
+	require.NoError(t, err)
+	return plan
+}
+
+func (f *planChangeFixture) reload(t *testing.T) *models.Subscription {
+	var sub models.Subscription
+	require.NoError(t, f.db.First(&sub, f.sub.ID).Error)
+	return &sub
+}
+
+func TestSubscriptionChange_UpgradeIsProrated(t *testing.T) {
+	ctx := context.Background()
+	f := newPlanChangeFixture(t)
+	premium := f.plan(t, "Team premium", 3000, "month")
+	req := services.PlanChangeRequest{PlanID: premium.ID, ProrationDate: f.at}
+
+	preview, err := f.service.PreviewChange(ctx, f.user.ID, req)
+	require.NoError(t, err)
+	assert.Equal(t, services.PlanChangeImmediate, preview.Timing)
+	assert.Equal(t, int64(500), preview.Credit, "half of the current period is unused")
+	assert.Equal(t, int64(1500), preview.Charge)
+	assert.Equal(t, int64(1000), preview.AmountDue)
+	assert.Equal(t, f.at.Unix(), preview.ProrationDate)
+
+	sub, confirmed, err := f.service.ChangePlan(ctx, f.user.ID, req)
+	require.NoError(t, err)
+	assert.Equal(t, preview.AmountDue, confirmed.AmountDue, "confirming with the preview's date charges what it showed")
+	assert.Equal(t, premium.ID, *sub.PlanID)
+	assert.Nil(t, sub.ScheduledPlanID)
+
+	var proration models.Payment
+	require.NoError(t, f.db.Where("subscription_id = ? AND amount = ?", sub.ID, int64(1000)).First(&proration).Error)
+	assert.Equal(t, "succeeded", proration.Status)
+
+	// Seats on the new plan are prorated the same way
+	preview, err = f.service.PreviewChange(ctx, f.user.ID, services.PlanChangeRequest{Quantity: 3, ProrationDate: f.at})
+	require.NoError(t, err)
+	assert.Equal(t, services.PlanChangeImmediate, preview.Timing)
+	assert.Equal(t, int64(1500), preview.Credit)
+	assert.Equal(t, int64(4500), preview.Charge)
+	assert.Equal(t, int64(9000), preview.RecurringAmount)
+
+	// Moving to a longer interval bills a full new period
+	yearly := f.plan(t, "Team yearly", 40000, "year")
+	preview, err = f.service.PreviewChange(ctx, f.user.ID, services.PlanChangeRequest{PlanID: yearly.ID, ProrationDate: f.at})
+	require.NoError(t, err)
+	assert.Equal(t, services.PlanChangeImmediate, preview.Timing)
+	assert.Equal(t, int64(40000-1500), preview.AmountDue)
+	assert.Equal(t, f.at.AddDate(1, 0, 0).Unix(), preview.PeriodEnd.Unix())
+
+	_, err = f.service.PreviewChange(ctx, f.user.ID, services.PlanChangeRequest{PlanID: premium.ID, ProrationDate: time.Now().Add(-2 * time.Hour)})
+	assert.ErrorIs(t, err, services.ErrProrationQuoteExpired)
+	_, err = f.service.PreviewChange(ctx, f.user.ID, services.PlanChangeRequest{PlanID: premium.ID})
+	assert.ErrorIs(t, err, services.ErrInvalidPlanChange, "the subscription is already on the plan")
+}
+
+func TestSubscriptionChange_DowngradeWaitsForPeriodEnd(t *testing.T) {
+	ctx := context.Background()
+	f := newPlanChangeFixture(t)
+	starter := f.plan(t, "Team starter", 500, "month")
+
+	sub, preview, err := f.service.ChangePlan(ctx, f.user.ID, services.PlanChangeRequest{PlanID: starter.ID})
+	require.NoError(t, err)
+	assert.Equal(t, services.PlanChangePeriodEnd, preview.Timing)
+	assert.Zero(t, preview.AmountDue)
+	assert.NotEqual(t, starter.ID, *sub.PlanID, "the current plan is kept until the period ends")
+	require.NotNil(t, sub.ScheduledPlanID)
+	assert.Equal(t, starter.ID, *sub.ScheduledPlanID)
+	assert.Equal(t, sub.CurrentPeriodEnd.Unix(), sub.ScheduledChangeAt.Unix())
+
+	// Asking for the current plan again drops the downgrade
+	_, _, err = f.service.ChangePlan(ctx, f.user.ID, services.PlanChangeRequest{PlanID: *sub.PlanID})
+	require.NoError(t, err)
+	assert.Nil(t, f.reload(t).ScheduledPlanID)
+
+	_, _, err = f.service.ChangePlan(ctx, f.user.ID, services.PlanChangeRequest{PlanID: starter.ID})
+	require.NoError(t, err)
+	applied, err := f.service.ApplyScheduledChanges(ctx)
+	require.NoError(t, err)
+	assert.Zero(t, applied, "the period hasn't ended yet")
+
+	require.NoError(t, f.db.Model(&models.Subscription{}).Where("id = ?", f.sub.ID).Update("scheduled_change_at", time.Now().Add(-time.Minute)).Error)
+	applied, err = f.service.ApplyScheduledChanges(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 1, applied)
+
+	changed := f.reload(t)
+	assert.Equal(t, starter.ID, *changed.PlanID)
+	assert.Nil(t, changed.ScheduledPlanID)
+	assert.Nil(t, changed.ScheduledChangeAt)
+}
+
+func TestSubscriptionChange_StoreSubscriptionsAreRefused(t *testing.T) {
+	f := newPlanChangeFixture(t)
+	premium := f.plan(t, "Team premium", 3000, "month")
+	require.NoError(t, f.db.Model(f.sub).Update("payment_method", services.AppStorePaymentMethod).Error)
+
+	_, _, err := f.service.ChangePlan(context.Background(), f.user.ID, services.PlanChangeRequest{PlanID: premium.ID})
+	assert.ErrorIs(t, err, services.ErrStoreSubscriptionChange)
+
+	_, _, err = f.service.ChangePlan(context.Background(), f.user.ID+1, services.PlanChangeRequest{PlanID: premium.ID})
+	assert.ErrorIs(t, err, services.ErrNoActiveSubscription)
+}
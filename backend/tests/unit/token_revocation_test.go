@@ -0,0 +1,128 @@
+package unit
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"mobile-backend/middleware"
+	"mobile-backend/services"
+	"mobile-backend/utils"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTTLCache_EvictsLeastRecentlyUsed(t *testing.T) {
+	cache := utils.NewTTLCache[bool](2)
+	cache.Set("a", true, time.Minute)
+	cache.Set("b", true, time.Minute)
+
+	// Touch "a" so "b" is the least recently used entry
+	_, ok := cache.Get("a")
+	require.True(t, ok)
+	cache.Set("c", true, time.Minute)
+
+	_, ok = cache.Get("b")
+	assert.False(t, ok)
+	_, ok = cache.Get("a")
+	assert.True(t, ok)
+	assert.Equal(t, 2, cache.Len())
+}
+
+func TestTTLCache_ExpiresEntries(t *testing.T) {
+	cache := utils.NewTTLCache[string](10)
+	cache.Set("key", "value", 10*time.Millisecond)
+
+	value, ok := cache.Get("key")
+	require.True(t, ok)
+	assert.Equal(t, "value", value)
+
+	time.Sleep(20 * time.Millisecond)
+	_, ok = cache.Get("key")
+	assert.False(t, ok)
+}
+
+type fakeRevocationChecker struct {
+	revoked map[string]bool
+	err     error
+}
+
+func (f *fakeRevocationChecker) IsRevoked(ctx context.Context, claims *utils.Claims) (bool, error) {
+	return f.revoked[claims.ID] || f.revoked[claims.SessionID], f.err
+}
+
+func performAuthRequest(token string) int {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.GET("/me", middleware.AuthMiddleware(), func(c *gin.Context) {
+		c.Status(http.StatusOK)
+	})
+
+	req, _ := http.NewRequest("GET", "/me", nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w.Code
+}
+
+func TestAuthMiddleware_RejectsRevokedTokens(t *testing.T) {
+	t.Setenv("JWT_SECRET", "test-secret")
+	checker := &fakeRevocationChecker{revoked: map[string]bool{}}
+	middleware.SetTokenRevocationChecker(checker)
+	t.Cleanup(func() { middleware.SetTokenRevocationChecker(nil) })
+
+	token, _, err := utils.GenerateAccessAndRefreshTokensWithOptions(1, "user@example.com", utils.TokenOptions{SessionID: "family-1"})
+	require.NoError(t, err)
+	claims, err := utils.ValidateToken(token)
+	require.NoError(t, err)
+	require.NotEmpty(t, claims.ID, "access tokens carry a jti")
+
+	assert.Equal(t, http.StatusOK, performAuthRequest(token))
+
+	// Revoking the token itself
+	checker.revoked[claims.ID] = true
+	assert.Equal(t, http.StatusUnauthorized, performAuthRequest(token))
+
+	// Revoking the session the token belongs to
+	delete(checker.revoked, claims.ID)
+	checker.revoked["family-1"] = true
+	assert.Equal(t, http.StatusUnauthorized, performAuthRequest(token))
+}
+
+func TestAuthMiddleware_FailsClosedWhenRevocationCheckFails(t *testing.T) {
+	t.Setenv("JWT_SECRET", "test-secret")
+	middleware.SetTokenRevocationChecker(&fakeRevocationChecker{err: errors.New("redis unavailable")})
+	t.Cleanup(func() { middleware.SetTokenRevocationChecker(nil) })
+
+	token, err := utils.GenerateToken(1, "user@example.com")
+	require.NoError(t, err)
+
+	assert.Equal(t, http.StatusInternalServerError, performAuthRequest(token))
+}
+
+func TestTokenBlacklist_RevokeAllCoversTokensFromTheSameSecond(t *testing.T) {
+	client, _ := newFakeRedis(t)
+	blacklist := services.NewTokenBlacklistService(client)
+	ctx := context.Background()
+
+	require.NoError(t, blacklist.RevokeAllForUser(ctx, 7))
+	cutoff, err := client.Get(ctx, "blacklist:user:7").Int64()
+	require.NoError(t, err)
+
+	// Issue times are whole seconds, so a token from the revocation's second is revoked too
+	sameSecond := &utils.Claims{UserID: 7, RegisteredClaims: jwt.RegisteredClaims{ID: "same-second", IssuedAt: jwt.NewNumericDate(time.Unix(cutoff, 0))}}
+	revoked, err := blacklist.IsRevoked(ctx, sameSecond)
+	require.NoError(t, err)
+	assert.True(t, revoked)
+
+	later := &utils.Claims{UserID: 7, RegisteredClaims: jwt.RegisteredClaims{ID: "later", IssuedAt: jwt.NewNumericDate(time.Unix(cutoff+1, 0))}}
+	revoked, err = blacklist.IsRevoked(ctx, later)
+	require.NoError(t, err)
+	assert.False(t, revoked, "tokens issued after the revocation stay valid")
+}
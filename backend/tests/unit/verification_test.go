@@ -0,0 +1,94 @@
+package unit
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"mobile-backend/config"
+	"mobile-backend/models"
+	"mobile-backend/services"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func setupVerificationService(t *testing.T) (*services.VerificationService, *gorm.DB, *models.User) {
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	require.NoError(t, err)
+	require.NoError(t, db.AutoMigrate(&models.User{}, &models.Session{}, &models.VerificationToken{}))
+
+	user := &models.User{Email: "verify@example.com", Password: "password123", Name: "Verify", IsActive: true}
+	require.NoError(t, db.Create(user).Error)
+
+	// The job queue is only needed for sending emails, which these tests don't exercise
+	return services.NewVerificationService(db, nil, nil, nil, &config.Logger{Logger: zap.NewNop()}), db, user
+}
+
+func TestVerificationService_VerifyEmail(t *testing.T) {
+	service, _, user := setupVerificationService(t)
+	ctx := context.Background()
+
+	token, err := service.CreateToken(ctx, user.ID, models.TokenPurposeEmailVerification)
+	require.NoError(t, err)
+
+	verified, err := service.VerifyEmail(ctx, token)
+	require.NoError(t, err)
+	assert.True(t, verified.IsEmailVerified())
+
+	// Tokens are single use
+	_, err = service.VerifyEmail(ctx, token)
+	assert.ErrorIs(t, err, services.ErrInvalidVerificationToken)
+}
+
+func TestVerificationService_TokenPurposeAndExpiry(t *testing.T) {
+	service, db, user := setupVerificationService(t)
+	ctx := context.Background()
+
+	// A reset token can't be used to verify an email
+	resetToken, err := service.CreateToken(ctx, user.ID, models.TokenPurposePasswordReset)
+	require.NoError(t, err)
+	_, err = service.VerifyEmail(ctx, resetToken)
+	assert.ErrorIs(t, err, services.ErrInvalidVerificationToken)
+
+	// Expired tokens are rejected
+	token, err := service.CreateToken(ctx, user.ID, models.TokenPurposeEmailVerification)
+	require.NoError(t, err)
+	require.NoError(t, db.Model(&models.VerificationToken{}).Where("purpose = ?", models.TokenPurposeEmailVerification).
+		Update("expires_at", time.Now().Add(-time.Minute)).Error)
+	_, err = service.VerifyEmail(ctx, token)
+	assert.ErrorIs(t, err, services.ErrInvalidVerificationToken)
+}
+
+func TestVerificationService_ResetPassword(t *testing.T) {
+	service, db, user := setupVerificationService(t)
+	ctx := context.Background()
+
+	sessions := services.NewSessionService(db, nil, &config.Logger{Logger: zap.NewNop()})
+	_, _, err := sessions.CreateSession(ctx, user.ID, services.SessionMetadata{})
+	require.NoError(t, err)
+
+	first, err := service.CreateToken(ctx, user.ID, models.TokenPurposePasswordReset)
+	require.NoError(t, err)
+	second, err := service.CreateToken(ctx, user.ID, models.TokenPurposePasswordReset)
+	require.NoError(t, err)
+
+	reset, err := service.ResetPassword(ctx, first, "newpassword123")
+	require.NoError(t, err)
+	assert.Equal(t, user.ID, reset.ID)
+
+	var updated models.User
+	require.NoError(t, db.First(&updated, user.ID).Error)
+	assert.NoError(t, updated.CheckPassword("newpassword123"))
+	assert.True(t, updated.IsEmailVerified())
+
+	// Outstanding reset links are invalidated and every session is signed out
+	_, err = service.ResetPassword(ctx, second, "anotherpassword")
+	assert.ErrorIs(t, err, services.ErrInvalidVerificationToken)
+	active, err := sessions.ListActiveSessions(ctx, user.ID)
+	require.NoError(t, err)
+	assert.Empty(t, active)
+}
@@ -1,10 +1,17 @@
 package utils
 
 import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
 	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
 	"encoding/hex"
-
-	"golang.org/x/crypto/bcrypt"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
 )
 
 // GenerateRandomString generates a random string of specified length
@@ -16,19 +23,21 @@ func GenerateRandomString(length int) (string, error) {
 	return hex.EncodeToString(bytes), nil
 }
 
-// HashPassword hashes a password using bcrypt
-func HashPassword(password string) (string, error) {
-	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+// HashToken returns the hex-encoded SHA-256 digest of a token so it can be stored
+// and looked up without keeping the raw value
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// GenerateNumericCode generates a uniformly random code of the given number of decimal digits
+func GenerateNumericCode(digits int) (string, error) {
+	max := new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(digits)), nil)
+	n, err := rand.Int(rand.Reader, max)
 	if err != nil {
 		return "", err
 	}
-	return string(hashedPassword), nil
-}
-
-// CheckPasswordHash verifies a password against its hash
-func CheckPasswordHash(password, hash string) bool {
-	err := bcrypt.CompareHashAndPassword([]byte(hash), []byte(password))
-	return err == nil
+	return fmt.Sprintf("%0*d", digits, n), nil
 }
 
 // GenerateAPIKey generates a secure API key
@@ -40,3 +49,91 @@ func GenerateAPIKey() (string, error) {
 func GenerateSessionToken() (string, error) {
 	return GenerateRandomString(64)
 }
+
+// EncryptString encrypts plaintext with AES-256-GCM using a key derived from passphrase.
+// The result is base64 encoded and includes the nonce.
+func EncryptString(plaintext, passphrase string) (string, error) {
+	gcm, err := newGCM(passphrase)
+	if err != nil {
+		return "", err
+	}
+
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+
+	sealed := gcm.Seal(nonce, nonce, []byte(plaintext), nil)
+	return base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+// DecryptString reverses EncryptString
+func DecryptString(ciphertext, passphrase string) (string, error) {
+	gcm, err := newGCM(passphrase)
+	if err != nil {
+		return "", err
+	}
+
+	data, err := base64.StdEncoding.DecodeString(ciphertext)
+	if err != nil {
+		return "", err
+	}
+	if len(data) < gcm.NonceSize() {
+		return "", errors.New("ciphertext too short")
+	}
+
+	nonce, sealed := data[:gcm.NonceSize()], data[gcm.NonceSize():]
+	plaintext, err := gcm.Open(nil, nonce, sealed, nil)
+	if err != nil {
+		return "", err
+	}
+	return string(plaintext), nil
+}
+
+func newGCM(passphrase string) (cipher.AEAD, error) {
+	key := sha256.Sum256([]byte(passphrase))
+	block, err := aes.NewCipher(key[:])
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// GeneratePKCEVerifier creates a PKCE code verifier (RFC 7636)
+func GeneratePKCEVerifier() (string, error) {
+	bytes := make([]byte, 32)
+	if _, err := rand.Read(bytes); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(bytes), nil
+}
+
+// PKCEChallengeS256 derives the S256 code challenge for a PKCE code verifier
+func PKCEChallengeS256(verifier string) string {
+	sum := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// Reasons a signed request is rejected
+var (
+	ErrRequestSignatureMissing = errors.New("request signature is missing")
+	ErrUnknownSigningClient    = errors.New("unknown signing client")
+	ErrRequestSignatureExpired = errors.New("request timestamp is outside the allowed window")
+	ErrInvalidRequestSignature = errors.New("invalid request signature")
+	ErrRequestReplayed         = errors.New("request nonce has already been used")
+)
+
+// RequestSigningPayload builds the canonical string a client signs for a request: the
+// method, the path including its query string, the Unix timestamp, the nonce and the
+// hex SHA-256 of the body, joined by newlines
+func RequestSigningPayload(method, path, timestamp, nonce string, body []byte) string {
+	bodyHash := sha256.Sum256(body)
+	return strings.Join([]string{strings.ToUpper(method), path, timestamp, nonce, hex.EncodeToString(bodyHash[:])}, "\n")
+}
+
+// SignRequest returns the hex HMAC-SHA256 of a request signing payload under secret
+func SignRequest(secret, payload string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(payload))
+	return hex.EncodeToString(mac.Sum(nil))
+}
@@ -8,13 +8,73 @@ import (
 	"github.com/golang-jwt/jwt/v5"
 )
 
-type Claims struct {
+const (
+	// AccessTokenTTL is the lifetime of access tokens
+	AccessTokenTTL = 15 * time.Minute
+	// RefreshTokenTTL is the lifetime of refresh tokens and their sessions
+	RefreshTokenTTL = 7 * 24 * time.Hour
+	// MFAChallengeTTL is the lifetime of the challenge token issued when login requires a second factor
+	MFAChallengeTTL = 5 * time.Minute
+	// ImpersonationTokenTTL is the lifetime of access tokens issued to staff impersonating a user
+	ImpersonationTokenTTL = 15 * time.Minute
+	// PasswordChangeTokenTTL is the lifetime of the token issued when login finds the password expired
+	PasswordChangeTokenTTL = 10 * time.Minute
+)
+
+// Login methods recorded on MFA challenge tokens
+const (
+	AuthMethodPassword = "password"
+	AuthMethodExternal = "external"
+)
+
+// Actor identifies who is really behind a token issued on another user's behalf
+type Actor struct {
 	UserID uint   `json:"user_id"`
-	Email  string `json:"email"`
-	Type   string `json:"type"` // "access" or "refresh"
+	Email  string `json:"email,omitempty"`
+}
+
+type Claims struct {
+	UserID      uint     `json:"user_id"`
+	Email       string   `json:"email"`
+	Type        string   `json:"type"` // "access" or "refresh"
+	Roles       []string `json:"roles,omitempty"`
+	Permissions []string `json:"permissions,omitempty"`
+	SessionID   string   `json:"sid,omitempty"`
+	// OrganizationID is the session's active organization, used as the tenant when a
+	// request has no X-Organization-ID header
+	OrganizationID uint `json:"org_id,omitempty"`
+	// Actor is set on impersonation tokens: the token acts as UserID on the actor's behalf
+	Actor *Actor `json:"act,omitempty"`
+	// AuthMethod is set on MFA challenge tokens to how the first step of the login was passed
+	AuthMethod string `json:"amr,omitempty"`
 	jwt.RegisteredClaims
 }
 
+// IsImpersonation reports whether the token was issued to someone impersonating the user
+func (c *Claims) IsImpersonation() bool {
+	return c.Actor != nil
+}
+
+// HasRole checks if the claims carry the given role
+func (c *Claims) HasRole(role string) bool {
+	for _, r := range c.Roles {
+		if r == role {
+			return true
+		}
+	}
+	return false
+}
+
+// HasPermission checks if the claims carry the given permission
+func (c *Claims) HasPermission(permission string) bool {
+	for _, p := range c.Permissions {
+		if p == permission {
+			return true
+		}
+	}
+	return false
+}
+
 func GenerateToken(userID uint, email string) (string, error) {
 	return GenerateTokenPair(userID, email)
 }
@@ -25,43 +85,72 @@ func GenerateTokenPair(userID uint, email string) (string, error) {
 }
 
 func GenerateAccessAndRefreshTokens(userID uint, email string) (string, string, error) {
-	secret := os.Getenv("JWT_SECRET")
-	if secret == "" {
-		return "", "", errors.New("JWT_SECRET environment variable is required")
+	return GenerateAccessAndRefreshTokensWithOptions(userID, email, TokenOptions{})
+}
+
+// TokenOptions carries the optional claims embedded in a token pair
+type TokenOptions struct {
+	Roles          []string
+	Permissions    []string
+	SessionID      string // session family the pair belongs to
+	RefreshTokenID string // unique ID of the refresh token, used for rotation
+	OrganizationID uint   // active organization, embedded in the access token only
+}
+
+// GenerateAccessAndRefreshTokensWithOptions generates a token pair whose access token carries
+// the user's role and permission claims. Refresh tokens never carry authorization data so
+// that role changes take effect on the next refresh.
+func GenerateAccessAndRefreshTokensWithOptions(userID uint, email string, opts TokenOptions) (string, string, error) {
+	now := time.Now()
+
+	accessTokenID, err := GenerateRandomString(16)
+	if err != nil {
+		return "", "", err
+	}
+	refreshTokenID := opts.RefreshTokenID
+	if refreshTokenID == "" {
+		if refreshTokenID, err = GenerateRandomString(16); err != nil {
+			return "", "", err
+		}
 	}
 
-	// Generate access token (15 minutes)
+	// Generate access token
 	accessClaims := Claims{
-		UserID: userID,
-		Email:  email,
-		Type:   "access",
+		UserID:         userID,
+		Email:          email,
+		Type:           "access",
+		Roles:          opts.Roles,
+		Permissions:    opts.Permissions,
+		SessionID:      opts.SessionID,
+		OrganizationID: opts.OrganizationID,
 		RegisteredClaims: jwt.RegisteredClaims{
-			ExpiresAt: jwt.NewNumericDate(time.Now().Add(15 * time.Minute)),
-			IssuedAt:  jwt.NewNumericDate(time.Now()),
-			NotBefore: jwt.NewNumericDate(time.Now()),
+			ID:        accessTokenID,
+			ExpiresAt: jwt.NewNumericDate(now.Add(AccessTokenTTL)),
+			IssuedAt:  jwt.NewNumericDate(now),
+			NotBefore: jwt.NewNumericDate(now),
 		},
 	}
 
-	accessToken := jwt.NewWithClaims(jwt.SigningMethodHS256, accessClaims)
-	accessTokenString, err := accessToken.SignedString([]byte(secret))
+	accessTokenString, err := signClaims(accessClaims)
 	if err != nil {
 		return "", "", err
 	}
 
-	// Generate refresh token (7 days)
+	// Generate refresh token
 	refreshClaims := Claims{
-		UserID: userID,
-		Email:  email,
-		Type:   "refresh",
+		UserID:    userID,
+		Email:     email,
+		Type:      "refresh",
+		SessionID: opts.SessionID,
 		RegisteredClaims: jwt.RegisteredClaims{
-			ExpiresAt: jwt.NewNumericDate(time.Now().Add(7 * 24 * time.Hour)),
-			IssuedAt:  jwt.NewNumericDate(time.Now()),
-			NotBefore: jwt.NewNumericDate(time.Now()),
+			ID:        refreshTokenID,
+			ExpiresAt: jwt.NewNumericDate(now.Add(RefreshTokenTTL)),
+			IssuedAt:  jwt.NewNumericDate(now),
+			NotBefore: jwt.NewNumericDate(now),
 		},
 	}
 
-	refreshToken := jwt.NewWithClaims(jwt.SigningMethodHS256, refreshClaims)
-	refreshTokenString, err := refreshToken.SignedString([]byte(secret))
+	refreshTokenString, err := signClaims(refreshClaims)
 	if err != nil {
 		return "", "", err
 	}
@@ -69,6 +158,98 @@ func GenerateAccessAndRefreshTokens(userID uint, email string) (string, string,
 	return accessTokenString, refreshTokenString, nil
 }
 
+// GenerateImpersonationToken issues a short-lived access token that acts as the user on
+// the actor's behalf. It belongs to no session and comes without a refresh token. It
+// carries no roles or permissions, so it only grants what any signed-in user can do.
+func GenerateImpersonationToken(userID uint, email string, actor Actor) (string, time.Time, error) {
+	tokenID, err := GenerateRandomString(16)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+
+	now := time.Now()
+	expiresAt := now.Add(ImpersonationTokenTTL)
+	claims := Claims{
+		UserID: userID,
+		Email:  email,
+		Type:   "access",
+		Actor:  &actor,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        tokenID,
+			ExpiresAt: jwt.NewNumericDate(expiresAt),
+			IssuedAt:  jwt.NewNumericDate(now),
+			NotBefore: jwt.NewNumericDate(now),
+		},
+	}
+
+	token, err := signClaims(claims)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	return token, expiresAt, nil
+}
+
+// GenerateMFAChallengeToken issues a short-lived token proving the first step of a login,
+// passed with authMethod, succeeded. It can only be exchanged for a token pair at the MFA
+// verify endpoint.
+func GenerateMFAChallengeToken(userID uint, email, authMethod string) (string, error) {
+	tokenID, err := GenerateRandomString(16)
+	if err != nil {
+		return "", err
+	}
+
+	now := time.Now()
+	claims := Claims{
+		UserID:     userID,
+		Email:      email,
+		Type:       "mfa",
+		AuthMethod: authMethod,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        tokenID,
+			ExpiresAt: jwt.NewNumericDate(now.Add(MFAChallengeTTL)),
+			IssuedAt:  jwt.NewNumericDate(now),
+			NotBefore: jwt.NewNumericDate(now),
+		},
+	}
+
+	return signClaims(claims)
+}
+
+// ValidateMFAChallengeToken validates a token issued by GenerateMFAChallengeToken
+func ValidateMFAChallengeToken(tokenString string) (*Claims, error) {
+	return ValidateTokenWithType(tokenString, "mfa")
+}
+
+// GeneratePasswordChangeToken issues a short-lived token proving the user passed every
+// step of a login but their password has expired. It can only be exchanged for a token
+// pair together with a new password, so the user can't do anything else until then.
+func GeneratePasswordChangeToken(userID uint, email string) (string, error) {
+	tokenID, err := GenerateRandomString(16)
+	if err != nil {
+		return "", err
+	}
+
+	now := time.Now()
+	claims := Claims{
+		UserID: userID,
+		Email:  email,
+		Type:   "password_change",
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        tokenID,
+			ExpiresAt: jwt.NewNumericDate(now.Add(PasswordChangeTokenTTL)),
+			IssuedAt:  jwt.NewNumericDate(now),
+			NotBefore: jwt.NewNumericDate(now),
+		},
+	}
+
+	return signClaims(claims)
+}
+
+// ValidatePasswordChangeToken validates a token issued by GeneratePasswordChangeToken
+func ValidatePasswordChangeToken(tokenString string) (*Claims, error) {
+	return ValidateTokenWithType(tokenString, "password_change")
+}
+
 func ValidateToken(tokenString string) (*Claims, error) {
 	return ValidateTokenWithType(tokenString, "access")
 }
@@ -78,15 +259,7 @@ func ValidateRefreshToken(tokenString string) (*Claims, error) {
 }
 
 func ValidateTokenWithType(tokenString string, expectedType string) (*Claims, error) {
-	secret := os.Getenv("JWT_SECRET")
-	if secret == "" {
-		return nil, errors.New("JWT_SECRET environment variable is required")
-	}
-
-	token, err := jwt.ParseWithClaims(tokenString, &Claims{}, func(token *jwt.Token) (interface{}, error) {
-		return []byte(secret), nil
-	})
-
+	token, err := parseClaims(tokenString, &Claims{})
 	if err != nil {
 		return nil, err
 	}
@@ -100,3 +273,32 @@ func ValidateTokenWithType(tokenString string, expectedType string) (*Claims, er
 
 	return nil, errors.New("invalid token")
 }
+
+// signClaims signs claims with the installed keyring, falling back to HS256 with
+// JWT_SECRET when asymmetric signing hasn't been configured
+func signClaims(claims jwt.Claims) (string, error) {
+	if keyring := DefaultKeyring(); keyring != nil {
+		return keyring.Sign(claims)
+	}
+
+	secret := os.Getenv("JWT_SECRET")
+	if secret == "" {
+		return "", errors.New("JWT_SECRET environment variable is required")
+	}
+	return jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte(secret))
+}
+
+// parseClaims verifies a token signed by signClaims
+func parseClaims(tokenString string, claims jwt.Claims) (*jwt.Token, error) {
+	if keyring := DefaultKeyring(); keyring != nil {
+		return jwt.ParseWithClaims(tokenString, claims, keyring.Keyfunc, jwt.WithValidMethods(keyring.ValidMethods()))
+	}
+
+	secret := os.Getenv("JWT_SECRET")
+	if secret == "" {
+		return nil, errors.New("JWT_SECRET environment variable is required")
+	}
+	return jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
+		return []byte(secret), nil
+	}, jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}))
+}
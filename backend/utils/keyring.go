@@ -0,0 +1,335 @@
+package utils
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// Supported asymmetric signing algorithms
+const (
+	SigningAlgRS256 = "RS256"
+	SigningAlgEdDSA = "EdDSA"
+)
+
+var (
+	ErrNoSigningKey      = errors.New("no active signing key")
+	ErrUnknownKeyID      = errors.New("unknown signing key id")
+	ErrAlgorithmMismatch = errors.New("token algorithm does not match signing key")
+)
+
+// SigningKey is a key pair in the keyring. Keys without a private key can only verify.
+type SigningKey struct {
+	ID          string
+	Algorithm   string
+	PrivateKey  crypto.Signer
+	PublicKey   crypto.PublicKey
+	ActivatesAt time.Time // the key signs new tokens from this time on
+	ExpiresAt   time.Time // the key is dropped after this time; zero means never
+}
+
+func (k *SigningKey) method() jwt.SigningMethod {
+	if k.Algorithm == SigningAlgEdDSA {
+		return jwt.SigningMethodEdDSA
+	}
+	return jwt.SigningMethodRS256
+}
+
+func (k *SigningKey) usable(now time.Time) bool {
+	return k.ExpiresAt.IsZero() || now.Before(k.ExpiresAt)
+}
+
+// Keyring holds the keys used to sign and verify JWTs. The newest activated key signs;
+// every unexpired key verifies, so tokens survive rotation until they expire.
+type Keyring struct {
+	mu           sync.RWMutex
+	keys         map[string]*SigningKey
+	legacySecret []byte
+	legacyUntil  time.Time
+}
+
+// NewKeyring creates a keyring. When legacySecret is set, HS256 tokens issued before
+// asymmetric signing was enabled (which carry no kid) are still accepted until
+// legacyUntil, after which anyone holding the old secret can no longer mint tokens.
+func NewKeyring(keys []*SigningKey, legacySecret string, legacyUntil time.Time) *Keyring {
+	k := &Keyring{legacySecret: []byte(legacySecret), legacyUntil: legacyUntil}
+	k.SetKeys(keys)
+	return k
+}
+
+// SetKeys replaces the keys in the keyring
+func (k *Keyring) SetKeys(keys []*SigningKey) {
+	byID := make(map[string]*SigningKey, len(keys))
+	for _, key := range keys {
+		byID[key.ID] = key
+	}
+
+	k.mu.Lock()
+	k.keys = byID
+	k.mu.Unlock()
+}
+
+// SigningKey returns the key currently used to sign tokens
+func (k *Keyring) SigningKey() (*SigningKey, error) {
+	now := time.Now()
+
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+
+	var current *SigningKey
+	for _, key := range k.keys {
+		if key.PrivateKey == nil || key.ActivatesAt.After(now) || !key.usable(now) {
+			continue
+		}
+		if current == nil || key.ActivatesAt.After(current.ActivatesAt) {
+			current = key
+		}
+	}
+	if current == nil {
+		return nil, ErrNoSigningKey
+	}
+	return current, nil
+}
+
+// Sign signs the claims with the active key and sets the kid header
+func (k *Keyring) Sign(claims jwt.Claims) (string, error) {
+	key, err := k.SigningKey()
+	if err != nil {
+		return "", err
+	}
+
+	token := jwt.NewWithClaims(key.method(), claims)
+	token.Header["kid"] = key.ID
+	return token.SignedString(key.PrivateKey)
+}
+
+// Keyfunc resolves the verification key for a token. The token's algorithm must match
+// the algorithm registered for its kid, which prevents algorithm confusion attacks.
+func (k *Keyring) Keyfunc(token *jwt.Token) (interface{}, error) {
+	kid, _ := token.Header["kid"].(string)
+	if kid == "" {
+		if k.acceptsLegacy() && token.Method.Alg() == jwt.SigningMethodHS256.Alg() {
+			return k.legacySecret, nil
+		}
+		return nil, ErrUnknownKeyID
+	}
+
+	k.mu.RLock()
+	key, ok := k.keys[kid]
+	k.mu.RUnlock()
+	if !ok || !key.usable(time.Now()) {
+		return nil, ErrUnknownKeyID
+	}
+	if token.Method.Alg() != key.method().Alg() {
+		return nil, ErrAlgorithmMismatch
+	}
+	return key.PublicKey, nil
+}
+
+// ValidMethods lists the algorithms the keyring accepts
+func (k *Keyring) ValidMethods() []string {
+	methods := []string{SigningAlgRS256, SigningAlgEdDSA}
+	if k.acceptsLegacy() {
+		methods = append(methods, jwt.SigningMethodHS256.Alg())
+	}
+	return methods
+}
+
+// acceptsLegacy reports whether legacy HS256 tokens are still inside their migration window
+func (k *Keyring) acceptsLegacy() bool {
+	return len(k.legacySecret) > 0 && time.Now().Before(k.legacyUntil)
+}
+
+// JWK is a public key in JSON Web Key format (RFC 7517)
+type JWK struct {
+	KeyType   string `json:"kty"`
+	Use       string `json:"use"`
+	KeyID     string `json:"kid"`
+	Algorithm string `json:"alg"`
+	N         string `json:"n,omitempty"`
+	E         string `json:"e,omitempty"`
+	Curve     string `json:"crv,omitempty"`
+	X         string `json:"x,omitempty"`
+	Y         string `json:"y,omitempty"`
+}
+
+// PublicKey decodes the JWK into an RSA, ECDSA or Ed25519 public key
+func (j JWK) PublicKey() (crypto.PublicKey, error) {
+	decode := base64.RawURLEncoding.DecodeString
+	switch j.KeyType {
+	case "RSA":
+		n, err := decode(j.N)
+		if err != nil {
+			return nil, fmt.Errorf("invalid RSA modulus: %w", err)
+		}
+		e, err := decode(j.E)
+		if err != nil {
+			return nil, fmt.Errorf("invalid RSA exponent: %w", err)
+		}
+		return &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}, nil
+	case "EC":
+		var curve elliptic.Curve
+		switch j.Curve {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		default:
+			return nil, fmt.Errorf("unsupported EC curve %q", j.Curve)
+		}
+		x, err := decode(j.X)
+		if err != nil {
+			return nil, fmt.Errorf("invalid EC x coordinate: %w", err)
+		}
+		y, err := decode(j.Y)
+		if err != nil {
+			return nil, fmt.Errorf("invalid EC y coordinate: %w", err)
+		}
+		return &ecdsa.PublicKey{Curve: curve, X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}, nil
+	case "OKP":
+		if j.Curve != "Ed25519" {
+			return nil, fmt.Errorf("unsupported OKP curve %q", j.Curve)
+		}
+		x, err := decode(j.X)
+		if err != nil || len(x) != ed25519.PublicKeySize {
+			return nil, errors.New("invalid Ed25519 public key")
+		}
+		return ed25519.PublicKey(x), nil
+	default:
+		return nil, fmt.Errorf("unsupported key type %q", j.KeyType)
+	}
+}
+
+// JWKSet is a JSON Web Key Set
+type JWKSet struct {
+	Keys []JWK `json:"keys"`
+}
+
+// JWKS returns the public verification keys, including keys published ahead of activation
+func (k *Keyring) JWKS() JWKSet {
+	now := time.Now()
+
+	k.mu.RLock()
+	keys := make([]*SigningKey, 0, len(k.keys))
+	for _, key := range k.keys {
+		if key.usable(now) {
+			keys = append(keys, key)
+		}
+	}
+	k.mu.RUnlock()
+
+	sort.Slice(keys, func(i, j int) bool { return keys[i].ActivatesAt.After(keys[j].ActivatesAt) })
+
+	set := JWKSet{Keys: make([]JWK, 0, len(keys))}
+	for _, key := range keys {
+		jwk := JWK{Use: "sig", KeyID: key.ID, Algorithm: key.Algorithm}
+		switch pub := key.PublicKey.(type) {
+		case *rsa.PublicKey:
+			jwk.KeyType = "RSA"
+			jwk.N = base64.RawURLEncoding.EncodeToString(pub.N.Bytes())
+			jwk.E = base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes())
+		case ed25519.PublicKey:
+			jwk.KeyType = "OKP"
+			jwk.Curve = "Ed25519"
+			jwk.X = base64.RawURLEncoding.EncodeToString(pub)
+		default:
+			continue
+		}
+		set.Keys = append(set.Keys, jwk)
+	}
+	return set
+}
+
+// GenerateSigningKey creates a new key pair for the given algorithm
+func GenerateSigningKey(algorithm string) (*SigningKey, error) {
+	kid, err := GenerateRandomString(8)
+	if err != nil {
+		return nil, err
+	}
+
+	key := &SigningKey{ID: kid, Algorithm: algorithm}
+	switch algorithm {
+	case SigningAlgRS256:
+		private, err := rsa.GenerateKey(rand.Reader, 2048)
+		if err != nil {
+			return nil, err
+		}
+		key.PrivateKey, key.PublicKey = private, &private.PublicKey
+	case SigningAlgEdDSA:
+		public, private, err := ed25519.GenerateKey(rand.Reader)
+		if err != nil {
+			return nil, err
+		}
+		key.PrivateKey, key.PublicKey = private, public
+	default:
+		return nil, fmt.Errorf("unsupported signing algorithm %q", algorithm)
+	}
+	return key, nil
+}
+
+// MarshalPrivateKeyPEM encodes a private key as PKCS#8 PEM
+func MarshalPrivateKeyPEM(key crypto.Signer) (string, error) {
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return "", err
+	}
+	return string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})), nil
+}
+
+// ParsePrivateKeyPEM decodes a PKCS#8 PEM private key
+func ParsePrivateKeyPEM(data string) (crypto.Signer, error) {
+	block, _ := pem.Decode([]byte(data))
+	if block == nil {
+		return nil, errors.New("invalid PEM private key")
+	}
+
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+
+	switch k := key.(type) {
+	case *rsa.PrivateKey:
+		return k, nil
+	case *ecdsa.PrivateKey:
+		return k, nil
+	case ed25519.PrivateKey:
+		return k, nil
+	default:
+		return nil, errors.New("unsupported private key type")
+	}
+}
+
+var (
+	defaultKeyringMu sync.RWMutex
+	defaultKeyring   *Keyring
+)
+
+// SetDefaultKeyring installs the keyring used by the package-level token functions.
+// Until one is installed, tokens are signed with HS256 and JWT_SECRET.
+func SetDefaultKeyring(k *Keyring) {
+	defaultKeyringMu.Lock()
+	defaultKeyring = k
+	defaultKeyringMu.Unlock()
+}
+
+// DefaultKeyring returns the installed keyring, or nil
+func DefaultKeyring() *Keyring {
+	defaultKeyringMu.RLock()
+	defer defaultKeyringMu.RUnlock()
+	return defaultKeyring
+}
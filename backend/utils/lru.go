@@ -0,0 +1,87 @@
+package utils
+
+import (
+	"container/list"
+	"sync"
+	"time"
+)
+
+// TTLCache is a small thread-safe LRU cache whose entries also expire after a TTL.
+// It is meant for hot-path lookups in front of Redis.
+type TTLCache[V any] struct {
+	mu       sync.Mutex
+	capacity int
+	items    map[string]*list.Element
+	order    *list.List
+}
+
+type ttlCacheEntry[V any] struct {
+	key       string
+	value     V
+	expiresAt time.Time
+}
+
+// NewTTLCache creates a cache holding at most capacity entries
+func NewTTLCache[V any](capacity int) *TTLCache[V] {
+	return &TTLCache[V]{
+		capacity: capacity,
+		items:    make(map[string]*list.Element, capacity),
+		order:    list.New(),
+	}
+}
+
+// Get returns the value for key if present and not expired
+func (c *TTLCache[V]) Get(key string) (V, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var zero V
+	elem, ok := c.items[key]
+	if !ok {
+		return zero, false
+	}
+
+	entry := elem.Value.(*ttlCacheEntry[V])
+	if time.Now().After(entry.expiresAt) {
+		c.order.Remove(elem)
+		delete(c.items, key)
+		return zero, false
+	}
+
+	c.order.MoveToFront(elem)
+	return entry.value, true
+}
+
+// Set stores value under key for the given TTL, evicting the least recently used entry when full
+func (c *TTLCache[V]) Set(key string, value V, ttl time.Duration) {
+	if ttl <= 0 {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if elem, ok := c.items[key]; ok {
+		entry := elem.Value.(*ttlCacheEntry[V])
+		entry.value = value
+		entry.expiresAt = time.Now().Add(ttl)
+		c.order.MoveToFront(elem)
+		return
+	}
+
+	if c.order.Len() >= c.capacity {
+		if oldest := c.order.Back(); oldest != nil {
+			c.order.Remove(oldest)
+			delete(c.items, oldest.Value.(*ttlCacheEntry[V]).key)
+		}
+	}
+
+	c.items[key] = c.order.PushFront(&ttlCacheEntry[V]{key: key, value: value, expiresAt: time.Now().Add(ttl)})
+}
+
+// Len returns the number of cached entries, including expired ones not yet evicted
+func (c *TTLCache[V]) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.order.Len()
+}
@@ -0,0 +1,204 @@
+package utils
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Password hashing algorithms
+const (
+	PasswordHashBcrypt   = "bcrypt"
+	PasswordHashArgon2id = "argon2id"
+)
+
+const (
+	argon2SaltLength = 16
+	argon2KeyLength  = 32
+	// bcryptMaxPasswordBytes is the longest input bcrypt accepts
+	bcryptMaxPasswordBytes = 72
+	// argon2MaxPasswordBytes caps argon2id input to keep hashing cost predictable
+	argon2MaxPasswordBytes = 1024
+)
+
+// ErrPasswordMismatch is returned when a password does not match its stored hash
+var ErrPasswordMismatch = errors.New("password does not match")
+
+// PasswordHashParams selects the algorithm and cost used for new password hashes
+type PasswordHashParams struct {
+	Algorithm     string
+	BcryptCost    int
+	Argon2Time    uint32
+	Argon2Memory  uint32 // KiB
+	Argon2Threads uint8
+}
+
+// DefaultPasswordHashParams are used until SetPasswordHashParams is called
+var DefaultPasswordHashParams = PasswordHashParams{
+	Algorithm:     PasswordHashBcrypt,
+	BcryptCost:    12,
+	Argon2Time:    3,
+	Argon2Memory:  64 * 1024,
+	Argon2Threads: 2,
+}
+
+// Validate checks that the parameters describe a usable hash
+func (p PasswordHashParams) Validate() error {
+	switch p.Algorithm {
+	case PasswordHashBcrypt:
+		if p.BcryptCost < bcrypt.MinCost || p.BcryptCost > bcrypt.MaxCost {
+			return fmt.Errorf("bcrypt cost must be between %d and %d", bcrypt.MinCost, bcrypt.MaxCost)
+		}
+	case PasswordHashArgon2id:
+		if p.Argon2Time < 1 || p.Argon2Memory < 8*uint32(p.Argon2Threads) || p.Argon2Threads < 1 {
+			return errors.New("argon2id needs at least one iteration, one thread and 8 KiB of memory per thread")
+		}
+	default:
+		return fmt.Errorf("unsupported password hash algorithm %q", p.Algorithm)
+	}
+	return nil
+}
+
+// MaxPasswordBytes is the longest password the algorithm hashes without truncation
+func (p PasswordHashParams) MaxPasswordBytes() int {
+	if p.Algorithm == PasswordHashArgon2id {
+		return argon2MaxPasswordBytes
+	}
+	return bcryptMaxPasswordBytes
+}
+
+var (
+	passwordHashParamsMu sync.RWMutex
+	passwordHashParams   = DefaultPasswordHashParams
+)
+
+// SetPasswordHashParams changes how new passwords are hashed. Existing hashes keep
+// verifying and are upgraded when PasswordNeedsRehash reports them as outdated.
+func SetPasswordHashParams(params PasswordHashParams) error {
+	if err := params.Validate(); err != nil {
+		return err
+	}
+	passwordHashParamsMu.Lock()
+	passwordHashParams = params
+	passwordHashParamsMu.Unlock()
+	return nil
+}
+
+// CurrentPasswordHashParams returns the parameters used for new password hashes
+func CurrentPasswordHashParams() PasswordHashParams {
+	passwordHashParamsMu.RLock()
+	defer passwordHashParamsMu.RUnlock()
+	return passwordHashParams
+}
+
+// HashPassword hashes a password with the current algorithm and cost
+func HashPassword(password string) (string, error) {
+	params := CurrentPasswordHashParams()
+	if params.Algorithm == PasswordHashArgon2id {
+		return hashArgon2id(password, params)
+	}
+
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), params.BcryptCost)
+	if err != nil {
+		return "", err
+	}
+	return string(hashedPassword), nil
+}
+
+// VerifyPassword checks a password against a bcrypt or argon2id hash
+func VerifyPassword(password, hash string) error {
+	if strings.HasPrefix(hash, "$argon2id$") {
+		params, salt, key, err := decodeArgon2id(hash)
+		if err != nil {
+			return err
+		}
+		candidate := argon2.IDKey([]byte(password), salt, params.Argon2Time, params.Argon2Memory, params.Argon2Threads, uint32(len(key)))
+		if subtle.ConstantTimeCompare(candidate, key) != 1 {
+			return ErrPasswordMismatch
+		}
+		return nil
+	}
+
+	if err := bcrypt.CompareHashAndPassword([]byte(hash), []byte(password)); err != nil {
+		if errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) {
+			return ErrPasswordMismatch
+		}
+		return err
+	}
+	return nil
+}
+
+// CheckPasswordHash verifies a password against its hash
+func CheckPasswordHash(password, hash string) bool {
+	return VerifyPassword(password, hash) == nil
+}
+
+// PasswordNeedsRehash reports whether a hash was made with a different algorithm or a
+// weaker cost than the current parameters
+func PasswordNeedsRehash(hash string) bool {
+	params := CurrentPasswordHashParams()
+
+	if strings.HasPrefix(hash, "$argon2id$") {
+		if params.Algorithm != PasswordHashArgon2id {
+			return true
+		}
+		stored, _, _, err := decodeArgon2id(hash)
+		return err != nil || stored.Argon2Time < params.Argon2Time ||
+			stored.Argon2Memory < params.Argon2Memory || stored.Argon2Threads < params.Argon2Threads
+	}
+
+	if params.Algorithm != PasswordHashBcrypt {
+		return true
+	}
+	cost, err := bcrypt.Cost([]byte(hash))
+	return err != nil || cost < params.BcryptCost
+}
+
+// hashArgon2id encodes the hash in the PHC string format used by the reference implementation
+func hashArgon2id(password string, params PasswordHashParams) (string, error) {
+	salt := make([]byte, argon2SaltLength)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+	key := argon2.IDKey([]byte(password), salt, params.Argon2Time, params.Argon2Memory, params.Argon2Threads, argon2KeyLength)
+
+	return fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s",
+		argon2.Version, params.Argon2Memory, params.Argon2Time, params.Argon2Threads,
+		base64.RawStdEncoding.EncodeToString(salt), base64.RawStdEncoding.EncodeToString(key),
+	), nil
+}
+
+func decodeArgon2id(hash string) (PasswordHashParams, []byte, []byte, error) {
+	params := PasswordHashParams{Algorithm: PasswordHashArgon2id}
+	invalid := errors.New("invalid argon2id hash")
+
+	parts := strings.Split(hash, "$")
+	if len(parts) != 6 {
+		return params, nil, nil, invalid
+	}
+
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil || version != argon2.Version {
+		return params, nil, nil, invalid
+	}
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &params.Argon2Memory, &params.Argon2Time, &params.Argon2Threads); err != nil {
+		return params, nil, nil, invalid
+	}
+
+	salt, err := base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil {
+		return params, nil, nil, invalid
+	}
+	key, err := base64.RawStdEncoding.DecodeString(parts[5])
+	if err != nil || len(key) == 0 {
+		return params, nil, nil, invalid
+	}
+	return params, salt, key, nil
+}
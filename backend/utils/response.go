@@ -75,6 +75,22 @@ func SendCreatedResponse(c *gin.Context, data interface{}, message string) {
 	c.JSON(http.StatusCreated, response)
 }
 
+// SendAcceptedResponse sends a response for work that will be completed in the background
+func SendAcceptedResponse(c *gin.Context, data interface{}, message string) {
+	requestID := c.GetString("request_id")
+	traceID := c.GetString("trace_id")
+
+	response := SuccessResponse{
+		Success:   true,
+		Message:   message,
+		Data:      data,
+		RequestID: requestID,
+		TraceID:   traceID,
+	}
+
+	c.JSON(http.StatusAccepted, response)
+}
+
 // FormatTime formats time for API responses
 func FormatTime(t time.Time) string {
 	return t.Format(time.RFC3339)
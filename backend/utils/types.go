@@ -11,6 +11,10 @@ type UserResponse struct {
 	CreatedAt time.Time `json:"created_at"`
 	UpdatedAt time.Time `json:"updated_at"`
 
+	EmailVerifiedAt *time.Time `json:"email_verified_at,omitempty"`
+	// IsGuest marks an anonymous account that hasn't been upgraded yet
+	IsGuest bool `json:"is_guest,omitempty"`
+
 	// Subscription status fields
 	SubscriptionStatus   string     `json:"subscription_status"`
 	IsPro                bool       `json:"is_pro"`
@@ -29,6 +33,28 @@ type LoginResponse struct {
 	ExpiresIn    int          `json:"expires_in"`
 }
 
+// GuestLoginResponse is returned by guest sign in. GuestSecret is only set when the guest
+// was just created; the device must keep it to sign in as the guest again.
+type GuestLoginResponse struct {
+	LoginResponse
+	GuestSecret string `json:"guest_secret,omitempty"`
+}
+
+// MFAChallengeResponse is returned by login when a second factor is required
+type MFAChallengeResponse struct {
+	MFARequired bool   `json:"mfa_required"`
+	MFAToken    string `json:"mfa_token"`
+	ExpiresIn   int    `json:"expires_in"`
+}
+
+// PasswordChangeResponse is returned by login instead of a token pair when the user's
+// password has expired
+type PasswordChangeResponse struct {
+	PasswordExpired     bool   `json:"password_expired"`
+	PasswordChangeToken string `json:"password_change_token"`
+	ExpiresIn           int    `json:"expires_in"`
+}
+
 // RefreshTokenResponse represents a refresh token response
 type RefreshTokenResponse struct {
 	AccessToken  string `json:"access_token"`
@@ -36,6 +62,27 @@ type RefreshTokenResponse struct {
 	ExpiresIn    int    `json:"expires_in"`
 }
 
+// ImpersonationResponse is returned when staff start impersonating a user
+type ImpersonationResponse struct {
+	User        UserResponse `json:"user"`
+	AccessToken string       `json:"access_token"`
+	ExpiresIn   int          `json:"expires_in"`
+	ExpiresAt   time.Time    `json:"expires_at"`
+}
+
+// SessionResponse represents an active session on one of the user's devices
+type SessionResponse struct {
+	ID         uint       `json:"id"`
+	DeviceID   string     `json:"device_id,omitempty"`
+	DeviceName string     `json:"device_name,omitempty"`
+	UserAgent  string     `json:"user_agent,omitempty"`
+	IPAddress  string     `json:"ip_address,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+	ExpiresAt  time.Time  `json:"expires_at"`
+	Current    bool       `json:"current"`
+}
+
 // parseValidationErrors converts validation errors to ValidationError slice
 func parseValidationErrors(err error) []ValidationError {
 	// This is a placeholder implementation